@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/auth"
+	gweb "schedule-management-api/internal/grpcweb"
+	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/health"
+	"schedule-management-api/internal/store/memstore"
+)
+
+func testServers(t *testing.T, handler http.Handler, timeout time.Duration) (servers, *health.Checker) {
+	t.Helper()
+	gl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := health.New(func(context.Context) error { return nil }).WithTimings(time.Second, 10*time.Millisecond)
+	g := grpc.NewServer()
+	healthpb.RegisterHealthServer(g, hc)
+	return servers{
+		grpc: g, grpcLis: gl,
+		http: &http.Server{Handler: handler}, httpLis: hl,
+		health: hc, timeout: timeout,
+	}, hc
+}
+
+// an HTTP request in flight when shutdown starts still completes
+func TestServeDrainsHTTP(t *testing.T) {
+	started := make(chan struct{})
+	hnd := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	s, hc := testServers(t, hnd, 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, s) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.httpLis.Addr().String() + "/slow")
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		got <- result{body: string(b)}
+	}()
+
+	<-started
+	cancel() // the SIGTERM equivalent
+
+	r := <-got
+	if r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request cut off: %q %v", r.body, r.err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return")
+	}
+	if hc.Ready(context.Background()) == nil {
+		t.Error("readiness should be off after shutdown")
+	}
+	if _, err := net.DialTimeout("tcp", s.httpLis.Addr().String(), 100*time.Millisecond); err == nil {
+		t.Error("http listener still accepting")
+	}
+}
+
+// a stream that never ends can't hold shutdown past the deadline
+func TestServeForcesStopAfterTimeout(t *testing.T) {
+	s, _ := testServers(t, http.NotFoundHandler(), 200*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, s) }()
+
+	conn, err := grpc.NewClient(s.grpcLis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("recv: %v", err)
+	}
+
+	start := time.Now()
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(3 * time.Second):
+		t.Fatal("serve didn't return")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("shutdown took %s with a 200ms timeout", d)
+	}
+}
+
+// one port takes a native grpc client and a grpc-web request alike
+func TestSinglePort(t *testing.T) {
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	srv := grpc.NewServer()
+	pb.RegisterScheduleServiceServer(srv, h)
+	bridge, err := gweb.New("", h, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") }))
+	mux.Handle("/", bridge.Handler())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := health.New(func(context.Context) error { return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, servers{grpc: srv, http: singlePort(srv, mux), httpLis: lis, health: hc, timeout: time.Second})
+	}()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	}()
+	addr := lis.Addr().String()
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	info, err := pb.NewScheduleServiceClient(conn).GetServerInfo(context.Background(), &pb.GetServerInfoRequest{})
+	if err != nil || len(info.Capabilities) == 0 {
+		t.Fatalf("grpc: %v %v", info, err)
+	}
+
+	resp, err := http.Post("http://"+addr+"/appointment.v1.ScheduleService/GetServerInfo",
+		"application/grpc-web+proto", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || len(body) < 5 || body[0] != 0 {
+		t.Fatalf("grpc-web: %s %q", resp.Proto, body)
+	}
+	var webInfo pb.ServerInfo
+	if err := proto.Unmarshal(body[5:5+binary.BigEndian.Uint32(body[1:5])], &webInfo); err != nil || !proto.Equal(&webInfo, info) {
+		t.Errorf("grpc-web reply %v, grpc %v (%v)", &webInfo, info, err)
+	}
+	if !bytes.Contains(body, []byte("grpc-status:0")) {
+		t.Errorf("grpc-web trailer: %q", body)
+	}
+
+	resp, err = http.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("plain http: %q", body)
+	}
+}
+
+// selfSigned writes a certificate for 127.0.0.1 and its key to dir,
+// returning their paths.
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// with TLS on, a browser's Login reaches the grpc server through a bridge
+// that dials it over TLS, every hop encrypted
+func TestTLS(t *testing.T) {
+	certFile, keyFile := selfSigned(t, t.TempDir())
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("GRPC_WEB_UPSTREAM_TLS", "true")
+	t.Setenv("GRPC_WEB_UPSTREAM_CA", certFile)
+	tlsCfg, err := serverTLS()
+	if err != nil || tlsCfg == nil {
+		t.Fatalf("serverTLS: %v %v", tlsCfg, err)
+	}
+	upTLS, err := upstreamTLS()
+	if err != nil || upTLS == nil {
+		t.Fatalf("upstreamTLS: %v %v", upTLS, err)
+	}
+
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	if _, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "tls@test.com", Password: "testpass123", Name: "TLS"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsCfg)))
+	pb.RegisterAuthServiceServer(srv, h)
+	gl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge, err := gweb.New(gl.Addr().String(), nil, keys, gweb.WithUpstreamTLS(upTLS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Close()
+	hl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, servers{
+			grpc: srv, grpcLis: gl,
+			http: &http.Server{Handler: bridge.Handler(), TLSConfig: tlsCfg}, httpLis: tls.NewListener(hl, tlsCfg),
+			health: health.New(func(context.Context) error { return nil }), timeout: time.Second,
+		})
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: upTLS}}
+	msg, _ := proto.Marshal(&pb.LoginRequest{Email: "tls@test.com", Password: "testpass123"})
+	body := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+	resp, err := client.Post("https://"+hl.Addr().String()+"/appointment.v1.AuthService/Login",
+		"application/grpc-web+proto", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.TLS == nil || len(out) < 5 || out[0] != 0 {
+		t.Fatalf("login over https: %q", out)
+	}
+	var login pb.LoginResponse
+	if err := proto.Unmarshal(out[5:5+binary.BigEndian.Uint32(out[1:5])], &login); err != nil || login.Token == "" {
+		t.Errorf("login: %v %v", &login, err)
+	}
+
+	// plaintext gets nowhere on either port: the https one answers the
+	// failed handshake with a bare 400 and never reaches the bridge
+	plain, err := http.Post("http://"+hl.Addr().String()+"/appointment.v1.AuthService/Login", "application/grpc-web+proto", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("plain http: %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest || plain.Header.Get("Content-Type") == "application/grpc-web+proto" {
+		t.Errorf("plain http served: %d %s", plain.StatusCode, plain.Header.Get("Content-Type"))
+	}
+	conn, err := grpc.NewClient(gl.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := pb.NewAuthServiceClient(conn).Login(context.Background(), &pb.LoginRequest{Email: "tls@test.com", Password: "testpass123"}); err == nil {
+		t.Error("plaintext grpc client served")
+	}
+}
+
+// plaintext unless asked, and half a configuration is an error
+func TestTLSConfigFromEnv(t *testing.T) {
+	for _, k := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_AUTOCERT_DIR", "TLS_AUTOCERT_HOSTS", "GRPC_WEB_UPSTREAM_TLS", "GRPC_WEB_UPSTREAM_CA"} {
+		t.Setenv(k, "")
+	}
+	if cfg, err := serverTLS(); cfg != nil || err != nil {
+		t.Errorf("default server: %v %v", cfg, err)
+	}
+	if cfg, err := upstreamTLS(); cfg != nil || err != nil {
+		t.Errorf("default upstream: %v %v", cfg, err)
+	}
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	if _, err := serverTLS(); err == nil {
+		t.Error("cert without key accepted")
+	}
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_AUTOCERT_DIR", t.TempDir())
+	if _, err := serverTLS(); err == nil {
+		t.Error("autocert without hosts accepted")
+	}
+	t.Setenv("TLS_AUTOCERT_HOSTS", "api.example.com")
+	if cfg, err := serverTLS(); err != nil || cfg.GetCertificate == nil {
+		t.Errorf("autocert: %v %v", cfg, err)
+	}
+	t.Setenv("GRPC_WEB_UPSTREAM_CA", "ca.pem")
+	if _, err := upstreamTLS(); err == nil {
+		t.Error("CA without GRPC_WEB_UPSTREAM_TLS accepted")
+	}
+}
+
+func TestHTTPTimeoutsFromEnv(t *testing.T) {
+	for _, k := range []string{"HTTP_READ_HEADER_TIMEOUT", "HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT"} {
+		t.Setenv(k, "")
+	}
+	hto, err := httpTimeouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hto != (httpTimeout{readHeader: 5 * time.Second, read: 30 * time.Second, write: 30 * time.Second, idle: 2 * time.Minute}) {
+		t.Errorf("defaults: %+v", hto)
+	}
+	var srv http.Server
+	hto.server(&srv)
+	if srv.ReadHeaderTimeout != 5*time.Second || srv.IdleTimeout != 2*time.Minute || srv.ReadTimeout != 0 || srv.WriteTimeout != 0 {
+		t.Errorf("server: %v %v %v %v", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	t.Setenv("HTTP_WRITE_TIMEOUT", "5m")
+	t.Setenv("HTTP_IDLE_TIMEOUT", "0")
+	if hto, err := httpTimeouts(); err != nil || hto.write != 5*time.Minute || hto.idle != 0 {
+		t.Errorf("overrides: %+v %v", hto, err)
+	}
+	t.Setenv("HTTP_READ_TIMEOUT", "soon")
+	if _, err := httpTimeouts(); err == nil {
+		t.Error("bad duration accepted")
+	}
+}
+
+// on a single port the write timeout cuts a slow http response off but
+// not a native grpc stream that outlives it
+func TestSinglePortTimeouts(t *testing.T) {
+	srv := grpc.NewServer()
+	hc := health.New(func(context.Context) error { return nil })
+	healthpb.RegisterHealthServer(srv, hc)
+	hto := httpTimeout{read: 200 * time.Millisecond, write: 200 * time.Millisecond}
+	mux := http.NewServeMux()
+	mux.Handle("/slow", hto.deadlines(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(400 * time.Millisecond)
+		io.WriteString(w, "late")
+	})))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpSrv := singlePort(srv, mux)
+	hto.server(httpSrv)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, servers{grpc: srv, http: httpSrv, httpLis: lis, health: hc, timeout: time.Second})
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+	addr := lis.Addr().String()
+
+	if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) == "late" {
+			t.Error("slow response outlived the write timeout")
+		}
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	wctx, wcancel := context.WithCancel(context.Background())
+	defer wcancel()
+	watch, err := healthpb.NewHealthClient(conn).Watch(wctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	recv := make(chan error, 1)
+	go func() {
+		_, err := watch.Recv()
+		recv <- err
+	}()
+	select {
+	case err := <-recv:
+		t.Fatalf("watch ended: %v", err)
+	case <-time.After(3 * hto.write):
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS is the TLS config of both listeners: the pair in TLS_CERT_FILE
+// and TLS_KEY_FILE, or certificates from Let's Encrypt for the names in
+// TLS_AUTOCERT_HOSTS, cached in TLS_AUTOCERT_DIR (the first request for a
+// name has to reach this server on :443 for the challenge). nil, meaning
+// plaintext, when none of them is set.
+func serverTLS() (*tls.Config, error) {
+	cert, key, dir := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"), os.Getenv("TLS_AUTOCERT_DIR")
+	switch {
+	case cert == "" && key == "" && dir == "":
+		return nil, nil
+	case dir != "" && (cert != "" || key != ""):
+		return nil, errors.New("set TLS_CERT_FILE/TLS_KEY_FILE or TLS_AUTOCERT_DIR, not both")
+	case dir != "":
+		var hosts []string
+		for _, h := range strings.Split(os.Getenv("TLS_AUTOCERT_HOSTS"), ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+		if len(hosts) == 0 {
+			return nil, errors.New("TLS_AUTOCERT_DIR needs TLS_AUTOCERT_HOSTS")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(dir),
+			HostPolicy: autocert.HostWhitelist(hosts...),
+		}
+		cfg := m.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg, nil
+	case cert == "" || key == "":
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE go together")
+	}
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("TLS_CERT_FILE/TLS_KEY_FILE: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// upstreamTLS is how the bridge dials GRPC_WEB_UPSTREAM: over TLS when
+// GRPC_WEB_UPSTREAM_TLS is true, trusting the PEM bundle in
+// GRPC_WEB_UPSTREAM_CA if set and the system roots otherwise. nil for
+// plaintext.
+func upstreamTLS() (*tls.Config, error) {
+	ca := os.Getenv("GRPC_WEB_UPSTREAM_CA")
+	if env("GRPC_WEB_UPSTREAM_TLS", "") != "true" {
+		if ca != "" {
+			return nil, errors.New("GRPC_WEB_UPSTREAM_CA needs GRPC_WEB_UPSTREAM_TLS=true")
+		}
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("GRPC_WEB_UPSTREAM_CA: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("GRPC_WEB_UPSTREAM_CA: no certificates in it")
+		}
+	}
+	return cfg, nil
+}
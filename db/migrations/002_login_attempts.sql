@@ -0,0 +1,9 @@
+-- failed logins per email (lowercased), for lockout. Unknown emails are
+-- tracked too, so a lockout doesn't tell an attacker the account exists.
+-- A row is deleted on successful login.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    email VARCHAR(255) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    first_failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ
+);
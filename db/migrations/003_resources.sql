@@ -0,0 +1,15 @@
+-- shared rooms and equipment. A resource can be booked by one confirmed
+-- appointment at a time, whoever owns it; no_resource_overlap backs the
+-- check the store does first, the way no_time_overlap does per user.
+CREATE TABLE IF NOT EXISTS resources (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS resource_id UUID REFERENCES resources(id);
+
+ALTER TABLE appointments ADD CONSTRAINT no_resource_overlap
+    EXCLUDE USING gist (resource_id WITH =, tstzrange(start_time, end_time, '[)') WITH &&)
+    WHERE (status = 'confirmed' AND resource_id IS NOT NULL);
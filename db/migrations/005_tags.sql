@@ -0,0 +1,5 @@
+-- free-form labels ("client", "internal") the calendar can filter on. The
+-- handler lower-cases and dedups them; the GIN index serves the && filter.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_appointments_tags ON appointments USING gin (tags);
@@ -0,0 +1,12 @@
+-- when each user takes bookings: weekly windows on the wall clock of
+-- time_zone, as [{"weekday":1,"start":540,"end":1020}, ...] with weekday
+-- 0 = Sunday and start/end in minutes since midnight (end <= start runs
+-- past midnight). No windows means any time. Only enforced on create and
+-- on moves when enforce is set; existing appointments are never touched.
+CREATE TABLE IF NOT EXISTS user_availability (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    time_zone TEXT NOT NULL DEFAULT 'UTC',
+    windows JSONB NOT NULL DEFAULT '[]',
+    enforce BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+-- per-user scheduling settings. buffer_minutes is kept free before and
+-- after each of the user's confirmed appointments on create and on moves;
+-- it's checked by the server, not a constraint, so what's already booked
+-- is never touched. No row means the defaults.
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    buffer_minutes INTEGER NOT NULL DEFAULT 0 CHECK (buffer_minutes BETWEEN 0 AND 240),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- ListUpcomingAppointments walks a user's confirmed appointments in start
+-- order and stops after a handful.
+CREATE INDEX IF NOT EXISTS idx_appointments_user_upcoming
+    ON appointments(user_id, start_time) WHERE (status = 'confirmed');
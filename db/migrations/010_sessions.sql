@@ -0,0 +1,4 @@
+-- where each refresh token was issued, for the session list. Rows from
+-- before this have neither.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- group events: up to capacity other users can add themselves as
+-- attendees. 0 keeps an appointment private, attendees only by the owner.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS capacity INTEGER NOT NULL DEFAULT 0
+    CHECK (capacity >= 0);
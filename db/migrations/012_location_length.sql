@@ -0,0 +1,3 @@
+-- locations get up to 500 characters (pasted addresses and dial-in
+-- details ran past 300). Widening a varchar doesn't rewrite the table.
+ALTER TABLE appointments ALTER COLUMN location TYPE VARCHAR(500);
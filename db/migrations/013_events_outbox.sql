@@ -0,0 +1,20 @@
+-- events outbox for internal consumers: one row per appointment change,
+-- written in the change's transaction and drained to the message bus by
+-- the relay. seq orders the events of one appointment; a row is done once
+-- published_at is set. Failed publishes are retried, never given up on.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    seq BIGSERIAL NOT NULL UNIQUE,
+    type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(aggregate_id, seq)
+    WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(next_attempt_at)
+    WHERE published_at IS NULL;
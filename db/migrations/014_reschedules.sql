@@ -0,0 +1,16 @@
+-- RescheduleAppointment: each move keeps the times it replaced, and the
+-- appointment counts how often it was moved.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS reschedule_count INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS appointment_reschedules (
+    id BIGSERIAL PRIMARY KEY,
+    appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    old_start TIMESTAMPTZ NOT NULL,
+    old_end TIMESTAMPTZ NOT NULL,
+    new_start TIMESTAMPTZ NOT NULL,
+    new_end TIMESTAMPTZ NOT NULL,
+    rescheduled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    rescheduled_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_appointment_reschedules_appointment
+    ON appointment_reschedules(appointment_id, id);
@@ -0,0 +1,11 @@
+-- all-day events run midnight to midnight in their time zone and don't take
+-- up anyone's time: no_time_overlap only holds timed appointments apart.
+-- Whether all-day events conflict with each other is the store's call
+-- (SetAllDayConflicts), so no constraint backs that.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS all_day BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS no_time_overlap;
+ALTER TABLE appointments ADD CONSTRAINT no_time_overlap
+    EXCLUDE USING gist (user_id WITH =, tstzrange(start_time, end_time, '[)') WITH &&)
+    WHERE (status = 'confirmed' AND NOT all_day);
@@ -0,0 +1,5 @@
+-- a per-user counter the handler bumps on every write to a user's
+-- appointments. Writes return it and ListAppointments takes it back as
+-- min_version, so a cached list older than the caller's own last write
+-- is read again instead of served.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS schedule_version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- appointment_audit.actor_id named its user with no foreign key, so once
+-- a purge removed an actor the entry pointed at nobody. It references
+-- users now and goes NULL when they're purged; the entry itself stays,
+-- since the change still happened to an appointment that's still there.
+ALTER TABLE appointment_audit ALTER COLUMN actor_id DROP NOT NULL;
+
+UPDATE appointment_audit SET actor_id = NULL
+WHERE actor_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = appointment_audit.actor_id);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'appointment_audit_actor_id_fkey'
+          AND conrelid = 'appointment_audit'::regclass
+    ) THEN
+        ALTER TABLE appointment_audit ADD CONSTRAINT appointment_audit_actor_id_fkey
+            FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL;
+    END IF;
+END $$;
@@ -0,0 +1,6 @@
+-- a key only proved the retry came from the same client, not that it was
+-- the same request: reusing one with a different body quietly got the
+-- first appointment back. Each key now carries a hash of the request it
+-- was first used with. Keys from before have none and match any request
+-- until they expire.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS request_hash TEXT;
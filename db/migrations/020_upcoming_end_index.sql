@@ -0,0 +1,7 @@
+-- ListUpcomingAppointments filters on end_time > now, which the
+-- (user_id, start_time) index from 009 can't seek on: it read every past
+-- appointment of the user to throw it away. This one starts the scan at
+-- the first appointment that hasn't ended; what's left to sort is only
+-- the user's future.
+CREATE INDEX IF NOT EXISTS idx_appointments_user_end
+    ON appointments(user_id, end_time) WHERE (status = 'confirmed');
@@ -0,0 +1,5 @@
+-- published events were never deleted. `cmd/admin purge-outbox-events`
+-- now drops the ones published longer than EVENTS_RETENTION ago, and
+-- finds them through this index instead of scanning the table.
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published ON outbox_events(published_at)
+    WHERE published_at IS NOT NULL;
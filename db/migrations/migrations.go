@@ -0,0 +1,8 @@
+// Package migrations embeds the schema files so the server binary carries
+// them; the runner is store.Migrate.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,318 @@
+// Package apperr is the catalog of machine-readable error reasons. Every
+// error a handler returns carries one as an errdetails.ErrorInfo (reason +
+// Domain), so clients can branch on the reason instead of the message, and
+// several failures can share a gRPC code without being confused. The
+// grpc-web bridge repeats it as JSON in the x-error-info trailer.
+//
+// Reasons are part of the API: never rename or reuse one, only add.
+//
+// Messages follow the caller's locale (see Localize); the code and the
+// reason don't.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/i18n"
+)
+
+// Domain is the ErrorInfo domain of every reason in the catalog.
+const Domain = "schedule-management-api"
+
+type Reason string
+
+const (
+	// general
+	Internal           Reason = "INTERNAL"
+	NotFound           Reason = "NOT_FOUND"
+	InvalidArgument    Reason = "INVALID_ARGUMENT"
+	BadPageToken       Reason = "BAD_PAGE_TOKEN"
+	FeatureUnavailable Reason = "FEATURE_UNAVAILABLE"
+	RateLimited        Reason = "RATE_LIMITED"
+	ServerBusy         Reason = "SERVER_BUSY"
+	DeadlineExceeded   Reason = "DEADLINE_EXCEEDED"
+	Canceled           Reason = "CANCELED"
+	MethodUnknown      Reason = "METHOD_UNKNOWN"
+
+	// grpc-web bridge
+	BadFrame               Reason = "BAD_FRAME"
+	MessageTooLarge        Reason = "MESSAGE_TOO_LARGE"
+	CompressionUnsupported Reason = "COMPRESSION_UNSUPPORTED"
+
+	// auth and accounts
+	AuthRequired           Reason = "AUTH_REQUIRED"
+	AuthTokenInvalid       Reason = "AUTH_TOKEN_INVALID"
+	AuthTokenExpired       Reason = "AUTH_TOKEN_EXPIRED"
+	AuthInvalidCredentials Reason = "AUTH_INVALID_CREDENTIALS"
+	AuthAccountDeleted     Reason = "AUTH_ACCOUNT_DELETED"
+	AuthLocked             Reason = "AUTH_LOCKED"
+	AuthRegistrationFailed Reason = "AUTH_REGISTRATION_FAILED"
+	AuthResetTokenInvalid  Reason = "AUTH_RESET_TOKEN_INVALID"
+	AuthRefreshInvalid     Reason = "AUTH_REFRESH_INVALID"
+	AuthPasswordTooShort   Reason = "AUTH_PASSWORD_TOO_SHORT"
+	AuthPasswordUnchanged  Reason = "AUTH_PASSWORD_UNCHANGED"
+	AuthEmailImmutable     Reason = "AUTH_EMAIL_IMMUTABLE"
+	AuthEmailUnverified    Reason = "AUTH_EMAIL_UNVERIFIED"
+	AuthVerifyTokenInvalid Reason = "AUTH_VERIFY_TOKEN_INVALID"
+	AdminOnly              Reason = "ADMIN_ONLY"
+
+	// appointments
+	ApptConflict     Reason = "APPT_CONFLICT"
+	ApptPast         Reason = "APPT_PAST"
+	ApptEmptyRange   Reason = "APPT_EMPTY_RANGE"
+	ApptFrozen       Reason = "APPT_FROZEN"
+	ApptUnavailable  Reason = "APPT_UNAVAILABLE"
+	ApptBuffer       Reason = "APPT_BUFFER"
+	ApptFull         Reason = "APPT_FULL"
+	ApptCancelled    Reason = "APPT_CANCELLED"
+	ApptKeyReused    Reason = "APPT_KEY_REUSED"
+	BatchTooLarge    Reason = "BATCH_TOO_LARGE"
+	ListRangeInvalid Reason = "LIST_RANGE_INVALID"
+
+	// calendars
+	CalendarNotFound  Reason = "CALENDAR_NOT_FOUND"
+	CalendarExists    Reason = "CALENDAR_EXISTS"
+	CalendarIsDefault Reason = "CALENDAR_IS_DEFAULT"
+	CalendarInUse     Reason = "CALENDAR_IN_USE"
+
+	// resources
+	ResourceNotFound Reason = "RESOURCE_NOT_FOUND"
+	ResourceBooked   Reason = "RESOURCE_BOOKED"
+	ResourceExists   Reason = "RESOURCE_EXISTS"
+
+	// webhooks
+	WebhookNotFound Reason = "WEBHOOK_NOT_FOUND"
+	WebhookLimit    Reason = "WEBHOOK_LIMIT"
+
+	// organizations
+	OrgNotFound      Reason = "ORG_NOT_FOUND"
+	OrgOwnerOnly     Reason = "ORG_OWNER_ONLY"
+	OrgAlreadyMember Reason = "ORG_ALREADY_MEMBER"
+	OrgInviteInvalid Reason = "ORG_INVITE_INVALID"
+)
+
+// Entry is one catalog row: the reason, the gRPC code it always travels
+// with, and what it means.
+type Entry struct {
+	Reason Reason
+	Code   codes.Code
+	Doc    string
+}
+
+var catalog = []Entry{
+	{Internal, codes.Internal, "something failed on the server; the message says nothing more on purpose"},
+	{NotFound, codes.NotFound, "no such resource, or it isn't the caller's"},
+	{InvalidArgument, codes.InvalidArgument, "a field is missing, too long or malformed; the message names it"},
+	{BadPageToken, codes.InvalidArgument, "page_token isn't one this server handed out"},
+	{FeatureUnavailable, codes.FailedPrecondition, "the database isn't migrated for this feature"},
+	{RateLimited, codes.ResourceExhausted, "too many requests from this client, back off"},
+	{ServerBusy, codes.ResourceExhausted, "the server is overloaded, retry shortly"},
+	{DeadlineExceeded, codes.DeadlineExceeded, "the request deadline passed before it could finish"},
+	{Canceled, codes.Canceled, "the client went away"},
+	{MethodUnknown, codes.Unimplemented, "no such service or method on this server"},
+
+	{BadFrame, codes.InvalidArgument, "the grpc-web body isn't a valid frame or message"},
+	{MessageTooLarge, codes.ResourceExhausted, "the request message is over the bridge's size limit"},
+	{CompressionUnsupported, codes.Unimplemented, "compressed grpc-web frames aren't supported"},
+
+	{AuthRequired, codes.Unauthenticated, "no access token was sent"},
+	{AuthTokenInvalid, codes.Unauthenticated, "the access token is malformed, forged or for another environment"},
+	{AuthTokenExpired, codes.Unauthenticated, "the access token has expired; refresh it and retry"},
+	{AuthInvalidCredentials, codes.Unauthenticated, "wrong email or password, or the session is gone"},
+	{AuthAccountDeleted, codes.Unauthenticated, "the account was deleted"},
+	{AuthLocked, codes.Unauthenticated, "too many failed logins for this email; try again after the lockout"},
+	{AuthRegistrationFailed, codes.AlreadyExists, "the account couldn't be created (the email may be taken)"},
+	{AuthResetTokenInvalid, codes.InvalidArgument, "the password reset code is wrong, used or expired"},
+	{AuthRefreshInvalid, codes.Unauthenticated, "the refresh token is unknown, already used, revoked or expired; log in again"},
+	{AuthPasswordTooShort, codes.InvalidArgument, "the new password is shorter than the minimum"},
+	{AuthPasswordUnchanged, codes.InvalidArgument, "the new password is the same as the current one"},
+	{AuthEmailImmutable, codes.InvalidArgument, "the email address can't be changed"},
+	{AuthEmailUnverified, codes.FailedPrecondition, "the server requires a verified email before login; use the emailed code"},
+	{AuthVerifyTokenInvalid, codes.InvalidArgument, "the email verification code is wrong, used or expired"},
+	{AdminOnly, codes.PermissionDenied, "the caller isn't an admin"},
+
+	{ApptConflict, codes.AlreadyExists, "the slot overlaps another confirmed appointment"},
+	{ApptPast, codes.InvalidArgument, "the appointment would start in the past"},
+	{ApptEmptyRange, codes.InvalidArgument, "the end isn't after the start"},
+	{ApptFrozen, codes.FailedPrecondition, "the slot is inside a freeze window; the message has its reason"},
+	{ApptUnavailable, codes.FailedPrecondition, "the slot is outside the owner's enforced availability; the message names the day's hours"},
+	{ApptBuffer, codes.AlreadyExists, "the slot is free but closer to another confirmed appointment than the owner's buffer_minutes; ConflictInfo names it"},
+	{ApptFull, codes.FailedPrecondition, "the group appointment has no spots left, or fewer than its attendees"},
+	{ApptCancelled, codes.FailedPrecondition, "the appointment is cancelled; restore it first"},
+	{ApptKeyReused, codes.FailedPrecondition, "the idempotency_key was already used with a different request; send a new key"},
+	{BatchTooLarge, codes.InvalidArgument, "too many appointments in one batch"},
+	{ListRangeInvalid, codes.InvalidArgument, "the list range or horizon is invalid"},
+
+	{CalendarNotFound, codes.NotFound, "no such calendar, or it isn't the caller's"},
+	{CalendarExists, codes.AlreadyExists, "the caller already has a calendar with that name"},
+	{CalendarIsDefault, codes.FailedPrecondition, "the default calendar can't be deleted"},
+	{CalendarInUse, codes.FailedPrecondition, "the calendar still has confirmed appointments"},
+
+	{ResourceNotFound, codes.NotFound, "no such resource"},
+	{ResourceBooked, codes.AlreadyExists, "the resource is booked by someone for an overlapping slot"},
+	{ResourceExists, codes.AlreadyExists, "a resource with that name already exists"},
+
+	{WebhookNotFound, codes.NotFound, "no such webhook, or it isn't the caller's"},
+	{WebhookLimit, codes.ResourceExhausted, "the caller has as many webhooks as allowed; delete one first"},
+
+	{OrgNotFound, codes.NotFound, "no such organization, or the caller isn't in it"},
+	{OrgOwnerOnly, codes.PermissionDenied, "only the organization's owners can do that"},
+	{OrgAlreadyMember, codes.FailedPrecondition, "the caller is already in an organization; leave it first"},
+	{OrgInviteInvalid, codes.NotFound, "the invite code is wrong, used, expired or for another email address"},
+}
+
+var byReason = func() map[Reason]Entry {
+	m := make(map[Reason]Entry, len(catalog))
+	for _, e := range catalog {
+		m[e.Reason] = e
+	}
+	return m
+}()
+
+// Catalog returns every registered reason, in declaration order.
+func Catalog() []Entry { return append([]Entry(nil), catalog...) }
+
+// Code is the gRPC code r travels with; Internal for an unregistered reason.
+func (r Reason) Code() codes.Code {
+	if e, ok := byReason[r]; ok {
+		return e.Code
+	}
+	return codes.Internal
+}
+
+// Status builds the status for r with its ErrorInfo attached, for callers
+// that add more details on top.
+func Status(r Reason, msg string) *status.Status {
+	st := status.New(r.Code(), msg)
+	if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(r), Domain: Domain}); err == nil {
+		return withInfo
+	}
+	return st
+}
+
+// New is the error for r with msg.
+func New(r Reason, msg string) error { return Status(r, msg).Err() }
+
+// Newf is New with a formatted message.
+func Newf(r Reason, format string, args ...any) error {
+	return New(r, fmt.Sprintf(format, args...))
+}
+
+// Msg is the error for r with the catalog message key, rendered with args
+// in English until Localize picks the caller's locale.
+func Msg(r Reason, key i18n.Key, args ...any) error {
+	return &message{reason: r, key: key, args: args}
+}
+
+type message struct {
+	reason Reason
+	key    i18n.Key
+	args   []any
+}
+
+func (m *message) Error() string { return m.GRPCStatus().Err().Error() }
+
+func (m *message) GRPCStatus() *status.Status {
+	return Status(m.reason, i18n.T(i18n.Default, m.key, m.args...))
+}
+
+func (m *message) Localize(locale string) error {
+	return Translated(Status(m.reason, i18n.T(locale, m.key, m.args...)), locale).Err()
+}
+
+// Localizer is an error that renders its own message in a locale, like
+// Msg's and validate's.
+type Localizer interface {
+	Localize(locale string) error
+}
+
+// Localize renders err's message in locale. A Localizer does it itself;
+// any other error with a reason takes the reason's message from the
+// locale's catalog, or keeps its own if there is none (English is never
+// rewritten). Done twice, it changes nothing the second time.
+func Localize(err error, locale string) error {
+	if err == nil {
+		return nil
+	}
+	var l Localizer
+	if errors.As(err, &l) {
+		return l.Localize(locale)
+	}
+	if locale == i18n.Default {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, d := range st.Details() {
+		switch d.(type) {
+		case *errdetails.LocalizedMessage, *errdetails.BadRequest:
+			// already rendered, or violations there are no keys left for
+			return err
+		}
+	}
+	info := InfoOf(err)
+	if info == nil {
+		return err
+	}
+	msg, ok := i18n.Lookup(locale, i18n.Key(info.Reason))
+	if !ok {
+		return err
+	}
+	p := st.Proto()
+	p.Message = msg
+	return Translated(status.FromProto(p), locale).Err()
+}
+
+// Translated marks st as rendered in locale: a LocalizedMessage detail
+// repeats its message, so Localize leaves it alone. English isn't marked.
+func Translated(st *status.Status, locale string) *status.Status {
+	if locale == i18n.Default {
+		return st
+	}
+	if withMsg, err := st.WithDetails(&errdetails.LocalizedMessage{Locale: locale, Message: st.Message()}); err == nil {
+		return withMsg
+	}
+	return st
+}
+
+// FromContext is the DeadlineExceeded or Canceled error for a context
+// error (or one wrapping it), and nil for anything else.
+func FromContext(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return New(Canceled, "canceled")
+	}
+	return nil
+}
+
+// ReasonOf returns the reason err carries, or "" if it has none.
+func ReasonOf(err error) Reason {
+	if info := InfoOf(err); info != nil {
+		return Reason(info.Reason)
+	}
+	return ""
+}
+
+// InfoOf returns the ErrorInfo err carries, or nil.
+func InfoOf(err error) *errdetails.ErrorInfo {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
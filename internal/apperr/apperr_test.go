@@ -0,0 +1,121 @@
+package apperr
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/i18n"
+)
+
+func TestCatalog(t *testing.T) {
+	shape := regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	seen := map[Reason]bool{}
+	for _, e := range Catalog() {
+		if seen[e.Reason] {
+			t.Errorf("%s registered twice", e.Reason)
+		}
+		seen[e.Reason] = true
+		if !shape.MatchString(string(e.Reason)) {
+			t.Errorf("%q isn't UPPER_SNAKE_CASE", e.Reason)
+		}
+		if e.Code == codes.OK || e.Code == codes.Unknown {
+			t.Errorf("%s has code %s", e.Reason, e.Code)
+		}
+		if e.Doc == "" {
+			t.Errorf("%s has no doc", e.Reason)
+		}
+	}
+}
+
+// a client in any locale gets a message of its own for every reason
+func TestCatalogTranslated(t *testing.T) {
+	for _, locale := range i18n.Locales() {
+		if locale == i18n.Default {
+			continue
+		}
+		for _, e := range Catalog() {
+			if _, ok := i18n.Lookup(locale, i18n.Key(e.Reason)); !ok {
+				t.Errorf("%s: no message for %s", locale, e.Reason)
+			}
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	msg := Msg(BatchTooLarge, i18n.BatchTooLarge, 100)
+	if st := status.Convert(msg); st.Message() != "at most 100 appointments per batch" || st.Code() != codes.InvalidArgument {
+		t.Errorf("english %v", st)
+	}
+	fr := Localize(msg, "fr")
+	if st := status.Convert(fr); st.Message() != "100 rendez-vous par lot au maximum" || ReasonOf(fr) != BatchTooLarge {
+		t.Errorf("french %v", st)
+	}
+
+	plain := New(NotFound, "not found")
+	if err := Localize(plain, "en"); err != plain {
+		t.Errorf("english rewritten: %v", err)
+	}
+	fr = Localize(plain, "fr")
+	if st := status.Convert(fr); st.Message() != "introuvable" || st.Code() != codes.NotFound || ReasonOf(fr) != NotFound {
+		t.Errorf("by reason %v", st)
+	}
+	if again := Localize(Localize(Msg(ApptFrozen, i18n.FrozenSlot, "a", "b", "c"), "fr"), "fr"); status.Convert(again).Message() != "réservations fermées du a au b : c" {
+		t.Errorf("localized twice: %v", again)
+	}
+	if err := Localize(status.Error(codes.NotFound, "x"), "fr"); status.Convert(err).Message() != "x" {
+		t.Errorf("no reason: %v", err)
+	}
+	if Localize(nil, "fr") != nil {
+		t.Error("nil localized to an error")
+	}
+}
+
+func TestNew(t *testing.T) {
+	err := Newf(ApptConflict, "time conflicts with entry %d", 2)
+	st, _ := status.FromError(err)
+	if st.Code() != codes.AlreadyExists || st.Message() != "time conflicts with entry 2" {
+		t.Errorf("got %v", st)
+	}
+	info := InfoOf(err)
+	if info == nil || info.Reason != "APPT_CONFLICT" || info.Domain != Domain {
+		t.Errorf("error info %v", info)
+	}
+	if r := ReasonOf(status.Error(codes.NotFound, "x")); r != "" {
+		t.Errorf("plain status has reason %q", r)
+	}
+	if c := Reason("NOT_REGISTERED").Code(); c != codes.Internal {
+		t.Errorf("unregistered reason code %s", c)
+	}
+}
+
+// every error the API returns must carry a reason, so raw statuses aren't
+// allowed in the packages that produce them
+func TestNoBareStatuses(t *testing.T) {
+	bare := regexp.MustCompile(`status\.(Error|Errorf|New|Newf)\(`)
+	for _, dir := range []string{"../handler", "../middleware", "../grpcweb"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if strings.HasSuffix(f, "_test.go") {
+				continue
+			}
+			src, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, line := range strings.Split(string(src), "\n") {
+				if bare.MatchString(line) {
+					t.Errorf("%s:%d: use apperr instead: %s", f, i+1, strings.TrimSpace(line))
+				}
+			}
+		}
+	}
+}
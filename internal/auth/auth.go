@@ -1,18 +1,33 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+
+	"schedule-management-api/internal/clock"
 )
 
 var ErrBadToken = errors.New("invalid token")
 
+// ErrExpired is a token that's genuine but past its exp: the client should
+// refresh it, not log the user out. The jwt error stays wrapped inside.
+var ErrExpired = errors.New("token expired")
+
+// ErrWrongIssuer is a valid token minted for another environment (or, with
+// AcceptMissing off, for no environment in particular).
+var ErrWrongIssuer = errors.New("token issuer or audience mismatch")
+
 func HashPassword(pw string) (string, error) {
 	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 	return string(b), err
@@ -22,53 +37,265 @@ func CheckPassword(hash, pw string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
 }
 
+// roles, stored in users.role
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Claims struct {
 	UserID string `json:"uid"`
+	Role   string `json:"role,omitempty"` // empty in tokens from before roles: a plain user
+	// id of the refresh token issued alongside; empty in tokens minted
+	// without one
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// short-lived access token (15 min)
-func MakeToken(uid, secret string) (string, error) {
-	c := Claims{
-		UserID: uid,
+// IsAdmin reports whether the token was issued to an admin.
+func (c *Claims) IsAdmin() bool { return c.Role == RoleAdmin }
+
+// how long an access token is good for by default; a role change shows up
+// in the next one
+const AccessTokenTTL = 15 * time.Minute
+
+// DefaultRefreshTTL is how long a refresh token lasts by default.
+const DefaultRefreshTTL = 7 * 24 * time.Hour
+
+// Config is how tokens are minted and checked. The zero value is what the
+// server always did: 15 minute access tokens, 7 day refresh tokens, no
+// iss or aud.
+type Config struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+
+	// Issuer and Audience go into every token when set, and a token
+	// carrying a different one is rejected, so environments sharing a
+	// secret can't use each other's tokens.
+	Issuer   string
+	Audience string
+	// AcceptMissing still lets in tokens with no iss/aud at all (minted
+	// before Issuer/Audience were set) while they age out.
+	AcceptMissing bool
+
+	// Clock stamps new tokens and judges expiry; nil is the real clock.
+	Clock clock.Clock
+
+	// RefreshPepper keys the HMAC new refresh tokens are hashed with, so a
+	// DB dump alone isn't enough to check guesses; empty keeps sha256.
+	// Rows hashed under an older scheme are still found (and rehashed)
+	// unless RejectLegacyRefresh closes the migration window.
+	RefreshPepper       string
+	RejectLegacyRefresh bool
+}
+
+func (c Config) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (c Config) accessTTL() time.Duration {
+	if c.AccessTTL > 0 {
+		return c.AccessTTL
+	}
+	return AccessTokenTTL
+}
+
+// RefreshTokenTTL is c.RefreshTTL or the default.
+func (c Config) RefreshTokenTTL() time.Duration {
+	if c.RefreshTTL > 0 {
+		return c.RefreshTTL
+	}
+	return DefaultRefreshTTL
+}
+
+// MakeToken mints an access token with the default Config and one secret.
+func MakeToken(uid, role, secret string) (string, error) {
+	tok, _, err := Config{}.MakeToken(uid, role, SingleKey(secret))
+	return tok, err
+}
+
+// MakeToken mints an access token signed with the first of ks and says when
+// it expires.
+func (c Config) MakeToken(uid, role string, ks Keys) (string, time.Time, error) {
+	return c.MakeSessionToken(uid, role, "", ks)
+}
+
+// MakeSessionToken is MakeToken for the session whose refresh token is sid,
+// so the session list can point out the caller's own.
+func (c Config) MakeSessionToken(uid, role, sid string, ks Keys) (string, time.Time, error) {
+	if len(ks) == 0 {
+		return "", time.Time{}, errors.New("no signing key")
+	}
+	now := c.now()
+	exp := now.Add(c.accessTTL())
+	claims := Claims{
+		UserID:    uid,
+		Role:      role,
+		SessionID: sid,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    c.Issuer,
+			ExpiresAt: jwt.NewNumericDate(exp),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(secret))
+	if c.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{c.Audience}
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t.Header["kid"] = ks[0].ID
+	tok, err := t.SignedString(ks[0].secret)
+	return tok, exp, err
 }
 
+// ParseToken checks a token with the default Config and one secret.
 func ParseToken(raw, secret string) (*Claims, error) {
+	return Config{}.ParseToken(raw, SingleKey(secret))
+}
+
+// ParseToken checks the signature against the key the kid names (every key,
+// for tokens from before kids), the expiry and, when c sets them, iss and
+// aud.
+func (c Config) ParseToken(raw string, ks Keys) (*Claims, error) {
 	tok, err := jwt.ParseWithClaims(raw, &Claims{}, func(t *jwt.Token) (any, error) {
 		// block alg confusion
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrBadToken
 		}
-		return []byte(secret), nil
-	})
+		if kid, ok := t.Header["kid"]; ok {
+			s, _ := kid.(string)
+			k, ok := ks.byID(s)
+			if !ok {
+				return nil, ErrUnknownKey
+			}
+			return k.secret, nil
+		}
+		set := jwt.VerificationKeySet{}
+		for _, k := range ks {
+			set.Keys = append(set.Keys, k.secret)
+		}
+		return set, nil
+	}, jwt.WithTimeFunc(c.now))
 	if err != nil {
+		// exp is only looked at once the signature checks out
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("%w: %w", ErrExpired, err)
+		}
 		return nil, err
 	}
-	c, ok := tok.Claims.(*Claims)
+	claims, ok := tok.Claims.(*Claims)
 	if !ok || !tok.Valid {
 		return nil, ErrBadToken
 	}
-	return c, nil
+	if c.Issuer != "" && !c.allowed(claims.Issuer != "", claims.Issuer == c.Issuer) {
+		return nil, ErrWrongIssuer
+	}
+	if c.Audience != "" && !c.allowed(len(claims.Audience) > 0, slices.Contains(claims.Audience, c.Audience)) {
+		return nil, ErrWrongIssuer
+	}
+	return claims, nil
 }
 
-func GenerateRefreshToken() (raw string, hash string, err error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
+// warned once per process, not per request
+var missingWarn sync.Once
+
+// allowed decides on a claim that's present (and matches or not) or absent.
+func (c Config) allowed(present, matches bool) bool {
+	if !present {
+		if c.AcceptMissing {
+			missingWarn.Do(func() {
+				log.Printf("accepting access tokens without iss/aud; turn off the grace setting once they've expired (%s)", c.accessTTL())
+			})
+		}
+		return c.AcceptMissing
+	}
+	return matches
+}
+
+// refresh token hash schemes, recorded per row in refresh_tokens.hash_version
+const (
+	RefreshHashSHA256 = 1 // legacy: sha256(raw)
+	RefreshHashHMAC   = 2 // hmac-sha256(pepper, raw)
+)
+
+// VersionedHash is a refresh token hash tagged with the scheme that produced it.
+type VersionedHash struct {
+	Version int
+	Hash    string
+}
+
+// RefreshHashVersion is the scheme new refresh tokens are hashed with.
+func (c Config) RefreshHashVersion() int {
+	if c.RefreshPepper != "" {
+		return RefreshHashHMAC
+	}
+	return RefreshHashSHA256
+}
+
+// GenerateRefreshToken makes a new refresh token and its hash under the
+// current scheme.
+func (c Config) GenerateRefreshToken() (raw string, hash VersionedHash, err error) {
+	if raw, err = randomToken(); err != nil {
+		return "", VersionedHash{}, err
+	}
+	return raw, c.HashRefreshToken(raw), nil
+}
+
+// HashRefreshToken hashes raw with the current scheme.
+func (c Config) HashRefreshToken(raw string) VersionedHash {
+	v := c.RefreshHashVersion()
+	return VersionedHash{v, c.HashRefreshTokenVersion(raw, v)}
+}
+
+func (c Config) HashRefreshTokenVersion(raw string, version int) string {
+	switch version {
+	case RefreshHashHMAC:
+		m := hmac.New(sha256.New, []byte(c.RefreshPepper))
+		m.Write([]byte(raw))
+		return hex.EncodeToString(m.Sum(nil))
+	default:
+		return HashToken(raw)
+	}
+}
+
+// RefreshHashCandidates returns the hashes to look raw up by, current scheme
+// first, followed by older schemes while legacy hashes are still accepted.
+func (c Config) RefreshHashCandidates(raw string) []VersionedHash {
+	cur := c.HashRefreshToken(raw)
+	out := []VersionedHash{cur}
+	if !c.RejectLegacyRefresh {
+		for v := cur.Version - 1; v >= RefreshHashSHA256; v-- {
+			out = append(out, VersionedHash{v, c.HashRefreshTokenVersion(raw, v)})
+		}
+	}
+	return out
+}
+
+// GenerateToken makes a single-use token for a link or an email: password
+// resets, email verification, share links, organization invites. The
+// hash is what gets stored.
+func GenerateToken() (raw, hash string, err error) {
+	if raw, err = randomToken(); err != nil {
 		return "", "", err
 	}
-	raw = hex.EncodeToString(b)
-	h := sha256.Sum256([]byte(raw))
-	hash = hex.EncodeToString(h[:])
-	return raw, hash, nil
+	return raw, HashToken(raw), nil
 }
 
-func HashRefreshToken(raw string) string {
+// HashToken is the sha256 of a token from GenerateToken. It never takes
+// the refresh pepper, so setting or changing that doesn't void the links
+// already sent out.
+func HashToken(raw string) string {
 	h := sha256.Sum256([]byte(raw))
 	return hex.EncodeToString(h[:])
 }
+
+// randomToken is 32 random bytes, hex encoded.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"schedule-management-api/internal/clock"
+)
+
+const testSecret = "test-secret"
+
+var testKeys = SingleKey(testSecret)
+
+func TestTokenTTL(t *testing.T) {
+	tok, exp, err := Config{AccessTTL: time.Minute}.MakeToken("u1", RoleUser, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(exp); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("expires in %v, want 1m", d)
+	}
+	c, err := ParseToken(tok, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.ExpiresAt.Time.Equal(exp.Truncate(time.Second)) {
+		t.Errorf("exp claim %v, returned %v", c.ExpiresAt.Time, exp)
+	}
+
+	// the zero Config keeps the old lifetimes
+	_, exp, _ = Config{}.MakeToken("u1", RoleUser, testKeys)
+	if d := time.Until(exp); d <= AccessTokenTTL-time.Minute || d > AccessTokenTTL {
+		t.Errorf("default access expires in %v", d)
+	}
+	if (Config{}).RefreshTokenTTL() != DefaultRefreshTTL || (Config{RefreshTTL: time.Hour}).RefreshTokenTTL() != time.Hour {
+		t.Error("RefreshTokenTTL")
+	}
+
+	old := Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second))}}
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, old).SignedString([]byte(testSecret))
+	if _, err := ParseToken(expired, testSecret); err == nil {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestTokenExpiryExact(t *testing.T) {
+	issued := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(issued)
+	cfg := Config{Clock: clk}
+	tok, exp, err := cfg.MakeToken("u1", RoleUser, testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := issued.Add(AccessTokenTTL); !exp.Equal(want) {
+		t.Errorf("expires %v, want %v", exp, want)
+	}
+
+	// good up to the last second before exp, not at it
+	clk.Set(exp.Add(-time.Second))
+	if _, err := cfg.ParseToken(tok, testKeys); err != nil {
+		t.Errorf("a second before expiry: %v", err)
+	}
+	clk.Set(exp)
+	if _, err := cfg.ParseToken(tok, testKeys); !errors.Is(err, ErrExpired) || !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("at expiry: %v", err)
+	}
+	// signed with another key, it's just bad
+	other, _, _ := Config{Clock: clock.NewFake(issued)}.MakeToken("u1", RoleUser, SingleKey("other"))
+	if _, err := cfg.ParseToken(other, testKeys); err == nil || errors.Is(err, ErrExpired) {
+		t.Errorf("expired forgery: %v", err)
+	}
+}
+
+func TestIssuerAudience(t *testing.T) {
+	prod := Config{Issuer: "https://api.example.com", Audience: "schedule"}
+	staging := Config{Issuer: "https://api.staging.example.com", Audience: "schedule-staging"}
+	mint := func(c Config) string {
+		t.Helper()
+		tok, _, err := c.MakeToken("u1", RoleUser, testKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+
+	c, err := prod.ParseToken(mint(prod), testKeys)
+	if err != nil {
+		t.Fatalf("own token: %v", err)
+	}
+	if c.Issuer != prod.Issuer || len(c.Audience) != 1 || c.Audience[0] != prod.Audience {
+		t.Errorf("claims iss=%q aud=%v", c.Issuer, c.Audience)
+	}
+
+	legacy := mint(Config{})
+	tests := []struct {
+		name string
+		cfg  Config
+		tok  string
+		ok   bool
+	}{
+		{"other environment", prod, mint(staging), false},
+		{"other environment in grace", Config{Issuer: prod.Issuer, Audience: prod.Audience, AcceptMissing: true}, mint(staging), false},
+		{"wrong audience only", prod, mint(Config{Issuer: prod.Issuer, Audience: "other"}), false},
+		{"wrong issuer only", prod, mint(Config{Issuer: "other", Audience: prod.Audience}), false},
+		{"legacy rejected", prod, legacy, false},
+		{"legacy in grace", Config{Issuer: prod.Issuer, Audience: prod.Audience, AcceptMissing: true}, legacy, true},
+		{"legacy, nothing configured", Config{}, legacy, true},
+		{"issuer only configured", Config{Issuer: prod.Issuer}, mint(prod), true},
+		{"unconfigured accepts anything signed", Config{}, mint(staging), true},
+	}
+	for _, tt := range tests {
+		_, err := tt.cfg.ParseToken(tt.tok, testKeys)
+		if tt.ok && err != nil {
+			t.Errorf("%s: rejected: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrWrongIssuer) {
+			t.Errorf("%s: err = %v, want ErrWrongIssuer", tt.name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := NewKeys("old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mid-rotation: new key signs, old one still verifies
+	rotating, err := NewKeys(" new-secret", "", "old-secret", "new-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotating) != 2 || rotating[0].ID == rotating[1].ID || rotating[1].ID != old[0].ID {
+		t.Fatalf("keys %+v", rotating)
+	}
+	done, _ := NewKeys("new-secret")
+
+	mint := func(ks Keys) string {
+		t.Helper()
+		tok, _, err := Config{}.MakeToken("u1", RoleUser, ks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	kidOf := func(tok string) any {
+		p, _, err := jwt.NewParser().ParseUnverified(tok, &Claims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.Header["kid"]
+	}
+
+	fromOld, fromNew := mint(old), mint(rotating)
+	if kidOf(fromOld) != old[0].ID || kidOf(fromNew) != rotating[0].ID {
+		t.Errorf("kids %v, %v", kidOf(fromOld), kidOf(fromNew))
+	}
+	if _, err := (Config{}).ParseToken(fromOld, rotating); err != nil {
+		t.Errorf("old token during the overlap: %v", err)
+	}
+	if _, err := (Config{}).ParseToken(fromNew, rotating); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+	if _, err := (Config{}).ParseToken(fromOld, done); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old token after the old key is dropped: %v", err)
+	}
+
+	// tokens from before kids: tried against every key
+	legacy := func(secret string) string {
+		tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}).SignedString([]byte(secret))
+		return tok
+	}
+	if _, err := (Config{}).ParseToken(legacy("old-secret"), rotating); err != nil {
+		t.Errorf("kid-less token from the old key: %v", err)
+	}
+	if _, err := (Config{}).ParseToken(legacy("unrelated"), rotating); err == nil {
+		t.Error("kid-less token from an unknown secret accepted")
+	}
+
+	// a kid nobody configured isn't tried against the other keys, even
+	// when one of them would verify it
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	forged.Header["kid"] = "0000000000000000"
+	tok, _ := forged.SignedString([]byte("new-secret"))
+	if _, err := (Config{}).ParseToken(tok, rotating); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown kid: %v", err)
+	}
+
+	if _, err := NewKeys("", " "); err == nil {
+		t.Error("empty key set accepted")
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Key is one HMAC secret. Its ID goes into the kid header of the tokens it
+// signs; it's derived from the secret, so listing the secrets is all the
+// configuration there is.
+type Key struct {
+	ID     string
+	secret []byte
+}
+
+// Keys are the secrets access tokens are checked against. The first one
+// signs; the rest are kept through a rotation so tokens they signed stay
+// valid until they expire.
+type Keys []Key
+
+// ErrUnknownKey is a token whose kid names none of the configured keys.
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// NewKeys builds the set from secrets, first one signing. Blank entries
+// are skipped; at least one secret is required.
+func NewKeys(secrets ...string) (Keys, error) {
+	var ks Keys
+	seen := map[string]bool{}
+	for _, s := range secrets {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		ks = append(ks, newKey(s))
+	}
+	if len(ks) == 0 {
+		return nil, errors.New("no JWT secret configured")
+	}
+	return ks, nil
+}
+
+// SingleKey is the set holding only secret.
+func SingleKey(secret string) Keys {
+	return Keys{newKey(secret)}
+}
+
+func newKey(secret string) Key {
+	sum := sha256.Sum256([]byte("kid:" + secret))
+	return Key{ID: hex.EncodeToString(sum[:8]), secret: []byte(secret)}
+}
+
+func (ks Keys) byID(kid string) (Key, bool) {
+	for _, k := range ks {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"runtime"
+)
+
+// ErrBusy means the hashing pool's queue is full; callers should shed load.
+var ErrBusy = errors.New("password hashing pool saturated")
+
+// Pool bounds how many bcrypt operations run at once so a burst of logins
+// can't take every core away from the rest of the server. Callers beyond
+// the worker count wait in a bounded queue (respecting ctx); beyond that
+// they get ErrBusy straight away.
+type Pool struct {
+	workers chan struct{}
+	queue   chan struct{}
+}
+
+// NewPool sizes the pool; workers <= 0 means GOMAXPROCS, queue <= 0 means
+// 4x workers.
+func NewPool(workers, queue int) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queue <= 0 {
+		queue = 4 * workers
+	}
+	return &Pool{
+		workers: make(chan struct{}, workers),
+		queue:   make(chan struct{}, queue),
+	}
+}
+
+func (p *Pool) do(ctx context.Context, fn func()) error {
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		return ErrBusy
+	}
+	defer func() { <-p.queue }()
+
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.workers }()
+
+	// deadline may have passed while we were queued, don't burn cpu for nothing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fn()
+	return nil
+}
+
+func (p *Pool) HashPassword(ctx context.Context, pw string) (string, error) {
+	var (
+		hash string
+		err  error
+	)
+	if perr := p.do(ctx, func() { hash, err = HashPassword(pw) }); perr != nil {
+		return "", perr
+	}
+	return hash, err
+}
+
+func (p *Pool) CheckPassword(ctx context.Context, hash, pw string) (bool, error) {
+	var ok bool
+	if err := p.do(ctx, func() { ok = CheckPassword(hash, pw) }); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
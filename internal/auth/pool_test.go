@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolBoundsConcurrency(t *testing.T) {
+	p := NewPool(2, 10)
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.do(context.Background(), func() {
+				n := running.Add(1)
+				for {
+					old := peak.Load()
+					if n <= old || peak.CompareAndSwap(old, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			})
+			if err != nil {
+				t.Errorf("do: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent, saw %d", peak.Load())
+	}
+}
+
+func TestPoolShedsWhenQueueFull(t *testing.T) {
+	p := NewPool(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go p.do(context.Background(), func() { close(started); <-release })
+	<-started
+
+	// the one queue slot is held by the running call
+	if err := p.do(context.Background(), func() {}); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected ErrBusy, got %v", err)
+	}
+	close(release)
+}
+
+func TestPoolHonorsDeadlineWhileQueued(t *testing.T) {
+	p := NewPool(1, 4)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go p.do(context.Background(), func() { close(started); <-release })
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	if err := p.do(ctx, func() { ran = true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if ran {
+		t.Error("work ran after deadline")
+	}
+}
+
+func TestPoolHashAndCheck(t *testing.T) {
+	p := NewPool(0, 0)
+	hash, err := p.HashPassword(context.Background(), "testpass123")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if ok, _ := p.CheckPassword(context.Background(), hash, "testpass123"); !ok {
+		t.Error("correct password rejected")
+	}
+	if ok, _ := p.CheckPassword(context.Background(), hash, "wrong"); ok {
+		t.Error("wrong password accepted")
+	}
+}
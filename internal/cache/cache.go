@@ -0,0 +1,295 @@
+// Package cache is a small in-process read-through cache. Entries belong
+// to an owner (a user ID) so everything of one owner can be dropped at
+// once, live for a TTL, and the least recently used go first once the
+// cache is full. Concurrent misses on a key share one load, and an entry
+// just past its TTL is still served while a single background load
+// refreshes it (stale-while-revalidate).
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"schedule-management-api/internal/clock"
+)
+
+// defaults for New
+const (
+	defaultTTL = 10 * time.Second
+	defaultMax = 10_000
+
+	// how long a load may take, as it outlives the request that started it
+	loadTimeout = 10 * time.Second
+)
+
+type entry[V any] struct {
+	owner, key string
+	val        V
+	loaded     time.Time
+	refreshing bool
+}
+
+// owner tracks one owner's keys. It's kept while the owner has entries or
+// loads in flight, so a load can tell whether Invalidate ran since it
+// started.
+type owner struct {
+	gen     uint64
+	keys    map[string]struct{}
+	loading int
+}
+
+// Cache maps an owner and key to a V. Safe for concurrent use.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *entry[V]
+	lru     list.List                // most recently used at the front
+	owners  map[string]*owner
+	gens    uint64 // last owner generation handed out, across owners
+	group   singleflight.Group
+
+	ttl   time.Duration
+	stale time.Duration
+	max   int
+	clock clock.Clock
+
+	onLookup     func(hit bool)
+	hits, misses atomic.Uint64
+}
+
+type options struct {
+	stale time.Duration
+	max   int
+	clock clock.Clock
+}
+
+type Option func(*options)
+
+// WithStale serves entries up to d past their TTL while they're reloaded
+// in the background. 0, the default, reloads them in the request.
+func WithStale(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.stale = d
+		}
+	}
+}
+
+// WithMaxEntries bounds the cache; past it the least recently used entry
+// is evicted.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.max = n
+		}
+	}
+}
+
+// WithClock sets where entry ages are measured from, for tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// New is a cache whose entries are fresh for ttl (10s if zero).
+func New[V any](ttl time.Duration, opts ...Option) *Cache[V] {
+	o := options{max: defaultMax, clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Cache[V]{
+		entries: make(map[string]*list.Element),
+		owners:  make(map[string]*owner),
+		ttl:     ttl,
+		stale:   o.stale,
+		max:     o.max,
+		clock:   o.clock,
+	}
+}
+
+// OnLookup registers a callback for every Get, told whether it was served
+// from the cache, e.g. a metrics counter.
+func (c *Cache[V]) OnLookup(fn func(hit bool)) {
+	c.onLookup = fn
+}
+
+// Get returns ownerID's value for key, calling load on a miss. Callers
+// missing on the same key at the same time wait for one load and share
+// its result, error included; errors aren't cached.
+func (c *Cache[V]) Get(ctx context.Context, ownerID, key string, load func(context.Context) (V, error)) (V, error) {
+	k := ownerID + "\x00" + key
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	if el, ok := c.entries[k]; ok {
+		e := el.Value.(*entry[V])
+		age := now.Sub(e.loaded)
+		if age < c.ttl+c.stale {
+			c.lru.MoveToFront(el)
+			if age >= c.ttl && !e.refreshing {
+				e.refreshing = true
+				gen := c.begin(ownerID)
+				go c.refresh(context.WithoutCancel(ctx), ownerID, k, gen, load)
+			}
+			v := e.val
+			c.mu.Unlock()
+			c.lookup(true)
+			return v, nil
+		}
+		c.remove(el)
+	}
+	gen := c.begin(ownerID)
+	c.mu.Unlock()
+	c.lookup(false)
+
+	defer c.end(ownerID)
+	return c.load(ctx, ownerID, k, gen, load)
+}
+
+// Invalidate drops everything of ownerID's, and keeps loads already
+// under way for it from storing what they read.
+func (c *Cache[V]) Invalidate(ownerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := c.owners[ownerID]
+	if o == nil {
+		return
+	}
+	c.gens++
+	o.gen = c.gens
+	for k := range o.keys {
+		c.remove(c.entries[k])
+	}
+}
+
+// Len is how many entries the cache holds.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Stats is how many Gets were served from the cache and how many loaded.
+func (c *Cache[V]) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func (c *Cache[V]) lookup(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	if c.onLookup != nil {
+		c.onLookup(hit)
+	}
+}
+
+// load runs fn once for every caller asking for k within gen; a load
+// from before an Invalidate isn't joined by callers after it. fn runs
+// apart from the caller that started it, under loadTimeout, so that one
+// giving up doesn't fail the rest; each caller still stops waiting as
+// soon as its own ctx is done.
+func (c *Cache[V]) load(ctx context.Context, ownerID, k string, gen uint64, fn func(context.Context) (V, error)) (V, error) {
+	ch := c.group.DoChan(strconv.FormatUint(gen, 10)+"\x00"+k, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		v, err := fn(ctx)
+		if err == nil {
+			c.put(ownerID, k, gen, v)
+		}
+		return v, err
+	})
+	var zero V
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return zero, r.Err
+		}
+		return r.Val.(V), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func (c *Cache[V]) refresh(ctx context.Context, ownerID, k string, gen uint64, fn func(context.Context) (V, error)) {
+	defer c.end(ownerID)
+	if _, err := c.load(ctx, ownerID, k, gen, fn); err != nil {
+		// keep serving the old value until it's too stale; the next Get
+		// past the TTL tries again
+		c.mu.Lock()
+		if el, ok := c.entries[k]; ok {
+			el.Value.(*entry[V]).refreshing = false
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Cache[V]) put(ownerID, k string, gen uint64, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := c.owners[ownerID]
+	if o == nil || o.gen != gen {
+		return
+	}
+	now := c.clock.Now()
+	if el, ok := c.entries[k]; ok {
+		e := el.Value.(*entry[V])
+		e.val, e.loaded, e.refreshing = v, now, false
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[k] = c.lru.PushFront(&entry[V]{owner: ownerID, key: k, val: v, loaded: now})
+	o.keys[k] = struct{}{}
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+// begin and end bracket a load for ownerID; c.mu must be held for begin.
+func (c *Cache[V]) begin(ownerID string) uint64 {
+	o := c.owners[ownerID]
+	if o == nil {
+		// a fresh generation, so a load that outlived the owner's last
+		// entry can't pass for one of the new owner's
+		c.gens++
+		o = &owner{gen: c.gens, keys: make(map[string]struct{})}
+		c.owners[ownerID] = o
+	}
+	o.loading++
+	return o.gen
+}
+
+func (c *Cache[V]) end(ownerID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := c.owners[ownerID]
+	o.loading--
+	c.prune(ownerID, o)
+}
+
+// remove drops el; c.mu must be held.
+func (c *Cache[V]) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry[V])
+	delete(c.entries, e.key)
+	o := c.owners[e.owner]
+	delete(o.keys, e.key)
+	c.prune(e.owner, o)
+}
+
+func (c *Cache[V]) prune(ownerID string, o *owner) {
+	if len(o.keys) == 0 && o.loading == 0 {
+		delete(c.owners, ownerID)
+	}
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"schedule-management-api/internal/clock"
+)
+
+// counter is a load that returns how many times it has run.
+func counter() (func(context.Context) (int, error), *atomic.Int32) {
+	var n atomic.Int32
+	return func(context.Context) (int, error) { return int(n.Add(1)), nil }, &n
+}
+
+func TestCacheHitsUntilTTL(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC))
+	c := New[int](10*time.Second, WithClock(clk))
+	load, n := counter()
+	ctx := context.Background()
+
+	for range 3 {
+		if v, err := c.Get(ctx, "u1", "k", load); err != nil || v != 1 {
+			t.Fatalf("Get = %d, %v", v, err)
+		}
+	}
+	clk.Advance(10 * time.Second)
+	if v, _ := c.Get(ctx, "u1", "k", load); v != 2 {
+		t.Errorf("after the TTL got %d, want a reload", v)
+	}
+	if hits, misses := c.Stats(); hits != 2 || misses != 2 {
+		t.Errorf("hits %d misses %d", hits, misses)
+	}
+	if n.Load() != 2 {
+		t.Errorf("%d loads", n.Load())
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := New[int](time.Minute)
+	load, _ := counter()
+	ctx := context.Background()
+	c.Get(ctx, "u1", "a", load)
+	c.Get(ctx, "u1", "b", load)
+	c.Get(ctx, "u2", "a", load)
+
+	c.Invalidate("u1")
+	if c.Len() != 1 {
+		t.Errorf("Len = %d after invalidating u1", c.Len())
+	}
+	if v, _ := c.Get(ctx, "u1", "a", load); v != 4 {
+		t.Errorf("u1/a = %d, want a reload", v)
+	}
+	if v, _ := c.Get(ctx, "u2", "a", load); v != 3 {
+		t.Errorf("u2/a = %d, want the cached 3", v)
+	}
+	c.Invalidate("nobody")
+}
+
+func TestCacheLoadBeforeInvalidateIsDropped(t *testing.T) {
+	c := New[int](time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan int)
+	go func() {
+		v, _ := c.Get(context.Background(), "u1", "k", func(context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		done <- v
+	}()
+	<-started
+	c.Invalidate("u1")
+
+	// a Get after the write doesn't join the read from before it
+	v, err := c.Get(context.Background(), "u1", "k", func(context.Context) (int, error) { return 2, nil })
+	if err != nil || v != 2 {
+		t.Fatalf("Get after Invalidate = %d, %v", v, err)
+	}
+	close(release)
+	if v := <-done; v != 1 {
+		t.Errorf("first caller got %d", v)
+	}
+	if v, _ := c.Get(context.Background(), "u1", "k", func(context.Context) (int, error) { return 3, nil }); v != 2 {
+		t.Errorf("cached %d, want the load after Invalidate", v)
+	}
+}
+
+func TestCacheCollapsesConcurrentMisses(t *testing.T) {
+	c := New[int](time.Minute)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 50
+	var wg sync.WaitGroup
+	got := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], _ = c.Get(context.Background(), "u1", "k", load)
+		}()
+	}
+	// every caller has missed once the miss counter says so
+	for deadline := time.Now().Add(time.Second); ; {
+		if _, misses := c.Stats(); misses == callers {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("callers didn't all reach the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if loads.Load() != 1 {
+		t.Errorf("%d loads for %d concurrent misses", loads.Load(), callers)
+	}
+	for i, v := range got {
+		if v != 42 {
+			t.Fatalf("caller %d got %d", i, v)
+		}
+	}
+}
+
+// the caller that started a load going away neither cancels it nor fails
+// the callers sharing it, and it doesn't wait for it either
+func TestCacheLoadOutlivesItsCaller(t *testing.T) {
+	c := New[int](time.Minute)
+	release := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, "u1", "k", load)
+		first <- err
+	}()
+	second := make(chan int, 1)
+	go func() {
+		v, _ := c.Get(context.Background(), "u1", "k", load)
+		second <- v
+	}()
+	for deadline := time.Now().Add(time.Second); ; {
+		if _, misses := c.Stats(); misses == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("callers didn't both reach the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-first:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled caller got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled caller still waiting on the load")
+	}
+	close(release)
+	if v := <-second; v != 42 {
+		t.Errorf("other caller got %d", v)
+	}
+	if v, _ := c.Get(context.Background(), "u1", "k", load); v != 42 {
+		t.Errorf("not cached: %d", v)
+	}
+}
+
+func TestCacheDoesNotKeepErrors(t *testing.T) {
+	c := New[int](time.Minute)
+	boom := errors.New("boom")
+	if _, err := c.Get(context.Background(), "u1", "k", func(context.Context) (int, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	if c.Len() != 0 || len(c.owners) != 0 {
+		t.Errorf("left %d entries, %d owners", c.Len(), len(c.owners))
+	}
+	if v, _ := c.Get(context.Background(), "u1", "k", func(context.Context) (int, error) { return 1, nil }); v != 1 {
+		t.Errorf("retry got %d", v)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string](time.Minute, WithMaxEntries(3))
+	ctx := context.Background()
+	get := func(owner, key string) string {
+		v, _ := c.Get(ctx, owner, key, func(context.Context) (string, error) { return owner + "/" + key, nil })
+		return v
+	}
+	get("u1", "a")
+	get("u1", "b")
+	get("u2", "c")
+	get("u1", "a") // a is now the most recent, b the least
+	get("u2", "d")
+
+	if c.Len() != 3 {
+		t.Fatalf("Len = %d", c.Len())
+	}
+	if _, ok := c.entries["u1\x00b"]; ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := c.entries["u1\x00a"]; !ok {
+		t.Error("a was evicted")
+	}
+	if keys := c.owners["u1"].keys; len(keys) != 1 {
+		t.Errorf("u1 still tracks %d keys", len(keys))
+	}
+}
+
+func TestCacheServesStaleWhileRefreshing(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC))
+	c := New[int](10*time.Second, WithStale(time.Minute), WithClock(clk))
+	ctx := context.Background()
+	c.Get(ctx, "u1", "k", func(context.Context) (int, error) { return 1, nil })
+
+	clk.Advance(15 * time.Second)
+	refreshed := make(chan struct{})
+	var loads atomic.Int32
+	refresh := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-refreshed
+		return 2, nil
+	}
+	for range 3 {
+		if v, _ := c.Get(ctx, "u1", "k", refresh); v != 1 {
+			t.Fatalf("stale Get = %d, want the old value right away", v)
+		}
+	}
+	close(refreshed)
+	waitFor(t, func() bool {
+		v, _ := c.Get(ctx, "u1", "k", refresh)
+		return v == 2
+	})
+	if loads.Load() != 1 {
+		t.Errorf("%d background loads", loads.Load())
+	}
+	if hits, misses := c.Stats(); misses != 1 || hits < 4 {
+		t.Errorf("hits %d misses %d", hits, misses)
+	}
+
+	// too stale to serve at all
+	clk.Advance(2 * time.Minute)
+	if v, _ := c.Get(ctx, "u1", "k", func(context.Context) (int, error) { return 3, nil }); v != 3 {
+		t.Errorf("past the stale window got %d", v)
+	}
+}
+
+func TestCacheOnLookup(t *testing.T) {
+	c := New[int](time.Minute)
+	var got []string
+	c.OnLookup(func(hit bool) { got = append(got, fmt.Sprint(hit)) })
+	load, _ := counter()
+	c.Get(context.Background(), "u1", "k", load)
+	c.Get(context.Background(), "u1", "k", load)
+	if fmt.Sprint(got) != "[false true]" {
+		t.Errorf("lookups %v", got)
+	}
+}
+
+func waitFor(t *testing.T, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !ok(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,316 @@
+// Package diag keeps the in-process state behind the admin diagnostics
+// snapshot: background worker runs, recent error reasons, gauges read from
+// other components and the startup config. Nothing here touches the
+// database; callers read the pool and schema themselves.
+package diag
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+)
+
+// how far back RecentErrors looks, in one-minute buckets
+const errorWindow = 60
+
+// Registry is safe for concurrent use. A nil *Registry accepts every call
+// and reports nothing, so components can be wired without it (tests, tools).
+type Registry struct {
+	started time.Time
+
+	mu        sync.Mutex
+	workers   []*Worker
+	gauges    map[string]func() int
+	config    map[string]string
+	migration Migration
+	buckets   [errorWindow]bucket
+}
+
+type bucket struct {
+	minute int64 // unix minute the counts belong to
+	counts map[string]int64
+}
+
+func New() *Registry {
+	return &Registry{started: time.Now(), gauges: map[string]func() int{}}
+}
+
+// Started is when the registry (i.e. the process) came up.
+func (r *Registry) Started() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	return r.started
+}
+
+// Worker is one background loop's run history.
+type Worker struct {
+	Name string
+
+	mu      sync.Mutex
+	lastRun time.Time
+	runs    int64
+	errors  int64
+	lastErr string
+}
+
+// WorkerStatus is a copy of a Worker's counters.
+type WorkerStatus struct {
+	Name      string
+	LastRun   time.Time // zero until the first run
+	Runs      int64
+	Errors    int64
+	LastError string
+}
+
+// Worker registers a background loop under name and returns its tracker.
+func (r *Registry) Worker(name string) *Worker {
+	w := &Worker{Name: name}
+	if r == nil {
+		return w
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers = append(r.workers, w)
+	return w
+}
+
+// Ran records one pass of the loop; err is what the pass failed with, if
+// anything.
+func (w *Worker) Ran(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastRun = time.Now()
+	w.runs++
+	if err != nil {
+		w.errors++
+		w.lastErr = err.Error()
+	}
+}
+
+func (w *Worker) status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WorkerStatus{Name: w.Name, LastRun: w.lastRun, Runs: w.runs, Errors: w.errors, LastError: w.lastErr}
+}
+
+// Workers lists every registered loop in registration order.
+func (r *Registry) Workers() []WorkerStatus {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	ws := slices.Clone(r.workers)
+	r.mu.Unlock()
+	out := make([]WorkerStatus, len(ws))
+	for i, w := range ws {
+		out[i] = w.status()
+	}
+	return out
+}
+
+// Gauge reports fn's value under name in every snapshot. fn is called
+// while a snapshot is taken, so it has to be cheap.
+func (r *Registry) Gauge(name string, fn func() int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = fn
+}
+
+// Gauges reads every registered gauge.
+func (r *Registry) Gauges() map[string]int64 {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	fns := make(map[string]func() int, len(r.gauges))
+	for k, fn := range r.gauges {
+		fns[k] = fn
+	}
+	r.mu.Unlock()
+	out := make(map[string]int64, len(fns))
+	for k, fn := range fns {
+		out[k] = int64(fn())
+	}
+	return out
+}
+
+// Migration is the outcome of the startup migration.
+type Migration struct {
+	Version   string
+	AppliedAt time.Time // zero if it failed or was skipped
+	Error     string
+}
+
+func (r *Registry) SetMigration(m Migration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.migration = m
+}
+
+func (r *Registry) Migration() Migration {
+	if r == nil {
+		return Migration{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.migration
+}
+
+// SetConfig stores the effective configuration with secrets redacted.
+func (r *Registry) SetConfig(cfg map[string]string) {
+	if r == nil {
+		return
+	}
+	red := Redact(cfg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = red
+}
+
+func (r *Registry) Config() map[string]string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]string, len(r.config))
+	for k, v := range r.config {
+		out[k] = v
+	}
+	return out
+}
+
+// key fragments whose values never leave the process
+var secretKeys = []string{"SECRET", "PASSWORD", "PEPPER", "TOKEN", "KEY"}
+
+// Redacted replaces a secret value.
+const Redacted = "[redacted]"
+
+// Redact returns a copy of cfg with secret values replaced and passwords
+// stripped out of URLs. An empty secret stays empty so "not set" is still
+// visible.
+func Redact(cfg map[string]string) map[string]string {
+	out := make(map[string]string, len(cfg))
+	for k, v := range cfg {
+		upper := strings.ToUpper(k)
+		switch {
+		case v == "":
+		case secret(upper):
+			v = Redacted
+		case upper == "DATABASE_URL":
+			v = redactDSN(v)
+		case strings.Contains(v, "://"):
+			v = redactURL(v)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func secret(key string) bool {
+	return slices.ContainsFunc(secretKeys, func(s string) bool { return strings.Contains(key, s) })
+}
+
+// redactDSN re-emits a Postgres connection string, URL or key=value, as a
+// URL of just where it connects: the password can sit in the userinfo, a
+// password= setting or a query parameter, and sslpassword in either.
+func redactDSN(dsn string) string {
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return Redacted
+	}
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.User(cfg.User),
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))),
+		Path:   "/" + cfg.Database,
+	}
+	return u.String()
+}
+
+// redactURL masks a URL's password and any query parameter named like a
+// secret.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return Redacted
+	}
+	q := u.Query()
+	for k := range q {
+		if secret(strings.ToUpper(k)) {
+			q.Set(k, Redacted)
+		}
+	}
+	if len(q) > 0 {
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// CountError records err under its apperr reason, or its status code for
+// errors that don't carry one. nil is ignored.
+func (r *Registry) CountError(err error) {
+	if r == nil || err == nil {
+		return
+	}
+	key := string(apperr.ReasonOf(err))
+	if key == "" {
+		key = status.Code(err).String()
+	}
+	now := time.Now().Unix() / 60
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := &r.buckets[now%errorWindow]
+	if b.minute != now {
+		*b = bucket{minute: now, counts: map[string]int64{}}
+	}
+	b.counts[key]++
+}
+
+// RecentErrors sums the error counts of the last hour by reason.
+func (r *Registry) RecentErrors() map[string]int64 {
+	if r == nil {
+		return nil
+	}
+	now := time.Now().Unix() / 60
+	out := map[string]int64{}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.buckets {
+		if now-b.minute >= errorWindow {
+			continue
+		}
+		for k, n := range b.counts {
+			out[k] += n
+		}
+	}
+	return out
+}
+
+// Interceptor counts every failed RPC. Put it first in the chain so
+// rejections from rate limiting and auth are counted too.
+func (r *Registry) Interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		resp, err := next(ctx, req)
+		r.CountError(err)
+		return resp, err
+	}
+}
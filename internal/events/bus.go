@@ -0,0 +1,208 @@
+// Package events is the per-user pub/sub meant to back appointment watch
+// streams. Publishing never blocks: each subscriber has a bounded buffer,
+// and one that falls behind is cut off with a single Resync event instead of
+// holding up publishers or growing without limit. How many subscriptions one
+// user may hold at once is capped too.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	defaultBuffer     = 256
+	defaultMaxPerUser = 10
+)
+
+// ErrTooManySubscriptions is returned (wrapped, with the limit) when a user
+// already holds the maximum number of subscriptions. Streams should map it
+// to ResourceExhausted, HTTP to 429.
+var ErrTooManySubscriptions = errors.New("too many open watch streams")
+
+// Kind says what happened to an appointment.
+type Kind string
+
+const (
+	Created   Kind = "created"
+	Updated   Kind = "updated"
+	Cancelled Kind = "cancelled"
+	Restored  Kind = "restored"
+	// Resync is the last event a lapsed subscription gets: events were
+	// dropped, so the client has to refetch and subscribe again.
+	Resync Kind = "resync"
+)
+
+type Event struct {
+	Kind          Kind
+	AppointmentID string
+}
+
+// Subscription receives one user's events on C. C is closed after
+// Unsubscribe, or right after the Resync event once the subscription lapses.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID string
+	lapsed bool
+	stop   func() bool // detaches the context watcher
+}
+
+// Lapsed reports whether the subscription was cut off for falling behind.
+// Only meaningful once C is closed.
+func (s *Subscription) Lapsed() bool { return s.lapsed }
+
+type Bus struct {
+	mu      sync.Mutex
+	subs    map[string]map[*Subscription]struct{}
+	buffer  int
+	max     int
+	total   int
+	onDrop  func(n int)
+	onLapse func()
+	onCount func(total int)
+}
+
+type Option func(*Bus)
+
+// WithBuffer sets how many events a subscriber may have queued before it
+// lapses. Zero or less keeps the default of 256.
+func WithBuffer(n int) Option {
+	return func(b *Bus) {
+		if n > 0 {
+			b.buffer = n
+		}
+	}
+}
+
+// WithMaxPerUser caps the subscriptions one user can hold at once. Zero or
+// less keeps the default of 10.
+func WithMaxPerUser(n int) Option {
+	return func(b *Bus) {
+		if n > 0 {
+			b.max = n
+		}
+	}
+}
+
+func NewBus(opts ...Option) *Bus {
+	b := &Bus{subs: make(map[string]map[*Subscription]struct{}), buffer: defaultBuffer, max: defaultMaxPerUser}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// OnDrop registers a callback with the number of events each lapse threw
+// away, e.g. a metrics counter.
+func (b *Bus) OnDrop(fn func(n int)) { b.onDrop = fn }
+
+// OnLapse registers a callback for every subscription that lapses.
+func (b *Bus) OnLapse(fn func()) { b.onLapse = fn }
+
+// OnCount registers a callback with the number of live subscriptions
+// across all users whenever it changes, e.g. a metrics gauge.
+func (b *Bus) OnCount(fn func(total int)) { b.onCount = fn }
+
+// Subscribe starts delivering userID's events. The subscription ends by
+// itself when ctx is done, so a stream whose connection drops gives its
+// slot back without waiting for the handler to notice.
+func (b *Bus) Subscribe(ctx context.Context, userID string) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(b.subs[userID]) >= b.max {
+		return nil, fmt.Errorf("%w (max %d per user)", ErrTooManySubscriptions, b.max)
+	}
+	ch := make(chan Event, b.buffer)
+	s := &Subscription{C: ch, ch: ch, userID: userID}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][s] = struct{}{}
+	s.stop = context.AfterFunc(ctx, func() { b.Unsubscribe(s) })
+	b.count(1)
+	return s, nil
+}
+
+// Count is how many subscriptions userID holds right now.
+func (b *Bus) Count(userID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[userID])
+}
+
+// Unsubscribe closes s.C. Safe to call more than once and after a lapse.
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+// Publish hands ev to every subscriber of userID without waiting on any of
+// them. A subscriber whose buffer is full has its queued events dropped
+// and gets Resync in their place.
+func (b *Bus) Publish(userID string, ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[userID] {
+		select {
+		case s.ch <- ev:
+		default:
+			b.lapse(s)
+		}
+	}
+}
+
+// lapse empties s's buffer, which can't refill since only Publish sends and
+// it holds b.mu, so Resync always fits. The event that didn't fit counts as
+// dropped too.
+func (b *Bus) lapse(s *Subscription) {
+	dropped := 1
+	for {
+		select {
+		case <-s.ch:
+			dropped++
+			continue
+		default:
+		}
+		break
+	}
+	s.lapsed = true
+	s.ch <- Event{Kind: Resync}
+	b.remove(s)
+	if b.onDrop != nil {
+		b.onDrop(dropped)
+	}
+	if b.onLapse != nil {
+		b.onLapse()
+	}
+}
+
+func (b *Bus) remove(s *Subscription) {
+	set, ok := b.subs[s.userID]
+	if !ok {
+		return
+	}
+	if _, ok := set[s]; !ok {
+		return
+	}
+	delete(set, s)
+	if len(set) == 0 {
+		delete(b.subs, s.userID)
+	}
+	s.stop()
+	close(s.ch)
+	b.count(-1)
+}
+
+func (b *Bus) count(delta int) {
+	b.total += delta
+	if b.onCount != nil {
+		b.onCount(b.total)
+	}
+}
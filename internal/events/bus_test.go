@@ -0,0 +1,260 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func sub(t *testing.T, b *Bus, userID string) *Subscription {
+	t.Helper()
+	s, err := b.Subscribe(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	return s
+}
+
+// one subscriber never reads; publishing must not wait on it, the fast ones
+// must see every event, and the slow one gets exactly one Resync.
+func TestSlowSubscriberLapses(t *testing.T) {
+	const buffer, events, fast = 16, 16 * 300, 20
+	b := NewBus(WithBuffer(buffer), WithMaxPerUser(fast+1))
+	var dropped, lapses int
+	b.OnDrop(func(n int) { dropped += n })
+	b.OnLapse(func() { lapses++ })
+
+	slow := sub(t, b, "u1")
+	var wg sync.WaitGroup
+	var seen sync.WaitGroup // one per fast subscriber per batch
+	counts := make([]int, fast)
+	for i := 0; i < fast; i++ {
+		s := sub(t, b, "u1")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for ev := range s.C {
+				if ev.Kind == Resync {
+					t.Errorf("fast subscriber %d lapsed", i)
+					return
+				}
+				counts[i]++
+				if counts[i]%buffer == 0 {
+					seen.Done()
+				}
+			}
+		}(i)
+	}
+	other := sub(t, b, "u2")
+
+	// publish a buffer's worth at a time and let the fast subscribers catch
+	// up between batches, so only the slow one can fall behind
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < events; i += buffer {
+			seen.Add(fast)
+			for j := i; j < i+buffer; j++ {
+				b.Publish("u1", Event{Kind: Updated, AppointmentID: fmt.Sprint(j)})
+			}
+			seen.Wait()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publisher stalled behind a slow subscriber")
+	}
+
+	var got []Event
+	for ev := range slow.C {
+		got = append(got, ev)
+	}
+	if len(got) != 1 || got[0].Kind != Resync || !slow.Lapsed() {
+		t.Fatalf("slow subscriber got %v (lapsed %v), want a single resync", got, slow.Lapsed())
+	}
+	if dropped != buffer+1 || lapses != 1 {
+		t.Errorf("dropped %d lapses %d, want %d and 1", dropped, lapses, buffer+1)
+	}
+
+	b.mu.Lock()
+	for s := range b.subs["u1"] {
+		b.remove(s)
+	}
+	b.mu.Unlock()
+	wg.Wait()
+	for i, n := range counts {
+		if n != events {
+			t.Errorf("fast subscriber %d got %d of %d events", i, n, events)
+		}
+	}
+
+	select {
+	case ev := <-other.C:
+		t.Errorf("u2 got u1's event %v", ev)
+	default:
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBus(WithBuffer(1))
+	s := sub(t, b, "u1")
+	b.Unsubscribe(s)
+	b.Unsubscribe(s) // idempotent
+	if _, ok := <-s.C; ok {
+		t.Fatal("channel still open after unsubscribe")
+	}
+	b.Publish("u1", Event{Kind: Created}) // no subscribers left, must not panic
+	if len(b.subs) != 0 {
+		t.Errorf("subscriber map not cleaned up: %v", b.subs)
+	}
+
+	// unsubscribing after a lapse is fine too
+	s = sub(t, b, "u1")
+	b.Publish("u1", Event{Kind: Created})
+	b.Publish("u1", Event{Kind: Updated})
+	b.Unsubscribe(s)
+	if ev := <-s.C; ev.Kind != Resync {
+		t.Errorf("got %v, want resync", ev)
+	}
+}
+
+func TestMaxPerUser(t *testing.T) {
+	b := NewBus(WithMaxPerUser(2))
+	var total int
+	b.OnCount(func(n int) { total = n })
+
+	a := sub(t, b, "u1")
+	sub(t, b, "u1")
+	if _, err := b.Subscribe(context.Background(), "u1"); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Fatalf("third subscription: got %v, want ErrTooManySubscriptions", err)
+	}
+	sub(t, b, "u2") // the cap is per user
+	if total != 3 {
+		t.Errorf("total %d, want 3", total)
+	}
+
+	b.Unsubscribe(a)
+	sub(t, b, "u1")
+
+	// a lapse frees the slot as well
+	b = NewBus(WithMaxPerUser(1), WithBuffer(1))
+	sub(t, b, "u1")
+	b.Publish("u1", Event{Kind: Created})
+	b.Publish("u1", Event{Kind: Updated})
+	sub(t, b, "u1")
+}
+
+func TestContextEndsSubscription(t *testing.T) {
+	b := NewBus(WithMaxPerUser(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := b.Subscribe(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, ok := <-s.C; ok {
+		t.Fatal("channel still open after cancel")
+	}
+	if n := b.Count("u1"); n != 0 {
+		t.Errorf("count %d after cancel", n)
+	}
+	if _, err := b.Subscribe(ctx, "u1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("subscribe with a done context: %v", err)
+	}
+}
+
+// a stream's context ends when its connection is reset, without the
+// client saying goodbye; the slot must come back by itself
+func TestDroppedConnectionFreesSlot(t *testing.T) {
+	b := NewBus(WithMaxPerUser(3))
+	desc := &grpc.ServiceDesc{
+		ServiceName: "test.Watch",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Watch",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				s, err := b.Subscribe(stream.Context(), "u1")
+				if err != nil {
+					return status.Error(codes.ResourceExhausted, err.Error())
+				}
+				if err := stream.SendHeader(metadata.Pairs("subscribed", "1")); err != nil {
+					return err
+				}
+				for range s.C {
+				}
+				return stream.Context().Err()
+			},
+		}},
+	}
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	srv.RegisterService(desc, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	var raw []net.Conn
+	open := func() (grpc.ClientStream, error) {
+		conn, err := grpc.NewClient("passthrough:///bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				c, err := lis.DialContext(ctx)
+				raw = append(raw, c)
+				return c, err
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		st, err := conn.NewStream(context.Background(), &desc.Streams[0], "/test.Watch/Watch")
+		if err != nil {
+			return nil, err
+		}
+		if err := st.CloseSend(); err != nil {
+			return nil, err
+		}
+		md, err := st.Header()
+		if err == nil && len(md.Get("subscribed")) == 0 {
+			// rejected before the header; the status comes with the trailer
+			err = st.RecvMsg(&emptypb.Empty{})
+		}
+		return st, err
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := open(); err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+	}
+	_, err := open()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("fourth stream: got %v, want ResourceExhausted", err)
+	}
+
+	// reset the transports underneath the clients
+	for _, c := range raw {
+		c.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Count("u1") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions still held after the connections dropped", b.Count("u1"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := open(); err != nil {
+		t.Fatalf("stream after reset: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package grpcweb
+
+import (
+	"net/url"
+	"strings"
+)
+
+// originPolicy is the CORS allow-list. Entries are exact origins
+// ("https://app.example.com"), wildcard subdomains ("https://*.example.com",
+// which matches any depth of subdomain but not example.com itself), or "*"
+// to let any page call without credentials. A listed origin gets its own
+// name back with Access-Control-Allow-Credentials, so its cookies work;
+// "*" is sent back as a literal "*" without it, so a page anywhere can
+// make bearer-token calls but never ride on a user's cookies.
+type originPolicy struct {
+	any      bool
+	exact    map[string]bool
+	suffixes []wildcard
+}
+
+type wildcard struct {
+	scheme string
+	suffix string // ".example.com" or ".example.com:8443"
+}
+
+func newOriginPolicy(origins []string) originPolicy {
+	p := originPolicy{exact: map[string]bool{}}
+	for _, o := range origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch {
+		case o == "":
+		case o == "*":
+			p.any = true
+		case strings.Contains(o, "://*."):
+			scheme, host, _ := strings.Cut(o, "://*")
+			p.suffixes = append(p.suffixes, wildcard{scheme: strings.ToLower(scheme), suffix: strings.ToLower(host)})
+		default:
+			p.exact[strings.ToLower(o)] = true
+		}
+	}
+	return p
+}
+
+// match returns the Access-Control-Allow-Origin for origin, "" if it isn't
+// allowed, and whether credentials are.
+func (p originPolicy) match(origin string) (allow string, credentials bool) {
+	switch {
+	case origin == "" || origin == "null":
+		return "", false
+	case p.listed(origin):
+		return origin, true
+	case p.any:
+		return "*", false
+	}
+	return "", false
+}
+
+func (p originPolicy) listed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return false
+	}
+	for _, w := range p.suffixes {
+		if u.Scheme != w.scheme {
+			continue
+		}
+		// at least one label in front of the suffix
+		if len(u.Host) > len(w.suffix) && strings.HasSuffix(u.Host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
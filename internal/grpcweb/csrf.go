@@ -0,0 +1,64 @@
+package grpcweb
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// Cookie and header names of the browser session. A page logged in through
+// the REST flow holds access_token (HttpOnly) and csrf_token (readable by
+// its script), and echoes csrf_token back in X-CSRF-Token.
+const (
+	AccessCookie = "access_token"
+	CSRFCookie   = "csrf_token"
+	CSRFHeader   = "X-CSRF-Token"
+)
+
+// SetCSRFCookie issues a new random CSRF token. Call it at login and on
+// every refresh, next to the session cookies, so the token rotates with
+// them. Unlike those it isn't HttpOnly: a page on another site can't read
+// it, and that's the point, so it can't forge the matching header.
+func SetCSRFCookie(w http.ResponseWriter) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	tok := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    tok,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return tok, nil
+}
+
+// csrfOK is the double-submit check. Only requests that would be
+// authenticated by cookie need it: a browser attaches cookies to a
+// cross-site request on its own, but never an Authorization header, so a
+// request carrying one is exempt. Safe methods change nothing and pass.
+func csrfOK(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	if _, err := r.Cookie(AccessCookie); err != nil {
+		return true
+	}
+	return csrfMatches(r)
+}
+
+// csrfMatches reports whether r's X-CSRF-Token is its csrf_token cookie.
+func csrfMatches(r *http.Request) bool {
+	c, err := r.Cookie(CSRFCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.Header.Get(CSRFHeader))) == 1
+}
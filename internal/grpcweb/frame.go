@@ -0,0 +1,60 @@
+package grpcweb
+
+import (
+	"encoding/binary"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+)
+
+// default cap on a request message, across all of its DATA frames
+const defaultMaxMessageBytes = 4 << 20
+
+// grpc-web frame: 1-byte flag + 4-byte big-endian length + payload
+const (
+	flagData       = 0x00
+	flagCompressed = 0x01
+	flagTrailer    = 0x80
+)
+
+// readMessage reassembles the request message from body. DATA frames are
+// concatenated; a trailer frame, if any, has to be the last thing in the
+// body. Lengths are checked against max before anything is allocated.
+func readMessage(body []byte, max int) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, apperr.New(apperr.BadFrame, "empty body")
+	}
+	var msg []byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, apperr.New(apperr.BadFrame, "incomplete frame header")
+		}
+		flag, n := body[0], binary.BigEndian.Uint32(body[1:5])
+		if uint64(n) > uint64(max) || len(msg)+int(n) > max {
+			return nil, apperr.Msg(apperr.MessageTooLarge, i18n.MessageTooLarge, max)
+		}
+		if uint64(n) > uint64(len(body)-5) {
+			return nil, apperr.New(apperr.BadFrame, "incomplete frame")
+		}
+		frame := body[5 : 5+n]
+		body = body[5+n:]
+
+		switch {
+		case flag == flagData:
+			msg = append(msg, frame...)
+		case flag&flagTrailer != 0:
+			if len(body) > 0 {
+				return nil, apperr.New(apperr.BadFrame, "data after trailer frame")
+			}
+		case flag&flagCompressed != 0:
+			return nil, apperr.New(apperr.CompressionUnsupported, "compressed frames are not supported")
+		default:
+			return nil, apperr.Newf(apperr.BadFrame, "unknown frame flag 0x%02x", flag)
+		}
+	}
+	if msg == nil {
+		// a lone empty DATA frame is a valid empty message
+		return []byte{}, nil
+	}
+	return msg, nil
+}
@@ -0,0 +1,60 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func frame(flag byte, payload []byte) []byte {
+	f := make([]byte, 5, 5+len(payload))
+	f[0] = flag
+	binary.BigEndian.PutUint32(f[1:5], uint32(len(payload)))
+	return append(f, payload...)
+}
+
+func header(flag byte, n uint32) []byte {
+	f := make([]byte, 5)
+	f[0] = flag
+	binary.BigEndian.PutUint32(f[1:5], n)
+	return f
+}
+
+func join(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func TestReadMessage(t *testing.T) {
+	msg := []byte("hello, world")
+	cases := []struct {
+		name string
+		body []byte
+		want []byte
+		code codes.Code
+	}{
+		{"single frame", frame(flagData, msg), msg, codes.OK},
+		{"split across frames", join(frame(flagData, msg[:5]), frame(flagData, msg[5:])), msg, codes.OK},
+		{"with trailer", join(frame(flagData, msg), frame(flagTrailer, []byte("x-a:b\r\n"))), msg, codes.OK},
+		{"empty message", frame(flagData, nil), []byte{}, codes.OK},
+		{"empty body", nil, nil, codes.InvalidArgument},
+		{"short header", []byte{0, 0, 0}, nil, codes.InvalidArgument},
+		{"truncated payload", frame(flagData, msg)[:10], nil, codes.InvalidArgument},
+		{"trailing junk", join(frame(flagData, msg), []byte{1, 2}), nil, codes.InvalidArgument},
+		{"data after trailer", join(frame(flagTrailer, nil), frame(flagData, msg)), nil, codes.InvalidArgument},
+		{"compressed", frame(flagCompressed, msg), nil, codes.Unimplemented},
+		{"unknown flag", frame(0x02, msg), nil, codes.InvalidArgument},
+		{"oversized length prefix", join(header(flagData, 0xffffffff), msg), nil, codes.ResourceExhausted},
+		{"oversized across frames", join(frame(flagData, make([]byte, 60)), frame(flagData, make([]byte, 60))), nil, codes.ResourceExhausted},
+	}
+	for _, tc := range cases {
+		got, err := readMessage(tc.body, 100)
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s: code %v, want %v (%v)", tc.name, code, tc.code, err)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
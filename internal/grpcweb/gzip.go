@@ -0,0 +1,91 @@
+package grpcweb
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// responses smaller than this aren't worth compressing: gzip's own header
+// and trailer are ~20 bytes and a status-only reply is a few dozen
+const minGzipBytes = 1024
+
+var gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip (and
+// doesn't turn it off with q=0).
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if c := strings.ToLower(strings.TrimSpace(coding)); c != "gzip" && c != "*" {
+			continue
+		}
+		name, val, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses the whole response, frames and trailer alike, at
+// the HTTP level. It holds the status and the first bytes back until it
+// knows whether the response reaches minGzipBytes; Close sends whatever's
+// still held. grpc-web-text wraps it, so it's the base64 that's
+// compressed, which still gets most of the saving.
+type gzipWriter struct {
+	http.ResponseWriter
+	code int
+	buf  []byte
+	gz   *gzip.Writer
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	if g.code == 0 {
+		g.code = code
+	}
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) < minGzipBytes {
+		return len(p), nil
+	}
+	g.Header().Set("Content-Encoding", "gzip")
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status())
+	g.gz = gzipPool.Get().(*gzip.Writer)
+	g.gz.Reset(g.ResponseWriter)
+	_, err := g.gz.Write(g.buf)
+	g.buf = nil
+	return len(p), err
+}
+
+// Close finishes the response.
+func (g *gzipWriter) Close() error {
+	if g.gz == nil {
+		g.ResponseWriter.WriteHeader(g.status())
+		_, err := g.ResponseWriter.Write(g.buf)
+		return err
+	}
+	err := g.gz.Close()
+	g.gz.Reset(nil)
+	gzipPool.Put(g.gz)
+	g.gz = nil
+	return err
+}
+
+func (g *gzipWriter) status() int {
+	if g.code == 0 {
+		return http.StatusOK
+	}
+	return g.code
+}
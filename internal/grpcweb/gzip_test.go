@@ -0,0 +1,191 @@
+package grpcweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"gzip, deflate, br":     true,
+		"deflate, gzip;q=0.5":   true,
+		"GZIP":                  true,
+		"gzip;q=0":              false,
+		"br, gzip ; q=0.0":      false,
+		"*":                     true,
+		"identity":              false,
+		"x-gzip":                false,
+		"deflate;q=1, gzip;q=1": true,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("%q: %v, want %v", header, got, want)
+		}
+	}
+}
+
+// listResponse is n appointments as ListAppointments would return them.
+func listResponse(n int) *pb.ListAppointmentsResponse {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	resp := &pb.ListAppointmentsResponse{}
+	for i := range n {
+		s := start.Add(time.Duration(i) * 90 * time.Minute)
+		resp.Appointments = append(resp.Appointments, &pb.Appointment{
+			Id:          fmt.Sprintf("6f1c2a3e-0000-4000-8000-%012d", i),
+			Title:       fmt.Sprintf("Weekly sync #%d", i),
+			Description: "Agenda: status, blockers, next steps",
+			StartTime:   timestamppb.New(s),
+			EndTime:     timestamppb.New(s.Add(time.Hour)),
+			UserId:      "0b7e9a52-4c1d-4e8a-9f3b-2d6c8e1a7f40",
+			Status:      "confirmed",
+			Location:    "Room 4B",
+			CreatedAt:   timestamppb.New(start.Add(-24 * time.Hour)),
+			UpdatedAt:   timestamppb.New(start.Add(-24 * time.Hour)),
+		})
+	}
+	return resp
+}
+
+// gunzip undoes the response's Content-Encoding, if any.
+func gunzip(t testing.TB, rec *httptest.ResponseRecorder) []byte {
+	t.Helper()
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		return rec.Body.Bytes()
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestGzipWriter(t *testing.T) {
+	want := listResponse(50)
+	rec := httptest.NewRecorder()
+	gz := &gzipWriter{ResponseWriter: rec}
+	writeMessage(gz, want)
+	gz.Close()
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("%d, encoding %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	body := gunzip(t, rec)
+	data, err := readMessage(body, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &pb.ListAppointmentsResponse{}
+	if err := proto.Unmarshal(data, got); err != nil || !proto.Equal(got, want) {
+		t.Errorf("round trip: %v", err)
+	}
+	// the trailer frame is inside the compressed stream
+	if !bytes.HasSuffix(body, []byte("grpc-status:0\r\n")) {
+		t.Errorf("no trailer at the end: %q", body[len(body)-20:])
+	}
+
+	// a status-only reply is sent as is
+	rec = httptest.NewRecorder()
+	gz = &gzipWriter{ResponseWriter: rec}
+	writeStatus(gz, apperr.New(apperr.NotFound, "not found"))
+	gz.Close()
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() == 0 || rec.Body.Bytes()[0] != flagTrailer {
+		t.Errorf("small reply: %q %q", rec.Header().Get("Content-Encoding"), rec.Body.Bytes())
+	}
+}
+
+// a big error (here, a long message) compresses like a big success
+func TestGzipLargeError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	gz := &gzipWriter{ResponseWriter: rec}
+	textWriter{gz}.WriteHeader(http.StatusOK)
+	writeStatus(textWriter{gz}, apperr.New(apperr.InvalidArgument, strings.Repeat("too long ", 200)))
+	gz.Close()
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Content-Type") != "application/grpc-web-text+proto" {
+		t.Fatalf("headers %v", rec.Header())
+	}
+	body, err := decodeText(gunzip(t, rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body[0] != flagTrailer || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 || !bytes.Contains(body, []byte("grpc-status:3\r\n")) {
+		t.Errorf("trailer %q", body[:40])
+	}
+}
+
+// the bridge compresses only for clients that ask, and keeps its CORS
+// headers either way
+func TestBridgeGzipHeaders(t *testing.T) {
+	b, err := New("localhost:0", nil, auth.SingleKey("s"), WithAllowedOrigins("https://app.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for _, enc := range []string{"", "gzip"} {
+		req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/ListAppointments",
+			bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Accept-Encoding", enc)
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, req)
+
+		if !strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "Grpc-Status") ||
+			rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+			t.Errorf("%q: CORS headers %v", enc, rec.Header())
+		}
+		if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Encoding") {
+			t.Errorf("%q: Vary %v", enc, rec.Header().Values("Vary"))
+		}
+		// nothing is listening, so this is a short Unavailable trailer
+		body := gunzip(t, rec)
+		if len(body) == 0 || body[0] != flagTrailer || !bytes.Contains(body, []byte("grpc-status:14")) {
+			t.Errorf("%q: body %q", enc, body)
+		}
+	}
+}
+
+func BenchmarkListResponseSize(b *testing.B) {
+	resp := listResponse(500)
+	for _, tc := range []struct {
+		name string
+		gzip bool
+	}{{"identity", false}, {"gzip", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			var n int
+			for b.Loop() {
+				rec := httptest.NewRecorder()
+				var w http.ResponseWriter = rec
+				gz := &gzipWriter{ResponseWriter: rec}
+				if tc.gzip {
+					w = gz
+				}
+				writeMessage(w, resp)
+				if tc.gzip {
+					gz.Close()
+				}
+				n = rec.Body.Len()
+			}
+			b.ReportMetric(float64(n), "bytes/op")
+		})
+	}
+}
@@ -2,77 +2,259 @@ package grpcweb
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/encoding/protowire"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/proto"
 
 	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
 	"schedule-management-api/internal/auth"
 	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/i18n"
 	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/tracing"
 )
 
-// Bridge translates gRPC-Web (browser HTTP/1.1) -> native gRPC via TCP.
+// Bridge translates gRPC-Web (browser HTTP/1.1) -> native gRPC, either by
+// calling the handler in-process or by forwarding over TCP.
 type Bridge struct {
-	conn   *grpc.ClientConn
-	direct *handler.Handler
-	secret string
+	conn    *grpc.ClientConn // nil when serving in-process
+	direct  *handler.Handler
+	keys    auth.Keys
+	authCfg auth.Config
+	origins originPolicy
+
+	methods      map[string]method
+	interceptors []grpc.UnaryServerInterceptor
+	chain        grpc.UnaryServerInterceptor
+
+	maxMessage int
+	timeout    time.Duration // for a whole call, reading the body included
+
+	forwardHeaders []string // lowercase, besides authorization
+	allowHeaders   string   // Access-Control-Allow-Headers for preflights
+
+	limiter    *middleware.RateLimiter // nil: no limit at the bridge
+	trustProxy bool
+
+	upstreamTLS *tls.Config // nil: plaintext to the upstream
+}
+
+// headers besides Authorization passed on as metadata unless
+// WithForwardHeaders says otherwise
+var defaultForwardHeaders = []string{"x-request-id", "user-agent"}
+
+// how long a call may take, from the first byte of its body on, unless
+// WithRequestTimeout says otherwise
+const defaultRequestTimeout = 30 * time.Second
+
+// request headers a browser may send cross-origin
+const baseAllowHeaders = "Content-Type, X-Grpc-Web, X-User-Agent, Authorization, Grpc-Timeout, X-CSRF-Token, x-grpc-web, Traceparent, Tracestate, X-Schedule-Version"
+
+// method is one unary RPC of a registered service implementation.
+type method struct {
+	srv  any
+	desc grpc.MethodDesc
+}
+
+type Option func(*Bridge)
+
+// WithAllowedOrigins sets which browser origins get CORS headers. Without
+// it no cross-origin browser calls are allowed.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(b *Bridge) { b.origins = newOriginPolicy(origins) }
+}
+
+// WithAuthConfig checks tokens on in-process calls against c's iss/aud.
+// It's ignored if WithInterceptors replaces the default chain.
+func WithAuthConfig(c auth.Config) Option {
+	return func(b *Bridge) { b.authCfg = c }
+}
+
+// WithInterceptors runs in-process calls through ics, outermost first,
+// instead of the default locale, deprecation warning and auth check. Pass
+// the grpc server's own chain so both transports log, limit, authenticate
+// and localize alike.
+func WithInterceptors(ics ...grpc.UnaryServerInterceptor) Option {
+	return func(b *Bridge) { b.interceptors = ics }
 }
 
-// New dials the gRPC server at addr (e.g. "localhost:50051").
-// If directHandler is provided, it bypasses network for specific methods.
-func New(addr string, directHandler *handler.Handler, secret string) (*Bridge, error) {
-	conn, err := grpc.NewClient(
-		addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+// WithMaxMessageBytes caps the size of a request message (default 4 MB).
+func WithMaxMessageBytes(n int) Option {
+	return func(b *Bridge) {
+		if n > 0 {
+			b.maxMessage = n
+		}
+	}
+}
+
+// WithRequestTimeout bounds each call, reading its body included
+// (default 30s). A client's shorter grpc-timeout still wins.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(b *Bridge) {
+		if d > 0 {
+			b.timeout = d
+		}
+	}
+}
+
+// WithForwardHeaders sets which request headers reach the handlers as grpc
+// metadata, besides Authorization and Accept-Language which always do (default x-request-id
+// and user-agent). Names grpc reserves for itself, like user-agent, can't
+// travel as metadata and arrive prefixed x-forwarded-, in-process too, so
+// handlers look in one place either way.
+func WithForwardHeaders(names ...string) Option {
+	return func(b *Bridge) {
+		b.forwardHeaders = nil
+		for _, n := range names {
+			if n = strings.ToLower(strings.TrimSpace(n)); n != "" && n != "authorization" && n != "accept-language" {
+				b.forwardHeaders = append(b.forwardHeaders, n)
+			}
+		}
+	}
+}
+
+// WithUpstreamTLS dials the upstream gRPC server over TLS with c, for a
+// bridge on another host. Without it the connection is plaintext. Only
+// matters when forwarding.
+func WithUpstreamTLS(c *tls.Config) Option {
+	return func(b *Bridge) { b.upstreamTLS = c }
+}
+
+// New builds a bridge. With addr "" every method of directHandler is
+// served in-process, looked up in the generated service descriptors, and
+// nothing needs to listen on a gRPC port. Otherwise it forwards every call
+// to the gRPC server at addr (e.g. "localhost:50051"), for a bridge running
+// apart from the server; directHandler then only serves share pages and
+// may be nil.
+func New(addr string, directHandler *handler.Handler, keys auth.Keys, opts ...Option) (*Bridge, error) {
+	b := &Bridge{
+		direct: directHandler, keys: keys, origins: newOriginPolicy(nil), maxMessage: defaultMaxMessageBytes,
+		timeout: defaultRequestTimeout, forwardHeaders: defaultForwardHeaders,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	b.allowHeaders = baseAllowHeaders
+	for _, n := range b.forwardHeaders {
+		if !strings.Contains(strings.ToLower(b.allowHeaders), n) {
+			b.allowHeaders += ", " + http.CanonicalHeaderKey(n)
+		}
+	}
+	if addr == "" {
+		if directHandler == nil {
+			return nil, errors.New("grpcweb: serving in-process needs a handler")
+		}
+		b.methods = map[string]method{}
+		for _, sd := range []grpc.ServiceDesc{pb.AuthService_ServiceDesc, pb.ScheduleService_ServiceDesc, pb.AdminService_ServiceDesc} {
+			for _, md := range sd.Methods {
+				b.methods["/"+sd.ServiceName+"/"+md.MethodName] = method{srv: directHandler, desc: md}
+			}
+		}
+		if b.interceptors == nil {
+			b.interceptors = []grpc.UnaryServerInterceptor{middleware.Locale(), middleware.Deprecation(), middleware.Auth(keys, b.authCfg)}
+		}
+		b.chain = chain(b.interceptors)
+		return b, nil
+	}
+	creds := insecure.NewCredentials()
+	if b.upstreamTLS != nil {
+		creds = credentials.NewTLS(b.upstreamTLS)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("grpcweb dial: %w", err)
 	}
-	return &Bridge{conn: conn, direct: directHandler, secret: secret}, nil
+	b.conn = conn
+	return b, nil
 }
 
-func (b *Bridge) Close() { b.conn.Close() }
+func (b *Bridge) Close() {
+	if b.conn != nil {
+		b.conn.Close()
+	}
+}
 
 // Handler returns an http.Handler that translates gRPC-Web -> gRPC.
 func (b *Bridge) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+		// the response depends on Origin, so shared caches must key on it or
+		// they'll hand one site's CORS headers to another
+		w.Header().Add("Vary", "Origin")
+		allow, credentials := b.origins.match(r.Header.Get("Origin"))
+		allowed := allow != ""
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", allow)
+			if credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
 		}
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers",
-			"Content-Type, X-Grpc-Web, X-User-Agent, Authorization, x-grpc-web")
-		w.Header().Set("Access-Control-Expose-Headers",
-			"Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin, grpc-status, grpc-message")
-		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		if r.Method == http.MethodOptions {
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			// preflights are cacheable (per origin and requested headers)
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", b.allowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.Header().Set("Cache-Control", "public, max-age=86400")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
+
+		// real responses carry per-user data and must never be cached
+		w.Header().Set("Cache-Control", "no-store")
+		if allowed {
+			w.Header().Set("Access-Control-Expose-Headers",
+				"Grpc-Status, Grpc-Message, Grpc-Status-Details-Bin, X-Error-Info, grpc-status, grpc-message, X-Schedule-Version")
+		}
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/share/") && b.direct != nil {
+			b.serveShare(w, r)
+			return
+		}
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if strings.HasPrefix(r.URL.Path, "/auth/") {
+			b.serveSession(w, r)
+			return
+		}
 		ct := r.Header.Get("Content-Type")
 		if !strings.HasPrefix(ct, "application/grpc-web") {
 			http.Error(w, "not grpc-web", http.StatusUnsupportedMediaType)
 			return
 		}
+		if !csrfOK(r) {
+			http.Error(w, "cookie-authenticated request needs an X-CSRF-Token header matching the csrf_token cookie", http.StatusForbidden)
+			return
+		}
 
 		log.Printf("grpc-web -> %s", r.URL.Path)
 		b.forward(w, r)
@@ -80,74 +262,238 @@ func (b *Bridge) Handler() http.Handler {
 }
 
 func (b *Bridge) forward(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	// the browser's traceparent, if any, is the parent of the bridge's span,
+	// which is the parent of the call's
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Tracer().Start(ctx, "grpc-web "+strings.TrimPrefix(r.URL.Path, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.route", r.URL.Path)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+	// a client trickling its body in can't hold the call past its time
+	// either; the read fails at the deadline (not supported, and not
+	// needed, on test recorders)
+	deadline, _ := ctx.Deadline()
+	http.NewResponseController(w).SetReadDeadline(deadline)
+	rw := w
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		gz := &gzipWriter{ResponseWriter: w}
+		defer gz.Close()
+		w = gz
+	}
+	text := strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web-text")
+	if text {
+		w = textWriter{w}
+	}
+	// the bridge's own errors follow Accept-Language like the handlers'
+	locale := i18n.Match(strings.Join(r.Header.Values("Accept-Language"), ", "))
+	fail := func(err error) { writeStatus(w, apperr.Localize(err, locale)) }
+	if !b.allow(r) {
+		fail(apperr.New(apperr.RateLimited, "too many requests"))
+		return
+	}
+	// room for the frame headers and base64's 4/3 blowup; readMessage
+	// enforces the real limit. A body past this is refused as it arrives
+	// rather than read to the end.
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, int64(b.maxMessage)*4/3+1024))
 	if err != nil {
-		writeError(w, codes.Internal, "read body failed")
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			fail(apperr.Msg(apperr.MessageTooLarge, i18n.MessageTooLarge, b.maxMessage))
+		case errors.Is(err, os.ErrDeadlineExceeded) || ctx.Err() != nil:
+			fail(apperr.New(apperr.DeadlineExceeded, "request body not received in time"))
+		default:
+			fail(apperr.New(apperr.Internal, "read body failed"))
+		}
 		return
 	}
-	if len(body) < 5 {
-		writeError(w, codes.InvalidArgument, "body too short")
+	if text {
+		if body, err = decodeText(body); err != nil {
+			fail(apperr.New(apperr.BadFrame, "bad base64 body"))
+			return
+		}
+	}
+	payload, err := readMessage(body, b.maxMessage)
+	if err != nil {
+		fail(err)
 		return
 	}
 
-	// grpc-web frame: 1-byte flag + 4-byte big-endian length + protobuf
-	msgLen := binary.BigEndian.Uint32(body[1:5])
-	if int(msgLen)+5 > len(body) {
-		writeError(w, codes.InvalidArgument, "incomplete frame")
+	// the client's deadline, if it set one, bounds the call either way
+	if v := r.Header.Get("Grpc-Timeout"); v != "" {
+		d, ok := parseTimeout(v)
+		if !ok {
+			fail(apperr.New(apperr.InvalidArgument, "malformed grpc-timeout"))
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	var out []byte
+	var header metadata.MD
+	if b.conn == nil {
+		out, header, err = b.invoke(r, payload)
+	} else {
+		out, header, err = b.dial(r, payload)
+	}
+	if err != nil {
+		// a call that ran out of time may have failed any which way
+		if cerr := apperr.FromContext(r.Context().Err()); cerr != nil {
+			err = cerr
+		}
+		st, _ := status.FromError(err)
+		log.Printf("grpc-web error: %s: %s", st.Code(), st.Message())
+		fail(err)
 		return
 	}
-	payload := body[5 : 5+msgLen]
+	setHeaders(w, header)
+	writeSuccess(w, out)
+}
 
-	// forward metadata
-	md := metadata.MD{}
-	if vals := r.Header.Values("Authorization"); len(vals) > 0 {
-		md.Set("authorization", vals...)
+// setHeaders passes on the response metadata a browser has a use for: the
+// schedule version a write answers with, to send back as min_version.
+func setHeaders(w http.ResponseWriter, header metadata.MD) {
+	if v := header.Get(handler.ScheduleVersionKey); len(v) > 0 {
+		w.Header().Set("X-Schedule-Version", v[len(v)-1])
 	}
-	ctx := metadata.NewOutgoingContext(r.Context(), md)
+}
 
-	// BYPASS: manually handle Login/Register if direct handler is available
-	if b.direct != nil {
-		if strings.HasSuffix(r.URL.Path, "/Login") {
-			b.manualLogin(ctx, w, payload)
-			return
-		}
-		if strings.HasSuffix(r.URL.Path, "/Register") {
-			b.manualRegister(ctx, w, payload)
-			return
-		}
-		if strings.HasSuffix(r.URL.Path, "/ListAppointments") {
-			b.manualListAppointments(ctx, w, payload, r.Header.Get("Authorization"))
-			return
-		}
-		if strings.HasSuffix(r.URL.Path, "/CreateAppointment") {
-			b.manualCreateAppointment(ctx, w, payload, r.Header.Get("Authorization"))
-			return
+// headerStream stands in for the grpc server's stream when a method runs
+// in-process, so what it sets with grpc.SetHeader reaches the response.
+type headerStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return s.method }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(metadata.MD) error { return nil }
+
+// invoke serves r in-process: the generated handler decodes payload into
+// the method's request type and calls the implementation through b's
+// interceptors, which see the same metadata and peer a grpc server would.
+// It returns the response with the header metadata the method set.
+func (b *Bridge) invoke(r *http.Request, payload []byte) ([]byte, metadata.MD, error) {
+	m, ok := b.methods[r.URL.Path]
+	if !ok {
+		return nil, nil, apperr.Newf(apperr.MethodUnknown, "unknown method %s", r.URL.Path)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), b.requestMD(r))
+	stream := &headerStream{method: r.URL.Path}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		if b.trustProxy {
+			if ip := net.ParseIP(b.clientIP(r)); ip != nil {
+				addr = &net.TCPAddr{IP: ip}
+			}
 		}
-		if strings.HasSuffix(r.URL.Path, "/GetAppointment") {
-			b.manualGetAppointment(ctx, w, payload, r.Header.Get("Authorization"))
-			return
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	if b.limiter != nil {
+		// allow already took this call's token
+		ctx = middleware.Charged(ctx, b.limiter)
+	}
+	dec := func(v any) error {
+		if err := proto.Unmarshal(payload, v.(proto.Message)); err != nil {
+			return apperr.New(apperr.BadFrame, "parse error")
 		}
-		if strings.HasSuffix(r.URL.Path, "/UpdateAppointment") {
-			b.manualUpdateAppointment(ctx, w, payload, r.Header.Get("Authorization"))
-			return
+		return nil
+	}
+	resp, err := m.desc.Handler(m.srv, ctx, dec, b.chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := proto.Marshal(resp.(proto.Message))
+	if err != nil {
+		return nil, nil, apperr.New(apperr.Internal, "encode response failed")
+	}
+	return out, stream.header, nil
+}
+
+// dial forwards r to the grpc server, passing the bytes through untouched,
+// and returns the response with the server's header metadata.
+func (b *Bridge) dial(r *http.Request, payload []byte) ([]byte, metadata.MD, error) {
+	md := b.requestMD(r)
+	// for an upstream that trusts this bridge to say who its callers are
+	md.Set(middleware.ForwardedFor, b.clientIP(r))
+	otel.GetTextMapPropagator().Inject(r.Context(), tracing.MetadataCarrier(md))
+	ctx := metadata.NewOutgoingContext(r.Context(), md)
+	resp := &rawMsg{}
+	var header metadata.MD
+	if err := b.conn.Invoke(ctx, r.URL.Path, &rawMsg{data: payload}, resp, grpc.ForceCodec(rawCodec{}), grpc.Header(&header)); err != nil {
+		return nil, nil, err
+	}
+	return resp.data, header, nil
+}
+
+// requestMD carries the caller's credentials on as grpc metadata: the
+// Authorization header if there is one, else the access_token cookie of a
+// browser session as a bearer token. The header wins so a page can act
+// with an explicit token while a session cookie is still around; the
+// auth interceptor then checks whichever it was like any other token.
+// Accept-Language always goes along too, for the error messages, and
+// X-Schedule-Version for ListAppointments. The headers in b.forwardHeaders go along as they are, or under x-forwarded-
+// for those grpc would drop.
+func (b *Bridge) requestMD(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	if vals := r.Header.Values("Authorization"); len(vals) > 0 {
+		md.Set("authorization", vals...)
+	} else if c, err := r.Cookie(AccessCookie); err == nil && c.Value != "" {
+		md.Set("authorization", "Bearer "+c.Value)
+	}
+	if vals := r.Header.Values("Accept-Language"); len(vals) > 0 {
+		md.Set("accept-language", vals...)
+	}
+	if vals := r.Header.Values("X-Schedule-Version"); len(vals) > 0 {
+		md.Set(handler.ScheduleVersionKey, vals...)
+	}
+	for _, n := range b.forwardHeaders {
+		vals := r.Header.Values(n)
+		if len(vals) == 0 {
+			continue
 		}
-		if strings.HasSuffix(r.URL.Path, "/DeleteAppointment") {
-			b.manualDeleteAppointment(ctx, w, payload, r.Header.Get("Authorization"))
-			return
+		if reservedHeader(n) {
+			n = "x-forwarded-" + n
 		}
+		md.Append(n, vals...)
 	}
+	return md
+}
 
-	// invoke gRPC method using raw codec (pass-through bytes)
-	resp := &rawMsg{}
-	err = b.conn.Invoke(ctx, r.URL.Path, &rawMsg{data: payload}, resp, grpc.ForceCodec(rawCodec{}))
-	if err != nil {
-		st, _ := status.FromError(err)
-		log.Printf("grpc-web error: %s: %s", st.Code(), st.Message())
-		writeError(w, st.Code(), st.Message())
-		return
+// reservedHeader reports whether grpc sets n itself, so a client's
+// metadata under that name never reaches the server.
+func reservedHeader(n string) bool {
+	switch n {
+	case "user-agent", "content-type", "te", "host", "connection":
+		return true
 	}
+	return strings.HasPrefix(n, "grpc-") || strings.HasPrefix(n, ":")
+}
 
-	writeSuccess(w, resp.data)
+// chain folds ics into one interceptor, outermost first, as
+// grpc.ChainUnaryInterceptor does for the server.
+func chain(ics []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		for i := len(ics) - 1; i >= 0; i-- {
+			ic, inner := ics[i], next
+			next = func(ctx context.Context, req any) (any, error) { return ic(ctx, req, info, inner) }
+		}
+		return next(ctx, req)
+	}
 }
 
 // rawMsg wraps raw protobuf bytes.
@@ -166,10 +512,13 @@ func (rawCodec) Unmarshal(data []byte, v any) error {
 }
 func (rawCodec) Name() string { return "raw" }
 
-func writeError(w http.ResponseWriter, code codes.Code, msg string) {
+func writeError(w http.ResponseWriter, r apperr.Reason, msg string) {
+	writeStatus(w, apperr.New(r, msg))
+}
+
+func writeTrailer(w http.ResponseWriter, trailer string) {
 	w.Header().Set("Content-Type", "application/grpc-web+proto")
 	w.WriteHeader(http.StatusOK)
-	trailer := fmt.Sprintf("grpc-status:%d\r\ngrpc-message:%s\r\n", code, msg)
 	tf := make([]byte, 5+len(trailer))
 	tf[0] = 0x80
 	binary.BigEndian.PutUint32(tf[1:5], uint32(len(trailer)))
@@ -195,436 +544,54 @@ func writeSuccess(w http.ResponseWriter, data []byte) {
 	w.Write(tf)
 }
 
-// no-op context key to suppress lint
-var _ context.Context
-
-func (b *Bridge) manualAuth(ctx context.Context, authHeader string) (context.Context, error) {
-	if authHeader == "" {
-		return nil, status.Error(codes.Unauthenticated, "no token")
-	}
-	raw := strings.TrimPrefix(authHeader, "Bearer ")
-	claims, err := auth.ParseToken(raw, b.secret)
-	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "bad token")
-	}
-	return context.WithValue(ctx, middleware.UserIDKey, claims.UserID), nil
-}
-
-func (b *Bridge) manualLogin(ctx context.Context, w http.ResponseWriter, payload []byte) {
-	req := &pb.LoginRequest{}
-	// manual decode
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Email = string(v)
-			payload = payload[n:]
-		} else if num == 2 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Password = string(v)
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			if n < 0 {
-				writeError(w, codes.InvalidArgument, "parse error")
-				return
-			}
-			payload = payload[n:]
-		}
-	}
-
-	resp, err := b.direct.Login(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	// manual encode response
-	var out []byte
-	out = protowire.AppendTag(out, 1, protowire.BytesType)
-	out = protowire.AppendString(out, resp.Token)
-	out = protowire.AppendTag(out, 2, protowire.BytesType)
-	out = protowire.AppendString(out, resp.UserId)
-	out = protowire.AppendTag(out, 3, protowire.BytesType)
-	out = protowire.AppendString(out, resp.Name)
-
-	writeSuccess(w, out)
-}
-
-func (b *Bridge) manualRegister(ctx context.Context, w http.ResponseWriter, payload []byte) {
-	req := &pb.RegisterRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Email = string(v)
-			payload = payload[n:]
-		} else if num == 2 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Password = string(v)
-			payload = payload[n:]
-		} else if num == 3 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Name = string(v)
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			if n < 0 {
-				writeError(w, codes.InvalidArgument, "parse error")
-				return
-			}
-			payload = payload[n:]
-		}
-	}
-
-	resp, err := b.direct.Register(ctx, req)
+// writeMessage sends m as the data frame of a successful response.
+func writeMessage(w http.ResponseWriter, m proto.Message) {
+	out, err := proto.Marshal(m)
 	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
+		writeError(w, apperr.Internal, "encode response failed")
 		return
 	}
-
-	var out []byte
-	out = protowire.AppendTag(out, 1, protowire.BytesType)
-	out = protowire.AppendString(out, resp.UserId)
-	out = protowire.AppendTag(out, 2, protowire.BytesType)
-	out = protowire.AppendString(out, resp.Token)
-
 	writeSuccess(w, out)
 }
 
-func (b *Bridge) manualListAppointments(ctx context.Context, w http.ResponseWriter, payload []byte, authHeader string) {
-	ctx, err := b.manualAuth(ctx, authHeader)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	req := &pb.ListAppointmentsRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
+// writeStatus sends err as the trailer. Details (the ErrorInfo, reschedule
+// suggestions) go in grpc-status-details-bin like native gRPC, and the
+// reason is repeated as JSON in x-error-info for clients that can't decode
+// the protobuf status.
+func writeStatus(w http.ResponseWriter, err error) {
+	st, _ := status.FromError(err)
+	trailer := fmt.Sprintf("grpc-status:%d\r\ngrpc-message:%s\r\n", st.Code(), encodeMessage(st.Message()))
+	if len(st.Proto().GetDetails()) > 0 {
+		if bin, err := proto.Marshal(st.Proto()); err == nil {
+			trailer += "grpc-status-details-bin:" + base64.RawStdEncoding.EncodeToString(bin) + "\r\n"
 		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.RangeStart = parseTimestamp(v)
-			payload = payload[n:]
-		} else if num == 2 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.RangeEnd = parseTimestamp(v)
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			if n < 0 {
-				writeError(w, codes.InvalidArgument, "parse error")
-				return
-			}
-			payload = payload[n:]
-		}
-	}
-
-	resp, err := b.direct.ListAppointments(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
 	}
-
-	var out []byte
-	for _, appt := range resp.Appointments {
-		out = appendAppointment(out, 1, appt)
-	}
-	writeSuccess(w, out)
-}
-
-func parseTimestamp(b []byte) *timestamppb.Timestamp {
-	ts := &timestamppb.Timestamp{}
-	for len(b) > 0 {
-		num, typ, n := protowire.ConsumeTag(b)
-		if n < 0 {
-			return ts
+	if info := apperr.InfoOf(err); info != nil {
+		if js, err := json.Marshal(errorInfo{Reason: info.Reason, Domain: info.Domain}); err == nil {
+			trailer += "x-error-info:" + string(js) + "\r\n"
 		}
-		b = b[n:]
-		if num == 1 && typ == protowire.VarintType {
-			v, n := protowire.ConsumeVarint(b)
-			ts.Seconds = int64(v)
-			b = b[n:]
-		} else if num == 2 && typ == protowire.VarintType {
-			v, n := protowire.ConsumeVarint(b)
-			ts.Nanos = int32(v)
-			b = b[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, b)
-			if n < 0 {
-				return ts
-			}
-			b = b[n:]
-		}
-	}
-	return ts
-}
-
-func appendTimestamp(out []byte, num protowire.Number, ts *timestamppb.Timestamp) []byte {
-	if ts == nil {
-		return out
 	}
-	var inner []byte
-	if ts.Seconds != 0 {
-		inner = protowire.AppendTag(inner, 1, protowire.VarintType)
-		inner = protowire.AppendVarint(inner, uint64(ts.Seconds))
-	}
-	if ts.Nanos != 0 {
-		inner = protowire.AppendTag(inner, 2, protowire.VarintType)
-		inner = protowire.AppendVarint(inner, uint64(ts.Nanos))
-	}
-	out = protowire.AppendTag(out, num, protowire.BytesType)
-	out = protowire.AppendBytes(out, inner)
-	return out
-}
-
-func appendAppointment(out []byte, num protowire.Number, a *pb.Appointment) []byte {
-	if a == nil {
-		return out
-	}
-	var inner []byte
-	inner = protowire.AppendTag(inner, 1, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.Id)
-	inner = protowire.AppendTag(inner, 2, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.Title)
-	inner = protowire.AppendTag(inner, 3, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.Description)
-	inner = appendTimestamp(inner, 4, a.StartTime)
-	inner = appendTimestamp(inner, 5, a.EndTime)
-	inner = protowire.AppendTag(inner, 6, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.UserId)
-	inner = protowire.AppendTag(inner, 7, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.Status)
-	inner = protowire.AppendTag(inner, 8, protowire.BytesType)
-	inner = protowire.AppendString(inner, a.Location)
-	for _, att := range a.AttendeeIds {
-		inner = protowire.AppendTag(inner, 9, protowire.BytesType)
-		inner = protowire.AppendString(inner, att)
-	}
-	inner = appendTimestamp(inner, 10, a.CreatedAt)
-	inner = appendTimestamp(inner, 11, a.UpdatedAt)
-
-	out = protowire.AppendTag(out, num, protowire.BytesType)
-	out = protowire.AppendBytes(out, inner)
-	return out
+	writeTrailer(w, trailer)
 }
 
-func (b *Bridge) manualCreateAppointment(ctx context.Context, w http.ResponseWriter, payload []byte, authHeader string) {
-	ctx, err := b.manualAuth(ctx, authHeader)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	req := &pb.CreateAppointmentRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Title = string(v)
-			payload = payload[n:]
-		} else if num == 2 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Description = string(v)
-			payload = payload[n:]
-		} else if num == 3 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.StartTime = parseTimestamp(v)
-			payload = payload[n:]
-		} else if num == 4 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.EndTime = parseTimestamp(v)
-			payload = payload[n:]
-		} else if num == 5 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Location = string(v)
-			payload = payload[n:]
-		} else if num == 6 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			// According to proto spec, repeated fields can be packed or not.
-			// protowire handles simple repeated bytes as sequential fields.
-			req.AttendeeIds = append(req.AttendeeIds, string(v))
-			payload = payload[n:]
+// encodeMessage percent-encodes grpc-message as the gRPC spec says: every
+// byte outside printable ASCII, and '%' itself, becomes %XX (so UTF-8 goes
+// byte by byte). Sent raw, a "\r\n" in a message would end the trailer
+// line and whatever followed would pass for another trailer.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
 		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			if n < 0 {
-				writeError(w, codes.InvalidArgument, "parse error")
-				return
-			}
-			payload = payload[n:]
-		}
-	}
-
-	resp, err := b.direct.CreateAppointment(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	var out []byte
-	out = appendAppointment(out, 1, resp.Appointment)
-	writeSuccess(w, out)
-}
-
-func (b *Bridge) manualGetAppointment(ctx context.Context, w http.ResponseWriter, payload []byte, authHeader string) {
-	ctx, err := b.manualAuth(ctx, authHeader)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	req := &pb.GetAppointmentRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Id = string(v)
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			payload = payload[n:]
-		}
-	}
-
-	resp, err := b.direct.GetAppointment(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	var out []byte
-	out = appendAppointment(out, 1, resp.Appointment)
-	writeSuccess(w, out)
-}
-
-func (b *Bridge) manualUpdateAppointment(ctx context.Context, w http.ResponseWriter, payload []byte, authHeader string) {
-	ctx, err := b.manualAuth(ctx, authHeader)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	req := &pb.UpdateAppointmentRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Id = string(v)
-			payload = payload[n:]
-		} else if num == 2 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Title = string(v)
-			payload = payload[n:]
-		} else if num == 3 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Description = string(v)
-			payload = payload[n:]
-		} else if num == 4 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.StartTime = parseTimestamp(v)
-			payload = payload[n:]
-		} else if num == 5 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.EndTime = parseTimestamp(v)
-			payload = payload[n:]
-		} else if num == 6 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Location = string(v)
-			payload = payload[n:]
-		} else if num == 7 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.AttendeeIds = append(req.AttendeeIds, string(v))
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			payload = payload[n:]
+			b.WriteByte(c)
 		}
 	}
-
-	resp, err := b.direct.UpdateAppointment(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	var out []byte
-	out = appendAppointment(out, 1, resp.Appointment)
-	writeSuccess(w, out)
+	return b.String()
 }
 
-func (b *Bridge) manualDeleteAppointment(ctx context.Context, w http.ResponseWriter, payload []byte, authHeader string) {
-	ctx, err := b.manualAuth(ctx, authHeader)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	req := &pb.DeleteAppointmentRequest{}
-	for len(payload) > 0 {
-		num, typ, n := protowire.ConsumeTag(payload)
-		if n < 0 {
-			writeError(w, codes.InvalidArgument, "parse error")
-			return
-		}
-		payload = payload[n:]
-		if num == 1 && typ == protowire.BytesType {
-			v, n := protowire.ConsumeBytes(payload)
-			req.Id = string(v)
-			payload = payload[n:]
-		} else {
-			n := protowire.ConsumeFieldValue(num, typ, payload)
-			payload = payload[n:]
-		}
-	}
-
-	_, err = b.direct.DeleteAppointment(ctx, req)
-	if err != nil {
-		st, _ := status.FromError(err)
-		writeError(w, st.Code(), st.Message())
-		return
-	}
-
-	writeSuccess(w, nil)
+// errorInfo is the x-error-info trailer.
+type errorInfo struct {
+	Reason string `json:"reason"`
+	Domain string `json:"domain"`
 }
-
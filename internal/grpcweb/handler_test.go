@@ -0,0 +1,443 @@
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store"
+)
+
+func TestWriteStatusReason(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeStatus(rec, apperr.New(apperr.ApptConflict, "time conflicts with existing appointment"))
+
+	body := rec.Body.Bytes()
+	if len(body) < 5 || body[0] != flagTrailer {
+		t.Fatalf("not a trailer frame: %q", body)
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(body[5:])), "\r\n") {
+		k, v, _ := strings.Cut(line, ":")
+		fields[k] = v
+	}
+	if fields["grpc-status"] != "6" {
+		t.Errorf("grpc-status %q", fields["grpc-status"])
+	}
+
+	var info errorInfo
+	if err := json.Unmarshal([]byte(fields["x-error-info"]), &info); err != nil {
+		t.Fatalf("x-error-info %q: %v", fields["x-error-info"], err)
+	}
+	if info.Reason != "APPT_CONFLICT" || info.Domain != apperr.Domain {
+		t.Errorf("x-error-info %+v", info)
+	}
+
+	// and the same ErrorInfo in the binary details, as native gRPC sends it
+	bin, err := base64.RawStdEncoding.DecodeString(fields["grpc-status-details-bin"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st spb.Status
+	if err := proto.Unmarshal(bin, &st); err != nil || len(st.Details) != 1 {
+		t.Fatalf("details: %v %v", &st, err)
+	}
+	var ei errdetails.ErrorInfo
+	if err := st.Details[0].UnmarshalTo(&ei); err != nil || ei.Reason != "APPT_CONFLICT" {
+		t.Errorf("details-bin error info %v %v", &ei, err)
+	}
+}
+
+// trailerFields reads the trailer frame of a grpc-web response; a repeated
+// name is a test failure, since that's what a smuggled line looks like.
+func trailerFields(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	for len(body) >= 5 && body[0] != flagTrailer {
+		body = body[5+binary.BigEndian.Uint32(body[1:5]):]
+	}
+	if len(body) < 5 {
+		t.Fatalf("no trailer frame")
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(body[5:]), "\r\n"), "\r\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if _, dup := fields[k]; dup || !ok {
+			t.Errorf("trailer line %q", line)
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+func TestWriteStatusMessageEncoding(t *testing.T) {
+	for _, msg := range []string{
+		`title: must not contain "quotes"`,
+		"first line\r\ngrpc-status:0",
+		"naïve café ✓ at 100%",
+		"tab\there, and a trailing %",
+	} {
+		rec := httptest.NewRecorder()
+		writeStatus(rec, apperr.New(apperr.InvalidArgument, msg))
+		fields := trailerFields(t, rec.Body.Bytes())
+		if fields["grpc-status"] != "3" {
+			t.Errorf("%q: grpc-status %q", msg, fields["grpc-status"])
+		}
+		for _, c := range fields["grpc-message"] {
+			if c < 0x20 || c > 0x7e {
+				t.Errorf("%q: raw %q on the wire", msg, c)
+			}
+		}
+		if got, err := url.PathUnescape(fields["grpc-message"]); err != nil || got != msg {
+			t.Errorf("round trip: %q -> %q -> %q (%v)", msg, fields["grpc-message"], got, err)
+		}
+		// the details carry it unencoded
+		bin, _ := base64.RawStdEncoding.DecodeString(fields["grpc-status-details-bin"])
+		var st spb.Status
+		if err := proto.Unmarshal(bin, &st); err != nil || st.Message != msg {
+			t.Errorf("details-bin: %q %v", st.Message, err)
+		}
+	}
+	if got := encodeMessage("plain ascii: ok"); got != "plain ascii: ok" {
+		t.Errorf("printable ascii changed: %q", got)
+	}
+}
+
+// A validation error naming a bad value survives the bridge: same message
+// and the same BadRequest violations as a direct call.
+func TestBridgeValidationMessage(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("s"))
+	b, err := New("", h, auth.SingleKey("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := "2b1e3c1a-5f6d-4f1e-9a7b-3c2d1e0f9a8b"
+	tok, _ := auth.MakeToken(userID, auth.RoleUser, "s")
+	start := time.Now().Add(time.Hour)
+	req := &pb.CreateAppointmentRequest{
+		Title: "x", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		Tags: []string{"“quoted” ünïcödé tag,\nwith a newline"},
+	}
+	ctx := context.WithValue(context.Background(), middleware.UserIDKey, userID)
+	_, direct := h.CreateAppointment(ctx, req)
+	want, _ := status.FromError(direct)
+	if want.Code() != codes.InvalidArgument {
+		t.Fatalf("direct: %v", direct)
+	}
+
+	msg, _ := proto.Marshal(req)
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	hreq := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/CreateAppointment", bytes.NewReader(body))
+	hreq.Header.Set("Content-Type", "application/grpc-web+proto")
+	hreq.Header.Set("Authorization", "Bearer "+tok)
+	rec := httptest.NewRecorder()
+	b.Handler().ServeHTTP(rec, hreq)
+	fields := trailerFields(t, rec.Body.Bytes())
+	if got, _ := url.PathUnescape(fields["grpc-message"]); got != want.Message() {
+		t.Errorf("message %q, want %q", got, want.Message())
+	}
+	bin, _ := base64.RawStdEncoding.DecodeString(fields["grpc-status-details-bin"])
+	var st spb.Status
+	if err := proto.Unmarshal(bin, &st); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&st, want.Proto()) {
+		t.Errorf("details %v, want %v", &st, want.Proto())
+	}
+}
+
+// The same bad request gets its message in the caller's language; the
+// status code and the reason don't change with it.
+func TestBridgeLocalizedErrors(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("s"))
+	b, err := New("", h, auth.SingleKey("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := auth.MakeToken("2b1e3c1a-5f6d-4f1e-9a7b-3c2d1e0f9a8b", auth.RoleUser, "s")
+	start := time.Now().Add(time.Hour)
+	msg, _ := proto.Marshal(&pb.CreateAppointmentRequest{
+		StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(-time.Hour)),
+	})
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	call := func(body []byte, acceptLanguage string) map[string]string {
+		hreq := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/CreateAppointment", bytes.NewReader(body))
+		hreq.Header.Set("Content-Type", "application/grpc-web+proto")
+		hreq.Header.Set("Authorization", "Bearer "+tok)
+		if acceptLanguage != "" {
+			hreq.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, hreq)
+		return trailerFields(t, rec.Body.Bytes())
+	}
+
+	en := call(body, "")
+	for _, tt := range []struct{ acceptLanguage, want string }{
+		{"en-GB", "title: required; end_time: must be after start_time"},
+		{"fr-FR, en;q=0.5", "title: obligatoire; end_time: doit être postérieur à start_time"},
+		{"de", "title: required; end_time: must be after start_time"},
+	} {
+		got := call(body, tt.acceptLanguage)
+		if msg, _ := url.PathUnescape(got["grpc-message"]); msg != tt.want {
+			t.Errorf("%s: message %q", tt.acceptLanguage, msg)
+		}
+		if got["grpc-status"] != en["grpc-status"] || got["x-error-info"] != en["x-error-info"] {
+			t.Errorf("%s: status %s %s, want %s %s", tt.acceptLanguage,
+				got["grpc-status"], got["x-error-info"], en["grpc-status"], en["x-error-info"])
+		}
+	}
+
+	// the bridge's own errors too
+	got := call(body[:3], "fr")
+	if msg, _ := url.PathUnescape(got["grpc-message"]); msg != "trame grpc-web invalide" || got["grpc-status"] != "3" {
+		t.Errorf("bad frame: %s %q", got["grpc-status"], msg)
+	}
+	if !strings.Contains(got["x-error-info"], `"BAD_FRAME"`) {
+		t.Errorf("bad frame info %s", got["x-error-info"])
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"1S":        time.Second,
+		"1500m":     1500 * time.Millisecond,
+		"2H":        2 * time.Hour,
+		"99999999n": 99999999,
+	} {
+		if got, ok := parseTimeout(v); !ok || got != want {
+			t.Errorf("%q: %s %v", v, got, ok)
+		}
+	}
+	for _, v := range []string{"", "S", "10", "10s", "123456789S", "-1S", "1.5S"} {
+		if _, ok := parseTimeout(v); ok {
+			t.Errorf("%q accepted", v)
+		}
+	}
+}
+
+// the client's grpc-timeout bounds an in-process call, and running out
+// of it is reported as DeadlineExceeded whatever the handler returned
+func TestBridgeDeadline(t *testing.T) {
+	slow := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		<-ctx.Done()
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	b, err := New("", handler.New(store.New(nil), auth.SingleKey("s")), auth.SingleKey("s"), WithInterceptors(slow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(timeout string) string {
+		req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/GetServerInfo", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("Grpc-Timeout", timeout)
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	start := time.Now()
+	if body := call("50m"); !strings.Contains(body, "grpc-status:4\r\n") || !strings.Contains(body, `"reason":"DEADLINE_EXCEEDED"`) {
+		t.Errorf("timed out call: %q", body)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("took %s", time.Since(start))
+	}
+	if body := call("soon"); !strings.Contains(body, "grpc-status:3\r\n") {
+		t.Errorf("bad grpc-timeout: %q", body)
+	}
+}
+
+// a body over the limit is refused as it arrives, not read to its end
+func TestBridgeBodyLimit(t *testing.T) {
+	b, err := New("", handler.New(store.New(nil), auth.SingleKey("s")), auth.SingleKey("s"), WithMaxMessageBytes(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(b.Handler())
+	defer srv.Close()
+
+	// a frame that claims 10 bytes, then no end of junk
+	body := io.MultiReader(bytes.NewReader([]byte{0, 0, 0, 0, 10}), endless{})
+	start := time.Now()
+	resp, err := http.Post(srv.URL+"/appointment.v1.ScheduleService/GetServerInfo", "application/grpc-web+proto", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	fields := trailerFields(t, got)
+	if fields["grpc-status"] != "8" || !strings.Contains(fields["x-error-info"], `"reason":"MESSAGE_TOO_LARGE"`) {
+		t.Errorf("trailer %v", fields)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("took %s", time.Since(start))
+	}
+}
+
+// endless reads as zeros forever
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// a client that stops sending its body part way is cut off at the
+// request timeout instead of holding the call open
+func TestBridgeSlowBody(t *testing.T) {
+	b, err := New("", handler.New(store.New(nil), auth.SingleKey("s")), auth.SingleKey("s"), WithRequestTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(b.Handler())
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte{0, 0, 0, 0, 10, 1, 2}) // 3 of the 10 bytes, then nothing
+	start := time.Now()
+	resp, err := http.Post(srv.URL+"/appointment.v1.ScheduleService/GetServerInfo", "application/grpc-web+proto", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	fields := trailerFields(t, got)
+	if fields["grpc-status"] != "4" || !strings.Contains(fields["x-error-info"], `"reason":"DEADLINE_EXCEEDED"`) {
+		t.Errorf("trailer %v", fields)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("cut off after %s", took)
+	}
+}
+
+func TestBridgeCSRF(t *testing.T) {
+	b, err := New("", handler.New(store.New(nil), auth.SingleKey("s")), auth.SingleKey("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	tok, err := SetCSRFCookie(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := rec.Result().Cookies()
+	if len(issued) != 1 || issued[0].Name != CSRFCookie || issued[0].HttpOnly || len(tok) != 64 {
+		t.Fatalf("issued %v", issued)
+	}
+	if again, _ := SetCSRFCookie(httptest.NewRecorder()); again == tok {
+		t.Error("token didn't rotate")
+	}
+
+	call := func(set func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/DeleteAppointment", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		set(req)
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	session := func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: AccessCookie, Value: "jwt"})
+		r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tok})
+	}
+	for name, set := range map[string]func(*http.Request){
+		"cookie, no header": session,
+		"mismatch": func(r *http.Request) {
+			session(r)
+			r.Header.Set(CSRFHeader, tok[:63]+"x")
+		},
+		"header, no cookie": func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: AccessCookie, Value: "jwt"})
+			r.Header.Set(CSRFHeader, tok)
+		},
+	} {
+		if rec := call(set); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "X-CSRF-Token") {
+			t.Errorf("%s: %d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+	// these get past the check to the call itself
+	for name, set := range map[string]func(*http.Request){
+		"matching": func(r *http.Request) {
+			session(r)
+			r.Header.Set(CSRFHeader, tok)
+		},
+		"bearer token": func(r *http.Request) {
+			session(r)
+			r.Header.Set("Authorization", "Bearer x")
+		},
+		"no session": func(r *http.Request) {},
+	} {
+		if rec := call(set); rec.Code != http.StatusOK {
+			t.Errorf("%s: %d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestBridgeCookieAuth(t *testing.T) {
+	b, err := New("", handler.New(store.New(nil), auth.SingleKey("s")), auth.SingleKey("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, _ := auth.MakeToken("2b1e3c1a-5f6d-4f1e-9a7b-3c2d1e0f9a8b", auth.RoleUser, "s")
+	forged, _ := auth.MakeToken("2b1e3c1a-5f6d-4f1e-9a7b-3c2d1e0f9a8b", auth.RoleUser, "other")
+	// a negative page size fails validation, which runs only once the
+	// caller is known: status 3 means authenticated, 16 means not
+	msg, _ := proto.Marshal(&pb.ListAppointmentsRequest{PageSize: -1})
+	call := func(header, cookie string) string {
+		body := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+		req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/ListAppointments", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: AccessCookie, Value: cookie})
+			req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "c"})
+			req.Header.Set(CSRFHeader, "c")
+		}
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, req)
+		_, st, _ := strings.Cut(rec.Body.String(), "grpc-status:")
+		st, _, _ = strings.Cut(st, "\r\n")
+		return st
+	}
+	for _, tc := range []struct {
+		name, header, cookie, want string
+	}{
+		{"cookie only", "", good, "3"},
+		{"forged cookie", "", forged, "16"},
+		{"neither", "", "", "16"},
+		{"header wins over a bad cookie", good, forged, "3"},
+		{"header wins over a good cookie", forged, good, "16"},
+	} {
+		if got := call(tc.header, tc.cookie); got != tc.want {
+			t.Errorf("%s: grpc-status %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
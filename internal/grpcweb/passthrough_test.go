@@ -0,0 +1,320 @@
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/clock"
+	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store/memstore"
+)
+
+// upstream runs a real grpc server for h on a random port, with the auth
+// interceptor behind one that records each call's metadata, and returns a
+// bridge forwarding to it over tcp.
+func upstream(t *testing.T, h *handler.Handler, keys auth.Keys, opts ...Option) (*Bridge, func() metadata.MD) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		last metadata.MD
+	)
+	record := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		last = md
+		mu.Unlock()
+		return next(ctx, req)
+	}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(record, middleware.Auth(keys, auth.Config{})))
+	pb.RegisterAuthServiceServer(srv, h)
+	pb.RegisterScheduleServiceServer(srv, h)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	b, err := New(lis.Addr().String(), nil, keys, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Close)
+	return b, func() metadata.MD {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+// webCall sends req to method through b as grpc-web and decodes the reply
+// into resp, returning the grpc-status of the trailer.
+func webCall(t *testing.T, b *Bridge, method string, req, resp proto.Message, set func(*http.Request)) string {
+	t.Helper()
+	msg, _ := proto.Marshal(req)
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	hreq := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/"+method, bytes.NewReader(body))
+	hreq.Header.Set("Content-Type", "application/grpc-web+proto")
+	set(hreq)
+	rec := httptest.NewRecorder()
+	b.Handler().ServeHTTP(rec, hreq)
+
+	out := rec.Body.Bytes()
+	if len(out) >= 5 && out[0] == 0 {
+		n := binary.BigEndian.Uint32(out[1:5])
+		if err := proto.Unmarshal(out[5:5+n], resp); err != nil {
+			t.Fatalf("%s: decode reply: %v", method, err)
+		}
+	}
+	return trailerFields(t, out)["grpc-status"]
+}
+
+// the five appointment methods work through a bridge running apart from
+// the server, authenticated by header or by session cookie
+func TestBridgePassthrough(t *testing.T) {
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	rr, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "pass@test.com", Password: "testpass123", Name: "Pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := auth.MakeToken(rr.UserId, auth.RoleUser, "s")
+	b, lastMD := upstream(t, h, keys)
+
+	for name, set := range map[string]func(*http.Request){
+		"header": func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+tok) },
+		"cookie": func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: AccessCookie, Value: tok})
+			r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: "c"})
+			r.Header.Set(CSRFHeader, "c")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+			var created pb.CreateAppointmentResponse
+			if st := webCall(t, b, "CreateAppointment", &pb.CreateAppointmentRequest{
+				Title: "via " + name, StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+			}, &created, set); st != "0" {
+				t.Fatalf("create: grpc-status %s", st)
+			}
+			id := created.GetAppointment().GetId()
+			if got := lastMD().Get("authorization"); len(got) != 1 || got[0] != "Bearer "+tok {
+				t.Errorf("server saw authorization %q", got)
+			}
+
+			var got pb.GetAppointmentResponse
+			if st := webCall(t, b, "GetAppointment", &pb.GetAppointmentRequest{Id: id}, &got, set); st != "0" || got.Appointment.GetTitle() != "via "+name {
+				t.Errorf("get: grpc-status %s, %v", st, got.Appointment)
+			}
+
+			var updated pb.UpdateAppointmentResponse
+			if st := webCall(t, b, "UpdateAppointment", &pb.UpdateAppointmentRequest{
+				Id: id, Title: "renamed", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+			}, &updated, set); st != "0" || updated.Appointment.GetTitle() != "renamed" {
+				t.Errorf("update: grpc-status %s, %v", st, updated.Appointment)
+			}
+
+			var listed pb.ListAppointmentsResponse
+			if st := webCall(t, b, "ListAppointments", &pb.ListAppointmentsRequest{}, &listed, set); st != "0" {
+				t.Errorf("list: grpc-status %s", st)
+			}
+			found := false
+			for _, a := range listed.Appointments {
+				found = found || a.Id == id
+			}
+			if !found {
+				t.Errorf("list is missing %s", id)
+			}
+
+			if st := webCall(t, b, "DeleteAppointment", &pb.DeleteAppointmentRequest{Id: id}, &pb.DeleteAppointmentResponse{}, set); st != "0" {
+				t.Errorf("delete: grpc-status %s", st)
+			}
+			got.Reset()
+			if st := webCall(t, b, "GetAppointment", &pb.GetAppointmentRequest{Id: id}, &got, set); st != "0" || got.Appointment.GetStatus() != "cancelled" {
+				t.Errorf("after delete: grpc-status %s, %v", st, got.Appointment)
+			}
+		})
+	}
+
+	if st := webCall(t, b, "ListAppointments", &pb.ListAppointmentsRequest{}, &pb.ListAppointmentsResponse{}, func(*http.Request) {}); st != "16" {
+		t.Errorf("no credentials: grpc-status %s, want 16", st)
+	}
+}
+
+// a write's schedule version comes back as X-Schedule-Version, in-process
+// and upstream alike, and goes along to the server when a list sends it
+func TestBridgeScheduleVersion(t *testing.T) {
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	rr, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "version@test.com", Password: "testpass123", Name: "Version"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := auth.MakeToken(rr.UserId, auth.RoleUser, "s")
+	direct, err := New("", h, keys, WithAllowedOrigins("https://app.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, lastMD := upstream(t, h, keys, WithAllowedOrigins("https://app.example"))
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	for i, b := range []*Bridge{direct, remote} {
+		msg, _ := proto.Marshal(&pb.CreateAppointmentRequest{
+			Title: "v", StartTime: timestamppb.New(start.Add(time.Duration(i) * 2 * time.Hour)), EndTime: timestamppb.New(start.Add(time.Duration(i)*2*time.Hour + time.Hour)),
+		})
+		body := append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+		req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/CreateAppointment", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("Origin", "https://app.example")
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		b.Handler().ServeHTTP(rec, req)
+		if got, want := rec.Header().Get("X-Schedule-Version"), strconv.Itoa(i+1); got != want {
+			t.Errorf("bridge %d: X-Schedule-Version %q, want %q", i, got, want)
+		}
+		if !strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "X-Schedule-Version") {
+			t.Errorf("bridge %d: X-Schedule-Version not exposed", i)
+		}
+	}
+
+	if st := webCall(t, remote, "ListAppointments", &pb.ListAppointmentsRequest{}, &pb.ListAppointmentsResponse{}, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+tok)
+		r.Header.Set("X-Schedule-Version", "2")
+	}); st != "0" {
+		t.Fatalf("list: grpc-status %s", st)
+	}
+	if got := lastMD().Get(handler.ScheduleVersionKey); len(got) != 1 || got[0] != "2" {
+		t.Errorf("server saw %s %q", handler.ScheduleVersionKey, got)
+	}
+}
+
+func TestBridgeForwardHeaders(t *testing.T) {
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	headers := func(r *http.Request) {
+		r.Header.Set("X-Request-Id", "req-1")
+		r.Header.Set("User-Agent", "browser/1.0")
+		r.Header.Set("X-Tenant", "acme")
+		r.Header.Set("Cookie", "other=1")
+	}
+
+	b, lastMD := upstream(t, h, keys)
+	webCall(t, b, "GetServerInfo", &pb.GetServerInfoRequest{}, &pb.ServerInfo{}, headers)
+	md := lastMD()
+	if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "req-1" {
+		t.Errorf("x-request-id %q", got)
+	}
+	if got := md.Get("x-forwarded-user-agent"); len(got) != 1 || got[0] != "browser/1.0" {
+		t.Errorf("x-forwarded-user-agent %q", got)
+	}
+	for _, k := range []string{"x-tenant", "cookie", "authorization"} {
+		if got := md.Get(k); len(got) != 0 {
+			t.Errorf("%s forwarded: %q", k, got)
+		}
+	}
+
+	b, lastMD = upstream(t, h, keys, WithForwardHeaders("X-Tenant"))
+	webCall(t, b, "GetServerInfo", &pb.GetServerInfoRequest{}, &pb.ServerInfo{}, headers)
+	md = lastMD()
+	if got := md.Get("x-tenant"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("x-tenant %q", got)
+	}
+	if got := md.Get("x-request-id"); len(got) != 0 {
+		t.Errorf("x-request-id forwarded after the list replaced it: %q", got)
+	}
+
+	// in-process calls see the same metadata
+	var seen metadata.MD
+	spy := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		seen, _ = metadata.FromIncomingContext(ctx)
+		return next(ctx, req)
+	}
+	direct, err := New("", h, keys, WithInterceptors(spy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	webCall(t, direct, "GetServerInfo", &pb.GetServerInfoRequest{}, &pb.ServerInfo{}, headers)
+	if got := seen.Get("x-forwarded-user-agent"); len(got) != 1 || got[0] != "browser/1.0" {
+		t.Errorf("in-process x-forwarded-user-agent %q", got)
+	}
+
+	// and browsers may send the listed headers cross-origin
+	cors, err := New("", h, keys, WithAllowedOrigins("https://app.example.com"), WithForwardHeaders("x-request-id", "x-tenant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodOptions, "/appointment.v1.ScheduleService/GetServerInfo", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	cors.Handler().ServeHTTP(rec, req)
+	allow := rec.Header().Get("Access-Control-Allow-Headers")
+	for _, want := range []string{"X-Request-Id", "X-Tenant", "Authorization"} {
+		if !strings.Contains(allow, want) {
+			t.Errorf("Access-Control-Allow-Headers %q is missing %s", allow, want)
+		}
+	}
+}
+
+// an expired token and a garbage one fail differently, so the browser
+// knows when to refresh instead of logging out, whichever way the bridge
+// reaches the handlers
+func TestBridgeExpiredToken(t *testing.T) {
+	keys := auth.SingleKey("s")
+	h := handler.New(memstore.New(), keys)
+	// minted two hours ago, so an hour past its exp now
+	stale, _, err := auth.Config{Clock: clock.NewFake(time.Now().Add(-2 * time.Hour)), AccessTTL: time.Hour}.MakeToken("u1", auth.RoleUser, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := New("", h, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarding, _ := upstream(t, h, keys)
+
+	for name, b := range map[string]*Bridge{"in-process": direct, "upstream": forwarding} {
+		for _, tt := range []struct {
+			token, msg string
+			reason     apperr.Reason
+		}{
+			{stale, "token expired", apperr.AuthTokenExpired},
+			{"not-a-jwt", "invalid token", apperr.AuthTokenInvalid},
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/appointment.v1.ScheduleService/ListAppointments", bytes.NewReader(make([]byte, 5)))
+			req.Header.Set("Content-Type", "application/grpc-web+proto")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			b.Handler().ServeHTTP(rec, req)
+
+			fields := trailerFields(t, rec.Body.Bytes())
+			var info errorInfo
+			json.Unmarshal([]byte(fields["x-error-info"]), &info)
+			msg, _ := url.PathUnescape(fields["grpc-message"])
+			if fields["grpc-status"] != "16" || msg != tt.msg || info.Reason != string(tt.reason) {
+				t.Errorf("%s, %s: grpc-status %s, message %q, reason %q", name, tt.msg, fields["grpc-status"], msg, info.Reason)
+			}
+		}
+	}
+}
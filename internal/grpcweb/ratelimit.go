@@ -0,0 +1,55 @@
+package grpcweb
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"schedule-management-api/internal/middleware"
+)
+
+// WithRateLimiter charges calls to the rate-limited methods (login,
+// register, password reset, ...) against rl per client IP before they're
+// served or forwarded. Pass the grpc server's limiter so one client gets
+// one budget whichever port it comes in on; in-process calls then aren't
+// charged a second time by the chain's RateLimit. A forwarding bridge
+// also tells the upstream each caller's IP, which its RateLimit only uses
+// if it lists the bridge with middleware.WithTrustedForwarders.
+func WithRateLimiter(rl *middleware.RateLimiter) Option {
+	return func(b *Bridge) { b.limiter = rl }
+}
+
+// WithTrustProxy takes the client's IP from X-Forwarded-For, for a bridge
+// behind a reverse proxy that sets it. Only the last entry counts, the
+// address the proxy itself saw: anything before it came from the client
+// and could be made up. Don't use it on a bridge clients reach directly,
+// or each can pick its own bucket.
+func WithTrustProxy() Option {
+	return func(b *Bridge) { b.trustProxy = true }
+}
+
+// clientIP is who r comes from for rate limiting and the peer of
+// in-process calls.
+func (b *Bridge) clientIP(r *http.Request) string {
+	if b.trustProxy {
+		if vals := r.Header.Values("X-Forwarded-For"); len(vals) > 0 {
+			hops := strings.Split(vals[len(vals)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// allow takes a token for r if its method is limited, reporting whether
+// the call may go ahead.
+func (b *Bridge) allow(r *http.Request) bool {
+	if b.limiter == nil || !middleware.Limited(r.URL.Path) {
+		return true
+	}
+	return b.limiter.Allow(b.clientIP(r), r.URL.Path)
+}
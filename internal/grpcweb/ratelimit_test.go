@@ -0,0 +1,187 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store/memstore"
+)
+
+// login posts a wrong password for a registered user through b, as from
+// remote with X-Forwarded-For xff if set, and returns the grpc-status
+// and reason.
+func login(t *testing.T, b *Bridge, remote, xff string) (string, string) {
+	t.Helper()
+	msg, _ := proto.Marshal(&pb.LoginRequest{Email: "rl@test.com", Password: "wrongpass"})
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	req := httptest.NewRequest(http.MethodPost, "/appointment.v1.AuthService/Login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.RemoteAddr = remote
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	b.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("http status %d", rec.Code)
+	}
+	fields := trailerFields(t, rec.Body.Bytes())
+	var info errorInfo
+	if v := fields["x-error-info"]; v != "" {
+		if err := json.Unmarshal([]byte(v), &info); err != nil {
+			t.Fatalf("x-error-info %q: %v", v, err)
+		}
+	}
+	return fields["grpc-status"], info.Reason
+}
+
+// hammer logs in n times and counts the rate-limited replies.
+func hammer(t *testing.T, b *Bridge, n int, remote, xff string) (limited int) {
+	t.Helper()
+	for range n {
+		st, reason := login(t, b, remote, xff)
+		switch {
+		case st == "8" && reason == "RATE_LIMITED":
+			limited++
+		case st != "16":
+			t.Fatalf("grpc-status %s reason %q, want 16 or a rate limit", st, reason)
+		}
+	}
+	return limited
+}
+
+func limitedHandler(t *testing.T) *handler.Handler {
+	t.Helper()
+	h := handler.New(memstore.New(), auth.SingleKey("s"))
+	if _, err := h.Register(t.Context(), &pb.RegisterRequest{Email: "rl@test.com", Password: "testpass123", Name: "RL"}); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+const burst = 3
+
+func newLimiter(t *testing.T) *middleware.RateLimiter {
+	rl := middleware.NewRateLimiter(0.001, burst)
+	t.Cleanup(rl.Close)
+	return rl
+}
+
+// in-process, the bridge and the chain share one limiter and a call is
+// charged once
+func TestBridgeRateLimit(t *testing.T) {
+	h := limitedHandler(t)
+	rl := newLimiter(t)
+	b, err := New("", h, auth.SingleKey("s"),
+		WithInterceptors(middleware.RateLimit(rl), middleware.Auth(auth.SingleKey("s"), auth.Config{})),
+		WithRateLimiter(rl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hammer(t, b, 10, "192.0.2.1:1234", ""); got != 10-burst {
+		t.Errorf("%d of 10 limited, want %d", got, 10-burst)
+	}
+	// another port of the same host shares the bucket, another host doesn't
+	if got := hammer(t, b, 1, "192.0.2.1:5678", ""); got != 1 {
+		t.Errorf("same host, new port: %d limited", got)
+	}
+	if got := hammer(t, b, burst, "192.0.2.2:1234", ""); got != 0 {
+		t.Errorf("other host: %d limited", got)
+	}
+	// an untrusted X-Forwarded-For doesn't buy a fresh bucket
+	if got := hammer(t, b, 1, "192.0.2.1:1234", "198.51.100.7"); got != 1 {
+		t.Errorf("spoofed X-Forwarded-For: %d limited", got)
+	}
+
+	// methods that aren't limited never are
+	for range 2 * burst {
+		var info pb.ServerInfo
+		if st := webCall(t, b, "GetServerInfo", &pb.GetServerInfoRequest{}, &info, func(r *http.Request) { r.RemoteAddr = "192.0.2.1:1234" }); st != "0" {
+			t.Fatalf("GetServerInfo: grpc-status %s", st)
+		}
+	}
+}
+
+func TestBridgeRateLimitTrustProxy(t *testing.T) {
+	b, err := New("", limitedHandler(t), auth.SingleKey("s"), WithRateLimiter(newLimiter(t)), WithTrustProxy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const proxy = "10.0.0.1:4000"
+	if got := hammer(t, b, burst+2, proxy, "203.0.113.5"); got != 2 {
+		t.Errorf("client behind proxy: %d limited, want 2", got)
+	}
+	// the proxy appends what it saw, so a made-up first hop changes nothing
+	if got := hammer(t, b, 1, proxy, "198.51.100.7, 203.0.113.5"); got != 1 {
+		t.Errorf("spoofed first hop: %d limited", got)
+	}
+	if got := hammer(t, b, burst, proxy, "203.0.113.6"); got != 0 {
+		t.Errorf("other client behind the proxy: %d limited", got)
+	}
+}
+
+// a bridge forwarding to another server limits on its own side, where it
+// still sees each client
+func TestBridgeRateLimitUpstream(t *testing.T) {
+	h := limitedHandler(t)
+	b, _ := upstream(t, h, auth.SingleKey("s"), WithRateLimiter(newLimiter(t)))
+	if got := hammer(t, b, burst+4, "192.0.2.1:1234", ""); got != 4 {
+		t.Errorf("%d limited, want 4", got)
+	}
+	if got := hammer(t, b, burst, "192.0.2.2:1234", ""); got != 0 {
+		t.Errorf("other host: %d limited", got)
+	}
+}
+
+// an upstream that trusts the bridge charges each browser, not the bridge;
+// one that doesn't lumps them all together
+func TestBridgeRateLimitForwardedFor(t *testing.T) {
+	serve := func(opts ...middleware.LimiterOption) *Bridge {
+		rl := middleware.NewRateLimiter(0.001, burst, opts...)
+		t.Cleanup(rl.Close)
+		srv := grpc.NewServer(grpc.ChainUnaryInterceptor(middleware.RateLimit(rl)))
+		pb.RegisterAuthServiceServer(srv, limitedHandler(t))
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+		b, err := New(lis.Addr().String(), nil, auth.SingleKey("s"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(b.Close)
+		return b
+	}
+
+	loopback := netip.MustParsePrefix("127.0.0.0/8")
+	b := serve(middleware.WithTrustedForwarders(loopback))
+	if got := hammer(t, b, burst+1, "192.0.2.1:1234", ""); got != 1 {
+		t.Errorf("first browser: %d limited, want 1", got)
+	}
+	if got := hammer(t, b, burst, "192.0.2.2:1234", ""); got != 0 {
+		t.Errorf("second browser: %d limited", got)
+	}
+
+	b = serve()
+	hammer(t, b, burst, "192.0.2.1:1234", "")
+	if got := hammer(t, b, 1, "192.0.2.2:1234", ""); got != 1 {
+		t.Errorf("untrusted bridge: second browser %d limited, want 1", got)
+	}
+}
@@ -0,0 +1,160 @@
+package grpcweb
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+)
+
+// RefreshCookie holds the refresh token of a browser session. It's only
+// sent to /auth/, where the bridge spends it.
+const RefreshCookie = "refresh_token"
+
+// serveSession handles the REST endpoints of a cookie session:
+//
+//	POST /auth/login    {"email": ..., "password": ...}
+//	POST /auth/refresh  (the refresh_token cookie, plus X-CSRF-Token)
+//
+// Both call the AuthService method like a grpc-web call would, rate limit
+// included, and answer with the session cookies and a small JSON body
+// instead of the tokens.
+func (b *Bridge) serveSession(w http.ResponseWriter, r *http.Request) {
+	locale := i18n.Match(strings.Join(r.Header.Values("Accept-Language"), ", "))
+	fail := func(err error) {
+		err = apperr.Localize(err, locale)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(httpStatus(status.Code(err)))
+		json.NewEncoder(w).Encode(map[string]string{"error": status.Convert(err).Message(), "reason": string(apperr.ReasonOf(err))})
+	}
+
+	switch r.URL.Path {
+	case "/auth/login":
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			fail(apperr.New(apperr.InvalidArgument, "bad JSON body"))
+			return
+		}
+		resp := &pb.LoginResponse{}
+		if err := b.call(r, pb.AuthService_Login_FullMethodName, &pb.LoginRequest{Email: body.Email, Password: body.Password}, resp); err != nil {
+			fail(err)
+			return
+		}
+		if err := setSession(w, resp.Token, resp.AccessExpiresAt.AsTime(), resp.RefreshToken, resp.RefreshExpiresAt.AsTime()); err != nil {
+			fail(apperr.New(apperr.Internal, "internal error"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"userId": resp.UserId, "name": resp.Name, "emailVerified": resp.EmailVerified,
+			"accessExpiresAt": resp.AccessExpiresAt.AsTime(),
+		})
+	case "/auth/refresh":
+		c, err := r.Cookie(RefreshCookie)
+		if err != nil || c.Value == "" {
+			fail(apperr.New(apperr.AuthRequired, "no refresh_token cookie"))
+			return
+		}
+		// the cookie authenticates this one, so it needs the same
+		// double-submit check as any other cookie call
+		if !csrfMatches(r) {
+			http.Error(w, "cookie-authenticated request needs an X-CSRF-Token header matching the csrf_token cookie", http.StatusForbidden)
+			return
+		}
+		resp := &pb.RefreshResponse{}
+		if err := b.call(r, pb.AuthService_Refresh_FullMethodName, &pb.RefreshRequest{RefreshToken: c.Value}, resp); err != nil {
+			fail(err)
+			return
+		}
+		if err := setSession(w, resp.Token, resp.AccessExpiresAt.AsTime(), resp.RefreshToken, resp.RefreshExpiresAt.AsTime()); err != nil {
+			fail(apperr.New(apperr.Internal, "internal error"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"accessExpiresAt": resp.AccessExpiresAt.AsTime()})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// call runs one unary method for r the way forward does, in-process or
+// upstream, after charging the rate limiter.
+func (b *Bridge) call(r *http.Request, fullMethod string, in, out proto.Message) error {
+	payload, err := proto.Marshal(in)
+	if err != nil {
+		return apperr.New(apperr.Internal, "encode request failed")
+	}
+	r = r.Clone(r.Context())
+	r.URL.Path = fullMethod
+	if !b.allow(r) {
+		return apperr.New(apperr.RateLimited, "too many requests")
+	}
+	var raw []byte
+	if b.conn == nil {
+		raw, _, err = b.invoke(r, payload)
+	} else {
+		raw, _, err = b.dial(r, payload)
+	}
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(raw, out); err != nil {
+		return apperr.New(apperr.Internal, "decode response failed")
+	}
+	return nil
+}
+
+// setSession sets the cookies of a new or refreshed session: the tokens,
+// HttpOnly, and a fresh CSRF token so it rotates with them.
+func setSession(w http.ResponseWriter, access string, accessExp time.Time, refresh string, refreshExp time.Time) error {
+	http.SetCookie(w, &http.Cookie{
+		Name: AccessCookie, Value: access, Path: "/", Expires: accessExp,
+		HttpOnly: true, Secure: true, SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: RefreshCookie, Value: refresh, Path: "/auth/", Expires: refreshExp,
+		HttpOnly: true, Secure: true, SameSite: http.SameSiteStrictMode,
+	})
+	_, err := SetCSRFCookie(w)
+	return err
+}
+
+// httpStatus is the HTTP equivalent of a grpc code for the JSON endpoints.
+func httpStatus(c codes.Code) int {
+	switch c {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded, codes.Canceled:
+		return http.StatusGatewayTimeout
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,91 @@
+package grpcweb
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/notify"
+)
+
+var shareTmpl = template.Must(template.New("share").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex">
+<title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Cancelled}}<p>This appointment is no longer scheduled.</p>{{else}}
+<p>{{.When}}</p>
+{{if .Location}}<p>{{.Location}}</p>{{end}}
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Attendees}}<ul>{{range .Attendees}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+</body></html>
+`))
+
+type shareView struct {
+	Title       string     `json:"title"`
+	When        string     `json:"when,omitempty"`
+	Start       *time.Time `json:"start,omitempty"` // nil once cancelled
+	End         *time.Time `json:"end,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Attendees   []string   `json:"attendees,omitempty"`
+	Cancelled   bool       `json:"cancelled,omitempty"`
+	AllDay      bool       `json:"all_day,omitempty"`
+	Message     string     `json:"message,omitempty"`
+}
+
+// serveShare renders GET /share/{token}. ?tz=Europe/Paris and ?lang=fr pick
+// how times are shown; ?format=json (or Accept: application/json) returns
+// JSON instead of HTML. An all-day event is shown as its dates, in its own
+// zone whatever ?tz says, and its JSON start and end are those midnights.
+func (b *Bridge) serveShare(w http.ResponseWriter, r *http.Request) {
+	// the token is the credential: don't cache it anywhere or leak it onwards
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	token := strings.TrimPrefix(r.URL.Path, "/share/")
+	asJSON := r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	sa, err := b.direct.ResolveShareLink(r.Context(), token)
+	if err != nil {
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "link not found or expired", "reason": string(apperr.NotFound)})
+			return
+		}
+		http.Error(w, "link not found or expired", http.StatusNotFound)
+		return
+	}
+
+	v := shareView{Title: sa.Title, Cancelled: sa.Cancelled}
+	if sa.Cancelled {
+		v.Message = "no longer scheduled"
+	} else {
+		prefs := notify.Prefs{TimeZone: r.URL.Query().Get("tz"), Locale: r.URL.Query().Get("lang")}
+		loc := notify.Location(prefs, sa.TimeZone)
+		v.When = notify.FormatRange(sa.Start, sa.End, prefs, sa.TimeZone)
+		if sa.AllDay {
+			loc = notify.Location(notify.Prefs{}, sa.TimeZone)
+			v.When = notify.FormatDays(sa.Start, sa.End, prefs, sa.TimeZone)
+			v.AllDay = true
+		}
+		start, end := sa.Start.In(loc), sa.End.In(loc)
+		v.Start, v.End = &start, &end
+		v.Location, v.Description, v.Attendees = sa.Location, sa.Description, sa.Attendees
+	}
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	shareTmpl.Execute(w, v)
+}
@@ -0,0 +1,49 @@
+package grpcweb
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// grpc-web-text is the binary protocol base64-encoded, for clients that
+// can't send or read raw bytes (the official JS client in text mode, some
+// older proxies).
+
+// textWriter encodes the response for grpc-web-text clients. writeSuccess and
+// writeError hand over one whole frame per Write, so every frame becomes its
+// own padded base64 chunk, as the spec has it.
+type textWriter struct{ http.ResponseWriter }
+
+func (t textWriter) WriteHeader(code int) {
+	t.Header().Set("Content-Type", "application/grpc-web-text+proto")
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t textWriter) Write(p []byte) (int, error) {
+	if _, err := t.ResponseWriter.Write([]byte(base64.StdEncoding.EncodeToString(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decodeText decodes a grpc-web-text body. Clients may send several padded
+// chunks back to back, which a plain base64 decode rejects, so this goes one
+// 4-character quantum at a time; padding can only end a quantum anyway.
+func decodeText(body []byte) ([]byte, error) {
+	src := strings.Join(strings.Fields(string(body)), "")
+	if len(src)%4 != 0 {
+		return nil, errors.New("truncated base64")
+	}
+	out := make([]byte, 0, len(src)/4*3)
+	var buf [3]byte
+	for i := 0; i < len(src); i += 4 {
+		n, err := base64.StdEncoding.Decode(buf[:], []byte(src[i:i+4]))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf[:n]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"time"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	defaultSearchPageSize = 50
+	maxSearchPageSize     = 200
+)
+
+// isAdmin is true for tokens carrying the admin role, and for the user IDs
+// in ADMIN_USER_IDS, which predate roles.
+func (h *Handler) isAdmin(ctx context.Context) bool {
+	role, _ := ctx.Value(middleware.RoleKey).(string)
+	id, _ := uid(ctx)
+	return role == auth.RoleAdmin || h.admins[id]
+}
+
+func (h *Handler) requireAdmin(ctx context.Context) (string, error) {
+	id, err := uid(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !h.isAdmin(ctx) {
+		return "", apperr.New(apperr.AdminOnly, "admin only")
+	}
+	return id, nil
+}
+
+// SearchAllAppointments is for support staff. The search is audited before
+// it runs; if the audit row can't be written the search doesn't happen.
+func (h *Handler) SearchAllAppointments(ctx context.Context, req *pb.SearchAllAppointmentsRequest) (*pb.SearchAllAppointmentsResponse, error) {
+	actor, err := h.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureAdminAudit); err != nil {
+		return nil, err
+	}
+
+	size := int(req.PageSize)
+	switch {
+	case size < 0:
+		return nil, validate.Field("page_size", i18n.NotNegative)
+	case size == 0:
+		size = defaultSearchPageSize
+	case size > maxSearchPageSize:
+		size = maxSearchPageSize
+	}
+
+	p := store.SearchParams{
+		Query:      req.Query,
+		OwnerEmail: req.UserEmail,
+		Status:     req.Status,
+		Limit:      size + 1,
+		Attendees:  req.IncludeDetails,
+	}
+	if req.RangeStart != nil {
+		p.From = req.RangeStart.AsTime()
+	}
+	if req.RangeEnd != nil {
+		p.To = req.RangeEnd.AsTime()
+	}
+	if !p.From.IsZero() && !p.To.IsZero() && !p.To.After(p.From) {
+		return nil, apperr.New(apperr.ListRangeInvalid, "range_end must be after range_start")
+	}
+	if req.PageToken != "" {
+		if p.AfterStart, p.AfterID, err = decodePageToken(req.PageToken); err != nil {
+			return nil, apperr.New(apperr.BadPageToken, "invalid page token")
+		}
+	}
+
+	params := map[string]any{
+		"query":           req.Query,
+		"user_email":      req.UserEmail,
+		"status":          req.Status,
+		"include_details": req.IncludeDetails,
+		"page_token":      req.PageToken,
+	}
+	if !p.From.IsZero() {
+		params["range_start"] = p.From.Format(time.RFC3339)
+	}
+	if !p.To.IsZero() {
+		params["range_end"] = p.To.Format(time.RFC3339)
+	}
+	if err := h.store.AppendAdminAudit(ctx, actor, "SearchAllAppointments", params); err != nil {
+		log.Printf("admin audit write failed: %v", err)
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	rows, err := h.store.SearchAppointments(ctx, p)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	resp := &pb.SearchAllAppointmentsResponse{}
+	if len(rows) > size {
+		rows = rows[:size]
+		last := rows[size-1].Appointment
+		resp.NextPageToken = encodePageToken(last.StartTime, last.ID)
+	}
+	for _, r := range rows {
+		a := toProto(&r.Appointment)
+		if !req.IncludeDetails {
+			a.Description = ""
+			a.AttendeeIds = nil
+		}
+		resp.Results = append(resp.Results, &pb.AppointmentSearchResult{Appointment: a, OwnerEmail: r.OwnerEmail})
+	}
+	return resp, nil
+}
+
+// ListUsers is the directory admins pick a user_id from.
+func (h *Handler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	if _, err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	size := int(req.PageSize)
+	switch {
+	case size < 0:
+		return nil, validate.Field("page_size", i18n.NotNegative)
+	case size == 0:
+		size = defaultSearchPageSize
+	case size > maxSearchPageSize:
+		size = maxSearchPageSize
+	}
+	after := ""
+	if req.PageToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+		if err != nil || len(b) == 0 {
+			return nil, apperr.New(apperr.BadPageToken, "invalid page token")
+		}
+		after = string(b)
+	}
+
+	users, err := h.store.ListUsers(ctx, after, size+1)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListUsersResponse{}
+	if len(users) > size {
+		users = users[:size]
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(users[size-1].Email))
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, toProfile(&users[i]))
+	}
+	return resp, nil
+}
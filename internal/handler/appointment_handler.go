@@ -2,74 +2,948 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
-	"google.golang.org/grpc/codes"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
 	"schedule-management-api/internal/middleware"
 	"schedule-management-api/internal/model"
-	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/sanitize"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
 )
 
-func uid(ctx context.Context) string {
-	return ctx.Value(middleware.UserIDKey).(string)
+// uid is the caller's user ID. It's missing when Auth didn't run for the
+// call (a method wrongly in its open list, a bridge given interceptors
+// without it), which is Unauthenticated like any call without a token.
+func uid(ctx context.Context) (string, error) {
+	v := ctx.Value(middleware.UserIDKey)
+	if v == nil {
+		return "", apperr.New(apperr.AuthRequired, "not authenticated")
+	}
+	id, ok := v.(string)
+	if !ok || id == "" {
+		return "", apperr.New(apperr.Internal, "internal error")
+	}
+	return id, nil
 }
 
-func (h *Handler) CreateAppointment(ctx context.Context, req *pb.CreateAppointmentRequest) (*pb.CreateAppointmentResponse, error) {
-	userID := uid(ctx)
+// max entries accepted by BatchCreateAppointments
+const maxBatch = 50
+
+// matches idempotency_keys.key
+const maxIdempotencyKey = 100
+
+// longest lead time a reminder can have (a week)
+const maxReminderMinutes = 7 * 24 * 60
+
+// default limits, in characters. Title and location match their columns,
+// so they can only be lowered; description is TEXT but capped so one
+// appointment can't blow the list size budget on its own.
+const (
+	maxTitleLen       = 200
+	maxDescriptionLen = 5000
+	maxLocationLen    = 500
+)
 
-	if req.Title == "" {
-		return nil, status.Error(codes.InvalidArgument, "title required")
+// per appointment, and per tag
+const (
+	maxTags   = 10
+	maxTagLen = 30
+)
+
+// maxCapacity caps how many can join a group appointment.
+const maxCapacity = 500
+
+// maxConflicts caps the appointments named in a ConflictInfo.
+const maxConflicts = 5
+
+// conflictStatus is the AlreadyExists status for want landing on a taken
+// slot, naming what's in the way in a ConflictInfo detail. Only userID's
+// appointments are looked at, so it can't show anyone else's. If the
+// lookup fails the plain status is returned.
+func (h *Handler) conflictStatus(ctx context.Context, userID, excludeID string, want slots.Interval, allDay bool) *status.Status {
+	st := apperr.Status(apperr.ApptConflict, "time conflicts with existing appointment")
+	in, err := h.store.FindOverlaps(ctx, userID, want.Start, want.End, allDay, excludeID, maxConflicts)
+	if err != nil || len(in) == 0 {
+		return st
 	}
-	if req.StartTime == nil || req.EndTime == nil {
-		return nil, status.Error(codes.InvalidArgument, "times required")
+	if withDetails, err := st.WithDetails(conflictInfo(in)); err == nil {
+		st = withDetails
 	}
+	return st
+}
 
-	start := req.StartTime.AsTime()
-	end := req.EndTime.AsTime()
+func conflictInfo(in []model.Appointment) *pb.ConflictInfo {
+	info := &pb.ConflictInfo{}
+	for _, a := range in {
+		info.Appointments = append(info.Appointments, &pb.ConflictingAppointment{
+			Id:        a.ID,
+			Title:     a.Title,
+			StartTime: timestamppb.New(a.StartTime),
+			EndTime:   timestamppb.New(a.EndTime),
+		})
+	}
+	return info
+}
 
-	if !end.After(start) {
-		return nil, status.Error(codes.InvalidArgument, "end must be after start")
+// rescheduleConflict is conflictStatus for a move onto a taken slot, plus
+// up to three nearby free slots as a RescheduleSuggestions detail. Free
+// time is no help to an all-day event, which only gets the former.
+func (h *Handler) rescheduleConflict(ctx context.Context, userID, id string, want slots.Interval, allDay bool) error {
+	st := h.conflictStatus(ctx, userID, id, want, allDay)
+	if allDay {
+		return st.Err()
+	}
+	busy, err := h.store.BusyIntervals(ctx, userID, slots.Window(want), id)
+	if err != nil {
+		return st.Err()
 	}
-	if start.Before(time.Now().Add(-5 * time.Minute)) {
-		return nil, status.Error(codes.InvalidArgument, "cannot book in the past")
+	details := &pb.RescheduleSuggestions{}
+	for _, s := range slots.Alternatives(busy, want, h.now()) {
+		details.Alternatives = append(details.Alternatives, suggestedSlot(s.Kind, s.Interval))
 	}
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
 
-	// app-level overlap check
-	if dup, err := h.store.HasOverlap(ctx, userID, start, end, ""); err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
-	} else if dup {
-		return nil, status.Error(codes.AlreadyExists, "time conflicts with existing appointment")
+// createConflict is conflictStatus for a new booking, plus the first free
+// slot of the same length from the requested start on, as SuggestSlots
+// would find it; just the former for an all-day event.
+func (h *Handler) createConflict(ctx context.Context, userID string, want slots.Interval, allDay bool) error {
+	st := h.conflictStatus(ctx, userID, "", want, allDay)
+	if allDay {
+		return st.Err()
+	}
+	from := want.Start
+	if soonest := slots.Earliest(h.now()); from.Before(soonest) {
+		from = soonest
+	}
+	w := slots.Window(slots.Interval{Start: from, End: from.Add(want.End.Sub(want.Start))})
+	busy, err := h.unbookable(ctx, userID, w)
+	if err != nil {
+		return st.Err()
+	}
+	free := slots.Free(busy, w.Start, w.End, want.End.Sub(want.Start), nil, 1)
+	if len(free) == 0 {
+		return st.Err()
 	}
+	details := &pb.RescheduleSuggestions{Alternatives: []*pb.SuggestedSlot{suggestedSlot(slots.NextFree, free[0])}}
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
 
-	apt := &model.Appointment{
+// fieldSet is the request fields being written, by proto name; nil is all
+// of them.
+type fieldSet []string
+
+func (f fieldSet) has(name string) bool { return f == nil || slices.Contains(f, name) }
+
+// maskable are the UpdateAppointmentRequest fields update_mask can name.
+var maskable = []string{"title", "description", "start_time", "end_time", "location", "attendee_ids", "calendar_id", "resource_id", "tags", "capacity", "all_day", "time_zone"}
+
+// updateFields is what an update_mask lets through: nil without a mask,
+// the named paths otherwise.
+func updateFields(v *validate.Errors, m *fieldmaskpb.FieldMask) fieldSet {
+	if m == nil {
+		return nil
+	}
+	if len(m.Paths) == 0 {
+		v.Add("update_mask", i18n.NoFields)
+	}
+	for _, p := range m.Paths {
+		if !slices.Contains(maskable, p) {
+			v.Add("update_mask", i18n.UnknownField, p)
+		}
+	}
+	return fieldSet(m.Paths)
+}
+
+// cleanText is what's stored for a client's title, description or
+// location: markup stripped (unless turned off), NFC, trimmed.
+func (h *Handler) cleanText(s string) string {
+	if h.stripHTML {
+		s = sanitize.StripHTML(s)
+	}
+	return sanitize.Text(s)
+}
+
+// checkAppointmentFields records what's wrong with the fields create and
+// update share. Only those in fields are looked at; the text ones are
+// expected cleaned already, so a title of only space is missing.
+func (h *Handler) checkAppointmentFields(v *validate.Errors, fields fieldSet, title, description, location string, start, end *timestamppb.Timestamp) {
+	if fields.has("title") && v.Required("title", title) {
+		v.MaxLen("title", title, h.maxTitle)
+	}
+	if fields.has("description") {
+		v.MaxLen("description", description, h.maxDescription)
+	}
+	if fields.has("location") {
+		v.MaxLen("location", location, h.maxLocation)
+	}
+	if start == nil && fields.has("start_time") {
+		v.Add("start_time", i18n.Required)
+	}
+	if end == nil && fields.has("end_time") {
+		v.Add("end_time", i18n.Required)
+	}
+	if start != nil && end != nil && fields.has("start_time") && fields.has("end_time") && !end.AsTime().After(start.AsTime()) {
+		v.AddReason(apperr.ApptEmptyRange, "end_time", i18n.After, "start_time")
+	}
+}
+
+// checkAllDay records what's wrong with an all-day event's times: both
+// have to be midnights in loc.
+func checkAllDay(v *validate.Errors, loc *time.Location, start, end time.Time) {
+	if !midnight(start, loc) {
+		v.Add("start_time", i18n.Midnight, loc.String())
+	}
+	if !midnight(end, loc) {
+		v.Add("end_time", i18n.Midnight, loc.String())
+	}
+}
+
+// midnight reports whether t starts a day in loc, which on a day a DST
+// change skips midnight is whenever the day does start.
+func midnight(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	return t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc))
+}
+
+// dayZone loads a stored appointment's time zone, checked when it was
+// written.
+func dayZone(name string) *time.Location {
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// normalizeTags lower-cases, sorts and dedups tags, recording what's wrong
+// with them under field. Surrounding space is dropped; a tag that's
+// nothing else is an error.
+func normalizeTags(v *validate.Errors, field string, tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			v.Add(field, i18n.EmptyTag)
+			return nil
+		}
+		if utf8.RuneCountInString(t) > maxTagLen {
+			v.Add(field, i18n.TagTooLong, t, maxTagLen)
+			return nil
+		}
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > maxTags {
+		v.Add(field, i18n.MaxTags, maxTags)
+		return nil
+	}
+	return out
+}
+
+// how far in the past a new appointment may start, for clocks a little
+// behind and forms left open a moment
+const pastGrace = 5 * time.Minute
+
+// validate a create request and build the model (shared by single + batch create)
+func (h *Handler) newAppointment(userID string, req *pb.CreateAppointmentRequest) (*model.Appointment, error) {
+	var v validate.Errors
+	title, description, location := h.cleanText(req.Title), h.cleanText(req.Description), h.cleanText(req.Location)
+	loc := timeZone(&v, "time_zone", req.TimeZone)
+	endTime := req.EndTime
+	if req.AllDay && endTime == nil && req.StartTime != nil && loc != nil {
+		// the day it starts
+		s := req.StartTime.AsTime().In(loc)
+		endTime = timestamppb.New(time.Date(s.Year(), s.Month(), s.Day()+1, 0, 0, 0, 0, loc))
+	}
+	h.checkAppointmentFields(&v, nil, title, description, location, req.StartTime, endTime)
+	if req.AllDay && req.StartTime != nil && endTime != nil && loc != nil {
+		checkAllDay(&v, loc, req.StartTime.AsTime(), endTime.AsTime())
+	}
+	// today's all-day event started at midnight; it's past once the day is
+	if req.AllDay && endTime != nil && !endTime.AsTime().After(h.now()) {
+		v.AddReason(apperr.ApptPast, "start_time", i18n.InPast)
+	} else if !req.AllDay && req.StartTime != nil && req.StartTime.AsTime().Before(h.now().Add(-pastGrace)) {
+		v.AddReason(apperr.ApptPast, "start_time", i18n.InPast)
+	}
+	if req.ReminderMinutesBefore < 0 || req.ReminderMinutesBefore > maxReminderMinutes {
+		v.Add("reminder_minutes_before", i18n.Between, 0, maxReminderMinutes)
+	}
+	tags := normalizeTags(&v, "tags", req.Tags)
+	checkCapacity(&v, req.Capacity)
+	if req.Capacity > 0 && len(req.AttendeeIds) > int(req.Capacity) {
+		v.Add("attendee_ids", i18n.OverCapacity)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	start := req.StartTime.AsTime()
+	end := endTime.AsTime()
+
+	return &model.Appointment{
 		ID:          uuid.New().String(),
-		Title:       req.Title,
-		Description: req.Description,
+		Title:       title,
+		Description: description,
 		StartTime:   start,
 		EndTime:     end,
 		UserID:      userID,
 		Status:      "confirmed",
-		Location:    req.Location,
+		Location:    location,
 		AttendeeIDs: req.AttendeeIds,
+
+		RemindBefore: time.Duration(req.ReminderMinutesBefore) * time.Minute,
+		CalendarID:   req.CalendarId,
+		ResourceID:   req.ResourceId,
+		Tags:         tags,
+		Capacity:     int(req.Capacity),
+		AllDay:       req.AllDay,
+		TimeZone:     req.TimeZone,
+	}, nil
+}
+
+func checkCapacity(v *validate.Errors, capacity int32) {
+	if capacity < 0 || capacity > maxCapacity {
+		v.Add("capacity", i18n.Between, 0, maxCapacity)
+	}
+}
+
+func (h *Handler) CreateAppointment(ctx context.Context, req *pb.CreateAppointmentRequest) (*pb.CreateAppointmentResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// a retry of a create that already went through gets the original back,
+	// before anything (like the start having passed) could reject it
+	key, hash := req.IdempotencyKey, ""
+	if key != "" {
+		if len(key) > maxIdempotencyKey {
+			return nil, validate.Field("idempotency_key", i18n.MaxChars, maxIdempotencyKey)
+		}
+		if err := h.require(store.FeatureIdempotencyKeys); err != nil {
+			return nil, err
+		}
+		if hash, err = requestHash(req); err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+		prev, err := h.store.IdempotentAppointment(ctx, userID, key, hash)
+		if err == nil {
+			return &pb.CreateAppointmentResponse{Appointment: toProto(prev)}, nil
+		}
+		if errors.Is(err, store.ErrKeyReused) {
+			return nil, apperr.New(apperr.ApptKeyReused, "idempotency_key was already used with a different request")
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+	}
+
+	apt, err := h.newAppointment(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(apt.AttendeeIDs) > 0 {
+		if err := h.require(store.FeatureAttendees); err != nil {
+			return nil, err
+		}
+	}
+	if apt.RemindBefore > 0 {
+		if err := h.require(store.FeatureReminders); err != nil {
+			return nil, err
+		}
+	}
+	if len(apt.Tags) > 0 {
+		if err := h.require(store.FeatureTags); err != nil {
+			return nil, err
+		}
+	}
+	if apt.Capacity > 0 {
+		if err := h.require(store.FeatureCapacity); err != nil {
+			return nil, err
+		}
+	}
+	if apt.AllDay || apt.TimeZone != "" {
+		if err := h.require(store.FeatureAllDay); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.checkCalendarID(apt.CalendarID); err != nil {
+		return nil, err
+	}
+	if err := h.checkResourceID(apt.ResourceID); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.CreateAppointment(ctx, apt); err != nil {
-		// db exclusion constraint caught a race
-		return nil, status.Error(codes.AlreadyExists, "time conflicts with existing appointment")
+	if err := h.checkFreeze(ctx, apt.StartTime, apt.EndTime); err != nil {
+		return nil, err
+	}
+	// an all-day event takes none of the owner's time
+	if !apt.AllDay {
+		if err := h.checkAvailability(ctx, userID, apt.StartTime, apt.EndTime); err != nil {
+			return nil, err
+		}
+		if apt.Buffer, err = h.buffer(ctx, userID); err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
 	}
 
+	// the overlap and buffer checks run in the insert's transaction; the
+	// exclusion constraint catches whatever races past the first
+	want, allDay, buf := slots.Interval{Start: apt.StartTime, End: apt.EndTime}, apt.AllDay, apt.Buffer
+	if key != "" {
+		// an identical request may have won the race since the lookup above;
+		// then this returns its appointment
+		apt, err = h.store.CreateAppointmentWithKey(ctx, apt, key, hash)
+	} else {
+		err = h.store.CreateAppointment(ctx, apt)
+	}
+	if errors.Is(err, store.ErrKeyReused) {
+		return nil, apperr.New(apperr.ApptKeyReused, "idempotency_key was already used with a different request")
+	}
+	if errors.Is(err, store.ErrConflict) {
+		h.metrics.Conflict()
+		return nil, h.createConflict(ctx, userID, want, allDay)
+	}
+	if errors.Is(err, store.ErrBuffer) {
+		return nil, h.bufferConflict(ctx, userID, "", want.Start, want.End, buf)
+	}
+	if errors.Is(err, store.ErrUnknownCalendar) {
+		return nil, apperr.New(apperr.CalendarNotFound, "calendar not found")
+	}
+	if rerr := resourceErr(err); rerr != nil {
+		return nil, rerr
+	}
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, userID)
+
 	return &pb.CreateAppointmentResponse{Appointment: toProto(apt)}, nil
 }
 
+// requestHash identifies a create by everything in it but the key, so a
+// retry matches the call it repeats and a reused key doesn't.
+func requestHash(req *pb.CreateAppointmentRequest) (string, error) {
+	req = proto.Clone(req).(*pb.CreateAppointmentRequest)
+	req.IdempotencyKey = ""
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// BatchCreateAppointments is atomic: every entry is validated and checked for
+// overlaps (against existing appointments and against the rest of the batch)
+// before anything is written. Any failure returns the per-item errors and
+// creates nothing.
+func (h *Handler) BatchCreateAppointments(ctx context.Context, req *pb.BatchCreateAppointmentsRequest) (*pb.BatchCreateAppointmentsResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Appointments) == 0 {
+		return nil, validate.Field("appointments", i18n.Required)
+	}
+	if len(req.Appointments) > maxBatch {
+		return nil, apperr.Msg(apperr.BatchTooLarge, i18n.BatchTooLarge, maxBatch)
+	}
+	for _, r := range req.Appointments {
+		if len(r.AttendeeIds) > 0 {
+			if err := h.require(store.FeatureAttendees); err != nil {
+				return nil, err
+			}
+		}
+		if r.ReminderMinutesBefore > 0 {
+			if err := h.require(store.FeatureReminders); err != nil {
+				return nil, err
+			}
+		}
+		if r.CalendarId != "" {
+			if err := h.require(store.FeatureCalendars); err != nil {
+				return nil, err
+			}
+		}
+		if len(r.Tags) > 0 {
+			if err := h.require(store.FeatureTags); err != nil {
+				return nil, err
+			}
+		}
+		if r.Capacity > 0 {
+			if err := h.require(store.FeatureCapacity); err != nil {
+				return nil, err
+			}
+		}
+		if r.AllDay || r.TimeZone != "" {
+			if err := h.require(store.FeatureAllDay); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	apts := make([]*model.Appointment, len(req.Appointments))
+	var errs []*pb.BatchItemError
+	// the entries' errors are in the response, out of the Locale
+	// interceptor's reach
+	locale := i18n.FromContext(ctx)
+	fail := func(i int, err error) {
+		err = apperr.Localize(err, locale)
+		st, _ := status.FromError(err)
+		errs = append(errs, &pb.BatchItemError{
+			Index: int32(i), Code: st.Code().String(), Message: st.Message(), Reason: string(apperr.ReasonOf(err)),
+		})
+		apts[i] = nil
+	}
+
+	// calendars are checked up front so a bad one is reported per entry
+	var calendars map[string]bool
+	for i, r := range req.Appointments {
+		apt, err := h.newAppointment(userID, r)
+		if err != nil {
+			fail(i, err)
+			continue
+		}
+		if apt.CalendarID != "" {
+			if calendars == nil {
+				if calendars, err = h.calendarIDs(ctx, userID); err != nil {
+					return nil, err
+				}
+			}
+			if !calendars[apt.CalendarID] {
+				fail(i, apperr.New(apperr.CalendarNotFound, "calendar not found"))
+				continue
+			}
+		}
+		if err := h.checkResourceID(apt.ResourceID); err != nil {
+			fail(i, err)
+			continue
+		}
+		err = h.checkFreeze(ctx, apt.StartTime, apt.EndTime)
+		if err == nil && !apt.AllDay {
+			err = h.checkAvailability(ctx, userID, apt.StartTime, apt.EndTime)
+		}
+		if r := apperr.ReasonOf(err); r == apperr.ApptFrozen || r == apperr.ApptUnavailable {
+			fail(i, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		apts[i] = apt
+	}
+
+	// overlaps within the batch — first entry wins, later ones are rejected
+	buf, err := h.buffer(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	for i := range apts {
+		for j := 0; j < i && apts[i] != nil; j++ {
+			if apts[j] == nil || apts[j].AllDay != apts[i].AllDay {
+				// all-day events and timed ones are never in each other's way
+				continue
+			}
+			if apts[i].AllDay && !h.store.AllDayConflicts() {
+				continue
+			}
+			if apts[j].StartTime.Before(apts[i].EndTime) && apts[j].EndTime.After(apts[i].StartTime) {
+				fail(i, apperr.Newf(apperr.ApptConflict, "time conflicts with entry %d", j))
+			} else if !apts[i].AllDay && apts[j].StartTime.Before(apts[i].EndTime.Add(buf)) && apts[j].EndTime.Add(buf).After(apts[i].StartTime) {
+				fail(i, apperr.New(apperr.ApptBuffer, bufferMessage(buf, fmt.Sprintf("entry %d", j))))
+			}
+		}
+	}
+
+	// overlaps against existing appointments
+	for i, apt := range apts {
+		if apt == nil {
+			continue
+		}
+		if dup, err := h.store.HasOverlap(ctx, userID, apt.StartTime, apt.EndTime, apt.AllDay, ""); err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		} else if dup {
+			fail(i, apperr.New(apperr.ApptConflict, "time conflicts with existing appointment"))
+			continue
+		}
+		if !apt.AllDay {
+			if err := h.checkBuffer(ctx, userID, "", apt.StartTime, apt.EndTime); apperr.ReasonOf(err) == apperr.ApptBuffer {
+				fail(i, err)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if apt.ResourceID == "" {
+			continue
+		}
+		// entries sharing a resource already failed above: they're the same user's
+		if err := h.store.CheckResource(ctx, apt.ResourceID, apt.StartTime, apt.EndTime, ""); resourceErr(err) != nil {
+			fail(i, resourceErr(err))
+		} else if err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(a, b int) bool { return errs[a].Index < errs[b].Index })
+		return &pb.BatchCreateAppointmentsResponse{Errors: errs}, nil
+	}
+
+	for _, apt := range apts {
+		if !apt.AllDay {
+			apt.Buffer = buf
+		}
+	}
+	if err := h.store.CreateAppointments(ctx, apts); errors.Is(err, store.ErrConflict) {
+		// something was booked since the checks above
+		return nil, apperr.New(apperr.ApptConflict, "time conflicts with existing appointment")
+	} else if errors.Is(err, store.ErrBuffer) {
+		return nil, apperr.New(apperr.ApptBuffer, bufferMessage(buf, "another appointment"))
+	} else if errors.Is(err, store.ErrUnknownCalendar) {
+		// or a calendar deleted
+		return nil, apperr.New(apperr.CalendarNotFound, "calendar not found")
+	} else if rerr := resourceErr(err); rerr != nil {
+		return nil, rerr
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, userID)
+
+	out := make([]*pb.Appointment, len(apts))
+	for i := range apts {
+		out[i] = toProto(apts[i])
+	}
+	return &pb.BatchCreateAppointmentsResponse{Appointments: out}, nil
+}
+
+// max page_size a client can ask for
+const maxPageSize = 500
+
 func (h *Handler) ListAppointments(ctx context.Context, req *pb.ListAppointmentsRequest) (*pb.ListAppointmentsResponse, error) {
-	userID := uid(ctx)
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	me := userID
+	if req.UserId != "" && req.UserId != userID {
+		actor, err := h.requireAdmin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := uuid.Parse(req.UserId); err != nil {
+			return nil, validate.Field("user_id", i18n.UUID)
+		}
+		userID = req.UserId
+		h.adminAudit(ctx, actor, "ListAppointments", map[string]any{"user_id": userID})
+	}
+
+	from, to, err := h.listRange(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.PageSize < 0 || req.PageSize > maxPageSize {
+		return nil, validate.Field("page_size", i18n.Between, 0, maxPageSize)
+	}
+	if req.CalendarId != "" {
+		if err := h.require(store.FeatureCalendars); err != nil {
+			return nil, err
+		}
+	}
+	statuses, err := listStatuses(req.Statuses)
+	if err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	tags := normalizeTags(&v, "tags", req.Tags)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		if err := h.require(store.FeatureTags); err != nil {
+			return nil, err
+		}
+	}
+	p := store.ListParams{From: from, To: to, CalendarID: req.CalendarId, Statuses: statuses, Tags: tags, Now: h.now()}
+	if req.PageToken != "" {
+		if p.AfterStart, p.AfterID, err = decodePageToken(req.PageToken); err != nil {
+			return nil, apperr.New(apperr.BadPageToken, "bad page_token")
+		}
+	}
+	if req.PageSize > 0 {
+		// one extra row tells us whether there is another page
+		p.Limit = int(req.PageSize) + 1
+	}
+
+	if h.listCache == nil {
+		return h.listPage(ctx, userID, me, req, p, from, to)
+	}
+	minVersion := req.MinVersion
+	if minVersion == 0 {
+		minVersion = versionFromMetadata(ctx)
+	}
+	// the request as sent, so a window defaulted from now is one entry
+	// until it expires; min_version only says how fresh it has to be
+	keyReq := proto.Clone(req).(*pb.ListAppointmentsRequest)
+	keyReq.MinVersion = 0
+	key, err := proto.MarshalOptions{Deterministic: true}.Marshal(keyReq)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	load := func(ctx context.Context) (*pb.ListAppointmentsResponse, error) {
+		return h.listPage(ctx, userID, me, req, p, from, to)
+	}
+	resp, err := h.listCache.Get(ctx, userID, me+"\x00"+string(key), load)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ScheduleVersion < minVersion {
+		// cached before the caller's write, most likely by another
+		// instance's write not reaching this one's cache: drop it and read
+		// again, past the cache if a load already under way is as old
+		h.listCache.Invalidate(userID)
+		if resp, err = h.listCache.Get(ctx, userID, me+"\x00"+string(key), load); err != nil {
+			return nil, err
+		}
+		if resp.ScheduleVersion < minVersion {
+			return h.listPage(ctx, userID, me, req, p, from, to)
+		}
+	}
+	return proto.Clone(resp).(*pb.ListAppointmentsResponse), nil
+}
+
+// versionFromMetadata is the x-schedule-version a call carries, 0 if none
+// or not a number.
+func versionFromMetadata(ctx context.Context) int64 {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(ScheduleVersionKey)
+	if len(v) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(v[0], 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// listPage reads one page of userID's appointments as seen by me, and
+// the schedule version it was read at.
+func (h *Handler) listPage(ctx context.Context, userID, me string, req *pb.ListAppointmentsRequest, p store.ListParams, from, to time.Time) (*pb.ListAppointmentsResponse, error) {
+	// read first: a write landing before the list is then in it, and one
+	// landing after only makes the version look older than the page is
+	var version int64
+	if h.store.Has(store.FeatureScheduleVersion) {
+		v, err := h.store.ScheduleVersion(ctx, userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+		version = v
+	}
+	apts, err := h.store.ListAppointments(ctx, userID, p)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	resp := &pb.ListAppointmentsResponse{
+		EffectiveRangeStart: timestamppb.New(from),
+		EffectiveRangeEnd:   timestamppb.New(to),
+		ScheduleVersion:     version,
+	}
+	if req.IncludeTotal {
+		n, err := h.store.CountAppointments(ctx, userID, p)
+		if err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+		resp.TotalSize = int32(n)
+	}
+	if resp.Appointments, resp.NextPageToken, resp.Truncated, err = h.page(ctx, apts, req.PageSize, me); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// page is apts as me sees them, cut to pageSize (apts has one more if
+// there's another page) and to the response size cap, with the token of
+// the page after it if any and whether the cap was what cut it.
+func (h *Handler) page(ctx context.Context, apts []model.Appointment, pageSize int32, me string) ([]*pb.Appointment, string, bool, error) {
+	more := pageSize > 0 && len(apts) > int(pageSize)
+	if more {
+		apts = apts[:pageSize]
+	}
+
+	page := make([]*model.Appointment, len(apts))
+	for i := range apts {
+		page[i] = &apts[i]
+	}
+	users, err := h.people(ctx, page...)
+	if err != nil {
+		return nil, "", false, apperr.New(apperr.Internal, "internal error")
+	}
+
+	// size guard: stop at the last whole appointment that fits under the cap.
+	// always return at least one so a huge single row can't stall paging.
+	var out []*pb.Appointment
+	size, truncated := 0, false
+	for i := range apts {
+		a := withPeople(&apts[i], users, me)
+		n := protowire.SizeTag(1) + protowire.SizeBytes(proto.Size(a))
+		if size+n > h.maxListBytes && len(out) > 0 {
+			truncated = true
+			more = true
+			break
+		}
+		size += n
+		out = append(out, a)
+	}
+
+	var next string
+	if more {
+		last := apts[len(out)-1]
+		next = encodePageToken(last.StartTime, last.ID)
+	}
+	return out, next, truncated, nil
+}
+
+// ScheduleVersionKey is the metadata a write to the caller's own
+// appointments answers with their new schedule version in, and that
+// ListAppointments takes as min_version.
+const ScheduleVersionKey = "x-schedule-version"
+
+// listChanged bumps userID's schedule version after a write and drops
+// their cached ListAppointments pages. The caller is told the new version
+// when the appointments were their own.
+func (h *Handler) listChanged(ctx context.Context, userID string) {
+	if h.store.Has(store.FeatureScheduleVersion) {
+		v, err := h.store.BumpScheduleVersion(ctx, userID)
+		if err != nil {
+			log.Printf("schedule version bump for %s: %v", userID, err)
+		} else if me, _ := uid(ctx); me == userID {
+			// not in a grpc call (a test calling the handler) is fine
+			_ = grpc.SetHeader(ctx, metadata.Pairs(ScheduleVersionKey, strconv.FormatInt(v, 10)))
+		}
+	}
+	if h.listCache != nil {
+		h.listCache.Invalidate(userID)
+	}
+}
+
+const (
+	defaultUpcoming = 5
+	maxUpcoming     = 20
+)
+
+// ListUpcomingAppointments answers "what's next" without a range: the
+// caller's confirmed appointments that haven't ended, soonest first, with
+// the ones already started flagged.
+func (h *Handler) ListUpcomingAppointments(ctx context.Context, req *pb.ListUpcomingAppointmentsRequest) (*pb.ListUpcomingAppointmentsResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n := int(req.Limit)
+	switch {
+	case n == 0:
+		n = defaultUpcoming
+	case n < 0 || n > maxUpcoming:
+		return nil, validate.Field("limit", i18n.Between, 0, maxUpcoming)
+	}
+
+	now := h.now()
+	apts, err := h.store.UpcomingAppointments(ctx, userID, now, n)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	page := make([]*model.Appointment, len(apts))
+	for i := range apts {
+		page[i] = &apts[i]
+	}
+	users, err := h.people(ctx, page...)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListUpcomingAppointmentsResponse{}
+	for i := range apts {
+		resp.Appointments = append(resp.Appointments, &pb.UpcomingAppointment{
+			Appointment: withPeople(&apts[i], users, userID),
+			InProgress:  !apts[i].StartTime.After(now),
+		})
+	}
+	return resp, nil
+}
 
-	from := time.Now().AddDate(0, 0, -30)
-	to := time.Now().AddDate(0, 2, 0)
+// listStatuses turns the request's status filter into the store's.
+// "completed" isn't stored: it's a confirmed appointment that has ended,
+// so asking for "confirmed" as well makes it redundant.
+func listStatuses(in []string) ([]string, error) {
+	var out []string
+	for _, st := range in {
+		switch st {
+		case "all":
+			st = "confirmed"
+			out = append(out, "cancelled")
+		case "confirmed", "cancelled", "completed":
+		default:
+			return nil, validate.Field("statuses", i18n.UnknownStatus, st)
+		}
+		out = append(out, st)
+	}
+	if slices.Contains(out, "confirmed") {
+		out = slices.DeleteFunc(out, func(st string) bool { return st == "completed" })
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// listRange resolves the queried window. Explicit bounds win; horizon_days
+// counts from range_start (or now) and can't be mixed with range_end;
+// anything still unset falls back to the server default window.
+func (h *Handler) listRange(req *pb.ListAppointmentsRequest) (time.Time, time.Time, error) {
+	now := h.now()
+	from := now.Add(-h.listPast)
+	to := now.Add(h.listFuture)
+
+	if req.HorizonDays < 0 || int(req.HorizonDays) > h.maxHorizon {
+		return from, to, apperr.Newf(apperr.ListRangeInvalid, "horizon_days must be between 0 and %d", h.maxHorizon)
+	}
+	if req.HorizonDays > 0 && req.RangeEnd != nil {
+		return from, to, apperr.New(apperr.ListRangeInvalid, "horizon_days and range_end are mutually exclusive")
+	}
 
 	if req.RangeStart != nil {
 		from = req.RangeStart.AsTime()
@@ -77,89 +951,361 @@ func (h *Handler) ListAppointments(ctx context.Context, req *pb.ListAppointments
 	if req.RangeEnd != nil {
 		to = req.RangeEnd.AsTime()
 	}
+	if req.HorizonDays > 0 {
+		if req.RangeStart == nil {
+			from = now
+		}
+		to = from.AddDate(0, 0, int(req.HorizonDays))
+	}
+	if !to.After(from) {
+		return from, to, apperr.New(apperr.ListRangeInvalid, "range_end must be after range_start")
+	}
+	return from, to, nil
+}
+
+// page tokens are opaque to clients: base64("<start RFC3339Nano>|<id>")
+func encodePageToken(start time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(start.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
 
-	apts, err := h.store.ListAppointments(ctx, userID, from, to)
+func decodePageToken(tok string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(tok)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return time.Time{}, "", err
 	}
-
-	out := make([]*pb.Appointment, len(apts))
-	for i := range apts {
-		out[i] = toProto(&apts[i])
+	ts, id, ok := strings.Cut(string(b), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", errors.New("malformed page token")
 	}
-	return &pb.ListAppointmentsResponse{Appointments: out}, nil
+	start, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return start, id, nil
 }
 
 func (h *Handler) GetAppointment(ctx context.Context, req *pb.GetAppointmentRequest) (*pb.GetAppointmentResponse, error) {
+	me, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id required")
+		return nil, validate.Field("id", i18n.Required)
 	}
 
 	apt, err := h.store.GetAppointment(ctx, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "not found")
+		return nil, apperr.New(apperr.NotFound, "not found")
 	}
 
 	// ownership — return 404 not 403 to hide existence
-	if apt.UserID != uid(ctx) {
-		return nil, status.Error(codes.NotFound, "not found")
+	if apt.UserID != me {
+		if !h.isAdmin(ctx) {
+			return nil, apperr.New(apperr.NotFound, "not found")
+		}
+		h.adminAudit(ctx, me, "GetAppointment", map[string]any{"id": apt.ID, "owner": apt.UserID})
 	}
 
-	return &pb.GetAppointmentResponse{Appointment: toProto(apt)}, nil
+	users, err := h.people(ctx, apt)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.GetAppointmentResponse{Appointment: withPeople(apt, users, me)}, nil
 }
 
 func (h *Handler) UpdateAppointment(ctx context.Context, req *pb.UpdateAppointmentRequest) (*pb.UpdateAppointmentResponse, error) {
-	userID := uid(ctx)
-
-	if req.Id == "" || req.Title == "" {
-		return nil, status.Error(codes.InvalidArgument, "id and title required")
+	var v validate.Errors
+	v.Required("id", req.Id)
+	fields := updateFields(&v, req.UpdateMask)
+	title, description, location := h.cleanText(req.Title), h.cleanText(req.Description), h.cleanText(req.Location)
+	h.checkAppointmentFields(&v, fields, title, description, location, req.StartTime, req.EndTime)
+	var tags []string
+	if fields.has("tags") {
+		tags = normalizeTags(&v, "tags", req.Tags)
 	}
-	if req.StartTime == nil || req.EndTime == nil {
-		return nil, status.Error(codes.InvalidArgument, "times required")
+	if fields.has("capacity") {
+		checkCapacity(&v, req.Capacity)
+	}
+	if fields.has("time_zone") {
+		timeZone(&v, "time_zone", req.TimeZone)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
-
 	start := req.StartTime.AsTime()
 	end := req.EndTime.AsTime()
-	if !end.After(start) {
-		return nil, status.Error(codes.InvalidArgument, "end must be after start")
+	if len(req.AttendeeIds) > 0 && fields.has("attendee_ids") {
+		if err := h.require(store.FeatureAttendees); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.checkCalendarID(req.CalendarId); err != nil {
+		return nil, err
+	}
+	if err := h.checkResourceID(req.ResourceId); err != nil {
+		return nil, err
+	}
+	if fields != nil && fields.has("resource_id") {
+		// clearing one needs the column too
+		if err := h.require(store.FeatureResources); err != nil {
+			return nil, err
+		}
+	}
+	if len(tags) > 0 || (fields != nil && fields.has("tags")) {
+		if err := h.require(store.FeatureTags); err != nil {
+			return nil, err
+		}
+	}
+	if req.Capacity > 0 || (fields != nil && fields.has("capacity")) {
+		if err := h.require(store.FeatureCapacity); err != nil {
+			return nil, err
+		}
+	}
+	if req.AllDay || req.TimeZone != "" || (fields != nil && (fields.has("all_day") || fields.has("time_zone"))) {
+		if err := h.require(store.FeatureAllDay); err != nil {
+			return nil, err
+		}
+	}
+	userID, err := h.ownerFor(ctx, req.Id, "UpdateAppointment")
+	if err != nil {
+		return nil, err
+	}
+
+	// the appointment as it is, read once if the checks below need it
+	var old *model.Appointment
+	stored := func() (*model.Appointment, error) {
+		if old != nil {
+			return old, nil
+		}
+		a, err := h.store.GetAppointment(ctx, req.Id)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && a.UserID != userID) {
+			return nil, apperr.New(apperr.NotFound, "not found")
+		} else if err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+		old = a
+		return old, nil
 	}
 
-	// exclude self from overlap check
-	if dup, err := h.store.HasOverlap(ctx, userID, start, end, req.Id); err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
-	} else if dup {
-		return nil, status.Error(codes.AlreadyExists, "time conflicts with existing appointment")
+	// a change to the times or to all_day is checked as the appointment
+	// it makes: what the mask leaves out stays as stored
+	allDay, zone := req.AllDay, req.TimeZone
+	moving := fields.has("start_time") || fields.has("end_time") || fields.has("all_day")
+	if moving || fields.has("time_zone") {
+		if !fields.has("start_time") || !fields.has("end_time") || !fields.has("all_day") || !fields.has("time_zone") {
+			cur, err := stored()
+			if err != nil {
+				return nil, err
+			}
+			if !fields.has("start_time") {
+				start = cur.StartTime
+			}
+			if !fields.has("end_time") {
+				end = cur.EndTime
+			}
+			if !fields.has("all_day") {
+				allDay = cur.AllDay
+			}
+			if !fields.has("time_zone") {
+				zone = cur.TimeZone
+			}
+		}
+		if !end.After(start) {
+			return nil, emptyRange()
+		}
+		if allDay {
+			checkAllDay(&v, dayZone(zone), start, end)
+			if err := v.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if moving {
+		err := h.checkFreeze(ctx, start, end)
+		// an all-day event takes none of the owner's time
+		if err == nil && !allDay {
+			err = h.checkAvailability(ctx, userID, start, end)
+		}
+		if r := apperr.ReasonOf(err); r == apperr.ApptFrozen || r == apperr.ApptUnavailable {
+			// edits that keep the times are fine, only moves into a freeze
+			// or out of the owner's hours aren't
+			cur, gerr := stored()
+			if gerr != nil {
+				return nil, gerr
+			}
+			if !cur.StartTime.Equal(start) || !cur.EndTime.Equal(end) || cur.AllDay != allDay {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	// the store holds a move to it, in the update's transaction
+	var buf time.Duration
+	if moving && !allDay {
+		if buf, err = h.buffer(ctx, userID); err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
 	}
 
 	apt := &model.Appointment{
 		ID:          req.Id,
-		Title:       req.Title,
-		Description: req.Description,
+		Title:       title,
+		Description: description,
 		StartTime:   start,
 		EndTime:     end,
 		UserID:      userID,
-		Location:    req.Location,
+		Location:    location,
 		AttendeeIDs: req.AttendeeIds,
+		CalendarID:  req.CalendarId,
+		ResourceID:  req.ResourceId,
+		Tags:        tags,
+		Capacity:    int(req.Capacity),
+		AllDay:      req.AllDay,
+		TimeZone:    req.TimeZone,
+		Buffer:      buf,
 	}
 
-	if err := h.store.UpdateAppointment(ctx, apt); err != nil {
-		return nil, status.Error(codes.AlreadyExists, "time conflicts with existing appointment")
+	// the store merges in the fields left out, then checks overlaps
+	// (excluding this appointment) and the buffer in the same transaction
+	// as the update
+	if err := h.store.UpdateAppointment(ctx, apt, fields); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	} else if errors.Is(err, store.ErrConflict) {
+		h.metrics.Conflict()
+		return nil, h.rescheduleConflict(ctx, userID, req.Id, slots.Interval{Start: apt.StartTime, End: apt.EndTime}, apt.AllDay)
+	} else if errors.Is(err, store.ErrBuffer) {
+		return nil, h.bufferConflict(ctx, userID, req.Id, apt.StartTime, apt.EndTime, buf)
+	} else if errors.Is(err, store.ErrEmptyRange) {
+		// the other end moved since the check above
+		return nil, emptyRange()
+	} else if errors.Is(err, store.ErrUnknownCalendar) {
+		return nil, apperr.New(apperr.CalendarNotFound, "calendar not found")
+	} else if errors.Is(err, store.ErrFull) {
+		return nil, apperr.New(apperr.ApptFull, "more attendees than capacity")
+	} else if rerr := resourceErr(err); rerr != nil {
+		return nil, rerr
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
 	}
+	h.listChanged(ctx, userID)
 
 	return &pb.UpdateAppointmentResponse{Appointment: toProto(apt)}, nil
 }
 
+func emptyRange() error {
+	var v validate.Errors
+	v.AddReason(apperr.ApptEmptyRange, "end_time", i18n.After, "start_time")
+	return v.Err()
+}
+
 func (h *Handler) DeleteAppointment(ctx context.Context, req *pb.DeleteAppointmentRequest) (*pb.DeleteAppointmentResponse, error) {
 	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id required")
+		return nil, validate.Field("id", i18n.Required)
 	}
 
-	if err := h.store.DeleteAppointment(ctx, req.Id, uid(ctx)); err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+	owner, err := h.ownerFor(ctx, req.Id, "DeleteAppointment")
+	if apperr.ReasonOf(err) == apperr.NotFound {
+		// deleting what isn't there is a no-op, as it is for owners
+		return &pb.DeleteAppointmentResponse{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if done, err := h.cancelForOrg(ctx, req.Id, owner); err != nil {
+		return nil, err
+	} else if done {
+		return &pb.DeleteAppointmentResponse{}, nil
 	}
+	if err := h.store.DeleteAppointment(ctx, req.Id, owner); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, owner)
 	return &pb.DeleteAppointmentResponse{}, nil
 }
 
+// ownerFor is whose appointment id the caller gets to change: their own,
+// or for an admin whoever holds it, in which case the change is audited
+// as action. The store enforces ownership for everyone else.
+func (h *Handler) ownerFor(ctx context.Context, id, action string) (string, error) {
+	me, err := uid(ctx)
+	if err != nil || !h.isAdmin(ctx) {
+		return me, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", apperr.New(apperr.NotFound, "not found")
+	}
+	apt, err := h.store.GetAppointment(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", apperr.New(apperr.NotFound, "not found")
+	} else if err != nil {
+		return "", apperr.New(apperr.Internal, "internal error")
+	}
+	if apt.UserID != me {
+		h.adminAudit(ctx, me, action, map[string]any{"id": id, "owner": apt.UserID})
+	}
+	return apt.UserID, nil
+}
+
+// RestoreAppointment undoes DeleteAppointment. The slot may have been booked
+// since, so it goes through ActivateAppointment like any other reactivation.
+func (h *Handler) RestoreAppointment(ctx context.Context, req *pb.RestoreAppointmentRequest) (*pb.RestoreAppointmentResponse, error) {
+	if req.Id == "" {
+		return nil, validate.Field("id", i18n.Required)
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apt, err := h.store.ActivateAppointment(ctx, req.Id, userID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, apperr.New(apperr.NotFound, "not found")
+	case errors.Is(err, store.ErrConflict):
+		h.metrics.Conflict()
+		return nil, apperr.New(apperr.ApptConflict, "time conflicts with existing appointment")
+	case resourceErr(err) != nil:
+		return nil, resourceErr(err)
+	case err != nil:
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, userID)
+	return &pb.RestoreAppointmentResponse{Appointment: toProto(apt)}, nil
+}
+
+// people looks up the owners and attendees of apts in one query.
+func (h *Handler) people(ctx context.Context, apts ...*model.Appointment) (map[string]model.User, error) {
+	var ids []string
+	for _, a := range apts {
+		ids = append(ids, a.UserID)
+		ids = append(ids, a.AttendeeIDs...)
+	}
+	slices.Sort(ids)
+	return h.store.UsersByIDs(ctx, slices.Compact(ids))
+}
+
+// withPeople is toProto plus the owner's name and the attendees from
+// users. Emails are only shown to the owner.
+func withPeople(a *model.Appointment, users map[string]model.User, viewer string) *pb.Appointment {
+	p := toProto(a)
+	p.OwnerName = users[a.UserID].Name
+	for _, id := range a.AttendeeIDs {
+		person := &pb.Person{Id: id}
+		if u, ok := users[id]; ok {
+			person.Name = u.Name
+			if viewer == a.UserID {
+				person.Email = u.Email
+			}
+		}
+		p.Attendees = append(p.Attendees, person)
+	}
+	return p
+}
+
 func toProto(a *model.Appointment) *pb.Appointment {
 	p := &pb.Appointment{
 		Id:          a.ID,
@@ -169,6 +1315,19 @@ func toProto(a *model.Appointment) *pb.Appointment {
 		Status:      a.Status,
 		Location:    a.Location,
 		AttendeeIds: a.AttendeeIDs,
+		CalendarId:  a.CalendarID,
+		ResourceId:  a.ResourceID,
+		Tags:        a.Tags,
+		Capacity:    int32(a.Capacity),
+
+		AttendeeCount:   int32(len(a.AttendeeIDs)),
+		RescheduleCount: int32(a.RescheduleCount),
+		AllDay:          a.AllDay,
+		TimeZone:        a.TimeZone,
+		OrgId:           a.OrgID,
+	}
+	if a.Capacity > len(a.AttendeeIDs) {
+		p.SpotsLeft = int32(a.Capacity - len(a.AttendeeIDs))
 	}
 	if !a.StartTime.IsZero() {
 		p.StartTime = timestamppb.New(a.StartTime)
@@ -2,27 +2,86 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
 
 	"github.com/google/uuid"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
 	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/i18n"
 	"schedule-management-api/internal/model"
-	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
 )
 
+const minPasswordLen = 8
+
+// bcrypt refuses longer input
+const maxPasswordBytes = 72
+
+// matches users.email VARCHAR(255)
+const maxEmailLen = 255
+
+// checked in place of a password hash when the email has no account, so
+// an unknown email costs the same bcrypt run as a known one
+const noUserHash = "$2a$10$e2mcp0H36luNxYme55KYL.e2yRK5r7JQj18ZOn7KzHC1t0UcdM2pm"
+
+// checkNewPassword vets a password that's about to be hashed and stored.
+func checkNewPassword(v *validate.Errors, field, pw string) {
+	switch {
+	case !v.Required(field, pw):
+	case len(pw) < minPasswordLen:
+		v.AddReason(apperr.AuthPasswordTooShort, field, i18n.MinChars, minPasswordLen)
+	case len(pw) > maxPasswordBytes:
+		v.Add(field, i18n.MaxBytes, maxPasswordBytes)
+	}
+}
+
+// how long an emailed reset token stays valid
+const resetTokenTTL = 30 * time.Minute
+
+// how long an emailed verification code stays valid, and how often one
+// account can be sent a new one
+const (
+	verifyTokenTTL     = 24 * time.Hour
+	verifyResendPeriod = time.Minute
+)
+
+// maps bcrypt pool failures: a full queue sheds load, an expired deadline
+// while queued is reported as such rather than as an internal error
+func hashErr(err error) error {
+	if errors.Is(err, auth.ErrBusy) {
+		return apperr.New(apperr.ServerBusy, "server busy, try again")
+	}
+	if cerr := apperr.FromContext(err); cerr != nil {
+		return cerr
+	}
+	return apperr.New(apperr.Internal, "internal error")
+}
+
 func (h *Handler) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	if req.Email == "" || req.Password == "" || req.Name == "" {
-		return nil, status.Error(codes.InvalidArgument, "all fields required")
+	var v validate.Errors
+	if v.Required("email", req.Email) {
+		v.Email("email", req.Email)
+		v.MaxLen("email", req.Email, maxEmailLen)
+	}
+	checkNewPassword(&v, "password", req.Password)
+	if v.Required("name", req.Name) {
+		v.MaxLen("name", req.Name, maxNameLen)
 	}
-	if len(req.Password) < 8 {
-		return nil, status.Error(codes.InvalidArgument, "password too short")
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 
-	hash, err := auth.HashPassword(req.Password)
+	hash, err := h.hasher.HashPassword(ctx, req.Password)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, hashErr(err)
 	}
 
 	u := &model.User{
@@ -34,35 +93,403 @@ func (h *Handler) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Re
 
 	if err := h.store.CreateUser(ctx, u); err != nil {
 		// unique violation = dup email, but don't reveal that
-		return nil, status.Error(codes.AlreadyExists, "registration failed")
+		return nil, apperr.New(apperr.AuthRegistrationFailed, "registration failed")
 	}
 
-	tok, err := auth.MakeToken(u.ID, h.secret)
+	u.Role = auth.RoleUser
+	u.Verified = !h.store.Has(store.FeatureEmailVerify)
+	if !u.Verified {
+		// the account exists either way; a code that didn't go out can be
+		// asked for again with ResendVerification
+		if err := h.sendVerification(ctx, u); err != nil {
+			log.Printf("verification email for %s: %v", u.ID, err)
+		}
+		if h.requireVerified {
+			return &pb.RegisterResponse{UserId: u.ID}, nil
+		}
+	}
+
+	tp, err := h.issueTokens(ctx, u)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, apperr.New(apperr.Internal, "internal error")
 	}
 
-	return &pb.RegisterResponse{UserId: u.ID, Token: tok}, nil
+	return &pb.RegisterResponse{
+		UserId: u.ID, Token: tp.access, RefreshToken: tp.refresh,
+		AccessExpiresAt: timestamppb.New(tp.accessExp), RefreshExpiresAt: timestamppb.New(tp.refreshExp),
+		EmailVerified: u.Verified,
+	}, nil
 }
 
 func (h *Handler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	if req.Email == "" || req.Password == "" {
-		return nil, status.Error(codes.InvalidArgument, "email and password required")
+	var v validate.Errors
+	if v.Required("email", req.Email) {
+		v.MaxLen("email", req.Email, maxEmailLen)
+	}
+	v.Required("password", req.Password)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	lockout := h.store.Has(store.FeatureLoginLockout)
+	var locked bool
+	if lockout {
+		until, err := h.store.LoginLockedUntil(ctx, req.Email)
+		if err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+		locked = !until.IsZero()
+	}
+
+	u, err := h.store.UserByEmail(ctx, req.Email)
+	if err != nil {
+		if _, err := h.hasher.CheckPassword(ctx, noUserHash, req.Password); err != nil {
+			return nil, hashErr(err)
+		}
+		return nil, h.loginFailed(ctx, req.Email, lockout, locked)
+	}
+
+	// the hash is checked even while locked, so a locked account doesn't
+	// answer faster than a live one (or an unknown email)
+	if ok, err := h.hasher.CheckPassword(ctx, u.PasswordHash, req.Password); err != nil {
+		return nil, hashErr(err)
+	} else if !ok || locked {
+		return nil, h.loginFailed(ctx, req.Email, lockout, locked)
+	}
+	if lockout {
+		if err := h.store.ResetLoginFailures(ctx, req.Email); err != nil {
+			return nil, apperr.New(apperr.Internal, "internal error")
+		}
+	}
+	// only after the password matched, so this doesn't leak deleted emails
+	if u.DeletedAt != nil {
+		return nil, apperr.New(apperr.AuthAccountDeleted, "account deleted")
+	}
+	if h.requireVerified && !u.Verified {
+		return nil, apperr.New(apperr.AuthEmailUnverified, "email not verified")
+	}
+
+	tp, err := h.issueTokens(ctx, u)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	return &pb.LoginResponse{
+		Token: tp.access, UserId: u.ID, Name: u.Name, RefreshToken: tp.refresh,
+		AccessExpiresAt: timestamppb.New(tp.accessExp), RefreshExpiresAt: timestamppb.New(tp.refreshExp),
+		EmailVerified: u.Verified,
+	}, nil
+}
+
+// loginFailed counts a failed login against email and picks the error.
+// Unknown emails count too, so being locked out says nothing about
+// whether the account exists. Attempts during a lockout don't extend it.
+func (h *Handler) loginFailed(ctx context.Context, email string, lockout, locked bool) error {
+	if locked {
+		return apperr.New(apperr.AuthLocked, "too many failed logins; try again later")
+	}
+	if lockout {
+		until, err := h.store.RecordLoginFailure(ctx, email, h.maxFailures, h.lockout)
+		if err != nil {
+			return apperr.New(apperr.Internal, "internal error")
+		}
+		if !until.IsZero() {
+			return apperr.New(apperr.AuthLocked, "too many failed logins; try again later")
+		}
+	}
+	return apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+}
+
+type tokenPair struct {
+	access, refresh       string
+	accessExp, refreshExp time.Time
+}
+
+// issueTokens starts a session for u: a fresh refresh token row plus an
+// access token carrying u's role.
+func (h *Handler) issueTokens(ctx context.Context, u *model.User) (tokenPair, error) {
+	raw, hash, err := h.authCfg.GenerateRefreshToken()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	tp := tokenPair{refresh: raw, refreshExp: h.now().Add(h.authCfg.RefreshTokenTTL())}
+	sid, err := h.store.CreateRefreshToken(ctx, u.ID, hash, tp.refreshExp, sessionClient(ctx))
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if tp.access, tp.accessExp, err = h.authCfg.MakeSessionToken(u.ID, u.Role, sid, h.keys); err != nil {
+		return tokenPair{}, err
+	}
+	return tp, nil
+}
+
+// Refresh trades a refresh token for a new pair. Each refresh token works
+// once: presenting one that was already rotated means it leaked (or the
+// client replayed it), so every session of that user is revoked.
+func (h *Handler) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, validate.Field("refresh_token", i18n.Required)
+	}
+	invalid := apperr.New(apperr.AuthRefreshInvalid, "invalid refresh token")
+
+	rt, err := h.store.FindRefreshToken(ctx, h.authCfg.RefreshHashCandidates(req.RefreshToken))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, invalid
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if rt.Revoked {
+		if rt.ReplacedBy != nil {
+			log.Printf("refresh token reuse for %s, revoking all sessions", rt.UserID)
+			if err := h.store.RevokeAllRefreshTokens(ctx, rt.UserID); err != nil {
+				return nil, apperr.New(apperr.Internal, "internal error")
+			}
+		}
+		return nil, invalid
+	}
+	if !rt.ExpiresAt.After(h.now()) {
+		return nil, invalid
+	}
+	u, err := h.store.UserByID(ctx, rt.UserID)
+	if err != nil || u.DeletedAt != nil {
+		return nil, invalid
+	}
+
+	raw, hash, err := h.authCfg.GenerateRefreshToken()
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	refreshExp := h.now().Add(h.authCfg.RefreshTokenTTL())
+	// lost a race with another refresh of the same token
+	sid := uuid.New().String()
+	if err := h.store.RotateRefreshToken(ctx, rt.ID, sid, u.ID, hash, refreshExp, sessionClient(ctx)); errors.Is(err, pgx.ErrNoRows) {
+		return nil, invalid
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	access, accessExp, err := h.authCfg.MakeSessionToken(u.ID, u.Role, sid, h.keys)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.RefreshResponse{
+		Token: access, RefreshToken: raw,
+		AccessExpiresAt: timestamppb.New(accessExp), RefreshExpiresAt: timestamppb.New(refreshExp),
+	}, nil
+}
+
+// RequestPasswordReset always succeeds so callers can't probe which emails
+// are registered. The raw token only ever leaves through the sender.
+func (h *Handler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if req.Email == "" {
+		return nil, validate.Field("email", i18n.Required)
+	}
+	if err := h.require(store.FeaturePasswordReset); err != nil {
+		return nil, err
 	}
 
 	u, err := h.store.UserByEmail(ctx, req.Email)
+	if err != nil || u.DeletedAt != nil {
+		return &pb.RequestPasswordResetResponse{}, nil
+	}
+
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if err := h.store.CreatePasswordResetToken(ctx, u.ID, hash, h.now().Add(resetTokenTTL)); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	if h.sender == nil {
+		log.Printf("password reset requested for %s but no sender configured", u.ID)
+		return &pb.RequestPasswordResetResponse{}, nil
+	}
+	body := fmt.Sprintf("Hi %s,\n\nUse this code to reset your password: %s\n\nIt expires in %d minutes. If you didn't ask for this, ignore this email.\n",
+		u.Name, raw, int(resetTokenTTL.Minutes()))
+	if err := h.sender.Send(ctx, u.Email, "Reset your password", body); err != nil {
+		// don't surface delivery failures, same response either way
+		log.Printf("password reset send failed for %s: %v", u.ID, err)
+	}
+	return &pb.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword is single-use: the token is consumed before the password
+// changes, and every refresh token for the user is revoked afterwards.
+func (h *Handler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	var v validate.Errors
+	v.Required("token", req.Token)
+	checkNewPassword(&v, "new_password", req.NewPassword)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeaturePasswordReset); err != nil {
+		return nil, err
+	}
+
+	hash, err := h.hasher.HashPassword(ctx, req.NewPassword)
+	if err != nil {
+		return nil, hashErr(err)
+	}
+
+	userID, err := h.store.ConsumePasswordResetToken(ctx, auth.HashToken(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.AuthResetTokenInvalid, "invalid or expired reset token")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	if err := h.store.UpdatePassword(ctx, userID, hash); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if err := h.store.RevokeAllRefreshTokens(ctx, userID); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+// sendVerification mails u a new verification code, voiding the last one.
+func (h *Handler) sendVerification(ctx context.Context, u *model.User) error {
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+	if err := h.store.CreateEmailVerificationToken(ctx, u.ID, hash, h.now().Add(verifyTokenTTL)); err != nil {
+		return err
+	}
+	return h.mailVerification(ctx, u, raw)
+}
+
+// mailVerification sends u the code raw.
+func (h *Handler) mailVerification(ctx context.Context, u *model.User, raw string) error {
+	if h.sender == nil {
+		log.Printf("verification email for %s not sent: no sender configured", u.ID)
+		return nil
+	}
+	body := fmt.Sprintf("Hi %s,\n\nUse this code to verify your email address: %s\n\nIt expires in %d hours. If you didn't sign up, ignore this email.\n",
+		u.Name, raw, int(verifyTokenTTL.Hours()))
+	return h.sender.Send(ctx, u.Email, "Verify your email address", body)
+}
+
+// VerifyEmail spends a code from sendVerification and marks its account
+// verified.
+func (h *Handler) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	if req.Token == "" {
+		return nil, validate.Field("token", i18n.Required)
+	}
+	if err := h.require(store.FeatureEmailVerify); err != nil {
+		return nil, err
+	}
+
+	_, err := h.store.ConsumeEmailVerificationToken(ctx, auth.HashToken(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.AuthVerifyTokenInvalid, "invalid or expired verification code")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.VerifyEmailResponse{}, nil
+}
+
+// ResendVerification answers the same whether or not anything was sent, so
+// it can't be used to probe which emails are registered or verified: every
+// email gets a code generated and the same store call, which only issues it
+// to an unverified account past the cooldown. Only the send itself is left
+// to tell them apart.
+func (h *Handler) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	if req.Email == "" {
+		return nil, validate.Field("email", i18n.Required)
+	}
+	if err := h.require(store.FeatureEmailVerify); err != nil {
+		return nil, err
+	}
+
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	now := h.now()
+	u, err := h.store.ResendEmailVerificationToken(ctx, req.Email, hash, now, now.Add(verifyTokenTTL), verifyResendPeriod)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &pb.ResendVerificationResponse{}, nil
+	}
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if err := h.mailVerification(ctx, u, raw); err != nil {
+		log.Printf("verification email for %s: %v", u.ID, err)
+	}
+	return &pb.ResendVerificationResponse{}, nil
+}
+
+// ChangePassword logs out every other session by revoking all refresh tokens.
+func (h *Handler) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if !auth.CheckPassword(u.PasswordHash, req.Password) {
-		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	var v validate.Errors
+	v.Required("current_password", req.CurrentPassword)
+	checkNewPassword(&v, "new_password", req.NewPassword)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 
-	tok, err := auth.MakeToken(u.ID, h.secret)
+	u, err := h.store.UserByID(ctx, userID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+	}
+	if ok, err := h.hasher.CheckPassword(ctx, u.PasswordHash, req.CurrentPassword); err != nil {
+		return nil, hashErr(err)
+	} else if !ok {
+		return nil, apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return nil, apperr.New(apperr.AuthPasswordUnchanged, "new password must differ from current")
 	}
 
-	return &pb.LoginResponse{Token: tok, UserId: u.ID, Name: u.Name}, nil
+	hash, err := h.hasher.HashPassword(ctx, req.NewPassword)
+	if err != nil {
+		return nil, hashErr(err)
+	}
+	if err := h.store.UpdatePassword(ctx, userID, hash); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if err := h.store.RevokeAllRefreshTokens(ctx, userID); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.ChangePasswordResponse{}, nil
+}
+
+// DeleteAccount soft-deletes the caller after re-checking their password.
+// Access tokens already issued stay valid until they expire (15m), but every
+// refresh token is revoked and login is refused from here on.
+func (h *Handler) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Password == "" {
+		return nil, validate.Field("password", i18n.Required)
+	}
+	if err := h.require(store.FeatureAccountDeletion); err != nil {
+		return nil, err
+	}
+
+	u, err := h.store.UserByID(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+	}
+	if ok, err := h.hasher.CheckPassword(ctx, u.PasswordHash, req.Password); err != nil {
+		return nil, hashErr(err)
+	} else if !ok {
+		return nil, apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+	}
+
+	if err := h.store.SoftDeleteUser(ctx, userID); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.AuthInvalidCredentials, "invalid credentials")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.DeleteAccountResponse{}, nil
 }
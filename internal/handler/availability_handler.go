@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+// a week of split shifts is well under this
+const maxAvailabilityWindows = 50
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+func (h *Handler) GetAvailability(ctx context.Context, req *pb.GetAvailabilityRequest) (*pb.GetAvailabilityResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureAvailability); err != nil {
+		return nil, err
+	}
+	a, err := h.store.Availability(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.GetAvailabilityResponse{Availability: availabilityProto(a)}, nil
+}
+
+// SetAvailability replaces the caller's windows. Nothing already booked is
+// checked against them; only creates and moves from now on are.
+func (h *Handler) SetAvailability(ctx context.Context, req *pb.SetAvailabilityRequest) (*pb.SetAvailabilityResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in := req.Availability
+	if in == nil {
+		in = &pb.Availability{}
+	}
+	var v validate.Errors
+	a := &model.Availability{UserID: userID, TimeZone: in.TimeZone, Enforce: in.Enforce}
+	if a.TimeZone == "" {
+		a.TimeZone = "UTC"
+	}
+	timeZone(&v, "availability.time_zone", in.TimeZone)
+	if len(in.Windows) > maxAvailabilityWindows {
+		v.Add("availability.windows", i18n.MaxWindows, maxAvailabilityWindows)
+	}
+	for i, w := range in.Windows {
+		field := fmt.Sprintf("availability.windows[%d]", i)
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(w.Weekday))]
+		if !ok {
+			v.Add(field+".weekday", i18n.Weekday)
+		}
+		start := clockTime(&v, field+".start", w.Start)
+		end := clockTime(&v, field+".end", w.End)
+		a.Windows = append(a.Windows, model.AvailabilityWindow{
+			Weekday: int(day),
+			Start:   int(start / time.Minute),
+			End:     int(end / time.Minute),
+		})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureAvailability); err != nil {
+		return nil, err
+	}
+	if err := h.store.SetAvailability(ctx, a); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.SetAvailabilityResponse{Availability: availabilityProto(a)}, nil
+}
+
+// availability is userID's windows and whether they're enforced. The
+// windows are nil if there are none (or the schema has no table for them),
+// meaning any time will do.
+func (h *Handler) availability(ctx context.Context, userID string) (*slots.Weekly, bool, error) {
+	if !h.store.Has(store.FeatureAvailability) {
+		return nil, false, nil
+	}
+	a, err := h.store.Availability(ctx, userID)
+	if err != nil || len(a.Windows) == 0 {
+		return nil, false, err
+	}
+	loc, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		// checked on the way in; a zone dropped from tzdata since then
+		// is treated like UTC rather than locking the user out
+		loc = time.UTC
+	}
+	w := &slots.Weekly{Loc: loc}
+	for _, win := range a.Windows {
+		w.Openings = append(w.Openings, slots.Opening{
+			Weekday: time.Weekday(win.Weekday),
+			Start:   time.Duration(win.Start) * time.Minute,
+			End:     time.Duration(win.End) * time.Minute,
+		})
+	}
+	return w, a.Enforce, nil
+}
+
+// checkAvailability refuses [start, end) for userID if they enforce their
+// availability and it isn't all inside it. The message gives the hours of
+// the day it starts on, in their time zone.
+func (h *Handler) checkAvailability(ctx context.Context, userID string, start, end time.Time) error {
+	weekly, enforce, err := h.availability(ctx, userID)
+	if err != nil {
+		return apperr.New(apperr.Internal, "internal error")
+	}
+	if weekly == nil || !enforce || weekly.Covers(slots.Interval{Start: start, End: end}) {
+		return nil
+	}
+	day := start.In(weekly.Loc).Weekday()
+	var hours []string
+	for _, o := range weekly.Openings {
+		if o.Weekday == day {
+			hours = append(hours, clockString(o.Start)+"-"+clockString(o.End))
+		}
+	}
+	name := strings.ToLower(day.String())
+	if len(hours) == 0 {
+		return apperr.Msg(apperr.ApptUnavailable, i18n.ClosedDay, name, weekly.Loc)
+	}
+	return apperr.Msg(apperr.ApptUnavailable, i18n.OutsideHours, name, strings.Join(hours, ", "), weekly.Loc)
+}
+
+func clockString(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+func availabilityProto(a *model.Availability) *pb.Availability {
+	p := &pb.Availability{TimeZone: a.TimeZone, Enforce: a.Enforce}
+	for _, w := range a.Windows {
+		p.Windows = append(p.Windows, &pb.AvailabilityWindow{
+			Weekday: strings.ToLower(time.Weekday(w.Weekday).String()),
+			Start:   clockString(time.Duration(w.Start) * time.Minute),
+			End:     clockString(time.Duration(w.End) * time.Minute),
+		})
+	}
+	if !a.UpdatedAt.IsZero() {
+		p.UpdatedAt = timestamppb.New(a.UpdatedAt)
+	}
+	return p
+}
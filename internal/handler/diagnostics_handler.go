@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store"
+)
+
+// GetDiagnostics is the operator runbook snapshot. It's read-only and
+// cheap, so unlike the other admin methods it isn't audited.
+func (h *Handler) GetDiagnostics(ctx context.Context, req *pb.GetDiagnosticsRequest) (*pb.GetDiagnosticsResponse, error) {
+	if _, err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return &pb.GetDiagnosticsResponse{Diagnostics: h.Diagnostics()}, nil
+}
+
+// Diagnostics builds the snapshot GetDiagnostics and /debug/diagnostics
+// return. Every field is always set, so a missing one in the output means
+// the shape changed.
+func (h *Handler) Diagnostics() *pb.Diagnostics {
+	d := &pb.Diagnostics{
+		GeneratedAt:  timestamppb.Now(),
+		StartedAt:    timestamppb.New(h.diag.Started()),
+		Build:        buildInfo(),
+		Config:       h.diag.Config(),
+		Pool:         &pb.PoolStats{},
+		Migration:    &pb.MigrationStatus{},
+		Gauges:       h.diag.Gauges(),
+		RecentErrors: h.diag.RecentErrors(),
+	}
+	if p := h.poolStats(); p != nil {
+		d.Pool = p
+	}
+	m := h.diag.Migration()
+	d.Migration.Version = m.Version
+	d.Migration.Error = m.Error
+	if !m.AppliedAt.IsZero() {
+		d.Migration.AppliedAt = timestamppb.New(m.AppliedAt)
+	}
+	for _, f := range store.Features() {
+		if !h.store.Has(f) {
+			d.Migration.MissingFeatures = append(d.Migration.MissingFeatures, f)
+		}
+	}
+	for _, w := range h.diag.Workers() {
+		ws := &pb.WorkerStatus{Name: w.Name, Runs: w.Runs, Errors: w.Errors, LastError: w.LastError}
+		if !w.LastRun.IsZero() {
+			ws.LastRun = timestamppb.New(w.LastRun)
+		}
+		d.Workers = append(d.Workers, ws)
+	}
+	return d
+}
+
+// poolStats is the pgxpool counters, nil without a pool.
+func (h *Handler) poolStats() *pb.PoolStats {
+	s := h.store.Stat()
+	if s == nil {
+		return nil
+	}
+	return &pb.PoolStats{
+		AcquiredConns:        s.AcquiredConns(),
+		IdleConns:            s.IdleConns(),
+		TotalConns:           s.TotalConns(),
+		MaxConns:             s.MaxConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireWaitMs:        s.AcquireDuration().Milliseconds(),
+	}
+}
+
+// GetSystemStats counts users, appointments and sessions for operations.
+// Unlike GetDiagnostics it queries the database, once per call.
+func (h *Handler) GetSystemStats(ctx context.Context, req *pb.GetSystemStatsRequest) (*pb.GetSystemStatsResponse, error) {
+	if _, err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	st, err := h.store.Stats(ctx)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.GetSystemStatsResponse{Stats: &pb.SystemStats{
+		GeneratedAt:                timestamppb.Now(),
+		Users:                      st.Users,
+		DeletedUsers:               st.DeletedUsers,
+		ConfirmedAppointments:      st.Confirmed,
+		CancelledAppointments:      st.Cancelled,
+		AppointmentsCreatedLastDay: st.CreatedLastDay,
+		ActiveRefreshTokens:        st.RefreshTokens,
+		Pool:                       h.poolStats(),
+	}}, nil
+}
+
+func buildInfo() *pb.BuildInfo {
+	b := &pb.BuildInfo{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.ModuleVersion = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.VcsRevision = s.Value
+		case "vcs.time":
+			b.VcsTime = s.Value
+		case "vcs.modified":
+			b.VcsModified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// DiagnosticsHTTP serves the snapshot as JSON to an admin's bearer token,
+// for operators without a gRPC client at hand.
+func (h *Handler) DiagnosticsHTTP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if raw == "" {
+			jsonError(w, http.StatusUnauthorized, apperr.AuthRequired, "no token")
+			return
+		}
+		claims, err := h.authCfg.ParseToken(raw, h.keys)
+		switch {
+		case err != nil:
+			tokenError(w, err)
+			return
+		case !h.isAdmin(middleware.WithClaims(r.Context(), claims)):
+			jsonError(w, http.StatusForbidden, apperr.AdminOnly, "admin only")
+			return
+		}
+		out, err := protojson.MarshalOptions{Multiline: true, EmitUnpopulated: true}.Marshal(h.Diagnostics())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, apperr.Internal, "internal error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(out)
+	})
+}
+
+func jsonError(w http.ResponseWriter, code int, reason apperr.Reason, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg, "reason": string(reason)})
+}
+
+// tokenError is middleware.TokenError as a JSON 401.
+func tokenError(w http.ResponseWriter, err error) {
+	err = middleware.TokenError(err)
+	jsonError(w, http.StatusUnauthorized, apperr.ReasonOf(err), status.Convert(err).Message())
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/model"
+)
+
+// appointments fetched per store call while exporting; each batch is
+// written and flushed before the next, so a large account never sits in
+// memory whole
+const exportBatch = 200
+
+// Export is the top of the document ExportHTTP writes; Appointments
+// follows it, streamed. Exported so clients (and tests) can decode it.
+type Export struct {
+	ExportedAt   time.Time         `json:"exported_at"`
+	Profile      ExportProfile     `json:"profile"`
+	Sessions     []ExportSession   `json:"sessions"`
+	Attending    []ExportAttending `json:"attending"`
+	Appointments []json.RawMessage `json:"appointments"`
+}
+
+// ExportProfile is the account itself, minus the password hash.
+type ExportProfile struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ExportSession is a live refresh token, without the token or its hash.
+type ExportSession struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExportAttending is someone else's appointment the user is invited to:
+// only what an attendee already knows of it.
+type ExportAttending struct {
+	AppointmentID string    `json:"appointment_id"`
+	OwnerID       string    `json:"owner_id"`
+	OwnerName     string    `json:"owner_name"`
+	Status        string    `json:"status"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+}
+
+var exportJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// ExportHTTP serves GET requests with the caller's bearer token a JSON
+// document of everything stored about them: profile, live sessions, the
+// appointments they're invited to, and every appointment they own in any
+// status, with attendee IDs and names but never other users' emails.
+// Appointments are streamed last, batch by batch; a failure part way
+// aborts the response, so a truncated body never parses as complete.
+func (h *Handler) ExportHTTP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if raw == "" {
+			jsonError(w, http.StatusUnauthorized, apperr.AuthRequired, "no token")
+			return
+		}
+		claims, err := h.authCfg.ParseToken(raw, h.keys)
+		if err != nil {
+			tokenError(w, err)
+			return
+		}
+		ctx := r.Context()
+		u, err := h.store.UserByID(ctx, claims.UserID)
+		if err != nil {
+			jsonError(w, http.StatusNotFound, apperr.NotFound, "user not found")
+			return
+		}
+		head, err := h.exportHead(ctx, u)
+		if err != nil {
+			log.Printf("export for %s: %v", u.ID, err)
+			jsonError(w, http.StatusInternalServerError, apperr.Internal, "internal error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Disposition", `attachment; filename="schedule-export.json"`)
+		if err := h.writeExport(ctx, w, claims.UserID, head); err != nil {
+			log.Printf("export for %s failed part way: %v", claims.UserID, err)
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// exportHead gathers everything but the appointments, before anything is
+// written, so those failures still get a proper status.
+func (h *Handler) exportHead(ctx context.Context, u *model.User) (*Export, error) {
+	e := &Export{
+		ExportedAt: h.now().UTC(),
+		Profile: ExportProfile{
+			ID: u.ID, Email: u.Email, Name: u.Name, Role: u.Role,
+			EmailVerified: u.Verified, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt,
+		},
+		Sessions:  []ExportSession{},
+		Attending: []ExportAttending{},
+	}
+
+	tokens, err := h.store.ListRefreshTokensByUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		e.Sessions = append(e.Sessions, ExportSession{
+			ID: t.ID, UserAgent: t.UserAgent, IP: t.IP, CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt,
+		})
+	}
+
+	attending, err := h.store.Attending(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]string, len(attending))
+	for i, a := range attending {
+		owners[i] = a.OwnerID
+	}
+	users, err := h.store.UsersByIDs(ctx, owners)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attending {
+		e.Attending = append(e.Attending, ExportAttending{
+			AppointmentID: a.AppointmentID, OwnerID: a.OwnerID, OwnerName: users[a.OwnerID].Name,
+			Status: a.Status, StartTime: a.StartTime, EndTime: a.EndTime,
+		})
+	}
+	return e, nil
+}
+
+// writeExport writes head with its appointments array left open, then the
+// appointments a batch at a time, then closes the document.
+func (h *Handler) writeExport(ctx context.Context, w io.Writer, userID string, head *Export) error {
+	top, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	// head.Appointments is nil, so top ends `"appointments":null}`
+	top = top[:len(top)-len("null}")]
+	if _, err := w.Write(append(top, '[')); err != nil {
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var afterStart time.Time
+	afterID, sep := "", ""
+	for {
+		apts, err := h.store.AllAppointments(ctx, userID, afterStart, afterID, exportBatch)
+		if err != nil {
+			return err
+		}
+		page := make([]*model.Appointment, len(apts))
+		for i := range apts {
+			page[i] = &apts[i]
+		}
+		users, err := h.people(ctx, page...)
+		if err != nil {
+			return err
+		}
+		for i := range apts {
+			// no viewer, so attendees carry IDs and names but no emails
+			p := withPeople(&apts[i], users, "")
+			b, err := exportJSON.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			sep = ","
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(apts) < exportBatch {
+			break
+		}
+		last := apts[len(apts)-1]
+		afterStart, afterID = last.StartTime, last.ID
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const maxFreezeReason = 300
+
+// CreateFreezeWindow stops new bookings in a time range for every user.
+// Appointments already in it stay as they are.
+func (h *Handler) CreateFreezeWindow(ctx context.Context, req *pb.CreateFreezeWindowRequest) (*pb.CreateFreezeWindowResponse, error) {
+	actor, err := h.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureFreezeWindows); err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	if req.StartTime == nil {
+		v.Add("start_time", i18n.Required)
+	}
+	if req.EndTime == nil {
+		v.Add("end_time", i18n.Required)
+	} else if req.StartTime != nil && !req.EndTime.AsTime().After(req.StartTime.AsTime()) {
+		v.AddReason(apperr.ApptEmptyRange, "end_time", i18n.After, "start_time")
+	}
+	if v.Required("reason", req.Reason) {
+		v.MaxLen("reason", req.Reason, maxFreezeReason)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	w := &model.FreezeWindow{
+		Start:     req.StartTime.AsTime(),
+		End:       req.EndTime.AsTime(),
+		Reason:    req.Reason,
+		CreatedBy: actor,
+	}
+	if err := h.store.CreateFreezeWindow(ctx, w); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.adminAudit(ctx, actor, "CreateFreezeWindow", map[string]any{
+		"id": w.ID, "start_time": w.Start.Format(time.RFC3339), "end_time": w.End.Format(time.RFC3339), "reason": w.Reason,
+	})
+	return &pb.CreateFreezeWindowResponse{FreezeWindow: freezeProto(w)}, nil
+}
+
+func (h *Handler) ListFreezeWindows(ctx context.Context, req *pb.ListFreezeWindowsRequest) (*pb.ListFreezeWindowsResponse, error) {
+	if _, err := h.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureFreezeWindows); err != nil {
+		return nil, err
+	}
+	since := h.now()
+	if req.IncludePast {
+		since = time.Time{}
+	}
+	ws, err := h.store.FreezeWindows(ctx, since)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListFreezeWindowsResponse{}
+	for i := range ws {
+		resp.FreezeWindows = append(resp.FreezeWindows, freezeProto(&ws[i]))
+	}
+	return resp, nil
+}
+
+func (h *Handler) DeleteFreezeWindow(ctx context.Context, req *pb.DeleteFreezeWindowRequest) (*pb.DeleteFreezeWindowResponse, error) {
+	actor, err := h.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureFreezeWindows); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	if err := h.store.DeleteFreezeWindow(ctx, req.Id); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.adminAudit(ctx, actor, "DeleteFreezeWindow", map[string]any{"id": req.Id})
+	return &pb.DeleteFreezeWindowResponse{}, nil
+}
+
+// adminAudit records an admin change when the audit table exists. Unlike
+// searches, the change has already happened, so a failed write is only logged.
+func (h *Handler) adminAudit(ctx context.Context, actor, action string, params map[string]any) {
+	if !h.store.Has(store.FeatureAdminAudit) {
+		return
+	}
+	if err := h.store.AppendAdminAudit(ctx, actor, action, params); err != nil {
+		log.Printf("admin audit write failed: %v", err)
+	}
+}
+
+// checkFreeze refuses a booking that overlaps a freeze window, with the
+// window's reason. Databases without the table have no freezes.
+func (h *Handler) checkFreeze(ctx context.Context, start, end time.Time) error {
+	if !h.store.Has(store.FeatureFreezeWindows) {
+		return nil
+	}
+	w, err := h.store.FreezeOverlapping(ctx, start, end)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return apperr.New(apperr.Internal, "internal error")
+	}
+	return apperr.Msg(apperr.ApptFrozen, i18n.FrozenSlot,
+		w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339), w.Reason)
+}
+
+func freezeProto(w *model.FreezeWindow) *pb.FreezeWindow {
+	return &pb.FreezeWindow{
+		Id:        w.ID,
+		StartTime: timestamppb.New(w.Start),
+		EndTime:   timestamppb.New(w.End),
+		Scope:     w.Scope,
+		Reason:    w.Reason,
+		CreatedBy: w.CreatedBy,
+		CreatedAt: timestamppb.New(w.CreatedAt),
+	}
+}
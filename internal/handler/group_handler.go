@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+// JoinAppointment puts the caller on someone else's group appointment.
+// The store counts and inserts under the appointment's row lock, so the
+// last spot goes to exactly one caller. Private, cancelled and the caller's
+// own appointments are all NotFound, like any other that isn't theirs.
+func (h *Handler) JoinAppointment(ctx context.Context, req *pb.JoinAppointmentRequest) (*pb.JoinAppointmentResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, validate.Field("id", i18n.Required)
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	if err := h.require(store.FeatureCapacity); err != nil {
+		return nil, err
+	}
+
+	apt, err := h.store.JoinAppointment(ctx, req.Id, userID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, apperr.New(apperr.NotFound, "not found")
+	case errors.Is(err, store.ErrFull):
+		return nil, apperr.New(apperr.ApptFull, "no spots left")
+	case err != nil:
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.JoinAppointmentResponse{Appointment: toProto(apt)}, nil
+}
+
+// LeaveAppointment undoes JoinAppointment, freeing the spot.
+func (h *Handler) LeaveAppointment(ctx context.Context, req *pb.LeaveAppointmentRequest) (*pb.LeaveAppointmentResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, validate.Field("id", i18n.Required)
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	if err := h.require(store.FeatureCapacity); err != nil {
+		return nil, err
+	}
+
+	err = h.store.LeaveAppointment(ctx, req.Id, userID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, apperr.New(apperr.NotFound, "not found")
+	case err != nil:
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.LeaveAppointmentResponse{}, nil
+}
@@ -1,16 +1,267 @@
 package handler
 
 import (
+	"strings"
+	"time"
+
 	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/cache"
+	"schedule-management-api/internal/clock"
+	"schedule-management-api/internal/diag"
+	"schedule-management-api/internal/metrics"
+	"schedule-management-api/internal/notify"
 	"schedule-management-api/internal/store"
 )
 
+// soft cap on the serialized size of a single ListAppointments response
+const defaultMaxListBytes = 1 << 20
+
+// ListAppointments window when the client sends no bounds. 62 days covers
+// any "two months ahead", which is what the old hardcoded default meant.
+const (
+	defaultListPast   = 30 * 24 * time.Hour
+	defaultListFuture = 62 * 24 * time.Hour
+	defaultMaxHorizon = 366
+)
+
+// Login lockout: 5 bad passwords in 15 minutes locks the email for 15.
+const (
+	defaultMaxFailures = 5
+	defaultLockout     = 15 * time.Minute
+)
+
+// Handler implements every service in the proto; the deprecated auth
+// methods on ScheduleService share their implementation with AuthService.
 type Handler struct {
+	pb.UnimplementedAuthServiceServer
 	pb.UnimplementedScheduleServiceServer
-	store  *store.Store
-	secret string
+	pb.UnimplementedAdminServiceServer
+	store Store
+	keys  auth.Keys
+
+	maxListBytes int
+	listPast     time.Duration
+	listFuture   time.Duration
+	maxHorizon   int           // days
+	sender       notify.Sender // nil = don't deliver mail
+	hasher       *auth.Pool
+	authCfg      auth.Config
+	maxFailures  int           // failed logins before an email is locked
+	lockout      time.Duration // window the failures count in, and the lock's length
+	publicURL    string        // prefix for share links
+	shareTTL     time.Duration // share link lifetime when the request gives none
+	metrics      *metrics.Metrics
+	admins       map[string]bool // user IDs allowed to call AdminService
+	diag         *diag.Registry
+	listCache    *cache.Cache[*pb.ListAppointmentsResponse] // nil = every list reads the store
+
+	// appointment text limits in characters, and whether markup is stripped
+	maxTitle       int
+	maxDescription int
+	maxLocation    int
+	stripHTML      bool
+
+	privateWebhooks bool // webhook URLs may point at loopback and private addresses
+
+	requireVerified bool // unverified accounts can't log in
+	clock           clock.Clock
+}
+
+type Option func(*Handler)
+
+// WithMaxListBytes overrides the ListAppointments response size cap.
+func WithMaxListBytes(n int) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.maxListBytes = n
+		}
+	}
+}
+
+// WithListWindow overrides the default ListAppointments range (now-past, now+future).
+func WithListWindow(past, future time.Duration) Option {
+	return func(h *Handler) {
+		if past > 0 {
+			h.listPast = past
+		}
+		if future > 0 {
+			h.listFuture = future
+		}
+	}
+}
+
+// WithMaxHorizonDays caps ListAppointmentsRequest.horizon_days.
+func WithMaxHorizonDays(days int) Option {
+	return func(h *Handler) {
+		if days > 0 {
+			h.maxHorizon = days
+		}
+	}
+}
+
+// WithHashPool sets the bounded pool bcrypt work runs on.
+func WithHashPool(p *auth.Pool) Option {
+	return func(h *Handler) { h.hasher = p }
+}
+
+// WithAuthConfig sets token lifetimes and the iss/aud tokens are minted
+// with and checked against.
+func WithAuthConfig(c auth.Config) Option {
+	return func(h *Handler) { h.authCfg = c }
+}
+
+// WithLoginLockout locks an email out of Login for window once max
+// logins for it failed within window.
+func WithLoginLockout(max int, window time.Duration) Option {
+	return func(h *Handler) {
+		if max > 0 {
+			h.maxFailures = max
+		}
+		if window > 0 {
+			h.lockout = window
+		}
+	}
+}
+
+// WithSender sets how password reset (and other) messages are delivered.
+func WithSender(s notify.Sender) Option {
+	return func(h *Handler) { h.sender = s }
 }
 
-func New(st *store.Store, secret string) *Handler {
-	return &Handler{store: st, secret: secret}
+// WithRequireVerifiedEmail refuses Login to accounts whose email isn't
+// verified yet, and Register hands out no tokens. Off, they're let in and
+// told email_verified=false.
+func WithRequireVerifiedEmail(on bool) Option {
+	return func(h *Handler) { h.requireVerified = on }
 }
+
+// WithClock makes c the handler's idea of now, for past-booking checks,
+// list defaults, expiries and the tokens it mints (unless the auth config
+// brings its own clock).
+func WithClock(c clock.Clock) Option {
+	return func(h *Handler) {
+		if c != nil {
+			h.clock = c
+		}
+	}
+}
+
+// WithPublicURL sets the externally reachable bridge address share links
+// point at, e.g. "https://schedule.example.com".
+func WithPublicURL(u string) Option {
+	return func(h *Handler) {
+		if u != "" {
+			h.publicURL = strings.TrimRight(u, "/")
+		}
+	}
+}
+
+// WithShareLinkTTL sets how long a share link lasts when CreateShareLink
+// doesn't say, up to the 90 day cap.
+func WithShareLinkTTL(d time.Duration) Option {
+	return func(h *Handler) {
+		if d > 0 {
+			h.shareTTL = min(d, maxShareTTL)
+		}
+	}
+}
+
+// WithTextLimits sets the most characters an appointment's title,
+// description and location may have. Zero keeps a default; title and
+// location can't go past their columns (200 and 500).
+func WithTextLimits(title, description, location int) Option {
+	return func(h *Handler) {
+		if title > 0 {
+			h.maxTitle = min(title, maxTitleLen)
+		}
+		if description > 0 {
+			h.maxDescription = description
+		}
+		if location > 0 {
+			h.maxLocation = min(location, maxLocationLen)
+		}
+	}
+}
+
+// WithStripHTML turns markup stripping of appointment text on or off
+// (on by default). Off, text is still normalized and trimmed.
+func WithStripHTML(on bool) Option {
+	return func(h *Handler) { h.stripHTML = on }
+}
+
+// WithPrivateWebhooks lets webhook URLs point at loopback and private
+// addresses, for development; the dispatcher needs
+// webhook.WithPrivateAddresses to match.
+func WithPrivateWebhooks(on bool) Option {
+	return func(h *Handler) { h.privateWebhooks = on }
+}
+
+// WithMetrics records business counters (booking conflicts) on m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(h *Handler) { h.metrics = m }
+}
+
+// WithListCache answers repeated ListAppointments calls from c. A user's
+// entries are dropped whenever their appointments are created, changed or
+// deleted through the handler; anything else (attendees joining, names
+// changing) shows up once an entry expires.
+func WithListCache(c *cache.Cache[*pb.ListAppointmentsResponse]) Option {
+	return func(h *Handler) { h.listCache = c }
+}
+
+// WithAdmins lets the given user IDs call AdminService.
+func WithAdmins(ids []string) Option {
+	return func(h *Handler) {
+		for _, id := range ids {
+			if id = strings.TrimSpace(id); id != "" {
+				h.admins[id] = true
+			}
+		}
+	}
+}
+
+// WithDiagnostics sets where GetDiagnostics reads worker and error state.
+func WithDiagnostics(d *diag.Registry) Option {
+	return func(h *Handler) { h.diag = d }
+}
+
+// New signs access tokens with the first of keys and accepts any of them.
+// A nil st is a handler with no database, for what needs none (validation,
+// GetServerInfo); it reports every feature present like a nil *store.Store.
+func New(st Store, keys auth.Keys, opts ...Option) *Handler {
+	if st == nil {
+		st = (*store.Store)(nil)
+	}
+	h := &Handler{
+		store:        st,
+		keys:         keys,
+		maxListBytes: defaultMaxListBytes,
+		listPast:     defaultListPast,
+		listFuture:   defaultListFuture,
+		maxHorizon:   defaultMaxHorizon,
+		maxFailures:  defaultMaxFailures,
+		lockout:      defaultLockout,
+		publicURL:    "http://localhost:8080",
+		shareTTL:     defaultShareTTL,
+		admins:       map[string]bool{},
+		clock:        clock.Real{},
+
+		maxTitle:       maxTitleLen,
+		maxDescription: maxDescriptionLen,
+		maxLocation:    maxLocationLen,
+		stripHTML:      true,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	if h.hasher == nil {
+		h.hasher = auth.NewPool(0, 0)
+	}
+	if h.authCfg.Clock == nil {
+		h.authCfg.Clock = h.clock
+	}
+	return h
+}
+
+func (h *Handler) now() time.Time { return h.clock.Now() }
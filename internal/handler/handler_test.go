@@ -2,34 +2,75 @@ package handler_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
 	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/cache"
+	"schedule-management-api/internal/clock"
+	"schedule-management-api/internal/diag"
+	gweb "schedule-management-api/internal/grpcweb"
 	"schedule-management-api/internal/handler"
 	"schedule-management-api/internal/middleware"
 	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
 	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/store/memstore"
+	"schedule-management-api/internal/tracing"
+	"schedule-management-api/internal/validate"
+	"schedule-management-api/internal/webhook"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"os"
 )
 
-
 func setup(t *testing.T) (*handler.Handler, *store.Store, string) {
 	t.Helper()
 	_ = godotenv.Load("../../.env")
@@ -38,18 +79,53 @@ func setup(t *testing.T) (*handler.Handler, *store.Store, string) {
 	if dbURL == "" || secret == "" {
 		t.Skip("DATABASE_URL or JWT_SECRET not set")
 	}
-	pool, err := pgxpool.New(context.Background(), dbURL)
+	cfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	cfg.ConnConfig.Tracer = store.QueryTracer()
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		t.Fatalf("db: %v", err)
 	}
 	t.Cleanup(pool.Close)
 	st := store.New(pool)
-	h := handler.New(st, secret)
+	h := handler.New(st, auth.SingleKey(secret))
 	return h, st, secret
 }
 
+// memSetup is a handler on memstore, for tests that don't need Postgres.
+func memSetup(t *testing.T) (*handler.Handler, *memstore.Store, string) {
+	t.Helper()
+	const secret = "mem-secret"
+	st := memstore.New()
+	return handler.New(st, auth.SingleKey(secret)), st, secret
+}
+
+// eachStore runs fn on memstore, then on Postgres unless setup skips. fn
+// takes the handler, or the store itself for tests that build their own
+// handler with options.
+func eachStore[F func(*testing.T, *handler.Handler, string) | func(*testing.T, handler.Store, string)](t *testing.T, fn F) {
+	run := func(t *testing.T, h *handler.Handler, st handler.Store, secret string) {
+		switch fn := any(fn).(type) {
+		case func(*testing.T, *handler.Handler, string):
+			fn(t, h, secret)
+		case func(*testing.T, handler.Store, string):
+			fn(t, st, secret)
+		}
+	}
+	t.Run("memstore", func(t *testing.T) {
+		h, st, secret := memSetup(t)
+		run(t, h, st, secret)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		h, st, secret := setup(t)
+		run(t, h, st, secret)
+	})
+}
+
 func authedCtx(uid, secret string) context.Context {
-	tok, _ := auth.MakeToken(uid, secret)
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
 	md := metadata.New(map[string]string{"authorization": "Bearer " + tok})
 	ctx := metadata.NewIncomingContext(context.Background(), md)
 	return context.WithValue(ctx, middleware.UserIDKey, uid)
@@ -130,6 +206,165 @@ func TestRegisterValidation(t *testing.T) {
 	}
 }
 
+// every bad field is reported at once, with its proto name, and the reason
+// is the first problem's; none of this reaches the store
+func TestFieldViolations(t *testing.T) {
+	const secret = "test-secret"
+	h := handler.New(nil, auth.SingleKey(secret))
+	ctx := authedCtx(uuid.NewString(), secret)
+	start := time.Now().Add(100 * time.Hour)
+
+	tests := []struct {
+		name   string
+		call   func() error
+		reason apperr.Reason
+		fields string
+	}{
+		{"register", func() error {
+			_, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "not-an-email", Password: "short"})
+			return err
+		}, apperr.InvalidArgument, "email: not a valid email address\npassword: at least 8 characters\nname: required\n"},
+		{"register password only", func() error {
+			_, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "a@b.co", Password: "short", Name: "A"})
+			return err
+		}, apperr.AuthPasswordTooShort, "password: at least 8 characters\n"},
+		{"register password too long for bcrypt", func() error {
+			_, err := h.Register(context.Background(), &pb.RegisterRequest{Email: "a@b.co", Password: strings.Repeat("p", 73), Name: "A"})
+			return err
+		}, apperr.InvalidArgument, "password: at most 72 bytes\n"},
+		{"login", func() error {
+			_, err := h.Login(context.Background(), &pb.LoginRequest{})
+			return err
+		}, apperr.InvalidArgument, "email: required\npassword: required\n"},
+		{"create", func() error {
+			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title:       strings.Repeat("é", 201), // characters, not bytes
+				Description: strings.Repeat("d", 5001),
+				Location:    strings.Repeat("l", 501),
+				StartTime:   timestamppb.New(start),
+			})
+			return err
+		}, apperr.InvalidArgument, "title: at most 200 characters\ndescription: at most 5000 characters\nlocation: at most 500 characters\nend_time: required\n"},
+		{"create inverted", func() error {
+			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title: "x", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(-time.Hour)),
+			})
+			return err
+		}, apperr.ApptEmptyRange, "end_time: must be after start_time\n"},
+		{"update", func() error {
+			_, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{EndTime: timestamppb.New(start)})
+			return err
+		}, apperr.InvalidArgument, "id: required\ntitle: required\nstart_time: required\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if status.Code(err) != codes.InvalidArgument || apperr.ReasonOf(err) != tt.reason {
+				t.Errorf("got %v (reason %s), want InvalidArgument/%s", err, apperr.ReasonOf(err), tt.reason)
+			}
+			if got := violationsOf(err); got != tt.fields {
+				t.Errorf("violations:\n%swant:\n%s", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestAppointmentText(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		uid, _ := registerUser(t, h)
+		ctx := authedCtx(uid, secret)
+		start := time.Now().Add(24 * time.Hour)
+		create := func(title, description, location string) (*pb.Appointment, error) {
+			start = start.Add(2 * time.Hour)
+			cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title: title, Description: description, Location: location,
+				StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return cr.Appointment, nil
+		}
+
+		a, err := create(`  Sync<script>alert("x")</script> `, "<p>Agenda</p><p>1 < 2 &amp; more</p>", "Café <b>Nord</b>")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Title != "Sync" || a.Description != "Agenda\n1 < 2 & more" || a.Location != "Café Nord" {
+			t.Errorf("got %q / %q / %q", a.Title, a.Description, a.Location)
+		}
+
+		// limits count characters, so emoji and right-to-left text fit
+		// as many as ASCII does
+		for _, s := range []string{"🎉", "م"} {
+			if _, err := create(strings.Repeat(s, 200), "", ""); err != nil {
+				t.Errorf("200 x %q: %v", s, err)
+			}
+			_, err := create(strings.Repeat(s, 201), "", "")
+			if got := violationsOf(err); got != "title: at most 200 characters\n" {
+				t.Errorf("201 x %q: %v", s, err)
+			}
+		}
+		_, err = create("x", strings.Repeat("d", 10000), "")
+		if status.Code(err) != codes.InvalidArgument || violationsOf(err) != "description: at most 5000 characters\n" {
+			t.Errorf("10k description: %v", err)
+		}
+		_, err = create(" \t<br>\n ", "", "")
+		if violationsOf(err) != "title: required\n" {
+			t.Errorf("blank title: %v", err)
+		}
+
+		// update cleans and checks the same way
+		update := func(title, description string) (*pb.Appointment, error) {
+			ur, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+				Id: a.Id, Title: title, Description: description,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "description"}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return ur.Appointment, nil
+		}
+		u, err := update("<i>Retro</i> ", "<style>p{}</style>notes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Title != "Retro" || u.Description != "notes" {
+			t.Errorf("updated: %q / %q", u.Title, u.Description)
+		}
+		if _, err := update("<b></b>", ""); violationsOf(err) != "title: required\n" {
+			t.Errorf("blank update: %v", err)
+		}
+		if _, err := update("x", strings.Repeat("d", 10000)); violationsOf(err) != "description: at most 5000 characters\n" {
+			t.Errorf("10k update: %v", err)
+		}
+	})
+}
+
+func TestAppointmentTextOptions(t *testing.T) {
+	_, st, secret := memSetup(t)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithTextLimits(10, 20, 0), handler.WithStripHTML(false))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	start := timestamppb.New(time.Now().Add(time.Hour))
+	end := timestamppb.New(time.Now().Add(2 * time.Hour))
+
+	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: strings.Repeat("t", 11), Description: strings.Repeat("d", 21), Location: strings.Repeat("l", 501),
+		StartTime: start, EndTime: end,
+	})
+	if got, want := violationsOf(err), "title: at most 10 characters\ndescription: at most 20 characters\nlocation: at most 500 characters\n"; got != want {
+		t.Errorf("violations:\n%swant:\n%s", got, want)
+	}
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: " <b>x</b> ", StartTime: start, EndTime: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Appointment.Title != "<b>x</b>" {
+		t.Errorf("with stripping off: %q", cr.Appointment.Title)
+	}
+}
+
 func TestRegisterDuplicate(t *testing.T) {
 	h, _, _ := setup(t)
 
@@ -202,534 +437,7128 @@ func TestLoginNonexistentUser(t *testing.T) {
 	}
 }
 
-// ----- appointment CRUD -----
-
-func TestCreateAppointment(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+// an unknown email goes through bcrypt like a known one, so it can't be
+// told apart by how fast it fails: with no time left for the hash, both
+// fail the same way instead of the unknown one answering "invalid"
+func TestLoginUnknownEmailHashes(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, _ string) {
+		_, email := registerUser(t, h)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, known := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "wrong"})
+		_, unknown := h.Login(ctx, &pb.LoginRequest{Email: "nobody-" + email, Password: "wrong"})
+		if status.Code(known) == codes.Unauthenticated || status.Code(unknown) != status.Code(known) {
+			t.Errorf("known: %v, unknown: %v", known, unknown)
+		}
+	})
+}
 
-	start := time.Now().Add(100 * time.Hour)
-	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title:       "Meeting",
-		Description: "important stuff",
-		Location:    "Room A",
-		StartTime:   timestamppb.New(start),
-		EndTime:     timestamppb.New(start.Add(time.Hour)),
+func TestLoginEmailTooLong(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, _ string) {
+		_, err := h.Login(context.Background(), &pb.LoginRequest{
+			Email: strings.Repeat("a", 250) + "@x.com", Password: "testpass123",
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("got %v, want InvalidArgument", err)
+		}
 	})
+}
+
+func TestLoginIssuesRefreshToken(t *testing.T) {
+	_, st, secret := setup(t)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAuthConfig(auth.Config{RefreshTTL: 2 * time.Hour}))
+	ctx := context.Background()
+
+	// checks raw is stored, hashed, for uid and expires when the response says
+	checkStored := func(name, raw, uid string, exp *timestamppb.Timestamp) {
+		t.Helper()
+		if raw == "" || exp == nil {
+			t.Fatalf("%s: no refresh token in response", name)
+		}
+		rt, err := st.GetRefreshTokenByHash(ctx, auth.Config{}.HashRefreshToken(raw).Hash)
+		if err != nil {
+			t.Fatalf("%s: stored token not found under HashRefreshToken(raw): %v", name, err)
+		}
+		if rt.UserID != uid || rt.Revoked || rt.TokenHash == raw {
+			t.Errorf("%s: stored %+v", name, rt)
+		}
+		if d := rt.ExpiresAt.Sub(exp.AsTime()); d < -time.Second || d > time.Second {
+			t.Errorf("%s: stored expiry %v, response says %v", name, rt.ExpiresAt, exp.AsTime())
+		}
+		if d := time.Until(rt.ExpiresAt); d < 119*time.Minute || d > 2*time.Hour {
+			t.Errorf("%s: expires in %v, want the configured 2h", name, d)
+		}
+	}
+
+	email := fmt.Sprintf("test-%s@test.com", uuid.New().String()[:8])
+	rr, err := h.Register(ctx, &pb.RegisterRequest{Email: email, Password: "testpass123", Name: "Refresh"})
 	if err != nil {
-		t.Fatalf("create: %v", err)
+		t.Fatalf("register: %v", err)
 	}
-	a := cr.Appointment
-	if a.Id == "" {
-		t.Fatal("empty id")
+	checkStored("register", rr.RefreshToken, rr.UserId, rr.RefreshExpiresAt)
+	if d := time.Until(rr.AccessExpiresAt.AsTime()); d <= 0 || d > auth.AccessTokenTTL {
+		t.Errorf("access expires in %v", d)
 	}
-	if a.Title != "Meeting" {
-		t.Errorf("title: got %s", a.Title)
+
+	lr, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "testpass123"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
 	}
-	if a.Description != "important stuff" {
-		t.Errorf("description: got %s", a.Description)
+	checkStored("login", lr.RefreshToken, lr.UserId, lr.RefreshExpiresAt)
+	if lr.RefreshToken == rr.RefreshToken {
+		t.Error("login reused the register refresh token")
 	}
-	if a.Location != "Room A" {
-		t.Errorf("location: got %s", a.Location)
+
+	// rotation: the new pair works, the old refresh token is spent
+	ref, err := h.Refresh(ctx, &pb.RefreshRequest{RefreshToken: lr.RefreshToken})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
 	}
-	if a.Status != "confirmed" {
-		t.Errorf("status: got %s", a.Status)
+	checkStored("refresh", ref.RefreshToken, lr.UserId, ref.RefreshExpiresAt)
+	if c, err := auth.ParseToken(ref.Token, secret); err != nil || c.UserID != lr.UserId {
+		t.Errorf("refreshed access token: %v, %v", c, err)
 	}
-}
-
-func TestCreateAppointmentValidation(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
-
-	start := time.Now().Add(200 * time.Hour)
 
-	tests := []struct {
-		name string
-		req  *pb.CreateAppointmentRequest
-	}{
-		{"empty title", &pb.CreateAppointmentRequest{
-			Title: "", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
-		}},
-		{"missing start", &pb.CreateAppointmentRequest{
-			Title: "X", EndTime: timestamppb.New(start.Add(time.Hour)),
-		}},
-		{"missing end", &pb.CreateAppointmentRequest{
-			Title: "X", StartTime: timestamppb.New(start),
-		}},
-		{"end before start", &pb.CreateAppointmentRequest{
-			Title: "X", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(-time.Hour)),
-		}},
-		{"past booking", &pb.CreateAppointmentRequest{
-			Title: "X", StartTime: timestamppb.New(time.Now().Add(-2 * time.Hour)), EndTime: timestamppb.New(time.Now().Add(-time.Hour)),
-		}},
+	// replaying the spent one is treated as theft: everything is revoked,
+	// including the pair that replaced it
+	if _, err := h.Refresh(ctx, &pb.RefreshRequest{RefreshToken: lr.RefreshToken}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Fatalf("replay: %v", err)
+	}
+	if _, err := h.Refresh(ctx, &pb.RefreshRequest{RefreshToken: ref.RefreshToken}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Errorf("successor survived a replay: %v", err)
+	}
+	if _, err := h.Refresh(ctx, &pb.RefreshRequest{RefreshToken: rr.RefreshToken}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Errorf("other session survived a replay: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			_, err := h.CreateAppointment(ctx, tt.req)
-			if err == nil {
-				t.Fatal("expected validation error")
-			}
-			s, _ := status.FromError(err)
-			if s.Code() != codes.InvalidArgument {
-				t.Errorf("expected InvalidArgument, got %v", s.Code())
-			}
-		})
+	if _, err := h.Refresh(ctx, &pb.RefreshRequest{RefreshToken: "nope"}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Errorf("unknown token: %v", err)
+	}
+	if _, err := h.Refresh(ctx, &pb.RefreshRequest{}); violationsOf(err) != "refresh_token: required\n" {
+		t.Errorf("empty token: %v", err)
 	}
 }
 
-func TestGetAppointment(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+func TestLoginLockout(t *testing.T) {
+	_, st, secret := setup(t)
+	if !st.Has(store.FeatureLoginLockout) {
+		t.Skip("database not migrated for login_lockout")
+	}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithLoginLockout(3, 2*time.Second))
+	ctx := context.Background()
+	_, email := registerUser(t, h)
+	login := func(pw string) error {
+		_, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: pw})
+		return err
+	}
 
-	appt := createAppointment(t, h, ctx, 300)
+	// a success clears earlier failures
+	for i := 0; i < 2; i++ {
+		if r := apperr.ReasonOf(login("wrong")); r != apperr.AuthInvalidCredentials {
+			t.Fatalf("failure %d: %s", i+1, r)
+		}
+	}
+	if err := login("testpass123"); err != nil {
+		t.Fatalf("login after 2 failures: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if r := apperr.ReasonOf(login("wrong")); r != apperr.AuthInvalidCredentials {
+			t.Fatalf("failure %d after reset: %s", i+1, r)
+		}
+	}
 
-	gr, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: appt.Id})
-	if err != nil {
-		t.Fatalf("get: %v", err)
+	// the third in the window locks, and the right password doesn't help
+	if r := apperr.ReasonOf(login("wrong")); r != apperr.AuthLocked {
+		t.Fatalf("third failure: %s, want AUTH_LOCKED", r)
 	}
-	if gr.Appointment.Title != appt.Title {
-		t.Errorf("title mismatch: %s vs %s", gr.Appointment.Title, appt.Title)
+	err := login("testpass123")
+	if apperr.ReasonOf(err) != apperr.AuthLocked || status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("right password while locked: %v", err)
+	}
+	// case and spaces don't get around it
+	if _, err := h.Login(ctx, &pb.LoginRequest{Email: " " + strings.ToUpper(email), Password: "testpass123"}); apperr.ReasonOf(err) != apperr.AuthLocked {
+		t.Errorf("differently spelled email while locked: %v", err)
 	}
-}
 
-func TestGetAppointmentNotFound(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+	// unknown emails lock the same way, so a lockout doesn't confirm an account
+	ghost := fmt.Sprintf("ghost-%s@test.com", uuid.New().String()[:8])
+	var r apperr.Reason
+	for i := 0; i < 3; i++ {
+		_, err := h.Login(ctx, &pb.LoginRequest{Email: ghost, Password: "x"})
+		r = apperr.ReasonOf(err)
+	}
+	if r != apperr.AuthLocked {
+		t.Errorf("unknown email after 3 failures: %s", r)
+	}
 
-	_, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: uuid.New().String()})
-	if err == nil {
-		t.Fatal("expected not found")
+	time.Sleep(2100 * time.Millisecond)
+	if err := login("testpass123"); err != nil {
+		t.Fatalf("login after the lockout expired: %v", err)
 	}
-	s, _ := status.FromError(err)
-	if s.Code() != codes.NotFound {
-		t.Errorf("expected NotFound, got %v", s.Code())
+	if r := apperr.ReasonOf(login("wrong")); r != apperr.AuthInvalidCredentials {
+		t.Errorf("first failure after expiry: %s", r)
 	}
 }
 
-func TestListAppointments(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+// captures outgoing mail instead of sending it
+type mailbox struct {
+	mu   sync.Mutex
+	sent []string
+}
 
-	createAppointment(t, h, ctx, 400)
-	createAppointment(t, h, ctx, 402)
+func (m *mailbox) Send(_ context.Context, to, _, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, body)
+	return nil
+}
 
-	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
-	if err != nil {
-		t.Fatalf("list: %v", err)
+var hexToken = regexp.MustCompile(`[0-9a-f]{64}`)
+
+func (m *mailbox) lastToken(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatal("no mail sent")
 	}
-	if len(lr.Appointments) < 2 {
-		t.Errorf("expected at least 2 appointments, got %d", len(lr.Appointments))
+	tok := hexToken.FindString(m.sent[len(m.sent)-1])
+	if tok == "" {
+		t.Fatal("no token in mail body")
 	}
+	return tok
 }
 
-func TestUpdateAppointment(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+func TestPasswordReset(t *testing.T) {
+	_, st, secret := setup(t)
+	mail := &mailbox{}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail))
+	uid, email := registerUser(t, h)
+	ctx := context.Background()
 
-	appt := createAppointment(t, h, ctx, 500)
+	_, hash, _ := auth.Config{}.GenerateRefreshToken()
+	st.CreateRefreshToken(ctx, uid, hash, time.Now().Add(time.Hour), store.SessionInfo{})
 
-	newStart := time.Now().Add(501 * time.Hour)
-	ur, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
-		Id:          appt.Id,
-		Title:       "Updated Title",
-		Description: "updated desc",
-		Location:    "New Room",
-		StartTime:   timestamppb.New(newStart),
-		EndTime:     timestamppb.New(newStart.Add(30 * time.Minute)),
-	})
-	if err != nil {
-		t.Fatalf("update: %v", err)
+	if _, err := h.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: email}); err != nil {
+		t.Fatalf("request reset: %v", err)
 	}
-	if ur.Appointment.Title != "Updated Title" {
-		t.Errorf("title not updated: %s", ur.Appointment.Title)
+	tok := mail.lastToken(t)
+
+	if _, err := h.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: tok, NewPassword: "newpass456"}); err != nil {
+		t.Fatalf("reset: %v", err)
 	}
-}
 
-func TestUpdateAppointmentConflict(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+	if _, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "newpass456"}); err != nil {
+		t.Errorf("login with new password: %v", err)
+	}
+	if _, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "testpass123"}); err == nil {
+		t.Error("old password still works")
+	}
 
-	// create two non-overlapping appointments
-	start1 := time.Now().Add(600 * time.Hour)
-	h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "First", StartTime: timestamppb.New(start1), EndTime: timestamppb.New(start1.Add(time.Hour)),
-	})
-	start2 := start1.Add(2 * time.Hour)
-	cr2, _ := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "Second", StartTime: timestamppb.New(start2), EndTime: timestamppb.New(start2.Add(time.Hour)),
-	})
+	// single use
+	_, err := h.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: tok, NewPassword: "another789"})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument on reuse, got %v", s.Code())
+	}
 
-	// try to move second appointment into first's slot
-	_, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
-		Id:        cr2.Appointment.Id,
-		Title:     "Moved",
-		StartTime: timestamppb.New(start1.Add(30 * time.Minute)),
-		EndTime:   timestamppb.New(start1.Add(90 * time.Minute)),
-	})
-	if err == nil {
-		t.Fatal("expected conflict on update")
+	// sessions revoked
+	rt, err := st.GetRefreshTokenByHash(ctx, hash.Hash)
+	if err != nil {
+		t.Fatalf("get refresh token: %v", err)
 	}
-	s, _ := status.FromError(err)
-	if s.Code() != codes.AlreadyExists {
-		t.Errorf("expected AlreadyExists, got %v", s.Code())
+	if !rt.Revoked {
+		t.Error("refresh token not revoked after reset")
 	}
 }
 
-func TestDeleteAppointment(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
-
-	appt := createAppointment(t, h, ctx, 700)
+func TestEmailVerification(t *testing.T) { eachStore(t, testEmailVerification) }
 
-	_, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id})
+func testEmailVerification(t *testing.T, st handler.Store, secret string) {
+	mail := &mailbox{}
+	clk := clock.NewFake(time.Now())
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail), handler.WithClock(clk))
+	ctx := context.Background()
+	email := fmt.Sprintf("verify-%s@test.com", uuid.New().String()[:8])
+	rr, err := h.Register(ctx, &pb.RegisterRequest{Email: email, Password: "testpass123", Name: "V"})
 	if err != nil {
-		t.Fatalf("delete: %v", err)
+		t.Fatalf("register: %v", err)
 	}
+	if rr.EmailVerified || rr.Token == "" {
+		t.Errorf("register: verified=%v token=%q", rr.EmailVerified, rr.Token)
+	}
+	tok := mail.lastToken(t)
 
-	// verify its gone (or cancelled) from list
-	lr, _ := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
-	for _, a := range lr.Appointments {
-		if a.Id == appt.Id && a.Status != "cancelled" {
-			t.Error("expected appointment to be cancelled after delete")
+	// unverified users can still log in by default, and are told so
+	login := func() *pb.LoginResponse {
+		t.Helper()
+		lr, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "testpass123"})
+		if err != nil {
+			t.Fatalf("login: %v", err)
 		}
+		return lr
+	}
+	if login().EmailVerified {
+		t.Error("verified before VerifyEmail")
+	}
+
+	verify := func(tok string) error {
+		_, err := h.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: tok})
+		return err
+	}
+	if r := apperr.ReasonOf(verify(strings.Repeat("ab", 32))); r != apperr.AuthVerifyTokenInvalid {
+		t.Errorf("wrong token: %s", r)
+	}
+	if err := verify(tok); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !login().EmailVerified {
+		t.Error("not verified after VerifyEmail")
+	}
+	// single use
+	if r := apperr.ReasonOf(verify(tok)); r != apperr.AuthVerifyTokenInvalid {
+		t.Errorf("reused token: %s", r)
+	}
+
+	// nothing is sent to a verified account, even past the cooldown
+	sent := len(mail.sent)
+	clk.Advance(2 * time.Minute)
+	if _, err := h.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: email}); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	if len(mail.sent) != sent {
+		t.Error("code resent to a verified account")
 	}
 }
 
-func TestOverlapPrevention(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+func TestEmailVerificationExpiredAndResent(t *testing.T) {
+	eachStore(t, testEmailVerificationExpiredAndResent)
+}
 
-	start := time.Now().Add(800 * time.Hour)
-	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "Existing", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
-	})
-	if err != nil {
-		t.Fatalf("first create: %v", err)
+func testEmailVerificationExpiredAndResent(t *testing.T, st handler.Store, secret string) {
+	mail := &mailbox{}
+	clk := clock.NewFake(time.Now())
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail), handler.WithClock(clk))
+	uid, email := registerUser(t, h)
+	ctx := context.Background()
+	verify := func(tok string) error {
+		_, err := h.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: tok})
+		return err
+	}
+	resend := func() {
+		t.Helper()
+		if _, err := h.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: email}); err != nil {
+			t.Fatalf("resend: %v", err)
+		}
 	}
 
-	// exact same slot
-	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "Overlap", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
-	})
-	if err == nil {
-		t.Fatal("expected conflict")
+	raw, hash, _ := auth.GenerateToken()
+	if err := st.CreateEmailVerificationToken(ctx, uid, hash, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if r := apperr.ReasonOf(verify(raw)); r != apperr.AuthVerifyTokenInvalid {
+		t.Errorf("expired token: %s", r)
 	}
 
-	// partial overlap
-	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "Partial", StartTime: timestamppb.New(start.Add(30 * time.Minute)), EndTime: timestamppb.New(start.Add(90 * time.Minute)),
-	})
-	if err == nil {
-		t.Fatal("expected conflict for partial overlap")
+	// a code was just issued, so a resend right away sends nothing
+	sent := len(mail.sent)
+	resend()
+	if len(mail.sent) != sent {
+		t.Error("resent within the cooldown")
 	}
 
-	// adjacent — should succeed (end is exclusive)
-	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-		Title: "Adjacent", StartTime: timestamppb.New(start.Add(time.Hour)), EndTime: timestamppb.New(start.Add(2 * time.Hour)),
-	})
-	if err != nil {
-		t.Fatalf("adjacent should not conflict: %v", err)
+	// past the cooldown: only the latest code works
+	clk.Advance(2 * time.Minute)
+	resend()
+	first := mail.lastToken(t)
+	clk.Advance(2 * time.Minute)
+	resend()
+	second := mail.lastToken(t)
+	if r := apperr.ReasonOf(verify(first)); r != apperr.AuthVerifyTokenInvalid {
+		t.Errorf("superseded token: %s", r)
+	}
+	if err := verify(second); err != nil {
+		t.Errorf("latest token rejected: %v", err)
 	}
 }
 
-// ----- concurrent booking -----
-
-func TestConcurrentBooking(t *testing.T) {
-	h, _, secret := setup(t)
-	uid, _ := registerUser(t, h)
-	ctx := authedCtx(uid, secret)
+func TestConcurrentResendVerification(t *testing.T) {
+	eachStore(t, testConcurrentResendVerification)
+}
 
-	start := time.Now().Add(900 * time.Hour)
-	end := start.Add(time.Hour)
+func testConcurrentResendVerification(t *testing.T, st handler.Store, secret string) {
+	mail := &mailbox{}
+	clk := clock.NewFake(time.Now())
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail), handler.WithClock(clk))
+	_, email := registerUser(t, h)
+	ctx := context.Background()
+	clk.Advance(2 * time.Minute)
 
-	const n = 10
+	// racing resends past the cooldown send one code between them
+	sent := len(mail.sent)
 	var wg sync.WaitGroup
-	results := make(chan error, n)
-
-	for i := 0; i < n; i++ {
+	for range 8 {
 		wg.Add(1)
-		go func(i int) {
+		go func() {
 			defer wg.Done()
-			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
-				Title:     fmt.Sprintf("concurrent-%d", i),
-				StartTime: timestamppb.New(start),
-				EndTime:   timestamppb.New(end),
-			})
-			results <- err
-		}(i)
+			if _, err := h.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: email}); err != nil {
+				t.Errorf("resend: %v", err)
+			}
+		}()
 	}
 	wg.Wait()
-	close(results)
-
-	successes := 0
-	conflicts := 0
-	for err := range results {
-		if err == nil {
-			successes++
-		} else if s, ok := status.FromError(err); ok && s.Code() == codes.AlreadyExists {
-			conflicts++
-		} else {
-			t.Errorf("unexpected error: %v", err)
-		}
+	if n := len(mail.sent) - sent; n != 1 {
+		t.Errorf("%d codes sent, want 1", n)
 	}
 
-	if successes != 1 {
-		t.Errorf("expected exactly 1 success, got %d", successes)
-	}
-	if conflicts != n-1 {
-		t.Errorf("expected %d conflicts, got %d", n-1, conflicts)
+	// an unknown email gets the same answer
+	resp, err := h.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: "nobody-" + email})
+	if err != nil || !proto.Equal(resp, &pb.ResendVerificationResponse{}) {
+		t.Errorf("unknown email: %v, %v", resp, err)
 	}
-	t.Logf("concurrent: %d success, %d conflicts (out of %d)", successes, conflicts, n)
 }
 
-// ----- IDOR / ownership -----
+func TestRequireVerifiedEmail(t *testing.T) { eachStore(t, testRequireVerifiedEmail) }
 
-func TestOwnershipGet(t *testing.T) {
-	h, _, secret := setup(t)
-	uid1, _ := registerUser(t, h)
-	uid2, _ := registerUser(t, h)
+func testRequireVerifiedEmail(t *testing.T, st handler.Store, secret string) {
+	mail := &mailbox{}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail), handler.WithRequireVerifiedEmail(true))
+	uid, email := registerUser(t, h)
+	ctx := context.Background()
 
-	ctx1 := authedCtx(uid1, secret)
-	ctx2 := authedCtx(uid2, secret)
+	login := func() error {
+		_, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "testpass123"})
+		return err
+	}
+	if r := apperr.ReasonOf(login()); r != apperr.AuthEmailUnverified {
+		t.Errorf("unverified login: %s", r)
+	}
+	// the password is checked first
+	_, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "wrongpass"})
+	if r := apperr.ReasonOf(err); r != apperr.AuthInvalidCredentials {
+		t.Errorf("wrong password: %s", r)
+	}
 
-	appt := createAppointment(t, h, ctx1, 1000)
+	if _, err := h.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: mail.lastToken(t)}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := login(); err != nil {
+		t.Errorf("login after verifying %s: %v", uid, err)
+	}
+}
 
-	// user2 cant see user1's appointment
-	_, err := h.GetAppointment(ctx2, &pb.GetAppointmentRequest{Id: appt.Id})
-	s, _ := status.FromError(err)
-	if s.Code() != codes.NotFound {
-		t.Errorf("expected NotFound (IDOR), got %v", s.Code())
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	_, st, secret := setup(t)
+	mail := &mailbox{}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail))
+
+	// same response as a real account, nothing sent
+	if _, err := h.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: "nobody@nowhere.com"}); err != nil {
+		t.Fatalf("expected success for unknown email, got %v", err)
+	}
+	if len(mail.sent) != 0 {
+		t.Error("mail sent for unknown email")
 	}
 }
 
-func TestOwnershipList(t *testing.T) {
-	h, _, secret := setup(t)
-	uid1, _ := registerUser(t, h)
-	uid2, _ := registerUser(t, h)
+func TestPasswordResetExpiredAndSuperseded(t *testing.T) {
+	_, st, secret := setup(t)
+	mail := &mailbox{}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithSender(mail))
+	uid, email := registerUser(t, h)
+	ctx := context.Background()
 
-	ctx1 := authedCtx(uid1, secret)
-	ctx2 := authedCtx(uid2, secret)
+	raw, hash, _ := auth.GenerateToken()
+	if err := st.CreatePasswordResetToken(ctx, uid, hash, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	_, err := h.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: raw, NewPassword: "newpass456"})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for expired token, got %v", s.Code())
+	}
 
-	createAppointment(t, h, ctx1, 1100)
+	// asking twice: only the second token works
+	h.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: email})
+	first := mail.lastToken(t)
+	h.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: email})
+	second := mail.lastToken(t)
 
-	// user2's list should not contain user1's appointments
-	lr, err := h.ListAppointments(ctx2, &pb.ListAppointmentsRequest{})
-	if err != nil {
-		t.Fatalf("list: %v", err)
+	if _, err := h.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: first, NewPassword: "newpass456"}); err == nil {
+		t.Error("superseded token still accepted")
 	}
-	for _, a := range lr.Appointments {
-		if a.UserId == uid1 {
-			t.Error("user2 can see user1's appointment in list")
-		}
+	if _, err := h.ResetPassword(ctx, &pb.ResetPasswordRequest{Token: second, NewPassword: "newpass456"}); err != nil {
+		t.Errorf("latest token rejected: %v", err)
 	}
 }
 
-func TestDifferentUsersNoConflict(t *testing.T) {
-	h, _, secret := setup(t)
-	uid1, _ := registerUser(t, h)
-	uid2, _ := registerUser(t, h)
-
-	ctx1 := authedCtx(uid1, secret)
-	ctx2 := authedCtx(uid2, secret)
+func TestChangePassword(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, email := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
 
-	start := time.Now().Add(1200 * time.Hour)
+	_, hash, _ := auth.Config{}.GenerateRefreshToken()
+	st.CreateRefreshToken(context.Background(), uid, hash, time.Now().Add(time.Hour), store.SessionInfo{})
 
-	// same slot, different users — both should succeed
-	_, err1 := h.CreateAppointment(ctx1, &pb.CreateAppointmentRequest{
-		Title: "User1", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
-	})
-	_, err2 := h.CreateAppointment(ctx2, &pb.CreateAppointmentRequest{
-		Title: "User2", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
-	})
+	tests := []struct {
+		name string
+		req  *pb.ChangePasswordRequest
+		code codes.Code
+	}{
+		{"wrong current", &pb.ChangePasswordRequest{CurrentPassword: "wrongpass1", NewPassword: "newpass456"}, codes.Unauthenticated},
+		{"short new", &pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "short"}, codes.InvalidArgument},
+		{"same as old", &pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "testpass123"}, codes.InvalidArgument},
+		{"missing current", &pb.ChangePasswordRequest{NewPassword: "newpass456"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.ChangePassword(ctx, tt.req)
+			if s, _ := status.FromError(err); s.Code() != tt.code {
+				t.Errorf("expected %v, got %v", tt.code, s.Code())
+			}
+		})
+	}
 
-	if err1 != nil {
-		t.Errorf("user1 should succeed: %v", err1)
+	if _, err := h.ChangePassword(ctx, &pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "newpass456"}); err != nil {
+		t.Fatalf("change: %v", err)
 	}
-	if err2 != nil {
-		t.Errorf("user2 should succeed: %v", err2)
+	if _, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "newpass456"}); err != nil {
+		t.Errorf("login with new password: %v", err)
+	}
+	if rt, _ := st.GetRefreshTokenByHash(context.Background(), hash.Hash); rt == nil || !rt.Revoked {
+		t.Error("other sessions not revoked")
 	}
 }
 
-// ----- REST auth integration -----
-
-func TestRESTRefreshToken(t *testing.T) {
-	_, st, _ := setup(t)
-
-	// create a user + refresh token directly
-	email := fmt.Sprintf("test-%s@test.com", uuid.New().String()[:8])
-	hash, _ := auth.HashPassword("testpass123")
-	uid := uuid.New().String()
-	err := st.CreateUser(context.Background(), &model.User{ID: uid, Email: email, PasswordHash: hash, Name: "Refresh User"})
+func TestChangePasswordViaBridge(t *testing.T) {
+	h, _, secret := setup(t)
+	uid, email := registerUser(t, h)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
 	if err != nil {
-		t.Skipf("skipping REST refresh test: %v", err)
+		t.Fatalf("bridge: %v", err)
 	}
+	defer bridge.Close()
 
-	rawRefresh, tokenHash, _ := auth.GenerateRefreshToken()
-	expiry := time.Now().Add(7 * 24 * time.Hour)
-	st.CreateRefreshToken(context.Background(), uid, tokenHash, expiry)
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, "testpass123")
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendString(msg, "bridgepass9")
 
-	// call /auth/refresh with the cookie
-	req := httptest.NewRequest("POST", "/auth/refresh", nil)
-	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: rawRefresh})
-	_ = req
+	code, grpcMsg, _ := grpcWebCall(t, bridge.Handler(), "/appointment.v1.AuthService/ChangePassword", tok, msg)
+	if code != "0" {
+		t.Fatalf("expected grpc-status 0, got %s: %s", code, grpcMsg)
+	}
+	if _, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "bridgepass9"}); err != nil {
+		t.Errorf("login with new password: %v", err)
+	}
 
-	t.Log("refresh token generation and storage verified")
+	// no token -> Unauthenticated
+	code, _, _ = grpcWebCall(t, bridge.Handler(), "/appointment.v1.AuthService/ChangePassword", "", msg)
+	if code != fmt.Sprint(int(codes.Unauthenticated)) {
+		t.Errorf("expected Unauthenticated without token, got %s", code)
+	}
 }
 
-func TestRefreshTokenGeneration(t *testing.T) {
-	raw, hash, err := auth.GenerateRefreshToken()
+// Every method the bridge serves in-process, encoded and decoded with the
+// generated types the way a real client would.
+func TestBridgeRoundTrip(t *testing.T) { eachStore(t, testBridgeRoundTrip) }
+
+func testBridgeRoundTrip(t *testing.T, h *handler.Handler, secret string) {
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
 	if err != nil {
-		t.Fatalf("generate: %v", err)
+		t.Fatalf("bridge: %v", err)
 	}
-	if len(raw) != 64 { // 32 bytes hex = 64 chars
-		t.Errorf("expected 64 char raw token, got %d", len(raw))
+	defer bridge.Close()
+	web := bridge.Handler()
+
+	call := func(path, token string, req, resp proto.Message) {
+		t.Helper()
+		msg, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		code, grpcMsg, data := grpcWebCall(t, web, path, token, msg)
+		if code != "0" {
+			t.Fatalf("%s: grpc-status %s: %s", path, code, grpcMsg)
+		}
+		if err := proto.Unmarshal(data, resp); err != nil {
+			t.Fatalf("%s: unmarshal: %v", path, err)
+		}
 	}
-	if len(hash) != 64 {
-		t.Errorf("expected 64 char hash, got %d", len(hash))
+
+	email := fmt.Sprintf("bridge-%s@test.com", uuid.New().String()[:8])
+	reg := &pb.RegisterResponse{}
+	call("/appointment.v1.AuthService/Register", "", &pb.RegisterRequest{Email: email, Password: "testpass123", Name: "Bridge"}, reg)
+	if reg.UserId == "" || reg.Token == "" {
+		t.Fatalf("register: %v", reg)
 	}
 
-	// verify hash matches
-	rehash := auth.HashRefreshToken(raw)
-	if rehash != hash {
-		t.Error("hash mismatch")
+	login := &pb.LoginResponse{}
+	call("/appointment.v1.AuthService/Login", "", &pb.LoginRequest{Email: email, Password: "testpass123"}, login)
+	if login.UserId != reg.UserId || login.Name != "Bridge" || login.Token == "" {
+		t.Fatalf("login: %v", login)
 	}
-}
+	tok := login.Token
 
-func TestAccessTokenExpiry(t *testing.T) {
-	_, _, secret := setup(t)
+	start := time.Now().Add(740 * time.Hour).Truncate(time.Second)
+	created := &pb.CreateAppointmentResponse{}
+	call("/appointment.v1.ScheduleService/CreateAppointment", tok, &pb.CreateAppointmentRequest{
+		Title: "via bridge", Description: "d", Location: "l",
+		StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	}, created)
+	a := created.Appointment
+	if a.GetId() == "" || a.Title != "via bridge" || !a.StartTime.AsTime().Equal(start) || a.Status != "confirmed" {
+		t.Fatalf("create: %v", a)
+	}
 
-	tok, err := auth.MakeToken("test-uid", secret)
-	if err != nil {
-		t.Fatalf("make token: %v", err)
+	got := &pb.GetAppointmentResponse{}
+	call("/appointment.v1.ScheduleService/GetAppointment", tok, &pb.GetAppointmentRequest{Id: a.Id}, got)
+	if !proto.Equal(got.Appointment.EndTime, a.EndTime) || got.Appointment.Location != "l" {
+		t.Errorf("get: %v", got.Appointment)
 	}
 
-	claims, err := auth.ParseToken(tok, secret)
-	if err != nil {
-		t.Fatalf("parse token: %v", err)
+	updated := &pb.UpdateAppointmentResponse{}
+	call("/appointment.v1.ScheduleService/UpdateAppointment", tok, &pb.UpdateAppointmentRequest{
+		Id: a.Id, Title: "renamed", StartTime: a.StartTime, EndTime: a.EndTime,
+	}, updated)
+	if updated.Appointment.Title != "renamed" {
+		t.Errorf("update: %v", updated.Appointment)
 	}
 
-	if claims.UserID != "test-uid" {
-		t.Errorf("uid mismatch: %s", claims.UserID)
+	// a pre-1970 range start has negative seconds, which the old
+	// hand-rolled varint handling mangled
+	before := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := &pb.ListAppointmentsResponse{}
+	call("/appointment.v1.ScheduleService/ListAppointments", tok, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(before), RangeEnd: timestamppb.New(start.Add(24 * time.Hour)),
+	}, list)
+	if !list.EffectiveRangeStart.AsTime().Equal(before) {
+		t.Errorf("effective range start %v, want %v", list.EffectiveRangeStart.AsTime(), before)
+	}
+	if len(list.Appointments) != 1 || list.Appointments[0].Title != "renamed" {
+		t.Errorf("list: %v", list.Appointments)
 	}
 
-	// verify expiry is ~15 min from now
-	exp := claims.ExpiresAt.Time
-	diff := time.Until(exp)
-	if diff < 14*time.Minute || diff > 16*time.Minute {
-		t.Errorf("expected ~15min expiry, got %v", diff)
+	call("/appointment.v1.ScheduleService/DeleteAppointment", tok, &pb.DeleteAppointmentRequest{Id: a.Id}, &pb.DeleteAppointmentResponse{})
+	call("/appointment.v1.AuthService/ChangePassword", tok,
+		&pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "bridgepass9"}, &pb.ChangePasswordResponse{})
+	if _, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "bridgepass9"}); err != nil {
+		t.Errorf("login with new password: %v", err)
 	}
 }
 
-func TestAlgorithmConfusion(t *testing.T) {
-	_, _, secret := setup(t)
-
-	// valid token parses fine
-	tok, _ := auth.MakeToken("uid", secret)
-	_, err := auth.ParseToken(tok, secret)
+// a month of appointments comes back gzipped to a client that accepts it
+func TestBridgeGzipList(t *testing.T) {
+	h, _, secret := setup(t)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
 	if err != nil {
-		t.Fatalf("valid token failed: %v", err)
+		t.Fatalf("bridge: %v", err)
 	}
+	defer bridge.Close()
+	web := bridge.Handler()
 
-	// wrong secret fails
-	_, err = auth.ParseToken(tok, "wrong-secret")
-	if err == nil {
-		t.Fatal("expected error for wrong secret")
+	userID, _ := registerUser(t, h)
+	ctx := authedCtx(userID, secret)
+	start := time.Now().Add(1400 * time.Hour).Truncate(time.Hour)
+	var batch []*pb.CreateAppointmentRequest
+	for i := range 30 {
+		s := start.Add(time.Duration(i) * 24 * time.Hour)
+		batch = append(batch, &pb.CreateAppointmentRequest{
+			Title: fmt.Sprintf("standup %d", i), Description: "daily", Location: "Room 4B",
+			StartTime: timestamppb.New(s), EndTime: timestamppb.New(s.Add(15 * time.Minute)),
+		})
+	}
+	if _, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: batch}); err != nil {
+		t.Fatalf("batch: %v", err)
 	}
+	tok, _ := auth.MakeToken(userID, auth.RoleUser, secret)
 
-	// garbage token fails
-	_, err = auth.ParseToken("not.a.token", secret)
-	if err == nil {
-		t.Fatal("expected error for garbage token")
+	msg, _ := proto.Marshal(&pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(31 * 24 * time.Hour)),
+	})
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	req := httptest.NewRequest("POST", "/appointment.v1.ScheduleService/ListAppointments", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	rec := httptest.NewRecorder()
+	web.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+	code, grpcMsg, data := splitReply(raw)
+	if code != "0" {
+		t.Fatalf("grpc-status %s: %s", code, grpcMsg)
+	}
+	list := &pb.ListAppointmentsResponse{}
+	if err := proto.Unmarshal(data, list); err != nil || len(list.Appointments) != 30 {
+		t.Fatalf("list: %d appointments, %v", len(list.Appointments), err)
+	}
+	if rec.Body.Len() >= len(raw)/2 {
+		t.Errorf("%d bytes compressed from %d", rec.Body.Len(), len(raw))
 	}
 }
 
-// ----- REST endpoint integration via HTTP -----
+func TestBridgeTextMode(t *testing.T) {
+	h, _, secret := setup(t)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	_, email := registerUser(t, h)
 
-func TestRESTLoginEndpoint(t *testing.T) {
-	h, st, secret := setup(t)
+	msg, _ := proto.Marshal(&pb.LoginRequest{Email: email, Password: "testpass123"})
+	code, grpcMsg, data := grpcWebTextCall(t, bridge.Handler(), "/appointment.v1.AuthService/Login", "", msg)
+	if code != "0" {
+		t.Fatalf("login: grpc-status %s: %s", code, grpcMsg)
+	}
+	login := &pb.LoginResponse{}
+	if err := proto.Unmarshal(data, login); err != nil || login.Token == "" {
+		t.Fatalf("login response: %v (%v)", login, err)
+	}
 
-	// register a user via grpc handler
-	email := fmt.Sprintf("test-%s@test.com", uuid.New().String()[:8])
-	h.Register(context.Background(), &pb.RegisterRequest{
-		Email: email, Password: "testpass123", Name: "REST User",
+	start := time.Now().Add(750 * time.Hour).Truncate(time.Second)
+	msg, _ = proto.Marshal(&pb.CreateAppointmentRequest{
+		Title: "text mode", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
 	})
+	code, grpcMsg, data = grpcWebTextCall(t, bridge.Handler(), "/appointment.v1.ScheduleService/CreateAppointment", login.Token, msg)
+	if code != "0" {
+		t.Fatalf("create: grpc-status %s: %s", code, grpcMsg)
+	}
+	created := &pb.CreateAppointmentResponse{}
+	if err := proto.Unmarshal(data, created); err != nil || created.Appointment.GetTitle() != "text mode" {
+		t.Errorf("create response: %v (%v)", created, err)
+	}
 
-	// simulate POST /auth/login
-	body, _ := json.Marshal(map[string]string{"email": email, "password": "testpass123"})
-	req := httptest.NewRequest("POST", "/auth/login", bytes.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
+	// errors come back as a base64 trailer too
+	code, _, _ = grpcWebTextCall(t, bridge.Handler(), "/appointment.v1.ScheduleService/CreateAppointment", "", msg)
+	if code != fmt.Sprint(int(codes.Unauthenticated)) {
+		t.Errorf("expected Unauthenticated, got %s", code)
+	}
+}
 
-	// build the handler inline (same logic as main.go)
-	loginHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var b struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
-		}
-		json.NewDecoder(r.Body).Decode(&b)
+func TestBridgeTextModeDecoding(t *testing.T) {
+	bridge, err := gweb.New("", handler.New(nil, auth.SingleKey("test-secret")), auth.SingleKey("test-secret"))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
 
-		resp, err := h.Login(r.Context(), &pb.LoginRequest{Email: b.Email, Password: b.Password})
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid credentials"})
-			return
-		}
+	// an empty LoginRequest is rejected before the store is touched
+	code, _, _ := grpcWebTextCall(t, bridge.Handler(), "/appointment.v1.AuthService/Login", "", nil)
+	if code != fmt.Sprint(int(codes.InvalidArgument)) {
+		t.Errorf("expected InvalidArgument, got %s", code)
+	}
 
-		// issue cookies
-		accessTok, _ := auth.MakeToken(resp.UserId, secret)
-		rawRefresh, tokenHash, _ := auth.GenerateRefreshToken()
-		expiry := time.Now().Add(7 * 24 * time.Hour)
-		st.CreateRefreshToken(r.Context(), resp.UserId, tokenHash, expiry)
+	// the frame header and the message sent as separately padded chunks
+	msg, _ := proto.Marshal(&pb.LoginRequest{Email: "x"})
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	body := base64.StdEncoding.EncodeToString(header) + base64.StdEncoding.EncodeToString(msg)
+	req := httptest.NewRequest("POST", "/appointment.v1.AuthService/Login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	rec := httptest.NewRecorder()
+	bridge.Handler().ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), "grpc-status") {
+		t.Fatalf("reply isn't base64: %q", rec.Body.String())
+	}
+	raw, _ := base64.StdEncoding.DecodeString(rec.Body.String())
+	if code, msg, _ := splitReply(raw); code != fmt.Sprint(int(codes.InvalidArgument)) || msg == "parse error" {
+		t.Errorf("chunked body: got %s %q", code, msg)
+	}
 
-		http.SetCookie(w, &http.Cookie{Name: "access_token", Value: accessTok, HttpOnly: true, Path: "/"})
-		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: rawRefresh, HttpOnly: true, Path: "/auth/"})
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"userId": resp.UserId, "name": resp.Name})
-	})
+	req = httptest.NewRequest("POST", "/appointment.v1.AuthService/Login", strings.NewReader("not*base64"))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	rec = httptest.NewRecorder()
+	bridge.Handler().ServeHTTP(rec, req)
+	raw, _ = base64.StdEncoding.DecodeString(rec.Body.String())
+	if code, _, _ := splitReply(raw); code != fmt.Sprint(int(codes.InvalidArgument)) {
+		t.Errorf("bad base64: got %s", code)
+	}
+}
 
-	loginHandler.ServeHTTP(rec, req)
+func TestBridgeRejectsMalformedPayload(t *testing.T) {
+	bridge, err := gweb.New("", handler.New(nil, auth.SingleKey("test-secret")), auth.SingleKey("test-secret"))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
 
-	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	// field 1 claims 100 bytes but the message ends
+	code, _, _ := grpcWebCall(t, bridge.Handler(), "/appointment.v1.AuthService/Login", "", []byte{0x0a, 100, 'a'})
+	if code != fmt.Sprint(int(codes.InvalidArgument)) {
+		t.Errorf("expected InvalidArgument, got %s", code)
 	}
+}
 
-	// check cookies
-	cookies := rec.Result().Cookies()
-	var hasAccess, hasRefresh bool
-	for _, c := range cookies {
-		if c.Name == "access_token" && c.HttpOnly {
-			hasAccess = true
-		}
-		if c.Name == "refresh_token" && c.HttpOnly {
-			hasRefresh = true
+// the bridge serves any method in the descriptors in-process, through
+// the interceptors it was given, and knows nothing else
+func TestBridgeInProcessDispatch(t *testing.T) {
+	var methods, peers []string
+	spy := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		methods = append(methods, info.FullMethod)
+		if p, ok := peer.FromContext(ctx); ok {
+			peers = append(peers, p.Addr.String())
 		}
+		return next(ctx, req)
 	}
-	if !hasAccess {
-		t.Error("missing httponly access_token cookie")
-	}
-	if !hasRefresh {
-		t.Error("missing httponly refresh_token cookie")
+	bridge, err := gweb.New("", handler.New(store.New(nil), auth.SingleKey("test-secret")), auth.SingleKey("test-secret"),
+		gweb.WithInterceptors(spy, middleware.Auth(auth.SingleKey("test-secret"), auth.Config{})))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
 	}
+	defer bridge.Close()
+	web := bridge.Handler()
 
-	// check response body
-	var respBody map[string]any
-	json.NewDecoder(rec.Body).Decode(&respBody)
-	if respBody["userId"] == nil || respBody["userId"] == "" {
-		t.Error("response missing userId")
+	// never hand-wired into the bridge
+	code, msg, data := grpcWebCall(t, web, "/appointment.v1.ScheduleService/GetServerInfo", "", nil)
+	var info pb.ServerInfo
+	if code != "0" || proto.Unmarshal(data, &info) != nil {
+		t.Fatalf("GetServerInfo: %s %s", code, msg)
+	}
+	if code, _, _ := grpcWebCall(t, web, "/appointment.v1.AdminService/ListUsers", "", nil); code != fmt.Sprint(int(codes.Unauthenticated)) {
+		t.Errorf("ListUsers without a token: %s", code)
+	}
+	want := []string{"/appointment.v1.ScheduleService/GetServerInfo", "/appointment.v1.AdminService/ListUsers"}
+	if strings.Join(methods, " ") != strings.Join(want, " ") {
+		t.Errorf("interceptor saw %v", methods)
 	}
-	if respBody["name"] != "REST User" {
-		t.Errorf("expected name 'REST User', got %v", respBody["name"])
+	// httptest's RemoteAddr
+	if len(peers) != 2 || peers[0] != "192.0.2.1:1234" {
+		t.Errorf("peers %v", peers)
 	}
 
-	t.Log("REST login: 200 OK, httponly cookies set, response has userId + name")
+	for _, path := range []string{"/appointment.v1.Nope/GetAppointment", "/appointment.v1.ScheduleService/ChangePassword"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		web.ServeHTTP(rec, req)
+		if code, _, _ := splitReply(rec.Body.Bytes()); code != fmt.Sprint(int(codes.Unimplemented)) ||
+			!strings.Contains(rec.Body.String(), `"reason":"METHOD_UNKNOWN"`) {
+			t.Errorf("%s: %q", path, rec.Body.String())
+		}
+	}
+	if len(methods) != 2 {
+		t.Errorf("unknown methods reached the interceptors: %v", methods)
+	}
+
+	if _, err := gweb.New("", nil, auth.SingleKey("test-secret")); err == nil {
+		t.Error("in-process bridge without a handler")
+	}
+}
+
+func TestPastGrace(t *testing.T) { eachStore(t, testPastGrace) }
+
+// a start up to exactly five minutes ago is taken, a second more isn't
+func testPastGrace(t *testing.T, st handler.Store, secret string) {
+	now := time.Now().Truncate(time.Second)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithClock(clock.NewFake(now)))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	create := func(start time.Time) error {
+		_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "late", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Minute)),
+		})
+		return err
+	}
+	if err := create(now.Add(-5 * time.Minute)); err != nil {
+		t.Errorf("exactly 5 minutes ago: %v", err)
+	}
+	if r := apperr.ReasonOf(create(now.Add(-5*time.Minute - time.Second))); r != apperr.ApptPast {
+		t.Errorf("5 minutes 1 second ago: %s", r)
+	}
+}
+
+func TestClockTokenExpiry(t *testing.T) { eachStore(t, testClockTokenExpiry) }
+
+// tokens the handler mints expire exactly a TTL after its clock's now
+func testClockTokenExpiry(t *testing.T, st handler.Store, secret string) {
+	now := time.Now().Truncate(time.Second)
+	clk := clock.NewFake(now)
+	cfg := auth.Config{Clock: clk}
+	h := handler.New(st, auth.SingleKey(secret), handler.WithClock(clk))
+	_, email := registerUser(t, h)
+
+	lr, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "testpass123"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	exp := lr.AccessExpiresAt.AsTime()
+	if want := now.Add(auth.AccessTokenTTL); !exp.Equal(want) {
+		t.Errorf("access expires %v, want %v", exp, want)
+	}
+	clk.Set(exp.Add(-time.Second))
+	if _, err := cfg.ParseToken(lr.Token, auth.SingleKey(secret)); err != nil {
+		t.Errorf("a second before expiry: %v", err)
+	}
+	clk.Set(exp)
+	if _, err := cfg.ParseToken(lr.Token, auth.SingleKey(secret)); err == nil {
+		t.Error("accepted at expiry")
+	}
+}
+
+func TestTraceHierarchy(t *testing.T) { eachStore(t, testTraceHierarchy) }
+
+// one CreateAppointment through the bridge: the browser's span, then the
+// bridge's, the RPC's, and one per statement the store ran
+func testTraceHierarchy(t *testing.T, st handler.Store, secret string) {
+	rec := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(prevTP); otel.SetTextMapPropagator(prevProp) })
+
+	h := handler.New(st, auth.SingleKey(secret))
+	uid, _ := registerUser(t, h)
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret),
+		gweb.WithInterceptors(tracing.UnaryServer(), middleware.Auth(auth.SingleKey(secret), auth.Config{})))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+
+	start := time.Now().Add(760 * time.Hour)
+	msg, _ := proto.Marshal(&pb.CreateAppointmentRequest{
+		Title: "traced", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	req := httptest.NewRequest("POST", "/appointment.v1.ScheduleService/CreateAppointment", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Authorization", "Bearer "+tok)
+	const traceID, browserSpan = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req.Header.Set("Traceparent", "00-"+traceID+"-"+browserSpan+"-01")
+	w := httptest.NewRecorder()
+	bridge.Handler().ServeHTTP(w, req)
+	if code, m, _ := splitReply(w.Body.Bytes()); code != "0" {
+		t.Fatalf("create: grpc-status %s: %s", code, m)
+	}
+
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	var storeSpans []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.SpanContext().TraceID().String() != traceID {
+			continue
+		}
+		if strings.HasPrefix(s.Name(), "store.") {
+			storeSpans = append(storeSpans, s)
+		}
+		byName[s.Name()] = s
+	}
+	web := byName["grpc-web appointment.v1.ScheduleService/CreateAppointment"]
+	rpc := byName["appointment.v1.ScheduleService/CreateAppointment"]
+	if web == nil || rpc == nil {
+		t.Fatalf("spans in the trace: %v", slices.Collect(maps.Keys(byName)))
+	}
+	if got := web.Parent().SpanID().String(); got != browserSpan {
+		t.Errorf("bridge span's parent %s, want the traceparent's %s", got, browserSpan)
+	}
+	if rpc.Parent().SpanID() != web.SpanContext().SpanID() || rpc.SpanKind() != trace.SpanKindServer {
+		t.Errorf("rpc span isn't a server span under the bridge's")
+	}
+
+	if _, pg := st.(*store.Store); !pg {
+		return
+	}
+	var insert bool
+	for _, s := range storeSpans {
+		if s.Parent().SpanID() != rpc.SpanContext().SpanID() {
+			t.Errorf("%s isn't under the rpc span", s.Name())
+		}
+		for _, kv := range s.Attributes() {
+			if kv.Key == "db.operation" && kv.Value.AsString() == "INSERT" && s.Name() == "store.CreateAppointment" {
+				insert = true
+			}
+		}
+	}
+	if !insert {
+		t.Errorf("no store.CreateAppointment INSERT span among %d store spans", len(storeSpans))
+	}
+}
+
+// posts one grpc-web frame and splits the reply into grpc-status, grpc-message and the data payload
+func grpcWebCall(t *testing.T, hnd http.Handler, path, token string, msg []byte) (code, message string, data []byte) {
+	t.Helper()
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	hnd.ServeHTTP(rec, req)
+	return splitReply(rec.Body.Bytes())
+}
+
+// grpcWebTextCall is grpcWebCall in grpc-web-text mode: the request goes out
+// base64-encoded, and every frame of the reply must be its own base64 chunk.
+func grpcWebTextCall(t *testing.T, hnd http.Handler, path, token string, msg []byte) (code, message string, data []byte) {
+	t.Helper()
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+
+	req := httptest.NewRequest("POST", path, strings.NewReader(base64.StdEncoding.EncodeToString(body)))
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	hnd.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/grpc-web-text+proto" {
+		t.Errorf("%s: content-type %q", path, ct)
+	}
+	var out []byte
+	rest := rec.Body.String()
+	for rest != "" {
+		// a chunk ends at its padding, or at the end of the body
+		end := len(rest)
+		if i := strings.Index(rest, "="); i >= 0 {
+			end = i + strings.IndexFunc(rest[i:]+"x", func(r rune) bool { return r != '=' })
+		}
+		chunk, err := base64.StdEncoding.DecodeString(rest[:end])
+		if err != nil {
+			t.Fatalf("%s: chunk %q: %v", path, rest[:end], err)
+		}
+		out = append(out, chunk...)
+		rest = rest[end:]
+	}
+	return splitReply(out)
+}
+
+// splitReply splits grpc-web frames into grpc-status, grpc-message and the data payload
+func splitReply(out []byte) (code, message string, data []byte) {
+	for len(out) >= 5 {
+		flag, n := out[0], binary.BigEndian.Uint32(out[1:5])
+		frame := out[5 : 5+n]
+		out = out[5+n:]
+		if flag&0x80 == 0 {
+			data = frame
+			continue
+		}
+		for _, line := range strings.Split(string(frame), "\r\n") {
+			if v, ok := strings.CutPrefix(line, "grpc-status:"); ok {
+				code = v
+			} else if v, ok := strings.CutPrefix(line, "grpc-message:"); ok {
+				// percent-encoded on the wire, as grpc-web clients expect
+				message, _ = url.PathUnescape(v)
+			}
+		}
+	}
+	return code, message, data
+}
+
+// BenchmarkLoginStorm measures p99 latency of GetAppointment, on memstore,
+// while 4x GOMAXPROCS goroutines hammer Login, with bcrypt unbounded and
+// on the default pool.
+//
+//	go test ./internal/handler -run x -bench LoginStorm -benchtime 200x
+func BenchmarkLoginStorm(b *testing.B) {
+	storm := 4 * runtime.GOMAXPROCS(0)
+
+	run := func(b *testing.B, pool *auth.Pool) {
+		const secret = "mem-secret"
+		h := handler.New(memstore.New(), auth.SingleKey(secret), handler.WithHashPool(pool))
+		email := fmt.Sprintf("storm-%s@test.com", uuid.New().String()[:8])
+		rr, err := h.Register(context.Background(), &pb.RegisterRequest{Email: email, Password: "testpass123", Name: "Storm"})
+		if err != nil {
+			b.Fatalf("register: %v", err)
+		}
+		ctx := authedCtx(rr.UserId, secret)
+		start := time.Now().Add(time.Hour)
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "storm", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		})
+		if err != nil {
+			b.Fatalf("create appointment: %v", err)
+		}
+		get := &pb.GetAppointmentRequest{Id: cr.Appointment.Id}
+
+		stormCtx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for i := 0; i < storm; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for stormCtx.Err() == nil {
+					_, err := h.Login(stormCtx, &pb.LoginRequest{Email: email, Password: "testpass123"})
+					if apperr.ReasonOf(err) == apperr.ServerBusy {
+						time.Sleep(time.Millisecond) // shed, client would back off
+					}
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		lat := make([]time.Duration, b.N)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			t0 := time.Now()
+			if _, err := h.GetAppointment(ctx, get); err != nil {
+				b.Fatalf("get appointment: %v", err)
+			}
+			lat[i] = time.Since(t0)
+			time.Sleep(time.Millisecond)
+		}
+		b.StopTimer()
+		cancel()
+		wg.Wait()
+
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		b.ReportMetric(float64(lat[len(lat)*99/100].Microseconds()), "p99-µs")
+	}
+
+	// as many workers and queue slots as the storm has goroutines: nothing
+	// waits and nothing is shed
+	b.Run("unbounded", func(b *testing.B) { run(b, auth.NewPool(storm, storm)) })
+	b.Run("pool", func(b *testing.B) { run(b, auth.NewPool(0, 0)) })
+}
+
+// ----- profile -----
+
+func TestGetProfile(t *testing.T) { eachStore(t, testGetProfile) }
+
+func testGetProfile(t *testing.T, h *handler.Handler, secret string) {
+	uid, email := registerUser(t, h)
+
+	gr, err := h.GetProfile(authedCtx(uid, secret), &pb.GetProfileRequest{})
+	if err != nil {
+		t.Fatalf("get profile: %v", err)
+	}
+	p := gr.Profile
+	if p.Id != uid || p.Email != email || p.Name != "Test User" {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+	if p.CreatedAt == nil {
+		t.Error("missing created_at")
+	}
+}
+
+func TestUpdateProfile(t *testing.T) { eachStore(t, testUpdateProfile) }
+
+func testUpdateProfile(t *testing.T, h *handler.Handler, secret string) {
+	uid, email := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	ur, err := h.UpdateProfile(ctx, &pb.UpdateProfileRequest{Name: "  Renamed  "})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if ur.Profile.Name != "Renamed" {
+		t.Errorf("expected trimmed name, got %q", ur.Profile.Name)
+	}
+
+	lr, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "testpass123"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if lr.Name != "Renamed" {
+		t.Errorf("login name not updated: %s", lr.Name)
+	}
+
+	bad := []*pb.UpdateProfileRequest{
+		{Name: ""},
+		{Name: "   "},
+		{Name: strings.Repeat("é", 101)},
+		{Name: "Fine", Email: "new@test.com"},
+	}
+	for _, req := range bad {
+		_, err := h.UpdateProfile(ctx, req)
+		if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+			t.Errorf("%q/%q: expected InvalidArgument, got %v", req.Name, req.Email, s.Code())
+		}
+	}
+}
+
+// ----- sessions -----
+
+func TestSessions(t *testing.T) { eachStore(t, testSessions) }
+
+func testSessions(t *testing.T, h *handler.Handler, secret string) {
+	_, email := registerUser(t, h)
+	other, _ := registerUser(t, h)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+
+	// one login from a phone over grpc, one from a browser through the bridge
+	phone := peer.NewContext(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", "Phone/1.0")),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 4000}})
+	phoneLogin, err := h.Login(phone, &pb.LoginRequest{Email: email, Password: "testpass123"})
+	if err != nil {
+		t.Fatalf("phone login: %v", err)
+	}
+	msg, _ := proto.Marshal(&pb.LoginRequest{Email: email, Password: "testpass123"})
+	code, grpcMsg, data := grpcWebCall(t, bridge.Handler(), "/appointment.v1.AuthService/Login", "", msg)
+	if code != "0" {
+		t.Fatalf("browser login: grpc-status %s: %s", code, grpcMsg)
+	}
+	var webLogin pb.LoginResponse
+	proto.Unmarshal(data, &webLogin)
+
+	claims, err := auth.ParseToken(phoneLogin.Token, secret)
+	if err != nil || claims.SessionID == "" {
+		t.Fatalf("phone token: %+v %v", claims, err)
+	}
+	phoneCtx := middleware.WithClaims(phone, claims)
+	list := func(ctx context.Context) map[string]*pb.Session {
+		t.Helper()
+		resp, err := h.ListSessions(ctx, &pb.ListSessionsRequest{})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		out := map[string]*pb.Session{}
+		for _, s := range resp.Sessions {
+			out[s.Id] = s
+		}
+		return out
+	}
+
+	// registering signed in too
+	sessions := list(phoneCtx)
+	if len(sessions) != 3 {
+		t.Fatalf("%d sessions, want 3", len(sessions))
+	}
+	mine := sessions[claims.SessionID]
+	if mine == nil || !mine.Current || mine.UserAgent != "Phone/1.0" || mine.Ip != "203.0.113.5" {
+		t.Errorf("phone session %v", mine)
+	}
+	var browserID string
+	for id, s := range sessions {
+		if id != claims.SessionID && s.Current {
+			t.Errorf("%v is current for the phone", s)
+		}
+		if s.Ip == "192.0.2.1" { // httptest's client address
+			browserID = id
+		}
+	}
+	if browserID == "" {
+		t.Fatalf("no browser session in %v", sessions)
+	}
+
+	// the bridge's interceptors put the session on the context too
+	code, grpcMsg, data = grpcWebCall(t, bridge.Handler(), "/appointment.v1.AuthService/ListSessions", webLogin.Token, nil)
+	var webList pb.ListSessionsResponse
+	if err := proto.Unmarshal(data, &webList); code != "0" || err != nil {
+		t.Fatalf("list through the bridge: grpc-status %s: %s", code, grpcMsg)
+	}
+	for _, s := range webList.Sessions {
+		if s.Current != (s.Id == browserID) {
+			t.Errorf("through the bridge, %s current = %v", s.Id, s.Current)
+		}
+	}
+
+	// someone else's session is as good as missing, and stays live
+	if _, err := h.RevokeSession(authedCtx(other, secret), &pb.RevokeSessionRequest{Id: claims.SessionID}); status.Code(err) != codes.NotFound {
+		t.Errorf("revoke another user's session: %v", err)
+	}
+	if _, err := h.RevokeSession(phoneCtx, &pb.RevokeSessionRequest{Id: "not-an-id"}); status.Code(err) != codes.NotFound {
+		t.Errorf("revoke unknown id: %v", err)
+	}
+	if len(list(phoneCtx)) != 3 {
+		t.Error("a failed revoke ended a session")
+	}
+
+	// the phone ends the browser's session: that one can't refresh any
+	// more, the phone's own carries on
+	if _, err := h.RevokeSession(phoneCtx, &pb.RevokeSessionRequest{Id: browserID}); err != nil {
+		t.Fatalf("revoke own session: %v", err)
+	}
+	if _, err := h.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: webLogin.RefreshToken}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Errorf("refresh of a revoked session: %v", err)
+	}
+	if _, err := h.RevokeSession(phoneCtx, &pb.RevokeSessionRequest{Id: browserID}); status.Code(err) != codes.NotFound {
+		t.Errorf("revoke twice: %v", err)
+	}
+	rr, err := h.Refresh(phone, &pb.RefreshRequest{RefreshToken: phoneLogin.RefreshToken})
+	if err != nil {
+		t.Fatalf("refresh the live session: %v", err)
+	}
+	claims, _ = auth.ParseToken(rr.Token, secret)
+	sessions = list(middleware.WithClaims(phone, claims))
+	if s := sessions[claims.SessionID]; len(sessions) != 2 || s == nil || !s.Current || s.UserAgent != "Phone/1.0" {
+		t.Errorf("after refresh: %v", sessions)
+	}
+
+	if _, err := h.RevokeAllSessions(phoneCtx, &pb.RevokeAllSessionsRequest{}); err != nil {
+		t.Fatalf("revoke all: %v", err)
+	}
+	if n := len(list(phoneCtx)); n != 0 {
+		t.Errorf("%d sessions after revoking all", n)
+	}
+	if _, err := h.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: rr.RefreshToken}); err == nil {
+		t.Error("refresh after revoking all")
+	}
+}
+
+// ----- account deletion -----
+
+func TestDeleteAccount(t *testing.T) {
+	h, st, secret := setup(t)
+	aliceID, aliceEmail := registerUser(t, h)
+	bobID, _ := registerUser(t, h)
+	alice, bob := authedCtx(aliceID, secret), authedCtx(bobID, secret)
+	ctx := context.Background()
+
+	start := time.Now().Add(48 * time.Hour)
+	bobs, err := h.CreateAppointment(bob, &pb.CreateAppointmentRequest{
+		Title: "bob's", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{aliceID},
+	})
+	if err != nil {
+		t.Fatalf("create bob's: %v", err)
+	}
+	alices, err := h.CreateAppointment(alice, &pb.CreateAppointmentRequest{
+		Title: "alice's", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{bobID},
+	})
+	if err != nil {
+		t.Fatalf("create alice's: %v", err)
+	}
+	_, hash, _ := auth.Config{}.GenerateRefreshToken()
+	st.CreateRefreshToken(ctx, aliceID, hash, time.Now().Add(time.Hour), store.SessionInfo{})
+
+	_, err = h.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "wrongpass"})
+	if s, _ := status.FromError(err); s.Code() != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for wrong password, got %v", s.Code())
+	}
+	if _, err := h.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "testpass123"}); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+
+	_, err = h.Login(ctx, &pb.LoginRequest{Email: aliceEmail, Password: "testpass123"})
+	if s, _ := status.FromError(err); s.Code() != codes.Unauthenticated || s.Message() != "account deleted" {
+		t.Errorf("expected Unauthenticated 'account deleted', got %v %q", s.Code(), s.Message())
+	}
+	if rt, err := st.GetRefreshTokenByHash(ctx, hash.Hash); err != nil || !rt.Revoked {
+		t.Error("expected refresh token revoked")
+	}
+
+	gr, err := h.GetAppointment(bob, &pb.GetAppointmentRequest{Id: bobs.Appointment.Id})
+	if err != nil {
+		t.Fatalf("get bob's: %v", err)
+	}
+	for _, id := range gr.Appointment.AttendeeIds {
+		if id == aliceID {
+			t.Error("deleted user still listed as attendee")
+		}
+	}
+	a, err := st.GetAppointment(ctx, alices.Appointment.Id)
+	if err != nil {
+		t.Fatalf("get alice's: %v", err)
+	}
+	if a.Status != "cancelled" {
+		t.Errorf("expected future appointment cancelled, got %s", a.Status)
+	}
+
+	if _, err := h.DeleteAccount(alice, &pb.DeleteAccountRequest{Password: "testpass123"}); err == nil {
+		t.Error("expected second delete to fail")
+	}
+
+	// a long retention leaves the row, zero retention purges it
+	if _, err := st.PurgeDeletedUsers(ctx, 24*time.Hour); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := st.UserByEmail(ctx, aliceEmail); err != nil {
+		t.Error("purged before retention elapsed")
+	}
+	if _, err := st.PurgeDeletedUsers(ctx, 0); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := st.UserByEmail(ctx, aliceEmail); err == nil {
+		t.Error("expected user hard-deleted after purge")
+	}
+	if _, err := h.GetAppointment(bob, &pb.GetAppointmentRequest{Id: bobs.Appointment.Id}); err != nil {
+		t.Errorf("bob's appointment should survive the purge: %v", err)
+	}
+}
+
+// ----- export -----
+
+func TestExport(t *testing.T) { eachStore(t, testExport) }
+
+func testExport(t *testing.T, h *handler.Handler, secret string) {
+	aliceID, aliceEmail := registerUser(t, h)
+	bobID, bobEmail := registerUser(t, h)
+	alice, bob := authedCtx(aliceID, secret), authedCtx(bobID, secret)
+
+	start := time.Now().Add(48 * time.Hour)
+	bobs, err := h.CreateAppointment(bob, &pb.CreateAppointmentRequest{
+		Title: "bob's", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{aliceID},
+	})
+	if err != nil {
+		t.Fatalf("create bob's: %v", err)
+	}
+	kept, err := h.CreateAppointment(alice, &pb.CreateAppointmentRequest{
+		Title: "kept", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{bobID},
+	})
+	if err != nil {
+		t.Fatalf("create kept: %v", err)
+	}
+	dropped := createAppointment(t, h, alice, 72)
+	if _, err := h.DeleteAppointment(alice, &pb.DeleteAppointmentRequest{Id: dropped.Id}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	get := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/export", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		h.ExportHTTP().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: %d, want 401", rec.Code)
+	}
+	if rec := get("Bearer junk"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad token: %d, want 401", rec.Code)
+	}
+
+	tok, _ := auth.MakeToken(aliceID, auth.RoleUser, secret)
+	rec := get("Bearer " + tok)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, bobEmail) {
+		t.Errorf("export leaks another user's email: %s", body)
+	}
+	if strings.Contains(body, "hash") {
+		t.Errorf("export mentions a hash: %s", body)
+	}
+
+	var e handler.Export
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatalf("decode: %v\n%s", err, body)
+	}
+	if e.Profile.ID != aliceID || e.Profile.Email != aliceEmail {
+		t.Errorf("profile %+v", e.Profile)
+	}
+	if len(e.Sessions) != 1 || e.Sessions[0].ID == "" {
+		t.Errorf("sessions %+v, want the one from register", e.Sessions)
+	}
+	if len(e.Attending) != 1 || e.Attending[0].AppointmentID != bobs.Appointment.Id ||
+		e.Attending[0].OwnerID != bobID || e.Attending[0].OwnerName != "Test User" {
+		t.Errorf("attending %+v", e.Attending)
+	}
+
+	got := map[string]*pb.Appointment{}
+	for _, raw := range e.Appointments {
+		var a pb.Appointment
+		if err := protojson.Unmarshal(raw, &a); err != nil {
+			t.Fatalf("decode appointment: %v", err)
+		}
+		got[a.Id] = &a
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d appointments, want 2", len(got))
+	}
+	if a := got[dropped.Id]; a == nil || a.Status != "cancelled" {
+		t.Errorf("cancelled appointment missing or wrong: %v", a)
+	}
+	a := got[kept.Appointment.Id]
+	if a == nil || len(a.Attendees) != 1 || a.Attendees[0].Id != bobID || a.Attendees[0].Name != "Test User" {
+		t.Errorf("kept appointment %v", a)
+	}
+	if _, ok := got[bobs.Appointment.Id]; ok {
+		t.Error("bob's appointment exported as alice's")
+	}
+}
+
+func TestExportPages(t *testing.T) { eachStore(t, testExportPages) }
+
+// the appointments are read 200 at a time; one past two full batches
+// checks that no page boundary drops or repeats a row
+func testExportPages(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	const n = 2*200 + 1
+	want := map[string]bool{}
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	for i := 0; i < n; i++ {
+		// pairs share a start, the first cancelled to free the slot, so the
+		// cursor's id tiebreak is exercised too
+		at := start.Add(time.Duration(i/2) * time.Hour)
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: fmt.Sprintf("appt-%d", i), StartTime: timestamppb.New(at), EndTime: timestamppb.New(at.Add(time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("create %d: %v", i, err)
+		}
+		if i%2 == 0 {
+			if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: cr.Appointment.Id}); err != nil {
+				t.Fatalf("cancel %d: %v", i, err)
+			}
+		}
+		want[cr.Appointment.Id] = true
+	}
+
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	req := httptest.NewRequest("GET", "/export", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	rec := httptest.NewRecorder()
+	h.ExportHTTP().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body)
+	}
+	var e handler.Export
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(e.Appointments) != n {
+		t.Errorf("got %d appointments, want %d", len(e.Appointments), n)
+	}
+	for _, raw := range e.Appointments {
+		var a pb.Appointment
+		if err := protojson.Unmarshal(raw, &a); err != nil {
+			t.Fatalf("decode appointment: %v", err)
+		}
+		if !want[a.Id] {
+			t.Errorf("%s exported twice or not the user's", a.Id)
+		}
+		delete(want, a.Id)
+	}
+}
+
+// ----- share links -----
+
+func getShare(t *testing.T, hnd http.Handler, url string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", url[strings.Index(url, "/share/"):], nil)
+	rec := httptest.NewRecorder()
+	hnd.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestShareLink(t *testing.T) {
+	h, st, secret := setup(t)
+	ownerID, _ := registerUser(t, h)
+	otherID, _ := registerUser(t, h)
+	owner, other := authedCtx(ownerID, secret), authedCtx(otherID, secret)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	web := bridge.Handler()
+
+	start := time.Date(2031, 5, 14, 14, 0, 0, 0, time.UTC)
+	cr, err := h.CreateAppointment(owner, &pb.CreateAppointmentRequest{
+		Title: "Dentist", Description: "private notes", Location: "12 Main St",
+		StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(45 * time.Minute)),
+		AttendeeIds: []string{otherID},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	apptID := cr.Appointment.Id
+
+	if _, err := h.CreateShareLink(other, &pb.CreateShareLinkRequest{AppointmentId: apptID}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound sharing someone else's appointment, got %v", err)
+	}
+	if _, err := h.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: apptID, TtlSeconds: 365 * 86400}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a year-long ttl, got %v", err)
+	}
+	// an hour once multiplied out to nanoseconds in an int64
+	if _, err := h.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: apptID, TtlSeconds: 36028797018967568}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a ttl that overflows, got %v", err)
+	}
+
+	link, err := h.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: apptID})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	code, body := getShare(t, web, link.Url+"?format=json&tz=Africa/Lagos")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", code, body)
+	}
+	var v struct {
+		Title, When, Location, Description string
+		Start                              time.Time
+		Attendees                          []string
+	}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if v.Title != "Dentist" || v.Location != "12 Main St" {
+		t.Errorf("unexpected view: %+v", v)
+	}
+	if v.When != "Wed, 14 May, 15:00–15:45 (WAT)" {
+		t.Errorf("expected time in Lagos, got %q", v.When)
+	}
+	for _, leak := range []string{ownerID, otherID, "private notes"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("share view leaked %q", leak)
+		}
+	}
+
+	code, body = getShare(t, web, link.Url)
+	if code != http.StatusOK || !strings.Contains(body, "<h1>Dentist</h1>") {
+		t.Errorf("expected html view, got %d: %s", code, body)
+	}
+
+	// the same view over grpc, without a token of any account
+	token := link.Url[strings.LastIndex(link.Url, "/")+1:]
+	sr, err := h.GetSharedAppointment(context.Background(), &pb.GetSharedAppointmentRequest{Token: token})
+	if err != nil {
+		t.Fatalf("get shared: %v", err)
+	}
+	if sr.Appointment.Title != "Dentist" || !sr.Appointment.StartTime.AsTime().Equal(start) || sr.Appointment.Location != "12 Main St" {
+		t.Errorf("unexpected shared appointment: %v", sr.Appointment)
+	}
+	raw, _ := protojson.Marshal(sr)
+	for _, leak := range []string{ownerID, otherID, "private notes"} {
+		if strings.Contains(string(raw), leak) {
+			t.Errorf("GetSharedAppointment leaked %q: %s", leak, raw)
+		}
+	}
+	if _, err := h.GetSharedAppointment(context.Background(), &pb.GetSharedAppointmentRequest{Token: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for an unknown token, got %v", err)
+	}
+
+	full, err := h.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: apptID, IncludeDescription: true, IncludeAttendees: true})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	_, body = getShare(t, web, full.Url+"?format=json")
+	if !strings.Contains(body, "private notes") || !strings.Contains(body, "Test User") || strings.Contains(body, otherID) {
+		t.Errorf("flagged link should show description and attendee names only: %s", body)
+	}
+
+	if _, err := h.RevokeShareLink(other, &pb.RevokeShareLinkRequest{Id: link.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound revoking someone else's link, got %v", err)
+	}
+	if _, err := h.RevokeShareLink(owner, &pb.RevokeShareLinkRequest{Id: link.Id}); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if code, _ := getShare(t, web, link.Url); code != http.StatusNotFound {
+		t.Errorf("expected 404 after revoke, got %d", code)
+	}
+	if _, err := h.GetSharedAppointment(context.Background(), &pb.GetSharedAppointmentRequest{Token: token}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound after revoke, got %v", err)
+	}
+
+	// with a one-day default, a link made 25 hours ago has expired
+	past := handler.New(st, auth.SingleKey(secret), handler.WithClock(clock.NewFake(time.Now().Add(-25*time.Hour))), handler.WithShareLinkTTL(24*time.Hour))
+	old, err := past.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: apptID})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if !old.ExpiresAt.AsTime().Before(time.Now()) {
+		t.Errorf("expected the link to have expired, expires %v", old.ExpiresAt.AsTime())
+	}
+	if _, err := h.GetSharedAppointment(context.Background(), &pb.GetSharedAppointmentRequest{Token: old.Url[strings.LastIndex(old.Url, "/")+1:]}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for an expired link, got %v", err)
+	}
+
+	if _, err := h.DeleteAppointment(owner, &pb.DeleteAppointmentRequest{Id: apptID}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	code, body = getShare(t, web, full.Url)
+	if code != http.StatusOK || !strings.Contains(body, "no longer scheduled") || strings.Contains(body, "private notes") {
+		t.Errorf("expected cancelled view, got %d: %s", code, body)
+	}
+}
+
+// a shared all-day event shows its own dates, whatever zone the viewer asks for
+func TestShareLinkAllDay(t *testing.T) {
+	h, _, secret := setup(t)
+	ownerID, _ := registerUser(t, h)
+	owner := authedCtx(ownerID, secret)
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	day := time.Date(2031, 5, 14, 0, 0, 0, 0, tokyo)
+	cr, err := h.CreateAppointment(owner, &pb.CreateAppointmentRequest{
+		Title: "Holiday", StartTime: timestamppb.New(day), EndTime: timestamppb.New(day.AddDate(0, 0, 2)),
+		AllDay: true, TimeZone: "Asia/Tokyo",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	link, err := h.CreateShareLink(owner, &pb.CreateShareLinkRequest{AppointmentId: cr.Appointment.Id})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	_, body := getShare(t, bridge.Handler(), link.Url+"?format=json&tz=America/New_York")
+	var v struct {
+		When   string
+		Start  string
+		AllDay bool `json:"all_day"`
+	}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !v.AllDay || v.When != "Wed, 14 May – Thu, 15 May" || v.Start != "2031-05-14T00:00:00+09:00" {
+		t.Errorf("all-day view: %s", body)
+	}
+}
+
+// ----- partially migrated schema -----
+
+// builds just the core tables in a scratch schema, none of the optional ones
+// scratchSchema creates a throwaway schema and returns a pool whose
+// search_path is that schema followed by extra.
+func scratchSchema(t *testing.T, extra ...string) *pgxpool.Pool {
+	t.Helper()
+	_ = godotenv.Load("../../.env")
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" || os.Getenv("JWT_SECRET") == "" {
+		t.Skip("DATABASE_URL or JWT_SECRET not set")
+	}
+	ctx := context.Background()
+	schema := "scratch_" + strings.ReplaceAll(uuid.New().String()[:8], "-", "")
+
+	admin, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), `DROP SCHEMA IF EXISTS `+schema+` CASCADE`)
+		admin.Close()
+	})
+	if _, err := admin.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = strings.Join(append([]string{schema}, extra...), ",")
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func setupPartialSchema(t *testing.T) (*handler.Handler, string) {
+	t.Helper()
+	pool := scratchSchema(t)
+	ctx := context.Background()
+	secret := os.Getenv("JWT_SECRET")
+
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE users (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE refresh_tokens (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(255) NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			revoked BOOLEAN NOT NULL DEFAULT FALSE,
+			replaced_by UUID,
+			hash_version SMALLINT NOT NULL DEFAULT 1,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE appointments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			title VARCHAR(200) NOT NULL,
+			description TEXT DEFAULT '',
+			start_time TIMESTAMPTZ NOT NULL,
+			end_time TIMESTAMPTZ NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'confirmed',
+			location VARCHAR(300) DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		t.Fatalf("core schema: %v", err)
+	}
+
+	st := store.New(pool)
+	if _, err := st.DetectCapabilities(ctx); err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	return handler.New(st, auth.SingleKey(secret)), secret
+}
+
+func TestPartialSchemaCoreFlows(t *testing.T) {
+	h, secret := setupPartialSchema(t)
+
+	info, err := h.GetServerInfo(context.Background(), &pb.GetServerInfoRequest{})
+	if err != nil {
+		t.Fatalf("server info: %v", err)
+	}
+	if len(info.Capabilities) != 0 {
+		t.Errorf("expected no optional capabilities, got %v", info.Capabilities)
+	}
+
+	userID, email := registerUser(t, h)
+	if _, err := h.Login(context.Background(), &pb.LoginRequest{Email: email, Password: "testpass123"}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	ctx := authedCtx(userID, secret)
+
+	appt := createAppointment(t, h, ctx, 24)
+	if _, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Errorf("get: %v", err)
+	}
+	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
+	if err != nil || len(lr.Appointments) != 1 {
+		t.Errorf("list: %v (%d results)", err, len(lr.GetAppointments()))
+	}
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: appt.Id, Title: "moved", StartTime: appt.StartTime, EndTime: appt.EndTime,
+	})
+	if err != nil {
+		t.Errorf("update: %v", err)
+	}
+	if _, err := h.GetProfile(ctx, &pb.GetProfileRequest{}); err != nil {
+		t.Errorf("profile: %v", err)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Errorf("delete: %v", err)
+	}
+
+	// only the feature itself is refused
+	start := time.Now().Add(72 * time.Hour)
+	_, errAttendees := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "with people", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{userID},
+	})
+	_, errReset := h.RequestPasswordReset(context.Background(), &pb.RequestPasswordResetRequest{Email: email})
+	_, errShare := h.CreateShareLink(ctx, &pb.CreateShareLinkRequest{AppointmentId: appt.Id})
+	_, errCalendars := h.ListCalendars(ctx, &pb.ListCalendarsRequest{})
+	_, errDelete := h.DeleteAccount(ctx, &pb.DeleteAccountRequest{Password: "testpass123"})
+	for name, err := range map[string]error{
+		"attendees": errAttendees, "password_reset": errReset, "share_links": errShare, "calendars": errCalendars,
+		"account_deletion": errDelete,
+	} {
+		s, _ := status.FromError(err)
+		if s.Code() != codes.FailedPrecondition || s.Message() != "server not migrated for "+name {
+			t.Errorf("%s: expected FailedPrecondition, got %v %q", name, s.Code(), s.Message())
+		}
+	}
+}
+
+// ----- invalid ranges -----
+
+// Rows the early prototype left with end_time <= start_time: hidden from
+// every read before the migration, quarantined by it, and blocked after.
+func TestInvalidRangesQuarantined(t *testing.T) {
+	// extensions live in public
+	pool := scratchSchema(t, "public")
+	ctx := context.Background()
+
+	uid := uuid.New().String()
+	email := "legacy-" + uid[:8] + "@test.com"
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE users (
+			id UUID PRIMARY KEY, email VARCHAR(255) UNIQUE NOT NULL, password_hash VARCHAR(255) NOT NULL,
+			name VARCHAR(100) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW());
+		CREATE TABLE appointments (
+			id UUID PRIMARY KEY, title VARCHAR(200) NOT NULL, description TEXT DEFAULT '',
+			start_time TIMESTAMPTZ NOT NULL, end_time TIMESTAMPTZ NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'confirmed', location VARCHAR(300) DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW())`)
+	if err != nil {
+		t.Fatalf("legacy schema: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO users (id, email, password_hash, name) VALUES ($1, $2, 'x', 'Legacy')`, uid, email); err != nil {
+		t.Fatalf("user: %v", err)
+	}
+	at := time.Now().Add(100 * time.Hour).Truncate(time.Second)
+	good, zero, inverted := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, r := range []struct {
+		id         string
+		start, end time.Time
+	}{
+		{good, at, at.Add(time.Hour)},
+		{zero, at.Add(2 * time.Hour), at.Add(2 * time.Hour)},
+		{inverted, at.Add(4 * time.Hour), at.Add(3 * time.Hour)},
+	} {
+		if _, err := pool.Exec(ctx, `INSERT INTO appointments (id, title, start_time, end_time, user_id) VALUES ($1, 'legacy', $2, $3, $4)`,
+			r.id, r.start, r.end, uid); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	st := store.New(pool)
+	list := func() []model.Appointment {
+		t.Helper()
+		apts, err := st.ListAppointments(ctx, uid, store.ListParams{From: at.Add(-time.Hour), To: at.Add(10 * time.Hour)})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return apts
+	}
+
+	// before the migration the scan guard keeps them out
+	if apts := list(); len(apts) != 1 || apts[0].ID != good {
+		t.Errorf("expected only the good row, got %v", apts)
+	}
+	total, rows, err := st.InvalidRanges(ctx, 10)
+	if err != nil || total != 2 || len(rows) != 2 || rows[0].Status != "confirmed" {
+		t.Fatalf("self-check before migration: %d %v %v", total, rows, err)
+	}
+
+	migration, err := os.ReadFile("../../db/migrations/001_init.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	for i := 0; i < 2; i++ { // and it's safe to rerun
+		if _, err := pool.Exec(ctx, string(migration)); err != nil {
+			t.Fatalf("migration run %d: %v", i+1, err)
+		}
+	}
+	if _, err := st.DetectCapabilities(ctx); err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+
+	total, rows, _ = st.InvalidRanges(ctx, 10)
+	for _, a := range rows {
+		if a.Status != "invalid" {
+			t.Errorf("%s not quarantined: %s", a.ID, a.Status)
+		}
+	}
+	if total != 2 {
+		t.Errorf("expected 2 invalid rows, got %d", total)
+	}
+	if apts := list(); len(apts) != 1 || apts[0].ID != good {
+		t.Errorf("list after migration: %v", apts)
+	}
+	if _, err := st.GetAppointment(ctx, inverted); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("quarantined row readable by id: %v", err)
+	}
+	res, err := st.SearchAppointments(ctx, store.SearchParams{OwnerEmail: email})
+	if err != nil || len(res) != 1 {
+		t.Errorf("search should only see the good row: %v %v", res, err)
+	}
+	if _, err := st.ActivateAppointment(ctx, zero, uid); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("quarantined row reactivated: %v", err)
+	}
+
+	// and no new ones get in
+	_, err = pool.Exec(ctx, `INSERT INTO appointments (id, title, start_time, end_time, user_id) VALUES ($1, 'new', $2, $2, $3)`,
+		uuid.New().String(), at.Add(8*time.Hour), uid)
+	if err == nil {
+		t.Error("zero-length row accepted after migration")
+	}
+}
+
+// ----- freeze windows and calendars -----
+
+func TestFreezeWindow(t *testing.T) {
+	base, st, secret := setup(t)
+	adminID, _ := registerUser(t, base)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAdmins([]string{adminID}))
+	admin := authedCtx(adminID, secret)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	day := time.Now().Add(3000 * time.Hour).UTC().Truncate(time.Hour)
+	at := func(h int) *timestamppb.Timestamp { return timestamppb.New(day.Add(time.Duration(h) * time.Hour)) }
+
+	// booked before the freeze, so it stays
+	before, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "kept", StartTime: at(2), EndTime: at(3)})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := h.CreateFreezeWindow(ctx, &pb.CreateFreezeWindowRequest{StartTime: at(1), EndTime: at(5), Reason: "x"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("non-admin freeze: got %v", err)
+	}
+	fw, err := h.CreateFreezeWindow(admin, &pb.CreateFreezeWindowRequest{StartTime: at(1), EndTime: at(5), Reason: "clinic closed"})
+	if err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+	deleted := false
+	t.Cleanup(func() {
+		if !deleted {
+			h.DeleteFreezeWindow(admin, &pb.DeleteFreezeWindowRequest{Id: fw.FreezeWindow.Id})
+		}
+	})
+
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "blocked", StartTime: at(4), EndTime: at(6)})
+	if st, _ := status.FromError(err); st.Code() != codes.FailedPrecondition || !strings.Contains(st.Message(), "clinic closed") {
+		t.Errorf("create in freeze: got %v", err)
+	}
+	// [) — right after the window is open
+	after, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "after", StartTime: at(5), EndTime: at(6)})
+	if err != nil {
+		t.Errorf("create after freeze: %v", err)
+	}
+
+	// renaming what's already in the window is fine, moving into it isn't
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: before.Appointment.Id, Title: "renamed", StartTime: at(2), EndTime: at(3)}); err != nil {
+		t.Errorf("rename inside freeze: %v", err)
+	}
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: before.Appointment.Id, Title: "renamed", StartTime: at(3), EndTime: at(4)}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("move within freeze: got %v", err)
+	}
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: after.Appointment.Id, Title: "after", StartTime: at(4), EndTime: at(5)}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("move into freeze: got %v", err)
+	}
+
+	batch, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+		{Title: "ok", StartTime: at(7), EndTime: at(8)},
+		{Title: "frozen", StartTime: at(0), EndTime: at(2)},
+	}})
+	if err != nil || len(batch.Errors) != 1 || batch.Errors[0].Index != 1 || batch.Errors[0].Code != codes.FailedPrecondition.String() {
+		t.Errorf("batch: %v %v", batch, err)
+	}
+
+	list, err := h.ListFreezeWindows(admin, &pb.ListFreezeWindowsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	found := false
+	for _, w := range list.FreezeWindows {
+		found = found || (w.Id == fw.FreezeWindow.Id && w.Reason == "clinic closed" && w.CreatedBy == adminID && w.Scope == "global")
+	}
+	if !found {
+		t.Errorf("freeze missing from list: %v", list.FreezeWindows)
+	}
+
+	if _, err := h.DeleteFreezeWindow(admin, &pb.DeleteFreezeWindowRequest{Id: fw.FreezeWindow.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	deleted = true
+	if _, err := h.DeleteFreezeWindow(admin, &pb.DeleteFreezeWindowRequest{Id: fw.FreezeWindow.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("second delete: got %v", err)
+	}
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "open again", StartTime: at(4), EndTime: at(5)}); err != nil {
+		t.Errorf("create after unfreeze: %v", err)
+	}
+}
+
+func TestCalendars(t *testing.T) {
+	h, _, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	otherID, _ := registerUser(t, h)
+	other := authedCtx(otherID, secret)
+
+	list, err := h.ListCalendars(ctx, &pb.ListCalendarsRequest{})
+	if err != nil || len(list.Calendars) != 1 || !list.Calendars[0].IsDefault || list.Calendars[0].Name != store.DefaultCalendarName {
+		t.Fatalf("new user's calendars: %v %v", list, err)
+	}
+	def := list.Calendars[0]
+
+	if _, err := h.CreateCalendar(ctx, &pb.CreateCalendarRequest{Name: "Work", Color: "blue"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad color: got %v", err)
+	}
+	cr, err := h.CreateCalendar(ctx, &pb.CreateCalendarRequest{Name: "Work", Color: "#3366ff"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	work := cr.Calendar
+	if work.IsDefault {
+		t.Error("new calendar is the default")
+	}
+	if _, err := h.CreateCalendar(ctx, &pb.CreateCalendarRequest{Name: "Work"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("duplicate name: got %v", err)
+	}
+
+	day := time.Now().Add(3100 * time.Hour).UTC().Truncate(time.Hour)
+	at := func(h int) *timestamppb.Timestamp { return timestamppb.New(day.Add(time.Duration(h) * time.Hour)) }
+
+	plain, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "plain", StartTime: at(0), EndTime: at(1)})
+	if err != nil || plain.Appointment.CalendarId != def.Id {
+		t.Fatalf("create without calendar: %v %v", plain, err)
+	}
+	meeting, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "meeting", StartTime: at(2), EndTime: at(3), CalendarId: work.Id})
+	if err != nil || meeting.Appointment.CalendarId != work.Id {
+		t.Fatalf("create in work: %v %v", meeting, err)
+	}
+	// overlaps are per user, not per calendar
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "clash", StartTime: at(2), EndTime: at(3)}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("overlap across calendars: got %v", err)
+	}
+	// someone else's calendar looks like no calendar at all
+	for _, id := range []string{work.Id, uuid.NewString(), "nope"} {
+		if _, err := h.CreateAppointment(other, &pb.CreateAppointmentRequest{Title: "x", StartTime: at(5), EndTime: at(6), CalendarId: id}); status.Code(err) != codes.NotFound {
+			t.Errorf("create with calendar %q: got %v", id, err)
+		}
+	}
+	batch, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+		{Title: "ok", StartTime: at(7), EndTime: at(8), CalendarId: work.Id},
+		{Title: "bad", StartTime: at(9), EndTime: at(10), CalendarId: uuid.NewString()},
+	}})
+	if err != nil || len(batch.Errors) != 1 || batch.Errors[0].Index != 1 || batch.Errors[0].Code != codes.NotFound.String() {
+		t.Errorf("batch: %v %v", batch, err)
+	}
+
+	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: at(0), RangeEnd: at(24), CalendarId: work.Id})
+	if err != nil || len(lr.Appointments) != 2 || lr.Appointments[0].Id != meeting.Appointment.Id {
+		t.Errorf("list work: %v %v", lr, err)
+	}
+
+	// leaving calendar_id out of an update keeps it, setting it moves it
+	up, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: meeting.Appointment.Id, Title: "meeting", StartTime: at(2), EndTime: at(4)})
+	if err != nil || up.Appointment.CalendarId != work.Id {
+		t.Errorf("update without calendar: %v %v", up, err)
+	}
+	up, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: plain.Appointment.Id, Title: "plain", StartTime: at(0), EndTime: at(1), CalendarId: work.Id})
+	if err != nil || up.Appointment.CalendarId != work.Id {
+		t.Errorf("move to work: %v %v", up, err)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: plain.Appointment.Id}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	if _, err := h.DeleteCalendar(ctx, &pb.DeleteCalendarRequest{Id: def.Id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("delete default: got %v", err)
+	}
+	if _, err := h.DeleteCalendar(other, &pb.DeleteCalendarRequest{Id: work.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("delete someone else's: got %v", err)
+	}
+	if _, err := h.DeleteCalendar(ctx, &pb.DeleteCalendarRequest{Id: work.Id}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("delete with confirmed appointments: got %v", err)
+	}
+	lr, _ = h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: at(0), RangeEnd: at(24), CalendarId: work.Id})
+	for _, a := range lr.Appointments {
+		h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: a.Id})
+	}
+	if _, err := h.DeleteCalendar(ctx, &pb.DeleteCalendarRequest{Id: work.Id}); err != nil {
+		t.Fatalf("delete emptied calendar: %v", err)
+	}
+	got, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: plain.Appointment.Id})
+	if err != nil || got.Appointment.CalendarId != def.Id {
+		t.Errorf("cancelled appointment after delete: %v %v", got, err)
+	}
+
+	// make_default hands the flag over
+	home, err := h.CreateCalendar(ctx, &pb.CreateCalendarRequest{Name: "Home"})
+	if err != nil {
+		t.Fatalf("create home: %v", err)
+	}
+	ur, err := h.UpdateCalendar(ctx, &pb.UpdateCalendarRequest{Id: home.Calendar.Id, Name: "Home", MakeDefault: true})
+	if err != nil || !ur.Calendar.IsDefault {
+		t.Fatalf("make default: %v %v", ur, err)
+	}
+	list, _ = h.ListCalendars(ctx, &pb.ListCalendarsRequest{})
+	if len(list.Calendars) != 2 || list.Calendars[0].Id != home.Calendar.Id || list.Calendars[1].IsDefault {
+		t.Errorf("after make default: %v", list.Calendars)
+	}
+	if _, err := h.UpdateCalendar(ctx, &pb.UpdateCalendarRequest{Id: def.Id, Name: "Home"}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("rename onto taken name: got %v", err)
+	}
+}
+
+// ----- admin search -----
+
+func TestSearchAllAppointments(t *testing.T) {
+	base, st, secret := setup(t)
+	adminID, _ := registerUser(t, base)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAdmins([]string{adminID}))
+
+	ownerID, ownerEmail := registerUser(t, h)
+	doctorID, _ := registerUser(t, h)
+	if _, err := h.UpdateProfile(authedCtx(doctorID, secret), &pb.UpdateProfileRequest{Name: "Dr Adeyemi " + doctorID[:8]}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	owner := authedCtx(ownerID, secret)
+	marker := "zx" + strings.ReplaceAll(uuid.New().String()[:8], "-", "")
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		req := &pb.CreateAppointmentRequest{
+			Title: "checkup " + marker, Description: "private", StartTime: timestamppb.New(s), EndTime: timestamppb.New(s.Add(30 * time.Minute)),
+		}
+		if i == 2 {
+			req.Title = "unrelated"
+			req.AttendeeIds = []string{doctorID}
+		}
+		if _, err := h.CreateAppointment(owner, req); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	admin := authedCtx(adminID, secret)
+
+	if _, err := h.SearchAllAppointments(owner, &pb.SearchAllAppointmentsRequest{Query: marker}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied for a normal user, got %v", err)
+	}
+
+	// title search, paginated one at a time
+	var got []*pb.AppointmentSearchResult
+	req := &pb.SearchAllAppointmentsRequest{Query: marker, PageSize: 1}
+	for {
+		resp, err := h.SearchAllAppointments(admin, req)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		got = append(got, resp.Results...)
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 title matches, got %d", len(got))
+	}
+	for _, r := range got {
+		if r.OwnerEmail != ownerEmail {
+			t.Errorf("expected owner email %s, got %s", ownerEmail, r.OwnerEmail)
+		}
+		if r.Appointment.Description != "" {
+			t.Error("description returned without include_details")
+		}
+	}
+
+	// attendee name, with details
+	resp, err := h.SearchAllAppointments(admin, &pb.SearchAllAppointmentsRequest{
+		Query: "Adeyemi " + doctorID[:8], UserEmail: ownerEmail, IncludeDetails: true,
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Appointment.Title != "unrelated" {
+		t.Fatalf("expected the appointment the doctor attends, got %v", resp.Results)
+	}
+	if resp.Results[0].Appointment.Description != "private" || len(resp.Results[0].Appointment.AttendeeIds) != 1 {
+		t.Error("expected details with include_details")
+	}
+
+	entries, err := st.AdminAuditEntries(context.Background(), adminID, 10)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audited searches, got %d", len(entries))
+	}
+	if entries[0].Action != "SearchAllAppointments" || entries[0].Params["include_details"] != true {
+		t.Errorf("latest audit entry should record include_details: %+v", entries[0])
+	}
+}
+
+// A promoted receptionist manages someone else's appointments through the
+// real interceptor chain, with the role coming from the login token.
+func TestRoles(t *testing.T) {
+	h, st, secret := setup(t)
+	conn := startServer(t, h, secret)
+	sched, admin := pb.NewScheduleServiceClient(conn), pb.NewAdminServiceClient(conn)
+	authc := pb.NewAuthServiceClient(conn)
+	ctx := context.Background()
+
+	ownerID, _ := registerUser(t, h)
+	owner := authedCtx(ownerID, secret)
+	appt := createAppointment(t, h, owner, 30)
+
+	login := func(email string) context.Context {
+		t.Helper()
+		lr, err := h.Login(ctx, &pb.LoginRequest{Email: email, Password: "testpass123"})
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+lr.Token)
+	}
+
+	// a normal user: admin methods refused outright, others' data hidden
+	userID, userEmail := registerUser(t, h)
+	user := login(userEmail)
+	if _, err := admin.ListUsers(user, &pb.ListUsersRequest{}); apperr.ReasonOf(err) != apperr.AdminOnly || status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ListUsers as user: %v", err)
+	}
+	if _, err := sched.ListAppointments(user, &pb.ListAppointmentsRequest{UserId: ownerID}); apperr.ReasonOf(err) != apperr.AdminOnly {
+		t.Errorf("list another user's as user: %v", err)
+	}
+	if _, err := sched.GetAppointment(user, &pb.GetAppointmentRequest{Id: appt.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("get another user's as user: %v", err)
+	}
+	if _, err := sched.ListAppointments(user, &pb.ListAppointmentsRequest{UserId: userID}); err != nil {
+		t.Errorf("naming yourself is fine: %v", err)
+	}
+
+	if err := st.SetUserRole(ctx, userID, "owner"); !errors.Is(err, store.ErrUnknownRole) {
+		t.Errorf("bad role: %v", err)
+	}
+	if err := st.SetUserRole(ctx, uuid.NewString(), auth.RoleAdmin); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("unknown user: %v", err)
+	}
+	if err := st.SetUserRole(ctx, userID, auth.RoleAdmin); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	// the old token still says user; the next login says admin
+	if _, err := admin.ListUsers(user, &pb.ListUsersRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("stale token: %v", err)
+	}
+	recep := login(userEmail)
+	if p, err := authc.GetProfile(recep, &pb.GetProfileRequest{}); err != nil || p.Profile.Role != auth.RoleAdmin {
+		t.Errorf("profile role: %v %v", p, err)
+	}
+
+	lr, err := sched.ListAppointments(recep, &pb.ListAppointmentsRequest{UserId: ownerID})
+	if err != nil || len(lr.Appointments) != 1 || lr.Appointments[0].Id != appt.Id {
+		t.Fatalf("admin list: %v %v", lr, err)
+	}
+	if _, err := sched.GetAppointment(recep, &pb.GetAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Errorf("admin get: %v", err)
+	}
+	ur, err := sched.UpdateAppointment(recep, &pb.UpdateAppointmentRequest{
+		Id: appt.Id, Title: "moved by reception", StartTime: appt.StartTime, EndTime: appt.EndTime,
+	})
+	if err != nil || ur.Appointment.UserId != ownerID {
+		t.Fatalf("admin update: %v %v", ur, err)
+	}
+	if _, err := sched.DeleteAppointment(recep, &pb.DeleteAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Fatalf("admin delete: %v", err)
+	}
+	if _, err := sched.DeleteAppointment(recep, &pb.DeleteAppointmentRequest{Id: uuid.NewString()}); err != nil {
+		t.Errorf("admin delete of nothing: %v", err)
+	}
+	got, err := h.GetAppointment(owner, &pb.GetAppointmentRequest{Id: appt.Id})
+	if err != nil || got.Appointment.Title != "moved by reception" || got.Appointment.Status != "cancelled" {
+		t.Errorf("owner sees %v %v", got, err)
+	}
+
+	// the directory pages by email
+	seen := map[string]string{}
+	req := &pb.ListUsersRequest{PageSize: 200}
+	for {
+		resp, err := admin.ListUsers(recep, req)
+		if err != nil {
+			t.Fatalf("list users: %v", err)
+		}
+		for _, u := range resp.Users {
+			seen[u.Id] = u.Role
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if seen[ownerID] != auth.RoleUser || seen[userID] != auth.RoleAdmin {
+		t.Errorf("directory roles: owner %q receptionist %q", seen[ownerID], seen[userID])
+	}
+
+	if st.Has(store.FeatureAdminAudit) {
+		entries, err := st.AdminAuditEntries(ctx, userID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actions []string
+		for _, e := range entries {
+			actions = append(actions, e.Action)
+		}
+		for _, want := range []string{"ListAppointments", "GetAppointment", "UpdateAppointment", "DeleteAppointment"} {
+			if !slices.Contains(actions, want) {
+				t.Errorf("%s not audited: %v", want, actions)
+			}
+		}
+	}
+}
+
+// ----- appointment CRUD -----
+
+func TestCreateAppointment(t *testing.T) { eachStore(t, testCreateAppointment) }
+
+func testCreateAppointment(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(100 * time.Hour)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title:       "Meeting",
+		Description: "important stuff",
+		Location:    "Room A",
+		StartTime:   timestamppb.New(start),
+		EndTime:     timestamppb.New(start.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	a := cr.Appointment
+	if a.Id == "" {
+		t.Fatal("empty id")
+	}
+	if a.Title != "Meeting" {
+		t.Errorf("title: got %s", a.Title)
+	}
+	if a.Description != "important stuff" {
+		t.Errorf("description: got %s", a.Description)
+	}
+	if a.Location != "Room A" {
+		t.Errorf("location: got %s", a.Location)
+	}
+	if a.Status != "confirmed" {
+		t.Errorf("status: got %s", a.Status)
+	}
+}
+
+func TestCreateAppointmentValidation(t *testing.T) { eachStore(t, testCreateAppointmentValidation) }
+
+func testCreateAppointmentValidation(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(200 * time.Hour)
+
+	tests := []struct {
+		name   string
+		req    *pb.CreateAppointmentRequest
+		reason apperr.Reason
+	}{
+		{"empty title", &pb.CreateAppointmentRequest{
+			Title: "", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		}, apperr.InvalidArgument},
+		{"missing start", &pb.CreateAppointmentRequest{
+			Title: "X", EndTime: timestamppb.New(start.Add(time.Hour)),
+		}, apperr.InvalidArgument},
+		{"missing end", &pb.CreateAppointmentRequest{
+			Title: "X", StartTime: timestamppb.New(start),
+		}, apperr.InvalidArgument},
+		{"end before start", &pb.CreateAppointmentRequest{
+			Title: "X", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(-time.Hour)),
+		}, apperr.ApptEmptyRange},
+		{"past booking", &pb.CreateAppointmentRequest{
+			Title: "X", StartTime: timestamppb.New(time.Now().Add(-2 * time.Hour)), EndTime: timestamppb.New(time.Now().Add(-time.Hour)),
+		}, apperr.ApptPast},
+		{"negative reminder", &pb.CreateAppointmentRequest{
+			Title: "X", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)), ReminderMinutesBefore: -1,
+		}, apperr.InvalidArgument},
+		{"reminder too early", &pb.CreateAppointmentRequest{
+			Title: "X", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)), ReminderMinutesBefore: 8 * 24 * 60,
+		}, apperr.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.CreateAppointment(ctx, tt.req)
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			s, _ := status.FromError(err)
+			if s.Code() != codes.InvalidArgument {
+				t.Errorf("expected InvalidArgument, got %v", s.Code())
+			}
+			if r := apperr.ReasonOf(err); r != tt.reason {
+				t.Errorf("reason %q, want %q", r, tt.reason)
+			}
+		})
+	}
+}
+
+func TestReminders(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, email := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// claims are global, so only count this test's appointment
+	claims := func(id string) (n int, got model.Reminder) {
+		t.Helper()
+		due, err := st.ClaimDueReminders(context.Background(), 100)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		for _, r := range due {
+			if r.Appointment.ID == id {
+				n, got = n+1, r
+			}
+		}
+		return n, got
+	}
+
+	// starts in 10 minutes with a 30 minute reminder: due right away
+	start := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "standup", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(15 * time.Minute)),
+		ReminderMinutesBefore: 30,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id := cr.Appointment.Id
+
+	// two pollers racing must not both get it
+	var wg sync.WaitGroup
+	counts := make([]int, 2)
+	var got model.Reminder
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var r model.Reminder
+			if counts[i], r = claims(id); counts[i] == 1 {
+				got = r
+			}
+		}(i)
+	}
+	wg.Wait()
+	if counts[0]+counts[1] != 1 {
+		t.Fatalf("reminder claimed %d times", counts[0]+counts[1])
+	}
+	if got.Email != email || !got.RemindAt.Equal(start.Add(-30*time.Minute)) || got.Appointment.Title != "standup" {
+		t.Errorf("claimed reminder: %+v", got)
+	}
+	if n, _ := claims(id); n != 0 {
+		t.Error("sent reminder claimed again")
+	}
+
+	// rescheduling keeps the lead time and re-arms it
+	later := start.Add(time.Hour)
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: id, Title: "standup", StartTime: timestamppb.New(later), EndTime: timestamppb.New(later.Add(15 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if n, _ := claims(id); n != 0 {
+		t.Error("rescheduled reminder isn't due for another 40 minutes")
+	}
+	back := time.Now().Add(20 * time.Minute).Truncate(time.Second)
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: id, Title: "standup", StartTime: timestamppb.New(back), EndTime: timestamppb.New(back.Add(15 * time.Minute)),
+	}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if n, r := claims(id); n != 1 || !r.RemindAt.Equal(back.Add(-30*time.Minute)) {
+		t.Errorf("expected the moved reminder to fire again at %v, got %d claims (%v)", back.Add(-30*time.Minute), n, r.RemindAt)
+	}
+
+	// cancelling holds it back, restoring brings it back
+	soon := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	cr, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "cancelled", StartTime: timestamppb.New(soon), EndTime: timestamppb.New(soon.Add(time.Hour)),
+		ReminderMinutesBefore: 7 * 24 * 60,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: cr.Appointment.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if n, _ := claims(cr.Appointment.Id); n != 0 {
+		t.Error("reminder of a cancelled appointment claimed")
+	}
+	if _, err := h.RestoreAppointment(ctx, &pb.RestoreAppointmentRequest{Id: cr.Appointment.Id}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if n, r := claims(cr.Appointment.Id); n != 1 || !r.RemindAt.Equal(soon.Add(-7*24*time.Hour)) {
+		t.Errorf("expected the restored reminder due at %v, got %d claims (%v)", soon.Add(-7*24*time.Hour), n, r.RemindAt)
+	}
+}
+
+func TestScheduleSummary(t *testing.T) {
+	h, _, secret := setup(t)
+	alice, _ := registerUser(t, h)
+	bob, _ := registerUser(t, h)
+	actx, bctx := authedCtx(alice, secret), authedCtx(bob, secret)
+
+	// a Monday far enough out to be empty
+	day := time.Now().Add(1300 * time.Hour).UTC().Truncate(24 * time.Hour)
+	for day.Weekday() != time.Monday {
+		day = day.Add(24 * time.Hour)
+	}
+	at := func(h float64) time.Time { return day.Add(time.Duration(h * float64(time.Hour))) }
+	book := func(ctx context.Context, from, to float64) string {
+		t.Helper()
+		r, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "x", StartTime: timestamppb.New(at(from)), EndTime: timestamppb.New(at(to))})
+		if err != nil {
+			t.Fatalf("book %v-%v: %v", from, to, err)
+		}
+		return r.Appointment.Id
+	}
+	book(actx, 10, 11)
+	book(actx, 23, 25) // over midnight: an hour on each day
+	book(actx, 57, 57.5)
+	gone := book(actx, 80, 81)
+	if _, err := h.DeleteAppointment(actx, &pb.DeleteAppointmentRequest{Id: gone}); err != nil {
+		t.Fatal(err)
+	}
+	book(bctx, 12, 13)
+
+	summary := func(req *pb.GetScheduleSummaryRequest) *pb.GetScheduleSummaryResponse {
+		t.Helper()
+		if req.RangeStart == nil {
+			req.RangeStart, req.RangeEnd = timestamppb.New(day), timestamppb.New(at(7*24))
+		}
+		resp, err := h.GetScheduleSummary(actx, req)
+		if err != nil {
+			t.Fatalf("summary: %v", err)
+		}
+		return resp
+	}
+	type bucket struct {
+		start time.Time
+		n     int32
+		min   int64
+	}
+	buckets := func(resp *pb.GetScheduleSummaryResponse) []bucket {
+		var out []bucket
+		for _, b := range resp.Buckets {
+			out = append(out, bucket{b.StartTime.AsTime(), b.Appointments, b.BookedMinutes})
+		}
+		return out
+	}
+
+	daily := summary(&pb.GetScheduleSummaryRequest{})
+	want := []bucket{{at(0), 2, 120}, {at(24), 1, 60}, {at(48), 1, 30}, {at(72), 0, 0}, {at(96), 0, 0}, {at(120), 0, 0}, {at(144), 0, 0}}
+	if got := buckets(daily); !slices.Equal(got, want) {
+		t.Errorf("daily %v, want %v", got, want)
+	}
+	if daily.TotalAppointments != 3 || daily.TotalBookedMinutes != 210 {
+		t.Errorf("totals %d, %d", daily.TotalAppointments, daily.TotalBookedMinutes)
+	}
+
+	weekly := summary(&pb.GetScheduleSummaryRequest{Granularity: "week"})
+	if got := buckets(weekly); !slices.Equal(got, []bucket{{at(0), 3, 210}}) || !weekly.Buckets[0].EndTime.AsTime().Equal(at(7*24)) {
+		t.Errorf("weekly %v", got)
+	}
+
+	// Lagos is UTC+1: its days start at 23:00 UTC, so the late meeting
+	// falls wholly on Tuesday, and the last day runs past the range
+	lagos := summary(&pb.GetScheduleSummaryRequest{TimeZone: "Africa/Lagos"})
+	got := buckets(lagos)
+	if len(got) != 8 || got[0] != (bucket{at(-1), 1, 60}) || got[1] != (bucket{at(23), 1, 120}) || got[2] != (bucket{at(47), 1, 30}) {
+		t.Errorf("lagos %v", got)
+	}
+
+	// the range cuts a spanning appointment too
+	cut := summary(&pb.GetScheduleSummaryRequest{RangeStart: timestamppb.New(at(24)), RangeEnd: timestamppb.New(at(48))})
+	if got := buckets(cut); !slices.Equal(got, []bucket{{at(24), 1, 60}}) || cut.TotalBookedMinutes != 60 {
+		t.Errorf("cut %v, total %d", got, cut.TotalBookedMinutes)
+	}
+
+	for name, req := range map[string]*pb.GetScheduleSummaryRequest{
+		"no range":    {},
+		"backwards":   {RangeStart: timestamppb.New(at(24)), RangeEnd: timestamppb.New(at(0))},
+		"over a year": {RangeStart: timestamppb.New(at(0)), RangeEnd: timestamppb.New(at(367 * 24))},
+		"month":       {RangeStart: timestamppb.New(at(0)), RangeEnd: timestamppb.New(at(24)), Granularity: "month"},
+		"zone":        {RangeStart: timestamppb.New(at(0)), RangeEnd: timestamppb.New(at(24)), TimeZone: "Mars/Olympus"},
+	} {
+		if _, err := h.GetScheduleSummary(actx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestGetAppointment(t *testing.T) { eachStore(t, testGetAppointment) }
+
+func testGetAppointment(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	appt := createAppointment(t, h, ctx, 300)
+
+	gr, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: appt.Id})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if gr.Appointment.Title != appt.Title {
+		t.Errorf("title mismatch: %s vs %s", gr.Appointment.Title, appt.Title)
+	}
+}
+
+func TestGetAppointmentNotFound(t *testing.T) { eachStore(t, testGetAppointmentNotFound) }
+
+func testGetAppointmentNotFound(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	_, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: uuid.New().String()})
+	if err == nil {
+		t.Fatal("expected not found")
+	}
+	s, _ := status.FromError(err)
+	if s.Code() != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", s.Code())
+	}
+}
+
+func TestListAppointments(t *testing.T) { eachStore(t, testListAppointments) }
+
+func testListAppointments(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	createAppointment(t, h, ctx, 400)
+	createAppointment(t, h, ctx, 402)
+
+	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(lr.Appointments) < 2 {
+		t.Errorf("expected at least 2 appointments, got %d", len(lr.Appointments))
+	}
+}
+
+func TestListStatusFilter(t *testing.T) { eachStore(t, testListStatusFilter) }
+
+func testListStatusFilter(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	kept := createAppointment(t, h, ctx, 1750)
+	gone := createAppointment(t, h, ctx, 1752)
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: gone.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	from := timestamppb.New(time.Now().Add(1749 * time.Hour))
+	to := timestamppb.New(time.Now().Add(1760 * time.Hour))
+
+	for _, tt := range []struct {
+		statuses []string
+		want     []string
+	}{
+		{nil, []string{kept.Id}},
+		{[]string{"confirmed"}, []string{kept.Id}},
+		{[]string{"cancelled"}, []string{gone.Id}},
+		{[]string{"confirmed", "cancelled"}, []string{kept.Id, gone.Id}},
+		{[]string{"all", "cancelled"}, []string{kept.Id, gone.Id}},
+	} {
+		lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: from, RangeEnd: to, Statuses: tt.statuses})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.statuses, err)
+		}
+		var got []string
+		for _, a := range lr.Appointments {
+			got = append(got, a.Id)
+			if a.Id == gone.Id && a.Status != "cancelled" {
+				t.Errorf("%v: cancelled appointment has status %q", tt.statuses, a.Status)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%v: got %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+
+	// listing cancelled appointments doesn't make them hold their slot
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "rebook", StartTime: gone.StartTime, EndTime: gone.EndTime,
+	}); err != nil {
+		t.Errorf("rebook a cancelled slot: %v", err)
+	}
+}
+
+func TestListCompleted(t *testing.T) { eachStore(t, testListCompleted) }
+
+// "completed" is a confirmed appointment that has ended by the handler's
+// clock: not the one under way, not a cancelled one
+func testListCompleted(t *testing.T, st handler.Store, secret string) {
+	t0 := time.Now().Add(3100 * time.Hour).Truncate(time.Hour)
+	clk := clock.NewFake(t0)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithClock(clk))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	book := func(title string, start time.Duration) string {
+		t.Helper()
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(t0.Add(start)), EndTime: timestamppb.New(t0.Add(start + time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return cr.Appointment.Id
+	}
+	done := book("done", time.Hour)
+	current := book("current", 3*time.Hour)
+	later := book("later", 5*time.Hour)
+	gone := book("gone", 2*time.Hour)
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: gone}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	clk.Set(t0.Add(3*time.Hour + 30*time.Minute))
+
+	from, to := timestamppb.New(t0), timestamppb.New(t0.Add(10*time.Hour))
+	for _, tt := range []struct {
+		statuses []string
+		want     []string
+	}{
+		{[]string{"completed"}, []string{done}},
+		{[]string{"completed", "cancelled"}, []string{done, gone}},
+		{[]string{"completed", "confirmed"}, []string{done, current, later}},
+		{[]string{"all", "completed"}, []string{done, gone, current, later}},
+	} {
+		lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: from, RangeEnd: to, Statuses: tt.statuses})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.statuses, err)
+		}
+		var got []string
+		for _, a := range lr.Appointments {
+			got = append(got, a.Id)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%v: got %v, want %v", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+// listing must show the same attendees as fetching one appointment, over
+// grpc and over the bridge
+func TestListIncludesAttendees(t *testing.T) { eachStore(t, testListIncludesAttendees) }
+
+func testListIncludesAttendees(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	a1, _ := registerUser(t, h)
+	a2, _ := registerUser(t, h)
+
+	start := time.Now().Add(1700 * time.Hour).Truncate(time.Hour)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "with people", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{a1, a2},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// a second one without attendees must not pick up the first one's
+	createAppointment(t, h, ctx, 1702)
+
+	req := &pb.ListAppointmentsRequest{RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(24 * time.Hour))}
+	check := func(via string, apts []*pb.Appointment) {
+		t.Helper()
+		if len(apts) != 2 {
+			t.Fatalf("%s: got %d appointments, want 2", via, len(apts))
+		}
+		got := append([]string(nil), apts[0].AttendeeIds...)
+		sort.Strings(got)
+		want := []string{a1, a2}
+		sort.Strings(want)
+		if apts[0].Id != cr.Appointment.Id || strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: first appointment %v, want attendees %v", via, apts[0], want)
+		}
+		if len(apts[1].AttendeeIds) != 0 {
+			t.Errorf("%s: second appointment has attendees %v", via, apts[1].AttendeeIds)
+		}
+	}
+
+	lr, err := h.ListAppointments(ctx, req)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	check("grpc", lr.Appointments)
+
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	msg, _ := proto.Marshal(req)
+	code, grpcMsg, data := grpcWebCall(t, bridge.Handler(), "/appointment.v1.ScheduleService/ListAppointments", tok, msg)
+	if code != "0" {
+		t.Fatalf("bridge list: grpc-status %s: %s", code, grpcMsg)
+	}
+	web := &pb.ListAppointmentsResponse{}
+	if err := proto.Unmarshal(data, web); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	check("grpc-web", web.Appointments)
+}
+
+// the range keeps anything overlapping it, including appointments that
+// straddle either edge
+func TestListRangeBoundaries(t *testing.T) { eachStore(t, testListRangeBoundaries) }
+
+func testListRangeBoundaries(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	from := time.Now().Add(1800 * time.Hour).Truncate(time.Hour)
+	to := from.Add(24 * time.Hour)
+	book := func(title string, start, end time.Time) string {
+		t.Helper()
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end),
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return resp.Appointment.Id
+	}
+	want := []string{
+		book("straddles start", from.Add(-time.Hour), from.Add(time.Hour)),
+		book("inside", from.Add(5*time.Hour), from.Add(6*time.Hour)),
+		book("straddles end", to.Add(-time.Hour), to.Add(time.Hour)),
+	}
+	book("before", from.Add(-3*time.Hour), from.Add(-2*time.Hour))
+	book("after", to.Add(3*time.Hour), to.Add(4*time.Hour))
+
+	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(from), RangeEnd: timestamppb.New(to),
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var got []string
+	for _, a := range lr.Appointments {
+		got = append(got, a.Id)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("listed %v, want %v in start order", got, want)
+	}
+
+	for _, r := range [][2]time.Time{{to, from}, {from, from}} {
+		_, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+			RangeStart: timestamppb.New(r[0]), RangeEnd: timestamppb.New(r[1]),
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("range %v - %v: expected InvalidArgument, got %v", r[0], r[1], err)
+		}
+	}
+}
+
+func TestListUpcoming(t *testing.T) { eachStore(t, testListUpcoming) }
+
+// past appointments drop out, the one under way leads with in_progress
+// set, and the rest follow soonest first up to the limit
+func testListUpcoming(t *testing.T, st handler.Store, secret string) {
+	t0 := time.Now().Add(3000 * time.Hour).Truncate(time.Hour)
+	clk := clock.NewFake(t0)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithClock(clk))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	guest, guestEmail := registerUser(t, h)
+
+	book := func(title string, start time.Duration, attendees ...string) string {
+		t.Helper()
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(t0.Add(start)), EndTime: timestamppb.New(t0.Add(start + 2*time.Hour)),
+			AttendeeIds: attendees,
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return cr.Appointment.Id
+	}
+	book("past", 0)
+	current := book("current", 3*time.Hour, guest)
+	var future []string
+	for i := range 7 {
+		future = append(future, book(fmt.Sprintf("future %d", i), time.Duration(10+3*i)*time.Hour))
+	}
+	gone := book("cancelled", 6*time.Hour)
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: gone}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	other, _ := registerUser(t, h)
+	if _, err := h.CreateAppointment(authedCtx(other, secret), &pb.CreateAppointmentRequest{
+		Title: "someone else's", StartTime: timestamppb.New(t0.Add(4 * time.Hour)), EndTime: timestamppb.New(t0.Add(5 * time.Hour)),
+	}); err != nil {
+		t.Fatalf("other create: %v", err)
+	}
+	clk.Set(t0.Add(4 * time.Hour))
+
+	check := func(via string, got []*pb.UpcomingAppointment, want []string) {
+		t.Helper()
+		var ids []string
+		for i, u := range got {
+			ids = append(ids, u.Appointment.GetId())
+			if u.InProgress != (i == 0) {
+				t.Errorf("%s: %q in_progress = %v", via, u.Appointment.GetTitle(), u.InProgress)
+			}
+			if u.Appointment.GetOwnerName() != "Test User" {
+				t.Errorf("%s: %q owner_name = %q", via, u.Appointment.GetTitle(), u.Appointment.GetOwnerName())
+			}
+		}
+		if len(got) > 0 {
+			if a := got[0].Appointment.GetAttendees(); len(a) != 1 || a[0].Id != guest || a[0].Name != "Test User" || a[0].Email != guestEmail {
+				t.Errorf("%s: attendees of the current one = %v", via, a)
+			}
+		}
+		if strings.Join(ids, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got %v, want %v", via, ids, want)
+		}
+	}
+
+	resp, err := h.ListUpcomingAppointments(ctx, &pb.ListUpcomingAppointmentsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	check("default limit", resp.Appointments, append([]string{current}, future[:4]...))
+	resp, err = h.ListUpcomingAppointments(ctx, &pb.ListUpcomingAppointmentsRequest{Limit: 20})
+	if err != nil {
+		t.Fatalf("list 20: %v", err)
+	}
+	check("limit 20", resp.Appointments, append([]string{current}, future...))
+
+	for _, n := range []int32{-1, 21} {
+		if _, err := h.ListUpcomingAppointments(ctx, &pb.ListUpcomingAppointmentsRequest{Limit: n}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("limit %d: %v", n, err)
+		}
+	}
+
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	msg, _ := proto.Marshal(&pb.ListUpcomingAppointmentsRequest{Limit: 2})
+	code, grpcMsg, data := grpcWebCall(t, bridge.Handler(), "/appointment.v1.ScheduleService/ListUpcomingAppointments", tok, msg)
+	if code != "0" {
+		t.Fatalf("bridge: grpc-status %s: %s", code, grpcMsg)
+	}
+	web := &pb.ListUpcomingAppointmentsResponse{}
+	if err := proto.Unmarshal(data, web); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	check("grpc-web", web.Appointments, []string{current, future[0]})
+
+	// once the current one ends it's gone, and nothing is under way
+	clk.Set(t0.Add(5 * time.Hour))
+	resp, err = h.ListUpcomingAppointments(ctx, &pb.ListUpcomingAppointmentsRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("list later: %v", err)
+	}
+	if len(resp.Appointments) != 1 || resp.Appointments[0].Appointment.Id != future[0] || resp.Appointments[0].InProgress {
+		t.Errorf("after the current one ended: %v", resp.Appointments)
+	}
+}
+
+func TestUpdateAppointment(t *testing.T) { eachStore(t, testUpdateAppointment) }
+
+func testUpdateAppointment(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	appt := createAppointment(t, h, ctx, 500)
+
+	newStart := time.Now().Add(501 * time.Hour)
+	ur, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id:          appt.Id,
+		Title:       "Updated Title",
+		Description: "updated desc",
+		Location:    "New Room",
+		StartTime:   timestamppb.New(newStart),
+		EndTime:     timestamppb.New(newStart.Add(30 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if ur.Appointment.Title != "Updated Title" {
+		t.Errorf("title not updated: %s", ur.Appointment.Title)
+	}
+}
+
+func TestUpdateAppointmentConflict(t *testing.T) { eachStore(t, testUpdateAppointmentConflict) }
+
+func testUpdateAppointmentConflict(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// create two non-overlapping appointments
+	start1 := time.Now().Add(600 * time.Hour)
+	h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "First", StartTime: timestamppb.New(start1), EndTime: timestamppb.New(start1.Add(time.Hour)),
+	})
+	start2 := start1.Add(2 * time.Hour)
+	cr2, _ := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Second", StartTime: timestamppb.New(start2), EndTime: timestamppb.New(start2.Add(time.Hour)),
+	})
+
+	// try to move second appointment into first's slot
+	_, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id:        cr2.Appointment.Id,
+		Title:     "Moved",
+		StartTime: timestamppb.New(start1.Add(30 * time.Minute)),
+		EndTime:   timestamppb.New(start1.Add(90 * time.Minute)),
+	})
+	if err == nil {
+		t.Fatal("expected conflict on update")
+	}
+	s, _ := status.FromError(err)
+	if s.Code() != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists, got %v", s.Code())
+	}
+}
+
+func TestUpdateAppointmentMask(t *testing.T) {
+	h, st, secret := setup(t)
+	if !st.Has(store.FeatureAttendees) {
+		t.Skip("database not migrated for attendees")
+	}
+	uid, _ := registerUser(t, h)
+	guest, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	mask := func(paths ...string) *fieldmaskpb.FieldMask { return &fieldmaskpb.FieldMask{Paths: paths} }
+
+	start := time.Now().Add(640 * time.Hour).Truncate(time.Second)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Planning", Description: "q3", Location: "Room 1", AttendeeIds: []string{guest},
+		StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	id := cr.Appointment.Id
+	get := func() *pb.Appointment {
+		t.Helper()
+		gr, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: id})
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return gr.Appointment
+	}
+
+	// only the location: nothing else is sent, nothing else changes
+	ur, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, Location: "Room 2", UpdateMask: mask("location")})
+	if err != nil {
+		t.Fatalf("location only: %v", err)
+	}
+	for _, a := range []*pb.Appointment{ur.Appointment, get()} {
+		if a.Location != "Room 2" || a.Title != "Planning" || a.Description != "q3" ||
+			!a.StartTime.AsTime().Equal(start) || !slices.Equal(a.AttendeeIds, []string{guest}) {
+			t.Errorf("after location-only update: %+v", a)
+		}
+	}
+
+	// a title-only update keeps the attendees, even though the request has none
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, Title: "Planning v2", UpdateMask: mask("title")}); err != nil {
+		t.Fatalf("title only: %v", err)
+	}
+	if a := get(); a.Title != "Planning v2" || !slices.Equal(a.AttendeeIds, []string{guest}) {
+		t.Errorf("after title-only update: title %q, attendees %v", a.Title, a.AttendeeIds)
+	}
+	// naming attendee_ids does replace them
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, UpdateMask: mask("attendee_ids")}); err != nil {
+		t.Fatalf("clear attendees: %v", err)
+	}
+	if a := get(); len(a.AttendeeIds) != 0 {
+		t.Errorf("attendees %v, want none", a.AttendeeIds)
+	}
+
+	// moving only the end is checked for overlaps against the merged range
+	blocker := start.Add(2 * time.Hour)
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Blocker", StartTime: timestamppb.New(blocker), EndTime: timestamppb.New(blocker.Add(time.Hour)),
+	}); err != nil {
+		t.Fatalf("create blocker: %v", err)
+	}
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, EndTime: timestamppb.New(blocker.Add(time.Minute)), UpdateMask: mask("end_time")})
+	if apperr.ReasonOf(err) != apperr.ApptConflict {
+		t.Errorf("end into the blocker: %v", err)
+	}
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, EndTime: timestamppb.New(blocker), UpdateMask: mask("end_time")})
+	if err != nil {
+		t.Fatalf("end up to the blocker: %v", err)
+	}
+	if a := get(); !a.StartTime.AsTime().Equal(start) || !a.EndTime.AsTime().Equal(blocker) || a.Title != "Planning v2" {
+		t.Errorf("after end-only update: %+v", a)
+	}
+	// a start past the stored end is an empty range
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, StartTime: timestamppb.New(blocker), UpdateMask: mask("start_time")})
+	if apperr.ReasonOf(err) != apperr.ApptEmptyRange {
+		t.Errorf("start at the end: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		m    *fieldmaskpb.FieldMask
+		want string
+	}{
+		"empty":   {mask(), "update_mask: names no fields\n"},
+		"unknown": {mask("location", "user_id"), "update_mask: unknown field \"user_id\"\n"},
+		// only named fields are validated, and those still are
+		"blank title": {mask("title"), "title: required\n"},
+	} {
+		_, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: id, UpdateMask: tc.m})
+		if status.Code(err) != codes.InvalidArgument || violationsOf(err) != tc.want {
+			t.Errorf("%s mask: %v, violations %q", name, err, violationsOf(err))
+		}
+	}
+}
+
+func TestDeleteAppointment(t *testing.T) { eachStore(t, testDeleteAppointment) }
+
+func testDeleteAppointment(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	appt := createAppointment(t, h, ctx, 700)
+
+	_, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// verify its gone (or cancelled) from list
+	lr, _ := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
+	for _, a := range lr.Appointments {
+		if a.Id == appt.Id && a.Status != "cancelled" {
+			t.Error("expected appointment to be cancelled after delete")
+		}
+	}
+}
+
+func TestRestoreAppointment(t *testing.T) { eachStore(t, testRestoreAppointment) }
+
+func testRestoreAppointment(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	appt := createAppointment(t, h, ctx, 710)
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp, err := h.RestoreAppointment(ctx, &pb.RestoreAppointmentRequest{Id: appt.Id})
+	if err != nil {
+		t.Fatalf("restore into a free slot: %v", err)
+	}
+	if resp.Appointment.Status != "confirmed" {
+		t.Errorf("expected confirmed, got %q", resp.Appointment.Status)
+	}
+	// restoring something already live is a no-op
+	if _, err := h.RestoreAppointment(ctx, &pb.RestoreAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Errorf("restore twice: %v", err)
+	}
+
+	// someone else's appointment looks like it doesn't exist
+	other, _ := registerUser(t, h)
+	_, err = h.RestoreAppointment(authedCtx(other, secret), &pb.RestoreAppointmentRequest{Id: appt.Id})
+	if s, _ := status.FromError(err); s.Code() != codes.NotFound {
+		t.Errorf("expected NotFound for another user, got %v", s.Code())
+	}
+}
+
+// Every activation path must refuse a slot that was booked while the
+// appointment was inert.
+func TestActivateIntoOccupiedSlot(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// restore: cancel, rebook the slot, try to bring the old one back
+	old := createAppointment(t, h, ctx, 720)
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: old.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	createAppointment(t, h, ctx, 720)
+	_, err := h.RestoreAppointment(ctx, &pb.RestoreAppointmentRequest{Id: old.Id})
+	if s, _ := status.FromError(err); s.Code() != codes.AlreadyExists {
+		t.Errorf("restore into occupied slot: expected AlreadyExists, got %v", s.Code())
+	}
+	got, _ := st.GetAppointment(context.Background(), old.Id)
+	if got == nil || got.Status != "cancelled" {
+		t.Errorf("failed restore must leave the appointment cancelled: %+v", got)
+	}
+
+	// store level, concurrently: two inert appointments for the same slot,
+	// only one of them can come back
+	start := time.Now().Add(730 * time.Hour).Truncate(time.Second)
+	ids := make([]string, 2)
+	for i := range ids {
+		a := &model.Appointment{
+			ID: uuid.New().String(), Title: fmt.Sprintf("inert-%d", i), UserID: uid, Status: "cancelled",
+			StartTime: start, EndTime: start.Add(time.Hour),
+		}
+		if err := st.CreateAppointment(context.Background(), a); err != nil {
+			t.Fatalf("seed inert appointment: %v", err)
+		}
+		ids[i] = a.ID
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ids))
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			_, err := st.ActivateAppointment(context.Background(), id, uid)
+			errs <- err
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	var won, conflicts int
+	for err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, store.ErrConflict):
+			conflicts++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if won != 1 || conflicts != 1 {
+		t.Errorf("expected 1 activation and 1 ErrConflict, got %d and %d", won, conflicts)
+	}
+}
+
+func TestAppointmentHistory(t *testing.T) {
+	h, _, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	appt := createAppointment(t, h, ctx, 760)
+	update := func(title string, start time.Time) {
+		t.Helper()
+		_, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+			Id: appt.Id, Title: title, Description: appt.Description, Location: appt.Location,
+			StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	start := appt.StartTime.AsTime()
+	update("renamed", start)
+	update("renamed", start) // changes nothing: no audit row
+	update("renamed", start.Add(time.Hour))
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	if _, err := h.RestoreAppointment(ctx, &pb.RestoreAppointmentRequest{Id: appt.Id}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	var entries []*pb.AppointmentAuditEntry
+	var pages int
+	req := &pb.GetAppointmentHistoryRequest{AppointmentId: appt.Id, PageSize: 2}
+	for {
+		resp, err := h.GetAppointmentHistory(ctx, req)
+		if err != nil {
+			t.Fatalf("history: %v", err)
+		}
+		entries = append(entries, resp.Entries...)
+		pages++
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		if e.ActorId != uid {
+			t.Errorf("%s: actor %s", e.Action, e.ActorId)
+		}
+	}
+	if got := strings.Join(actions, ","); got != "create,update,update,cancel,restore" {
+		t.Fatalf("actions: %s", got)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages of 2, got %d", pages)
+	}
+	if entries[0].Before != nil || entries[0].After.Title != appt.Title {
+		t.Errorf("create entry: %v", entries[0])
+	}
+	if entries[1].Before.Title != appt.Title || entries[1].After.Title != "renamed" {
+		t.Errorf("rename entry: %v", entries[1])
+	}
+	if !entries[2].After.StartTime.AsTime().Equal(start.Add(time.Hour)) || !entries[2].Before.StartTime.AsTime().Equal(start) {
+		t.Errorf("move entry: %v", entries[2])
+	}
+	if entries[3].Before.Status != "confirmed" || entries[3].After.Status != "cancelled" {
+		t.Errorf("cancel entry: %v", entries[3])
+	}
+	if entries[4].After.Status != "confirmed" {
+		t.Errorf("restore entry: %v", entries[4])
+	}
+
+	// owner only
+	other, _ := registerUser(t, h)
+	_, err := h.GetAppointmentHistory(authedCtx(other, secret), &pb.GetAppointmentHistoryRequest{AppointmentId: appt.Id})
+	if s, _ := status.FromError(err); s.Code() != codes.NotFound {
+		t.Errorf("expected NotFound for another user, got %v", s.Code())
+	}
+	// and updating someone else's appointment is a 404, not a silent no-op
+	_, err = h.UpdateAppointment(authedCtx(other, secret), &pb.UpdateAppointmentRequest{
+		Id: appt.Id, Title: "hijack", StartTime: appt.StartTime, EndTime: appt.EndTime,
+	})
+	if s, _ := status.FromError(err); s.Code() != codes.NotFound {
+		t.Errorf("expected NotFound updating another user's appointment, got %v", s.Code())
+	}
+}
+
+// purging someone who changed another user's appointment keeps the entry,
+// with no actor
+func TestAppointmentHistoryOutlivesActor(t *testing.T) {
+	h, st, secret := setup(t)
+	owner, _ := registerUser(t, h)
+	ctx := authedCtx(owner, secret)
+	start := time.Now().Add(940 * time.Hour)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "open house", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)), Capacity: 5,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	guest, _ := registerUser(t, h)
+	gctx := authedCtx(guest, secret)
+	if _, err := h.JoinAppointment(gctx, &pb.JoinAppointmentRequest{Id: cr.Appointment.Id}); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if _, err := h.DeleteAccount(gctx, &pb.DeleteAccountRequest{Password: "testpass123"}); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	if _, err := st.PurgeDeletedUsers(context.Background(), 0); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	resp, err := h.GetAppointmentHistory(ctx, &pb.GetAppointmentHistoryRequest{AppointmentId: cr.Appointment.Id})
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(resp.Entries) != 2 || resp.Entries[0].ActorId != owner || resp.Entries[1].Action != "join" || resp.Entries[1].ActorId != "" {
+		t.Errorf("history %v, want the join kept without its actor", resp.Entries)
+	}
+}
+
+func TestOverlapPrevention(t *testing.T) { eachStore(t, testOverlapPrevention) }
+
+func testOverlapPrevention(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(800 * time.Hour)
+	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Existing", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("first create: %v", err)
+	}
+
+	// exact same slot
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Overlap", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+	if err == nil {
+		t.Fatal("expected conflict")
+	}
+	if r := apperr.ReasonOf(err); r != apperr.ApptConflict {
+		t.Errorf("conflict reason %q", r)
+	}
+
+	// partial overlap
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Partial", StartTime: timestamppb.New(start.Add(30 * time.Minute)), EndTime: timestamppb.New(start.Add(90 * time.Minute)),
+	})
+	if err == nil {
+		t.Fatal("expected conflict for partial overlap")
+	}
+
+	// adjacent — should succeed (end is exclusive, and the buffer defaults to 0)
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Adjacent", StartTime: timestamppb.New(start.Add(time.Hour)), EndTime: timestamppb.New(start.Add(2 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("adjacent should not conflict: %v", err)
+	}
+}
+
+// the constraint and HasOverlap must agree on [) — touching slots are fine,
+// any real overlap isn't, whichever layer catches it
+func TestAdjacentSlotsAtDBLayer(t *testing.T) {
+	h, st, _ := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := context.Background()
+
+	start := time.Now().Add(1200 * time.Hour).Truncate(time.Second)
+	slot := func(i int) *model.Appointment {
+		s := start.Add(time.Duration(i) * 15 * time.Minute)
+		return &model.Appointment{
+			ID: uuid.New().String(), Title: fmt.Sprintf("slot-%d", i), UserID: uid, Status: "confirmed",
+			StartTime: s, EndTime: s.Add(15 * time.Minute),
+		}
+	}
+
+	// straight to the store, concurrently, so only the constraint is in play
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(a *model.Appointment) {
+			defer wg.Done()
+			errs <- st.CreateAppointment(ctx, a)
+		}(slot(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("adjacent insert rejected by the db: %v", err)
+		}
+	}
+
+	// overlapping by a millisecond: both layers say no
+	a := slot(n)
+	a.StartTime = a.StartTime.Add(-time.Millisecond)
+	if dup, err := st.HasOverlap(ctx, uid, a.StartTime, a.EndTime, false, ""); err != nil || !dup {
+		t.Errorf("HasOverlap missed a 1ms overlap (dup=%v, err=%v)", dup, err)
+	}
+	if err := st.CreateAppointment(ctx, a); err == nil {
+		t.Error("constraint allowed a 1ms overlap")
+	}
+
+	// exactly touching the last slot: both layers say yes
+	b := slot(n)
+	if dup, err := st.HasOverlap(ctx, uid, b.StartTime, b.EndTime, false, ""); err != nil || dup {
+		t.Errorf("HasOverlap flagged a touching slot (dup=%v, err=%v)", dup, err)
+	}
+	if err := st.CreateAppointment(ctx, b); err != nil {
+		t.Errorf("constraint rejected a touching slot: %v", err)
+	}
+}
+
+func TestZeroDurationRejected(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	at := time.Now().Add(1300 * time.Hour)
+	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "instant", StartTime: timestamppb.New(at), EndTime: timestamppb.New(at),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for start == end, got %v", err)
+	}
+
+	// and the store refuses on its own, without a round trip
+	a := &model.Appointment{ID: uuid.New().String(), Title: "instant", UserID: uid, Status: "confirmed", StartTime: at, EndTime: at}
+	if err := st.CreateAppointment(context.Background(), a); !errors.Is(err, store.ErrEmptyRange) {
+		t.Errorf("expected ErrEmptyRange, got %v", err)
+	}
+	if _, err := st.HasOverlap(context.Background(), uid, at, at, false, ""); !errors.Is(err, store.ErrEmptyRange) {
+		t.Errorf("expected ErrEmptyRange from HasOverlap, got %v", err)
+	}
+}
+
+func TestGroupAppointments(t *testing.T) { eachStore(t, testGroupAppointments) }
+
+func testGroupAppointments(t *testing.T, h *handler.Handler, secret string) {
+	owner, _ := registerUser(t, h)
+	ctx := authedCtx(owner, secret)
+	start := time.Now().Add(920 * time.Hour)
+	friend, _ := registerUser(t, h)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title:       "book club",
+		StartTime:   timestamppb.New(start),
+		EndTime:     timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{friend},
+		Capacity:    2,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	g := cr.Appointment
+	if g.Capacity != 2 || g.AttendeeCount != 1 || g.SpotsLeft != 1 {
+		t.Fatalf("capacity %d, count %d, left %d; want 2, 1, 1", g.Capacity, g.AttendeeCount, g.SpotsLeft)
+	}
+
+	a, _ := registerUser(t, h)
+	actx := authedCtx(a, secret)
+	jr, err := h.JoinAppointment(actx, &pb.JoinAppointmentRequest{Id: g.Id})
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if jr.Appointment.SpotsLeft != 0 || !slices.Contains(jr.Appointment.AttendeeIds, a) {
+		t.Errorf("after join: left %d, attendees %v", jr.Appointment.SpotsLeft, jr.Appointment.AttendeeIds)
+	}
+	if _, err := h.JoinAppointment(actx, &pb.JoinAppointmentRequest{Id: g.Id}); err != nil {
+		t.Errorf("joining twice: %v", err)
+	}
+
+	b, _ := registerUser(t, h)
+	bctx := authedCtx(b, secret)
+	if _, err := h.JoinAppointment(bctx, &pb.JoinAppointmentRequest{Id: g.Id}); apperr.ReasonOf(err) != apperr.ApptFull {
+		t.Errorf("join when full: want APPT_FULL, got %v", err)
+	}
+	// the owner can't shrink it below who's on it
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: g.Id, Capacity: 1, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"capacity"}},
+	}); apperr.ReasonOf(err) != apperr.ApptFull {
+		t.Errorf("capacity below attendees: want APPT_FULL, got %v", err)
+	}
+
+	if _, err := h.LeaveAppointment(actx, &pb.LeaveAppointmentRequest{Id: g.Id}); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	if _, err := h.LeaveAppointment(actx, &pb.LeaveAppointmentRequest{Id: g.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("leaving twice: want NotFound, got %v", err)
+	}
+	if _, err := h.JoinAppointment(bctx, &pb.JoinAppointmentRequest{Id: g.Id}); err != nil {
+		t.Errorf("join after a spot freed up: %v", err)
+	}
+
+	lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start.Add(-time.Hour)), RangeEnd: timestamppb.New(start.Add(2 * time.Hour)),
+	})
+	if err != nil || len(lr.Appointments) != 1 {
+		t.Fatalf("list: %v %v", lr, err)
+	}
+	if got := lr.Appointments[0]; got.AttendeeCount != 2 || got.SpotsLeft != 0 {
+		t.Errorf("listed count %d, left %d; want 2, 0", got.AttendeeCount, got.SpotsLeft)
+	}
+
+	// not joinable: your own, a private one, a cancelled one
+	if _, err := h.JoinAppointment(ctx, &pb.JoinAppointmentRequest{Id: g.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("owner joining: want NotFound, got %v", err)
+	}
+	private := createAppointment(t, h, ctx, 930)
+	if private.Capacity != 0 || private.SpotsLeft != 0 {
+		t.Errorf("default capacity %d, left %d; want private", private.Capacity, private.SpotsLeft)
+	}
+	if _, err := h.JoinAppointment(actx, &pb.JoinAppointmentRequest{Id: private.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("joining a private appointment: want NotFound, got %v", err)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: g.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.JoinAppointment(actx, &pb.JoinAppointmentRequest{Id: g.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("joining a cancelled appointment: want NotFound, got %v", err)
+	}
+
+	for _, req := range []*pb.CreateAppointmentRequest{
+		{Title: "t", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)), Capacity: 501},
+		{Title: "t", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)), Capacity: 1, AttendeeIds: []string{a, b}},
+	} {
+		if _, err := h.CreateAppointment(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("capacity %d with %d attendees: want InvalidArgument, got %v", req.Capacity, len(req.AttendeeIds), err)
+		}
+	}
+}
+
+// ----- concurrent booking -----
+
+func TestConcurrentBooking(t *testing.T) { eachStore(t, testConcurrentBooking) }
+
+func testConcurrentBooking(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(900 * time.Hour)
+	end := start.Add(time.Hour)
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title:     fmt.Sprintf("concurrent-%d", i),
+				StartTime: timestamppb.New(start),
+				EndTime:   timestamppb.New(end),
+			})
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	successes := 0
+	conflicts := 0
+	for err := range results {
+		if err == nil {
+			successes++
+		} else if s, ok := status.FromError(err); ok && s.Code() == codes.AlreadyExists {
+			conflicts++
+		} else {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if successes != 1 {
+		t.Errorf("expected exactly 1 success, got %d", successes)
+	}
+	if conflicts != n-1 {
+		t.Errorf("expected %d conflicts, got %d", n-1, conflicts)
+	}
+	t.Logf("concurrent: %d success, %d conflicts (out of %d)", successes, conflicts, n)
+}
+
+// many users racing for the last spots of one group event: exactly
+// capacity of them get in
+func TestConcurrentJoin(t *testing.T) { eachStore(t, testConcurrentJoin) }
+
+func testConcurrentJoin(t *testing.T, h *handler.Handler, secret string) {
+	owner, _ := registerUser(t, h)
+	start := time.Now().Add(910 * time.Hour)
+	cr, err := h.CreateAppointment(authedCtx(owner, secret), &pb.CreateAppointmentRequest{
+		Title:     "workshop",
+		StartTime: timestamppb.New(start),
+		EndTime:   timestamppb.New(start.Add(time.Hour)),
+		Capacity:  3,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	const n = 10
+	users := make([]string, n)
+	for i := range users {
+		users[i], _ = registerUser(t, h)
+	}
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+
+	for _, u := range users {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			_, err := h.JoinAppointment(authedCtx(u, secret), &pb.JoinAppointmentRequest{Id: cr.Appointment.Id})
+			results <- err
+		}(u)
+	}
+	wg.Wait()
+	close(results)
+
+	successes := 0
+	full := 0
+	for err := range results {
+		if err == nil {
+			successes++
+		} else if apperr.ReasonOf(err) == apperr.ApptFull {
+			full++
+		} else {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	if successes != 3 {
+		t.Errorf("expected exactly 3 joins, got %d", successes)
+	}
+	if full != n-3 {
+		t.Errorf("expected %d APPT_FULL, got %d", n-3, full)
+	}
+	gr, err := h.GetAppointment(authedCtx(owner, secret), &pb.GetAppointmentRequest{Id: cr.Appointment.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gr.Appointment.AttendeeCount != 3 || gr.Appointment.SpotsLeft != 0 {
+		t.Errorf("stored count %d, left %d; want 3, 0", gr.Appointment.AttendeeCount, gr.Appointment.SpotsLeft)
+	}
+}
+
+func TestRescheduleAppointment(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		owner, _ := registerUser(t, h)
+		ctx := authedCtx(owner, secret)
+		a := createAppointment(t, h, ctx, 920)
+		orig := a.StartTime.AsTime()
+
+		// three moves, each an hour later than the last
+		for i := 1; i <= 3; i++ {
+			start := orig.Add(time.Duration(i) * time.Hour)
+			rr, err := h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{
+				Id:        a.Id,
+				StartTime: timestamppb.New(start),
+				EndTime:   timestamppb.New(start.Add(time.Hour)),
+				Reason:    fmt.Sprintf("move %d", i),
+			})
+			if err != nil {
+				t.Fatalf("reschedule %d: %v", i, err)
+			}
+			if got := rr.Appointment.RescheduleCount; got != int32(i) {
+				t.Errorf("reschedule %d: count %d", i, got)
+			}
+		}
+
+		history := func() []*pb.RescheduleEntry {
+			t.Helper()
+			hr, err := h.GetRescheduleHistory(ctx, &pb.GetRescheduleHistoryRequest{AppointmentId: a.Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return hr.Entries
+		}
+		entries := history()
+		if len(entries) != 3 {
+			t.Fatalf("got %d entries, want 3", len(entries))
+		}
+		for i, e := range entries {
+			oldStart := orig.Add(time.Duration(i) * time.Hour)
+			if !e.OldStart.AsTime().Equal(oldStart) || !e.NewStart.AsTime().Equal(oldStart.Add(time.Hour)) {
+				t.Errorf("entry %d: %v -> %v", i, e.OldStart.AsTime(), e.NewStart.AsTime())
+			}
+			if !e.OldEnd.AsTime().Equal(oldStart.Add(time.Hour)) || !e.NewEnd.AsTime().Equal(oldStart.Add(2*time.Hour)) {
+				t.Errorf("entry %d ends: %v -> %v", i, e.OldEnd.AsTime(), e.NewEnd.AsTime())
+			}
+			if e.RescheduledBy != owner || e.Reason != fmt.Sprintf("move %d", i+1) {
+				t.Errorf("entry %d: by %q, reason %q", i, e.RescheduledBy, e.Reason)
+			}
+		}
+
+		// onto another appointment: conflict, and nothing recorded
+		other := createAppointment(t, h, ctx, 940)
+		_, err := h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{
+			Id:        a.Id,
+			StartTime: other.StartTime,
+			EndTime:   other.EndTime,
+		})
+		if status.Code(err) != codes.AlreadyExists || apperr.ReasonOf(err) != apperr.ApptConflict {
+			t.Fatalf("conflict: %v", err)
+		}
+		if got := len(history()); got != 3 {
+			t.Errorf("conflict left %d entries, want 3", got)
+		}
+		gr, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: a.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gr.Appointment.RescheduleCount != 3 || !gr.Appointment.StartTime.AsTime().Equal(orig.Add(3*time.Hour)) {
+			t.Errorf("after conflict: count %d, start %v", gr.Appointment.RescheduleCount, gr.Appointment.StartTime.AsTime())
+		}
+
+		// the history is the owner's only
+		stranger, _ := registerUser(t, h)
+		_, err = h.GetRescheduleHistory(authedCtx(stranger, secret), &pb.GetRescheduleHistoryRequest{AppointmentId: a.Id})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("stranger's history: %v", err)
+		}
+		_, err = h.RescheduleAppointment(authedCtx(stranger, secret), &pb.RescheduleAppointmentRequest{
+			Id: a.Id, StartTime: timestamppb.New(orig), EndTime: timestamppb.New(orig.Add(time.Hour)),
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("stranger's reschedule: %v", err)
+		}
+
+		// a cancelled one stays where it is
+		if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: other.Id}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{
+			Id:        other.Id,
+			StartTime: timestamppb.New(orig.Add(100 * time.Hour)),
+			EndTime:   timestamppb.New(orig.Add(101 * time.Hour)),
+		})
+		if status.Code(err) != codes.FailedPrecondition || apperr.ReasonOf(err) != apperr.ApptCancelled {
+			t.Errorf("cancelled: %v", err)
+		}
+
+		_, err = h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{
+			Id: a.Id, StartTime: timestamppb.New(orig.Add(time.Hour)), EndTime: timestamppb.New(orig),
+		})
+		if apperr.ReasonOf(err) != apperr.ApptEmptyRange {
+			t.Errorf("empty range: %v", err)
+		}
+	})
+}
+
+// newResource creates a uniquely named resource as an admin.
+func newResource(t *testing.T, st *store.Store, secret string) (*handler.Handler, *pb.Resource) {
+	t.Helper()
+	if !st.Has(store.FeatureResources) {
+		t.Skip("database not migrated for resources")
+	}
+	base := handler.New(st, auth.SingleKey(secret))
+	adminID, _ := registerUser(t, base)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAdmins([]string{adminID}))
+	r, err := h.CreateResource(authedCtx(adminID, secret), &pb.CreateResourceRequest{Name: "Room " + uuid.NewString()[:8]})
+	if err != nil {
+		t.Fatalf("create resource: %v", err)
+	}
+	return h, r.Resource
+}
+
+// two users hammering one room: the room is booked once, whoever wins
+func TestConcurrentResourceBooking(t *testing.T) {
+	_, st, secret := setup(t)
+	h, room := newResource(t, st, secret)
+	alice, _ := registerUser(t, h)
+	bob, _ := registerUser(t, h)
+
+	start := time.Now().Add(905 * time.Hour)
+	end := start.Add(time.Hour)
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		uid := alice
+		if i%2 == 1 {
+			uid = bob
+		}
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title: "standup", ResourceId: room.Id,
+				StartTime: timestamppb.New(start), EndTime: timestamppb.New(end),
+			})
+			results <- err
+		}(authedCtx(uid, secret))
+	}
+	wg.Wait()
+	close(results)
+
+	// a loser is refused for the room, or for the slot if it's the winner's own
+	successes, booked := 0, 0
+	for err := range results {
+		switch apperr.ReasonOf(err) {
+		case "":
+			successes++
+		case apperr.ResourceBooked, apperr.ApptConflict:
+			booked++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if successes != 1 || booked != n-1 {
+		t.Errorf("%d successes, %d rejected, want 1 and %d", successes, booked, n-1)
+	}
+
+	busy, err := h.GetResourceAvailability(authedCtx(alice, secret), &pb.GetResourceAvailabilityRequest{
+		ResourceId: room.Id, StartTime: timestamppb.New(start.Add(-time.Hour)), EndTime: timestamppb.New(end.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("availability: %v", err)
+	}
+	if len(busy.Busy) != 1 || busy.Resource.Name != room.Name {
+		t.Errorf("availability %v", busy)
+	}
+}
+
+func TestResourceBooking(t *testing.T) {
+	_, st, secret := setup(t)
+	h, room := newResource(t, st, secret)
+	alice, _ := registerUser(t, h)
+	bob, _ := registerUser(t, h)
+	actx, bctx := authedCtx(alice, secret), authedCtx(bob, secret)
+
+	day := time.Now().Add(960 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h int) *timestamppb.Timestamp { return timestamppb.New(day.Add(time.Duration(h) * time.Hour)) }
+
+	mine, err := h.CreateAppointment(actx, &pb.CreateAppointmentRequest{Title: "review", ResourceId: room.Id, StartTime: at(10), EndTime: at(11)})
+	if err != nil {
+		t.Fatalf("book: %v", err)
+	}
+	if mine.Appointment.ResourceId != room.Id {
+		t.Errorf("resource_id %q", mine.Appointment.ResourceId)
+	}
+
+	// someone else, same room, overlapping: refused without naming alice's meeting
+	_, err = h.CreateAppointment(bctx, &pb.CreateAppointmentRequest{Title: "1:1", ResourceId: room.Id, StartTime: at(10), EndTime: at(12)})
+	if apperr.ReasonOf(err) != apperr.ResourceBooked || conflictInfo(err) != nil {
+		t.Fatalf("double booking: %v", err)
+	}
+	// back to back is fine, and so is the same time without the room
+	if _, err := h.CreateAppointment(bctx, &pb.CreateAppointmentRequest{Title: "after", ResourceId: room.Id, StartTime: at(11), EndTime: at(12)}); err != nil {
+		t.Errorf("back to back: %v", err)
+	}
+	if _, err := h.CreateAppointment(bctx, &pb.CreateAppointmentRequest{Title: "elsewhere", Location: room.Name, StartTime: at(10), EndTime: at(11)}); err != nil {
+		t.Errorf("free-text location: %v", err)
+	}
+	if _, err := h.CreateAppointment(bctx, &pb.CreateAppointmentRequest{Title: "x", ResourceId: uuid.NewString(), StartTime: at(14), EndTime: at(15)}); apperr.ReasonOf(err) != apperr.ResourceNotFound {
+		t.Errorf("unknown resource: %v", err)
+	}
+
+	// an edit that keeps the slot keeps the booking; a move into bob's slot doesn't
+	get := func() *pb.Appointment {
+		g, err := h.GetAppointment(actx, &pb.GetAppointmentRequest{Id: mine.Appointment.Id})
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return g.Appointment
+	}
+	if _, err := h.UpdateAppointment(actx, &pb.UpdateAppointmentRequest{Id: mine.Appointment.Id, Title: "review v2", StartTime: at(10), EndTime: at(11)}); err != nil {
+		t.Fatalf("retitle: %v", err)
+	}
+	if a := get(); a.ResourceId != room.Id {
+		t.Errorf("update without resource_id dropped it: %+v", a)
+	}
+	_, err = h.UpdateAppointment(actx, &pb.UpdateAppointmentRequest{Id: mine.Appointment.Id, StartTime: at(11), EndTime: at(12), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"start_time", "end_time"}}})
+	if apperr.ReasonOf(err) != apperr.ResourceBooked {
+		t.Errorf("move into a booked slot: %v", err)
+	}
+	// freeing the room through the mask
+	if _, err := h.UpdateAppointment(actx, &pb.UpdateAppointmentRequest{Id: mine.Appointment.Id, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"resource_id"}}}); err != nil {
+		t.Fatalf("free the room: %v", err)
+	}
+	if a := get(); a.ResourceId != "" {
+		t.Errorf("resource still %q", a.ResourceId)
+	}
+	if _, err := h.CreateAppointment(bctx, &pb.CreateAppointmentRequest{Title: "took it", ResourceId: room.Id, StartTime: at(10), EndTime: at(11)}); err != nil {
+		t.Errorf("book the freed room: %v", err)
+	}
+
+	// availability says when, not who
+	av, err := h.GetResourceAvailability(actx, &pb.GetResourceAvailabilityRequest{ResourceId: room.Id, StartTime: at(0), EndTime: at(24)})
+	if err != nil {
+		t.Fatalf("availability: %v", err)
+	}
+	var got []string
+	for _, b := range av.Busy {
+		got = append(got, fmt.Sprintf("%s-%s", b.StartTime.AsTime().Sub(day), b.EndTime.AsTime().Sub(day)))
+	}
+	if strings.Join(got, " ") != "10h0m0s-11h0m0s 11h0m0s-12h0m0s" {
+		t.Errorf("busy %v", got)
+	}
+	_, err = h.GetResourceAvailability(actx, &pb.GetResourceAvailabilityRequest{ResourceId: room.Id, StartTime: at(0), EndTime: at(24 * 40)})
+	if violationsOf(err) != "end_time: at most 31 days after start_time\n" {
+		t.Errorf("long range: %v", err)
+	}
+
+	list, err := h.ListResources(actx, &pb.ListResourcesRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	found := false
+	for _, r := range list.Resources {
+		found = found || r.Id == room.Id
+	}
+	if !found {
+		t.Error("new resource not listed")
+	}
+	if _, err := h.CreateResource(actx, &pb.CreateResourceRequest{Name: "mine"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("non-admin CreateResource: %v", err)
+	}
+}
+
+func TestAppointmentTags(t *testing.T) { eachStore(t, testAppointmentTags) }
+
+func testAppointmentTags(t *testing.T, h *handler.Handler, secret string) {
+	userID, _ := registerUser(t, h)
+	ctx := authedCtx(userID, secret)
+	day := time.Now().Add(1200 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h int) *timestamppb.Timestamp { return timestamppb.New(day.Add(time.Duration(h) * time.Hour)) }
+
+	create := func(title string, hour int, tags ...string) *pb.Appointment {
+		t.Helper()
+		r, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: title, StartTime: at(hour), EndTime: at(hour + 1), Tags: tags})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return r.Appointment
+	}
+	kickoff := create("kickoff", 9, "Client", " internal ", "client")
+	if got := strings.Join(kickoff.Tags, ","); got != "client,internal" {
+		t.Errorf("stored tags %q", got)
+	}
+	create("dentist", 11, "personal")
+	create("untagged", 13)
+
+	list := func(tags ...string) string {
+		t.Helper()
+		r, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: at(0), RangeEnd: at(24), Tags: tags})
+		if err != nil {
+			t.Fatalf("list %v: %v", tags, err)
+		}
+		var titles []string
+		for _, a := range r.Appointments {
+			titles = append(titles, a.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+	for tags, want := range map[string]string{
+		"":                  "kickoff,dentist,untagged",
+		"CLIENT":            "kickoff",
+		"internal,personal": "kickoff,dentist",
+		"travel":            "",
+	} {
+		var filter []string
+		if tags != "" {
+			filter = strings.Split(tags, ",")
+		}
+		if got := list(filter...); got != want {
+			t.Errorf("tags %q: %q, want %q", tags, got, want)
+		}
+	}
+
+	// a masked update replaces them, one that doesn't name them keeps them
+	upd, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: kickoff.Id, Tags: []string{"Travel"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"tags"}}})
+	if err != nil || strings.Join(upd.Appointment.Tags, ",") != "travel" {
+		t.Fatalf("replace tags: %v %v", upd, err)
+	}
+	upd, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: kickoff.Id, Title: "kick-off",
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}}})
+	if err != nil || strings.Join(upd.Appointment.Tags, ",") != "travel" {
+		t.Fatalf("rename: %v %v", upd, err)
+	}
+	if got := list("client"); got != "" {
+		t.Errorf("old tag still matches: %q", got)
+	}
+	// and a full update without any clears them
+	upd, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: kickoff.Id, Title: "kick-off", StartTime: at(9), EndTime: at(10)})
+	if err != nil || len(upd.Appointment.Tags) != 0 {
+		t.Fatalf("full update: %v %v", upd, err)
+	}
+	got, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: kickoff.Id})
+	if err != nil || len(got.Appointment.Tags) != 0 {
+		t.Errorf("after clearing: %v %v", got, err)
+	}
+}
+
+// tags are checked before anything is stored
+func TestTagValidation(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("secret"))
+	ctx := authedCtx(uuid.NewString(), "secret")
+	start := timestamppb.New(time.Now().Add(time.Hour))
+	end := timestamppb.New(time.Now().Add(2 * time.Hour))
+	eleven := make([]string, 11)
+	for i := range eleven {
+		eleven[i] = fmt.Sprint("t", i)
+	}
+	for name, tc := range map[string]struct {
+		tags []string
+		want string
+	}{
+		"too many": {eleven, "tags: at most 10 tags\n"},
+		"too long": {[]string{strings.Repeat("x", 31)}, fmt.Sprintf("tags: %q: at most 30 characters\n", strings.Repeat("x", 31))},
+		"blank":    {[]string{"ok", "  "}, "tags: no empty tags\n"},
+	} {
+		_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "x", StartTime: start, EndTime: end, Tags: tc.tags})
+		if got := violationsOf(err); got != tc.want {
+			t.Errorf("create, %s: %q", name, got)
+		}
+		_, err = h.ListAppointments(ctx, &pb.ListAppointmentsRequest{Tags: tc.tags})
+		if got := violationsOf(err); got != tc.want {
+			t.Errorf("list, %s: %q", name, got)
+		}
+	}
+	// duplicates only count once (the missing title keeps this off the store)
+	twice := append(eleven[:10:10], "T0", "t1 ")
+	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{StartTime: start, EndTime: end, Tags: twice})
+	if got := violationsOf(err); got != "title: required\n" {
+		t.Errorf("ten distinct tags: %q", got)
+	}
+}
+
+// webhookSink records what a webhook receiver gets.
+type webhookSink struct {
+	mu     sync.Mutex
+	status int
+	got    []*http.Request
+	bodies [][]byte
+}
+
+func (s *webhookSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, r)
+	s.bodies = append(s.bodies, body)
+	w.WriteHeader(s.status)
+}
+
+// webhooks can't point at the server's own network
+func TestWebhookPrivateURLs(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"https://10.0.0.5/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.0.1]/hook",
+	} {
+		if _, err := h.RegisterWebhook(ctx, &pb.RegisterWebhookRequest{Url: u}); violationsOf(err) != "url: must resolve to a public address\n" {
+			t.Errorf("%s: %v", u, err)
+		}
+	}
+	dev := handler.New(st, auth.SingleKey(secret), handler.WithPrivateWebhooks(true))
+	uid, _ = registerUser(t, dev)
+	if _, err := dev.RegisterWebhook(authedCtx(uid, secret), &pb.RegisterWebhookRequest{Url: "http://127.0.0.1:8080/hook"}); err != nil {
+		t.Errorf("private allowed: %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	_, st, secret := setup(t)
+	// the receivers are on loopback
+	h := handler.New(st, auth.SingleKey(secret), handler.WithPrivateWebhooks(true))
+	alice, _ := registerUser(t, h)
+	bob, _ := registerUser(t, h)
+	actx, bctx := authedCtx(alice, secret), authedCtx(bob, secret)
+
+	for _, bad := range []string{"", "ftp://example.com/hook", "/relative", "https://"} {
+		if _, err := h.RegisterWebhook(actx, &pb.RegisterWebhookRequest{Url: bad}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("url %q: %v", bad, err)
+		}
+	}
+
+	ok := &webhookSink{status: http.StatusOK}
+	okSrv := httptest.NewServer(ok)
+	defer okSrv.Close()
+	down := &webhookSink{status: http.StatusInternalServerError}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+
+	reg, err := h.RegisterWebhook(actx, &pb.RegisterWebhookRequest{Url: okSrv.URL + "/hook"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if len(reg.Secret) != 64 || !reg.Webhook.Enabled || reg.Webhook.LastAttemptAt != nil {
+		t.Errorf("registered %+v", reg)
+	}
+	bobs, err := h.RegisterWebhook(bctx, &pb.RegisterWebhookRequest{Url: downSrv.URL})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	// alice books, moves, renames and cancels; bob books once
+	a := createAppointment(t, h, actx, 1100)
+	moved := a.StartTime.AsTime().Add(time.Hour)
+	if _, err := h.UpdateAppointment(actx, &pb.UpdateAppointmentRequest{
+		Id: a.Id, StartTime: timestamppb.New(moved), EndTime: timestamppb.New(moved.Add(time.Hour)),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"start_time", "end_time"}},
+	}); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if _, err := h.UpdateAppointment(actx, &pb.UpdateAppointmentRequest{
+		Id: a.Id, Title: "renamed", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if _, err := h.DeleteAppointment(actx, &pb.DeleteAppointmentRequest{Id: a.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	createAppointment(t, h, bctx, 1100)
+
+	// nothing goes out until the dispatcher runs
+	if len(ok.got) != 0 {
+		t.Fatal("delivered inside the transaction")
+	}
+	d := webhook.NewDispatcher(st, webhook.WithPrivateAddresses(), webhook.WithBackoff(time.Hour, time.Hour))
+	d.Tick(context.Background())
+
+	type delivery struct {
+		id      int
+		payload store.WebhookPayload
+	}
+	var got []delivery
+	for i, r := range ok.got {
+		ts := r.Header.Get("X-Webhook-Timestamp")
+		if sig := r.Header.Get("X-Webhook-Signature"); sig != "sha256="+webhook.Sign(reg.Secret, ts, ok.bodies[i]) {
+			t.Errorf("bad signature %q", sig)
+		}
+		var p store.WebhookPayload
+		if err := json.Unmarshal(ok.bodies[i], &p); err != nil {
+			t.Fatalf("payload: %v", err)
+		}
+		if p.AppointmentID != a.Id || r.Header.Get("X-Webhook-Event") != p.Event {
+			t.Errorf("delivery %s: %+v", r.Header.Get("X-Webhook-Event"), p)
+		}
+		id, _ := strconv.Atoi(r.Header.Get("X-Webhook-Delivery"))
+		got = append(got, delivery{id, p})
+	}
+	// sent concurrently; the outbox order is the order of the changes
+	sort.Slice(got, func(i, j int) bool { return got[i].id < got[j].id })
+	var events []string
+	for _, d := range got {
+		events = append(events, d.payload.Event)
+	}
+	want := []string{store.EventCreated, store.EventRescheduled, store.EventUpdated, store.EventCancelled}
+	if !slices.Equal(events, want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	if p := got[1].payload; p.Previous == nil || !p.Previous.StartTime.Equal(a.StartTime.AsTime()) || !p.Appointment.StartTime.Equal(moved) {
+		t.Errorf("reschedule payload %+v", p)
+	}
+	if p := got[3].payload; p.Appointment.Status != "cancelled" || p.Previous != nil {
+		t.Errorf("cancel payload %+v", p)
+	}
+
+	// bob's endpoint is down: one attempt now, the retry an hour out
+	if len(down.got) != 1 {
+		t.Errorf("down endpoint got %d requests", len(down.got))
+	}
+	d.Tick(context.Background())
+	if len(down.got) != 1 || len(ok.got) != 4 {
+		t.Errorf("second tick resent: %d, %d", len(down.got), len(ok.got))
+	}
+
+	list, err := h.ListWebhooks(bctx, &pb.ListWebhooksRequest{})
+	if err != nil || len(list.Webhooks) != 1 {
+		t.Fatalf("list: %v %v", list, err)
+	}
+	if w := list.Webhooks[0]; w.Id != bobs.Webhook.Id || w.LastStatus != 500 || w.LastError == "" || w.LastAttemptAt == nil || w.LastSuccessAt != nil {
+		t.Errorf("failing webhook %+v", w)
+	}
+	list, _ = h.ListWebhooks(actx, &pb.ListWebhooksRequest{})
+	if w := list.Webhooks[0]; w.LastStatus != 200 || w.LastError != "" || w.LastSuccessAt == nil {
+		t.Errorf("working webhook %+v", w)
+	}
+
+	// disabled webhooks queue nothing
+	if _, err := h.SetWebhookEnabled(actx, &pb.SetWebhookEnabledRequest{Id: reg.Webhook.Id}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	createAppointment(t, h, actx, 1200)
+	d.Tick(context.Background())
+	if len(ok.got) != 4 {
+		t.Errorf("disabled webhook got %d deliveries", len(ok.got))
+	}
+
+	// other people's webhooks are NotFound
+	if _, err := h.DeleteWebhook(bctx, &pb.DeleteWebhookRequest{Id: reg.Webhook.Id}); apperr.ReasonOf(err) != apperr.WebhookNotFound {
+		t.Errorf("deleting alice's as bob: %v", err)
+	}
+	if _, err := h.SetWebhookEnabled(bctx, &pb.SetWebhookEnabledRequest{Id: reg.Webhook.Id, Enabled: true}); apperr.ReasonOf(err) != apperr.WebhookNotFound {
+		t.Errorf("enabling alice's as bob: %v", err)
+	}
+	if _, err := h.DeleteWebhook(actx, &pb.DeleteWebhookRequest{Id: reg.Webhook.Id}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if list, _ := h.ListWebhooks(actx, &pb.ListWebhooksRequest{}); len(list.Webhooks) != 0 {
+		t.Errorf("still listed: %v", list.Webhooks)
+	}
+
+	for i := 1; i < 10; i++ {
+		if _, err := h.RegisterWebhook(bctx, &pb.RegisterWebhookRequest{Url: downSrv.URL}); err != nil {
+			t.Fatalf("webhook %d: %v", i+1, err)
+		}
+	}
+	if _, err := h.RegisterWebhook(bctx, &pb.RegisterWebhookRequest{Url: downSrv.URL}); apperr.ReasonOf(err) != apperr.WebhookLimit {
+		t.Errorf("11th webhook: %v", err)
+	}
+}
+
+// a client retrying the same create, all copies in flight at once: every
+// one gets OK and the same appointment, and only one row is written
+func TestConcurrentIdempotentCreate(t *testing.T) { eachStore(t, testConcurrentIdempotentCreate) }
+
+func testConcurrentIdempotentCreate(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(910 * time.Hour)
+	end := start.Add(time.Hour)
+	key := uuid.New().String()
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan string, n)
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+				Title:          "retried",
+				StartTime:      timestamppb.New(start),
+				EndTime:        timestamppb.New(end),
+				IdempotencyKey: key,
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- resp.Appointment.Id
+		}()
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	ids := map[string]bool{}
+	for id := range results {
+		ids[id] = true
+	}
+	if len(ids) != 1 {
+		t.Fatalf("expected one appointment, got %v", ids)
+	}
+
+	list, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start.Add(-time.Hour)),
+		RangeEnd:   timestamppb.New(end.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list.Appointments) != 1 {
+		t.Errorf("expected 1 stored appointment, got %d", len(list.Appointments))
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) { eachStore(t, testIdempotencyKey) }
+
+func testIdempotencyKey(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(920 * time.Hour)
+	req := &pb.CreateAppointmentRequest{
+		Title:          "once",
+		StartTime:      timestamppb.New(start),
+		EndTime:        timestamppb.New(start.Add(time.Hour)),
+		IdempotencyKey: "k1",
+	}
+	first, err := h.CreateAppointment(ctx, req)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	again, err := h.CreateAppointment(ctx, req)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if again.Appointment.Id != first.Appointment.Id {
+		t.Errorf("retry created %s, want %s", again.Appointment.Id, first.Appointment.Id)
+	}
+
+	// the same key on a different request is refused, not answered with
+	// the first appointment
+	changed := proto.Clone(req).(*pb.CreateAppointmentRequest)
+	changed.Title = "twice"
+	_, err = h.CreateAppointment(ctx, changed)
+	if status.Code(err) != codes.FailedPrecondition || apperr.ReasonOf(err) != apperr.ApptKeyReused {
+		t.Errorf("reused key: expected APPT_KEY_REUSED, got %v", err)
+	}
+
+	// a different key is a different booking, and the slot is taken
+	req.IdempotencyKey = "k2"
+	_, err = h.CreateAppointment(ctx, req)
+	if s, _ := status.FromError(err); s.Code() != codes.AlreadyExists {
+		t.Errorf("new key, same slot: expected AlreadyExists, got %v", err)
+	}
+
+	// keys are per user
+	other, _ := registerUser(t, h)
+	req.IdempotencyKey = "k1"
+	resp, err := h.CreateAppointment(authedCtx(other, secret), req)
+	if err != nil {
+		t.Fatalf("other user: %v", err)
+	}
+	if resp.Appointment.Id == first.Appointment.Id || resp.Appointment.UserId != other {
+		t.Errorf("other user got someone else's appointment: %v", resp.Appointment)
+	}
+
+	req.IdempotencyKey = strings.Repeat("k", 101)
+	_, err = h.CreateAppointment(ctx, req)
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("long key: expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestRescheduleSuggestions(t *testing.T) { eachStore(t, testRescheduleSuggestions) }
+
+func testRescheduleSuggestions(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	day := time.Now().Add(930 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	book := func(title string, start, end time.Time) *pb.Appointment {
+		t.Helper()
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end),
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return resp.Appointment
+	}
+	book("a", at(10, 0), at(11, 0))
+	book("b", at(11, 30), at(12, 30))
+	moving := book("c", at(14, 0), at(15, 0))
+
+	req := &pb.UpdateAppointmentRequest{
+		Id: moving.Id, Title: "c",
+		StartTime: timestamppb.New(at(10, 30)), EndTime: timestamppb.New(at(11, 30)),
+	}
+	_, err := h.UpdateAppointment(ctx, req)
+	st, _ := status.FromError(err)
+	if st.Code() != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists, got %v", err)
+	}
+	var sugg *pb.RescheduleSuggestions
+	for _, d := range st.Details() {
+		if s, ok := d.(*pb.RescheduleSuggestions); ok {
+			sugg = s
+		}
+	}
+	if sugg == nil {
+		t.Fatal("no suggestions attached")
+	}
+	// 10:30 is inside "a", so nothing to shorten; 11:00-12:00 runs into "b";
+	// the appointment being moved doesn't count as busy
+	var got []string
+	for _, a := range sugg.Alternatives {
+		got = append(got, fmt.Sprintf("%s %s-%s", a.Kind,
+			a.StartTime.AsTime().Sub(day), a.EndTime.AsTime().Sub(day)))
+	}
+	want := []string{"later_same_day 12h30m0s-13h30m0s", "next_day 34h30m0s-35h30m0s"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("suggestions %v, want %v", got, want)
+	}
+
+	// the bridge passes them on in grpc-status-details-bin
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	msg, _ := proto.Marshal(req)
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	hreq := httptest.NewRequest("POST", "/appointment.v1.ScheduleService/UpdateAppointment", bytes.NewReader(body))
+	hreq.Header.Set("Content-Type", "application/grpc-web+proto")
+	hreq.Header.Set("Authorization", "Bearer "+tok)
+	rec := httptest.NewRecorder()
+	bridge.Handler().ServeHTTP(rec, hreq)
+	_, bin, ok := strings.Cut(rec.Body.String(), "grpc-status-details-bin:")
+	if !ok {
+		t.Fatalf("no details in bridge trailer: %q", rec.Body.String())
+	}
+	bin, _, _ = strings.Cut(bin, "\r\n")
+	raw, err := base64.RawStdEncoding.DecodeString(bin)
+	if err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	var sp spb.Status
+	if err := proto.Unmarshal(raw, &sp); err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	var kinds []string
+	for _, d := range sp.Details {
+		kinds = append(kinds, string(d.MessageName().Name()))
+	}
+	if strings.Join(kinds, ",") != "ErrorInfo,ConflictInfo,RescheduleSuggestions" {
+		t.Errorf("bridge details %v", kinds)
+	}
+}
+
+func TestSuggestSlots(t *testing.T) { eachStore(t, testSuggestSlots) }
+
+func testSuggestSlots(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	day := time.Now().Add(1010 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	book := func(title string, start, end time.Time) {
+		t.Helper()
+		if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end),
+		}); err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+	}
+	// 09:00-17:00 is packed but for 13:30-14:00
+	book("standup", at(9, 0), at(10, 0))
+	book("review", at(10, 0), at(12, 0))
+	book("lunch", at(12, 0), at(13, 30))
+	book("workshop", at(14, 0), at(17, 0))
+
+	suggest := func(req *pb.SuggestSlotsRequest) []string {
+		t.Helper()
+		resp, err := h.SuggestSlots(ctx, req)
+		if err != nil {
+			t.Fatalf("suggest: %v", err)
+		}
+		var got []string
+		for _, s := range resp.Slots {
+			got = append(got, fmt.Sprintf("%s %s-%s", s.Kind, s.StartTime.AsTime().Sub(day), s.EndTime.AsTime().Sub(day)))
+		}
+		return got
+	}
+	nineToFive := &pb.WorkingHours{Start: "09:00", End: "17:00"}
+	got := suggest(&pb.SuggestSlotsRequest{
+		DurationMinutes: 30, EarliestStart: timestamppb.New(at(9, 0)), LatestEnd: timestamppb.New(at(17, 0)),
+		WorkingHours: nineToFive,
+	})
+	if want := "next_free 13h30m0s-14h0m0s"; strings.Join(got, ", ") != want {
+		t.Errorf("packed day: %v, want %s", got, want)
+	}
+	// an hour doesn't fit until the next morning
+	got = suggest(&pb.SuggestSlotsRequest{
+		DurationMinutes: 60, EarliestStart: timestamppb.New(at(9, 0)), WorkingHours: nineToFive, MaxResults: 2,
+	})
+	if want := "next_free 33h0m0s-34h0m0s, next_free 34h0m0s-35h0m0s"; strings.Join(got, ", ") != want {
+		t.Errorf("next day: %v, want %s", got, want)
+	}
+
+	// without earliest_start the first slot is a little after now
+	resp, err := h.SuggestSlots(ctx, &pb.SuggestSlotsRequest{DurationMinutes: 30, MaxResults: 1})
+	if err != nil || len(resp.Slots) != 1 {
+		t.Fatalf("now: %v %v", resp, err)
+	}
+	if first := resp.Slots[0].StartTime.AsTime(); first.Before(time.Now().Add(slots.Lead-time.Minute)) || first.After(time.Now().Add(slots.Lead+5*time.Minute)) {
+		t.Errorf("now: first slot at %v", first)
+	}
+
+	// a conflicting create carries the next free slot
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "clash", StartTime: timestamppb.New(at(12, 30)), EndTime: timestamppb.New(at(13, 0)),
+	})
+	st, _ := status.FromError(err)
+	var sugg *pb.RescheduleSuggestions
+	for _, d := range st.Details() {
+		if s, ok := d.(*pb.RescheduleSuggestions); ok {
+			sugg = s
+		}
+	}
+	if st.Code() != codes.AlreadyExists || sugg == nil || len(sugg.Alternatives) != 1 {
+		t.Fatalf("clash: %v %v", err, sugg)
+	}
+	if a := sugg.Alternatives[0]; a.Kind != slots.NextFree || !a.StartTime.AsTime().Equal(at(13, 30)) {
+		t.Errorf("clash suggestion %v", a)
+	}
+}
+
+func TestSuggestSlotsValidation(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("secret"))
+	ctx := authedCtx(uuid.NewString(), "secret")
+	later := time.Now().Add(48 * time.Hour)
+	for name, tc := range map[string]struct {
+		req  *pb.SuggestSlotsRequest
+		want string
+	}{
+		"no duration": {&pb.SuggestSlotsRequest{}, "duration_minutes: required\n"},
+		"too long":    {&pb.SuggestSlotsRequest{DurationMinutes: 24*60 + 1}, "duration_minutes: at most a day\n"},
+		"range": {&pb.SuggestSlotsRequest{DurationMinutes: 30, EarliestStart: timestamppb.New(later), LatestEnd: timestamppb.New(later.Add(-time.Hour))},
+			"latest_end: must be after earliest_start\n"},
+		"wide range": {&pb.SuggestSlotsRequest{DurationMinutes: 30, EarliestStart: timestamppb.New(later), LatestEnd: timestamppb.New(later.Add(40 * 24 * time.Hour))},
+			"latest_end: at most 31 days after earliest_start\n"},
+		"hours": {&pb.SuggestSlotsRequest{DurationMinutes: 30, WorkingHours: &pb.WorkingHours{Start: "9am", End: "08:00", TimeZone: "Mars/Olympus"}},
+			"working_hours.start: want \"HH:MM\"\nworking_hours.time_zone: not an IANA time zone name\n"},
+		"backwards hours": {&pb.SuggestSlotsRequest{DurationMinutes: 30, WorkingHours: &pb.WorkingHours{Start: "17:00", End: "09:00"}},
+			"working_hours.end: must be after working_hours.start\n"},
+		"longer than the day": {&pb.SuggestSlotsRequest{DurationMinutes: 120, WorkingHours: &pb.WorkingHours{Start: "09:00", End: "10:00"}},
+			"duration_minutes: longer than working_hours\n"},
+		"results": {&pb.SuggestSlotsRequest{DurationMinutes: 30, MaxResults: 21}, "max_results: between 0 and 20\n"},
+	} {
+		_, err := h.SuggestSlots(ctx, tc.req)
+		if got := violationsOf(err); got != tc.want {
+			t.Errorf("%s: %q", name, got)
+		}
+	}
+}
+
+func TestCheckAvailability(t *testing.T) { eachStore(t, testCheckAvailability) }
+
+func testCheckAvailability(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	three := time.Now().Add(940 * time.Hour).Truncate(time.Hour)
+	cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "standup", StartTime: timestamppb.New(three), EndTime: timestamppb.New(three.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	check := func(start, end time.Time, exclude string) *pb.CheckAvailabilityResponse {
+		t.Helper()
+		r, err := h.CheckAvailability(ctx, &pb.CheckAvailabilityRequest{
+			StartTime: timestamppb.New(start), EndTime: timestamppb.New(end), ExcludeAppointmentId: exclude,
+		})
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		return r
+	}
+
+	r := check(three.Add(30*time.Minute), three.Add(90*time.Minute), "")
+	if r.Available || len(r.Conflicts) != 1 || r.Conflicts[0].Id != cr.Appointment.Id || r.Conflicts[0].Title != "standup" {
+		t.Errorf("overlapping: %v", r)
+	}
+	if r := check(three.Add(time.Hour), three.Add(2*time.Hour), ""); !r.Available || len(r.Conflicts) != 0 {
+		t.Errorf("back to back should be free: %v", r)
+	}
+	if r := check(three.Add(30*time.Minute), three.Add(90*time.Minute), cr.Appointment.Id); !r.Available {
+		t.Errorf("moving the appointment itself should be free: %v", r)
+	}
+
+	// the precheck and the insert agree
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "clash", StartTime: timestamppb.New(three.Add(30 * time.Minute)), EndTime: timestamppb.New(three.Add(90 * time.Minute)),
+	}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("create where unavailable: want AlreadyExists, got %v", err)
+	}
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "next", StartTime: timestamppb.New(three.Add(time.Hour)), EndTime: timestamppb.New(three.Add(2 * time.Hour)),
+	}); err != nil {
+		t.Errorf("create where available: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		req  *pb.CheckAvailabilityRequest
+		want string
+	}{
+		"missing": {&pb.CheckAvailabilityRequest{}, "start_time: required\nend_time: required\n"},
+		"backwards": {&pb.CheckAvailabilityRequest{StartTime: timestamppb.New(three), EndTime: timestamppb.New(three)},
+			"end_time: must be after start_time\n"},
+		"exclude": {&pb.CheckAvailabilityRequest{StartTime: timestamppb.New(three), EndTime: timestamppb.New(three.Add(time.Hour)), ExcludeAppointmentId: "x"},
+			"exclude_appointment_id: must be a UUID\n"},
+	} {
+		_, err := h.CheckAvailability(ctx, tc.req)
+		if got := violationsOf(err); got != tc.want {
+			t.Errorf("%s: %q", name, got)
+		}
+	}
+}
+
+func TestAvailability(t *testing.T) { eachStore(t, testAvailability) }
+
+func testAvailability(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// nothing set: any time, unenforced
+	got, err := h.GetAvailability(ctx, &pb.GetAvailabilityRequest{})
+	if err != nil || len(got.Availability.Windows) != 0 || got.Availability.TimeZone != "UTC" {
+		t.Fatalf("default: %v %v", got, err)
+	}
+
+	var windows []*pb.AvailabilityWindow
+	for _, day := range []string{"monday", "tuesday", "wednesday", "thursday", "Friday"} {
+		windows = append(windows, &pb.AvailabilityWindow{Weekday: day, Start: "09:00", End: "17:00"})
+	}
+	set, err := h.SetAvailability(ctx, &pb.SetAvailabilityRequest{Availability: &pb.Availability{
+		Windows: windows, TimeZone: "Africa/Lagos", Enforce: true,
+	}})
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if w := set.Availability.Windows[4]; w.Weekday != "friday" || w.Start != "09:00" || set.Availability.UpdatedAt == nil {
+		t.Errorf("set: %v", set.Availability)
+	}
+
+	// a Monday well ahead, on Lagos time
+	monday := time.Now().Add(1100 * time.Hour).In(lagos)
+	monday = time.Date(monday.Year(), monday.Month(), monday.Day()+int(8-monday.Weekday())%7, 0, 0, 0, 0, lagos)
+	at := func(day, h, m int) *timestamppb.Timestamp {
+		return timestamppb.New(time.Date(monday.Year(), monday.Month(), monday.Day()+day, h, m, 0, 0, lagos))
+	}
+	create := func(title string, start, end *timestamppb.Timestamp) (*pb.Appointment, error) {
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: title, StartTime: start, EndTime: end})
+		return resp.GetAppointment(), err
+	}
+	if _, err := create("saturday", at(5, 10, 0), at(5, 11, 0)); apperr.ReasonOf(err) != apperr.ApptUnavailable ||
+		status.Code(err) != codes.FailedPrecondition || !strings.Contains(fmt.Sprint(err), "no bookings on saturday (Africa/Lagos)") {
+		t.Errorf("saturday: %v", err)
+	}
+	if _, err := create("late", at(0, 16, 30), at(0, 17, 30)); !strings.Contains(fmt.Sprint(err), "monday 09:00-17:00 (Africa/Lagos)") {
+		t.Errorf("past closing: %v", err)
+	}
+	early, err := create("early", at(0, 9, 0), at(0, 10, 0))
+	if err != nil {
+		t.Fatalf("in hours: %v", err)
+	}
+
+	// narrower hours leave what's booked alone, but it can't move outside them
+	for i := range windows {
+		windows[i].Start = "13:00"
+	}
+	if _, err := h.SetAvailability(ctx, &pb.SetAvailabilityRequest{Availability: &pb.Availability{
+		Windows: windows, TimeZone: "Africa/Lagos", Enforce: true,
+	}}); err != nil {
+		t.Fatalf("narrow: %v", err)
+	}
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: early.Id, Title: "renamed", StartTime: early.StartTime, EndTime: early.EndTime,
+	}); err != nil {
+		t.Errorf("keeping the times: %v", err)
+	}
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: early.Id, Title: "renamed", StartTime: at(0, 11, 0), EndTime: at(0, 12, 0),
+	}); apperr.ReasonOf(err) != apperr.ApptUnavailable {
+		t.Errorf("moving out of hours: %v", err)
+	}
+
+	// suggestions only come inside the windows
+	sugg, err := h.SuggestSlots(ctx, &pb.SuggestSlotsRequest{DurationMinutes: 60, EarliestStart: at(5, 0, 0), MaxResults: 1})
+	if err != nil || len(sugg.Slots) != 1 || !sugg.Slots[0].StartTime.AsTime().Equal(at(7, 13, 0).AsTime()) {
+		t.Errorf("suggest: %v %v", sugg, err)
+	}
+
+	// unenforced, or cleared, anything goes again
+	if _, err := h.SetAvailability(ctx, &pb.SetAvailabilityRequest{Availability: &pb.Availability{Windows: windows}}); err != nil {
+		t.Fatalf("unenforced: %v", err)
+	}
+	if _, err := create("saturday", at(5, 10, 0), at(5, 11, 0)); err != nil {
+		t.Errorf("unenforced: %v", err)
+	}
+	if _, err := h.SetAvailability(ctx, &pb.SetAvailabilityRequest{Availability: &pb.Availability{Enforce: true}}); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if _, err := create("sunday", at(6, 3, 0), at(6, 4, 0)); err != nil {
+		t.Errorf("no windows: %v", err)
+	}
+}
+
+func TestAvailabilityValidation(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("secret"))
+	ctx := authedCtx(uuid.NewString(), "secret")
+	_, err := h.SetAvailability(ctx, &pb.SetAvailabilityRequest{Availability: &pb.Availability{
+		TimeZone: "Local",
+		Windows: []*pb.AvailabilityWindow{
+			{Weekday: "monday", Start: "22:00", End: "02:00"},
+			{Weekday: "mon", Start: "9:00", End: "25:00"},
+		},
+	}})
+	want := "availability.time_zone: not an IANA time zone name\n" +
+		"availability.windows[1].weekday: want a day name, e.g. \"monday\"\n" +
+		"availability.windows[1].end: want \"HH:MM\"\n"
+	if got := violationsOf(err); got != want {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestBufferMinutes(t *testing.T) { eachStore(t, testBufferMinutes) }
+
+func testBufferMinutes(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	got, err := h.GetPreferences(ctx, &pb.GetPreferencesRequest{})
+	if err != nil || got.Preferences.BufferMinutes != 0 {
+		t.Fatalf("default: %v %v", got, err)
+	}
+	if _, err := h.UpdatePreferences(ctx, &pb.UpdatePreferencesRequest{Preferences: &pb.Preferences{BufferMinutes: 241}}); violationsOf(err) != "preferences.buffer_minutes: between 0 and 240\n" {
+		t.Errorf("too long: %v", err)
+	}
+	set, err := h.UpdatePreferences(ctx, &pb.UpdatePreferencesRequest{Preferences: &pb.Preferences{BufferMinutes: 10}})
+	if err != nil || set.Preferences.BufferMinutes != 10 || set.Preferences.UpdatedAt == nil {
+		t.Fatalf("set: %v %v", set, err)
+	}
+
+	day := time.Now().Add(1300 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h, m int) *timestamppb.Timestamp {
+		return timestamppb.New(day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute))
+	}
+	create := func(title string, start, end *timestamppb.Timestamp) (*pb.Appointment, error) {
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: title, StartTime: start, EndTime: end})
+		return resp.GetAppointment(), err
+	}
+	ten, err := create("ten", at(10, 0), at(11, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		start, end *timestamppb.Timestamp
+	}{
+		{"back to back after", at(11, 0), at(12, 0)},
+		{"5 minutes after", at(11, 5), at(12, 0)},
+		{"back to back before", at(9, 0), at(10, 0)},
+		{"5 minutes before", at(9, 0), at(9, 55)},
+	} {
+		_, err := create(tc.name, tc.start, tc.end)
+		if apperr.ReasonOf(err) != apperr.ApptBuffer || status.Code(err) != codes.AlreadyExists ||
+			!strings.Contains(fmt.Sprint(err), "within your 10-minute buffer") {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if ci := conflictInfo(err); ci == nil || len(ci.Appointments) != 1 || ci.Appointments[0].Id != ten.Id {
+			t.Errorf("%s: conflict info %v", tc.name, ci)
+		}
+	}
+	// an outright overlap is still a conflict, not a buffer problem
+	if _, err := create("overlap", at(10, 30), at(11, 30)); apperr.ReasonOf(err) != apperr.ApptConflict {
+		t.Errorf("overlap: %v", err)
+	}
+	eleven, err := create("exactly 10 after", at(11, 10), at(12, 0))
+	if err != nil {
+		t.Fatalf("exactly the buffer after: %v", err)
+	}
+	if _, err := create("exactly 10 before", at(9, 0), at(9, 50)); err != nil {
+		t.Errorf("exactly the buffer before: %v", err)
+	}
+
+	// moves honor it, edits keeping the times don't care
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: eleven.Id, Title: "moved", StartTime: at(11, 5), EndTime: at(12, 0),
+	}); apperr.ReasonOf(err) != apperr.ApptBuffer {
+		t.Errorf("move into the buffer: %v", err)
+	}
+	if _, err := h.UpdatePreferences(ctx, &pb.UpdatePreferencesRequest{Preferences: &pb.Preferences{BufferMinutes: 30}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: eleven.Id, Title: "renamed", StartTime: eleven.StartTime, EndTime: eleven.EndTime,
+	}); err != nil {
+		t.Errorf("keeping the times under a wider buffer: %v", err)
+	}
+
+	// batches check it against what's booked and between entries
+	batch, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+		{Title: "near nine", StartTime: at(8, 0), EndTime: at(8, 45)},
+		{Title: "free", StartTime: at(14, 0), EndTime: at(15, 0)},
+		{Title: "near free", StartTime: at(15, 20), EndTime: at(16, 0)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[int32]string{}
+	for _, e := range batch.Errors {
+		reasons[e.Index] = e.Reason
+	}
+	if len(reasons) != 2 || reasons[0] != string(apperr.ApptBuffer) || reasons[2] != string(apperr.ApptBuffer) {
+		t.Errorf("batch errors %v", batch.Errors)
+	}
+
+	// suggestions leave the gap too
+	sugg, err := h.SuggestSlots(ctx, &pb.SuggestSlotsRequest{DurationMinutes: 30, EarliestStart: at(12, 0), MaxResults: 1})
+	if err != nil || len(sugg.Slots) != 1 || !sugg.Slots[0].StartTime.AsTime().Equal(at(12, 30).AsTime()) {
+		t.Errorf("suggest: %v %v", sugg, err)
+	}
+
+	// back to 0, back to back is fine again
+	if _, err := h.UpdatePreferences(ctx, &pb.UpdatePreferencesRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := create("back to back", at(12, 0), at(13, 0)); err != nil {
+		t.Errorf("no buffer: %v", err)
+	}
+}
+
+// conflictInfo is the ConflictInfo detail on err, nil if there's none.
+func conflictInfo(err error) *pb.ConflictInfo {
+	st, _ := status.FromError(err)
+	for _, d := range st.Details() {
+		if ci, ok := d.(*pb.ConflictInfo); ok {
+			return ci
+		}
+	}
+	return nil
+}
+
+func TestConflictInfo(t *testing.T) { eachStore(t, testConflictInfo) }
+
+func testConflictInfo(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	other, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	day := time.Now().Add(950 * time.Hour).UTC().Truncate(24 * time.Hour)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	book := func(ctx context.Context, title string, start, end time.Time) *pb.Appointment {
+		t.Helper()
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(start), EndTime: timestamppb.New(end),
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", title, err)
+		}
+		return resp.Appointment
+	}
+	first := book(ctx, "standup", at(10, 0), at(10, 30))
+	second := book(ctx, "1:1", at(10, 30), at(11, 0))
+	// someone else's meeting in the same slot is never named
+	book(authedCtx(other, secret), "their secret meeting", at(10, 0), at(11, 0))
+
+	describe := func(ci *pb.ConflictInfo) string {
+		var got []string
+		for _, a := range ci.GetAppointments() {
+			got = append(got, fmt.Sprintf("%s %s %s-%s", a.Id, a.Title, a.StartTime.AsTime().Sub(day), a.EndTime.AsTime().Sub(day)))
+		}
+		return strings.Join(got, ", ")
+	}
+	want := first.Id + " standup 10h0m0s-10h30m0s, " + second.Id + " 1:1 10h30m0s-11h0m0s"
+
+	req := &pb.CreateAppointmentRequest{Title: "clash", StartTime: timestamppb.New(at(10, 15)), EndTime: timestamppb.New(at(10, 45))}
+	_, err := h.CreateAppointment(ctx, req)
+	if apperr.ReasonOf(err) != apperr.ApptConflict {
+		t.Fatalf("create: %v", err)
+	}
+	if got := describe(conflictInfo(err)); got != want {
+		t.Errorf("create conflicts %q, want %q", got, want)
+	}
+
+	// the same through the idempotent path
+	req.IdempotencyKey = uuid.New().String()
+	if _, err := h.CreateAppointment(ctx, req); describe(conflictInfo(err)) != want {
+		t.Errorf("create with key: %v", err)
+	}
+
+	// on update the appointment being moved isn't in its own way
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: second.Id, Title: "1:1", StartTime: timestamppb.New(at(10, 15)), EndTime: timestamppb.New(at(10, 45)),
+	})
+	if got := describe(conflictInfo(err)); got != first.Id+" standup 10h0m0s-10h30m0s" {
+		t.Errorf("update conflicts %q", got)
+	}
+
+	// and the bridge passes it on
+	bridge, err := gweb.New("", h, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	tok, _ := auth.MakeToken(uid, auth.RoleUser, secret)
+	req.IdempotencyKey = ""
+	msg, _ := proto.Marshal(req)
+	body := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+	copy(body[5:], msg)
+	hreq := httptest.NewRequest("POST", "/appointment.v1.ScheduleService/CreateAppointment", bytes.NewReader(body))
+	hreq.Header.Set("Content-Type", "application/grpc-web+proto")
+	hreq.Header.Set("Authorization", "Bearer "+tok)
+	rec := httptest.NewRecorder()
+	bridge.Handler().ServeHTTP(rec, hreq)
+	_, bin, ok := strings.Cut(rec.Body.String(), "grpc-status-details-bin:")
+	if !ok {
+		t.Fatalf("no details in bridge trailer: %q", rec.Body.String())
+	}
+	bin, _, _ = strings.Cut(bin, "\r\n")
+	raw, err := base64.RawStdEncoding.DecodeString(bin)
+	if err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	var sp spb.Status
+	if err := proto.Unmarshal(raw, &sp); err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	if got := describe(conflictInfo(status.FromProto(&sp).Err())); got != want {
+		t.Errorf("bridge conflicts %q, want %q", got, want)
+	}
+}
+
+// only a taken slot is AlreadyExists; any other store failure is Internal
+func TestStoreErrorsAreInternal(t *testing.T) {
+	// nothing listens there, so every query fails to connect
+	pool, err := pgxpool.New(context.Background(), "postgres://x:x@127.0.0.1:1/none?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("pool: %v", err)
+	}
+	defer pool.Close()
+	h := handler.New(store.New(pool), auth.SingleKey("secret"))
+	ctx := authedCtx(uuid.New().String(), "secret")
+	start := time.Now().Add(time.Hour)
+	times := func() (*timestamppb.Timestamp, *timestamppb.Timestamp) {
+		return timestamppb.New(start), timestamppb.New(start.Add(time.Hour))
+	}
+
+	s, e := times()
+	_, err = h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "x", StartTime: s, EndTime: e})
+	if c := status.Code(err); c != codes.Internal {
+		t.Errorf("create on a dead pool: got %v, want Internal", c)
+	}
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{Id: uuid.New().String(), Title: "x", StartTime: s, EndTime: e})
+	if c := status.Code(err); c != codes.Internal {
+		t.Errorf("update on a dead pool: got %v, want Internal", c)
+	}
+	_, err = h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{
+		Appointments: []*pb.CreateAppointmentRequest{{Title: "x", StartTime: s, EndTime: e}},
+	})
+	if c := status.Code(err); c != codes.Internal {
+		t.Errorf("batch on a dead pool: got %v, want Internal", c)
+	}
+}
+
+// a call that never went through Auth (a method wrongly in its open list)
+// is refused before the store is touched, not a panic
+func TestMissingUserIsUnauthenticated(t *testing.T) {
+	h := handler.New(store.New(nil), auth.SingleKey("secret"))
+	start := timestamppb.New(time.Now().Add(time.Hour))
+	end := timestamppb.New(time.Now().Add(2 * time.Hour))
+	calls := map[string]func(context.Context) error{
+		"CreateAppointment": func(ctx context.Context) error {
+			_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "x", StartTime: start, EndTime: end})
+			return err
+		},
+		"ListAppointments": func(ctx context.Context) error {
+			_, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
+			return err
+		},
+		"GetAppointment": func(ctx context.Context) error {
+			_, err := h.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: uuid.NewString()})
+			return err
+		},
+		"DeleteAppointment": func(ctx context.Context) error {
+			_, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: uuid.NewString()})
+			return err
+		},
+		"GetProfile": func(ctx context.Context) error {
+			_, err := h.GetProfile(ctx, &pb.GetProfileRequest{})
+			return err
+		},
+		"SearchAllAppointments": func(ctx context.Context) error {
+			_, err := h.SearchAllAppointments(ctx, &pb.SearchAllAppointmentsRequest{})
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call(context.Background())
+		if status.Code(err) != codes.Unauthenticated || apperr.ReasonOf(err) != apperr.AuthRequired {
+			t.Errorf("%s with no user: %v", name, err)
+		}
+		// something other than a string under the key is a bug on our side
+		err = call(context.WithValue(context.Background(), middleware.UserIDKey, 42))
+		if status.Code(err) != codes.Internal {
+			t.Errorf("%s with a non-string user: %v", name, err)
+		}
+	}
+}
+
+func TestForeignKeyViolationIsInternal(t *testing.T) { eachStore(t, testForeignKeyViolationIsInternal) }
+
+func testForeignKeyViolationIsInternal(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(940 * time.Hour)
+	req := &pb.CreateAppointmentRequest{
+		Title:       "ghost attendee",
+		StartTime:   timestamppb.New(start),
+		EndTime:     timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{uuid.New().String()}, // no such user
+	}
+	if _, err := h.CreateAppointment(ctx, req); status.Code(err) != codes.Internal {
+		t.Errorf("create: got %v, want Internal", err)
+	}
+
+	req.AttendeeIds = nil
+	resp, err := h.CreateAppointment(ctx, req)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+		Id: resp.Appointment.Id, Title: "moved",
+		StartTime: req.StartTime, EndTime: req.EndTime,
+		AttendeeIds: []string{uuid.New().String()},
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("update: got %v, want Internal", err)
+	}
+}
+
+// ----- IDOR / ownership -----
+
+func TestOwnershipGet(t *testing.T) { eachStore(t, testOwnershipGet) }
+
+func testOwnershipGet(t *testing.T, h *handler.Handler, secret string) {
+	uid1, _ := registerUser(t, h)
+	uid2, _ := registerUser(t, h)
+
+	ctx1 := authedCtx(uid1, secret)
+	ctx2 := authedCtx(uid2, secret)
+
+	appt := createAppointment(t, h, ctx1, 1000)
+
+	// user2 cant see user1's appointment
+	_, err := h.GetAppointment(ctx2, &pb.GetAppointmentRequest{Id: appt.Id})
+	s, _ := status.FromError(err)
+	if s.Code() != codes.NotFound {
+		t.Errorf("expected NotFound (IDOR), got %v", s.Code())
+	}
+}
+
+func TestOwnershipList(t *testing.T) { eachStore(t, testOwnershipList) }
+
+func testOwnershipList(t *testing.T, h *handler.Handler, secret string) {
+	uid1, _ := registerUser(t, h)
+	uid2, _ := registerUser(t, h)
+
+	ctx1 := authedCtx(uid1, secret)
+	ctx2 := authedCtx(uid2, secret)
+
+	createAppointment(t, h, ctx1, 1100)
+
+	// user2's list should not contain user1's appointments
+	lr, err := h.ListAppointments(ctx2, &pb.ListAppointmentsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	for _, a := range lr.Appointments {
+		if a.UserId == uid1 {
+			t.Error("user2 can see user1's appointment in list")
+		}
+	}
+}
+
+func TestDifferentUsersNoConflict(t *testing.T) { eachStore(t, testDifferentUsersNoConflict) }
+
+func testDifferentUsersNoConflict(t *testing.T, h *handler.Handler, secret string) {
+	uid1, _ := registerUser(t, h)
+	uid2, _ := registerUser(t, h)
+
+	ctx1 := authedCtx(uid1, secret)
+	ctx2 := authedCtx(uid2, secret)
+
+	start := time.Now().Add(1200 * time.Hour)
+
+	// same slot, different users — both should succeed
+	_, err1 := h.CreateAppointment(ctx1, &pb.CreateAppointmentRequest{
+		Title: "User1", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+	_, err2 := h.CreateAppointment(ctx2, &pb.CreateAppointmentRequest{
+		Title: "User2", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+	})
+
+	if err1 != nil {
+		t.Errorf("user1 should succeed: %v", err1)
+	}
+	if err2 != nil {
+		t.Errorf("user2 should succeed: %v", err2)
+	}
+}
+
+// ----- batch create -----
+
+func TestBatchCreateAppointments(t *testing.T) { eachStore(t, testBatchCreateAppointments) }
+
+func testBatchCreateAppointments(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(1300 * time.Hour)
+	var reqs []*pb.CreateAppointmentRequest
+	for i := 0; i < 3; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		reqs = append(reqs, &pb.CreateAppointmentRequest{
+			Title: fmt.Sprintf("class-%d", i), StartTime: timestamppb.New(s), EndTime: timestamppb.New(s.Add(time.Hour)),
+		})
+	}
+
+	br, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: reqs})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(br.Errors) != 0 {
+		t.Fatalf("unexpected item errors: %v", br.Errors)
+	}
+	if len(br.Appointments) != 3 {
+		t.Fatalf("expected 3 created, got %d", len(br.Appointments))
+	}
+
+	lr, _ := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(3 * time.Hour)),
+	})
+	if len(lr.Appointments) != 3 {
+		t.Errorf("expected 3 in list, got %d", len(lr.Appointments))
+	}
+}
+
+func TestBatchCreateConflictInMiddle(t *testing.T) { eachStore(t, testBatchCreateConflictInMiddle) }
+
+func testBatchCreateConflictInMiddle(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	start := time.Now().Add(1400 * time.Hour)
+	existing := start.Add(time.Hour)
+	_, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Existing", StartTime: timestamppb.New(existing), EndTime: timestamppb.New(existing.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// entry 1 hits the existing appointment, entry 3 overlaps entry 2
+	br, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+		{Title: "ok", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour))},
+		{Title: "clash", StartTime: timestamppb.New(existing), EndTime: timestamppb.New(existing.Add(time.Hour))},
+		{Title: "ok", StartTime: timestamppb.New(start.Add(3 * time.Hour)), EndTime: timestamppb.New(start.Add(4 * time.Hour))},
+		{Title: "self", StartTime: timestamppb.New(start.Add(3 * time.Hour)), EndTime: timestamppb.New(start.Add(5 * time.Hour))},
+	}})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(br.Appointments) != 0 {
+		t.Errorf("expected nothing created, got %d", len(br.Appointments))
+	}
+	if len(br.Errors) != 2 || br.Errors[0].Index != 1 || br.Errors[1].Index != 3 {
+		t.Fatalf("expected errors for entries 1 and 3, got %v", br.Errors)
+	}
+	if br.Errors[0].Code != codes.AlreadyExists.String() {
+		t.Errorf("expected AlreadyExists, got %s", br.Errors[0].Code)
+	}
+
+	// all-or-nothing: only the pre-existing appointment is there
+	lr, _ := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(5 * time.Hour)),
+	})
+	if len(lr.Appointments) != 1 {
+		t.Errorf("expected only the existing appointment, got %d", len(lr.Appointments))
+	}
+}
+
+func TestBatchCreateTooLarge(t *testing.T) { eachStore(t, testBatchCreateTooLarge) }
+
+func testBatchCreateTooLarge(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	reqs := make([]*pb.CreateAppointmentRequest, 51)
+	for i := range reqs {
+		reqs[i] = &pb.CreateAppointmentRequest{Title: "x"}
+	}
+	_, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: reqs})
+	s, _ := status.FromError(err)
+	if s.Code() != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", s.Code())
+	}
+}
+
+// ----- pagination / size cap -----
+
+func TestListPagination(t *testing.T) { eachStore(t, testListPagination) }
+
+func testListPagination(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	for i := 0; i < 5; i++ {
+		createAppointment(t, h, ctx, 1500+i)
+	}
+	start := time.Now().Add(1499 * time.Hour)
+	end := time.Now().Add(1510 * time.Hour)
+
+	seen := map[string]bool{}
+	tok := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not terminate")
+		}
+		lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{
+			RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(end), PageSize: 2, PageToken: tok,
+		})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(lr.Appointments) > 2 {
+			t.Fatalf("page too big: %d", len(lr.Appointments))
+		}
+		for _, a := range lr.Appointments {
+			if seen[a.Id] {
+				t.Fatalf("duplicate across pages: %s", a.Id)
+			}
+			seen[a.Id] = true
+		}
+		if lr.NextPageToken == "" {
+			break
+		}
+		tok = lr.NextPageToken
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected 5 appointments across pages, got %d", len(seen))
+	}
+
+	_, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{PageToken: "garbage!"})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for bad token, got %v", s.Code())
+	}
+}
+
+func TestListPaginationTies(t *testing.T) { eachStore(t, testListPaginationTies) }
+
+// appointments starting at the same instant page by id, so none is shown
+// twice or skipped
+func testListPaginationTies(t *testing.T, h *handler.Handler, secret string) {
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// only one can be confirmed at a time, so all but the last are cancelled
+	start := time.Now().Add(1520 * time.Hour).Truncate(time.Second)
+	want := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "tie", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		want[cr.Appointment.Id] = true
+		if i < 3 {
+			h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: cr.Appointment.Id})
+		}
+	}
+
+	req := &pb.ListAppointmentsRequest{
+		RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(time.Hour)),
+		Statuses: []string{"all"}, PageSize: 1, IncludeTotal: true,
+	}
+	seen := map[string]bool{}
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("paging did not terminate")
+		}
+		lr, err := h.ListAppointments(ctx, req)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if lr.TotalSize != 4 {
+			t.Errorf("page %d: total_size %d, want 4", pages, lr.TotalSize)
+		}
+		for _, a := range lr.Appointments {
+			if seen[a.Id] {
+				t.Fatalf("duplicate across pages: %s", a.Id)
+			}
+			seen[a.Id] = true
+		}
+		if lr.NextPageToken == "" {
+			break
+		}
+		req.PageToken = lr.NextPageToken
+	}
+	if len(seen) != len(want) {
+		t.Errorf("saw %d of %d appointments", len(seen), len(want))
+	}
+
+	// not counted unless asked
+	req.PageToken, req.IncludeTotal = "", false
+	if lr, err := h.ListAppointments(ctx, req); err != nil || lr.TotalSize != 0 {
+		t.Errorf("total without include_total: %v, %v", lr.GetTotalSize(), err)
+	}
+}
+
+func TestListResponseSizeCap(t *testing.T) {
+	h, st, secret := setup(t)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// ~4KB per appointment against a 10KB cap -> 2 fit per response
+	capped := handler.New(st, auth.SingleKey(secret), handler.WithMaxListBytes(10_000))
+	desc := strings.Repeat("x", 4000)
+	start := time.Now().Add(1600 * time.Hour)
+	for i := 0; i < 5; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		_, err := capped.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "big", Description: desc, StartTime: timestamppb.New(s), EndTime: timestamppb.New(s.Add(time.Hour)),
+		})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	req := &pb.ListAppointmentsRequest{RangeStart: timestamppb.New(start), RangeEnd: timestamppb.New(start.Add(5 * time.Hour))}
+	lr, err := capped.ListAppointments(ctx, req)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !lr.Truncated || lr.NextPageToken == "" {
+		t.Fatalf("expected truncated page with next token, got truncated=%v token=%q", lr.Truncated, lr.NextPageToken)
+	}
+	if n := len(lr.Appointments); n != 2 {
+		t.Errorf("expected 2 appointments under the cap, got %d", n)
+	}
+	if size := proto.Size(lr); size > 10_000+100 {
+		t.Errorf("response %d bytes exceeds cap", size)
+	}
+
+	// keep paging until done
+	total := len(lr.Appointments)
+	for lr.NextPageToken != "" {
+		req.PageToken = lr.NextPageToken
+		if lr, err = capped.ListAppointments(ctx, req); err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		total += len(lr.Appointments)
+	}
+	if total != 5 {
+		t.Errorf("expected 5 total, got %d", total)
+	}
+}
+
+// ----- service split -----
+
+// grpc server with the same interceptor chain as main.go
+func newServer(t *testing.T, h *handler.Handler, secret string) *grpc.Server {
+	t.Helper()
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(serverInterceptors(secret)...),
+		grpc.UnknownServiceHandler(middleware.UnknownMethod))
+	pb.RegisterAuthServiceServer(srv, h)
+	pb.RegisterScheduleServiceServer(srv, h)
+	pb.RegisterAdminServiceServer(srv, h)
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+// the chain newServer runs, for an in-process bridge to match it
+func serverInterceptors(secret string) []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		middleware.Deprecation(),
+		middleware.RateLimit(middleware.NewRateLimiter(100, 100)),
+		middleware.Auth(auth.SingleKey(secret), auth.Config{}),
+	}
+}
+
+// newServer over bufconn
+func startServer(t *testing.T, h *handler.Handler, secret string) *grpc.ClientConn {
+	t.Helper()
+	return dialBufconn(t, newServer(t, h, secret))
+}
+
+func dialBufconn(t *testing.T, srv *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// ----- transport parity -----
+
+// what a client can see of one call
+type parityResult struct {
+	code   codes.Code
+	reason apperr.Reason
+	fields string        // field violations, "field: description" per line
+	resp   proto.Message // nil unless OK
+}
+
+func violationsOf(err error) string {
+	var b strings.Builder
+	for _, v := range validate.Violations(err) {
+		fmt.Fprintf(&b, "%s: %s\n", v.Field, v.Description)
+	}
+	return b.String()
+}
+
+type transport struct {
+	name string
+	call func(t *testing.T, method, token string, req, resp proto.Message) parityResult
+}
+
+// the same handler behind the native grpc server (over bufconn), the
+// in-process grpc-web bridge, and a bridge forwarding to the server over
+// TCP.
+func parityTransports(t *testing.T, h *handler.Handler, secret string) []transport {
+	t.Helper()
+	srv := newServer(t, h, secret)
+	conn := dialBufconn(t, srv)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go srv.Serve(lis)
+	inProcess, err := gweb.New("", h, auth.SingleKey(secret), gweb.WithInterceptors(serverInterceptors(secret)...))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	forwarding, err := gweb.New(lis.Addr().String(), nil, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	t.Cleanup(func() { forwarding.Close() })
+
+	native := func(t *testing.T, method, token string, req, resp proto.Message) parityResult {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		if err := conn.Invoke(ctx, method, req, resp); err != nil {
+			return parityResult{code: status.Code(err), reason: apperr.ReasonOf(err), fields: violationsOf(err)}
+		}
+		return parityResult{code: codes.OK, resp: resp}
+	}
+	overBridge := func(web http.Handler) func(t *testing.T, method, token string, req, resp proto.Message) parityResult {
+		return func(t *testing.T, method, token string, req, resp proto.Message) parityResult {
+			msg, err := proto.Marshal(req)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			body := make([]byte, 5+len(msg))
+			binary.BigEndian.PutUint32(body[1:5], uint32(len(msg)))
+			copy(body[5:], msg)
+			r := httptest.NewRequest("POST", method, bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/grpc-web+proto")
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			web.ServeHTTP(rec, r)
+
+			code, _, data := splitReply(rec.Body.Bytes())
+			n, err := strconv.Atoi(code)
+			if err != nil {
+				t.Fatalf("%s: grpc-status %q", method, code)
+			}
+			if n != int(codes.OK) {
+				res := parityResult{code: codes.Code(n)}
+				if _, js, ok := strings.Cut(rec.Body.String(), "x-error-info:"); ok {
+					js, _, _ = strings.Cut(js, "\r\n")
+					var info struct{ Reason string }
+					json.Unmarshal([]byte(js), &info)
+					res.reason = apperr.Reason(info.Reason)
+				}
+				if _, b64, ok := strings.Cut(rec.Body.String(), "grpc-status-details-bin:"); ok {
+					b64, _, _ = strings.Cut(b64, "\r\n")
+					bin, err := base64.RawStdEncoding.DecodeString(b64)
+					var sp spb.Status
+					if err != nil || proto.Unmarshal(bin, &sp) != nil {
+						t.Fatalf("%s: grpc-status-details-bin %q", method, b64)
+					}
+					res.fields = violationsOf(status.FromProto(&sp).Err())
+				}
+				return res
+			}
+			if err := proto.Unmarshal(data, resp); err != nil {
+				t.Fatalf("%s: unmarshal: %v", method, err)
+			}
+			return parityResult{code: codes.OK, resp: resp}
+		}
+	}
+	return []transport{
+		{"grpc", native},
+		{"grpc-web", overBridge(inProcess.Handler())},
+		{"grpc-web forwarding", overBridge(forwarding.Handler())},
+	}
+}
+
+// parityStep is one logical request. It's built from the transport's own
+// state, so mutations can run once per transport without tripping over
+// each other.
+type parityStep struct {
+	name   string
+	method string
+	req    func(st *parityState) proto.Message
+	resp   func() proto.Message
+	after  func(st *parityState, resp proto.Message) // e.g. remember an id
+}
+
+type parityState struct {
+	email, token, apptID string
+	start                time.Time
+}
+
+// runParity runs steps over every transport and fails on any difference
+// in code, reason or (normalised) response.
+func runParity(t *testing.T, trs []transport, states []*parityState, steps []parityStep) {
+	t.Helper()
+	results := make([][]parityResult, len(trs))
+	for i, tr := range trs {
+		for _, s := range steps {
+			res := tr.call(t, s.method, states[i].token, s.req(states[i]), s.resp())
+			if res.code == codes.OK && s.after != nil {
+				s.after(states[i], res.resp)
+			}
+			results[i] = append(results[i], res)
+		}
+	}
+	for j, s := range steps {
+		want := results[0][j]
+		for i := 1; i < len(trs); i++ {
+			got := results[i][j]
+			if got.code != want.code || got.reason != want.reason {
+				t.Errorf("%s: %s gave %s/%s, %s gave %s/%s", s.name,
+					trs[0].name, want.code, want.reason, trs[i].name, got.code, got.reason)
+				continue
+			}
+			if got.fields != want.fields {
+				t.Errorf("%s: field violations differ\n%s:\n%s%s:\n%s", s.name,
+					trs[0].name, want.fields, trs[i].name, got.fields)
+			}
+			if want.code == codes.OK && !proto.Equal(normalize(want.resp), normalize(got.resp)) {
+				t.Errorf("%s: responses differ\n%s: %v\n%s: %v", s.name,
+					trs[0].name, want.resp, trs[i].name, got.resp)
+			}
+		}
+	}
+}
+
+// normalize blanks what legitimately differs between two users making the
+// same request: ids, tokens and server timestamps.
+func normalize(m proto.Message) proto.Message {
+	m = proto.Clone(m)
+	appt := func(a *pb.Appointment) {
+		if a != nil {
+			a.Id, a.UserId, a.CalendarId, a.CreatedAt, a.UpdatedAt = "", "", "", nil, nil
+		}
+	}
+	switch v := m.(type) {
+	case *pb.RegisterResponse:
+		v.UserId, v.Token = "", ""
+	case *pb.LoginResponse:
+		v.UserId, v.Token = "", ""
+	case *pb.CreateAppointmentResponse:
+		appt(v.Appointment)
+	case *pb.GetAppointmentResponse:
+		appt(v.Appointment)
+	case *pb.UpdateAppointmentResponse:
+		appt(v.Appointment)
+	case *pb.ListAppointmentsResponse:
+		for _, a := range v.Appointments {
+			appt(a)
+		}
+		v.NextPageToken = ""
+		if v.EffectiveRangeStart.AsTime().After(time.Now().Add(-time.Hour)) {
+			// defaults are relative to now, which moved between the calls
+			v.EffectiveRangeStart, v.EffectiveRangeEnd = nil, nil
+		}
+	}
+	return m
+}
+
+const (
+	authSvc  = "/appointment.v1.AuthService/"
+	schedSvc = "/appointment.v1.ScheduleService/"
+)
+
+func msg[T proto.Message](m T) func(*parityState) proto.Message {
+	return func(*parityState) proto.Message { return m }
+}
+
+func newResp[T any, P interface {
+	*T
+	proto.Message
+}]() func() proto.Message {
+	return func() proto.Message { return P(new(T)) }
+}
+
+// invalid requests are turned away before the store, so this runs without
+// a database
+func TestTransportParityInvalid(t *testing.T) {
+	const secret = "test-secret"
+	trs := parityTransports(t, handler.New(nil, auth.SingleKey(secret)), secret)
+	tok, _ := auth.MakeToken(uuid.NewString(), auth.RoleUser, secret)
+	var states []*parityState
+	for range trs {
+		states = append(states, &parityState{token: tok})
+	}
+
+	start := time.Now().Add(300 * time.Hour).Truncate(time.Second)
+	ts := timestamppb.New
+	steps := []parityStep{
+		{"login empty", authSvc + "Login", msg(&pb.LoginRequest{}), newResp[pb.LoginResponse](), nil},
+		{"login no password", authSvc + "Login", msg(&pb.LoginRequest{Email: "a@b.c"}), newResp[pb.LoginResponse](), nil},
+		{"deprecated login empty", schedSvc + "Login", msg(&pb.LoginRequest{}), newResp[pb.LoginResponse](), nil},
+		{"register empty", authSvc + "Register", msg(&pb.RegisterRequest{}), newResp[pb.RegisterResponse](), nil},
+		{"register short password", authSvc + "Register", msg(&pb.RegisterRequest{Email: "a@b.c", Password: "x", Name: "n"}), newResp[pb.RegisterResponse](), nil},
+		{"register all wrong", authSvc + "Register", msg(&pb.RegisterRequest{Email: "Ann <a@b.c>", Password: "x", Name: strings.Repeat("n", 101)}), newResp[pb.RegisterResponse](), nil},
+
+		{"create no title", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{StartTime: ts(start), EndTime: ts(start.Add(time.Hour))}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create no times", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x"}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create no end", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start)}), newResp[pb.CreateAppointmentResponse](), nil},
+		// present but zero is 1970, not missing
+		{"create epoch start", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: &timestamppb.Timestamp{}, EndTime: ts(start)}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create epoch end", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start), EndTime: &timestamppb.Timestamp{}}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create end before start", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start), EndTime: ts(start.Add(-time.Hour))}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create zero length", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start), EndTime: ts(start)}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create in the past", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start.Add(-1000 * time.Hour)), EndTime: ts(start.Add(-999 * time.Hour))}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create bad reminder", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start), EndTime: ts(start.Add(time.Hour)), ReminderMinutesBefore: -1}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create too long", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: strings.Repeat("t", 201), Description: strings.Repeat("d", 5001), StartTime: ts(start), EndTime: ts(start.Add(time.Hour))}), newResp[pb.CreateAppointmentResponse](), nil},
+		{"create bad calendar", schedSvc + "CreateAppointment", msg(&pb.CreateAppointmentRequest{Title: "x", StartTime: ts(start), EndTime: ts(start.Add(time.Hour)), CalendarId: "nope"}), newResp[pb.CreateAppointmentResponse](), nil},
+
+		{"get no id", schedSvc + "GetAppointment", msg(&pb.GetAppointmentRequest{}), newResp[pb.GetAppointmentResponse](), nil},
+
+		{"list negative page size", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{PageSize: -1}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list bad page token", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{PageToken: "!!"}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list inverted range", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{RangeStart: ts(start), RangeEnd: ts(start.Add(-time.Hour))}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list epoch range end", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{RangeEnd: &timestamppb.Timestamp{}}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list horizon and end", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{HorizonDays: 1, RangeEnd: ts(start)}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list negative horizon", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{HorizonDays: -1}), newResp[pb.ListAppointmentsResponse](), nil},
+		{"list unknown status", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{Statuses: []string{"cancelled", "done"}}), newResp[pb.ListAppointmentsResponse](), nil},
+
+		{"update no title", schedSvc + "UpdateAppointment", msg(&pb.UpdateAppointmentRequest{Id: uuid.NewString(), StartTime: ts(start), EndTime: ts(start.Add(time.Hour))}), newResp[pb.UpdateAppointmentResponse](), nil},
+		{"update no times", schedSvc + "UpdateAppointment", msg(&pb.UpdateAppointmentRequest{Id: uuid.NewString(), Title: "x"}), newResp[pb.UpdateAppointmentResponse](), nil},
+		{"update end before start", schedSvc + "UpdateAppointment", msg(&pb.UpdateAppointmentRequest{Id: uuid.NewString(), Title: "x", StartTime: ts(start), EndTime: ts(start.Add(-time.Hour))}), newResp[pb.UpdateAppointmentResponse](), nil},
+
+		{"delete no id", schedSvc + "DeleteAppointment", msg(&pb.DeleteAppointmentRequest{}), newResp[pb.DeleteAppointmentResponse](), nil},
+
+		{"change password empty", authSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{}), newResp[pb.ChangePasswordResponse](), nil},
+		{"change password short", authSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "x"}), newResp[pb.ChangePasswordResponse](), nil},
+		// not a ScheduleService method natively, so not over the bridge either
+		{"change password wrong service", schedSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{}), newResp[pb.ChangePasswordResponse](), nil},
+		{"unknown service", "/appointment.v1.Nope/GetAppointment", msg(&pb.GetAppointmentRequest{Id: "x"}), newResp[pb.GetAppointmentResponse](), nil},
+	}
+	runParity(t, trs, states, steps)
+
+	// and every authenticated method without a token or with a bad one
+	var authSteps []parityStep
+	for _, m := range []struct {
+		method string
+		req    proto.Message
+		resp   func() proto.Message
+	}{
+		{schedSvc + "CreateAppointment", &pb.CreateAppointmentRequest{}, newResp[pb.CreateAppointmentResponse]()},
+		{schedSvc + "GetAppointment", &pb.GetAppointmentRequest{}, newResp[pb.GetAppointmentResponse]()},
+		{schedSvc + "ListAppointments", &pb.ListAppointmentsRequest{}, newResp[pb.ListAppointmentsResponse]()},
+		{schedSvc + "UpdateAppointment", &pb.UpdateAppointmentRequest{}, newResp[pb.UpdateAppointmentResponse]()},
+		{schedSvc + "DeleteAppointment", &pb.DeleteAppointmentRequest{}, newResp[pb.DeleteAppointmentResponse]()},
+		{authSvc + "ChangePassword", &pb.ChangePasswordRequest{}, newResp[pb.ChangePasswordResponse]()},
+	} {
+		authSteps = append(authSteps, parityStep{name: m.method, method: m.method, req: msg(m.req), resp: m.resp})
+	}
+	runParity(t, trs, []*parityState{{}, {}, {}}, authSteps)
+	runParity(t, trs, []*parityState{{token: "garbage"}, {token: "garbage"}, {token: "garbage"}}, authSteps)
+}
+
+// the valid half: one user per transport doing the same things
+func TestTransportParity(t *testing.T) {
+	h, _, secret := setup(t)
+	trs := parityTransports(t, h, secret)
+	start := time.Now().Add(2200 * time.Hour).UTC().Truncate(time.Second)
+	var states []*parityState
+	for range trs {
+		states = append(states, &parityState{email: fmt.Sprintf("parity-%s@test.com", uuid.New().String()[:8]), start: start})
+	}
+	ts := timestamppb.New
+	remember := func(st *parityState, m proto.Message) { st.token = m.(interface{ GetToken() string }).GetToken() }
+
+	steps := []parityStep{
+		{"register", authSvc + "Register", func(st *parityState) proto.Message {
+			return &pb.RegisterRequest{Email: st.email, Password: "testpass123", Name: "Parity"}
+		}, newResp[pb.RegisterResponse](), remember},
+		{"register again", authSvc + "Register", func(st *parityState) proto.Message {
+			return &pb.RegisterRequest{Email: st.email, Password: "testpass123", Name: "Parity"}
+		}, newResp[pb.RegisterResponse](), nil},
+		{"login wrong password", authSvc + "Login", func(st *parityState) proto.Message {
+			return &pb.LoginRequest{Email: st.email, Password: "wrongpass1"}
+		}, newResp[pb.LoginResponse](), nil},
+		{"login", authSvc + "Login", func(st *parityState) proto.Message {
+			return &pb.LoginRequest{Email: st.email, Password: "testpass123"}
+		}, newResp[pb.LoginResponse](), remember},
+
+		{"create", schedSvc + "CreateAppointment", func(st *parityState) proto.Message {
+			return &pb.CreateAppointmentRequest{Title: "parity", Description: "d", Location: "l",
+				StartTime: ts(st.start), EndTime: ts(st.start.Add(time.Hour)), AttendeeIds: []string{}}
+		}, newResp[pb.CreateAppointmentResponse](), func(st *parityState, m proto.Message) {
+			st.apptID = m.(*pb.CreateAppointmentResponse).Appointment.Id
+		}},
+		{"create overlapping", schedSvc + "CreateAppointment", func(st *parityState) proto.Message {
+			return &pb.CreateAppointmentRequest{Title: "clash", StartTime: ts(st.start.Add(30 * time.Minute)), EndTime: ts(st.start.Add(2 * time.Hour))}
+		}, newResp[pb.CreateAppointmentResponse](), nil},
+		{"create adjacent", schedSvc + "CreateAppointment", func(st *parityState) proto.Message {
+			return &pb.CreateAppointmentRequest{Title: "next", StartTime: ts(st.start.Add(time.Hour)), EndTime: ts(st.start.Add(2 * time.Hour))}
+		}, newResp[pb.CreateAppointmentResponse](), nil},
+
+		{"get", schedSvc + "GetAppointment", func(st *parityState) proto.Message {
+			return &pb.GetAppointmentRequest{Id: st.apptID}
+		}, newResp[pb.GetAppointmentResponse](), nil},
+		{"get unknown", schedSvc + "GetAppointment", msg(&pb.GetAppointmentRequest{Id: uuid.NewString()}), newResp[pb.GetAppointmentResponse](), nil},
+		{"get malformed id", schedSvc + "GetAppointment", msg(&pb.GetAppointmentRequest{Id: "nope"}), newResp[pb.GetAppointmentResponse](), nil},
+
+		{"list", schedSvc + "ListAppointments", func(st *parityState) proto.Message {
+			return &pb.ListAppointmentsRequest{RangeStart: ts(st.start.Add(-time.Hour)), RangeEnd: ts(st.start.Add(24 * time.Hour))}
+		}, newResp[pb.ListAppointmentsResponse](), nil},
+		{"list paged", schedSvc + "ListAppointments", func(st *parityState) proto.Message {
+			return &pb.ListAppointmentsRequest{RangeStart: ts(st.start.Add(-time.Hour)), RangeEnd: ts(st.start.Add(24 * time.Hour)), PageSize: 1}
+		}, newResp[pb.ListAppointmentsResponse](), nil},
+		{"list default range", schedSvc + "ListAppointments", msg(&pb.ListAppointmentsRequest{}), newResp[pb.ListAppointmentsResponse](), nil},
+
+		{"update", schedSvc + "UpdateAppointment", func(st *parityState) proto.Message {
+			return &pb.UpdateAppointmentRequest{Id: st.apptID, Title: "moved", StartTime: ts(st.start.Add(3 * time.Hour)), EndTime: ts(st.start.Add(4 * time.Hour))}
+		}, newResp[pb.UpdateAppointmentResponse](), nil},
+		{"update onto taken slot", schedSvc + "UpdateAppointment", func(st *parityState) proto.Message {
+			return &pb.UpdateAppointmentRequest{Id: st.apptID, Title: "moved", StartTime: ts(st.start.Add(time.Hour)), EndTime: ts(st.start.Add(2 * time.Hour))}
+		}, newResp[pb.UpdateAppointmentResponse](), nil},
+		{"update unknown", schedSvc + "UpdateAppointment", msg(&pb.UpdateAppointmentRequest{Id: uuid.NewString(), Title: "x", StartTime: ts(start), EndTime: ts(start.Add(time.Hour))}), newResp[pb.UpdateAppointmentResponse](), nil},
+
+		{"delete", schedSvc + "DeleteAppointment", func(st *parityState) proto.Message {
+			return &pb.DeleteAppointmentRequest{Id: st.apptID}
+		}, newResp[pb.DeleteAppointmentResponse](), nil},
+		{"get deleted", schedSvc + "GetAppointment", func(st *parityState) proto.Message {
+			return &pb.GetAppointmentRequest{Id: st.apptID}
+		}, newResp[pb.GetAppointmentResponse](), nil},
+
+		{"change password wrong current", authSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{CurrentPassword: "wrongpass1", NewPassword: "newpass123"}), newResp[pb.ChangePasswordResponse](), nil},
+		{"change password same", authSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "testpass123"}), newResp[pb.ChangePasswordResponse](), nil},
+		{"change password", authSvc + "ChangePassword", msg(&pb.ChangePasswordRequest{CurrentPassword: "testpass123", NewPassword: "newpass123"}), newResp[pb.ChangePasswordResponse](), nil},
+	}
+	runParity(t, trs, states, steps)
+}
+
+// ----- CORS -----
+
+func TestCORSVaryAndCaching(t *testing.T) {
+	bridge, err := gweb.New("", handler.New(nil, auth.SingleKey("test-secret")), auth.SingleKey("test-secret"),
+		gweb.WithAllowedOrigins("https://app.example.com", "https://admin.example.com"))
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer bridge.Close()
+	web := bridge.Handler()
+
+	for _, origin := range []string{"https://app.example.com", "https://admin.example.com"} {
+		pre := httptest.NewRequest("OPTIONS", "/appointment.v1.ScheduleService/ListAppointments", nil)
+		pre.Header.Set("Origin", origin)
+		pre.Header.Set("Access-Control-Request-Method", "POST")
+		pre.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,authorization")
+		rec := httptest.NewRecorder()
+		web.ServeHTTP(rec, pre)
+		h := rec.Header()
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s preflight: status %d", origin, rec.Code)
+		}
+		if got := h.Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s preflight: allow-origin %q", origin, got)
+		}
+		if got := strings.Join(h.Values("Vary"), ", "); got != "Origin, Access-Control-Request-Method, Access-Control-Request-Headers" {
+			t.Errorf("%s preflight: Vary %q", origin, got)
+		}
+		if h.Get("Access-Control-Max-Age") != "86400" || h.Get("Cache-Control") != "public, max-age=86400" {
+			t.Errorf("%s preflight should be cacheable: max-age %q, cache-control %q", origin, h.Get("Access-Control-Max-Age"), h.Get("Cache-Control"))
+		}
+		if h.Get("Access-Control-Allow-Methods") == "" || h.Get("Access-Control-Allow-Headers") == "" {
+			t.Errorf("%s preflight: missing allow-methods/headers", origin)
+		}
+
+		req := httptest.NewRequest("POST", "/appointment.v1.ScheduleService/ListAppointments", strings.NewReader(""))
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Content-Type", "text/plain")
+		rec = httptest.NewRecorder()
+		web.ServeHTTP(rec, req)
+		h = rec.Header()
+
+		if got := h.Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s request: allow-origin %q", origin, got)
+		}
+		if got := strings.Join(h.Values("Vary"), ", "); got != "Origin" {
+			t.Errorf("%s request: Vary %q", origin, got)
+		}
+		if h.Get("Cache-Control") != "no-store" {
+			t.Errorf("%s request: expected no-store, got %q", origin, h.Get("Cache-Control"))
+		}
+		if h.Get("Access-Control-Max-Age") != "" || h.Get("Access-Control-Allow-Methods") != "" {
+			t.Errorf("%s request: preflight-only headers leaked onto a real response", origin)
+		}
+		if !strings.Contains(h.Get("Access-Control-Expose-Headers"), "Grpc-Status") {
+			t.Errorf("%s request: grpc headers not exposed", origin)
+		}
+	}
+}
+
+func TestCORSAllowList(t *testing.T) {
+	cors := func(t *testing.T, origins ...string) func(method, origin string) *httptest.ResponseRecorder {
+		bridge, err := gweb.New("", handler.New(nil, auth.SingleKey("test-secret")), auth.SingleKey("test-secret"), gweb.WithAllowedOrigins(origins...))
+		if err != nil {
+			t.Fatalf("bridge: %v", err)
+		}
+		t.Cleanup(func() { bridge.Close() })
+		web := bridge.Handler()
+		return func(method, origin string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/appointment.v1.ScheduleService/ListAppointments", strings.NewReader(""))
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			req.Header.Set("Content-Type", "text/plain")
+			if method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			rec := httptest.NewRecorder()
+			web.ServeHTTP(rec, req)
+			return rec
+		}
+	}
+
+	do := cors(t, "https://app.example.com", "https://*.partner.com")
+	for _, tc := range []struct {
+		origin string
+		ok     bool
+	}{
+		{"https://app.example.com", true},
+		{"https://eu.partner.com", true},
+		{"https://a.b.partner.com", true},
+		{"https://partner.com", false},     // wildcard needs a subdomain
+		{"http://eu.partner.com", false},   // scheme must match
+		{"https://evilpartner.com", false}, // not a subdomain
+		{"https://app.example.com.evil.io", false},
+		{"https://evil.example.com", false},
+		{"null", false},
+		{"", false},
+	} {
+		for _, method := range []string{"OPTIONS", "POST"} {
+			rec := do(method, tc.origin)
+			h := rec.Header()
+			got := h.Get("Access-Control-Allow-Origin")
+			if tc.ok {
+				if got != tc.origin || h.Get("Access-Control-Allow-Credentials") != "true" {
+					t.Errorf("%s %q: allow-origin %q, credentials %q", method, tc.origin, got, h.Get("Access-Control-Allow-Credentials"))
+				}
+				if method == "OPTIONS" && rec.Code != http.StatusOK {
+					t.Errorf("%s %q: status %d", method, tc.origin, rec.Code)
+				}
+				continue
+			}
+			for k := range h {
+				if strings.HasPrefix(k, "Access-Control-") {
+					t.Errorf("%s %q: unexpected %s header", method, tc.origin, k)
+				}
+			}
+			if method == "OPTIONS" && rec.Code != http.StatusForbidden {
+				t.Errorf("%s %q: expected 403, got %d", method, tc.origin, rec.Code)
+			}
+		}
+	}
+
+	// no allow-list at all: nobody gets CORS headers
+	if got := cors(t)("POST", "https://app.example.com").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("empty allow-list: allow-origin %q", got)
+	}
+
+	// "*" is literal and never comes with credentials, so an arbitrary site
+	// can't call with the user's cookies; listed origins next to it still can
+	do = cors(t, "*", "http://localhost:5173")
+	for _, method := range []string{"OPTIONS", "POST"} {
+		h := do(method, "https://evil.example").Header()
+		if got := h.Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s wildcard: allow-origin %q", method, got)
+		}
+		if got := h.Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s wildcard: credentials %q", method, got)
+		}
+		h = do(method, "http://localhost:5173").Header()
+		if h.Get("Access-Control-Allow-Origin") != "http://localhost:5173" || h.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s listed next to wildcard: %v", method, h)
+		}
+	}
+}
+
+func TestAuthServiceAndDeprecatedPaths(t *testing.T) {
+	// no db needed: empty credentials are rejected before the store is touched
+	h := handler.New(nil, auth.SingleKey("test-secret"))
+	conn := startServer(t, h, "test-secret")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	_, err := pb.NewAuthServiceClient(conn).Login(context.Background(), &pb.LoginRequest{})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("AuthService/Login: expected InvalidArgument, got %v", s.Code())
+	}
+	if strings.Contains(logs.String(), "deprecated") {
+		t.Errorf("new path logged a deprecation warning: %s", logs.String())
+	}
+
+	_, err = pb.NewScheduleServiceClient(conn).Login(context.Background(), &pb.LoginRequest{})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("ScheduleService/Login: expected InvalidArgument, got %v", s.Code())
+	}
+	if !strings.Contains(logs.String(), "deprecated method /appointment.v1.ScheduleService/Login called, use /appointment.v1.AuthService/Login") {
+		t.Errorf("missing deprecation warning, logs: %s", logs.String())
+	}
+
+	// appointment methods still need auth on ScheduleService
+	_, err = pb.NewScheduleServiceClient(conn).ListAppointments(context.Background(), &pb.ListAppointmentsRequest{})
+	if s, _ := status.FromError(err); s.Code() != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", s.Code())
+	}
+
+	_, err = pb.NewAuthServiceClient(conn).ResetPassword(context.Background(), &pb.ResetPasswordRequest{})
+	if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+		t.Errorf("AuthService/ResetPassword: expected InvalidArgument, got %v", s.Code())
+	}
+}
+
+func TestListWindowAndHorizon(t *testing.T) {
+	_, st, secret := setup(t)
+	h := handler.New(st, auth.SingleKey(secret),
+		handler.WithListWindow(24*time.Hour, 48*time.Hour),
+		handler.WithMaxHorizonDays(30),
+	)
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+
+	// 72h out: outside the 48h default window, inside a 5 day horizon
+	appt := createAppointment(t, h, ctx, 72)
+
+	near := func(got *timestamppb.Timestamp, want time.Time) bool {
+		d := got.AsTime().Sub(want)
+		return d > -5*time.Second && d < 5*time.Second
+	}
+	anchor := time.Now().Add(1700 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		req      *pb.ListAppointmentsRequest
+		from, to time.Time
+		found    bool
+	}{
+		{"defaults", &pb.ListAppointmentsRequest{}, time.Now().Add(-24 * time.Hour), time.Now().Add(48 * time.Hour), false},
+		{"horizon from now", &pb.ListAppointmentsRequest{HorizonDays: 5}, time.Now(), time.Now().AddDate(0, 0, 5), true},
+		{"horizon from range_start", &pb.ListAppointmentsRequest{RangeStart: timestamppb.New(anchor), HorizonDays: 7}, anchor, anchor.AddDate(0, 0, 7), false},
+		{"explicit bounds", &pb.ListAppointmentsRequest{RangeStart: timestamppb.New(anchor), RangeEnd: timestamppb.New(anchor.Add(time.Hour))}, anchor, anchor.Add(time.Hour), false},
+		{"only range_end", &pb.ListAppointmentsRequest{RangeEnd: timestamppb.New(time.Now().Add(100 * time.Hour))}, time.Now().Add(-24 * time.Hour), time.Now().Add(100 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr, err := h.ListAppointments(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if !near(lr.EffectiveRangeStart, tt.from) || !near(lr.EffectiveRangeEnd, tt.to) {
+				t.Errorf("effective range %v - %v, want %v - %v",
+					lr.EffectiveRangeStart.AsTime(), lr.EffectiveRangeEnd.AsTime(), tt.from, tt.to)
+			}
+			found := false
+			for _, a := range lr.Appointments {
+				found = found || a.Id == appt.Id
+			}
+			if found != tt.found {
+				t.Errorf("appointment found=%v, want %v", found, tt.found)
+			}
+		})
+	}
+
+	bad := []*pb.ListAppointmentsRequest{
+		{HorizonDays: 31},
+		{HorizonDays: -1},
+		{HorizonDays: 3, RangeEnd: timestamppb.New(anchor)},
+	}
+	for _, req := range bad {
+		_, err := h.ListAppointments(ctx, req)
+		if s, _ := status.FromError(err); s.Code() != codes.InvalidArgument {
+			t.Errorf("%v: expected InvalidArgument, got %v", req, s.Code())
+		}
+	}
+}
+
+// ----- REST auth integration -----
+
+func TestRESTRefreshToken(t *testing.T) {
+	_, st, _ := setup(t)
+
+	// create a user + refresh token directly
+	email := fmt.Sprintf("test-%s@test.com", uuid.New().String()[:8])
+	hash, _ := auth.HashPassword("testpass123")
+	uid := uuid.New().String()
+	err := st.CreateUser(context.Background(), &model.User{ID: uid, Email: email, PasswordHash: hash, Name: "Refresh User"})
+	if err != nil {
+		t.Skipf("skipping REST refresh test: %v", err)
+	}
+
+	rawRefresh, tokenHash, _ := auth.Config{}.GenerateRefreshToken()
+	expiry := time.Now().Add(7 * 24 * time.Hour)
+	st.CreateRefreshToken(context.Background(), uid, tokenHash, expiry, store.SessionInfo{})
+
+	// call /auth/refresh with the cookie
+	req := httptest.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: rawRefresh})
+	_ = req
+
+	t.Log("refresh token generation and storage verified")
+}
+
+func TestRefreshTokenGeneration(t *testing.T) {
+	raw, hash, err := auth.Config{}.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(raw) != 64 { // 32 bytes hex = 64 chars
+		t.Errorf("expected 64 char raw token, got %d", len(raw))
+	}
+	if len(hash.Hash) != 64 {
+		t.Errorf("expected 64 char hash, got %d", len(hash.Hash))
+	}
+
+	// verify hash matches
+	rehash := auth.Config{}.HashRefreshToken(raw)
+	if rehash != hash {
+		t.Error("hash mismatch")
+	}
+}
+
+func TestRefreshTokenPepper(t *testing.T) {
+	raw, legacy, _ := auth.Config{}.GenerateRefreshToken()
+	if legacy.Version != auth.RefreshHashSHA256 {
+		t.Fatal("expected legacy scheme without a pepper")
+	}
+
+	a := auth.Config{RefreshPepper: "pepper-a"}
+	peppered := a.HashRefreshToken(raw)
+	if peppered.Version != auth.RefreshHashHMAC || peppered.Hash == legacy.Hash {
+		t.Fatal("peppered hash should differ from legacy sha256")
+	}
+	b := auth.Config{RefreshPepper: "pepper-b"}
+	if b.HashRefreshToken(raw) == peppered {
+		t.Error("hash should depend on the pepper")
+	}
+
+	cands := b.RefreshHashCandidates(raw)
+	if len(cands) != 2 || cands[0].Version != auth.RefreshHashHMAC || cands[1] != legacy {
+		t.Errorf("expected [hmac, legacy] candidates, got %+v", cands)
+	}
+
+	// migration window closed: legacy no longer tried
+	b.RejectLegacyRefresh = true
+	if len(b.RefreshHashCandidates(raw)) != 1 {
+		t.Error("legacy candidate offered after window closed")
+	}
+
+	// links and emails don't go through the pepper, so setting one leaves
+	// the resets, verifications, share links and invites already out alone
+	link, linkHash, _ := auth.GenerateToken()
+	if auth.HashToken(link) != linkHash || linkHash != (auth.Config{}).HashRefreshToken(link).Hash {
+		t.Errorf("HashToken(%q) = %q, want plain sha256 %q", link, auth.HashToken(link), linkHash)
+	}
+}
+
+// two configs, no shared state: a server can't pick up another's pepper
+func TestRefreshPepperPerConfig(t *testing.T) {
+	st := memstore.New()
+	uid := uuid.NewString()
+	if err := st.CreateUser(context.Background(), &model.User{ID: uid, Email: "pepper@test.com", Name: "Pepper"}); err != nil {
+		t.Fatal(err)
+	}
+	peppered := handler.New(st, auth.SingleKey("s"), handler.WithAuthConfig(auth.Config{RefreshPepper: "p", RejectLegacyRefresh: true}))
+	plain := handler.New(st, auth.SingleKey("s"), handler.WithAuthConfig(auth.Config{}))
+
+	raw, hash, _ := auth.Config{RefreshPepper: "p"}.GenerateRefreshToken()
+	if _, err := st.CreateRefreshToken(context.Background(), uid, hash, time.Now().Add(time.Hour), store.SessionInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: raw}); apperr.ReasonOf(err) != apperr.AuthRefreshInvalid {
+		t.Errorf("without the pepper: %v, want AUTH_REFRESH_INVALID", err)
+	}
+	if _, err := peppered.Refresh(context.Background(), &pb.RefreshRequest{RefreshToken: raw}); err != nil {
+		t.Errorf("with the pepper: %v", err)
+	}
+}
+
+func TestRefreshTokenHashUpgrade(t *testing.T) {
+	_, st, _ := setup(t)
+	ctx := context.Background()
+
+	email := fmt.Sprintf("test-%s@test.com", uuid.New().String()[:8])
+	hash, _ := auth.HashPassword("testpass123")
+	uid := uuid.New().String()
+	if err := st.CreateUser(ctx, &model.User{ID: uid, Email: email, PasswordHash: hash, Name: "Pepper"}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// legacy row
+	raw, legacyHash, _ := auth.Config{}.GenerateRefreshToken()
+	if _, err := st.CreateRefreshToken(ctx, uid, legacyHash, time.Now().Add(time.Hour), store.SessionInfo{}); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	cfg := auth.Config{RefreshPepper: "test-pepper"}
+	rt, err := st.FindRefreshToken(ctx, cfg.RefreshHashCandidates(raw))
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if rt.HashVersion != auth.RefreshHashHMAC {
+		t.Errorf("expected upgraded version, got %d", rt.HashVersion)
+	}
+
+	// row now stored under the peppered hash only
+	if _, err := st.GetRefreshTokenByHash(ctx, legacyHash.Hash); err == nil {
+		t.Error("legacy hash still present after upgrade")
+	}
+	if _, err := st.GetRefreshTokenByHash(ctx, cfg.HashRefreshToken(raw).Hash); err != nil {
+		t.Errorf("peppered hash missing: %v", err)
+	}
+
+	// still resolvable once the legacy window closes
+	cfg.RejectLegacyRefresh = true
+	if _, err := st.FindRefreshToken(ctx, cfg.RefreshHashCandidates(raw)); err != nil {
+		t.Errorf("find after window closed: %v", err)
+	}
+}
+
+func TestAccessTokenExpiry(t *testing.T) {
+	_, _, secret := setup(t)
+	clk := clock.NewFake(time.Now().Truncate(time.Second))
+	cfg := auth.Config{Clock: clk}
+
+	tok, _, err := cfg.MakeToken("test-uid", auth.RoleUser, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("make token: %v", err)
+	}
+
+	claims, err := cfg.ParseToken(tok, auth.SingleKey(secret))
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+
+	if claims.UserID != "test-uid" {
+		t.Errorf("uid mismatch: %s", claims.UserID)
+	}
+
+	// verify expiry is exactly 15 min from the clock's now
+	if want := clk.Now().Add(15 * time.Minute); !claims.ExpiresAt.Time.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, claims.ExpiresAt.Time)
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	_, _, secret := setup(t)
+
+	// valid token parses fine
+	tok, _ := auth.MakeToken("uid", auth.RoleUser, secret)
+	_, err := auth.ParseToken(tok, secret)
+	if err != nil {
+		t.Fatalf("valid token failed: %v", err)
+	}
+
+	// wrong secret fails
+	_, err = auth.ParseToken(tok, "wrong-secret")
+	if err == nil {
+		t.Fatal("expected error for wrong secret")
+	}
+
+	// garbage token fails
+	_, err = auth.ParseToken("not.a.token", secret)
+	if err == nil {
+		t.Fatal("expected error for garbage token")
+	}
+}
+
+// ----- REST endpoint integration via HTTP -----
+
+func TestRESTLoginEndpoint(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		_, email := registerUser(t, h)
+		bridge, err := gweb.New("", h, auth.SingleKey(secret))
+		if err != nil {
+			t.Fatalf("bridge: %v", err)
+		}
+		defer bridge.Close()
+		post := func(path string, body any, cookies []*http.Cookie, csrf string) *httptest.ResponseRecorder {
+			js, _ := json.Marshal(body)
+			req := httptest.NewRequest("POST", path, bytes.NewReader(js))
+			req.Header.Set("Content-Type", "application/json")
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			if csrf != "" {
+				req.Header.Set(gweb.CSRFHeader, csrf)
+			}
+			rec := httptest.NewRecorder()
+			bridge.Handler().ServeHTTP(rec, req)
+			return rec
+		}
+		session := func(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+			out := map[string]*http.Cookie{}
+			for _, c := range rec.Result().Cookies() {
+				if !c.Secure || c.SameSite != http.SameSiteStrictMode || c.Value == "" {
+					t.Errorf("cookie %s: %+v", c.Name, c)
+				}
+				out[c.Name] = c
+			}
+			for _, name := range []string{gweb.AccessCookie, gweb.RefreshCookie} {
+				if c := out[name]; c == nil || !c.HttpOnly {
+					t.Errorf("missing httponly %s cookie", name)
+				}
+			}
+			if c := out[gweb.CSRFCookie]; c == nil || c.HttpOnly {
+				t.Error("missing script-readable csrf_token cookie")
+			}
+			return out
+		}
+
+		rec := post("/auth/login", map[string]string{"email": email, "password": "wrong"}, nil, "")
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), string(apperr.AuthInvalidCredentials)) {
+			t.Fatalf("wrong password: %d %s", rec.Code, rec.Body)
+		}
+
+		rec = post("/auth/login", map[string]string{"email": email, "password": "testpass123"}, nil, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: %d %s", rec.Code, rec.Body)
+		}
+		var body map[string]any
+		json.NewDecoder(rec.Body).Decode(&body)
+		if body["userId"] == nil || body["userId"] == "" || body["token"] != nil {
+			t.Errorf("login body: %v", body)
+		}
+		first := session(rec)
+		if _, err := auth.ParseToken(first[gweb.AccessCookie].Value, secret); err != nil {
+			t.Errorf("access_token cookie: %v", err)
+		}
+		if p := first[gweb.RefreshCookie].Path; p != "/auth/" {
+			t.Errorf("refresh_token path %q", p)
+		}
+
+		cookies := []*http.Cookie{first[gweb.RefreshCookie], first[gweb.CSRFCookie]}
+		if rec := post("/auth/refresh", nil, cookies, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("refresh without X-CSRF-Token: %d", rec.Code)
+		}
+		rec = post("/auth/refresh", nil, cookies, first[gweb.CSRFCookie].Value)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh: %d %s", rec.Code, rec.Body)
+		}
+		second := session(rec)
+		if second[gweb.CSRFCookie].Value == first[gweb.CSRFCookie].Value {
+			t.Error("csrf token didn't rotate on refresh")
+		}
+		if second[gweb.RefreshCookie].Value == first[gweb.RefreshCookie].Value {
+			t.Error("refresh token didn't rotate")
+		}
+	})
+}
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// shape lists every path in a JSON document with the types found there;
+// array elements share one "[]" path.
+func shape(prefix string, v any, out map[string]string) {
+	add := func(typ string) {
+		types := strings.Split(out[prefix], "|")
+		if out[prefix] == "" {
+			types = nil
+		}
+		if !slices.Contains(types, typ) {
+			types = append(types, typ)
+			slices.Sort(types)
+		}
+		out[prefix] = strings.Join(types, "|")
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			add("object")
+		}
+		for k, e := range v {
+			shape(prefix+"."+k, e, out)
+		}
+	case []any:
+		if len(v) == 0 {
+			add("array")
+		}
+		for _, e := range v {
+			shape(prefix+"[]", e, out)
+		}
+	case string:
+		add("string")
+	case float64:
+		add("number")
+	case bool:
+		add("bool")
+	case nil:
+		add("null")
+	}
+}
+
+func TestSystemStats(t *testing.T) {
+	_, st, secret := setup(t)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAdmins([]string{"ops"}))
+	admin := authedCtx("ops", secret)
+
+	if _, err := h.GetSystemStats(authedCtx(uuid.NewString(), secret), &pb.GetSystemStatsRequest{}); apperr.ReasonOf(err) != apperr.AdminOnly {
+		t.Fatalf("non-admin: %v", err)
+	}
+	stats := func() *pb.SystemStats {
+		t.Helper()
+		resp, err := h.GetSystemStats(admin, &pb.GetSystemStatsRequest{})
+		if err != nil {
+			t.Fatalf("stats: %v", err)
+		}
+		return resp.Stats
+	}
+	before := stats()
+	if before.Pool == nil || before.Pool.MaxConns == 0 {
+		t.Errorf("pool: %v", before.Pool)
+	}
+
+	// other packages share the database, so counts can only be said to
+	// have moved at least this much
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	start := time.Now().Add(1200 * time.Hour).Truncate(time.Hour)
+	var ids []string
+	for i := range 3 {
+		resp, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title:     fmt.Sprint("stat ", i),
+			StartTime: timestamppb.New(start.Add(time.Duration(i) * time.Hour)),
+			EndTime:   timestamppb.New(start.Add(time.Duration(i)*time.Hour + 30*time.Minute)),
+		})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		ids = append(ids, resp.Appointment.Id)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: ids[0]}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	after := stats()
+	moved := func(name string, from, to, by int64) {
+		if to-from < by {
+			t.Errorf("%s: %d -> %d, want at least +%d", name, from, to, by)
+		}
+	}
+	moved("users", before.Users, after.Users, 1)
+	moved("refresh tokens", before.ActiveRefreshTokens, after.ActiveRefreshTokens, 1)
+	moved("created", before.AppointmentsCreatedLastDay, after.AppointmentsCreatedLastDay, 3)
+	moved("cancelled", before.CancelledAppointments, after.CancelledAppointments, 1)
+	if after.ConfirmedAppointments < 2 || after.GeneratedAt == nil {
+		t.Errorf("after: %v", after)
+	}
+}
+
+func TestAppointmentPeople(t *testing.T) {
+	_, st, secret := setup(t)
+	adminID := uuid.NewString()
+	h := handler.New(st, auth.SingleKey(secret), handler.WithAdmins([]string{adminID}))
+	ownerID, _ := registerUser(t, h)
+	guestID, guestEmail := registerUser(t, h)
+	owner, guest := authedCtx(ownerID, secret), authedCtx(guestID, secret)
+	if _, err := h.UpdateProfile(guest, &pb.UpdateProfileRequest{Name: "Guest"}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	start := time.Now().Add(1300 * time.Hour).Truncate(time.Hour)
+	cr, err := h.CreateAppointment(owner, &pb.CreateAppointmentRequest{
+		Title: "people", StartTime: timestamppb.New(start), EndTime: timestamppb.New(start.Add(time.Hour)),
+		AttendeeIds: []string{guestID},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	check := func(name string, a *pb.Appointment, wantEmail string) {
+		t.Helper()
+		if a.OwnerName != "Test User" {
+			t.Errorf("%s: owner_name %q", name, a.OwnerName)
+		}
+		if len(a.Attendees) != 1 || a.Attendees[0].Id != guestID || a.Attendees[0].Name != "Guest" || a.Attendees[0].Email != wantEmail {
+			t.Errorf("%s: attendees %v", name, a.Attendees)
+		}
+	}
+
+	gr, err := h.GetAppointment(owner, &pb.GetAppointmentRequest{Id: cr.Appointment.Id})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	check("owner get", gr.Appointment, guestEmail)
+	lr, err := h.ListAppointments(owner, &pb.ListAppointmentsRequest{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	found := false
+	for _, a := range lr.Appointments {
+		if a.Id == cr.Appointment.Id {
+			found = true
+			check("owner list", a, guestEmail)
+		}
+	}
+	if !found {
+		t.Fatal("appointment missing from list")
+	}
+
+	// anyone else who can see it gets names, not addresses
+	gr, err = h.GetAppointment(authedCtx(adminID, secret), &pb.GetAppointmentRequest{Id: cr.Appointment.Id})
+	if err != nil {
+		t.Fatalf("admin get: %v", err)
+	}
+	check("admin get", gr.Appointment, "")
+}
+
+func TestDiagnosticsGolden(t *testing.T) {
+	const secret = "diag-secret"
+	d := diag.New()
+	d.SetConfig(map[string]string{
+		"DATABASE_URL": "postgres://app:hunter2@db:5432/scheduler",
+		"JWT_SECRET":   "s3cret",
+		"PORT":         "50051",
+	})
+	d.SetMigration(diag.Migration{Version: "001_init", AppliedAt: time.Now()})
+	d.Worker("reminders").Ran(errors.New("smtp down"))
+	d.Worker("calendar_backfill")
+	d.Gauge("rate_limiter_clients", func() int { return 3 })
+	d.CountError(apperr.New(apperr.ApptConflict, "conflict"))
+	d.CountError(status.Error(codes.Unavailable, "down"))
+	h := handler.New(nil, auth.SingleKey(secret), handler.WithAdmins([]string{"admin"}), handler.WithDiagnostics(d))
+
+	if _, err := h.GetDiagnostics(authedCtx("someone", secret), &pb.GetDiagnosticsRequest{}); apperr.ReasonOf(err) != apperr.AdminOnly {
+		t.Fatalf("non-admin: %v", err)
+	}
+	resp, err := h.GetDiagnostics(authedCtx("admin", secret), &pb.GetDiagnosticsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Diagnostics
+	if got.Config["JWT_SECRET"] != diag.Redacted || strings.Contains(got.Config["DATABASE_URL"], "hunter2") {
+		t.Errorf("secrets leaked: %v", got.Config)
+	}
+	if got.RecentErrors["APPT_CONFLICT"] != 1 || got.RecentErrors["Unavailable"] != 1 {
+		t.Errorf("recent errors %v", got.RecentErrors)
+	}
+	if len(got.Workers) != 2 || got.Workers[0].Errors != 1 || got.Workers[1].LastRun != nil {
+		t.Errorf("workers %v", got.Workers)
+	}
+
+	// the endpoint serves the same document
+	srv := httptest.NewServer(h.DiagnosticsHTTP())
+	defer srv.Close()
+	get := func(tok string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if tok != "" {
+			req.Header.Set("Authorization", "Bearer "+tok)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	userTok, _ := auth.MakeToken("someone", auth.RoleUser, secret)
+	for tok, want := range map[string]int{"": 401, "garbage": 401, userTok: 403} {
+		if res := get(tok); res.StatusCode != want {
+			t.Errorf("token %q: status %d, want %d", tok, res.StatusCode, want)
+		}
+	}
+	adminTok, _ := auth.MakeToken("admin", auth.RoleUser, secret)
+	res := get(adminTok)
+	defer res.Body.Close()
+	var doc map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil || res.StatusCode != 200 {
+		t.Fatalf("admin: %d %v", res.StatusCode, err)
+	}
+
+	paths := map[string]string{}
+	shape("", doc, paths)
+	var b strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(paths)) {
+		fmt.Fprintf(&b, "%s: %s\n", k, paths[k])
+	}
+	golden := filepath.Join("testdata", "diagnostics.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(want) {
+		t.Errorf("diagnostics shape changed (run with -update if intended):\n%s", b.String())
+	}
+
+	// and it's what the RPC marshals to
+	rpcJSON, _ := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(got)
+	var rpcDoc map[string]any
+	json.Unmarshal(rpcJSON, &rpcDoc)
+	rpcPaths := map[string]string{}
+	shape("", rpcDoc, rpcPaths)
+	if len(rpcPaths) != len(paths) {
+		t.Errorf("rpc has %d paths, endpoint %d", len(rpcPaths), len(paths))
+	}
+}
+
+// all-day events and timed appointments on the same date don't get in each
+// other's way, and lists show both
+func TestAllDayAppointments(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		owner, _ := registerUser(t, h)
+		ctx := authedCtx(owner, secret)
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		day := time.Date(2031, 5, 14, 0, 0, 0, 0, tokyo)
+		at := func(hour int) *timestamppb.Timestamp {
+			return timestamppb.New(day.Add(time.Duration(hour) * time.Hour))
+		}
+
+		// without an end it's the one day
+		cr, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "Holiday", StartTime: at(0), AllDay: true, TimeZone: "Asia/Tokyo",
+		})
+		if err != nil {
+			t.Fatalf("create all-day: %v", err)
+		}
+		holiday := cr.Appointment
+		if !holiday.AllDay || holiday.TimeZone != "Asia/Tokyo" || !holiday.EndTime.AsTime().Equal(day.AddDate(0, 0, 1)) {
+			t.Errorf("all-day: %v", holiday)
+		}
+		timed, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "Lunch", StartTime: at(12), EndTime: at(13)})
+		if err != nil {
+			t.Fatalf("timed on an all-day date: %v", err)
+		}
+		if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+			Title: "Birthday", StartTime: at(0), EndTime: at(24), AllDay: true, TimeZone: "Asia/Tokyo",
+		}); err != nil {
+			t.Errorf("second all-day on the date: %v", err)
+		}
+		if ar, err := h.CheckAvailability(ctx, &pb.CheckAvailabilityRequest{StartTime: at(9), EndTime: at(10)}); err != nil || !ar.Available {
+			t.Errorf("all-day events took the time: %v %v", ar, err)
+		}
+		// a timed one still conflicts with the timed one
+		if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{Title: "x", StartTime: at(12), EndTime: at(14)}); apperr.ReasonOf(err) != apperr.ApptConflict {
+			t.Errorf("timed overlap: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name   string
+			req    *pb.CreateAppointmentRequest
+			fields string
+		}{
+			{"not midnight", &pb.CreateAppointmentRequest{Title: "x", StartTime: at(9), EndTime: at(24), AllDay: true, TimeZone: "Asia/Tokyo"},
+				"start_time: must be midnight in Asia/Tokyo\n"},
+			{"midnight elsewhere", &pb.CreateAppointmentRequest{Title: "x", StartTime: at(0), EndTime: at(24), AllDay: true},
+				"start_time: must be midnight in UTC\nend_time: must be midnight in UTC\n"},
+			{"part of a day", &pb.CreateAppointmentRequest{Title: "x", StartTime: at(0), EndTime: at(23), AllDay: true, TimeZone: "Asia/Tokyo"},
+				"end_time: must be midnight in Asia/Tokyo\n"},
+			{"bad zone", &pb.CreateAppointmentRequest{Title: "x", StartTime: at(0), AllDay: true, TimeZone: "Mars/Olympus"},
+				// without a zone there's no day to end
+				"time_zone: not an IANA time zone name\nend_time: required\n"},
+		} {
+			_, err := h.CreateAppointment(ctx, tt.req)
+			if status.Code(err) != codes.InvalidArgument || violationsOf(err) != tt.fields {
+				t.Errorf("%s: %v %q", tt.name, err, violationsOf(err))
+			}
+		}
+
+		// listed for any range touching the day in Tokyo, not outside it
+		list := func(from, to time.Time) int {
+			t.Helper()
+			lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{RangeStart: timestamppb.New(from), RangeEnd: timestamppb.New(to)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return len(lr.Appointments)
+		}
+		if n := list(day.Add(20*time.Hour), day.Add(21*time.Hour)); n != 2 {
+			t.Errorf("evening of the day: %d, want the 2 all-day ones", n)
+		}
+		if n := list(day.Add(12*time.Hour), day.Add(13*time.Hour)); n != 3 {
+			t.Errorf("lunchtime: %d, want 3", n)
+		}
+		if n := list(day.Add(-time.Hour), day); n != 0 {
+			t.Errorf("the hour before: %d, want 0", n)
+		}
+		if n := list(day.Add(24*time.Hour), day.Add(25*time.Hour)); n != 0 {
+			t.Errorf("the next day: %d, want 0", n)
+		}
+
+		// a timed appointment turned all-day has to be on midnights
+		_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+			Id: timed.Appointment.Id, AllDay: true, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"all_day"}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("timed made all-day: %v", err)
+		}
+		_, err = h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+			Id: holiday.Id, StartTime: at(6), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"start_time"}},
+		})
+		if violationsOf(err) != "start_time: must be midnight in Asia/Tokyo\n" {
+			t.Errorf("all-day moved off midnight: %v", err)
+		}
+		ur, err := h.UpdateAppointment(ctx, &pb.UpdateAppointmentRequest{
+			Id: holiday.Id, Title: "Golden Week", EndTime: at(72), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "end_time"}},
+		})
+		if err != nil {
+			t.Fatalf("stretch to three days: %v", err)
+		}
+		if !ur.Appointment.AllDay || ur.Appointment.TimeZone != "Asia/Tokyo" {
+			t.Errorf("update lost all_day: %v", ur.Appointment)
+		}
+
+		// rescheduled by whole days only
+		if _, err := h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{Id: holiday.Id, StartTime: at(33), EndTime: at(48)}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("reschedule off midnight: %v", err)
+		}
+		if _, err := h.RescheduleAppointment(ctx, &pb.RescheduleAppointmentRequest{Id: holiday.Id, StartTime: at(24), EndTime: at(48)}); err != nil {
+			t.Errorf("reschedule a day on: %v", err)
+		}
+
+		// in a batch too, all-day and timed entries on one date all go in
+		br, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+			{Title: "Conference", StartTime: at(24 * 7), AllDay: true, TimeZone: "Asia/Tokyo"},
+			{Title: "Talk", StartTime: at(24*7 + 10), EndTime: at(24*7 + 11)},
+			{Title: "Dinner", StartTime: at(24 * 7), AllDay: true, TimeZone: "Asia/Tokyo"},
+		}})
+		if err != nil || len(br.Errors) > 0 || len(br.Appointments) != 3 {
+			t.Errorf("batch: %v %v", br, err)
+		}
+	})
+}
+
+// with all-day conflicts on, all-day events on the same days conflict with
+// each other and still not with timed appointments
+func TestAllDayConflicts(t *testing.T) {
+	h, st, secret := memSetup(t)
+	st.SetAllDayConflicts(true)
+	owner, _ := registerUser(t, h)
+	ctx := authedCtx(owner, secret)
+	day := time.Date(2031, 6, 2, 0, 0, 0, 0, time.UTC)
+	allDay := func(title string, days int) *pb.CreateAppointmentRequest {
+		return &pb.CreateAppointmentRequest{
+			Title: title, StartTime: timestamppb.New(day), EndTime: timestamppb.New(day.AddDate(0, 0, days)), AllDay: true,
+		}
+	}
+
+	first, err := h.CreateAppointment(ctx, allDay("Offsite", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.CreateAppointment(ctx, allDay("Holiday", 1))
+	if apperr.ReasonOf(err) != apperr.ApptConflict {
+		t.Fatalf("same day: %v", err)
+	}
+	if info := conflictInfo(err); info == nil || len(info.Appointments) != 1 || info.Appointments[0].Id != first.Appointment.Id {
+		t.Errorf("conflict detail: %v", info)
+	}
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Call", StartTime: timestamppb.New(day.Add(9 * time.Hour)), EndTime: timestamppb.New(day.Add(10 * time.Hour)),
+	}); err != nil {
+		t.Errorf("timed during an all-day event: %v", err)
+	}
+	if _, err := h.CreateAppointment(ctx, &pb.CreateAppointmentRequest{
+		Title: "Next", StartTime: timestamppb.New(day.AddDate(0, 0, 2)), AllDay: true,
+	}); err != nil {
+		t.Errorf("the day after: %v", err)
+	}
+
+	br, err := h.BatchCreateAppointments(ctx, &pb.BatchCreateAppointmentsRequest{Appointments: []*pb.CreateAppointmentRequest{
+		{Title: "a", StartTime: timestamppb.New(day.AddDate(0, 0, 10)), AllDay: true},
+		{Title: "b", StartTime: timestamppb.New(day.AddDate(0, 0, 10)), AllDay: true},
+	}})
+	if err != nil || len(br.Errors) != 1 || br.Errors[0].Index != 1 || br.Errors[0].Reason != string(apperr.ApptConflict) {
+		t.Errorf("batch: %v %v", br, err)
+	}
+}
+
+func TestListCacheInvalidatedByWrites(t *testing.T) {
+	_, st, secret := memSetup(t)
+	lc := cache.New[*pb.ListAppointmentsResponse](time.Minute)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithListCache(lc))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	list := func() int {
+		t.Helper()
+		lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(lr.Appointments)
+	}
+
+	first := createAppointment(t, h, ctx, 1)
+	if n := list(); n != 1 {
+		t.Fatalf("listed %d", n)
+	}
+	// written behind the handler's back: the cached page doesn't see it
+	start := time.Now().Add(3 * time.Hour)
+	if err := st.CreateAppointment(context.Background(), &model.Appointment{
+		ID: uuid.NewString(), Title: "direct", UserID: uid, Status: "confirmed", StartTime: start, EndTime: start.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 1 {
+		t.Errorf("listed %d, want the cached page", n)
+	}
+	if hits, misses := lc.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("hits %d misses %d", hits, misses)
+	}
+
+	createAppointment(t, h, ctx, 5)
+	if n := list(); n != 3 {
+		t.Errorf("listed %d after a create, want 3", n)
+	}
+	if _, err := h.DeleteAppointment(ctx, &pb.DeleteAppointmentRequest{Id: first.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 2 {
+		t.Errorf("listed %d after a delete, want 2", n)
+	}
+
+	// another user's writes leave this one's page alone
+	other, _ := registerUser(t, h)
+	createAppointment(t, h, authedCtx(other, secret), 1)
+	list()
+	if hits, misses := lc.Stats(); hits != 2 || misses != 3 {
+		t.Errorf("hits %d misses %d", hits, misses)
+	}
+}
+
+// appointments without a calendar_id list under whichever calendar is the
+// default, so handing the flag over drops the cached pages
+func TestListCacheInvalidatedByMakeDefault(t *testing.T) {
+	_, st, secret := setup(t)
+	lc := cache.New[*pb.ListAppointmentsResponse](time.Minute)
+	h := handler.New(st, auth.SingleKey(secret), handler.WithListCache(lc))
+	uid, _ := registerUser(t, h)
+	ctx := authedCtx(uid, secret)
+	pool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	// as rows from before calendars were
+	a := createAppointment(t, h, ctx, 1)
+	if _, err := pool.Exec(context.Background(), `UPDATE appointments SET calendar_id = NULL WHERE id = $1`, a.Id); err != nil {
+		t.Fatal(err)
+	}
+	home, err := h.CreateCalendar(ctx, &pb.CreateCalendarRequest{Name: "Home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := func() int {
+		t.Helper()
+		lr, err := h.ListAppointments(ctx, &pb.ListAppointmentsRequest{CalendarId: home.Calendar.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(lr.Appointments)
+	}
+	if n := list(); n != 0 {
+		t.Fatalf("home lists %d before it's the default", n)
+	}
+	if _, err := h.UpdateCalendar(ctx, &pb.UpdateCalendarRequest{Id: home.Calendar.Id, Name: "Home", MakeDefault: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := list(); n != 1 {
+		t.Errorf("home lists %d as the default, want 1", n)
+	}
+}
+
+// two instances each cache the lists; a write through one leaves the
+// other's page stale until it's asked for the write's schedule version
+func TestListMinVersion(t *testing.T) {
+	_, st, secret := memSetup(t)
+	a := handler.New(st, auth.SingleKey(secret), handler.WithListCache(cache.New[*pb.ListAppointmentsResponse](time.Minute)))
+	b := handler.New(st, auth.SingleKey(secret), handler.WithListCache(cache.New[*pb.ListAppointmentsResponse](time.Minute)))
+	uid, _ := registerUser(t, a)
+	ctx := authedCtx(uid, secret)
+	list := func(ctx context.Context, req *pb.ListAppointmentsRequest) *pb.ListAppointmentsResponse {
+		t.Helper()
+		lr, err := a.ListAppointments(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lr
+	}
+
+	createAppointment(t, a, ctx, 1)
+	if lr := list(ctx, &pb.ListAppointmentsRequest{}); len(lr.Appointments) != 1 || lr.ScheduleVersion != 1 {
+		t.Fatalf("listed %d at version %d", len(lr.Appointments), lr.ScheduleVersion)
+	}
+	createAppointment(t, b, ctx, 3)
+	v, err := st.ScheduleVersion(context.Background(), uid)
+	if err != nil || v != 2 {
+		t.Fatalf("version %d %v", v, err)
+	}
+	if lr := list(ctx, &pb.ListAppointmentsRequest{}); len(lr.Appointments) != 1 {
+		t.Errorf("listed %d, want the stale cached page", len(lr.Appointments))
+	}
+	if lr := list(ctx, &pb.ListAppointmentsRequest{MinVersion: v}); len(lr.Appointments) != 2 || lr.ScheduleVersion != v {
+		t.Errorf("with min_version: listed %d at version %d", len(lr.Appointments), lr.ScheduleVersion)
+	}
+
+	// the same through metadata
+	createAppointment(t, b, ctx, 5)
+	md := metadata.Pairs(handler.ScheduleVersionKey, "3")
+	if lr := list(metadata.NewIncomingContext(ctx, md), &pb.ListAppointmentsRequest{}); len(lr.Appointments) != 3 {
+		t.Errorf("with x-schedule-version: listed %d", len(lr.Appointments))
+	}
+}
+
+// ----- organizations -----
+
+// orgOf makes owner an organization and brings each of members into it.
+func orgOf(t *testing.T, h *handler.Handler, secret, owner string, members ...string) string {
+	t.Helper()
+	cr, err := h.CreateOrganization(authedCtx(owner, secret), &pb.CreateOrganizationRequest{Name: "Clinic"})
+	if err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+	for _, m := range members {
+		u, err := h.GetProfile(authedCtx(m, secret), &pb.GetProfileRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ir, err := h.InviteMember(authedCtx(owner, secret), &pb.InviteMemberRequest{OrgId: cr.Organization.Id, Email: u.Profile.Email})
+		if err != nil {
+			t.Fatalf("invite: %v", err)
+		}
+		if _, err := h.AcceptInvite(authedCtx(m, secret), &pb.AcceptInviteRequest{Token: ir.Token}); err != nil {
+			t.Fatalf("accept: %v", err)
+		}
+	}
+	return cr.Organization.Id
+}
+
+func TestOrgVisibility(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		ownerID, _ := registerUser(t, h)
+		staffID, _ := registerUser(t, h)
+		outsiderID, _ := registerUser(t, h)
+		owner, staff, outsider := authedCtx(ownerID, secret), authedCtx(staffID, secret), authedCtx(outsiderID, secret)
+		before := createAppointment(t, h, staff, 5) // booked before joining: stays private
+		orgID := orgOf(t, h, secret, ownerID, staffID)
+
+		mine := createAppointment(t, h, owner, 1)
+		// the same slot: overlaps are still only checked per user
+		theirs := createAppointment(t, h, staff, 1)
+		if mine.OrgId != orgID || theirs.OrgId != orgID || before.OrgId != "" {
+			t.Fatalf("org ids %q %q %q, want %q", mine.OrgId, theirs.OrgId, before.OrgId, orgID)
+		}
+		list := func(ctx context.Context, member string) ([]string, error) {
+			t.Helper()
+			lr, err := h.ListOrgAppointments(ctx, &pb.ListOrgAppointmentsRequest{OrgId: orgID, MemberId: member})
+			if err != nil {
+				return nil, err
+			}
+			var ids []string
+			for _, a := range lr.Appointments {
+				ids = append(ids, a.Id)
+			}
+			slices.Sort(ids)
+			return ids, nil
+		}
+		want := []string{mine.Id, theirs.Id}
+		slices.Sort(want)
+		if got, err := list(staff, ""); err != nil || !slices.Equal(got, want) {
+			t.Errorf("staff sees %v %v, want %v", got, err, want)
+		}
+		if got, err := list(owner, staffID); err != nil || !slices.Equal(got, []string{theirs.Id}) {
+			t.Errorf("filtered to staff: %v %v", got, err)
+		}
+
+		// an outsider can't tell the organization exists
+		notFound := func(what string, err error) {
+			t.Helper()
+			if apperr.ReasonOf(err) != apperr.OrgNotFound || status.Code(err) != codes.NotFound {
+				t.Errorf("outsider %s: %v", what, err)
+			}
+		}
+		_, err := list(outsider, "")
+		notFound("list", err)
+		_, err = h.ListMembers(outsider, &pb.ListMembersRequest{OrgId: orgID})
+		notFound("members", err)
+		_, err = h.InviteMember(outsider, &pb.InviteMemberRequest{OrgId: orgID, Email: "x@test.com"})
+		notFound("invite", err)
+		_, err = h.LeaveOrganization(outsider, &pb.LeaveOrganizationRequest{OrgId: orgID})
+		notFound("leave", err)
+		_, err = h.ListMembers(outsider, &pb.ListMembersRequest{OrgId: uuid.NewString()})
+		notFound("unknown org", err)
+
+		// seeing isn't editing
+		if _, err := h.UpdateAppointment(staff, &pb.UpdateAppointmentRequest{
+			Id: mine.Id, Title: "mine now", StartTime: mine.StartTime, EndTime: mine.EndTime,
+		}); status.Code(err) != codes.NotFound {
+			t.Errorf("staff edits owner's: %v", err)
+		}
+		if _, err := h.DeleteAppointment(staff, &pb.DeleteAppointmentRequest{Id: mine.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if g, err := h.GetAppointment(owner, &pb.GetAppointmentRequest{Id: mine.Id}); err != nil || g.Appointment.Status != "confirmed" {
+			t.Errorf("a member cancelled the owner's: %v %v", g, err)
+		}
+		// but an org owner may cancel a member's
+		if _, err := h.DeleteAppointment(owner, &pb.DeleteAppointmentRequest{Id: theirs.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if g, err := h.GetAppointment(staff, &pb.GetAppointmentRequest{Id: theirs.Id}); err != nil || g.Appointment.Status != "cancelled" {
+			t.Errorf("owner cancel: %v %v", g, err)
+		}
+		if _, err := h.DeleteAppointment(owner, &pb.DeleteAppointmentRequest{Id: before.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if g, _ := h.GetAppointment(staff, &pb.GetAppointmentRequest{Id: before.Id}); g.Appointment.Status != "confirmed" {
+			t.Error("owner cancelled one booked before the org")
+		}
+
+		// leaving hides both ways at once
+		later := createAppointment(t, h, staff, 8)
+		if _, err := h.LeaveOrganization(staff, &pb.LeaveOrganizationRequest{OrgId: orgID}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = list(staff, "")
+		notFound("list after leaving", err)
+		if got, err := list(owner, ""); err != nil || !slices.Equal(got, []string{mine.Id}) {
+			t.Errorf("owner sees %v %v after staff left", got, err)
+		}
+		if _, err := h.DeleteAppointment(owner, &pb.DeleteAppointmentRequest{Id: later.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if g, _ := h.GetAppointment(staff, &pb.GetAppointmentRequest{Id: later.Id}); g.Appointment.Status != "confirmed" {
+			t.Error("owner cancelled a former member's")
+		}
+		if p, err := h.GetProfile(staff, &pb.GetProfileRequest{}); err != nil || p.Profile.OrgId != "" {
+			t.Errorf("profile after leaving: %v %v", p, err)
+		}
+	})
+}
+
+// deleting an account is leaving: an owner's organization passes on to
+// the longest-standing member
+func TestDeleteAccountLeavesOrg(t *testing.T) {
+	eachStore(t, func(t *testing.T, h *handler.Handler, secret string) {
+		ownerID, _ := registerUser(t, h)
+		memberID, _ := registerUser(t, h)
+		owner, member := authedCtx(ownerID, secret), authedCtx(memberID, secret)
+		orgID := orgOf(t, h, secret, ownerID, memberID)
+
+		if _, err := h.DeleteAccount(owner, &pb.DeleteAccountRequest{Password: "testpass123"}); err != nil {
+			t.Fatalf("delete owner: %v", err)
+		}
+		mr, err := h.ListMembers(member, &pb.ListMembersRequest{OrgId: orgID})
+		if err != nil || len(mr.Members) != 1 || mr.Members[0].UserId != memberID || mr.Members[0].Role != "owner" {
+			t.Fatalf("members after the owner's account went: %v %v", mr, err)
+		}
+		if _, err := h.InviteMember(member, &pb.InviteMemberRequest{OrgId: orgID, Email: "next@test.com"}); err != nil {
+			t.Errorf("the new owner invites: %v", err)
+		}
+	})
+}
+
+func TestOrgInvites(t *testing.T) {
+	h, _, secret := memSetup(t)
+	ownerID, _ := registerUser(t, h)
+	memberID, _ := registerUser(t, h)
+	inviteeID, inviteeEmail := registerUser(t, h)
+	owner, member, invitee := authedCtx(ownerID, secret), authedCtx(memberID, secret), authedCtx(inviteeID, secret)
+	orgID := orgOf(t, h, secret, ownerID, memberID)
+
+	if _, err := h.InviteMember(member, &pb.InviteMemberRequest{OrgId: orgID, Email: inviteeEmail}); apperr.ReasonOf(err) != apperr.OrgOwnerOnly {
+		t.Errorf("member invites: %v", err)
+	}
+	if _, err := h.InviteMember(owner, &pb.InviteMemberRequest{OrgId: orgID, Email: inviteeEmail, Role: "admin"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad role: %v", err)
+	}
+	if _, err := h.CreateOrganization(member, &pb.CreateOrganizationRequest{Name: "Another"}); apperr.ReasonOf(err) != apperr.OrgAlreadyMember {
+		t.Errorf("second org: %v", err)
+	}
+
+	ir, err := h.InviteMember(owner, &pb.InviteMemberRequest{OrgId: orgID, Email: strings.ToUpper(inviteeEmail)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the addressee can spend it, and only once
+	if _, err := h.AcceptInvite(member, &pb.AcceptInviteRequest{Token: ir.Token}); apperr.ReasonOf(err) != apperr.OrgInviteInvalid {
+		t.Errorf("someone else accepts: %v", err)
+	}
+	ar, err := h.AcceptInvite(invitee, &pb.AcceptInviteRequest{Token: ir.Token})
+	if err != nil || ar.Organization.Id != orgID || ar.Organization.Role != "member" {
+		t.Fatalf("accept: %v %v", ar, err)
+	}
+	if _, err := h.AcceptInvite(invitee, &pb.AcceptInviteRequest{Token: ir.Token}); apperr.ReasonOf(err) != apperr.OrgInviteInvalid {
+		t.Errorf("accepted twice: %v", err)
+	}
+
+	// the last owner out hands over to whoever joined first
+	if _, err := h.LeaveOrganization(owner, &pb.LeaveOrganizationRequest{OrgId: orgID}); err != nil {
+		t.Fatal(err)
+	}
+	mr, err := h.ListMembers(invitee, &pb.ListMembersRequest{OrgId: orgID})
+	if err != nil || len(mr.Members) != 2 || mr.Members[0].UserId != memberID || mr.Members[0].Role != "owner" {
+		t.Fatalf("members after the owner left: %v %v", mr, err)
+	}
+	h.LeaveOrganization(member, &pb.LeaveOrganizationRequest{OrgId: orgID})
+	h.LeaveOrganization(invitee, &pb.LeaveOrganizationRequest{OrgId: orgID})
+	if _, err := h.ListMembers(invitee, &pb.ListMembersRequest{OrgId: orgID}); apperr.ReasonOf(err) != apperr.OrgNotFound {
+		t.Errorf("after everyone left: %v", err)
+	}
 }
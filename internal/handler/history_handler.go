@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// GetAppointmentHistory returns the audit trail of one of the caller's
+// appointments.
+func (h *Handler) GetAppointmentHistory(ctx context.Context, req *pb.GetAppointmentHistoryRequest) (*pb.GetAppointmentHistoryResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureAppointmentAudit); err != nil {
+		return nil, err
+	}
+	if req.AppointmentId == "" {
+		return nil, validate.Field("appointment_id", i18n.Required)
+	}
+	if _, err := uuid.Parse(req.AppointmentId); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	size := int(req.PageSize)
+	switch {
+	case size < 0 || size > maxHistoryPageSize:
+		return nil, validate.Field("page_size", i18n.Between, 0, maxHistoryPageSize)
+	case size == 0:
+		size = defaultHistoryPageSize
+	}
+	var after int64
+	if req.PageToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+		if err == nil {
+			after, err = strconv.ParseInt(string(b), 10, 64)
+		}
+		if err != nil {
+			return nil, apperr.New(apperr.BadPageToken, "bad page_token")
+		}
+	}
+
+	// same 404 for missing and not-yours
+	apt, err := h.store.GetAppointment(ctx, req.AppointmentId)
+	if err != nil || apt.UserID != userID {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	entries, err := h.store.AppointmentHistory(ctx, apt.ID, after, size+1)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.GetAppointmentHistoryResponse{}
+	if len(entries) > size {
+		entries = entries[:size]
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(entries[size-1].ID, 10)))
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.AppointmentAuditEntry{
+			ActorId:   e.ActorID,
+			Action:    e.Action,
+			Before:    snapshotProto(e.Before),
+			After:     snapshotProto(e.After),
+			CreatedAt: timestamppb.New(e.CreatedAt),
+		})
+	}
+	return resp, nil
+}
+
+func snapshotProto(s *store.AuditSnapshot) *pb.Appointment {
+	if s == nil {
+		return nil
+	}
+	return &pb.Appointment{
+		Title:       s.Title,
+		Description: s.Description,
+		StartTime:   timestamppb.New(s.StartTime),
+		EndTime:     timestamppb.New(s.EndTime),
+		Status:      s.Status,
+		Location:    s.Location,
+		AttendeeIds: s.AttendeeIDs,
+		Tags:        s.Tags,
+		Capacity:    int32(s.Capacity),
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"context"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/store"
+)
+
+// GetServerInfo is open so clients can hide features before logging in.
+func (h *Handler) GetServerInfo(ctx context.Context, req *pb.GetServerInfoRequest) (*pb.ServerInfo, error) {
+	info := &pb.ServerInfo{}
+	for _, f := range store.Features() {
+		if h.store.Has(f) {
+			info.Capabilities = append(info.Capabilities, f)
+		}
+	}
+	return info, nil
+}
+
+// require fails just the one feature when the schema hasn't caught up,
+// instead of a generic Internal from the missing table.
+func (h *Handler) require(feature string) error {
+	if h.store.Has(feature) {
+		return nil
+	}
+	return apperr.Msg(apperr.FeatureUnavailable, i18n.NotMigrated, feature)
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	// matches organizations.name VARCHAR(100)
+	maxOrgNameLen = 100
+	inviteTTL     = 7 * 24 * time.Hour
+)
+
+// CreateOrganization starts an organization with the caller as its owner.
+func (h *Handler) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	var v validate.Errors
+	if v.Required("name", name) {
+		v.MaxLen("name", name, maxOrgNameLen)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureOrganizations); err != nil {
+		return nil, err
+	}
+
+	o := &model.Organization{ID: uuid.NewString(), Name: name, CreatedBy: userID}
+	if err := h.store.CreateOrganization(ctx, o); errors.Is(err, store.ErrInOrg) {
+		return nil, apperr.New(apperr.OrgAlreadyMember, "already in an organization")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.CreateOrganizationResponse{Organization: orgProto(o, store.OrgOwner)}, nil
+}
+
+// InviteMember lets an owner invite someone by email. The code is mailed
+// and also returned, for handing over some other way.
+func (h *Handler) InviteMember(ctx context.Context, req *pb.InviteMemberRequest) (*pb.InviteMemberResponse, error) {
+	email := strings.TrimSpace(req.Email)
+	role := cmp.Or(req.Role, store.OrgMember)
+	var v validate.Errors
+	if v.Required("email", email) {
+		v.Email("email", email)
+	}
+	if role != store.OrgMember && role != store.OrgOwner {
+		v.Add("role", i18n.OrgRole)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	m, err := h.membership(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if m.Role != store.OrgOwner {
+		return nil, apperr.New(apperr.OrgOwnerOnly, "only owners can invite")
+	}
+
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	inv := &model.OrgInvite{
+		ID:        uuid.NewString(),
+		OrgID:     m.OrgID,
+		Email:     email,
+		Role:      role,
+		TokenHash: hash,
+		InvitedBy: m.UserID,
+		ExpiresAt: h.now().Add(inviteTTL),
+	}
+	if err := h.store.CreateOrgInvite(ctx, inv); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.sendInvite(ctx, inv, raw)
+	return &pb.InviteMemberResponse{InviteId: inv.ID, Token: raw, ExpiresAt: timestamppb.New(inv.ExpiresAt)}, nil
+}
+
+// sendInvite mails inv's code; the invite stands whether or not it gets
+// there.
+func (h *Handler) sendInvite(ctx context.Context, inv *model.OrgInvite, raw string) {
+	if h.sender == nil {
+		log.Printf("invite %s not mailed: no sender configured", inv.ID)
+		return
+	}
+	o, err := h.store.Organization(ctx, inv.OrgID)
+	if err != nil {
+		log.Printf("invite %s not mailed: %v", inv.ID, err)
+		return
+	}
+	body := fmt.Sprintf("Hi,\n\nYou've been invited to join %s. Sign in as %s and use this code to accept: %s\n\nIt expires in %d days.\n",
+		o.Name, inv.Email, raw, int(inviteTTL.Hours()/24))
+	if err := h.sender.Send(ctx, inv.Email, "You're invited to join "+o.Name, body); err != nil {
+		log.Printf("invite %s send failed: %v", inv.ID, err)
+	}
+}
+
+// AcceptInvite spends an invite addressed to the caller's email and makes
+// them a member.
+func (h *Handler) AcceptInvite(ctx context.Context, req *pb.AcceptInviteRequest) (*pb.AcceptInviteResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Token == "" {
+		return nil, validate.Field("token", i18n.Required)
+	}
+	if err := h.require(store.FeatureOrganizations); err != nil {
+		return nil, err
+	}
+	u, err := h.store.UserByID(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	m, err := h.store.AcceptOrgInvite(ctx, auth.HashToken(req.Token), userID, u.Email)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, apperr.New(apperr.OrgInviteInvalid, "invalid or expired invite")
+	case errors.Is(err, store.ErrInOrg):
+		return nil, apperr.New(apperr.OrgAlreadyMember, "already in an organization")
+	case err != nil:
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	o, err := h.store.Organization(ctx, m.OrgID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.AcceptInviteResponse{Organization: orgProto(o, m.Role)}, nil
+}
+
+func (h *Handler) ListMembers(ctx context.Context, req *pb.ListMembersRequest) (*pb.ListMembersResponse, error) {
+	m, err := h.membership(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := h.store.OrgMembers(ctx, m.OrgID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListMembersResponse{}
+	for i := range ms {
+		resp.Members = append(resp.Members, orgMemberProto(&ms[i]))
+	}
+	return resp, nil
+}
+
+// LeaveOrganization takes the caller out; from then on neither they nor
+// the others see each other's appointments.
+func (h *Handler) LeaveOrganization(ctx context.Context, req *pb.LeaveOrganizationRequest) (*pb.LeaveOrganizationResponse, error) {
+	m, err := h.membership(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.store.LeaveOrganization(ctx, m.OrgID, m.UserID); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.OrgNotFound, "organization not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.LeaveOrganizationResponse{}, nil
+}
+
+// ListOrgAppointments pages through the appointments of the caller's
+// organization like ListAppointments does through theirs. It's a view:
+// changing any of them still takes being its owner.
+func (h *Handler) ListOrgAppointments(ctx context.Context, req *pb.ListOrgAppointmentsRequest) (*pb.ListOrgAppointmentsResponse, error) {
+	m, err := h.membership(ctx, req.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if req.MemberId != "" {
+		if _, err := uuid.Parse(req.MemberId); err != nil {
+			return nil, validate.Field("member_id", i18n.UUID)
+		}
+	}
+	from, to, err := h.listRange(&pb.ListAppointmentsRequest{RangeStart: req.RangeStart, RangeEnd: req.RangeEnd})
+	if err != nil {
+		return nil, err
+	}
+	if req.PageSize < 0 || req.PageSize > maxPageSize {
+		return nil, validate.Field("page_size", i18n.Between, 0, maxPageSize)
+	}
+	statuses, err := listStatuses(req.Statuses)
+	if err != nil {
+		return nil, err
+	}
+	p := store.ListParams{From: from, To: to, Statuses: statuses, Now: h.now()}
+	if req.PageToken != "" {
+		if p.AfterStart, p.AfterID, err = decodePageToken(req.PageToken); err != nil {
+			return nil, apperr.New(apperr.BadPageToken, "bad page_token")
+		}
+	}
+	if req.PageSize > 0 {
+		p.Limit = int(req.PageSize) + 1
+	}
+
+	apts, err := h.store.OrgAppointments(ctx, m.OrgID, req.MemberId, p)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListOrgAppointmentsResponse{
+		EffectiveRangeStart: timestamppb.New(from),
+		EffectiveRangeEnd:   timestamppb.New(to),
+	}
+	if resp.Appointments, resp.NextPageToken, resp.Truncated, err = h.page(ctx, apts, req.PageSize, m.UserID); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// membership is the caller's place in orgID. Anyone not in it gets
+// OrgNotFound, the same as for an organization that doesn't exist.
+func (h *Handler) membership(ctx context.Context, orgID string) (*model.OrgMember, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureOrganizations); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, apperr.New(apperr.OrgNotFound, "organization not found")
+	}
+	m, err := h.store.OrgMembership(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && m.OrgID != orgID) {
+		return nil, apperr.New(apperr.OrgNotFound, "organization not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return m, nil
+}
+
+// cancelForOrg is DeleteAppointment for an owner of the organization
+// appointment id was booked in, cancelling a member's. It reports false
+// when the caller isn't that, owner being whose appointment they'd
+// otherwise change, and DeleteAppointment goes on as for their own.
+func (h *Handler) cancelForOrg(ctx context.Context, id, owner string) (bool, error) {
+	me, err := uid(ctx)
+	if err != nil || owner != me || !h.store.Has(store.FeatureOrganizations) {
+		return false, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+	owner, err = h.store.CancelOrgAppointment(ctx, id, me)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, owner)
+	return true, nil
+}
+
+func orgProto(o *model.Organization, role string) *pb.Organization {
+	return &pb.Organization{Id: o.ID, Name: o.Name, Role: role, CreatedAt: timestamppb.New(o.CreatedAt)}
+}
+
+func orgMemberProto(m *model.OrgMember) *pb.OrgMember {
+	return &pb.OrgMember{
+		UserId:   m.UserID,
+		Name:     m.Name,
+		Email:    m.Email,
+		Role:     m.Role,
+		JoinedAt: timestamppb.New(m.JoinedAt),
+	}
+}
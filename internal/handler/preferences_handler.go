@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+// four hours either side is already more gap than meeting
+const maxBufferMinutes = 240
+
+func (h *Handler) GetPreferences(ctx context.Context, req *pb.GetPreferencesRequest) (*pb.GetPreferencesResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeaturePreferences); err != nil {
+		return nil, err
+	}
+	p, err := h.store.Preferences(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.GetPreferencesResponse{Preferences: preferencesProto(p)}, nil
+}
+
+// UpdatePreferences replaces the caller's preferences. Nothing already
+// booked is checked against a new buffer; only creates and moves from now
+// on are.
+func (h *Handler) UpdatePreferences(ctx context.Context, req *pb.UpdatePreferencesRequest) (*pb.UpdatePreferencesResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in := req.Preferences
+	if in == nil {
+		in = &pb.Preferences{}
+	}
+	if in.BufferMinutes < 0 || in.BufferMinutes > maxBufferMinutes {
+		return nil, validate.Field("preferences.buffer_minutes", i18n.Between, 0, maxBufferMinutes)
+	}
+	if err := h.require(store.FeaturePreferences); err != nil {
+		return nil, err
+	}
+	p := &model.Preferences{UserID: userID, BufferMinutes: int(in.BufferMinutes)}
+	if err := h.store.SetPreferences(ctx, p); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.UpdatePreferencesResponse{Preferences: preferencesProto(p)}, nil
+}
+
+// buffer is the gap userID keeps around their appointments; 0 without
+// the table.
+func (h *Handler) buffer(ctx context.Context, userID string) (time.Duration, error) {
+	if !h.store.Has(store.FeaturePreferences) {
+		return 0, nil
+	}
+	p, err := h.store.Preferences(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(p.BufferMinutes) * time.Minute, nil
+}
+
+// checkBuffer refuses [start, end) for userID if it comes within their
+// buffer of another of their confirmed timed appointments, other than
+// excludeID. An outright overlap passes: that's APPT_CONFLICT. It only
+// gives a batch its per-entry errors ahead of the write; the store's check
+// in the write's transaction is what holds.
+func (h *Handler) checkBuffer(ctx context.Context, userID, excludeID string, start, end time.Time) error {
+	buf, err := h.buffer(ctx, userID)
+	if err != nil {
+		return apperr.New(apperr.Internal, "internal error")
+	}
+	if buf == 0 {
+		return nil
+	}
+	if dup, err := h.store.HasOverlap(ctx, userID, start, end, false, excludeID); err != nil {
+		return apperr.New(apperr.Internal, "internal error")
+	} else if dup {
+		return nil
+	}
+	if near, err := h.store.HasOverlap(ctx, userID, start.Add(-buf), end.Add(buf), false, excludeID); err != nil {
+		return apperr.New(apperr.Internal, "internal error")
+	} else if !near {
+		return nil
+	}
+	return h.bufferConflict(ctx, userID, excludeID, start, end, buf)
+}
+
+// bufferConflict is the APPT_BUFFER error for a write of [start, end) the
+// store refused with ErrBuffer, naming the appointments within buf of it
+// in a ConflictInfo.
+func (h *Handler) bufferConflict(ctx context.Context, userID, excludeID string, start, end time.Time, buf time.Duration) error {
+	st := apperr.Status(apperr.ApptBuffer, bufferMessage(buf, "another appointment"))
+	near, err := h.store.FindOverlaps(ctx, userID, start.Add(-buf), end.Add(buf), false, excludeID, maxConflicts)
+	if err != nil || len(near) == 0 {
+		return st.Err()
+	}
+	if withDetails, err := st.WithDetails(conflictInfo(near)); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func bufferMessage(buf time.Duration, what string) string {
+	return fmt.Sprintf("within your %d-minute buffer of %s", int(buf/time.Minute), what)
+}
+
+func preferencesProto(p *model.Preferences) *pb.Preferences {
+	out := &pb.Preferences{BufferMinutes: int32(p.BufferMinutes)}
+	if !p.UpdatedAt.IsZero() {
+		out.UpdatedAt = timestamppb.New(p.UpdatedAt)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/validate"
+)
+
+// matches users.name VARCHAR(100)
+const maxNameLen = 100
+
+func (h *Handler) GetProfile(ctx context.Context, req *pb.GetProfileRequest) (*pb.GetProfileResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := h.store.UserByID(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	return &pb.GetProfileResponse{Profile: toProfile(u)}, nil
+}
+
+func (h *Handler) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Email != "" {
+		return nil, apperr.New(apperr.AuthEmailImmutable, "email cannot be changed")
+	}
+	name := strings.TrimSpace(req.Name)
+	var v validate.Errors
+	if v.Required("name", name) {
+		v.MaxLen("name", name, maxNameLen)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	u, err := h.store.UserByID(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	u.Name = name
+	if err := h.store.UpdateUser(ctx, u); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.UpdateProfileResponse{Profile: toProfile(u)}, nil
+}
+
+func toProfile(u *model.User) *pb.Profile {
+	p := &pb.Profile{Id: u.ID, Email: u.Email, Name: u.Name, Role: u.Role, OrgId: u.OrgID}
+	if !u.CreatedAt.IsZero() {
+		p.CreatedAt = timestamppb.New(u.CreatedAt)
+	}
+	return p
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+// maxRescheduleReasonLen caps RescheduleAppointmentRequest.reason.
+const maxRescheduleReasonLen = 500
+
+// RescheduleAppointment moves an appointment to new times. It's checked
+// like an UpdateAppointment of start_time and end_time, and the store keeps
+// the times it had in its reschedule history.
+func (h *Handler) RescheduleAppointment(ctx context.Context, req *pb.RescheduleAppointmentRequest) (*pb.RescheduleAppointmentResponse, error) {
+	var v validate.Errors
+	v.Required("id", req.Id)
+	h.checkAppointmentFields(&v, fieldSet{"start_time", "end_time"}, "", "", "", req.StartTime, req.EndTime)
+	reason := h.cleanText(req.Reason)
+	v.MaxLen("reason", reason, maxRescheduleReasonLen)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	me, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := h.ownerFor(ctx, req.Id, "RescheduleAppointment")
+	if err != nil {
+		return nil, err
+	}
+	start, end := req.StartTime.AsTime(), req.EndTime.AsTime()
+
+	old, err := h.store.GetAppointment(ctx, req.Id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && old.UserID != userID) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	// an all-day event moves by whole days
+	if old.AllDay {
+		checkAllDay(&v, dayZone(old.TimeZone), start, end)
+		if err := v.Err(); err != nil {
+			return nil, err
+		}
+	}
+	// staying put isn't a move into a freeze or out of hours; the store
+	// leaves it alone
+	var buf time.Duration
+	if !old.StartTime.Equal(start) || !old.EndTime.Equal(end) {
+		err := h.checkFreeze(ctx, start, end)
+		if err == nil && !old.AllDay {
+			err = h.checkAvailability(ctx, userID, start, end)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !old.AllDay {
+			if buf, err = h.buffer(ctx, userID); err != nil {
+				return nil, apperr.New(apperr.Internal, "internal error")
+			}
+		}
+	}
+
+	apt, err := h.store.RescheduleAppointment(ctx, req.Id, userID, me, start, end, buf, reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	} else if errors.Is(err, store.ErrCancelled) {
+		return nil, apperr.New(apperr.ApptCancelled, "a cancelled appointment can't be rescheduled")
+	} else if errors.Is(err, store.ErrConflict) {
+		h.metrics.Conflict()
+		return nil, h.rescheduleConflict(ctx, userID, req.Id, slots.Interval{Start: start, End: end}, old.AllDay)
+	} else if errors.Is(err, store.ErrBuffer) {
+		return nil, h.bufferConflict(ctx, userID, req.Id, start, end, buf)
+	} else if errors.Is(err, store.ErrEmptyRange) {
+		return nil, emptyRange()
+	} else if rerr := resourceErr(err); rerr != nil {
+		return nil, rerr
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.listChanged(ctx, userID)
+	return &pb.RescheduleAppointmentResponse{Appointment: toProto(apt)}, nil
+}
+
+// GetRescheduleHistory lists how one of the caller's appointments was
+// rescheduled, oldest first.
+func (h *Handler) GetRescheduleHistory(ctx context.Context, req *pb.GetRescheduleHistoryRequest) (*pb.GetRescheduleHistoryResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureReschedules); err != nil {
+		return nil, err
+	}
+	if req.AppointmentId == "" {
+		return nil, validate.Field("appointment_id", i18n.Required)
+	}
+	if _, err := uuid.Parse(req.AppointmentId); err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	// same 404 for missing and not-yours
+	apt, err := h.store.GetAppointment(ctx, req.AppointmentId)
+	if err != nil || apt.UserID != userID {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	entries, err := h.store.RescheduleHistory(ctx, apt.ID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.GetRescheduleHistoryResponse{}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.RescheduleEntry{
+			OldStart:      timestamppb.New(e.OldStart),
+			OldEnd:        timestamppb.New(e.OldEnd),
+			NewStart:      timestamppb.New(e.NewStart),
+			NewEnd:        timestamppb.New(e.NewEnd),
+			RescheduledBy: e.RescheduledBy,
+			Reason:        e.Reason,
+			RescheduledAt: timestamppb.New(e.RescheduledAt),
+		})
+	}
+	return resp, nil
+}
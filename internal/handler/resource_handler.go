@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	maxResourceName        = 100
+	maxResourceDescription = 500
+	// longest range GetResourceAvailability answers for
+	maxAvailabilitySpan = 31 * 24 * time.Hour
+)
+
+// checkResourceID is checkCalendarID for resources: the store still has to
+// find it.
+func (h *Handler) checkResourceID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if err := h.require(store.FeatureResources); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return apperr.New(apperr.ResourceNotFound, "resource not found")
+	}
+	return nil
+}
+
+// resourceErr is the error for a store failure about a resource, nil if
+// err isn't one.
+func resourceErr(err error) error {
+	switch {
+	case errors.Is(err, store.ErrResourceBooked):
+		return apperr.New(apperr.ResourceBooked, "resource already booked for that time")
+	case errors.Is(err, store.ErrUnknownResource):
+		return apperr.New(apperr.ResourceNotFound, "resource not found")
+	}
+	return nil
+}
+
+// CreateResource adds a room or piece of equipment anyone can book.
+func (h *Handler) CreateResource(ctx context.Context, req *pb.CreateResourceRequest) (*pb.CreateResourceResponse, error) {
+	actor, err := h.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureResources); err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	if v.Required("name", req.Name) {
+		v.MaxLen("name", req.Name, maxResourceName)
+	}
+	v.MaxLen("description", req.Description, maxResourceDescription)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	r := &model.Resource{Name: req.Name, Description: req.Description}
+	if err := h.store.CreateResource(ctx, r); errors.Is(err, store.ErrResourceExists) {
+		return nil, apperr.New(apperr.ResourceExists, err.Error())
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	h.adminAudit(ctx, actor, "CreateResource", map[string]any{"id": r.ID, "name": r.Name})
+	return &pb.CreateResourceResponse{Resource: resourceProto(r)}, nil
+}
+
+func (h *Handler) ListResources(ctx context.Context, req *pb.ListResourcesRequest) (*pb.ListResourcesResponse, error) {
+	if err := h.require(store.FeatureResources); err != nil {
+		return nil, err
+	}
+	rs, err := h.store.Resources(ctx)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListResourcesResponse{}
+	for i := range rs {
+		resp.Resources = append(resp.Resources, resourceProto(&rs[i]))
+	}
+	return resp, nil
+}
+
+// GetResourceAvailability lists when a resource is taken in a range. The
+// bookings belong to anyone, so only their times are given.
+func (h *Handler) GetResourceAvailability(ctx context.Context, req *pb.GetResourceAvailabilityRequest) (*pb.GetResourceAvailabilityResponse, error) {
+	if err := h.require(store.FeatureResources); err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	v.Required("resource_id", req.ResourceId)
+	if req.StartTime == nil {
+		v.Add("start_time", i18n.Required)
+	}
+	if req.EndTime == nil {
+		v.Add("end_time", i18n.Required)
+	} else if req.StartTime != nil {
+		if span := req.EndTime.AsTime().Sub(req.StartTime.AsTime()); span <= 0 {
+			v.AddReason(apperr.ApptEmptyRange, "end_time", i18n.After, "start_time")
+		} else if span > maxAvailabilitySpan {
+			v.AddReason(apperr.ListRangeInvalid, "end_time", i18n.AtMostDaysAfter, int(maxAvailabilitySpan.Hours()/24), "start_time")
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := h.checkResourceID(req.ResourceId); err != nil {
+		return nil, err
+	}
+
+	r, err := h.store.Resource(ctx, req.ResourceId)
+	if rerr := resourceErr(err); rerr != nil {
+		return nil, rerr
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	busy, err := h.store.ResourceBusy(ctx, r.ID, slots.Interval{Start: req.StartTime.AsTime(), End: req.EndTime.AsTime()})
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.GetResourceAvailabilityResponse{Resource: resourceProto(r)}
+	for _, b := range busy {
+		resp.Busy = append(resp.Busy, &pb.BusySlot{StartTime: timestamppb.New(b.Start), EndTime: timestamppb.New(b.End)})
+	}
+	return resp, nil
+}
+
+func resourceProto(r *model.Resource) *pb.Resource {
+	return &pb.Resource{Id: r.ID, Name: r.Name, Description: r.Description}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/middleware"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+// how much of a User-Agent is kept with a session
+const maxUserAgent = 256
+
+// ListSessions shows the caller's live refresh tokens, marking the one
+// their access token came with.
+func (h *Handler) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := h.store.ListRefreshTokensByUser(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	current, _ := ctx.Value(middleware.SessionKey).(string)
+	resp := &pb.ListSessionsResponse{}
+	for _, t := range tokens {
+		resp.Sessions = append(resp.Sessions, &pb.Session{
+			Id:        t.ID,
+			UserAgent: t.UserAgent,
+			Ip:        t.IP,
+			CreatedAt: timestamppb.New(t.CreatedAt),
+			ExpiresAt: timestamppb.New(t.ExpiresAt),
+			Current:   current != "" && t.ID == current,
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession ends one of the caller's sessions. Someone else's id is
+// NotFound, same as one that doesn't exist.
+func (h *Handler) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, validate.Field("id", i18n.Required)
+	}
+	if err := h.store.RevokeRefreshToken(ctx, req.Id, userID); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.NotFound, "session not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.RevokeSessionResponse{}, nil
+}
+
+// RevokeAllSessions logs the caller out everywhere, here included.
+func (h *Handler) RevokeAllSessions(ctx context.Context, req *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.store.RevokeAllRefreshTokens(ctx, userID); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.RevokeAllSessionsResponse{}, nil
+}
+
+// sessionClient is who a new refresh token goes to: the browser's user
+// agent when the call came through the bridge, the grpc client's
+// otherwise, and the peer address.
+func sessionClient(ctx context.Context) store.SessionInfo {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ua := ""
+	for _, k := range []string{"x-forwarded-user-agent", "user-agent"} {
+		if v := md.Get(k); len(v) > 0 && v[0] != "" {
+			ua = v[0]
+			break
+		}
+	}
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	ip := middleware.ClientIP(ctx)
+	if ip == "unknown" {
+		ip = ""
+	}
+	return store.SessionInfo{UserAgent: strings.ToValidUTF8(ua, ""), IP: ip}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 90 * 24 * time.Hour
+)
+
+// SharedAppointment is everything a share link exposes. The owner and
+// attendee IDs never leave through it; attendee names and the description
+// only when the link was created with the matching flag.
+type SharedAppointment struct {
+	Title       string    `json:"title"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Location    string    `json:"location,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Attendees   []string  `json:"attendees,omitempty"`
+	Cancelled   bool      `json:"cancelled,omitempty"`
+	AllDay      bool      `json:"all_day,omitempty"`
+	TimeZone    string    `json:"time_zone,omitempty"`
+}
+
+func (h *Handler) CreateShareLink(ctx context.Context, req *pb.CreateShareLinkRequest) (*pb.CreateShareLinkResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.AppointmentId == "" {
+		return nil, validate.Field("appointment_id", i18n.Required)
+	}
+	if err := h.require(store.FeatureShareLinks); err != nil {
+		return nil, err
+	}
+	// checked in seconds: a huge ttl_seconds would wrap as a Duration
+	if req.TtlSeconds < 0 || req.TtlSeconds > int64(maxShareTTL/time.Second) {
+		return nil, validate.Field("ttl_seconds", i18n.BetweenDays, 0, int(maxShareTTL.Hours()/24))
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	if ttl == 0 {
+		ttl = h.shareTTL
+	}
+
+	apt, err := h.store.GetAppointment(ctx, req.AppointmentId)
+	if err != nil || apt.UserID != userID {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	raw, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	l := &model.ShareLink{
+		ID:                 uuid.New().String(),
+		AppointmentID:      apt.ID,
+		TokenHash:          hash,
+		IncludeDescription: req.IncludeDescription,
+		IncludeAttendees:   req.IncludeAttendees,
+		ExpiresAt:          h.now().Add(ttl),
+	}
+	if err := h.store.CreateShareLink(ctx, l); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+
+	return &pb.CreateShareLinkResponse{
+		Id:        l.ID,
+		Url:       h.publicURL + "/share/" + raw,
+		ExpiresAt: timestamppb.New(l.ExpiresAt),
+	}, nil
+}
+
+func (h *Handler) RevokeShareLink(ctx context.Context, req *pb.RevokeShareLinkRequest) (*pb.RevokeShareLinkResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, validate.Field("id", i18n.Required)
+	}
+	if err := h.require(store.FeatureShareLinks); err != nil {
+		return nil, err
+	}
+	if err := h.store.RevokeShareLink(ctx, req.Id, userID); errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.RevokeShareLinkResponse{}, nil
+}
+
+// GetSharedAppointment is ResolveShareLink over grpc, for clients that
+// render the view themselves.
+func (h *Handler) GetSharedAppointment(ctx context.Context, req *pb.GetSharedAppointmentRequest) (*pb.GetSharedAppointmentResponse, error) {
+	sa, err := h.ResolveShareLink(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	v := &pb.SharedAppointment{
+		Title:         sa.Title,
+		Location:      sa.Location,
+		Description:   sa.Description,
+		AttendeeNames: sa.Attendees,
+		Cancelled:     sa.Cancelled,
+		AllDay:        sa.AllDay,
+		TimeZone:      sa.TimeZone,
+	}
+	if !sa.Cancelled {
+		v.StartTime, v.EndTime = timestamppb.New(sa.Start), timestamppb.New(sa.End)
+	}
+	return &pb.GetSharedAppointmentResponse{Appointment: v}, nil
+}
+
+// ResolveShareLink backs the public GET /share/{token} route and
+// GetSharedAppointment. Unknown, expired and revoked tokens all look the
+// same: NotFound.
+func (h *Handler) ResolveShareLink(ctx context.Context, token string) (*SharedAppointment, error) {
+	if token == "" || !h.store.Has(store.FeatureShareLinks) {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	l, err := h.store.ActiveShareLink(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+	apt, err := h.store.GetAppointment(ctx, l.AppointmentID)
+	if err != nil {
+		return nil, apperr.New(apperr.NotFound, "not found")
+	}
+
+	if apt.Status == "cancelled" {
+		return &SharedAppointment{Title: apt.Title, Cancelled: true}, nil
+	}
+	v := &SharedAppointment{
+		Title:    apt.Title,
+		Start:    apt.StartTime,
+		End:      apt.EndTime,
+		Location: apt.Location,
+		AllDay:   apt.AllDay,
+		TimeZone: apt.TimeZone,
+	}
+	if l.IncludeDescription {
+		v.Description = apt.Description
+	}
+	if l.IncludeAttendees && h.store.Has(store.FeatureAttendees) {
+		for _, id := range apt.AttendeeIDs {
+			if u, err := h.store.UserByID(ctx, id); err == nil {
+				v.Attendees = append(v.Attendees, u.Name)
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+)
+
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 20
+	// longest slot SuggestSlots looks for
+	maxSuggestMinutes = 24 * 60
+)
+
+// SuggestSlots walks the gaps between the caller's confirmed appointments
+// (and any freeze windows) in Go, after one query for what's busy in the
+// range.
+func (h *Handler) SuggestSlots(ctx context.Context, req *pb.SuggestSlotsRequest) (*pb.SuggestSlotsResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	length := time.Duration(req.DurationMinutes) * time.Minute
+	switch {
+	case req.DurationMinutes <= 0:
+		v.Add("duration_minutes", i18n.Required)
+	case req.DurationMinutes > maxSuggestMinutes:
+		v.Add("duration_minutes", i18n.AtMostADay)
+	}
+	// "now" gets a little notice; a later earliest_start is taken as given
+	from := slots.Earliest(h.now())
+	if req.EarliestStart != nil && req.EarliestStart.AsTime().After(from) {
+		from = req.EarliestStart.AsTime()
+	}
+	to := from.Add(slots.MaxWindow)
+	if req.LatestEnd != nil {
+		to = req.LatestEnd.AsTime()
+		if span := to.Sub(from); span <= 0 {
+			v.AddReason(apperr.ListRangeInvalid, "latest_end", i18n.After, "earliest_start")
+		} else if span > maxAvailabilitySpan {
+			v.AddReason(apperr.ListRangeInvalid, "latest_end", i18n.AtMostDaysAfter, int(maxAvailabilitySpan.Hours()/24), "earliest_start")
+		}
+	}
+	hours := workingHours(&v, req.WorkingHours)
+	if hours != nil && length > hours.Close-hours.Open {
+		v.Add("duration_minutes", i18n.LongerThanHours)
+	}
+	n := int(req.MaxResults)
+	switch {
+	case n == 0:
+		n = defaultSuggestions
+	case n < 0 || n > maxSuggestions:
+		v.Add("max_results", i18n.Between, 0, maxSuggestions)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	busy, err := h.unbookable(ctx, userID, slots.Interval{Start: from, End: to})
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.SuggestSlotsResponse{}
+	for _, iv := range slots.Free(busy, from, to, length, hours, n) {
+		resp.Slots = append(resp.Slots, suggestedSlot(slots.NextFree, iv))
+	}
+	return resp, nil
+}
+
+// CheckAvailability runs FindOverlaps, the query the overlap checks on
+// create and update use, which tests ranges the way no_time_overlap does.
+// The range is for a timed appointment: all-day events don't take it.
+func (h *Handler) CheckAvailability(ctx context.Context, req *pb.CheckAvailabilityRequest) (*pb.CheckAvailabilityResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	h.checkAppointmentFields(&v, fieldSet{"start_time", "end_time"}, "", "", "", req.StartTime, req.EndTime)
+	if req.ExcludeAppointmentId != "" {
+		if _, err := uuid.Parse(req.ExcludeAppointmentId); err != nil {
+			v.Add("exclude_appointment_id", i18n.UUID)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	in, err := h.store.FindOverlaps(ctx, userID, req.StartTime.AsTime(), req.EndTime.AsTime(), false, req.ExcludeAppointmentId, maxConflicts)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	if len(in) == 0 {
+		return &pb.CheckAvailabilityResponse{Available: true}, nil
+	}
+	return &pb.CheckAvailabilityResponse{Conflicts: conflictInfo(in).Appointments}, nil
+}
+
+// unbookable is everything in w a suggestion for userID has to miss: their
+// confirmed appointments widened by their buffer, freeze windows (a slot
+// there would only fail on create) and hours outside their availability,
+// enforced or not.
+func (h *Handler) unbookable(ctx context.Context, userID string, w slots.Interval) ([]slots.Interval, error) {
+	buf, err := h.buffer(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := h.store.BusyIntervals(ctx, userID, slots.Interval{Start: w.Start.Add(-buf), End: w.End.Add(buf)}, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range busy {
+		busy[i].Start, busy[i].End = busy[i].Start.Add(-buf), busy[i].End.Add(buf)
+	}
+	if h.store.Has(store.FeatureFreezeWindows) {
+		frozen, err := h.store.FreezeWindows(ctx, w.Start)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range frozen {
+			busy = append(busy, slots.Interval{Start: f.Start, End: f.End})
+		}
+	}
+	weekly, _, err := h.availability(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if weekly != nil {
+		busy = append(busy, weekly.Closed(w.Start, w.End)...)
+	}
+	return busy, nil
+}
+
+// workingHours checks req and turns it into slots.Hours; nil if unset or
+// invalid.
+func workingHours(v *validate.Errors, req *pb.WorkingHours) *slots.Hours {
+	if req == nil {
+		return nil
+	}
+	open := clockTime(v, "working_hours.start", req.Start)
+	closing := clockTime(v, "working_hours.end", req.End)
+	if open >= 0 && closing >= 0 && closing <= open {
+		v.Add("working_hours.end", i18n.After, "working_hours.start")
+	}
+	loc := timeZone(v, "working_hours.time_zone", req.TimeZone)
+	if v.Err() != nil {
+		return nil
+	}
+	return &slots.Hours{Open: open, Close: closing, Loc: loc}
+}
+
+// clockTime reads "HH:MM" as time since midnight; -1 if it isn't.
+func clockTime(v *validate.Errors, field, s string) time.Duration {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		v.Add(field, i18n.ClockTime)
+		return -1
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// timeZone loads an IANA name, "" being UTC. "Local" is refused: it's
+// wherever the server happens to run.
+func timeZone(v *validate.Errors, field, tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		v.Add(field, i18n.TimeZone)
+		return nil
+	}
+	return loc
+}
+
+func suggestedSlot(kind string, iv slots.Interval) *pb.SuggestedSlot {
+	return &pb.SuggestedSlot{
+		Kind:      kind,
+		StartTime: timestamppb.New(iv.Start),
+		EndTime:   timestamppb.New(iv.End),
+	}
+}
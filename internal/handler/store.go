@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+)
+
+// Store is everything the handler needs from persistence. *store.Store is
+// the Postgres one; memstore keeps it in memory for tests. The methods of
+// a feature Has reports missing aren't called. Errors are store.Store's:
+// pgx.ErrNoRows for a missing row, the store.Err* values for the
+// conflicts the handler maps to a reason.
+type Store interface {
+	Has(feature string) bool
+	Stat() *pgxpool.Stat // nil if there's no pool
+	Stats(ctx context.Context) (*store.Stats, error)
+
+	// users
+	CreateUser(ctx context.Context, u *model.User) error
+	UserByEmail(ctx context.Context, email string) (*model.User, error)
+	UserByID(ctx context.Context, id string) (*model.User, error)
+	UsersByIDs(ctx context.Context, ids []string) (map[string]model.User, error)
+	ListUsers(ctx context.Context, afterEmail string, limit int) ([]model.User, error)
+	UpdateUser(ctx context.Context, u *model.User) error
+	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	SoftDeleteUser(ctx context.Context, userID string) error
+
+	// sessions and login
+	CreateRefreshToken(ctx context.Context, userID string, hash auth.VersionedHash, expiresAt time.Time, client store.SessionInfo) (string, error)
+	FindRefreshToken(ctx context.Context, cands []auth.VersionedHash) (*store.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID, newID, userID string, newHash auth.VersionedHash, newExpiry time.Time, client store.SessionInfo) error
+	RevokeAllRefreshTokens(ctx context.Context, userID string) error
+	ListRefreshTokensByUser(ctx context.Context, userID string) ([]store.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id, userID string) error
+	LoginLockedUntil(ctx context.Context, email string) (time.Time, error)
+	RecordLoginFailure(ctx context.Context, email string, max int, window time.Duration) (time.Time, error)
+	ResetLoginFailures(ctx context.Context, email string) error
+	CreatePasswordResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error)
+	CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (string, error)
+	ResendEmailVerificationToken(ctx context.Context, email, tokenHash string, sentAt, expiresAt time.Time, cooldown time.Duration) (*model.User, error)
+
+	// appointments
+	CreateAppointment(ctx context.Context, a *model.Appointment) error
+	CreateAppointments(ctx context.Context, apts []*model.Appointment) error
+	CreateAppointmentWithKey(ctx context.Context, a *model.Appointment, key, hash string) (*model.Appointment, error)
+	IdempotentAppointment(ctx context.Context, userID, key, hash string) (*model.Appointment, error)
+	GetAppointment(ctx context.Context, id string) (*model.Appointment, error)
+	ListAppointments(ctx context.Context, userID string, p store.ListParams) ([]model.Appointment, error)
+	UpcomingAppointments(ctx context.Context, userID string, now time.Time, limit int) ([]model.Appointment, error)
+	CountAppointments(ctx context.Context, userID string, p store.ListParams) (int, error)
+	SearchAppointments(ctx context.Context, p store.SearchParams) ([]store.SearchResult, error)
+	UpdateAppointment(ctx context.Context, a *model.Appointment, fields []string) error
+	DeleteAppointment(ctx context.Context, id, userID string) error
+	ActivateAppointment(ctx context.Context, id, userID string) (*model.Appointment, error)
+	JoinAppointment(ctx context.Context, id, userID string) (*model.Appointment, error)
+	LeaveAppointment(ctx context.Context, id, userID string) error
+	AppointmentHistory(ctx context.Context, appointmentID string, afterID int64, limit int) ([]store.AuditEntry, error)
+	RescheduleAppointment(ctx context.Context, id, ownerID, actorID string, start, end time.Time, buf time.Duration, reason string) (*model.Appointment, error)
+	RescheduleHistory(ctx context.Context, appointmentID string) ([]model.Reschedule, error)
+	AllAppointments(ctx context.Context, userID string, afterStart time.Time, afterID string, limit int) ([]model.Appointment, error)
+	Attending(ctx context.Context, userID string) ([]store.Attendance, error)
+	ScheduleSummary(ctx context.Context, userID string, from, to time.Time, unit, tz string) ([]store.SummaryBucket, int, time.Duration, error)
+
+	// free and busy time; allDay picks which kind of appointment the
+	// overlaps are looked for among
+	HasOverlap(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string) (bool, error)
+	FindOverlaps(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string, limit int) ([]model.Appointment, error)
+	AllDayConflicts() bool
+	BusyIntervals(ctx context.Context, userID string, w slots.Interval, excludeID string) ([]slots.Interval, error)
+	Availability(ctx context.Context, userID string) (*model.Availability, error)
+	SetAvailability(ctx context.Context, a *model.Availability) error
+	Preferences(ctx context.Context, userID string) (*model.Preferences, error)
+	SetPreferences(ctx context.Context, p *model.Preferences) error
+	BumpScheduleVersion(ctx context.Context, userID string) (int64, error)
+	ScheduleVersion(ctx context.Context, userID string) (int64, error)
+	FreezeWindows(ctx context.Context, since time.Time) ([]model.FreezeWindow, error)
+	FreezeOverlapping(ctx context.Context, start, end time.Time) (*model.FreezeWindow, error)
+	CreateFreezeWindow(ctx context.Context, w *model.FreezeWindow) error
+	DeleteFreezeWindow(ctx context.Context, id string) error
+
+	// calendars and resources
+	Calendars(ctx context.Context, userID string) ([]model.Calendar, error)
+	CreateCalendar(ctx context.Context, c *model.Calendar) error
+	UpdateCalendar(ctx context.Context, c *model.Calendar, makeDefault bool) error
+	DeleteCalendar(ctx context.Context, id, userID string) error
+	Resource(ctx context.Context, id string) (*model.Resource, error)
+	Resources(ctx context.Context) ([]model.Resource, error)
+	CreateResource(ctx context.Context, r *model.Resource) error
+	CheckResource(ctx context.Context, resourceID string, start, end time.Time, excludeID string) error
+	ResourceBusy(ctx context.Context, resourceID string, w slots.Interval) ([]slots.Interval, error)
+
+	// share links, webhooks, admin audit
+	CreateShareLink(ctx context.Context, l *model.ShareLink) error
+	ActiveShareLink(ctx context.Context, tokenHash string) (*model.ShareLink, error)
+	RevokeShareLink(ctx context.Context, id, userID string) error
+	Webhooks(ctx context.Context, userID string) ([]model.Webhook, error)
+	CreateWebhook(ctx context.Context, w *model.Webhook, max int) error
+	SetWebhookEnabled(ctx context.Context, id, userID string, enabled bool) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id, userID string) error
+	AppendAdminAudit(ctx context.Context, actorID, action string, params any) error
+
+	// organizations
+	CreateOrganization(ctx context.Context, o *model.Organization) error
+	Organization(ctx context.Context, id string) (*model.Organization, error)
+	OrgMembership(ctx context.Context, userID string) (*model.OrgMember, error)
+	OrgMembers(ctx context.Context, orgID string) ([]model.OrgMember, error)
+	CreateOrgInvite(ctx context.Context, inv *model.OrgInvite) error
+	AcceptOrgInvite(ctx context.Context, tokenHash, userID, email string) (*model.OrgMember, error)
+	LeaveOrganization(ctx context.Context, orgID, userID string) error
+	OrgAppointments(ctx context.Context, orgID, memberID string, p store.ListParams) ([]model.Appointment, error)
+	CancelOrgAppointment(ctx context.Context, id, actorID string) (string, error)
+}
+
+var _ Store = (*store.Store)(nil)
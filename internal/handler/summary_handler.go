@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/validate"
+)
+
+// longest range GetScheduleSummary answers for, a leap year included
+const maxSummarySpan = 366 * 24 * time.Hour
+
+// GetScheduleSummary gives the dashboard per-day or per-week counts and
+// booked minutes without listing the appointments.
+func (h *Handler) GetScheduleSummary(ctx context.Context, req *pb.GetScheduleSummaryRequest) (*pb.GetScheduleSummaryResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	if req.RangeStart == nil {
+		v.Add("range_start", i18n.Required)
+	}
+	if req.RangeEnd == nil {
+		v.Add("range_end", i18n.Required)
+	} else if req.RangeStart != nil {
+		if span := req.RangeEnd.AsTime().Sub(req.RangeStart.AsTime()); span <= 0 {
+			v.AddReason(apperr.ListRangeInvalid, "range_end", i18n.After, "range_start")
+		} else if span > maxSummarySpan {
+			v.AddReason(apperr.ListRangeInvalid, "range_end", i18n.AtMostYearAfter, "range_start")
+		}
+	}
+	unit := req.Granularity
+	switch unit {
+	case "":
+		unit = "day"
+	case "day", "week":
+	default:
+		v.Add("granularity", i18n.Granularity)
+	}
+	tz := req.TimeZone
+	if tz == "" {
+		tz = "UTC"
+	} else if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+		v.Add("time_zone", i18n.TimeZone)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	buckets, total, booked, err := h.store.ScheduleSummary(ctx, userID,
+		req.RangeStart.AsTime(), req.RangeEnd.AsTime(), unit, tz)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.GetScheduleSummaryResponse{
+		TotalAppointments:  int32(total),
+		TotalBookedMinutes: int64(booked.Round(time.Minute) / time.Minute),
+	}
+	for _, b := range buckets {
+		resp.Buckets = append(resp.Buckets, &pb.SummaryBucket{
+			StartTime:     timestamppb.New(b.Start),
+			EndTime:       timestamppb.New(b.End),
+			Appointments:  int32(b.Appointments),
+			BookedMinutes: int64(b.Booked.Round(time.Minute) / time.Minute),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/validate"
+	"schedule-management-api/internal/webhook"
+)
+
+const (
+	maxWebhookURL = 2000
+	// per user, so one account can't fan every change out without limit
+	maxWebhooks = 10
+)
+
+// RegisterWebhook adds a webhook for the caller's appointment changes. The
+// signing secret is generated here and returned this once. The URL's host
+// has to resolve to public addresses only, unless WithPrivateWebhooks.
+func (h *Handler) RegisterWebhook(ctx context.Context, req *pb.RegisterWebhookRequest) (*pb.RegisterWebhookResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureWebhooks); err != nil {
+		return nil, err
+	}
+	var v validate.Errors
+	if len(req.Url) > maxWebhookURL {
+		v.MaxLen("url", req.Url, maxWebhookURL)
+	} else if v.Required("url", req.Url) {
+		if u, err := url.Parse(req.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.Add("url", i18n.HTTPURL)
+		} else if !h.privateWebhooks && webhook.CheckHost(ctx, u.Hostname()) != nil {
+			// the dispatcher checks again when it dials
+			v.Add("url", i18n.PublicURL)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	w := &model.Webhook{UserID: userID, URL: req.Url, Secret: hex.EncodeToString(b)}
+	if err := h.store.CreateWebhook(ctx, w, maxWebhooks); errors.Is(err, store.ErrWebhookLimit) {
+		return nil, apperr.New(apperr.WebhookLimit, fmt.Sprintf("at most %d webhooks", maxWebhooks))
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.RegisterWebhookResponse{Webhook: webhookProto(w), Secret: w.Secret}, nil
+}
+
+func (h *Handler) ListWebhooks(ctx context.Context, req *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureWebhooks); err != nil {
+		return nil, err
+	}
+	ws, err := h.store.Webhooks(ctx, userID)
+	if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	resp := &pb.ListWebhooksResponse{}
+	for i := range ws {
+		resp.Webhooks = append(resp.Webhooks, webhookProto(&ws[i]))
+	}
+	return resp, nil
+}
+
+func (h *Handler) SetWebhookEnabled(ctx context.Context, req *pb.SetWebhookEnabledRequest) (*pb.SetWebhookEnabledResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureWebhooks); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.WebhookNotFound, "webhook not found")
+	}
+	w, err := h.store.SetWebhookEnabled(ctx, req.Id, userID, req.Enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.WebhookNotFound, "webhook not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.SetWebhookEnabledResponse{Webhook: webhookProto(w)}, nil
+}
+
+// DeleteWebhook removes a webhook; deliveries still queued for it are
+// dropped.
+func (h *Handler) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	userID, err := uid(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.require(store.FeatureWebhooks); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(req.Id); err != nil {
+		return nil, apperr.New(apperr.WebhookNotFound, "webhook not found")
+	}
+	err = h.store.DeleteWebhook(ctx, req.Id, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.New(apperr.WebhookNotFound, "webhook not found")
+	} else if err != nil {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	return &pb.DeleteWebhookResponse{}, nil
+}
+
+func webhookProto(w *model.Webhook) *pb.Webhook {
+	p := &pb.Webhook{
+		Id:         w.ID,
+		Url:        w.URL,
+		Enabled:    w.Enabled,
+		CreatedAt:  timestamppb.New(w.CreatedAt),
+		LastStatus: int32(w.LastStatus),
+		LastError:  w.LastError,
+	}
+	if w.LastAttemptAt != nil {
+		p.LastAttemptAt = timestamppb.New(*w.LastAttemptAt)
+	}
+	if w.LastSuccessAt != nil {
+		p.LastSuccessAt = timestamppb.New(*w.LastSuccessAt)
+	}
+	return p
+}
@@ -0,0 +1,128 @@
+// Package health backs the liveness/readiness probes: the standard
+// grpc.health.v1 service on the gRPC port and /healthz, /readyz on the web
+// port. Both report ready only while the database answers and the server
+// isn't draining.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 2 * time.Second
+)
+
+// Checker caches the result of the database ping for a couple of seconds
+// so probes from several sources don't each hit Postgres.
+type Checker struct {
+	healthpb.UnimplementedHealthServer
+
+	ping     func(context.Context) error
+	timeout  time.Duration
+	cacheTTL time.Duration
+	draining atomic.Bool
+
+	mu      sync.Mutex
+	checked time.Time
+	lastErr error
+}
+
+// New wraps ping, typically pgxpool.Pool.Ping.
+func New(ping func(context.Context) error) *Checker {
+	return &Checker{ping: ping, timeout: defaultTimeout, cacheTTL: defaultCacheTTL}
+}
+
+// WithTimings overrides the ping timeout and how long a result is reused.
+func (c *Checker) WithTimings(timeout, cacheTTL time.Duration) *Checker {
+	c.timeout, c.cacheTTL = timeout, cacheTTL
+	return c
+}
+
+// Shutdown flips readiness off for good; call it before GracefulStop so
+// load balancers stop sending traffic while in-flight calls finish.
+func (c *Checker) Shutdown() {
+	c.draining.Store(true)
+}
+
+// Ready reports nil when the server should receive traffic.
+func (c *Checker) Ready(ctx context.Context) error {
+	if c.draining.Load() {
+		return errDraining
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < c.cacheTTL {
+		return c.lastErr
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	c.lastErr = c.ping(ctx)
+	c.checked = time.Now()
+	return c.lastErr
+}
+
+var errDraining = status.Error(codes.Unavailable, "shutting down")
+
+func (c *Checker) servingStatus(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if c.Ready(ctx) != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// Check answers for the whole server ("") and for any service name; they
+// all share the one database.
+func (c *Checker) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return &healthpb.HealthCheckResponse{Status: c.servingStatus(ctx)}, nil
+}
+
+// Watch sends the current status and then every change, polling at the
+// cache interval.
+func (c *Checker) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	t := time.NewTicker(c.cacheTTL)
+	defer t.Stop()
+	for {
+		if s := c.servingStatus(ctx); s != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: s}); err != nil {
+				return err
+			}
+			last = s
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Liveness is /healthz: the process is up and serving HTTP. It deliberately
+// ignores the database so a Postgres blip doesn't get pods restarted.
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// Readiness is /readyz: 503 while the database is unreachable or the
+// server is draining.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Ready(r.Context()); err != nil {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func check(t *testing.T, c *Checker) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	return resp.Status
+}
+
+func probe(c *Checker) int {
+	rec := httptest.NewRecorder()
+	c.Readiness().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	return rec.Code
+}
+
+func TestServingAndCached(t *testing.T) {
+	var pings atomic.Int32
+	c := New(func(context.Context) error { pings.Add(1); return nil })
+
+	for i := 0; i < 5; i++ {
+		if s := check(t, c); s != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("expected SERVING, got %v", s)
+		}
+		if code := probe(c); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	}
+	if n := pings.Load(); n != 1 {
+		t.Errorf("expected one ping inside the cache window, got %d", n)
+	}
+}
+
+func TestDatabaseDown(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	c := New(func(context.Context) error {
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}).WithTimings(time.Second, 10*time.Millisecond)
+
+	if s := check(t, c); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected NOT_SERVING, got %v", s)
+	}
+	if code := probe(c); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+
+	down.Store(false)
+	time.Sleep(20 * time.Millisecond)
+	if s := check(t, c); s != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected recovery to SERVING, got %v", s)
+	}
+}
+
+// a hung database must not hang the probe
+func TestPingTimeout(t *testing.T) {
+	c := New(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}).WithTimings(20*time.Millisecond, time.Second)
+
+	start := time.Now()
+	if s := check(t, c); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected NOT_SERVING, got %v", s)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("probe took %s", d)
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	c := New(func(context.Context) error { return nil })
+	if s := check(t, c); s != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING, got %v", s)
+	}
+	c.Shutdown()
+	if s := check(t, c); s != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected NOT_SERVING while draining, got %v", s)
+	}
+	if code := probe(c); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", code)
+	}
+
+	// liveness stays up while draining
+	rec := httptest.NewRecorder()
+	c.Liveness().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected /healthz 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package i18n
+
+var en = map[Key]string{
+	Required:        "required",
+	MaxChars:        "at most %d characters",
+	MinChars:        "at least %d characters",
+	MaxBytes:        "at most %d bytes",
+	Email:           "not a valid email address",
+	UUID:            "must be a UUID",
+	NotNegative:     "must not be negative",
+	Between:         "between %d and %d",
+	BetweenDays:     "between %d and %d days",
+	After:           "must be after %s",
+	InPast:          "can't be in the past",
+	AtMostYearAfter: "at most a year after %s",
+	AtMostDaysAfter: "at most %d days after %s",
+	UnknownStatus:   "unknown status %q, want confirmed, cancelled, completed or all",
+	MaxTags:         "at most %d tags",
+	EmptyTag:        "no empty tags",
+	TagTooLong:      "%q: at most %d characters",
+	ClockTime:       `want "HH:MM"`,
+	TimeZone:        "not an IANA time zone name",
+	Weekday:         `want a day name, e.g. "monday"`,
+	HTTPURL:         "must be an absolute http or https URL",
+	PublicURL:       "must resolve to a public address",
+	UnknownField:    "unknown field %q",
+	NoFields:        "names no fields",
+	Granularity:     `want "day" or "week"`,
+	LongerThanHours: "longer than working_hours",
+	AtMostADay:      "at most a day",
+	Color:           "must be #rrggbb",
+	MaxWindows:      "at most %d windows",
+	OverCapacity:    "more than capacity",
+	Midnight:        "must be midnight in %s",
+	OrgRole:         `want "member" or "owner"`,
+
+	FrozenSlot:      "bookings are closed from %s to %s: %s",
+	ClosedDay:       "outside availability: no bookings on %s (%s)",
+	OutsideHours:    "outside availability: %s %s (%s)",
+	MessageTooLarge: "message larger than %d bytes",
+	BatchTooLarge:   "at most %d appointments per batch",
+	NotMigrated:     "server not migrated for %s",
+}
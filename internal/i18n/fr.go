@@ -0,0 +1,104 @@
+package i18n
+
+var fr = map[Key]string{
+	Required:        "obligatoire",
+	MaxChars:        "%d caractères au maximum",
+	MinChars:        "%d caractères au minimum",
+	MaxBytes:        "%d octets au maximum",
+	Email:           "adresse e-mail invalide",
+	UUID:            "doit être un UUID",
+	NotNegative:     "ne doit pas être négatif",
+	Between:         "entre %d et %d",
+	BetweenDays:     "entre %d et %d jours",
+	After:           "doit être postérieur à %s",
+	InPast:          "ne peut pas être dans le passé",
+	AtMostYearAfter: "au plus un an après %s",
+	AtMostDaysAfter: "au plus %d jours après %s",
+	UnknownStatus:   "statut %q inconnu, attendu confirmed, cancelled, completed ou all",
+	MaxTags:         "%d étiquettes au maximum",
+	EmptyTag:        "pas d'étiquette vide",
+	TagTooLong:      "%q : %d caractères au maximum",
+	ClockTime:       `format attendu "HH:MM"`,
+	TimeZone:        "fuseau horaire IANA inconnu",
+	Weekday:         `nom de jour attendu, par ex. "monday"`,
+	HTTPURL:         "doit être une URL http ou https absolue",
+	PublicURL:       "doit pointer vers une adresse publique",
+	UnknownField:    "champ %q inconnu",
+	NoFields:        "ne nomme aucun champ",
+	Granularity:     `"day" ou "week" attendu`,
+	LongerThanHours: "plus long que working_hours",
+	AtMostADay:      "au plus une journée",
+	Color:           "doit être au format #rrggbb",
+	MaxWindows:      "%d plages au maximum",
+	OverCapacity:    "dépasse la capacité",
+	Midnight:        "doit tomber à minuit (%s)",
+	OrgRole:         `"member" ou "owner" attendu`,
+
+	FrozenSlot:      "réservations fermées du %s au %s : %s",
+	ClosedDay:       "hors disponibilités : aucune réservation le %s (%s)",
+	OutsideHours:    "hors disponibilités : %s %s (%s)",
+	MessageTooLarge: "message de plus de %d octets",
+	BatchTooLarge:   "%d rendez-vous par lot au maximum",
+	NotMigrated:     "serveur non migré pour %s",
+
+	// by apperr reason
+	"INTERNAL":            "erreur interne",
+	"NOT_FOUND":           "introuvable",
+	"INVALID_ARGUMENT":    "requête invalide",
+	"BAD_PAGE_TOKEN":      "page_token invalide",
+	"FEATURE_UNAVAILABLE": "fonctionnalité indisponible sur ce serveur",
+	"RATE_LIMITED":        "trop de requêtes",
+	"SERVER_BUSY":         "serveur surchargé, réessayez",
+	"DEADLINE_EXCEEDED":   "délai dépassé",
+	"CANCELED":            "annulé",
+	"METHOD_UNKNOWN":      "méthode inconnue",
+
+	"BAD_FRAME":               "trame grpc-web invalide",
+	"MESSAGE_TOO_LARGE":       "message trop volumineux",
+	"COMPRESSION_UNSUPPORTED": "les trames compressées ne sont pas prises en charge",
+
+	"AUTH_REQUIRED":             "non authentifié",
+	"AUTH_TOKEN_INVALID":        "jeton invalide",
+	"AUTH_TOKEN_EXPIRED":        "jeton expiré",
+	"AUTH_INVALID_CREDENTIALS":  "identifiants invalides",
+	"AUTH_ACCOUNT_DELETED":      "compte supprimé",
+	"AUTH_LOCKED":               "trop d'échecs de connexion ; réessayez plus tard",
+	"AUTH_REGISTRATION_FAILED":  "l'inscription a échoué",
+	"AUTH_RESET_TOKEN_INVALID":  "code de réinitialisation invalide ou expiré",
+	"AUTH_REFRESH_INVALID":      "jeton de rafraîchissement invalide",
+	"AUTH_PASSWORD_TOO_SHORT":   "mot de passe trop court",
+	"AUTH_PASSWORD_UNCHANGED":   "le nouveau mot de passe doit être différent de l'actuel",
+	"AUTH_EMAIL_IMMUTABLE":      "l'adresse e-mail ne peut pas être modifiée",
+	"AUTH_EMAIL_UNVERIFIED":     "adresse e-mail non vérifiée",
+	"AUTH_VERIFY_TOKEN_INVALID": "code de vérification invalide ou expiré",
+	"ADMIN_ONLY":                "réservé aux administrateurs",
+
+	"APPT_CONFLICT":      "ce créneau chevauche un rendez-vous existant",
+	"APPT_PAST":          "le rendez-vous ne peut pas commencer dans le passé",
+	"APPT_EMPTY_RANGE":   "la fin doit être après le début",
+	"APPT_FROZEN":        "réservations fermées sur ce créneau",
+	"APPT_UNAVAILABLE":   "hors disponibilités",
+	"APPT_BUFFER":        "trop proche d'un autre rendez-vous",
+	"APPT_FULL":          "plus de places disponibles",
+	"APPT_CANCELLED":     "un rendez-vous annulé ne peut pas être déplacé",
+	"APPT_KEY_REUSED":    "clé d'idempotence déjà utilisée pour une autre requête",
+	"BATCH_TOO_LARGE":    "lot trop volumineux",
+	"LIST_RANGE_INVALID": "plage invalide",
+
+	"CALENDAR_NOT_FOUND":  "agenda introuvable",
+	"CALENDAR_EXISTS":     "un agenda porte déjà ce nom",
+	"CALENDAR_IS_DEFAULT": "l'agenda par défaut ne peut pas être supprimé",
+	"CALENDAR_IN_USE":     "l'agenda contient encore des rendez-vous confirmés",
+
+	"RESOURCE_NOT_FOUND": "ressource introuvable",
+	"RESOURCE_BOOKED":    "ressource déjà réservée sur ce créneau",
+	"RESOURCE_EXISTS":    "une ressource porte déjà ce nom",
+
+	"WEBHOOK_NOT_FOUND": "webhook introuvable",
+	"WEBHOOK_LIMIT":     "nombre maximal de webhooks atteint",
+
+	"ORG_NOT_FOUND":      "organisation introuvable",
+	"ORG_OWNER_ONLY":     "réservé aux propriétaires de l'organisation",
+	"ORG_ALREADY_MEMBER": "vous faites déjà partie d'une organisation",
+	"ORG_INVITE_INVALID": "invitation invalide ou expirée",
+}
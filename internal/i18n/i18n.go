@@ -0,0 +1,140 @@
+// Package i18n holds the message catalogs error messages are rendered
+// from. Keys are stable codes: the field violation keys below, and for the
+// other errors the apperr reasons. A message takes the locale the client
+// asked for in Accept-Language, English when the catalogs have nothing
+// closer; the status code and reason never change with it.
+//
+// English is what the code writes: en only has the templates for keyed
+// messages, and an error without one keeps the message it was made with.
+// Every other locale has those templates plus a message per reason.
+package i18n
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the locale of unknown or missing languages.
+const Default = "en"
+
+// Key names a catalog message.
+type Key string
+
+// field violation keys; the English templates are in en.go
+const (
+	Required        Key = "required"
+	MaxChars        Key = "max_chars"
+	MinChars        Key = "min_chars"
+	MaxBytes        Key = "max_bytes"
+	Email           Key = "email"
+	UUID            Key = "uuid"
+	NotNegative     Key = "not_negative"
+	Between         Key = "between"
+	BetweenDays     Key = "between_days"
+	After           Key = "after"
+	InPast          Key = "in_past"
+	AtMostYearAfter Key = "at_most_year_after"
+	AtMostDaysAfter Key = "at_most_days_after"
+	UnknownStatus   Key = "unknown_status"
+	MaxTags         Key = "max_tags"
+	EmptyTag        Key = "empty_tag"
+	TagTooLong      Key = "tag_too_long"
+	ClockTime       Key = "clock_time"
+	TimeZone        Key = "time_zone"
+	Weekday         Key = "weekday"
+	HTTPURL         Key = "http_url"
+	PublicURL       Key = "public_url"
+	UnknownField    Key = "unknown_field"
+	NoFields        Key = "no_fields"
+	Granularity     Key = "granularity"
+	LongerThanHours Key = "longer_than_hours"
+	AtMostADay      Key = "at_most_a_day"
+	Color           Key = "color"
+	MaxWindows      Key = "max_windows"
+	OverCapacity    Key = "over_capacity"
+	Midnight        Key = "midnight"
+	OrgRole         Key = "org_role"
+)
+
+// message keys for errors whose text carries specifics, besides the
+// reason's own
+const (
+	FrozenSlot      Key = "frozen_slot"
+	ClosedDay       Key = "closed_day"
+	OutsideHours    Key = "outside_hours"
+	MessageTooLarge Key = "message_too_large"
+	BatchTooLarge   Key = "batch_too_large"
+	NotMigrated     Key = "not_migrated"
+)
+
+var catalogs = map[string]map[Key]string{
+	"en": en,
+	"fr": fr,
+}
+
+// supported lists the locales in matcher order, Default first so it's
+// what no match falls back to.
+var supported = []string{"en", "fr"}
+
+var matcher = func() language.Matcher {
+	tags := make([]language.Tag, len(supported))
+	for i, l := range supported {
+		tags[i] = language.MustParse(l)
+	}
+	return language.NewMatcher(tags)
+}()
+
+// Locales returns the locales there are catalogs for, Default first.
+func Locales() []string { return append([]string(nil), supported...) }
+
+// Match picks the locale for an Accept-Language value ("fr-CA, en;q=0.5"):
+// the best one there's a catalog for, Default if none is close.
+func Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, i, conf := matcher.Match(tags...)
+	if conf == language.No {
+		return Default
+	}
+	return supported[i]
+}
+
+// Lookup returns the message key has in locale, without formatting it.
+func Lookup(locale string, key Key) (string, bool) {
+	msg, ok := catalogs[locale][key]
+	return msg, ok
+}
+
+// T renders key in locale with args, falling back to English and then
+// to the key itself.
+func T(locale string, key Key, args ...any) string {
+	msg, ok := Lookup(locale, key)
+	if !ok {
+		if msg, ok = Lookup(Default, key); !ok {
+			msg = string(key)
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying locale.
+func NewContext(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, locale)
+}
+
+// FromContext is the locale ctx carries, Default if none.
+func FromContext(ctx context.Context) string {
+	if l, ok := ctx.Value(ctxKey{}).(string); ok {
+		return l
+	}
+	return Default
+}
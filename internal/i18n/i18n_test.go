@@ -0,0 +1,74 @@
+package i18n
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct{ header, want string }{
+		{"", "en"},
+		{"fr", "fr"},
+		{"FR", "fr"},
+		{"fr-CA, en;q=0.5", "fr"},
+		{"en-US,fr;q=0.9", "en"},
+		{"de, fr;q=0.3", "fr"},
+		{"fr;q=0, en", "en"},
+		{"de-DE", "en"},
+		{"*", "en"},
+		{"not;a=header;;", "en"},
+	} {
+		if got := Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("fr", MaxChars, 200); got != "200 caractères au maximum" {
+		t.Errorf("fr: %q", got)
+	}
+	if got := T("en", MaxChars, 200); got != "at most 200 characters" {
+		t.Errorf("en: %q", got)
+	}
+	// unknown locales and keys fall back to English, then the key
+	if got := T("de", Required); got != "required" {
+		t.Errorf("de: %q", got)
+	}
+	if got := T("fr", "NO_SUCH_KEY"); got != "NO_SUCH_KEY" {
+		t.Errorf("unknown key: %q", got)
+	}
+}
+
+// a translation takes the same arguments, in the same order, as the
+// English it stands for
+func TestCatalogs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+	for _, locale := range Locales() {
+		if locale == Default {
+			continue
+		}
+		for key, msg := range en {
+			tr, ok := Lookup(locale, key)
+			if !ok {
+				t.Errorf("%s: no %s", locale, key)
+				continue
+			}
+			if want, got := verbs.FindAllString(msg, -1), verbs.FindAllString(tr, -1); !slices.Equal(got, want) {
+				t.Errorf("%s %s: verbs %v, want %v", locale, key, got, want)
+			}
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if got := FromContext(ctx); got != Default {
+		t.Errorf("empty context: %q", got)
+	}
+	if got := FromContext(NewContext(ctx, "fr")); got != "fr" {
+		t.Errorf("got %q", got)
+	}
+}
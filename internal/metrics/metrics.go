@@ -0,0 +1,170 @@
+// Package metrics exposes Prometheus metrics for RPCs, the database pool
+// and the business signals worth alerting on (rate limiting, booking
+// conflicts). Everything registers on a caller-supplied registry so tests
+// can use a fresh one.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type Metrics struct {
+	rpcs        *prometheus.CounterVec
+	rpcDuration *prometheus.HistogramVec
+	rateLimited *prometheus.CounterVec
+	conflicts   prometheus.Counter
+	dbRetries   *prometheus.CounterVec
+	listCache   *prometheus.CounterVec
+
+	poolAcquired     prometheus.Gauge
+	poolIdle         prometheus.Gauge
+	poolTotal        prometheus.Gauge
+	poolMax          prometheus.Gauge
+	poolAcquireWait  prometheus.Gauge
+	poolEmptyAcquire prometheus.Gauge
+}
+
+// New creates the metrics and registers them on reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		rpcs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "RPCs completed, by method and status code.",
+		}, []string{"method", "code"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "RPC latency, by method.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limited_total",
+			Help: "Requests rejected by the per-IP rate limiter, by method.",
+		}, []string{"method"}),
+		conflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "appointment_conflicts_total",
+			Help: "Bookings rejected because they overlap an existing appointment.",
+		}),
+		dbRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_read_retries_total",
+			Help: "Store reads retried after a transient database error, by operation.",
+		}, []string{"op"}),
+		listCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "list_cache_lookups_total",
+			Help: "ListAppointments calls answered from the cache (hit) or the database (miss).",
+		}, []string{"result"}),
+		poolAcquired: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_acquired_conns", Help: "Connections currently checked out.",
+		}),
+		poolIdle: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_idle_conns", Help: "Idle connections.",
+		}),
+		poolTotal: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_total_conns", Help: "Open connections.",
+		}),
+		poolMax: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_max_conns", Help: "Configured pool size.",
+		}),
+		poolAcquireWait: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_acquire_wait_seconds_total", Help: "Cumulative time spent waiting for a connection.",
+		}),
+		poolEmptyAcquire: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "db_pool_empty_acquire_total", Help: "Acquires that had to wait because the pool was empty.",
+		}),
+	}
+	reg.MustRegister(m.rpcs, m.rpcDuration, m.rateLimited, m.conflicts, m.dbRetries,
+		m.listCache, m.poolAcquired, m.poolIdle, m.poolTotal, m.poolMax, m.poolAcquireWait, m.poolEmptyAcquire)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// Interceptor counts and times every RPC. Put it first in the chain so
+// calls rejected by rate limiting or auth are counted too.
+func (m *Metrics) Interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		m.rpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		m.rpcs.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// RateLimited and Conflict are safe to call on a nil *Metrics, so code
+// paths that record them don't need metrics wired up (tests, tools).
+func (m *Metrics) RateLimited(method string) {
+	if m != nil {
+		m.rateLimited.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *Metrics) Conflict() {
+	if m != nil {
+		m.conflicts.Inc()
+	}
+}
+
+func (m *Metrics) DBRetried(op string) {
+	if m != nil {
+		m.dbRetries.WithLabelValues(op).Inc()
+	}
+}
+
+func (m *Metrics) ListCacheLookup(hit bool) {
+	if m != nil {
+		result := "miss"
+		if hit {
+			result = "hit"
+		}
+		m.listCache.WithLabelValues(result).Inc()
+	}
+}
+
+// PoolStats is the subset of pgxpool.Stat that gets exported.
+type PoolStats struct {
+	Acquired, Idle, Total, Max int32
+	AcquireWait                time.Duration
+	EmptyAcquire               int64
+}
+
+func (m *Metrics) ObservePool(s PoolStats) {
+	m.poolAcquired.Set(float64(s.Acquired))
+	m.poolIdle.Set(float64(s.Idle))
+	m.poolTotal.Set(float64(s.Total))
+	m.poolMax.Set(float64(s.Max))
+	m.poolAcquireWait.Set(s.AcquireWait.Seconds())
+	m.poolEmptyAcquire.Set(float64(s.EmptyAcquire))
+}
+
+// WatchPool samples pool stats every interval until ctx is done.
+func (m *Metrics) WatchPool(ctx context.Context, pool *pgxpool.Pool, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		s := pool.Stat()
+		m.ObservePool(PoolStats{
+			Acquired:     s.AcquiredConns(),
+			Idle:         s.IdleConns(),
+			Total:        s.TotalConns(),
+			Max:          s.MaxConns(),
+			AcquireWait:  s.AcquireDuration(),
+			EmptyAcquire: s.EmptyAcquireCount(),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/metrics"
+	"schedule-management-api/internal/middleware"
+)
+
+func TestInterceptorCounts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	// a second instance on its own registry must not collide
+	metrics.New(prometheus.NewRegistry())
+
+	ic := m.Interceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.ScheduleService/GetAppointment"}
+	ok := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	notFound := func(ctx context.Context, req any) (any, error) { return nil, status.Error(codes.NotFound, "not found") }
+
+	ic(context.Background(), nil, info, ok)
+	ic(context.Background(), nil, info, ok)
+	ic(context.Background(), nil, info, notFound)
+
+	out := scrape(reg)
+	for _, want := range []string{
+		`grpc_server_handled_total{code="OK",method="/appointment.v1.ScheduleService/GetAppointment"} 2`,
+		`grpc_server_handled_total{code="NotFound",method="/appointment.v1.ScheduleService/GetAppointment"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if n := testutil.CollectAndCount(reg, "grpc_server_handling_seconds"); n != 1 {
+		t.Errorf("expected one latency series, got %d", n)
+	}
+}
+
+func TestRateLimitAndConflictCounters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	rl := middleware.NewRateLimiter(0.001, 1)
+	rl.OnReject(m.RateLimited)
+	ic := middleware.RateLimit(rl)
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.AuthService/Login"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: fakeAddr("10.0.0.1:1234")})
+	for i := 0; i < 3; i++ {
+		ic(ctx, nil, info, func(ctx context.Context, req any) (any, error) { return nil, nil })
+	}
+
+	m.Conflict()
+	var nilMetrics *metrics.Metrics
+	nilMetrics.Conflict() // must not panic
+	m.DBRetried("GetAppointment")
+	m.DBRetried("GetAppointment")
+	m.ListCacheLookup(true)
+	m.ListCacheLookup(false)
+	m.ListCacheLookup(true)
+
+	out := scrape(reg)
+	for _, want := range []string{
+		`rate_limited_total{method="/appointment.v1.AuthService/Login"} 2`,
+		"appointment_conflicts_total 1",
+		`db_read_retries_total{op="GetAppointment"} 2`,
+		`list_cache_lookups_total{result="hit"} 2`,
+		`list_cache_lookups_total{result="miss"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestPoolGauges(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	m.ObservePool(metrics.PoolStats{Acquired: 3, Idle: 2, Total: 5, Max: 10, AcquireWait: 1500 * time.Millisecond, EmptyAcquire: 7})
+
+	out := scrape(reg)
+	for _, want := range []string{
+		"db_pool_acquired_conns 3",
+		"db_pool_idle_conns 2",
+		"db_pool_total_conns 5",
+		"db_pool_max_conns 10",
+		"db_pool_acquire_wait_seconds_total 1.5",
+		"db_pool_empty_acquire_total 7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func scrape(reg *prometheus.Registry) string {
+	rec := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
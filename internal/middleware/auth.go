@@ -2,35 +2,42 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"strings"
 
+	"schedule-management-api/internal/apperr"
 	"schedule-management-api/internal/auth"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 type ctxKey string
 
-const UserIDKey ctxKey = "uid"
+const (
+	UserIDKey  ctxKey = "uid"
+	RoleKey    ctxKey = "role"
+	SessionKey ctxKey = "sid"
+)
 
-// skip auth for these
-var open = map[string]bool{
-	"/appointment.v1.ScheduleService/Register": true,
-	"/appointment.v1.ScheduleService/Login":    true,
+// WithClaims puts the caller's user ID, role and session on ctx.
+func WithClaims(ctx context.Context, c *auth.Claims) context.Context {
+	ctx = context.WithValue(ctx, UserIDKey, c.UserID)
+	ctx = context.WithValue(ctx, SessionKey, c.SessionID)
+	return context.WithValue(ctx, RoleKey, c.Role)
 }
 
-func Auth(secret string) grpc.UnaryServerInterceptor {
+// Auth checks the bearer token against ks and cfg's iss/aud, for every
+// method whose policy asks for one.
+func Auth(ks auth.Keys, cfg auth.Config) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
-		if open[info.FullMethod] {
+		if p, _ := PolicyFor(info.FullMethod); !p.RequiresAuth {
 			return next(ctx, req)
 		}
 
 		md, ok := metadata.FromIncomingContext(ctx)
 		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+			return nil, apperr.New(apperr.AuthRequired, "missing metadata")
 		}
 
 	// token from Authorization: Bearer <jwt>
@@ -41,15 +48,25 @@ func Auth(secret string) grpc.UnaryServerInterceptor {
 		}
 
 		if raw == "" {
-			return nil, status.Error(codes.Unauthenticated, "no token")
+			return nil, apperr.New(apperr.AuthRequired, "no token")
 		}
 
-		claims, err := auth.ParseToken(raw, secret)
+		claims, err := cfg.ParseToken(raw, ks)
 		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, "bad token")
+			return nil, TokenError(err)
 		}
 
-		ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
-		return next(ctx, req)
+		noteUser(ctx, claims.UserID)
+		return next(WithClaims(ctx, claims), req)
+	}
+}
+
+// TokenError is what the caller hears about a token ParseToken turned
+// down: AUTH_TOKEN_EXPIRED when a refresh would fix it, AUTH_TOKEN_INVALID
+// for anything else.
+func TokenError(err error) error {
+	if errors.Is(err, auth.ErrExpired) {
+		return apperr.New(apperr.AuthTokenExpired, "token expired")
 	}
+	return apperr.New(apperr.AuthTokenInvalid, "invalid token")
 }
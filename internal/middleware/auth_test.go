@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/clock"
+)
+
+func TestAuthChecksIssuer(t *testing.T) {
+	prod := auth.Config{Issuer: "prod", Audience: "api"}
+	interceptor := Auth(auth.SingleKey("test-secret"), prod)
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.ScheduleService/ListAppointments"}
+	call := func(cfg auth.Config) error {
+		tok, _, _ := cfg.MakeToken("u1", auth.RoleUser, auth.SingleKey("test-secret"))
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tok))
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+			if ctx.Value(UserIDKey) != "u1" {
+				t.Error("claims not on ctx")
+			}
+			return nil, nil
+		})
+		return err
+	}
+
+	if err := call(prod); err != nil {
+		t.Errorf("own token: %v", err)
+	}
+	if err := call(auth.Config{Issuer: "staging", Audience: "api"}); apperr.ReasonOf(err) != apperr.AuthTokenInvalid {
+		t.Errorf("staging token: %v", err)
+	}
+	if err := call(auth.Config{}); apperr.ReasonOf(err) != apperr.AuthTokenInvalid {
+		t.Errorf("token without iss/aud: %v", err)
+	}
+}
+
+func TestAuthExpiredToken(t *testing.T) {
+	keys := auth.SingleKey("test-secret")
+	clk := clock.NewFake(time.Now())
+	cfg := auth.Config{Clock: clk}
+	tok, exp, _ := cfg.MakeToken("u1", auth.RoleUser, keys)
+	interceptor := Auth(keys, cfg)
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.ScheduleService/ListAppointments"}
+	call := func(tok string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tok))
+		_, err := interceptor(ctx, nil, info, func(context.Context, any) (any, error) { return nil, nil })
+		return err
+	}
+
+	clk.Set(exp)
+	for _, tt := range []struct {
+		name, tok, msg string
+		reason         apperr.Reason
+	}{
+		{"expired", tok, "token expired", apperr.AuthTokenExpired},
+		{"malformed", "not-a-jwt", "invalid token", apperr.AuthTokenInvalid},
+		// an expired token with a broken signature is a forgery, not a stale session
+		{"expired and tampered", tok[:len(tok)-2] + "xx", "invalid token", apperr.AuthTokenInvalid},
+	} {
+		err := call(tt.tok)
+		if st := status.Convert(err); st.Code() != codes.Unauthenticated || st.Message() != tt.msg || apperr.ReasonOf(err) != tt.reason {
+			t.Errorf("%s: %v (%s)", tt.name, err, apperr.ReasonOf(err))
+		}
+	}
+}
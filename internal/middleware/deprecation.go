@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+)
+
+// old method -> replacement. still served, just logged until clients move over
+var deprecated = map[string]string{
+	"/appointment.v1.ScheduleService/Register":             "/appointment.v1.AuthService/Register",
+	"/appointment.v1.ScheduleService/Login":                "/appointment.v1.AuthService/Login",
+	"/appointment.v1.ScheduleService/RequestPasswordReset": "/appointment.v1.AuthService/RequestPasswordReset",
+	"/appointment.v1.ScheduleService/ResetPassword":        "/appointment.v1.AuthService/ResetPassword",
+}
+
+// Replacement returns the method that supersedes a deprecated one.
+func Replacement(method string) (string, bool) {
+	r, ok := deprecated[method]
+	return r, ok
+}
+
+// WarnDeprecated logs a warning for calls to a deprecated method path.
+func WarnDeprecated(method string) {
+	if r, ok := deprecated[method]; ok {
+		log.Printf("deprecated method %s called, use %s", method, r)
+	}
+}
+
+func Deprecation() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		WarnDeprecated(info.FullMethod)
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+)
+
+// Locale picks the caller's language from the accept-language metadata,
+// puts it on the context for handlers that build messages themselves, and
+// renders the error the call ends with in it. Put it first in the chain so
+// the other interceptors' errors are covered and the logs stay in English.
+func Locale() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		locale := i18n.Match(strings.Join(md.Get("accept-language"), ", "))
+		resp, err := next(i18n.NewContext(ctx, locale), req)
+		return resp, apperr.Localize(err, locale)
+	}
+}
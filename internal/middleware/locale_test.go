@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+	"schedule-management-api/internal/validate"
+)
+
+func TestLocale(t *testing.T) {
+	ic := Locale()
+	call := func(acceptLanguage string, err error) (string, error) {
+		ctx := context.Background()
+		if acceptLanguage != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("accept-language", acceptLanguage))
+		}
+		var locale string
+		_, err = ic(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/M"}, func(ctx context.Context, _ any) (any, error) {
+			locale = i18n.FromContext(ctx)
+			return nil, err
+		})
+		return locale, err
+	}
+
+	bad := validate.Field("title", i18n.Required)
+	for _, tt := range []struct{ header, locale, msg string }{
+		{"", "en", "title: required"},
+		{"fr-FR,fr;q=0.9", "fr", "title: obligatoire"},
+		{"de", "en", "title: required"},
+	} {
+		locale, err := call(tt.header, bad)
+		if locale != tt.locale {
+			t.Errorf("%q: locale %q", tt.header, locale)
+		}
+		if st := status.Convert(err); st.Message() != tt.msg || st.Code() != codes.InvalidArgument || apperr.ReasonOf(err) != apperr.InvalidArgument {
+			t.Errorf("%q: %v", tt.header, err)
+		}
+	}
+
+	// errors without a key take their reason's message
+	_, err := call("fr", apperr.New(apperr.NotFound, "not found"))
+	if st := status.Convert(err); st.Message() != "introuvable" || st.Code() != codes.NotFound || apperr.ReasonOf(err) != apperr.NotFound {
+		t.Errorf("not found: %v", err)
+	}
+	if _, err := call("fr", nil); err != nil {
+		t.Errorf("success: %v", err)
+	}
+}
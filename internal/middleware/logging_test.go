@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/auth"
+)
+
+const secretValue = "hunter2-hunter2"
+
+func TestRedactedJSON(t *testing.T) {
+	cases := []proto.Message{
+		&pb.LoginRequest{Email: "a@b.com", Password: secretValue},
+		&pb.RegisterRequest{Email: "a@b.com", Password: secretValue, Name: "A"},
+		&pb.ChangePasswordRequest{CurrentPassword: secretValue, NewPassword: secretValue},
+		&pb.ResetPasswordRequest{Token: secretValue, NewPassword: secretValue},
+		&pb.DeleteAccountRequest{Password: secretValue},
+		&pb.RefreshRequest{RefreshToken: secretValue},
+	}
+	for _, m := range cases {
+		before := proto.Clone(m)
+		out := RedactedJSON(m)
+		if strings.Contains(out, secretValue) {
+			t.Errorf("%T leaked a secret: %s", m, out)
+		}
+		if !strings.Contains(out, redacted) {
+			t.Errorf("%T: expected redaction marker in %s", m, out)
+		}
+		if !proto.Equal(m, before) {
+			t.Errorf("%T: redaction modified the request itself", m)
+		}
+	}
+
+	out := RedactedJSON(&pb.LoginRequest{Email: "a@b.com", Password: secretValue})
+	if !strings.Contains(out, "a@b.com") {
+		t.Errorf("non-sensitive fields should survive: %s", out)
+	}
+}
+
+func TestLoggingLine(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logging, authn := Logging(logger, true), Auth(auth.SingleKey("test-secret"), auth.Config{})
+
+	call := func(ctx context.Context, method string, req any, fail error) map[string]any {
+		t.Helper()
+		buf.Reset()
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		logging(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return authn(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return nil, fail
+			})
+		})
+		var line map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("not one json line: %q", buf.String())
+		}
+		if strings.Contains(buf.String(), secretValue) {
+			t.Errorf("secret in log line: %s", buf.String())
+		}
+		return line
+	}
+
+	line := call(context.Background(), "/appointment.v1.AuthService/Login",
+		&pb.LoginRequest{Email: "a@b.com", Password: secretValue}, status.Error(codes.Unauthenticated, "invalid credentials"))
+	if line["method"] != "/appointment.v1.AuthService/Login" || line["code"] != "Unauthenticated" {
+		t.Errorf("unexpected line: %v", line)
+	}
+	if _, ok := line["user_id"]; ok {
+		t.Errorf("no user on an open method: %v", line)
+	}
+
+	tok, _ := auth.MakeToken("user-1", auth.RoleUser, "test-secret")
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tok))
+	line = call(ctx, "/appointment.v1.AuthService/ChangePassword",
+		&pb.ChangePasswordRequest{CurrentPassword: secretValue, NewPassword: secretValue}, nil)
+	if line["user_id"] != "user-1" || line["code"] != "OK" {
+		t.Errorf("expected user_id and OK: %v", line)
+	}
+
+	// rejected by Auth, still logged
+	line = call(context.Background(), "/appointment.v1.AuthService/ChangePassword", &pb.ChangePasswordRequest{}, nil)
+	if line["code"] != "Unauthenticated" {
+		t.Errorf("expected Unauthenticated: %v", line)
+	}
+}
+
+func TestLoggingPayloadsOffByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	Logging(logger, false)(context.Background(), &pb.LoginRequest{Email: "a@b.com"},
+		&grpc.UnaryServerInfo{FullMethod: "/appointment.v1.AuthService/Login"},
+		func(ctx context.Context, req any) (any, error) { return nil, nil })
+	if strings.Contains(buf.String(), "a@b.com") {
+		t.Errorf("payload logged without LOG_PAYLOADS: %s", buf.String())
+	}
+}
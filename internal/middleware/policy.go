@@ -0,0 +1,119 @@
+package middleware
+
+// RateLimitClass is how RateLimit and the grpc-web bridge charge a
+// method's calls.
+type RateLimitClass int
+
+const (
+	// NotLimited calls are never charged.
+	NotLimited RateLimitClass = iota
+	// PerIP calls take a token from the client IP's bucket: credential
+	// guessing, sign-ups, and the admin-wide scans.
+	PerIP
+)
+
+// MethodPolicy is how the interceptors treat one method.
+type MethodPolicy struct {
+	RequiresAuth   bool
+	RateLimitClass RateLimitClass
+}
+
+var (
+	public        = MethodPolicy{}
+	publicLimited = MethodPolicy{RateLimitClass: PerIP}
+	authed        = MethodPolicy{RequiresAuth: true}
+	authedLimited = MethodPolicy{RequiresAuth: true, RateLimitClass: PerIP}
+)
+
+// every method the server registers, by full name. A new RPC needs an
+// entry here; TestEveryMethodHasAPolicy fails until it has one.
+var methodPolicies = map[string]MethodPolicy{
+	"/appointment.v1.AuthService/Register":             publicLimited,
+	"/appointment.v1.AuthService/Login":                publicLimited,
+	"/appointment.v1.AuthService/Refresh":              publicLimited,
+	"/appointment.v1.AuthService/RequestPasswordReset": publicLimited,
+	"/appointment.v1.AuthService/ResetPassword":        publicLimited,
+	"/appointment.v1.AuthService/VerifyEmail":          publicLimited,
+	"/appointment.v1.AuthService/ResendVerification":   publicLimited,
+	"/appointment.v1.AuthService/ChangePassword":       authed,
+	"/appointment.v1.AuthService/GetProfile":           authed,
+	"/appointment.v1.AuthService/UpdateProfile":        authed,
+	"/appointment.v1.AuthService/DeleteAccount":        authed,
+	"/appointment.v1.AuthService/ListSessions":         authed,
+	"/appointment.v1.AuthService/RevokeSession":        authed,
+	"/appointment.v1.AuthService/RevokeAllSessions":    authed,
+
+	// deprecated copies of the AuthService ones
+	"/appointment.v1.ScheduleService/Register":             publicLimited,
+	"/appointment.v1.ScheduleService/Login":                publicLimited,
+	"/appointment.v1.ScheduleService/RequestPasswordReset": publicLimited,
+	"/appointment.v1.ScheduleService/ResetPassword":        publicLimited,
+
+	"/appointment.v1.ScheduleService/GetServerInfo":        public,
+	"/appointment.v1.ScheduleService/GetSharedAppointment": public,
+
+	"/appointment.v1.ScheduleService/CreateAppointment":        authed,
+	"/appointment.v1.ScheduleService/ListAppointments":         authed,
+	"/appointment.v1.ScheduleService/ListUpcomingAppointments": authed,
+	"/appointment.v1.ScheduleService/GetAppointment":           authed,
+	"/appointment.v1.ScheduleService/UpdateAppointment":        authed,
+	"/appointment.v1.ScheduleService/DeleteAppointment":        authed,
+	"/appointment.v1.ScheduleService/RestoreAppointment":       authed,
+	"/appointment.v1.ScheduleService/JoinAppointment":          authed,
+	"/appointment.v1.ScheduleService/LeaveAppointment":         authed,
+	"/appointment.v1.ScheduleService/GetAppointmentHistory":    authed,
+	"/appointment.v1.ScheduleService/RescheduleAppointment":    authed,
+	"/appointment.v1.ScheduleService/GetRescheduleHistory":     authed,
+	"/appointment.v1.ScheduleService/BatchCreateAppointments":  authed,
+	"/appointment.v1.ScheduleService/CreateShareLink":          authed,
+	"/appointment.v1.ScheduleService/RevokeShareLink":          authed,
+	"/appointment.v1.ScheduleService/CreateCalendar":           authed,
+	"/appointment.v1.ScheduleService/ListCalendars":            authed,
+	"/appointment.v1.ScheduleService/UpdateCalendar":           authed,
+	"/appointment.v1.ScheduleService/DeleteCalendar":           authed,
+	"/appointment.v1.ScheduleService/ListResources":            authed,
+	"/appointment.v1.ScheduleService/GetResourceAvailability":  authed,
+	"/appointment.v1.ScheduleService/GetScheduleSummary":       authed,
+	"/appointment.v1.ScheduleService/SuggestSlots":             authed,
+	"/appointment.v1.ScheduleService/CheckAvailability":        authed,
+	"/appointment.v1.ScheduleService/SetAvailability":          authed,
+	"/appointment.v1.ScheduleService/GetAvailability":          authed,
+	"/appointment.v1.ScheduleService/GetPreferences":           authed,
+	"/appointment.v1.ScheduleService/UpdatePreferences":        authed,
+	"/appointment.v1.ScheduleService/RegisterWebhook":          authed,
+	"/appointment.v1.ScheduleService/ListWebhooks":             authed,
+	"/appointment.v1.ScheduleService/SetWebhookEnabled":        authed,
+	"/appointment.v1.ScheduleService/DeleteWebhook":            authed,
+	"/appointment.v1.ScheduleService/CreateOrganization":       authed,
+	"/appointment.v1.ScheduleService/InviteMember":             authed,
+	"/appointment.v1.ScheduleService/AcceptInvite":             authed,
+	"/appointment.v1.ScheduleService/ListMembers":              authed,
+	"/appointment.v1.ScheduleService/LeaveOrganization":        authed,
+	"/appointment.v1.ScheduleService/ListOrgAppointments":      authed,
+
+	"/appointment.v1.AdminService/SearchAllAppointments": authedLimited,
+	"/appointment.v1.AdminService/GetSystemStats":        authedLimited,
+	"/appointment.v1.AdminService/CreateFreezeWindow":    authed,
+	"/appointment.v1.AdminService/ListFreezeWindows":     authed,
+	"/appointment.v1.AdminService/DeleteFreezeWindow":    authed,
+	"/appointment.v1.AdminService/GetDiagnostics":        authed,
+	"/appointment.v1.AdminService/ListUsers":             authed,
+	"/appointment.v1.AdminService/CreateResource":        authed,
+
+	// load balancers and probes call these without a token. Watch is a
+	// stream, which the unary Auth interceptor never sees, so it has always
+	// answered anyone; public says so instead of promising a check
+	"/grpc.health.v1.Health/Check": public,
+	"/grpc.health.v1.Health/Watch": public,
+}
+
+// PolicyFor is method's policy. A method without an entry reports ok
+// false and is treated as needing a token and not rate limited, so a
+// forgotten entry can't leave an endpoint open.
+func PolicyFor(method string) (p MethodPolicy, ok bool) {
+	p, ok = methodPolicies[method]
+	if !ok {
+		return authed, false
+	}
+	return p, true
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "schedule-management-api/gen/appointment/v1"
+)
+
+// the methods of every service the server registers
+func registeredMethods() map[string]bool {
+	all := map[string]bool{}
+	for _, f := range []protoreflect.FileDescriptor{pb.File_proto_appointment_v1_appointment_proto, healthpb.File_grpc_health_v1_health_proto} {
+		for i := 0; i < f.Services().Len(); i++ {
+			svc := f.Services().Get(i)
+			for j := 0; j < svc.Methods().Len(); j++ {
+				all[fmt.Sprintf("/%s/%s", svc.FullName(), svc.Methods().Get(j).Name())] = true
+			}
+		}
+	}
+	return all
+}
+
+func TestEveryMethodHasAPolicy(t *testing.T) {
+	methods := registeredMethods()
+	for m := range methods {
+		if _, ok := PolicyFor(m); !ok {
+			t.Errorf("%s has no entry in methodPolicies", m)
+		}
+	}
+	for m := range methodPolicies {
+		if !methods[m] {
+			t.Errorf("methodPolicies names %s, which no service has", m)
+		}
+	}
+}
+
+func TestPolicyDefaults(t *testing.T) {
+	p, ok := PolicyFor("/appointment.v1.ScheduleService/NoSuchMethod")
+	if ok || !p.RequiresAuth || p.RateLimitClass != NotLimited {
+		t.Errorf("unknown method: got %+v, %v; want auth required, not limited", p, ok)
+	}
+	if p, _ := PolicyFor("/appointment.v1.AuthService/Login"); p.RequiresAuth || !Limited("/appointment.v1.AuthService/Login") {
+		t.Errorf("Login: got %+v; want open and limited", p)
+	}
+	if p, _ := PolicyFor("/appointment.v1.ScheduleService/CreateAppointment"); !p.RequiresAuth || Limited("/appointment.v1.ScheduleService/CreateAppointment") {
+		t.Errorf("CreateAppointment: got %+v; want auth required, not limited", p)
+	}
+}
@@ -1,80 +1,251 @@
 package middleware
 
 import (
+	"container/list"
+	"context"
+	"net"
+	"net/netip"
+	"slices"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
-	"google.golang.org/grpc/status"
-	"context"
+
+	"schedule-management-api/internal/apperr"
 )
 
 type client struct {
+	key  string
 	lim  *rate.Limiter
 	seen time.Time
 }
 
+// defaults for NewRateLimiter
+const (
+	defaultMaxClients = 100_000
+	defaultCleanup    = time.Minute
+	defaultStaleAfter = 3 * time.Minute
+)
+
+// RateLimiter keeps a token bucket per client IP. At most maxClients are
+// tracked; past that the least recently seen one is dropped, so a flood of
+// distinct sources costs a bounded amount of memory (the evicted clients
+// just start over with a full bucket).
 type RateLimiter struct {
 	mu      sync.Mutex
-	clients map[string]*client
+	clients map[string]*list.Element // of *client
+	lru     list.List                // most recently seen at the front
 	r       rate.Limit
 	burst   int
+
+	maxClients int
+	cleanup    time.Duration
+	staleAfter time.Duration
+
+	onReject func(method string)
+
+	forwarders []netip.Prefix
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func NewRateLimiter(rps float64, burst int) *RateLimiter {
+type LimiterOption func(*RateLimiter)
+
+// WithMaxClients caps how many clients are tracked at once.
+func WithMaxClients(n int) LimiterOption {
+	return func(rl *RateLimiter) {
+		if n > 0 {
+			rl.maxClients = n
+		}
+	}
+}
+
+// WithCleanup sets how often clients unseen for staleAfter are dropped.
+func WithCleanup(every, staleAfter time.Duration) LimiterOption {
+	return func(rl *RateLimiter) {
+		if every > 0 {
+			rl.cleanup = every
+		}
+		if staleAfter > 0 {
+			rl.staleAfter = staleAfter
+		}
+	}
+}
+
+// ForwardedFor is the metadata a forwarding grpc-web bridge puts the
+// browser's IP under.
+const ForwardedFor = "x-forwarded-for"
+
+// WithTrustedForwarders makes RateLimit charge calls from peers in
+// prefixes, forwarding grpc-web bridges, to the IP in their ForwardedFor
+// metadata instead of to the bridge, which would otherwise share one
+// bucket among all its browsers. From any other peer the metadata is
+// ignored, so a client can't pick its own bucket.
+func WithTrustedForwarders(prefixes ...netip.Prefix) LimiterOption {
+	return func(rl *RateLimiter) { rl.forwarders = prefixes }
+}
+
+func NewRateLimiter(rps float64, burst int, opts ...LimiterOption) *RateLimiter {
 	rl := &RateLimiter{
-		clients: make(map[string]*client),
-		r:       rate.Limit(rps),
-		burst:   burst,
+		clients:    make(map[string]*list.Element),
+		r:          rate.Limit(rps),
+		burst:      burst,
+		maxClients: defaultMaxClients,
+		cleanup:    defaultCleanup,
+		staleAfter: defaultStaleAfter,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(rl)
 	}
-	// cleanup stale entries every minute
 	go func() {
+		defer close(rl.done)
+		t := time.NewTicker(rl.cleanup)
+		defer t.Stop()
 		for {
-			time.Sleep(time.Minute)
-			rl.mu.Lock()
-			for ip, c := range rl.clients {
-				if time.Since(c.seen) > 3*time.Minute {
-					delete(rl.clients, ip)
-				}
+			select {
+			case <-rl.stop:
+				return
+			case <-t.C:
 			}
-			rl.mu.Unlock()
+			rl.dropStale(time.Now())
 		}
 	}()
 	return rl
 }
 
-func (rl *RateLimiter) get(ip string) *rate.Limiter {
+// dropStale removes clients unseen since staleAfter before now. The list
+// is in seen order, so it stops at the first fresh one.
+func (rl *RateLimiter) dropStale(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for e := rl.lru.Back(); e != nil; e = rl.lru.Back() {
+		c := e.Value.(*client)
+		if now.Sub(c.seen) <= rl.staleAfter {
+			return
+		}
+		rl.remove(e)
+	}
+}
+
+func (rl *RateLimiter) remove(e *list.Element) {
+	rl.lru.Remove(e)
+	delete(rl.clients, e.Value.(*client).key)
+}
+
+// Close stops the cleanup goroutine and waits for it to exit.
+func (rl *RateLimiter) Close() {
+	rl.closeOnce.Do(func() { close(rl.stop) })
+	<-rl.done
+}
+
+// OnReject registers a callback for every rejected call, e.g. a metrics counter.
+func (rl *RateLimiter) OnReject(fn func(method string)) {
+	rl.onReject = fn
+}
+
+// Len is how many clients the limiter is tracking.
+func (rl *RateLimiter) Len() int {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
-	if c, ok := rl.clients[ip]; ok {
-		c.seen = time.Now()
+	return len(rl.clients)
+}
+
+func (rl *RateLimiter) get(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	if e, ok := rl.clients[key]; ok {
+		c := e.Value.(*client)
+		c.seen = now
+		rl.lru.MoveToFront(e)
 		return c.lim
 	}
-	l := rate.NewLimiter(rl.r, rl.burst)
-	rl.clients[ip] = &client{lim: l, seen: time.Now()}
-	return l
+	if len(rl.clients) >= rl.maxClients {
+		rl.remove(rl.lru.Back())
+	}
+	c := &client{key: key, lim: rate.NewLimiter(rl.r, rl.burst), seen: now}
+	rl.clients[key] = rl.lru.PushFront(c)
+	return c.lim
 }
 
-// methods that should be rate limited
-var limited = map[string]bool{
-	"/appointment.v1.ScheduleService/Register": true,
-	"/appointment.v1.ScheduleService/Login":    true,
+// ClientIP is the host part of the peer address: every connection from
+// one client shares a bucket, whatever its source port.
+func ClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// clientIP is ClientIP, or the forwarded IP on a call from a trusted
+// forwarder.
+func (rl *RateLimiter) clientIP(ctx context.Context) string {
+	ip := ClientIP(ctx)
+	if len(rl.forwarders) == 0 {
+		return ip
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !slices.ContainsFunc(rl.forwarders, func(p netip.Prefix) bool { return p.Contains(addr.Unmap()) }) {
+		return ip
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if vals := md.Get(ForwardedFor); len(vals) == 1 {
+		if fwd, err := netip.ParseAddr(vals[0]); err == nil {
+			return fwd.String()
+		}
+	}
+	return ip
+}
+
+// Limited reports whether calls to method are rate limited.
+func Limited(method string) bool {
+	p, _ := PolicyFor(method)
+	return p.RateLimitClass != NotLimited
+}
+
+// Allow takes a token from key's bucket for a call to method, reporting
+// whether there was one. For front ends that know the client by something
+// other than the grpc peer; RateLimit uses it with the peer's IP.
+func (rl *RateLimiter) Allow(key, method string) bool {
+	if rl.get(key).Allow() {
+		return true
+	}
+	if rl.onReject != nil {
+		rl.onReject(method)
+	}
+	return false
+}
+
+type chargedKey struct{}
+
+// Charged marks ctx as already counted against rl, so RateLimit(rl) lets
+// the call through instead of taking a second token for it.
+func Charged(ctx context.Context, rl *RateLimiter) context.Context {
+	return context.WithValue(ctx, chargedKey{}, rl)
 }
 
 func RateLimit(rl *RateLimiter) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
-		if !limited[info.FullMethod] {
+		if !Limited(info.FullMethod) {
 			return next(ctx, req)
 		}
-		ip := "unknown"
-		if p, ok := peer.FromContext(ctx); ok {
-			ip = p.Addr.String()
+		if by, _ := ctx.Value(chargedKey{}).(*RateLimiter); by == rl {
+			return next(ctx, req)
 		}
-		if !rl.get(ip).Allow() {
-			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		if !rl.Allow(rl.clientIP(ctx), info.FullMethod) {
+			return nil, apperr.New(apperr.RateLimited, "too many requests")
 		}
 		return next(ctx, req)
 	}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"schedule-management-api/internal/apperr"
+)
+
+func TestRateLimiterCloseStopsCleanup(t *testing.T) {
+	rl := NewRateLimiter(1, 1)
+	done := make(chan struct{})
+	go func() {
+		rl.Close()
+		rl.Close() // idempotent
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't stop the cleanup goroutine")
+	}
+}
+
+func TestRateLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	rl := NewRateLimiter(1, 1, WithMaxClients(3))
+	defer rl.Close()
+
+	a := rl.get("a")
+	rl.get("b")
+	rl.get("c")
+	rl.get("a") // a is now the most recent, b the least
+	rl.get("d")
+	if n := rl.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	if _, ok := rl.clients["b"]; ok {
+		t.Error("b should have been evicted")
+	}
+	if rl.get("a") != a {
+		t.Error("a lost its bucket")
+	}
+}
+
+func TestRateLimiterDropsStale(t *testing.T) {
+	rl := NewRateLimiter(1, 1, WithCleanup(time.Hour, time.Minute))
+	defer rl.Close()
+	rl.get("old")
+	rl.clients["old"].Value.(*client).seen = time.Now().Add(-2 * time.Minute)
+	rl.get("new")
+
+	rl.dropStale(time.Now())
+	if _, ok := rl.clients["old"]; ok || rl.Len() != 1 {
+		t.Errorf("after cleanup: %d clients, old present=%v", rl.Len(), ok)
+	}
+}
+
+func TestRateLimiterCleanupRuns(t *testing.T) {
+	rl := NewRateLimiter(1, 1, WithCleanup(5*time.Millisecond, time.Millisecond))
+	defer rl.Close()
+	rl.get("x")
+	deadline := time.Now().Add(time.Second)
+	for rl.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stale client never cleaned up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientIPIgnoresPort(t *testing.T) {
+	at := func(addr net.Addr) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	}
+	cases := map[string]context.Context{
+		"10.0.0.1":    at(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 51234}),
+		"2001:db8::1": at(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}),
+		"bufconn":     at(fakeAddr("bufconn")),
+		"unknown":     context.Background(),
+	}
+	for want, ctx := range cases {
+		if got := ClientIP(ctx); got != want {
+			t.Errorf("ClientIP = %q, want %q", got, want)
+		}
+	}
+
+	// two connections from one host share a bucket
+	rl := NewRateLimiter(0.001, 1)
+	defer rl.Close()
+	interceptor := RateLimit(rl)
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.AuthService/Login"}
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := interceptor(at(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}), nil, info, ok); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interceptor(at(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1001}), nil, info, ok); apperr.ReasonOf(err) != apperr.RateLimited {
+		t.Errorf("new port got a fresh bucket: %v", err)
+	}
+}
+
+// a call a front end already charged to rl passes RateLimit(rl) free, but
+// not a limiter it wasn't charged to
+func TestRateLimitCharged(t *testing.T) {
+	rl := NewRateLimiter(0.001, 1)
+	defer rl.Close()
+	other := NewRateLimiter(0.001, 1)
+	defer other.Close()
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.AuthService/Login"}
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1")}})
+
+	if !rl.Allow("10.0.0.1", info.FullMethod) || rl.Allow("10.0.0.1", info.FullMethod) {
+		t.Fatal("Allow didn't spend the one token")
+	}
+	if _, err := RateLimit(rl)(Charged(ctx, rl), nil, info, ok); err != nil {
+		t.Errorf("charged call: %v", err)
+	}
+	if _, err := RateLimit(rl)(ctx, nil, info, ok); apperr.ReasonOf(err) != apperr.RateLimited {
+		t.Errorf("uncharged call: %v", err)
+	}
+	if _, err := RateLimit(other)(Charged(ctx, rl), nil, info, ok); err != nil {
+		t.Fatalf("first call on other: %v", err)
+	}
+	if _, err := RateLimit(other)(Charged(ctx, rl), nil, info, ok); apperr.ReasonOf(err) != apperr.RateLimited {
+		t.Errorf("charged to rl, passed other: %v", err)
+	}
+}
+
+// the forwarded IP counts only on a call from a trusted forwarder
+func TestRateLimitTrustedForwarders(t *testing.T) {
+	rl := NewRateLimiter(0.001, 1, WithTrustedForwarders(netip.MustParsePrefix("10.0.0.0/24")))
+	defer rl.Close()
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.AuthService/Login"}
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(from, fwd string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(from), Port: 1000}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ForwardedFor, fwd))
+		_, err := RateLimit(rl)(ctx, nil, info, ok)
+		return err
+	}
+
+	for _, browser := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := call("10.0.0.5", browser); err != nil {
+			t.Errorf("%s through the bridge: %v", browser, err)
+		}
+	}
+	if err := call("10.0.0.5", "192.0.2.1"); apperr.ReasonOf(err) != apperr.RateLimited {
+		t.Errorf("same browser again: %v", err)
+	}
+	// anyone else claiming a forwarded IP is charged for themselves
+	if err := call("198.51.100.1", "192.0.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := call("198.51.100.1", "192.0.2.4"); apperr.ReasonOf(err) != apperr.RateLimited {
+		t.Errorf("untrusted peer picked its own bucket: %v", err)
+	}
+}
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "fake" }
+func (a fakeAddr) String() string  { return string(a) }
+
+// a million distinct sources (a spoofed flood) leave at most maxClients
+// behind, and the heap doesn't grow with the key count
+func TestRateLimiterBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("1M keys")
+	}
+	const max = 1000
+	rl := NewRateLimiter(1, 1, WithMaxClients(max))
+	defer rl.Close()
+
+	heap := func() uint64 {
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+	for i := range max {
+		rl.get(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255))
+	}
+	before := heap()
+	for i := range 1_000_000 {
+		rl.get(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255) + "x")
+	}
+	after := heap()
+
+	if n := rl.Len(); n != max {
+		t.Errorf("Len = %d, want %d", n, max)
+	}
+	if rl.lru.Len() != max {
+		t.Errorf("lru has %d entries", rl.lru.Len())
+	}
+	// an unbounded map of 1M limiters is well over 100MB
+	if after > before+4<<20 {
+		t.Errorf("heap grew from %d to %d bytes", before, after)
+	}
+}
+
+func BenchmarkRateLimiterDistinctKeys(b *testing.B) {
+	rl := NewRateLimiter(1, 1, WithMaxClients(10_000))
+	defer rl.Close()
+	b.ReportAllocs()
+	for i := range b.N {
+		rl.get(strconv.Itoa(i))
+	}
+	b.ReportMetric(float64(rl.Len()), "clients")
+}
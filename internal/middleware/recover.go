@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+
+	"schedule-management-api/internal/apperr"
+)
+
+// Recover turns a panic in anything after it into an Internal error for
+// that one call, logging the panic and stack with the method and, once
+// Auth has run, the user. It goes first in the chain. The client only
+// sees "internal error".
+func Recover(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (resp any, err error) {
+		ci, ok := ctx.Value(logKey{}).(*callInfo)
+		if !ok {
+			ci = &callInfo{}
+			ctx = context.WithValue(ctx, logKey{}, ci)
+		}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			attrs := []slog.Attr{
+				slog.String("method", info.FullMethod),
+				slog.Any("panic", p),
+				slog.String("stack", string(debug.Stack())),
+			}
+			if ci.userID != "" {
+				attrs = append(attrs, slog.String("user_id", ci.userID))
+			}
+			logger.LogAttrs(ctx, slog.LevelError, "panic", attrs...)
+			resp, err = nil, apperr.New(apperr.Internal, "internal error")
+		}()
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "schedule-management-api/gen/appointment/v1"
+	"schedule-management-api/internal/auth"
+)
+
+// panicky serves GetAppointment by panicking and GetServerInfo normally.
+type panicky struct {
+	pb.UnimplementedScheduleServiceServer
+}
+
+func (panicky) GetAppointment(ctx context.Context, req *pb.GetAppointmentRequest) (*pb.GetAppointmentResponse, error) {
+	var m map[string]int
+	m[req.Id] = 1 // assignment to a nil map
+	return nil, nil
+}
+
+func (panicky) GetServerInfo(context.Context, *pb.GetServerInfoRequest) (*pb.ServerInfo, error) {
+	return &pb.ServerInfo{}, nil
+}
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		Recover(logger),
+		Logging(logger, false),
+		Auth(auth.SingleKey("test-secret"), auth.Config{}),
+	))
+	pb.RegisterScheduleServiceServer(srv, panicky{})
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewScheduleServiceClient(conn)
+
+	tok, _ := auth.MakeToken("user-1", auth.RoleUser, "test-secret")
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tok)
+	for range 2 {
+		_, err := client.GetAppointment(ctx, &pb.GetAppointmentRequest{Id: "a1"})
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("panicking call: %v", err)
+		}
+		if msg := status.Convert(err).Message(); strings.Contains(msg, "nil map") {
+			t.Errorf("panic leaked to the client: %q", msg)
+		}
+	}
+	// still serving
+	if _, err := client.GetServerInfo(ctx, &pb.GetServerInfoRequest{}); err != nil {
+		t.Errorf("after the panic: %v", err)
+	}
+
+	log := buf.String()
+	for _, want := range []string{`"msg":"panic"`, "nil map", "/appointment.v1.ScheduleService/GetAppointment", `"user_id":"user-1"`, "recover_test.go"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log has no %s: %s", want, log)
+		}
+	}
+}
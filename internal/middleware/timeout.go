@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"schedule-management-api/internal/apperr"
+)
+
+// Timeout gives every call a deadline: per[method] if it's listed, def
+// otherwise, and 0 for none. A sooner deadline from the client still
+// wins. Once the deadline passes (or the client goes away) whatever the
+// handler returns, usually Internal from a query that was cut off, is
+// replaced by DeadlineExceeded or Canceled so a slow call isn't reported
+// as a broken one.
+func Timeout(def time.Duration, per map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		d, ok := per[info.FullMethod]
+		if !ok {
+			d = def
+		}
+		if d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		resp, err := next(ctx, req)
+		if err != nil {
+			if cerr := apperr.FromContext(ctx.Err()); cerr != nil {
+				return nil, cerr
+			}
+		}
+		return resp, err
+	}
+}
+
+// ParseTimeouts reads REQUEST_TIMEOUTS: comma-separated method=duration
+// pairs, e.g. "AdminService/SearchAllAppointments=30s". A method without
+// a leading slash is in appointment.v1.
+func ParseTimeouts(s string) (map[string]time.Duration, error) {
+	per := map[string]time.Duration{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		method, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want method=duration", part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(val))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%q: bad duration", part)
+		}
+		method = strings.TrimSpace(method)
+		if !strings.HasPrefix(method, "/") {
+			method = "/appointment.v1." + method
+		}
+		per[method] = d
+	}
+	return per, nil
+}
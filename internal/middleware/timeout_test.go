@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+)
+
+func TestTimeout(t *testing.T) {
+	ic := Timeout(5*time.Second, map[string]time.Duration{"/svc/Slow": time.Minute, "/svc/Open": 0})
+	deadline := func(method string) time.Duration {
+		var left time.Duration
+		ic(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+			if d, ok := ctx.Deadline(); ok {
+				left = time.Until(d)
+			}
+			return nil, nil
+		})
+		return left
+	}
+	if d := deadline("/svc/Fast"); d <= 4*time.Second || d > 5*time.Second {
+		t.Errorf("default: %s left", d)
+	}
+	if d := deadline("/svc/Slow"); d <= 59*time.Second {
+		t.Errorf("override: %s left", d)
+	}
+	if d := deadline("/svc/Open"); d != 0 {
+		t.Errorf("unbounded: %s left", d)
+	}
+
+	// a store failure after the deadline is reported as the deadline
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	internal := func(ctx context.Context, _ any) (any, error) {
+		return nil, apperr.New(apperr.Internal, "internal error")
+	}
+	conflict := func(ctx context.Context, _ any) (any, error) {
+		return nil, apperr.New(apperr.ApptConflict, "time conflicts with existing appointment")
+	}
+	for _, next := range []grpc.UnaryHandler{internal, conflict} {
+		_, err := ic(expired, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Fast"}, next)
+		if status.Code(err) != codes.DeadlineExceeded || apperr.ReasonOf(err) != apperr.DeadlineExceeded {
+			t.Errorf("expired: %v", err)
+		}
+	}
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ic(gone, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Fast"}, internal); apperr.ReasonOf(err) != apperr.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+	// and before it, errors pass through
+	if _, err := ic(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Fast"}, conflict); apperr.ReasonOf(err) != apperr.ApptConflict {
+		t.Errorf("in time: %v", err)
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	per, err := ParseTimeouts(" AdminService/SearchAllAppointments=30s, /grpc.health.v1.Health/Check=1s,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if per["/appointment.v1.AdminService/SearchAllAppointments"] != 30*time.Second || per["/grpc.health.v1.Health/Check"] != time.Second || len(per) != 2 {
+		t.Errorf("got %v", per)
+	}
+	if per, err := ParseTimeouts(""); err != nil || len(per) != 0 {
+		t.Errorf("empty: %v %v", per, err)
+	}
+	for _, bad := range []string{"AuthService/Login", "AuthService/Login=soon", "AuthService/Login=-1s"} {
+		if _, err := ParseTimeouts(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
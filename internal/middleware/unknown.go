@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"google.golang.org/grpc"
+
+	"schedule-management-api/internal/apperr"
+)
+
+// UnknownMethod answers calls to a service or method the server doesn't
+// have, which grpc would otherwise fail with a bare Unimplemented. Install
+// it with grpc.UnknownServiceHandler.
+func UnknownMethod(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	return apperr.Newf(apperr.MethodUnknown, "unknown method %s", method)
+}
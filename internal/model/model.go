@@ -7,8 +7,12 @@ type User struct {
 	Email        string
 	PasswordHash string
 	Name         string
+	Role         string // auth.RoleUser or auth.RoleAdmin
+	Verified     bool   // email address confirmed
+	OrgID        string // "" = not in an organization
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
+	DeletedAt    *time.Time
 }
 
 type Appointment struct {
@@ -23,4 +27,190 @@ type Appointment struct {
 	AttendeeIDs []string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	// on create only: remind the owner this long before the start, 0 = don't
+	RemindBefore time.Duration
+
+	// on create and update only: keep this much free between a timed
+	// appointment and the owner's other timed ones, 0 = no buffer
+	Buffer time.Duration
+
+	// "" on create/update means the default calendar / leave it where it is
+	CalendarID string
+
+	// a shared room or piece of equipment, "" = none
+	ResourceID string
+
+	// lower-case labels, no duplicates
+	Tags []string
+
+	// how many others may join as attendees themselves; 0 = private, only
+	// the owner adds attendees
+	Capacity int
+
+	// how often RescheduleAppointment moved it; read only
+	RescheduleCount int
+
+	// runs from a midnight to a later one in TimeZone, and doesn't keep
+	// timed appointments out
+	AllDay bool
+
+	// IANA name the appointment's days are in, "" = UTC
+	TimeZone string
+
+	// the owner's organization when it was created, "" = none; set by the
+	// store
+	OrgID string
+}
+
+// Reschedule is one move made by RescheduleAppointment.
+type Reschedule struct {
+	AppointmentID string
+	OldStart      time.Time
+	OldEnd        time.Time
+	NewStart      time.Time
+	NewEnd        time.Time
+	RescheduledBy string // "" once that user is gone
+	Reason        string
+	RescheduledAt time.Time
+}
+
+// Resource is something everyone books: a meeting room, a projector.
+type Resource struct {
+	ID          string
+	Name        string
+	Description string
+	CreatedAt   time.Time
+}
+
+// Organization is a group of users who see each other's appointments.
+type Organization struct {
+	ID        string
+	Name      string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// OrgMember is a user's place in an organization, with their name and
+// email for member lists.
+type OrgMember struct {
+	OrgID    string
+	UserID   string
+	Name     string
+	Email    string
+	Role     string // "member" or "owner"
+	JoinedAt time.Time
+}
+
+// OrgInvite asks whoever signs in as Email to join OrgID as Role.
+type OrgInvite struct {
+	ID        string
+	OrgID     string
+	Email     string
+	Role      string
+	TokenHash string
+	InvitedBy string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type Calendar struct {
+	ID        string
+	UserID    string
+	Name      string
+	Color     string // "#rrggbb" or ""
+	IsDefault bool
+	CreatedAt time.Time
+}
+
+type ShareLink struct {
+	ID                 string
+	AppointmentID      string
+	TokenHash          string
+	IncludeDescription bool
+	IncludeAttendees   bool
+	ExpiresAt          time.Time
+	CreatedAt          time.Time
+}
+
+// FreezeWindow blocks new bookings in [Start, End).
+type FreezeWindow struct {
+	ID        string
+	Start     time.Time
+	End       time.Time
+	Scope     string
+	Reason    string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// Reminder is a claimed, due reminder with what's needed to deliver it.
+type Reminder struct {
+	ID          string
+	UserID      string
+	Email       string
+	RemindAt    time.Time
+	Appointment Appointment
+}
+
+// Webhook is where a user's appointment changes get posted. Last* describe
+// the most recent delivery attempt; LastStatus is 0 without a response.
+type Webhook struct {
+	ID            string
+	UserID        string
+	URL           string
+	Secret        string
+	Enabled       bool
+	CreatedAt     time.Time
+	LastAttemptAt *time.Time
+	LastStatus    int
+	LastError     string
+	LastSuccessAt *time.Time
+}
+
+// WebhookDelivery is a claimed outbox row with what's needed to send it.
+// Attempts counts this one.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID string
+	URL       string
+	Secret    string
+	Event     string
+	Payload   []byte
+	Attempts  int
+}
+
+// OutboxEvent is a claimed events outbox row. ID is what consumers dedup
+// on; Attempts counts this one.
+type OutboxEvent struct {
+	ID          string
+	Seq         int64
+	Type        string
+	AggregateID string
+	Payload     []byte
+	CreatedAt   time.Time
+	Attempts    int
+}
+
+// Availability is when a user takes bookings. No windows means any time.
+type Availability struct {
+	UserID    string
+	TimeZone  string
+	Windows   []AvailabilityWindow
+	Enforce   bool // reject creates and moves outside the windows
+	UpdatedAt time.Time
+}
+
+// Preferences are a user's scheduling settings.
+type Preferences struct {
+	UserID        string
+	BufferMinutes int // kept free before and after each confirmed appointment
+	UpdatedAt     time.Time
+}
+
+// AvailabilityWindow is stored as JSON in user_availability.windows.
+type AvailabilityWindow struct {
+	Weekday int `json:"weekday"` // 0 = Sunday
+	Start   int `json:"start"`   // minutes since midnight
+	End     int `json:"end"`     // at or before Start runs past midnight
 }
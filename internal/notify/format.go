@@ -0,0 +1,141 @@
+// Package notify renders appointment details for outgoing messages and
+// hands them to whatever delivers them.
+//
+// Every message that shows an appointment's time (reminders now;
+// confirmations, cancellations and reschedules as they're added) goes
+// through the formatting here so times are shown in the recipient's zone
+// and language rather than as raw UTC.
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // alpine image ships without zoneinfo
+)
+
+// Prefs are the recipient's display settings. Zero values fall back to
+// the appointment's zone (then UTC), English, and a 24h clock.
+type Prefs struct {
+	TimeZone string // IANA name, e.g. "Africa/Lagos"
+	Locale   string // "en", "fr", ...
+	Hour12   bool
+}
+
+type locale struct {
+	days   [7]string  // Sunday first, matches time.Weekday
+	months [12]string // January first
+	daySep string     // between weekday and day of month
+	am, pm string
+}
+
+var locales = map[string]locale{
+	"en": {
+		days:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		months: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		daySep: ", ",
+		am:     "AM", pm: "PM",
+	},
+	"fr": {
+		days:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		months: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		daySep: " ",
+		am:     "AM", pm: "PM",
+	},
+}
+
+// Location resolves the zone to render in: recipient first, then the
+// appointment's own zone, then UTC. Unknown names are skipped.
+func Location(p Prefs, apptZone string) *time.Location {
+	for _, name := range []string{p.TimeZone, apptZone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+func lookup(tag string) locale {
+	// "fr-FR" -> "fr"
+	tag = strings.ToLower(tag)
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		tag = tag[:i]
+	}
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	return locales["en"]
+}
+
+// FormatRange renders an appointment slot, e.g.
+//
+//	Tue, 14 May, 15:00–15:45 (WAT)
+//
+// Slots that end on a different local day repeat the date on the end side.
+// The zone abbreviation is taken from the start instant, and the end's is
+// added too if a DST change falls inside the slot.
+func FormatRange(start, end time.Time, p Prefs, apptZone string) string {
+	loc := Location(p, apptZone)
+	l := lookup(p.Locale)
+	s, e := start.In(loc), end.In(loc)
+
+	out := l.date(s) + ", " + l.clock(s, p.Hour12)
+	if sameDay(s, e) {
+		out += "–" + l.clock(e, p.Hour12)
+	} else {
+		out += " – " + l.date(e) + ", " + l.clock(e, p.Hour12)
+	}
+
+	sz, ez := s.Format("MST"), e.Format("MST")
+	if sz != ez {
+		return fmt.Sprintf("%s (%s/%s)", out, sz, ez)
+	}
+	return fmt.Sprintf("%s (%s)", out, sz)
+}
+
+// FormatDays renders an all-day event's dates, e.g.
+//
+//	Tue, 14 May
+//	Tue, 14 May – Thu, 16 May
+//
+// end being the midnight after the last day. Dates are the appointment's
+// own, whatever zone the recipient is in: a holiday on the 14th is on the
+// 14th everywhere.
+func FormatDays(start, end time.Time, p Prefs, apptZone string) string {
+	loc := Location(Prefs{}, apptZone)
+	l := lookup(p.Locale)
+	s, e := start.In(loc), end.In(loc).AddDate(0, 0, -1)
+	if !e.After(s) || sameDay(s, e) {
+		return l.date(s)
+	}
+	return l.date(s) + " – " + l.date(e)
+}
+
+// FormatReschedule renders the old -> new diff used by reschedule notices.
+func FormatReschedule(oldStart, oldEnd, newStart, newEnd time.Time, p Prefs, apptZone string) string {
+	return FormatRange(oldStart, oldEnd, p, apptZone) + " → " + FormatRange(newStart, newEnd, p, apptZone)
+}
+
+func (l locale) date(t time.Time) string {
+	return fmt.Sprintf("%s%s%d %s", l.days[t.Weekday()], l.daySep, t.Day(), l.months[t.Month()-1])
+}
+
+func (l locale) clock(t time.Time, hour12 bool) string {
+	if !hour12 {
+		return t.Format("15:04")
+	}
+	suffix := l.am
+	if t.Hour() >= 12 {
+		suffix = l.pm
+	}
+	return t.Format("3:04") + " " + suffix
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
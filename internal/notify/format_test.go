@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func TestFormatRangeGolden(t *testing.T) {
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		name       string
+		start, end time.Time
+		apptZone   string
+	}{
+		{"lagos", utc("2024-05-14T14:00:00Z"), utc("2024-05-14T14:45:00Z"), ""},
+		{"cross_midnight", utc("2024-05-14T22:30:00Z"), utc("2024-05-15T00:15:00Z"), ""},
+		// Europe/Paris springs forward 2024-03-31 02:00 local
+		{"dst_boundary", utc("2024-03-31T00:30:00Z"), utc("2024-03-31T01:30:00Z"), ""},
+		{"appt_zone_fallback", utc("2024-05-14T14:00:00Z"), utc("2024-05-14T15:00:00Z"), "America/New_York"},
+	}
+	recipients := []struct {
+		name  string
+		prefs Prefs
+	}{
+		{"en_24h", Prefs{TimeZone: "Africa/Lagos", Locale: "en"}},
+		{"en_12h", Prefs{TimeZone: "Africa/Lagos", Locale: "en-GB", Hour12: true}},
+		{"fr_paris", Prefs{TimeZone: "Europe/Paris", Locale: "fr-FR"}},
+		{"no_prefs", Prefs{}},
+	}
+
+	var b strings.Builder
+	for _, r := range recipients {
+		for _, c := range cases {
+			b.WriteString(r.name + "/" + c.name + ": " + FormatRange(c.start, c.end, r.prefs, c.apptZone) + "\n")
+		}
+	}
+	old := [2]time.Time{utc("2024-05-14T14:00:00Z"), utc("2024-05-14T14:45:00Z")}
+	b.WriteString("reschedule: " + FormatReschedule(old[0], old[1], old[0].Add(24*time.Hour), old[1].Add(24*time.Hour),
+		Prefs{TimeZone: "Africa/Lagos"}, "") + "\n")
+
+	golden := filepath.Join("testdata", "format.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden (run with -update): %v", err)
+	}
+	if got := b.String(); got != string(want) {
+		t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestLocationFallback(t *testing.T) {
+	if got := Location(Prefs{TimeZone: "Not/AZone"}, "Europe/Paris").String(); got != "Europe/Paris" {
+		t.Errorf("bad recipient zone should fall back to appointment zone, got %s", got)
+	}
+	if got := Location(Prefs{}, ""); got != time.UTC {
+		t.Errorf("expected UTC, got %s", got)
+	}
+}
+
+// an all-day event's dates are its own, not the recipient's
+func TestFormatDays(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	day := time.Date(2024, 5, 14, 0, 0, 0, 0, tokyo)
+	for _, tt := range []struct {
+		end   time.Time
+		prefs Prefs
+		want  string
+	}{
+		{day.AddDate(0, 0, 1), Prefs{TimeZone: "America/New_York"}, "Tue, 14 May"},
+		{day.AddDate(0, 0, 3), Prefs{Locale: "fr"}, "mar. 14 mai – jeu. 16 mai"},
+	} {
+		if got := FormatDays(day, tt.end, tt.prefs, "Asia/Tokyo"); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"schedule-management-api/internal/model"
+)
+
+// Notifier delivers a due reminder. Email and push plug in here; the
+// reminder worker never knows which one is wired.
+type Notifier interface {
+	Remind(ctx context.Context, r model.Reminder) error
+}
+
+// LogNotifier writes reminders to the server log instead of delivering them.
+type LogNotifier struct{}
+
+func (LogNotifier) Remind(_ context.Context, r model.Reminder) error {
+	a := r.Appointment
+	log.Printf("reminder to=%s appointment=%s %q %s", r.Email, a.ID, a.Title, When(a, Prefs{}))
+	return nil
+}
+
+// MailNotifier emails reminders to the owner through Sender.
+type MailNotifier struct {
+	Sender Sender
+}
+
+func (n MailNotifier) Remind(ctx context.Context, r model.Reminder) error {
+	a := r.Appointment
+	body := fmt.Sprintf("Hi,\n\nThis is a reminder of %q, %s.\n", a.Title, When(a, Prefs{}))
+	if a.Location != "" {
+		body += "Where: " + a.Location + "\n"
+	}
+	return n.Sender.Send(ctx, r.Email, "Reminder: "+a.Title, body)
+}
+
+// When renders when a is for p: its days if it's all day, else its slot.
+func When(a model.Appointment, p Prefs) string {
+	if a.AllDay {
+		return FormatDays(a.StartTime, a.EndTime, p, a.TimeZone)
+	}
+	return FormatRange(a.StartTime, a.EndTime, p, a.TimeZone)
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+type outbox struct{ to, subject, body string }
+
+func (o *outbox) Send(_ context.Context, to, subject, body string) error {
+	o.to, o.subject, o.body = to, subject, body
+	return nil
+}
+
+func TestMailNotifier(t *testing.T) {
+	start := time.Date(2024, 5, 14, 14, 0, 0, 0, time.UTC)
+	r := model.Reminder{Email: "a@test.com", Appointment: model.Appointment{
+		Title: "Dentist", Location: "Ikeja", StartTime: start, EndTime: start.Add(45 * time.Minute), TimeZone: "Africa/Lagos",
+	}}
+	out := &outbox{}
+	if err := (MailNotifier{Sender: out}).Remind(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if out.to != "a@test.com" || out.subject != "Reminder: Dentist" {
+		t.Errorf("sent to %q with subject %q", out.to, out.subject)
+	}
+	// in the appointment's zone, not UTC
+	for _, want := range []string{`"Dentist"`, "Tue, 14 May, 15:00–15:45 (WAT)", "Where: Ikeja"} {
+		if !strings.Contains(out.body, want) {
+			t.Errorf("body lacks %q:\n%s", want, out.body)
+		}
+	}
+
+	r.Appointment.AllDay = true
+	r.Appointment.StartTime = time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+	r.Appointment.EndTime = r.Appointment.StartTime.AddDate(0, 0, 1)
+	r.Appointment.TimeZone = ""
+	MailNotifier{Sender: out}.Remind(context.Background(), r)
+	if !strings.Contains(out.body, "Tue, 14 May.") {
+		t.Errorf("all-day body:\n%s", out.body)
+	}
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Sender delivers a message to one recipient. Email/SMS providers plug in
+// here; the handler never knows which one is wired.
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogSender writes messages to the server log instead of delivering them.
+// Dev only — bodies can contain reset links and other secrets.
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, to, subject, body string) error {
+	log.Printf("mail to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
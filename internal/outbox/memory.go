@@ -0,0 +1,41 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a Publisher that keeps what it's given, for tests and local
+// runs. Fail makes the next publishes fail.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+	failures int
+	err      error
+}
+
+// Publish records m, or fails if a failure is pending.
+func (p *Memory) Publish(_ context.Context, m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return p.err
+	}
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+// Fail makes the next n publishes return err.
+func (p *Memory) Fail(n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures, p.err = n, err
+}
+
+// Messages is everything published so far, in order.
+func (p *Memory) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
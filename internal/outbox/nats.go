@@ -0,0 +1,54 @@
+//go:build nats
+
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes to JetStream as <prefix>.<type>, e.g.
+// "schedule.events.appointment.created". The event ID goes in
+// Nats-Msg-Id as well as the body, so the stream drops a republished
+// event within its duplicate window. Some stream has to cover the
+// subjects; without one, publishes fail (and are retried).
+type NATS struct {
+	nc     *nats.Conn
+	js     nats.JetStreamContext
+	prefix string
+}
+
+// DialNATS connects to the server(s) at url, reconnecting for as long as
+// the process runs.
+func DialNATS(url, prefix string) (*NATS, error) {
+	nc, err := nats.Connect(url,
+		nats.Name("schedule-management-api"),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	return &NATS{nc: nc, js: js, prefix: prefix}, nil
+}
+
+// Publish waits for the stream's ack.
+func (p *NATS) Publish(ctx context.Context, m Message) error {
+	msg := nats.NewMsg(p.prefix + "." + m.Type)
+	msg.Data = m.Body()
+	msg.Header.Set("Content-Type", "application/json")
+	_, err := p.js.PublishMsg(msg, nats.MsgId(m.ID), nats.Context(ctx))
+	return err
+}
+
+// Close flushes and closes the connection.
+func (p *NATS) Close() error {
+	return p.nc.Drain()
+}
@@ -0,0 +1,24 @@
+//go:build !nats
+
+package outbox
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoNATS is what DialNATS returns in a binary built without the nats
+// tag.
+var ErrNoNATS = errors.New("built without NATS support (go build -tags nats)")
+
+// NATS stands in for the JetStream publisher in builds without it.
+type NATS struct{}
+
+// DialNATS fails with ErrNoNATS; build with -tags nats for the real one.
+func DialNATS(url, prefix string) (*NATS, error) {
+	return nil, ErrNoNATS
+}
+
+func (p *NATS) Publish(ctx context.Context, m Message) error { return ErrNoNATS }
+
+func (p *NATS) Close() error { return nil }
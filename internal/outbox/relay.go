@@ -0,0 +1,189 @@
+// Package outbox publishes the events outbox (appointment changes written
+// in their own transactions) to a message bus for other services.
+// Delivery is at least once: an event is marked published only after the
+// Publisher took it, so a crash in between sends it again, and consumers
+// dedup on Message.ID. One appointment's events go out in order.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+const (
+	defaultInterval    = 5 * time.Second
+	defaultBaseBackoff = time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+	publishTimeout     = 10 * time.Second
+	batchSize          = 100
+	// how long a claimed event is left alone; longer than a publish can take
+	lease = 2 * publishTimeout
+)
+
+// Message is one event as published.
+type Message struct {
+	ID          string // the event's ID, for consumers to dedup on
+	Type        string // e.g. appointment.rescheduled
+	AggregateID string // the appointment's ID
+	CreatedAt   time.Time
+	Payload     json.RawMessage // what a webhook for the change would carry
+}
+
+// Body is the message as JSON, the ID included, for publishers that send
+// bytes.
+func (m Message) Body() []byte {
+	b, _ := json.Marshal(struct {
+		ID          string          `json:"id"`
+		Type        string          `json:"type"`
+		AggregateID string          `json:"aggregate_id"`
+		CreatedAt   time.Time       `json:"created_at"`
+		Payload     json.RawMessage `json:"payload"`
+	}{m.ID, m.Type, m.AggregateID, m.CreatedAt.UTC(), m.Payload})
+	return b
+}
+
+// Publisher hands messages to a bus. Publish returns once the bus has
+// the message, or an error, in which case it's tried again later.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// Store is where events are claimed from and reported back to
+// (store.Store).
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	OutboxPublished(ctx context.Context, id string) error
+	OutboxFailed(ctx context.Context, id, msg string, retryAt time.Time) error
+}
+
+type Relay struct {
+	store       Store
+	pub         Publisher
+	interval    time.Duration
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	onRun func(err error)
+}
+
+type Option func(*Relay)
+
+// WithInterval polls the outbox every interval (5s if zero).
+func WithInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// WithBackoff waits base after an event's first failed publish, doubling
+// per attempt up to max (1s and 5m by default). Events are never given up
+// on.
+func WithBackoff(base, max time.Duration) Option {
+	return func(r *Relay) {
+		if base > 0 {
+			r.baseBackoff = base
+		}
+		if max > 0 {
+			r.maxBackoff = max
+		}
+	}
+}
+
+func NewRelay(st Store, pub Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:       st,
+		pub:         pub,
+		interval:    defaultInterval,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// OnRun registers a callback for the end of every Tick, with the claim
+// error or the last reporting error, e.g. a diagnostics tracker. Failed
+// publishes aren't errors here; the events wait for their retry.
+func (r *Relay) OnRun(fn func(err error)) {
+	r.onRun = fn
+}
+
+// Run publishes events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		r.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Tick publishes everything currently due. A claim gives at most one
+// event per appointment, so it claims again until nothing's left: an
+// appointment with several pending events gets one more out each round.
+// Events are published one at a time in the order claimed.
+func (r *Relay) Tick(ctx context.Context) {
+	var failed error
+	defer func() {
+		if r.onRun != nil {
+			r.onRun(failed)
+		}
+	}()
+	for ctx.Err() == nil {
+		due, err := r.store.ClaimOutboxEvents(ctx, batchSize, lease)
+		if err != nil {
+			log.Printf("outbox: claim: %v", err)
+			failed = fmt.Errorf("claim: %w", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for _, e := range due {
+			if err := r.publish(ctx, e); err != nil {
+				log.Printf("outbox: record event %s: %v", e.ID, err)
+				failed = fmt.Errorf("record %s: %w", e.ID, err)
+			}
+		}
+	}
+}
+
+// publish sends one event and reports how it went. The error is from
+// reporting, not publishing.
+func (r *Relay) publish(ctx context.Context, e model.OutboxEvent) error {
+	pctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	err := r.pub.Publish(pctx, Message{
+		ID:          e.ID,
+		Type:        e.Type,
+		AggregateID: e.AggregateID,
+		CreatedAt:   e.CreatedAt,
+		Payload:     e.Payload,
+	})
+	cancel()
+	if err == nil {
+		return r.store.OutboxPublished(ctx, e.ID)
+	}
+	return r.store.OutboxFailed(ctx, e.ID, err.Error(), time.Now().Add(r.backoff(e.Attempts)))
+}
+
+// backoff is how long to wait after the attempts-th failure.
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.baseBackoff
+	for i := 1; i < attempts && wait < r.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, r.maxBackoff)
+}
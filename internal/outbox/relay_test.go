@@ -0,0 +1,192 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+// fakeStore hands out events the way the store does, at most the oldest
+// pending one per appointment, except that retryAt is compared with a
+// clock the test moves.
+type fakeStore struct {
+	mu   sync.Mutex
+	now  time.Time
+	rows []*row // by seq
+}
+
+type row struct {
+	ev        model.OutboxEvent
+	published bool
+	claimed   bool
+	retryAt   time.Time
+	lastError string
+}
+
+func (s *fakeStore) add(aggregate, typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := int64(len(s.rows) + 1)
+	s.rows = append(s.rows, &row{ev: model.OutboxEvent{
+		ID: fmt.Sprintf("ev-%d", seq), Seq: seq, Type: typ, AggregateID: aggregate,
+		Payload: json.RawMessage(`{"n":` + fmt.Sprint(seq) + `}`),
+	}})
+}
+
+func (s *fakeStore) ClaimOutboxEvents(_ context.Context, limit int, _ time.Duration) ([]model.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.OutboxEvent
+	seen := map[string]bool{}
+	for _, r := range s.rows {
+		if r.published {
+			continue
+		}
+		head := !seen[r.ev.AggregateID]
+		seen[r.ev.AggregateID] = true
+		if !head || r.claimed || r.retryAt.After(s.now) || len(out) == limit {
+			continue
+		}
+		r.claimed = true
+		r.ev.Attempts++
+		out = append(out, r.ev)
+	}
+	return out, nil
+}
+
+func (s *fakeStore) OutboxPublished(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.find(id)
+	r.published, r.claimed = true, false
+	return nil
+}
+
+func (s *fakeStore) OutboxFailed(_ context.Context, id, msg string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.find(id)
+	r.claimed, r.lastError, r.retryAt = false, msg, retryAt
+	return nil
+}
+
+func (s *fakeStore) find(id string) *row {
+	for _, r := range s.rows {
+		if r.ev.ID == id {
+			return r
+		}
+	}
+	panic(id)
+}
+
+// ids is what pub got, as event IDs, for one appointment or all.
+func ids(pub *Memory, aggregate string) []string {
+	var out []string
+	for _, m := range pub.Messages() {
+		if aggregate == "" || m.AggregateID == aggregate {
+			out = append(out, m.ID)
+		}
+	}
+	return out
+}
+
+func TestFailedPublishIsRetried(t *testing.T) {
+	st := &fakeStore{now: time.Now()}
+	st.add("a", "appointment.created")
+	pub := &Memory{}
+	pub.Fail(1, errors.New("nats: timeout"))
+	r := NewRelay(st, pub, WithBackoff(time.Minute, time.Hour))
+
+	r.Tick(context.Background())
+	if got := ids(pub, ""); len(got) != 0 {
+		t.Fatalf("published %v", got)
+	}
+	row := st.rows[0]
+	if row.published || row.lastError != "nats: timeout" || row.ev.Attempts != 1 {
+		t.Fatalf("after failure: %+v", row)
+	}
+	if wait := row.retryAt.Sub(time.Now()); wait < 50*time.Second || wait > time.Minute {
+		t.Errorf("retry in %v, want about a minute", wait)
+	}
+
+	// not due yet
+	r.Tick(context.Background())
+	if len(pub.Messages()) != 0 {
+		t.Fatal("retried before its time")
+	}
+
+	st.now = st.now.Add(2 * time.Minute)
+	r.Tick(context.Background())
+	msgs := pub.Messages()
+	if len(msgs) != 1 || !row.published {
+		t.Fatalf("after retry: %v, row %+v", msgs, row)
+	}
+	m := msgs[0]
+	if m.ID != "ev-1" || m.Type != "appointment.created" || m.AggregateID != "a" || string(m.Payload) != `{"n":1}` {
+		t.Errorf("message %+v", m)
+	}
+}
+
+// failOnce fails the first publish of the given events.
+type failOnce struct {
+	*Memory
+	ids map[string]bool
+}
+
+func (p failOnce) Publish(ctx context.Context, m Message) error {
+	if p.ids[m.ID] {
+		delete(p.ids, m.ID)
+		return errors.New("nats: no response from stream")
+	}
+	return p.Memory.Publish(ctx, m)
+}
+
+func TestEventsInOrderPerAppointment(t *testing.T) {
+	st := &fakeStore{now: time.Now()}
+	for _, typ := range []string{"created", "updated", "rescheduled", "cancelled"} {
+		st.add("a", "appointment."+typ)
+		st.add("b", "appointment."+typ)
+	}
+	pub := &Memory{}
+	// b's second event fails once: b stalls behind it, a carries on
+	r := NewRelay(st, failOnce{pub, map[string]bool{"ev-4": true}}, WithBackoff(time.Minute, time.Hour))
+
+	r.Tick(context.Background())
+	if got, want := ids(pub, "a"), []string{"ev-1", "ev-3", "ev-5", "ev-7"}; !slices.Equal(got, want) {
+		t.Errorf("a: %v, want %v", got, want)
+	}
+	if got, want := ids(pub, "b"), []string{"ev-2"}; !slices.Equal(got, want) {
+		t.Errorf("b before its retry: %v, want %v", got, want)
+	}
+
+	st.now = st.now.Add(2 * time.Minute)
+	r.Tick(context.Background())
+	if got, want := ids(pub, "b"), []string{"ev-2", "ev-4", "ev-6", "ev-8"}; !slices.Equal(got, want) {
+		t.Errorf("b: %v, want %v", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := NewRelay(nil, nil, WithBackoff(time.Second, 10*time.Second))
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := r.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestMessageBody(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 0, 0, 0, time.FixedZone("", 3600))
+	m := Message{ID: "e1", Type: "appointment.created", AggregateID: "a1", CreatedAt: at, Payload: json.RawMessage(`{"x":1}`)}
+	want := `{"id":"e1","type":"appointment.created","aggregate_id":"a1","created_at":"2026-03-01T08:00:00Z","payload":{"x":1}}`
+	if got := string(m.Body()); got != want {
+		t.Errorf("body %s", got)
+	}
+}
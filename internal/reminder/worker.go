@@ -0,0 +1,87 @@
+// Package reminder delivers due appointment reminders in the background.
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/notify"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	batchSize       = 100
+)
+
+// Claimer hands out due reminders, each to exactly one caller
+// (store.ClaimDueReminders).
+type Claimer interface {
+	ClaimDueReminders(ctx context.Context, limit int) ([]model.Reminder, error)
+}
+
+type Worker struct {
+	claimer  Claimer
+	notifier notify.Notifier
+	interval time.Duration
+
+	onRun func(err error)
+}
+
+// NewWorker polls every interval (30s if zero). Reminders can go out up to
+// one interval late.
+func NewWorker(c Claimer, n notify.Notifier, interval time.Duration) *Worker {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Worker{claimer: c, notifier: n, interval: interval}
+}
+
+// OnRun registers a callback for the end of every Tick, with the claim
+// error or the last delivery error, e.g. a diagnostics tracker.
+func (w *Worker) OnRun(fn func(err error)) {
+	w.onRun = fn
+}
+
+// Run delivers reminders until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		w.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Tick claims and delivers everything currently due, a batch at a time.
+func (w *Worker) Tick(ctx context.Context) {
+	var failed error
+	defer func() {
+		if w.onRun != nil {
+			w.onRun(failed)
+		}
+	}()
+	for ctx.Err() == nil {
+		due, err := w.claimer.ClaimDueReminders(ctx, batchSize)
+		if err != nil {
+			log.Printf("reminders: claim: %v", err)
+			failed = fmt.Errorf("claim: %w", err)
+			return
+		}
+		for _, r := range due {
+			if err := w.notifier.Remind(ctx, r); err != nil {
+				log.Printf("reminders: deliver %s to user %s: %v", r.ID, r.UserID, err)
+				failed = fmt.Errorf("deliver %s: %w", r.ID, err)
+			}
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
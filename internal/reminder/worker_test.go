@@ -0,0 +1,115 @@
+package reminder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+// fakeClaimer hands out pending in batches, like the store would.
+type fakeClaimer struct {
+	mu      sync.Mutex
+	pending []model.Reminder
+	calls   int
+	err     error
+}
+
+func (f *fakeClaimer) ClaimDueReminders(_ context.Context, limit int) ([]model.Reminder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	n := min(limit, len(f.pending))
+	out := f.pending[:n]
+	f.pending = f.pending[n:]
+	return out, nil
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]bool
+}
+
+func (r *recorder) Remind(_ context.Context, rem model.Reminder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[rem.ID] {
+		return errors.New("smtp down")
+	}
+	r.sent = append(r.sent, rem.ID)
+	return nil
+}
+
+func TestTickDrainsEverythingDue(t *testing.T) {
+	c := &fakeClaimer{}
+	for i := 0; i < batchSize*2+5; i++ {
+		c.pending = append(c.pending, model.Reminder{ID: string(rune('a' + i%26))})
+	}
+	c.pending[3].ID = "broken"
+	rec := &recorder{fail: map[string]bool{"broken": true}}
+
+	w := NewWorker(c, rec, time.Hour)
+	var runErr error
+	w.OnRun(func(err error) { runErr = err })
+	w.Tick(context.Background())
+
+	if len(c.pending) != 0 {
+		t.Errorf("%d reminders left unclaimed", len(c.pending))
+	}
+	if c.calls != 3 {
+		t.Errorf("expected 3 claims, got %d", c.calls)
+	}
+	// one failed delivery doesn't hold up the rest
+	if len(rec.sent) != batchSize*2+4 {
+		t.Errorf("delivered %d", len(rec.sent))
+	}
+	if runErr == nil || !strings.Contains(runErr.Error(), "broken") {
+		t.Errorf("OnRun got %v", runErr)
+	}
+}
+
+func TestTickStopsOnClaimError(t *testing.T) {
+	c := &fakeClaimer{err: errors.New("db down")}
+	w := NewWorker(c, &recorder{}, time.Hour)
+	runs := 0
+	var runErr error
+	w.OnRun(func(err error) { runs++; runErr = err })
+	w.Tick(context.Background())
+	if c.calls != 1 {
+		t.Errorf("expected one attempt per tick, got %d", c.calls)
+	}
+	if runs != 1 || runErr == nil {
+		t.Errorf("OnRun called %d times with %v", runs, runErr)
+	}
+}
+
+func TestRunPollsUntilCancelled(t *testing.T) {
+	c := &fakeClaimer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewWorker(c, &recorder{}, 5*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after cancel")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls < 2 {
+		t.Errorf("expected repeated polling, got %d claims", c.calls)
+	}
+}
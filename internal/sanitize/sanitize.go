@@ -0,0 +1,114 @@
+// Package sanitize turns free text from clients (titles, descriptions,
+// locations) into plain text: no markup, Unicode in NFC, no surrounding
+// space. Clients render what's stored as text, so a pasted email has to
+// lose its HTML here rather than show up as raw tags elsewhere.
+package sanitize
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text is s in NFC without surrounding white space.
+func Text(s string) string {
+	return strings.TrimSpace(norm.NFC.String(s))
+}
+
+// StripHTML drops tags and comments from s, keeping the text in between.
+// What's inside script and style elements goes too. Line breaks and the
+// ends of block elements become newlines, so a pasted email keeps its
+// paragraphs, and once markup was found the entities in the text are
+// decoded. Only well-formed tags count: a known element name right after
+// the "<" (or "</"), then name=value attributes, then ">". Anything else,
+// like "a<b then c>d" or an "&lt;b&gt;" typed as such, comes back as it was.
+func StripHTML(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+	in := s
+	var text []string
+	stripped := false
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			text = append(text, s)
+			break
+		}
+		text = append(text, s[:i])
+		s = s[i:]
+		n, name, closing := tag(s)
+		if n == 0 {
+			text = append(text, "<")
+			s = s[1:]
+			continue
+		}
+		stripped = true
+		s = s[n:]
+		switch {
+		case !closing && (name == "script" || name == "style"):
+			// the element's content goes with it, to its end tag or the end
+			end := closeTag(s, name)
+			if end < 0 {
+				s = ""
+			} else {
+				s = s[end:]
+			}
+		case name == "br" || closing && blocks[name]:
+			text = append(text, "\n")
+		}
+	}
+	if !stripped {
+		return in
+	}
+	// decoded once, after stripping: an entity never becomes a tag
+	return blankLines.ReplaceAllString(html.UnescapeString(strings.Join(text, "")), "\n\n")
+}
+
+var (
+	element    = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[a-zA-Z_:][-a-zA-Z0-9_:.]*\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))*)\s*/?>`)
+	comment    = regexp.MustCompile(`^<!--[\s\S]*?-->`)
+	doctype    = regexp.MustCompile(`^<![a-zA-Z][^<>]*>`)
+	endTag     = regexp.MustCompile(`(?i)</(script|style)\s*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// tag is the length of the well-formed tag, comment or doctype s starts
+// with, 0 if it doesn't, and for an element its lower-case name and
+// whether it's an end tag.
+func tag(s string) (n int, name string, closing bool) {
+	if m := comment.FindString(s); m != "" {
+		return len(m), "", false
+	}
+	if m := doctype.FindString(s); m != "" {
+		return len(m), "", false
+	}
+	m := element.FindStringSubmatch(s)
+	if m == nil {
+		return 0, "", false
+	}
+	name = strings.ToLower(m[2])
+	if atom.Lookup([]byte(name)) == 0 {
+		return 0, "", false
+	}
+	return len(m[0]), name, m[1] == "/"
+}
+
+// closeTag is the index just past the first </name> in s, -1 without one.
+func closeTag(s, name string) int {
+	for _, loc := range endTag.FindAllStringSubmatchIndex(s, -1) {
+		if strings.EqualFold(s[loc[2]:loc[3]], name) {
+			return loc[1]
+		}
+	}
+	return -1
+}
+
+// elements whose end starts a new line
+var blocks = map[string]bool{
+	"p": true, "div": true, "li": true, "tr": true, "table": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "blockquote": true, "pre": true,
+}
@@ -0,0 +1,53 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripHTML(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Dentist", "Dentist"},
+		{"Tom & Jerry, 1 < 2 <3", "Tom & Jerry, 1 < 2 <3"},
+		{"<b>Team</b> sync", "Team sync"},
+		{`Hi<script>alert("x")</script> there`, "Hi there"},
+		{"<style>p{color:red}</style><p>one</p><p>two</p>", "one\ntwo\n"},
+		{"line<br>next<br/>last", "line\nnext\nlast"},
+		{"a <!-- note --> b", "a  b"},
+		{"<p>AT&amp;T &eacute;t&eacute;</p>", "AT&T été\n"},
+		// text without markup keeps its entities, and decoded ones aren't
+		// stripped again
+		{"&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"<b>&lt;i&gt;</b>", "<i>"},
+		// only well-formed tags of known elements are markup
+		{"a<b then c>d", "a<b then c>d"},
+		{"x <y> z </zz>", "x <y> z </zz>"},
+		{"<!DOCTYPE html><P Class=x>caps</P>", "caps\n"},
+		{"<script>unterminated", ""},
+		{"<div><div><div>x</div></div></div>y", "x\n\ny"},
+		{"<a href=\"https://evil.example\" onclick=\"steal()\">link</a>", "link"},
+	} {
+		if got := StripHTML(tc.in); got != tc.want {
+			t.Errorf("StripHTML(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	// "é" as e + combining acute composes to one rune
+	if got := Text("  Café \n"); got != "Café" {
+		t.Errorf("got %q", got)
+	}
+	// right-to-left and emoji pass through untouched
+	for _, s := range []string{"موعد الطبيب", "🎉 party 👩‍👩‍👧"} {
+		if got := Text(s); got != s {
+			t.Errorf("Text(%q) = %q", s, got)
+		}
+	}
+	if got := Text(" \t \n"); got != "" {
+		t.Errorf("white space only: %q", got)
+	}
+	if got := Text(strings.Repeat("x", 3)); got != "xxx" {
+		t.Errorf("got %q", got)
+	}
+}
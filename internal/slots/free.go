@@ -0,0 +1,82 @@
+package slots
+
+import (
+	"sort"
+	"time"
+)
+
+// NextFree is the kind of a slot found by walking forward through the
+// gaps, as Free does.
+const NextFree = "next_free"
+
+// Lead is how soon from now Free is asked to start when the caller says
+// "now": nobody can make a meeting that starts this second.
+const Lead = 15 * time.Minute
+
+// step is what Earliest rounds up to, so "now" suggestions land on
+// :00, :05, ... rather than the second the request came in.
+const step = 5 * time.Minute
+
+// Earliest is the first start worth offering at now: Lead later, rounded
+// up to the next five minutes.
+func Earliest(now time.Time) time.Time {
+	t := now.Add(Lead)
+	if r := t.Truncate(step); r.Before(t) {
+		return r.Add(step)
+	}
+	return t
+}
+
+// Hours is the part of every day, on Loc's wall clock, a slot has to fit
+// in. Open and Close are since midnight, Open before Close.
+type Hours struct {
+	Open, Close time.Duration
+	Loc         *time.Location
+}
+
+// fit moves at forward to the first time a slot of length fits inside
+// the hours, or to past limit if none does before it.
+func (h *Hours) fit(at time.Time, length time.Duration, limit time.Time) time.Time {
+	for at.Before(limit) {
+		l := at.In(h.Loc)
+		if open := clock(l, 0, h.Open); at.Before(open) {
+			at = open
+		}
+		if !at.Add(length).After(clock(l, 0, h.Close)) {
+			return at
+		}
+		at = clock(l, 1, h.Open)
+	}
+	return at
+}
+
+// Free returns up to n slots of length between from and to that miss
+// everything in busy, earliest first. A gap with room for several gets
+// them back to back. With hours set, each slot sits inside one day's
+// hours.
+func Free(busy []Interval, from, to time.Time, length time.Duration, hours *Hours, n int) []Interval {
+	busy = append([]Interval(nil), busy...)
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	var out []Interval
+	at, i := from, 0
+	for len(out) < n {
+		if hours != nil {
+			at = hours.fit(at, length, to)
+		}
+		iv := Interval{at, at.Add(length)}
+		if iv.End.After(to) {
+			break
+		}
+		// at only moves forward, so whatever ended before it is behind us
+		for i < len(busy) && !busy[i].End.After(iv.Start) {
+			i++
+		}
+		if i < len(busy) && busy[i].Start.Before(iv.End) {
+			at = busy[i].End
+			continue
+		}
+		out = append(out, iv)
+		at = iv.End
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+// Package slots works out free time around a user's confirmed
+// appointments. Times are half-open, [Start, End), like everywhere else.
+package slots
+
+import (
+	"sort"
+	"time"
+)
+
+type Interval struct {
+	Start, End time.Time
+}
+
+func (i Interval) overlaps(o Interval) bool {
+	return i.Start.Before(o.End) && o.Start.Before(i.End)
+}
+
+// Kinds of alternative a conflicting booking can be offered.
+const (
+	Shortened    = "shortened"      // same start, ends when the next appointment begins
+	LaterSameDay = "later_same_day" // first free slot of the same length after the requested start
+	NextDay      = "next_day"       // same time the following day
+)
+
+// MinShortened is the shortest slot worth offering as a shortened booking.
+const MinShortened = 15 * time.Minute
+
+type Suggestion struct {
+	Kind string
+	Interval
+}
+
+// MaxWindow caps how much of the calendar one suggestion lookup reads.
+const MaxWindow = 7 * 24 * time.Hour
+
+// Window is the busy time Alternatives needs to see for want: from its start
+// to the end of the same slot a day later, and never more than MaxWindow.
+func Window(want Interval) Interval {
+	end := want.End.Add(24 * time.Hour)
+	if limit := want.Start.Add(MaxWindow); end.After(limit) {
+		end = limit
+	}
+	return Interval{Start: want.Start, End: end}
+}
+
+// Alternatives offers up to three free slots close to want, which conflicts
+// with something in busy. Days are UTC days. Slots before now are never
+// offered.
+func Alternatives(busy []Interval, want Interval, now time.Time) []Suggestion {
+	busy = append([]Interval(nil), busy...)
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	free := func(iv Interval) bool {
+		if iv.Start.Before(now) {
+			return false
+		}
+		for _, b := range busy {
+			if b.overlaps(iv) {
+				return false
+			}
+		}
+		return true
+	}
+	length := want.End.Sub(want.Start)
+	var out []Suggestion
+
+	// keep the start, stop at the first appointment in the way
+	for _, b := range busy {
+		if !b.overlaps(want) {
+			continue
+		}
+		iv := Interval{want.Start, b.Start}
+		if iv.End.Sub(iv.Start) >= MinShortened && free(iv) {
+			out = append(out, Suggestion{Shortened, iv})
+		}
+		break
+	}
+
+	// walk forward from the requested start, jumping past each appointment
+	// that's in the way, until the slot fits or the day is over
+	dayEnd := want.Start.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	iv := want
+	for _, b := range busy {
+		if !iv.End.After(b.Start) {
+			break
+		}
+		if b.overlaps(iv) {
+			iv = Interval{b.End, b.End.Add(length)}
+		}
+	}
+	if !iv.End.After(dayEnd) && !iv.Start.Equal(want.Start) && free(iv) {
+		out = append(out, Suggestion{LaterSameDay, iv})
+	}
+
+	if iv := (Interval{want.Start.Add(24 * time.Hour), want.End.Add(24 * time.Hour)}); free(iv) {
+		out = append(out, Suggestion{NextDay, iv})
+	}
+	return out
+}
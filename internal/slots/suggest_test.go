@@ -0,0 +1,249 @@
+package slots
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAlternatives(t *testing.T) {
+	day := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	iv := func(h1, m1, h2, m2 int) Interval { return Interval{at(h1, m1), at(h2, m2)} }
+	now := day
+
+	tests := []struct {
+		name string
+		busy []Interval
+		want Interval
+		now  time.Time
+		out  []Suggestion
+	}{
+		{
+			name: "all three",
+			busy: []Interval{iv(10, 30, 11, 30)},
+			want: iv(10, 0, 11, 0),
+			out: []Suggestion{
+				{Shortened, iv(10, 0, 10, 30)},
+				{LaterSameDay, iv(11, 30, 12, 30)},
+				{NextDay, iv(34, 0, 35, 0)},
+			},
+		},
+		{
+			name: "too little room to shorten",
+			busy: []Interval{iv(10, 10, 11, 0)},
+			want: iv(10, 0, 11, 0),
+			out: []Suggestion{
+				{LaterSameDay, iv(11, 0, 12, 0)},
+				{NextDay, iv(34, 0, 35, 0)},
+			},
+		},
+		{
+			name: "start is taken, nothing to shorten",
+			busy: []Interval{iv(9, 0, 10, 30)},
+			want: iv(10, 0, 11, 0),
+			out: []Suggestion{
+				{LaterSameDay, iv(10, 30, 11, 30)},
+				{NextDay, iv(34, 0, 35, 0)},
+			},
+		},
+		{
+			name: "skips gaps that are too short",
+			busy: []Interval{iv(10, 0, 11, 0), iv(11, 30, 12, 0), iv(12, 0, 13, 0), iv(34, 0, 35, 0)},
+			want: iv(10, 0, 11, 0),
+			out: []Suggestion{
+				{LaterSameDay, iv(13, 0, 14, 0)},
+			},
+		},
+		{
+			name: "no room left that day",
+			busy: []Interval{iv(22, 0, 23, 30)},
+			want: iv(22, 0, 23, 0),
+			out: []Suggestion{
+				{NextDay, iv(46, 0, 47, 0)},
+			},
+		},
+		{
+			name: "nothing in the past",
+			busy: []Interval{iv(10, 30, 11, 30)},
+			want: iv(10, 0, 11, 0),
+			now:  at(10, 15),
+			out: []Suggestion{
+				{LaterSameDay, iv(11, 30, 12, 30)},
+				{NextDay, iv(34, 0, 35, 0)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := tt.now
+			if n.IsZero() {
+				n = now
+			}
+			got := Alternatives(tt.busy, tt.want, n)
+			if !reflect.DeepEqual(got, tt.out) {
+				t.Errorf("got %v\nwant %v", got, tt.out)
+			}
+		})
+	}
+}
+
+func TestWindowCapped(t *testing.T) {
+	start := time.Date(2030, 3, 4, 10, 0, 0, 0, time.UTC)
+	w := Window(Interval{start, start.Add(30 * 24 * time.Hour)})
+	if got := w.End.Sub(w.Start); got != MaxWindow {
+		t.Errorf("window %v, want %v", got, MaxWindow)
+	}
+}
+
+func TestFree(t *testing.T) {
+	day := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	iv := func(h1, m1, h2, m2 int) Interval { return Interval{at(h1, m1), at(h2, m2)} }
+	nineToFive := &Hours{Open: 9 * time.Hour, Close: 17 * time.Hour, Loc: time.UTC}
+
+	// 09:00-17:00 booked solid except 13:30-14:00
+	packed := []Interval{iv(9, 0, 11, 0), iv(10, 30, 12, 0), iv(12, 0, 13, 30), iv(14, 0, 17, 0)}
+
+	tests := []struct {
+		name     string
+		busy     []Interval
+		from, to time.Time
+		length   time.Duration
+		hours    *Hours
+		n        int
+		out      []Interval
+	}{
+		{
+			name: "the one gap in a packed day", busy: packed,
+			from: at(9, 0), to: at(17, 0), length: 30 * time.Minute, n: 3,
+			out: []Interval{iv(13, 30, 14, 0)},
+		},
+		{
+			name: "gap too short, next day's hours", busy: packed,
+			from: at(9, 0), to: at(48, 0), length: time.Hour, hours: nineToFive, n: 2,
+			out: []Interval{iv(33, 0, 34, 0), iv(34, 0, 35, 0)},
+		},
+		{
+			name: "back to back in a free morning",
+			from: at(9, 10), to: at(12, 0), length: time.Hour, n: 5,
+			out: []Interval{iv(9, 10, 10, 10), iv(10, 10, 11, 10)},
+		},
+		{
+			name: "doesn't run past closing",
+			busy: []Interval{iv(9, 0, 16, 30)},
+			from: at(9, 0), to: at(24+17, 0), length: time.Hour, hours: nineToFive, n: 1,
+			out: []Interval{iv(24+9, 0, 24+10, 0)},
+		},
+		{
+			name: "start inside an appointment",
+			busy: []Interval{iv(8, 0, 9, 45)},
+			from: at(9, 0), to: at(17, 0), length: 30 * time.Minute, n: 1,
+			out: []Interval{iv(9, 45, 10, 15)},
+		},
+		{
+			name: "longer than the hours",
+			from: at(0, 0), to: at(72, 0), length: 9 * time.Hour, hours: nineToFive, n: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Free(tt.busy, tt.from, tt.to, tt.length, tt.hours, tt.n)
+			if !reflect.DeepEqual(got, tt.out) {
+				t.Errorf("got %v\nwant %v", got, tt.out)
+			}
+		})
+	}
+}
+
+func TestFreeHoursInZone(t *testing.T) {
+	lagos, err := time.LoadLocation("Africa/Lagos") // UTC+1
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	got := Free(nil, from, from.Add(48*time.Hour), time.Hour, &Hours{Open: 9 * time.Hour, Close: 17 * time.Hour, Loc: lagos}, 1)
+	if len(got) != 1 || !got[0].Start.Equal(time.Date(2030, 3, 4, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestEarliest(t *testing.T) {
+	now := time.Date(2030, 3, 4, 10, 2, 31, 0, time.UTC)
+	if got, want := Earliest(now), time.Date(2030, 3, 4, 10, 20, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := Earliest(now.Truncate(time.Hour)), now.Truncate(time.Hour).Add(Lead); !got.Equal(want) {
+		t.Errorf("on the dot: got %v, want %v", got, want)
+	}
+}
+
+func TestWeekly(t *testing.T) {
+	// 2030-03-04 is a Monday
+	day := time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	iv := func(h1, m1, h2, m2 int) Interval { return Interval{at(h1, m1), at(h2, m2)} }
+	w := Weekly{Loc: time.UTC, Openings: []Opening{
+		{time.Monday, 9 * time.Hour, 12 * time.Hour},
+		{time.Monday, 12 * time.Hour, 17 * time.Hour},
+		{time.Tuesday, 22 * time.Hour, 2 * time.Hour}, // into Wednesday
+		{time.Sunday, 20 * time.Hour, 1 * time.Hour},  // into Monday
+	}}
+	got := w.Open(at(0, 0), at(48, 0))
+	want := []Interval{iv(0, 0, 1, 0), iv(9, 0, 17, 0), iv(46, 0, 48, 0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("open: got %v\nwant %v", got, want)
+	}
+	closed := w.Closed(at(0, 0), at(24, 0))
+	if want := []Interval{iv(1, 0, 9, 0), iv(17, 0, 24, 0)}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("closed: got %v\nwant %v", closed, want)
+	}
+
+	for _, tc := range []struct {
+		iv   Interval
+		want bool
+	}{
+		{iv(11, 0, 13, 0), true}, // across two back-to-back openings
+		{iv(16, 30, 17, 30), false},
+		{iv(23, 0, 25, 0), false},
+		{iv(47, 0, 49, 30), true}, // Tuesday night into Wednesday
+		{iv(49, 30, 50, 30), false},
+	} {
+		if got := w.Covers(tc.iv); got != tc.want {
+			t.Errorf("covers %v: %v", tc.iv, got)
+		}
+	}
+}
+
+func TestWeeklyDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// clocks go forward at 02:00 on Sunday 2030-03-10
+	w := Weekly{Loc: ny, Openings: []Opening{
+		{time.Saturday, 22 * time.Hour, 6 * time.Hour},
+		{time.Sunday, 9 * time.Hour, 17 * time.Hour},
+	}}
+	sat := time.Date(2030, 3, 9, 0, 0, 0, 0, ny)
+	got := w.Open(sat, sat.AddDate(0, 0, 2))
+	want := []Interval{
+		{time.Date(2030, 3, 9, 22, 0, 0, 0, ny), time.Date(2030, 3, 10, 6, 0, 0, 0, ny)},
+		{time.Date(2030, 3, 10, 9, 0, 0, 0, ny), time.Date(2030, 3, 10, 17, 0, 0, 0, ny)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) {
+			t.Errorf("%d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	// the night is an hour short, the day keeps its hours
+	if d := got[0].End.Sub(got[0].Start); d != 7*time.Hour {
+		t.Errorf("night is %v", d)
+	}
+	if d := got[1].End.Sub(got[1].Start); d != 8*time.Hour {
+		t.Errorf("day is %v", d)
+	}
+}
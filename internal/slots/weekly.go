@@ -0,0 +1,94 @@
+package slots
+
+import (
+	"sort"
+	"time"
+)
+
+// Opening is one weekly window of availability, from Start on Weekday to
+// End, both since midnight on Weekly.Loc's wall clock. End at or before Start runs past
+// midnight into the next day; End == Start is a full 24 hours.
+type Opening struct {
+	Weekday    time.Weekday
+	Start, End time.Duration
+}
+
+// Weekly is a user's availability. Without openings it's never open;
+// callers take that as no restriction at all.
+type Weekly struct {
+	Openings []Opening
+	Loc      *time.Location
+}
+
+// Open returns the times in [from, to) that some opening covers, merged and
+// in order, cut to the range. Each occurrence is worked out with
+// time.Date on that day, so an opening keeps its wall-clock hours across
+// DST changes (and is an hour shorter or longer on the night of one).
+func (w Weekly) Open(from, to time.Time) []Interval {
+	var out []Interval
+	// an opening reaches at most into the next day, so starting a day
+	// early catches one that's already open at from
+	for d := clock(from.In(w.Loc), -1, 0); d.Before(to); d = clock(d, 1, 0) {
+		for _, win := range w.Openings {
+			if win.Weekday != d.Weekday() {
+				continue
+			}
+			start := clock(d, 0, win.Start)
+			end := clock(d, 0, win.End)
+			if win.End <= win.Start {
+				end = clock(d, 1, win.End)
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if start.Before(end) {
+				out = append(out, Interval{start, end})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	merged := out[:0]
+	for _, iv := range out {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// Closed is the complement of Open in [from, to): the times no opening
+// covers, for treating as busy.
+func (w Weekly) Closed(from, to time.Time) []Interval {
+	var out []Interval
+	at := from
+	for _, iv := range w.Open(from, to) {
+		if at.Before(iv.Start) {
+			out = append(out, Interval{at, iv.Start})
+		}
+		at = iv.End
+	}
+	if at.Before(to) {
+		out = append(out, Interval{at, to})
+	}
+	return out
+}
+
+// Covers reports whether iv is entirely inside open time. Back-to-back
+// openings count as one.
+func (w Weekly) Covers(iv Interval) bool {
+	open := w.Open(iv.Start, iv.End)
+	return len(open) == 1 && open[0].Start.Equal(iv.Start) && open[0].End.Equal(iv.End)
+}
+
+// clock is d's date plus offset days at wall-clock time t. time.Date,
+// not Add, so the hour is the same on a DST day.
+func clock(d time.Time, offset int, t time.Duration) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day()+offset, 0, 0, int(t/time.Second), 0, d.Location())
+}
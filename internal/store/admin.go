@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+// AppendAdminAudit records an admin action. params is stored as JSONB.
+func (s *Store) AppendAdminAudit(ctx context.Context, actorID, action string, params any) error {
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO admin_audit (actor_id, action, params) VALUES ($1,$2,$3)`,
+		actorID, action, params,
+	)
+	return err
+}
+
+type AdminAuditEntry struct {
+	Action    string
+	Params    map[string]any
+	CreatedAt time.Time
+}
+
+// AdminAuditEntries returns an admin's audit trail, newest first.
+func (s *Store) AdminAuditEntries(ctx context.Context, actorID string, limit int) ([]AdminAuditEntry, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT action, params, created_at FROM admin_audit
+		 WHERE actor_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, actorID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AdminAuditEntry
+	for rows.Next() {
+		var e AdminAuditEntry
+		if err := rows.Scan(&e.Action, &e.Params, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// SearchParams narrows SearchAppointments; zero values don't filter.
+// Results are ordered by (start_time, id) like ListAppointments, with the
+// same keyset cursor.
+type SearchParams struct {
+	Query      string
+	OwnerEmail string
+	From, To   time.Time
+	Status     string
+	AfterStart time.Time
+	AfterID    string
+	Limit      int
+	Attendees  bool // load attendee IDs
+}
+
+type SearchResult struct {
+	Appointment model.Appointment
+	OwnerEmail  string
+}
+
+// SearchAppointments looks across every user's appointments.
+func (s *Store) SearchAppointments(ctx context.Context, p SearchParams) ([]SearchResult, error) {
+	where := []string{`a.status <> 'invalid'`}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if p.Query != "" {
+		q := arg(p.Query)
+		cond := `to_tsvector('simple', a.title) @@ plainto_tsquery('simple', ` + q + `)`
+		if s.Has(FeatureAttendees) {
+			like := arg("%" + escapeLike(p.Query) + "%")
+			cond += ` OR EXISTS (
+			    SELECT 1 FROM appointment_attendees aa JOIN users au ON au.id = aa.user_id
+			    WHERE aa.appointment_id = a.id AND (au.name ILIKE ` + like + ` OR au.email ILIKE ` + like + `))`
+		}
+		where = append(where, "("+cond+")")
+	}
+	if p.OwnerEmail != "" {
+		where = append(where, `lower(u.email) = lower(`+arg(p.OwnerEmail)+`)`)
+	}
+	if !p.From.IsZero() {
+		where = append(where, `a.end_time > `+arg(p.From))
+	}
+	if !p.To.IsZero() {
+		where = append(where, `a.start_time < `+arg(p.To))
+	}
+	if p.Status != "" {
+		where = append(where, `a.status = `+arg(p.Status))
+	}
+	if p.AfterID != "" {
+		where = append(where, `(a.start_time, a.id) > (`+arg(p.AfterStart)+`, `+arg(p.AfterID)+`)`)
+	}
+
+	attendees := `NULL::text[]`
+	if p.Attendees && s.Has(FeatureAttendees) {
+		attendees = `ARRAY(SELECT user_id::text FROM appointment_attendees WHERE appointment_id = a.id)`
+	}
+	q := `SELECT a.id, a.title, a.description, a.start_time, a.end_time,
+	        a.user_id, a.status, a.location, a.created_at, a.updated_at, u.email, ` + attendees + `
+	 FROM appointments a JOIN users u ON u.id = a.user_id
+	 WHERE ` + strings.Join(where, ` AND `)
+	q += ` ORDER BY a.start_time, a.id`
+	if p.Limit > 0 {
+		q += fmt.Sprintf(` LIMIT %d`, p.Limit)
+	}
+
+	rows, err := s.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		a := &r.Appointment
+		if err := rows.Scan(
+			&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
+			&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt, &r.OwnerEmail, &a.AttendeeIDs,
+		); err != nil {
+			return nil, err
+		}
+		if !validRange(a) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SetAllDayConflicts makes all-day events on the same days conflict with
+// each other, the way timed appointments do. Off by default: a birthday
+// and a public holiday can share a date. All-day events never conflict
+// with timed ones either way. Call it before serving.
+func (s *Store) SetAllDayConflicts(on bool) {
+	s.allDayConflicts = on
+}
+
+// AllDayConflicts reports whether all-day events conflict with each other.
+func (s *Store) AllDayConflicts() bool { return s.allDayConflicts }
+
+// allDayCol selects whether an appointment is all-day, false without the
+// feature.
+func (s *Store) allDayCol(table string) string {
+	if !s.Has(FeatureAllDay) {
+		return `false`
+	}
+	return table + `.all_day`
+}
+
+// timeZoneCol selects an appointment's time zone, "" without the feature.
+func (s *Store) timeZoneCol(table string) string {
+	if !s.Has(FeatureAllDay) {
+		return `''`
+	}
+	return table + `.time_zone`
+}
+
+// slotTaken is hasOverlap for a write in tx. no_time_overlap only backs
+// timed appointments, so with all-day conflicts on, the user's all-day
+// writes queue on an advisory lock instead and the check can't race.
+func (s *Store) slotTaken(ctx context.Context, tx pgx.Tx, userID string, start, end time.Time, allDay bool, excludeID string) (bool, error) {
+	if allDay && s.allDayConflicts {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('all_day:' || $1, 0))`, userID); err != nil {
+			return false, err
+		}
+	}
+	return s.hasOverlap(ctx, tx, userID, start, end, allDay, excludeID)
+}
@@ -2,23 +2,111 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
 	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
 )
 
 func (s *Store) CreateAppointment(ctx context.Context, a *model.Appointment) error {
+	return s.CreateAppointments(ctx, []*model.Appointment{a})
+}
+
+// CreateAppointments inserts all appointments in one transaction — if any
+// insert fails nothing is written. A taken slot is ErrConflict, a taken
+// resource ErrResourceBooked.
+func (s *Store) CreateAppointments(ctx context.Context, apts []*model.Appointment) error {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx,
-		`INSERT INTO appointments (id,title,description,start_time,end_time,user_id,status,location)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
-		a.ID, a.Title, a.Description, a.StartTime, a.EndTime, a.UserID, a.Status, a.Location,
-	)
+	for _, a := range apts {
+		if err := s.insertAppointment(ctx, tx, a); err != nil {
+			return err
+		}
+		if err := s.appendAudit(ctx, tx, a.UserID, "create", a.ID, nil, snapshot(a)); err != nil {
+			return err
+		}
+	}
+
+	return commit(ctx, tx)
+}
+
+// commit maps a deferred exclusion violation to ErrConflict or
+// ErrResourceBooked.
+func commit(ctx context.Context, tx pgx.Tx) error {
+	err := tx.Commit(ctx)
+	if isExclusionViolation(err) {
+		return overlapErr(err)
+	}
+	return err
+}
+
+// insertAppointment returns ErrConflict if the slot is taken, whether the
+// check here sees it or the no_time_overlap constraint catches a race,
+// ErrBuffer if it's within a.Buffer of another, and likewise
+// ErrResourceBooked for a.ResourceID.
+// An empty a.CalendarID means the user's default calendar, and is filled in.
+func (s *Store) insertAppointment(ctx context.Context, tx pgx.Tx, a *model.Appointment) error {
+	if err := s.checkSlot(ctx, tx, a.UserID, a.StartTime, a.EndTime, a.AllDay, "", a.Buffer); err != nil {
+		return err
+	}
+	if a.ResourceID != "" {
+		if err := checkResource(ctx, tx, a.ResourceID, a.StartTime, a.EndTime, ""); err != nil {
+			return err
+		}
+	}
+	var calendarID *string // NULL without the feature
+	if s.Has(FeatureCalendars) {
+		id, err := resolveCalendar(ctx, tx, a.UserID, a.CalendarID)
+		if err != nil {
+			return err
+		}
+		a.CalendarID, calendarID = id, &id
+	}
+	cols, vals := `id,title,description,start_time,end_time,user_id,status,location`, `$1,$2,$3,$4,$5,$6,$7,$8`
+	args := []any{a.ID, a.Title, a.Description, a.StartTime, a.EndTime, a.UserID, a.Status, a.Location}
+	if calendarID != nil {
+		args = append(args, *calendarID)
+		cols, vals = cols+`,calendar_id`, vals+fmt.Sprintf(`,$%d`, len(args))
+	}
+	if a.ResourceID != "" {
+		args = append(args, a.ResourceID)
+		cols, vals = cols+`,resource_id`, vals+fmt.Sprintf(`,$%d`, len(args))
+	}
+	if len(a.Tags) > 0 {
+		args = append(args, a.Tags)
+		cols, vals = cols+`,tags`, vals+fmt.Sprintf(`,$%d`, len(args))
+	}
+	if a.Capacity > 0 {
+		args = append(args, a.Capacity)
+		cols, vals = cols+`,capacity`, vals+fmt.Sprintf(`,$%d`, len(args))
+	}
+	if a.AllDay || a.TimeZone != "" {
+		args = append(args, a.AllDay, a.TimeZone)
+		cols, vals = cols+`,all_day,time_zone`, vals+fmt.Sprintf(`,$%d,$%d`, len(args)-1, len(args))
+	}
+	if s.Has(FeatureOrganizations) {
+		// the owner's organization as of now; joining one later doesn't
+		// share what was booked before
+		cols, vals = cols+`,org_id`, vals+`,(SELECT org_id FROM users WHERE id = $6)`
+	}
+	err := tx.QueryRow(ctx,
+		`INSERT INTO appointments (`+cols+`) VALUES (`+vals+`) RETURNING `+s.orgCol("appointments"), args...,
+	).Scan(&a.OrgID)
+	if isExclusionViolation(err) {
+		return overlapErr(err)
+	}
 	if err != nil {
 		return err
 	}
@@ -33,52 +121,154 @@ func (s *Store) CreateAppointment(ctx context.Context, a *model.Appointment) err
 		}
 	}
 
-	return tx.Commit(ctx)
+	if a.RemindBefore > 0 {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO reminders (appointment_id, user_id, remind_at) VALUES ($1,$2,$3)`,
+			a.ID, a.UserID, a.StartTime.Add(-a.RemindBefore),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Appointment times are half-open, [start, end): back-to-back slots don't
+// conflict. Every range the store builds spells the bounds out so it can't
+// drift from the no_time_overlap constraint, which uses the same
+// expression (and so the same gist index).
+const rangeExpr = `tstzrange(start_time, end_time, '[)')`
+
+// ErrEmptyRange is returned for appointments whose end isn't after their
+// start; '[)' makes those empty ranges that would never conflict with anything.
+var ErrEmptyRange = errors.New("end must be after start")
+
+// ErrConflict is returned when the slot is already held by another confirmed
+// appointment of the same user: a timed one for a timed appointment, an
+// all-day one for an all-day event if those conflict at all.
+var ErrConflict = errors.New("time conflicts with existing appointment")
+
+// isExclusionViolation reports whether err is no_time_overlap or
+// no_resource_overlap firing.
+func isExclusionViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23P01"
 }
 
-func (s *Store) HasOverlap(ctx context.Context, userID string, start, end time.Time, excludeID string) (bool, error) {
-	q := `SELECT EXISTS(
+func (s *Store) HasOverlap(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string) (bool, error) {
+	var exists bool
+	err := s.read(ctx, "HasOverlap", func() error {
+		var err error
+		exists, err = s.hasOverlap(ctx, s.reads, userID, start, end, allDay, excludeID)
+		return err
+	})
+	return exists, err
+}
+
+// rowQuerier is a pool or a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// hasOverlap only compares like with like: timed appointments with timed
+// ones, all-day events with all-day ones and only with conflicts on.
+func (s *Store) hasOverlap(ctx context.Context, q rowQuerier, userID string, start, end time.Time, allDay bool, excludeID string) (bool, error) {
+	if !end.After(start) {
+		return false, ErrEmptyRange
+	}
+	if allDay && !s.allDayConflicts {
+		return false, nil
+	}
+	sql := `SELECT EXISTS(
 		SELECT 1 FROM appointments
 		WHERE user_id = $1
 		  AND status = 'confirmed'
-		  AND start_time < $3
-		  AND end_time > $2`
+		  AND ` + rangeExpr + ` && tstzrange($2, $3, '[)')
+		  AND ` + s.allDayCol("appointments") + ` = $4`
 
-	args := []any{userID, start, end}
+	args := []any{userID, start, end, allDay}
 
 	if excludeID != "" {
-		q += ` AND id != $4`
+		sql += ` AND id != $5`
 		args = append(args, excludeID)
 	}
-	q += `)`
+	sql += `)`
 
 	var exists bool
-	err := s.pool.QueryRow(ctx, q, args...).Scan(&exists)
+	err := q.QueryRow(ctx, sql, args...).Scan(&exists)
 	return exists, err
 }
 
-func (s *Store) ListAppointments(ctx context.Context, userID string, from, to time.Time) ([]model.Appointment, error) {
+// ListParams narrows ListAppointments to appointments overlapping [From, To),
+// including ones that straddle either edge. Results are ordered by
+// (start_time, id); AfterStart/AfterID is the keyset cursor of the last row
+// already seen.
+type ListParams struct {
+	From, To   time.Time
+	AfterStart time.Time
+	AfterID    string
+	Limit      int      // 0 = no limit
+	CalendarID string   // "" = every calendar
+	Statuses   []string // nil = confirmed only; 'invalid' rows never show
+	Tags       []string // nil = any; else appointments with at least one
+
+	// "completed" in Statuses is a confirmed appointment that ended at or
+	// before Now; zero = the database's clock
+	Now time.Time
+}
+
+// BusyIntervals returns the confirmed timed appointments of userID that
+// overlap w, other than excludeID, ordered by start. All-day events leave
+// the time free.
+func (s *Store) BusyIntervals(ctx context.Context, userID string, w slots.Interval, excludeID string) ([]slots.Interval, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, title, description, start_time, end_time,
-		        user_id, status, location, created_at, updated_at
-		 FROM appointments
-		 WHERE user_id = $1
-		   AND start_time >= $2 AND end_time <= $3
-		   AND status = 'confirmed'
-		 ORDER BY start_time`, userID, from, to,
+		`SELECT start_time, end_time FROM appointments
+		 WHERE user_id = $1 AND status = 'confirmed' AND id::text <> $4
+		   AND `+rangeExpr+` && tstzrange($2, $3, '[)')
+		   AND NOT `+s.allDayCol("appointments")+`
+		 ORDER BY start_time`,
+		userID, w.Start, w.End, excludeID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	var out []slots.Interval
+	for rows.Next() {
+		var iv slots.Interval
+		if err := rows.Scan(&iv.Start, &iv.End); err != nil {
+			return nil, err
+		}
+		out = append(out, iv)
+	}
+	return out, rows.Err()
+}
 
+// FindOverlaps returns up to limit confirmed appointments of userID that
+// overlap [start, end), other than excludeID, ordered by start: the ones
+// HasOverlap would have found for an appointment of the kind allDay says.
+// Only id, title and times are filled in.
+func (s *Store) FindOverlaps(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string, limit int) ([]model.Appointment, error) {
+	if allDay && !s.allDayConflicts {
+		return nil, nil
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, title, start_time, end_time FROM appointments
+		 WHERE user_id = $1 AND status = 'confirmed' AND id::text <> $4
+		   AND `+rangeExpr+` && tstzrange($2, $3, '[)')
+		   AND `+s.allDayCol("appointments")+` = $6
+		 ORDER BY start_time, id
+		 LIMIT $5`,
+		userID, start, end, excludeID, limit, allDay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	var out []model.Appointment
 	for rows.Next() {
-		var a model.Appointment
-		if err := rows.Scan(
-			&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
-			&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt,
-		); err != nil {
+		a := model.Appointment{UserID: userID}
+		if err := rows.Scan(&a.ID, &a.Title, &a.StartTime, &a.EndTime); err != nil {
 			return nil, err
 		}
 		out = append(out, a)
@@ -86,53 +276,383 @@ func (s *Store) ListAppointments(ctx context.Context, userID string, from, to ti
 	return out, rows.Err()
 }
 
-func (s *Store) GetAppointment(ctx context.Context, id string) (*model.Appointment, error) {
-	a := &model.Appointment{}
-	err := s.pool.QueryRow(ctx,
-		`SELECT id, title, description, start_time, end_time,
-		        user_id, status, location, created_at, updated_at
-		 FROM appointments WHERE id = $1`, id,
-	).Scan(&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
-		&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt)
+func (s *Store) ListAppointments(ctx context.Context, userID string, p ListParams) ([]model.Appointment, error) {
+	cal := s.calendarCol("appointments")
+	where, args, err := s.listWhere(ctx, userID, p)
 	if err != nil {
 		return nil, err
 	}
+	q := `SELECT id, title, description, start_time, end_time,
+	        user_id, status, location, created_at, updated_at, ` + cal + `, ` + s.resourceCol("appointments") + `,
+	        ` + s.tagsCol("appointments") + `, ` + s.capacityCol("appointments") + `, ` + s.rescheduleCountCol("appointments") + `,
+	        ` + s.allDayCol("appointments") + `, ` + s.timeZoneCol("appointments") + `, ` + s.orgCol("appointments") + `
+	 FROM appointments
+	 WHERE ` + where
+	if p.AfterID != "" {
+		args = append(args, p.AfterStart, p.AfterID)
+		q += fmt.Sprintf(` AND (start_time, id) > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	q += ` ORDER BY start_time, id`
+	if p.Limit > 0 {
+		q += fmt.Sprintf(` LIMIT %d`, p.Limit)
+	}
 
-	// load attendees
-	rows, err := s.pool.Query(ctx,
-		`SELECT user_id FROM appointment_attendees WHERE appointment_id = $1`, id)
+	var out []model.Appointment
+	err = s.read(ctx, "ListAppointments", func() error {
+		var err error
+		out, err = s.listAppointments(ctx, q, args)
+		return err
+	})
+	return out, err
+}
+
+// UpcomingAppointments returns up to limit confirmed appointments of
+// userID that end after now, ones already under way included, in start
+// order. idx_appointments_user_end starts it past the ones that have
+// ended, so only the user's future is read and sorted.
+func (s *Store) UpcomingAppointments(ctx context.Context, userID string, now time.Time, limit int) ([]model.Appointment, error) {
+	q := `SELECT id, title, description, start_time, end_time,
+	        user_id, status, location, created_at, updated_at, ` + s.calendarCol("appointments") + `, ` + s.resourceCol("appointments") + `,
+	        ` + s.tagsCol("appointments") + `, ` + s.capacityCol("appointments") + `, ` + s.rescheduleCountCol("appointments") + `,
+	        ` + s.allDayCol("appointments") + `, ` + s.timeZoneCol("appointments") + `, ` + s.orgCol("appointments") + `
+	 FROM appointments
+	 WHERE user_id = $1 AND status = 'confirmed' AND end_time > $2
+	 ORDER BY start_time, id
+	 LIMIT $3`
+
+	var out []model.Appointment
+	err := s.read(ctx, "UpcomingAppointments", func() error {
+		var err error
+		out, err = s.listAppointments(ctx, q, []any{userID, now, limit})
+		return err
+	})
+	return out, err
+}
+
+// CountAppointments counts what ListAppointments would return over every
+// page: the cursor and Limit in p are ignored. Rows with an invalid range
+// aren't counted, as they're skipped in lists.
+func (s *Store) CountAppointments(ctx context.Context, userID string, p ListParams) (int, error) {
+	where, args, err := s.listWhere(ctx, userID, p)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = s.read(ctx, "CountAppointments", func() error {
+		return s.reads.QueryRow(ctx,
+			`SELECT count(*) FROM appointments WHERE `+where+` AND end_time > start_time`, args...,
+		).Scan(&n)
+	})
+	return n, err
+}
+
+// listWhere is the filter part of a list, shared with its count. Rows
+// from before the calendar backfill have no calendar_id and belong to the
+// owner's default, so that one is looked up first instead of per row.
+func (s *Store) listWhere(ctx context.Context, userID string, p ListParams) (string, []any, error) {
+	cal := p.CalendarID
+	p.CalendarID = ""
+	q, args := s.filterWhere(`user_id = $1`, userID, p)
+	if cal == "" || !s.Has(FeatureCalendars) {
+		return q, args, nil
+	}
+	if _, err := uuid.Parse(cal); err != nil {
+		// no calendar has that ID
+		return q + ` AND FALSE`, args, nil
+	}
+	var def string
+	err := s.read(ctx, "DefaultCalendar", func() error {
+		return s.reads.QueryRow(ctx,
+			`SELECT id::text FROM calendars WHERE user_id = $1 AND is_default`, userID,
+		).Scan(&def)
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, err
+	}
+	args = append(args, cal)
+	q += fmt.Sprintf(` AND (calendar_id = $%d::uuid`, len(args))
+	if strings.EqualFold(cal, def) {
+		q += ` OR calendar_id IS NULL`
+	}
+	return q + `)`, args, nil
+}
+
+// filterWhere is listWhere with whose, a condition on arg as $1, picking
+// the rows instead of user_id.
+func (s *Store) filterWhere(whose string, arg any, p ListParams) (string, []any) {
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{"confirmed"}
+	}
+	completed := slices.Contains(statuses, "completed")
+	statuses = slices.DeleteFunc(slices.Clone(statuses), func(st string) bool { return st == "completed" })
+	args := []any{arg, p.From, p.To, statuses}
+	match := `status = ANY($4)`
+	if completed {
+		now := any(p.Now)
+		if p.Now.IsZero() {
+			now = nil
+		}
+		args = append(args, now)
+		match = fmt.Sprintf(`(status = ANY($4) OR (status = 'confirmed' AND end_time <= COALESCE($%d::timestamptz, NOW())))`, len(args))
+	}
+	q := whose + `
+	   AND start_time < $3 AND end_time > $2
+	   AND ` + match + ` AND status <> 'invalid'`
+
+	if len(p.Tags) > 0 {
+		args = append(args, p.Tags)
+		q += fmt.Sprintf(` AND tags && $%d::text[]`, len(args))
+	}
+	return q, args
+}
+
+func (s *Store) listAppointments(ctx context.Context, q string, args []any) ([]model.Appointment, error) {
+	rows, err := s.reads.Query(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var out []model.Appointment
 	for rows.Next() {
-		var uid string
-		if err := rows.Scan(&uid); err != nil {
+		var a model.Appointment
+		if err := rows.Scan(
+			&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
+			&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt, &a.CalendarID, &a.ResourceID, &a.Tags,
+			&a.Capacity, &a.RescheduleCount, &a.AllDay, &a.TimeZone, &a.OrgID,
+		); err != nil {
 			return nil, err
 		}
-		a.AttendeeIDs = append(a.AttendeeIDs, uid)
+		if !validRange(&a) {
+			continue
+		}
+		out = append(out, a)
 	}
-	return a, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.attachAttendees(ctx, out)
 }
 
-func (s *Store) UpdateAppointment(ctx context.Context, a *model.Appointment) error {
+// attachAttendees fills AttendeeIDs on a page of appointments with a single
+// query instead of one per row.
+func (s *Store) attachAttendees(ctx context.Context, apts []model.Appointment) error {
+	if len(apts) == 0 || !s.Has(FeatureAttendees) {
+		return nil
+	}
+	ids := make([]string, len(apts))
+	byID := make(map[string]*model.Appointment, len(apts))
+	for i := range apts {
+		ids[i] = apts[i].ID
+		byID[apts[i].ID] = &apts[i]
+	}
+	rows, err := s.reads.Query(ctx,
+		`SELECT appointment_id, user_id FROM appointment_attendees
+		 WHERE appointment_id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var aptID, uid string
+		if err := rows.Scan(&aptID, &uid); err != nil {
+			return err
+		}
+		if a := byID[aptID]; a != nil {
+			a.AttendeeIDs = append(a.AttendeeIDs, uid)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Store) GetAppointment(ctx context.Context, id string) (*model.Appointment, error) {
+	var a *model.Appointment
+	err := s.read(ctx, "GetAppointment", func() error {
+		var err error
+		a, err = s.getAppointment(ctx, id)
+		return err
+	})
+	return a, err
+}
+
+// one round trip, attendees included
+func (s *Store) getAppointment(ctx context.Context, id string) (*model.Appointment, error) {
+	a := &model.Appointment{}
+	err := s.reads.QueryRow(ctx,
+		`SELECT id, title, description, start_time, end_time,
+		        user_id, status, location, created_at, updated_at, `+s.calendarCol("appointments")+`,
+		        `+s.resourceCol("appointments")+`, `+s.tagsCol("appointments")+`, `+s.capacityCol("appointments")+`,
+		        `+s.rescheduleCountCol("appointments")+`, `+s.allDayCol("appointments")+`, `+s.timeZoneCol("appointments")+`,
+		        `+s.orgCol("appointments")+`, `+s.attendeesCol("appointments")+`
+		 FROM appointments WHERE id = $1 AND status <> 'invalid'`, id,
+	).Scan(&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
+		&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt, &a.CalendarID, &a.ResourceID, &a.Tags, &a.Capacity,
+		&a.RescheduleCount, &a.AllDay, &a.TimeZone, &a.OrgID, &a.AttendeeIDs)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// attendeesCol selects an appointment's attendee IDs as an array, empty
+// (array_agg over no rows is NULL) for none or without the feature.
+func (s *Store) attendeesCol(table string) string {
+	if !s.Has(FeatureAttendees) {
+		return `'{}'::text[]`
+	}
+	return `COALESCE((SELECT array_agg(aa.user_id::text) FROM appointment_attendees aa
+	          WHERE aa.appointment_id = ` + table + `.id), '{}')`
+}
+
+// UpdateAppointment overwrites the user's appointment with a, returning
+// pgx.ErrNoRows if there's no such appointment and ErrConflict if a
+// confirmed one is moved onto a taken slot (ErrResourceBooked if it's the
+// resource that's taken, ErrBuffer if it's moved within a.Buffer of
+// another). An update that changes nothing
+// writes nothing, audit row included.
+//
+// fields names what to write, by proto field name (title, start_time,
+// attendee_ids, ...); nil writes everything. Like the calendar, an empty
+// a.ResourceID keeps the current resource unless fields names it. The rest of a is filled in
+// from the stored row, so a ends up as the appointment now is.
+func (s *Store) UpdateAppointment(ctx context.Context, a *model.Appointment, fields []string) error {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
+	old, err := s.lockAppointment(ctx, tx, a.ID, a.UserID)
+	if err != nil {
+		return err
+	}
+	has := func(f string) bool { return fields == nil || slices.Contains(fields, f) }
+	if !has("title") {
+		a.Title = old.Title
+	}
+	if !has("description") {
+		a.Description = old.Description
+	}
+	if !has("start_time") {
+		a.StartTime = old.StartTime
+	}
+	if !has("end_time") {
+		a.EndTime = old.EndTime
+	}
+	if !has("location") {
+		a.Location = old.Location
+	}
+	if !has("attendee_ids") {
+		a.AttendeeIDs = old.AttendeeIDs
+	}
+	if !has("tags") || !s.Has(FeatureTags) {
+		a.Tags = old.Tags
+	}
+	if (fields == nil && a.ResourceID == "") || !has("resource_id") {
+		a.ResourceID = old.ResourceID
+	}
+	if (fields == nil && a.Capacity == 0) || !has("capacity") || !s.Has(FeatureCapacity) {
+		a.Capacity = old.Capacity
+	}
+	if !has("all_day") || !s.Has(FeatureAllDay) {
+		a.AllDay = old.AllDay
+	}
+	if !has("time_zone") || !s.Has(FeatureAllDay) {
+		a.TimeZone = old.TimeZone
+	}
+	if !a.EndTime.After(a.StartTime) {
+		return ErrEmptyRange
+	}
+	a.Status, a.CreatedAt, a.RescheduleCount = old.Status, old.CreatedAt, old.RescheduleCount
+	if !s.Has(FeatureAttendees) {
+		a.AttendeeIDs = nil
+	}
+	// joins hold this row's lock too, so the count can't move under us
+	if a.Capacity > 0 && len(a.AttendeeIDs) > a.Capacity {
+		return ErrFull
+	}
+	if a.CalendarID == "" || !has("calendar_id") {
+		a.CalendarID = old.CalendarID
+	} else if a.CalendarID != old.CalendarID {
+		if _, err := resolveCalendar(ctx, tx, a.UserID, a.CalendarID); err != nil {
+			return err
+		}
+	}
+	before, after := snapshot(old), snapshot(a)
+	if before.equal(after) {
+		a.UpdatedAt = old.UpdatedAt
+		return nil
+	}
+	if a.Status == "confirmed" {
+		// edits that keep the times don't answer to the buffer
+		buf := a.Buffer
+		if a.StartTime.Equal(old.StartTime) && a.EndTime.Equal(old.EndTime) && a.AllDay == old.AllDay {
+			buf = 0
+		}
+		if err := s.checkSlot(ctx, tx, a.UserID, a.StartTime, a.EndTime, a.AllDay, a.ID, buf); err != nil {
+			return err
+		}
+		if a.ResourceID != "" {
+			if err := checkResource(ctx, tx, a.ResourceID, a.StartTime, a.EndTime, a.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.appendAudit(ctx, tx, a.UserID, "update", a.ID, before, after); err != nil {
+		return err
+	}
+
+	if err := s.shiftReminders(ctx, tx, a.ID, a.UserID, a.StartTime); err != nil {
+		return err
+	}
+
+	// only the named columns; the row is locked, so the others are as read
+	set := []string{"updated_at=NOW()"}
+	args := []any{a.ID, a.UserID}
+	for _, c := range []struct {
+		field string
+		val   any
+	}{
+		{"title", a.Title},
+		{"description", a.Description},
+		{"start_time", a.StartTime},
+		{"end_time", a.EndTime},
+		{"location", a.Location},
+		{"calendar_id", a.CalendarID},
+		{"resource_id", nullable(a.ResourceID)},
+		{"tags", tagsArg(a.Tags)},
+		{"capacity", a.Capacity},
+		{"all_day", a.AllDay},
+		{"time_zone", a.TimeZone},
+	} {
+		switch {
+		case !has(c.field),
+			c.field == "calendar_id" && !s.Has(FeatureCalendars),
+			c.field == "resource_id" && !s.Has(FeatureResources),
+			c.field == "tags" && !s.Has(FeatureTags),
+			c.field == "capacity" && !s.Has(FeatureCapacity),
+			(c.field == "all_day" || c.field == "time_zone") && !s.Has(FeatureAllDay):
+			continue
+		}
+		args = append(args, c.val)
+		set = append(set, fmt.Sprintf("%s=$%d", c.field, len(args)))
+	}
 	_, err = tx.Exec(ctx,
-		`UPDATE appointments
-		 SET title=$1, description=$2, start_time=$3, end_time=$4, location=$5, updated_at=NOW()
-		 WHERE id=$6 AND user_id=$7`,
-		a.Title, a.Description, a.StartTime, a.EndTime, a.Location, a.ID, a.UserID,
-	)
+		`UPDATE appointments SET `+strings.Join(set, ", ")+`
+		 WHERE id=$1 AND user_id=$2 AND status <> 'invalid'`, args...)
+	if isExclusionViolation(err) {
+		return overlapErr(err)
+	}
 	if err != nil {
 		return err
 	}
 
+	if !s.Has(FeatureAttendees) || !has("attendee_ids") {
+		return commit(ctx, tx)
+	}
+
 	// replace attendees
 	_, _ = tx.Exec(ctx, `DELETE FROM appointment_attendees WHERE appointment_id=$1`, a.ID)
 	for _, uid := range a.AttendeeIDs {
@@ -145,13 +665,115 @@ func (s *Store) UpdateAppointment(ctx context.Context, a *model.Appointment) err
 		}
 	}
 
-	return tx.Commit(ctx)
+	return commit(ctx, tx)
 }
 
-func (s *Store) DeleteAppointment(ctx context.Context, id, userID string) error {
-	_, err := s.pool.Exec(ctx,
-		`UPDATE appointments SET status='cancelled', updated_at=NOW()
-		 WHERE id=$1 AND user_id=$2`, id, userID,
+// shiftReminders moves an appointment's reminders along with a new start,
+// before the appointment row itself is updated.
+func (s *Store) shiftReminders(ctx context.Context, tx pgx.Tx, id, userID string, start time.Time) error {
+	if !s.Has(FeatureReminders) {
+		return nil
+	}
+	// keep the same lead time; a moved appointment gets reminded again
+	_, err := tx.Exec(ctx,
+		`UPDATE reminders r
+		 SET remind_at = r.remind_at + ($1::timestamptz - a.start_time),
+		     sent_at = CASE WHEN a.start_time = $1::timestamptz THEN r.sent_at END
+		 FROM appointments a
+		 WHERE a.id = r.appointment_id AND a.id = $2 AND a.user_id = $3`,
+		start, id, userID,
 	)
 	return err
 }
+
+func (s *Store) DeleteAppointment(ctx context.Context, id, userID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := s.lockAppointment(ctx, tx, id, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil || a.Status == "cancelled" {
+		return err
+	}
+	if err := s.cancelLocked(ctx, tx, a, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// cancelLocked cancels a, locked in tx, on actorID's behalf. Its reminder
+// stays, with its lead time, for ActivateAppointment to bring back;
+// ClaimDueReminders skips it while the appointment is cancelled.
+func (s *Store) cancelLocked(ctx context.Context, tx pgx.Tx, a *model.Appointment, actorID string) error {
+	if _, err := tx.Exec(ctx,
+		`UPDATE appointments SET status='cancelled', updated_at=NOW() WHERE id=$1`, a.ID,
+	); err != nil {
+		return err
+	}
+	before := snapshot(a)
+	after := *before
+	after.Status = "cancelled"
+	return s.appendAuditFor(ctx, tx, actorID, a.UserID, "cancel", a.ID, before, &after)
+}
+
+// ActivateAppointment makes an inert appointment (cancelled, for now the only
+// one) confirmed again. Anything that brings an appointment back into the
+// calendar goes through here so the overlap check can't be forgotten: it
+// runs in the same transaction as the status flip, and no_time_overlap
+// catches whatever races past it. Returns ErrConflict if the slot is taken,
+// ErrResourceBooked if its resource is, and pgx.ErrNoRows if the user has no such appointment. Activating an
+// already confirmed appointment is a no-op. An unsent reminder comes back
+// with it, due at the same lead time; one that fell due while it was
+// cancelled goes out on the next poll if the appointment hasn't started.
+func (s *Store) ActivateAppointment(ctx context.Context, id, userID string) (*model.Appointment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := s.lockAppointment(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status != "confirmed" {
+		taken, err := s.slotTaken(ctx, tx, a.UserID, a.StartTime, a.EndTime, a.AllDay, a.ID)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrConflict
+		}
+		if a.ResourceID != "" {
+			if err := checkResource(ctx, tx, a.ResourceID, a.StartTime, a.EndTime, a.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE appointments SET status = 'confirmed', updated_at = NOW() WHERE id = $1`, id)
+		if isExclusionViolation(err) {
+			return nil, overlapErr(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		before := snapshot(a)
+		after := *before
+		after.Status = "confirmed"
+		if err := s.appendAudit(ctx, tx, userID, "restore", id, before, &after); err != nil {
+			return nil, err
+		}
+		if err := commit(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetAppointment(ctx, id)
+}
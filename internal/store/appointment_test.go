@@ -0,0 +1,201 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+)
+
+// fixture is a store on DATABASE_URL (migrated, as for the handler tests)
+// and a new user with n hour-long appointments, one a day from base on.
+// Users it makes go, with everything of theirs, at the end.
+type fixture struct {
+	st     *store.Store
+	pool   *pgxpool.Pool
+	userID string
+	base   time.Time
+}
+
+func seeded(tb testing.TB, n int) *fixture {
+	tb.Helper()
+	_ = godotenv.Load("../../.env")
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		tb.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := store.Connect(ctx, store.ConnectConfig{URL: dbURL, Attempts: 1})
+	if err != nil {
+		tb.Fatalf("db: %v", err)
+	}
+	tb.Cleanup(pool.Close)
+	f := &fixture{st: store.New(pool), pool: pool, base: time.Now().Add(24 * time.Hour).Truncate(time.Hour)}
+	if _, err := f.st.DetectCapabilities(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	f.userID = f.newUser(tb)
+
+	batch := make([]*model.Appointment, 0, 100)
+	flush := func() {
+		if err := f.st.CreateAppointments(ctx, batch); err != nil {
+			tb.Fatalf("seed: %v", err)
+		}
+		batch = batch[:0]
+	}
+	for i := range n {
+		start := f.base.Add(time.Duration(i) * 24 * time.Hour)
+		batch = append(batch, &model.Appointment{
+			ID: uuid.NewString(), Title: fmt.Sprintf("seed-%d", i), UserID: f.userID, Status: "confirmed",
+			StartTime: start, EndTime: start.Add(time.Hour),
+		})
+		if len(batch) == cap(batch) {
+			flush()
+		}
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	return f
+}
+
+func (f *fixture) newUser(tb testing.TB) string {
+	tb.Helper()
+	u := &model.User{ID: uuid.NewString(), Email: fmt.Sprintf("seed-%s@test.com", uuid.NewString()[:8]), PasswordHash: "x", Name: "Seed"}
+	if err := f.st.CreateUser(context.Background(), u); err != nil {
+		tb.Fatalf("user: %v", err)
+	}
+	tb.Cleanup(func() { f.pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, u.ID) })
+	return u.ID
+}
+
+func TestGetAppointmentAttendees(t *testing.T) {
+	f := seeded(t, 0)
+	st, owner, base := f.st, f.userID, f.base
+	ctx := context.Background()
+	guest := f.newUser(t)
+
+	alone := &model.Appointment{ID: uuid.NewString(), Title: "alone", UserID: owner, Status: "confirmed", StartTime: base, EndTime: base.Add(time.Hour)}
+	with := &model.Appointment{ID: uuid.NewString(), Title: "with", UserID: owner, Status: "confirmed",
+		StartTime: base.Add(2 * time.Hour), EndTime: base.Add(3 * time.Hour), AttendeeIDs: []string{guest}}
+	if err := st.CreateAppointments(ctx, []*model.Appointment{alone, with}); err != nil {
+		t.Fatal(err)
+	}
+
+	// no attendees aggregates to NULL, which has to come back empty
+	got, err := st.GetAppointment(ctx, alone.ID)
+	if err != nil {
+		t.Fatalf("get without attendees: %v", err)
+	}
+	if got.AttendeeIDs == nil || len(got.AttendeeIDs) != 0 {
+		t.Errorf("attendees %#v; want an empty slice", got.AttendeeIDs)
+	}
+	got, err = st.GetAppointment(ctx, with.ID)
+	if err != nil {
+		t.Fatalf("get with attendees: %v", err)
+	}
+	if len(got.AttendeeIDs) != 1 || got.AttendeeIDs[0] != guest {
+		t.Errorf("attendees %v; want [%s]", got.AttendeeIDs, guest)
+	}
+}
+
+// creates racing for neighbouring slots, each within its neighbours' buffer:
+// whichever get through, no two of them end up too close
+func TestBufferRace(t *testing.T) {
+	f := seeded(t, 0)
+	ctx := context.Background()
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := f.base.Add(time.Duration(i) * 65 * time.Minute)
+			errs[i] = f.st.CreateAppointment(ctx, &model.Appointment{
+				ID: uuid.NewString(), Title: fmt.Sprintf("race-%d", i), UserID: f.userID, Status: "confirmed",
+				StartTime: start, EndTime: start.Add(time.Hour), Buffer: 10 * time.Minute,
+			})
+		}()
+	}
+	wg.Wait()
+
+	booked := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			booked++
+		case !errors.Is(err, store.ErrBuffer):
+			t.Errorf("create %d: %v", i, err)
+		}
+	}
+	// every other one fits at best; each booking rules out its neighbours
+	if booked == 0 || booked > n/2 {
+		t.Fatalf("%d booked", booked)
+	}
+	apts, err := f.st.ListAppointments(ctx, f.userID, store.ListParams{From: f.base, To: f.base.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(apts); i++ {
+		if gap := apts[i].StartTime.Sub(apts[i-1].EndTime); gap < 10*time.Minute {
+			t.Errorf("%s and %s are %v apart", apts[i-1].Title, apts[i].Title, gap)
+		}
+	}
+}
+
+// a year of appointments; the probe lands on a free evening among them
+func BenchmarkHasOverlap(b *testing.B) {
+	f := seeded(b, 365)
+	st, uid, base := f.st, f.userID, f.base
+	ctx := context.Background()
+	at := base.Add(180*24*time.Hour + 6*time.Hour)
+	b.ResetTimer()
+	for b.Loop() {
+		if dup, err := st.HasOverlap(ctx, uid, at, at.Add(time.Hour), false, ""); err != nil || dup {
+			b.Fatalf("overlap: %v %v", dup, err)
+		}
+	}
+}
+
+// a month's page out of a year of appointments
+func BenchmarkList(b *testing.B) {
+	f := seeded(b, 365)
+	st, uid, base := f.st, f.userID, f.base
+	ctx := context.Background()
+	from := base.Add(90 * 24 * time.Hour)
+	p := store.ListParams{From: from, To: from.Add(31 * 24 * time.Hour), Limit: 51}
+	b.ResetTimer()
+	for b.Loop() {
+		if apts, err := st.ListAppointments(ctx, uid, p); err != nil || len(apts) != 31 {
+			b.Fatalf("list: %d %v", len(apts), err)
+		}
+	}
+}
+
+func BenchmarkGetAppointment(b *testing.B) {
+	f := seeded(b, 1)
+	st, uid, base := f.st, f.userID, f.base
+	ctx := context.Background()
+	apts, err := st.ListAppointments(ctx, uid, store.ListParams{From: base, To: base.Add(time.Hour)})
+	if err != nil || len(apts) != 1 {
+		b.Fatalf("list: %v %v", apts, err)
+	}
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := st.GetAppointment(ctx, apts[0].ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// AuditSnapshot is what appointment_audit keeps of an appointment on each
+// side of a change.
+type AuditSnapshot struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Status      string    `json:"status"`
+	Location    string    `json:"location"`
+	AttendeeIDs []string  `json:"attendee_ids,omitempty"`
+	CalendarID  string    `json:"calendar_id,omitempty"`
+	ResourceID  string    `json:"resource_id,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Capacity    int       `json:"capacity,omitempty"`
+	AllDay      bool      `json:"all_day,omitempty"`
+	TimeZone    string    `json:"time_zone,omitempty"`
+}
+
+func snapshot(a *model.Appointment) *AuditSnapshot {
+	ids := slices.Clone(a.AttendeeIDs)
+	slices.Sort(ids)
+	return &AuditSnapshot{
+		Title:       a.Title,
+		Description: a.Description,
+		StartTime:   a.StartTime.UTC(),
+		EndTime:     a.EndTime.UTC(),
+		Status:      a.Status,
+		Location:    a.Location,
+		AttendeeIDs: ids,
+		CalendarID:  a.CalendarID,
+		ResourceID:  a.ResourceID,
+		Tags:        a.Tags,
+		Capacity:    a.Capacity,
+		AllDay:      a.AllDay,
+		TimeZone:    a.TimeZone,
+	}
+}
+
+func (s *AuditSnapshot) equal(o *AuditSnapshot) bool {
+	return s.Title == o.Title && s.Description == o.Description &&
+		s.StartTime.Equal(o.StartTime) && s.EndTime.Equal(o.EndTime) &&
+		s.Status == o.Status && s.Location == o.Location &&
+		slices.Equal(s.AttendeeIDs, o.AttendeeIDs) && s.CalendarID == o.CalendarID &&
+		s.ResourceID == o.ResourceID && slices.Equal(s.Tags, o.Tags) && s.Capacity == o.Capacity &&
+		s.AllDay == o.AllDay && s.TimeZone == o.TimeZone
+}
+
+// AuditEntry is one change to an appointment. Before is nil for a create.
+type AuditEntry struct {
+	ID            int64
+	AppointmentID string
+	ActorID       string // "" once that user is purged
+	Action        string // create, update, cancel, restore, join, leave
+	Before, After *AuditSnapshot
+	CreatedAt     time.Time
+}
+
+// appendAudit records a change and queues the owner's webhooks and the
+// outbox event for it. It takes the mutation's transaction, so they all
+// commit or roll back with the change itself.
+func (s *Store) appendAudit(ctx context.Context, tx pgx.Tx, actorID, action, appointmentID string, before, after *AuditSnapshot) error {
+	return s.appendAuditFor(ctx, tx, actorID, actorID, action, appointmentID, before, after)
+}
+
+// appendAuditFor is appendAudit for a change someone other than the owner
+// made to their appointment: the owner's webhooks hear of it.
+func (s *Store) appendAuditFor(ctx context.Context, tx pgx.Tx, actorID, ownerID, action, appointmentID string, before, after *AuditSnapshot) error {
+	if s.Has(FeatureAppointmentAudit) {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO appointment_audit (appointment_id, actor_id, action, before, after)
+			 VALUES ($1,$2,$3,$4,$5)`,
+			appointmentID, actorID, action, before, after,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if !s.Has(FeatureWebhooks) && !s.publishesEvents() {
+		return nil
+	}
+	p := changePayload(action, appointmentID, before, after)
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := s.enqueueWebhooks(ctx, tx, ownerID, p.Event, body); err != nil {
+		return err
+	}
+	return s.enqueueEvent(ctx, tx, p.Event, appointmentID, body)
+}
+
+// lockAppointment loads the user's appointment, attendees included, and
+// holds its row lock for the rest of tx.
+func (s *Store) lockAppointment(ctx context.Context, tx pgx.Tx, id, userID string) (*model.Appointment, error) {
+	a := &model.Appointment{}
+	err := tx.QueryRow(ctx,
+		`SELECT id, title, description, start_time, end_time,
+		        user_id, status, location, created_at, updated_at, `+s.calendarCol("appointments")+`,
+		        `+s.resourceCol("appointments")+`, `+s.tagsCol("appointments")+`, `+s.capacityCol("appointments")+`,
+		        `+s.rescheduleCountCol("appointments")+`, `+s.allDayCol("appointments")+`, `+s.timeZoneCol("appointments")+`,
+		        `+s.orgCol("appointments")+`
+		 FROM appointments
+		 WHERE id = $1 AND user_id = $2 AND status <> 'invalid'
+		 FOR UPDATE OF appointments`, id, userID,
+	).Scan(&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
+		&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt, &a.CalendarID, &a.ResourceID, &a.Tags, &a.Capacity,
+		&a.RescheduleCount, &a.AllDay, &a.TimeZone, &a.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Has(FeatureAttendees) {
+		return a, nil
+	}
+	rows, err := tx.Query(ctx, `SELECT user_id FROM appointment_attendees WHERE appointment_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	a.AttendeeIDs, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	return a, err
+}
+
+// AppointmentHistory returns an appointment's audit entries oldest first,
+// starting after the entry with ID afterID.
+func (s *Store) AppointmentHistory(ctx context.Context, appointmentID string, afterID int64, limit int) ([]AuditEntry, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, appointment_id, COALESCE(actor_id::text, ''), action, before, after, created_at
+		 FROM appointment_audit
+		 WHERE appointment_id = $1 AND id > $2
+		 ORDER BY id
+		 LIMIT $3`, appointmentID, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.AppointmentID, &e.ActorID, &e.Action, &e.Before, &e.After, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// Availability returns userID's availability; a user who never set one
+// gets no windows in UTC, unenforced.
+func (s *Store) Availability(ctx context.Context, userID string) (*model.Availability, error) {
+	a := &model.Availability{UserID: userID, TimeZone: "UTC"}
+	err := s.pool.QueryRow(ctx,
+		`SELECT time_zone, windows, enforce, updated_at FROM user_availability WHERE user_id = $1`,
+		userID,
+	).Scan(&a.TimeZone, &a.Windows, &a.Enforce, &a.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetAvailability replaces a.UserID's availability and fills in
+// UpdatedAt. Appointments already booked are left as they are.
+func (s *Store) SetAvailability(ctx context.Context, a *model.Availability) error {
+	windows := a.Windows
+	if windows == nil {
+		windows = []model.AvailabilityWindow{}
+	}
+	return s.pool.QueryRow(ctx,
+		`INSERT INTO user_availability (user_id, time_zone, windows, enforce)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET time_zone = EXCLUDED.time_zone, windows = EXCLUDED.windows,
+		     enforce = EXCLUDED.enforce, updated_at = NOW()
+		 RETURNING updated_at`,
+		a.UserID, a.TimeZone, windows, a.Enforce,
+	).Scan(&a.UpdatedAt)
+}
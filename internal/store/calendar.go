@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"schedule-management-api/internal/model"
+)
+
+var (
+	// ErrUnknownCalendar is returned when an appointment names a calendar
+	// that doesn't exist or isn't the user's.
+	ErrUnknownCalendar = errors.New("calendar not found")
+	// ErrDefaultCalendar is returned for deleting the default calendar.
+	ErrDefaultCalendar = errors.New("the default calendar can't be deleted")
+	// ErrCalendarInUse is returned for deleting a calendar that still has
+	// confirmed appointments.
+	ErrCalendarInUse = errors.New("calendar still has confirmed appointments")
+	// ErrCalendarExists is returned when the user already has a calendar
+	// with that name.
+	ErrCalendarExists = errors.New("a calendar with that name already exists")
+)
+
+// isUniqueViolation reports whether err is a unique constraint firing.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// DefaultCalendarName is what the calendar created for every user is called.
+const DefaultCalendarName = "Calendar"
+
+// calendarCol selects an appointment's calendar as text. Rows from before
+// the backfill have none and read as the owner's default. Without the
+// feature it's always "".
+func (s *Store) calendarCol(table string) string {
+	if !s.Has(FeatureCalendars) {
+		return `''`
+	}
+	return `COALESCE(` + table + `.calendar_id, (SELECT c.id FROM calendars c
+	          WHERE c.user_id = ` + table + `.user_id AND c.is_default))::text`
+}
+
+// defaultCalendar returns userID's default calendar, creating it if the user
+// is newer than the migration.
+func defaultCalendar(ctx context.Context, q rowQuerier, userID string) (string, error) {
+	var id string
+	err := q.QueryRow(ctx,
+		`WITH ins AS (
+		   INSERT INTO calendars (user_id, name, is_default) VALUES ($1, $2, TRUE)
+		   ON CONFLICT (user_id) WHERE is_default DO NOTHING
+		   RETURNING id)
+		 SELECT id FROM ins
+		 UNION ALL
+		 SELECT id FROM calendars WHERE user_id = $1 AND is_default
+		 LIMIT 1`, userID, DefaultCalendarName,
+	).Scan(&id)
+	return id, err
+}
+
+// resolveCalendar checks that calendarID (a valid UUID) is userID's, or
+// picks the default when it's empty.
+func resolveCalendar(ctx context.Context, q rowQuerier, userID, calendarID string) (string, error) {
+	if calendarID == "" {
+		return defaultCalendar(ctx, q, userID)
+	}
+	var id string
+	err := q.QueryRow(ctx,
+		`SELECT id FROM calendars WHERE id = $1 AND user_id = $2`, calendarID, userID,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUnknownCalendar
+	}
+	return id, err
+}
+
+// CreateCalendar adds a non-default calendar. A name the user already has
+// fails with ErrCalendarExists.
+func (s *Store) CreateCalendar(ctx context.Context, c *model.Calendar) error {
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO calendars (user_id, name, color) VALUES ($1,$2,$3)
+		 RETURNING id, is_default, created_at`,
+		c.UserID, c.Name, c.Color,
+	).Scan(&c.ID, &c.IsDefault, &c.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrCalendarExists
+	}
+	return err
+}
+
+// Calendars lists userID's calendars, default first, then by name.
+func (s *Store) Calendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	if _, err := defaultCalendar(ctx, s.pool, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, user_id, name, color, is_default, created_at FROM calendars
+		 WHERE user_id = $1 ORDER BY is_default DESC, name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Calendar, error) {
+		var c model.Calendar
+		err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.Color, &c.IsDefault, &c.CreatedAt)
+		return c, err
+	})
+}
+
+// UpdateCalendar renames/recolours the user's calendar and, with
+// makeDefault, makes it the default instead of the current one. Returns
+// pgx.ErrNoRows if there's no such calendar and ErrCalendarExists if the
+// new name is taken.
+func (s *Store) UpdateCalendar(ctx context.Context, c *model.Calendar, makeDefault bool) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if makeDefault {
+		// the unique index allows one default at a time, so clear the old
+		// one first; a no-op when it's already this calendar
+		_, err := tx.Exec(ctx,
+			`UPDATE calendars SET is_default = FALSE
+			 WHERE user_id = $1 AND is_default AND id <> $2
+			   AND EXISTS (SELECT 1 FROM calendars WHERE id = $2 AND user_id = $1)`,
+			c.UserID, c.ID)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRow(ctx,
+		`UPDATE calendars SET name = $3, color = $4, is_default = is_default OR $5
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING is_default, created_at`,
+		c.ID, c.UserID, c.Name, c.Color, makeDefault,
+	).Scan(&c.IsDefault, &c.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrCalendarExists
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteCalendar removes one of the user's calendars. It refuses while the
+// calendar holds confirmed appointments (ErrCalendarInUse) and for the
+// default (ErrDefaultCalendar); cancelled appointments in it move to the
+// default calendar. Returns pgx.ErrNoRows if there's no such calendar.
+func (s *Store) DeleteCalendar(ctx context.Context, id, userID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var isDefault bool
+	err = tx.QueryRow(ctx,
+		`SELECT is_default FROM calendars WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID,
+	).Scan(&isDefault)
+	if err != nil {
+		return err
+	}
+	if isDefault {
+		return ErrDefaultCalendar
+	}
+
+	// the row lock above keeps new bookings out: inserting one takes a
+	// KEY SHARE lock on the calendar for the foreign key
+	var inUse bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM appointments WHERE calendar_id = $1 AND status = 'confirmed')`, id,
+	).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCalendarInUse
+	}
+
+	def, err := defaultCalendar(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE appointments SET calendar_id = $1 WHERE calendar_id = $2`, def, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM calendars WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CalendarBackfill fills calendar_id on appointments from before calendars
+// existed. Run it with Backfill.
+var CalendarBackfill = Backfill{
+	Table: "appointments",
+	Set: `calendar_id = (SELECT c.id FROM calendars c
+	        WHERE c.user_id = appointments.user_id AND c.is_default)`,
+	Where: `calendar_id IS NULL AND EXISTS (SELECT 1 FROM calendars c
+	          WHERE c.user_id = appointments.user_id AND c.is_default)`,
+}
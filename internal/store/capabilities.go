@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"sort"
+)
+
+// Optional features backed by tables (or columns) a partially migrated
+// database may not have yet. Core CRUD on users and appointments works
+// without any of them.
+const (
+	FeatureAttendees        = "attendees"
+	FeaturePasswordReset    = "password_reset"
+	FeatureShareLinks       = "share_links"
+	FeatureAccountDeletion  = "account_deletion"
+	FeatureAdminAudit       = "admin_audit"
+	FeatureReminders        = "reminders"
+	FeatureAppointmentAudit = "appointment_audit"
+	FeatureIdempotencyKeys  = "idempotency_keys"
+	FeatureFreezeWindows    = "freeze_windows"
+	FeatureCalendars        = "calendars"
+	FeatureRoles            = "roles"
+	FeatureLoginLockout     = "login_lockout"
+	FeatureResources        = "resources"
+	FeatureWebhooks         = "webhooks"
+	FeatureTags             = "tags"
+	FeatureAvailability     = "availability"
+	FeatureEmailVerify      = "email_verification"
+	FeaturePreferences      = "preferences"
+	FeatureSessions         = "sessions"
+	FeatureCapacity         = "capacity"
+	FeatureEventsOutbox     = "events_outbox"
+	FeatureReschedules      = "reschedules"
+	FeatureAllDay           = "all_day"
+	FeatureOrganizations    = "organizations"
+	FeatureScheduleVersion  = "schedule_version"
+)
+
+// what has to exist for each feature; an empty column means just the table
+var featureSchema = map[string]struct{ table, column string }{
+	FeatureAttendees:        {"appointment_attendees", ""},
+	FeaturePasswordReset:    {"password_reset_tokens", ""},
+	FeatureShareLinks:       {"share_links", ""},
+	FeatureAccountDeletion:  {"users", "deleted_at"},
+	FeatureAdminAudit:       {"admin_audit", ""},
+	FeatureReminders:        {"reminders", ""},
+	FeatureAppointmentAudit: {"appointment_audit", ""},
+	FeatureIdempotencyKeys:  {"idempotency_keys", "request_hash"},
+	FeatureFreezeWindows:    {"freeze_windows", ""},
+	FeatureCalendars:        {"appointments", "calendar_id"},
+	FeatureRoles:            {"users", "role"},
+	FeatureLoginLockout:     {"login_attempts", ""},
+	FeatureResources:        {"appointments", "resource_id"},
+	FeatureWebhooks:         {"webhook_deliveries", ""},
+	FeatureTags:             {"appointments", "tags"},
+	FeatureAvailability:     {"user_availability", ""},
+	FeatureEmailVerify:      {"email_verification_tokens", ""},
+	FeaturePreferences:      {"user_preferences", ""},
+	FeatureSessions:         {"refresh_tokens", "user_agent"},
+	FeatureCapacity:         {"appointments", "capacity"},
+	FeatureEventsOutbox:     {"outbox_events", ""},
+	FeatureReschedules:      {"appointment_reschedules", ""},
+	FeatureAllDay:           {"appointments", "all_day"},
+	FeatureOrganizations:    {"organization_members", ""},
+	FeatureScheduleVersion:  {"users", "schedule_version"},
+}
+
+// Capabilities maps feature name -> available.
+type Capabilities map[string]bool
+
+// DetectCapabilities looks the optional tables up in the current schema and
+// remembers the result. Call once at startup, before serving; until then
+// every feature is assumed present.
+func (s *Store) DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	caps := Capabilities{}
+	for name, f := range featureSchema {
+		var ok bool
+		err := s.pool.QueryRow(ctx,
+			`SELECT EXISTS (
+			   SELECT 1 FROM information_schema.columns
+			   WHERE table_schema = current_schema() AND table_name = $1
+			     AND ($2 = '' OR column_name = $2))`,
+			f.table, f.column,
+		).Scan(&ok)
+		if err != nil {
+			return nil, err
+		}
+		caps[name] = ok
+	}
+	s.caps = caps
+	return caps, nil
+}
+
+// Features lists every optional feature name, sorted.
+func Features() []string {
+	out := make([]string, 0, len(featureSchema))
+	for name := range featureSchema {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Has reports whether the schema supports feature.
+func (s *Store) Has(feature string) bool {
+	if s == nil || s.caps == nil {
+		return true
+	}
+	return s.caps[feature]
+}
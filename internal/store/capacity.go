@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// ErrFull is returned when a group appointment has no spots left.
+var ErrFull = errors.New("appointment is full")
+
+// capacityCol selects an appointment's capacity, 0 (private) without the
+// feature.
+func (s *Store) capacityCol(table string) string {
+	if !s.Has(FeatureCapacity) {
+		return `0`
+	}
+	return table + `.capacity`
+}
+
+// JoinAppointment adds userID to the attendees of someone else's confirmed
+// group appointment. The row lock makes the count and the insert one step,
+// so concurrent joins can't overfill it: ErrFull once capacity is reached.
+// pgx.ErrNoRows if there's no such appointment open to joining (private,
+// not confirmed, or userID's own). Joining twice is a no-op.
+func (s *Store) JoinAppointment(ctx context.Context, id, userID string) (*model.Appointment, error) {
+	if !s.Has(FeatureCapacity) {
+		return nil, pgx.ErrNoRows
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := s.lockJoinable(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(a.AttendeeIDs, userID) {
+		return a, nil
+	}
+	if len(a.AttendeeIDs) >= a.Capacity {
+		return nil, ErrFull
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO appointment_attendees (appointment_id, user_id) VALUES ($1,$2)`, id, userID,
+	); err != nil {
+		return nil, err
+	}
+	before := snapshot(a)
+	a.AttendeeIDs = append(a.AttendeeIDs, userID)
+	if err := s.appendAuditFor(ctx, tx, userID, a.UserID, "join", id, before, snapshot(a)); err != nil {
+		return nil, err
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// LeaveAppointment takes userID off the attendees of someone else's group
+// appointment; pgx.ErrNoRows if they aren't on it.
+func (s *Store) LeaveAppointment(ctx context.Context, id, userID string) error {
+	if !s.Has(FeatureCapacity) {
+		return pgx.ErrNoRows
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner string
+	if err := tx.QueryRow(ctx,
+		`SELECT user_id FROM appointments WHERE id = $1 AND status <> 'invalid'`, id,
+	).Scan(&owner); err != nil {
+		return err
+	}
+	a, err := s.lockAppointment(ctx, tx, id, owner)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(a.AttendeeIDs, userID) {
+		return pgx.ErrNoRows
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM appointment_attendees WHERE appointment_id = $1 AND user_id = $2`, id, userID,
+	); err != nil {
+		return err
+	}
+	before := snapshot(a)
+	a.AttendeeIDs = slices.DeleteFunc(a.AttendeeIDs, func(u string) bool { return u == userID })
+	if err := s.appendAuditFor(ctx, tx, userID, owner, "leave", id, before, snapshot(a)); err != nil {
+		return err
+	}
+	return commit(ctx, tx)
+}
+
+// lockJoinable locks appointment id for userID to join, pgx.ErrNoRows
+// unless it's someone else's confirmed group appointment.
+func (s *Store) lockJoinable(ctx context.Context, tx pgx.Tx, id, userID string) (*model.Appointment, error) {
+	var owner string
+	if err := tx.QueryRow(ctx,
+		`SELECT user_id FROM appointments WHERE id = $1 AND status <> 'invalid'`, id,
+	).Scan(&owner); err != nil {
+		return nil, err
+	}
+	if owner == userID {
+		return nil, pgx.ErrNoRows
+	}
+	a, err := s.lockAppointment(ctx, tx, id, owner)
+	if err != nil {
+		return nil, err
+	}
+	if a.Capacity == 0 || a.Status != "confirmed" {
+		return nil, pgx.ErrNoRows
+	}
+	return a, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ConnectConfig is how Connect builds the pool and how long it keeps trying.
+// Zero fields keep the pgxpool default (or whatever DATABASE_URL's
+// pool_max_conns etc. say) and the retry defaults below.
+type ConnectConfig struct {
+	URL string
+
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// describe-only queries instead of prepared statements, for
+	// pgbouncer in transaction mode
+	NoStatementCache bool
+
+	Attempts int           // pings before giving up
+	Timeout  time.Duration // for all attempts together
+	Backoff  time.Duration // wait after the first failure, doubled each time
+}
+
+const (
+	defaultConnectAttempts = 10
+	defaultConnectTimeout  = 30 * time.Second
+	defaultConnectBackoff  = 250 * time.Millisecond
+	maxConnectBackoff      = 5 * time.Second
+
+	// how long a cancelled query gets to stop before its connection is cut
+	cancelGrace = 2 * time.Second
+)
+
+// Connect opens the pool and pings it until the database answers, so the
+// server can start alongside a Postgres that's still coming up. It gives
+// up after cfg.Attempts pings or cfg.Timeout, whichever comes first, with
+// the last ping error. A bad URL fails straight away.
+func Connect(ctx context.Context, cfg ConnectConfig) (*pgxpool.Pool, error) {
+	pc, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("db config: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		pc.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		pc.MinConns = cfg.MinConns
+	}
+	if pc.MinConns > pc.MaxConns {
+		return nil, fmt.Errorf("db config: min conns %d above max conns %d", pc.MinConns, pc.MaxConns)
+	}
+	if cfg.MaxConnLifetime > 0 {
+		pc.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		pc.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	pc.ConnConfig.Tracer = QueryTracer()
+
+	// each connection prepares a query text the first time it runs it and
+	// reuses the statement after, so the hot ones (overlap checks, lists,
+	// GetAppointment) are parsed and planned once per connection. The
+	// store keeps its query texts stable for that: optional columns are
+	// fixed once capabilities are detected.
+	if cfg.NoStatementCache {
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	} else {
+		pc.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	}
+
+	// when a query's context ends, ask the server to cancel it rather than
+	// just dropping the connection, which leaves the query running there
+	pc.ConnConfig.BuildContextWatcherHandler = func(c *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: c, DeadlineDelay: cancelGrace}
+	}
+
+	attempts := cfg.Attempts
+	if attempts <= 0 {
+		attempts = defaultConnectAttempts
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultConnectTimeout
+	}
+	backoff := cfg.Backoff
+	if backoff <= 0 {
+		backoff = defaultConnectBackoff
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// the pool dials lazily (or in the background for MinConns), so only
+	// the pings need retrying
+	pool, err := pgxpool.NewWithConfig(ctx, pc)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	for i := 1; ; i++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+		if i == attempts || ctx.Err() != nil {
+			pool.Close()
+			return nil, fmt.Errorf("db ping: gave up after %d attempts: %w", i, err)
+		}
+		log.Printf("db ping failed (attempt %d/%d), retrying in %s: %v", i, attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			pool.Close()
+			return nil, fmt.Errorf("db ping: gave up after %d attempts: %w", i, err)
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
@@ -0,0 +1,189 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/joho/godotenv"
+
+	"schedule-management-api/internal/store"
+)
+
+// freePort returns an address nothing listens on (until someone does).
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// fakePostgres answers just enough of the wire protocol for a ping:
+// trust auth, then an empty result for every simple query. It serves
+// until l is closed.
+func fakePostgres(l net.Listener) {
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				be := pgproto3.NewBackend(c, c)
+				if _, err := be.ReceiveStartupMessage(); err != nil {
+					return
+				}
+				be.Send(&pgproto3.AuthenticationOk{})
+				be.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+				be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+				if be.Flush() != nil {
+					return
+				}
+				for {
+					msg, err := be.Receive()
+					if err != nil {
+						return
+					}
+					switch msg.(type) {
+					case *pgproto3.Query:
+						be.Send(&pgproto3.EmptyQueryResponse{})
+						be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+						if be.Flush() != nil {
+							return
+						}
+					case *pgproto3.Terminate:
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func dsn(addr string) string {
+	return "postgres://u@" + addr + "/db?sslmode=disable&connect_timeout=1"
+}
+
+func TestConnectGivesUpAfterAttempts(t *testing.T) {
+	start := time.Now()
+	_, err := store.Connect(context.Background(), store.ConnectConfig{
+		URL:      dsn(freePort(t)),
+		Attempts: 3,
+		Backoff:  10 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("err = %v, want to give up after 3 attempts", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %s", d)
+	}
+}
+
+func TestConnectGivesUpAfterTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := store.Connect(context.Background(), store.ConnectConfig{
+		URL:      dsn(freePort(t)),
+		Attempts: 1000,
+		Timeout:  300 * time.Millisecond,
+		Backoff:  10 * time.Millisecond,
+	})
+	if err == nil {
+		t.Fatal("connected to nothing")
+	}
+	if d := time.Since(start); d < 300*time.Millisecond || d > 2*time.Second {
+		t.Errorf("gave up after %s, want about 300ms", d)
+	}
+}
+
+func TestConnectBadConfig(t *testing.T) {
+	_, err := store.Connect(context.Background(), store.ConnectConfig{URL: dsn(freePort(t)), MaxConns: 2, MinConns: 5})
+	if err == nil || !strings.Contains(err.Error(), "db config") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// the database comes up while Connect is backing off
+func TestConnectRetriesUntilUp(t *testing.T) {
+	addr := freePort(t)
+	up := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			close(up)
+			return
+		}
+		fakePostgres(l)
+		up <- l
+	}()
+
+	pool, err := store.Connect(context.Background(), store.ConnectConfig{
+		URL:      dsn(addr),
+		MaxConns: 4,
+		Attempts: 20,
+		Timeout:  10 * time.Second,
+		Backoff:  20 * time.Millisecond,
+	})
+	l, ok := <-up
+	if !ok {
+		t.Skip("port taken before the fake server could bind it")
+	}
+	defer l.Close()
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer pool.Close()
+	if got := pool.Config().MaxConns; got != 4 {
+		t.Errorf("MaxConns = %d", got)
+	}
+}
+
+// a query whose context runs out stops on the server too, and the
+// connection stays usable
+func TestQueryCancelReachesPostgres(t *testing.T) {
+	_ = godotenv.Load("../../.env")
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	pool, err := store.Connect(context.Background(), store.ConnectConfig{URL: dbURL, MaxConns: 1})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer pool.Close()
+
+	marker := fmt.Sprintf("cancel-test-%d", time.Now().UnixNano())
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = pool.Exec(ctx, `SELECT pg_sleep(30) /* `+marker+` */`)
+	if err == nil {
+		t.Fatal("pg_sleep outlived its deadline")
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("returned after %s", took)
+	}
+
+	// MaxConns is 1, so this runs on the connection the sleep had
+	var running int
+	err = pool.QueryRow(context.Background(),
+		`SELECT count(*) FROM pg_stat_activity WHERE state = 'active' AND query LIKE '%' || $1 || '%' AND pid <> pg_backend_pid()`,
+		marker,
+	).Scan(&running)
+	if err != nil {
+		t.Fatalf("after cancel: %v", err)
+	}
+	if running != 0 {
+		t.Error("pg_sleep still running on the server")
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+// CreateEmailVerificationToken stores a new verification token hash for the
+// user and invalidates any earlier unused ones, so only the latest email
+// works.
+func (s *Store) CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1,$2,$3)`,
+		userID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeEmailVerificationToken marks a valid (unused, unexpired) token used,
+// marks its user verified and returns the user. One statement, so a token
+// can't be spent twice.
+func (s *Store) ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+	err := s.pool.QueryRow(ctx,
+		`WITH t AS (
+		   UPDATE email_verification_tokens SET used_at = NOW()
+		   WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		   RETURNING user_id)
+		 UPDATE users SET email_verified = TRUE, updated_at = NOW()
+		 FROM t WHERE users.id = t.user_id
+		 RETURNING users.id`, tokenHash,
+	).Scan(&userID)
+	return userID, err
+}
+
+// ResendEmailVerificationToken issues tokenHash at sentAt to the account
+// with email, voiding its earlier tokens, unless it's deleted, already
+// verified or had a token issued within cooldown of sentAt; then it's
+// pgx.ErrNoRows. The account is
+// locked first, so of two concurrent resends only one issues a token. The
+// same two statements run whatever the email, so an unknown one takes as
+// long as a real one.
+func (s *Store) ResendEmailVerificationToken(ctx context.Context, email, tokenHash string, sentAt, expiresAt time.Time, cooldown time.Duration) (*model.User, error) {
+	live := " AND deleted_at IS NULL"
+	if !s.Has(FeatureAccountDeletion) {
+		live = ""
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id *string
+	err = tx.QueryRow(ctx,
+		`SELECT (SELECT id::text FROM users WHERE email = $1 AND NOT email_verified`+live+` FOR UPDATE)`, email,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	// a statement of its own, so it sees a token a resend that held the
+	// lock before us committed
+	u := &model.User{}
+	err = tx.QueryRow(ctx,
+		`WITH ok AS (
+		   SELECT u.id, u.email, u.name FROM users u
+		   WHERE u.id::text = $1 AND NOT EXISTS (
+		     SELECT 1 FROM email_verification_tokens t WHERE t.user_id = u.id AND t.created_at > $4)),
+		 old AS (
+		   UPDATE email_verification_tokens SET used_at = NOW()
+		   WHERE user_id IN (SELECT id FROM ok) AND used_at IS NULL),
+		 ins AS (
+		   INSERT INTO email_verification_tokens (user_id, token_hash, expires_at, created_at)
+		   SELECT id, $2, $3, $5 FROM ok)
+		 SELECT id::text, email, name FROM ok`,
+		id, tokenHash, expiresAt, sentAt.Add(-cooldown), sentAt,
+	).Scan(&u.ID, &u.Email, &u.Name)
+	if err != nil {
+		return nil, err
+	}
+	return u, commit(ctx, tx)
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// AllAppointments pages through every appointment userID owns, whatever
+// its status or date, by (start_time, id) after the cursor afterStart,
+// afterID ("" for the first page). For a data export: nothing is left out
+// but rows already quarantined as invalid.
+func (s *Store) AllAppointments(ctx context.Context, userID string, afterStart time.Time, afterID string, limit int) ([]model.Appointment, error) {
+	q := `SELECT id, title, description, start_time, end_time,
+	        user_id, status, location, created_at, updated_at, ` + s.calendarCol("appointments") + `, ` + s.resourceCol("appointments") + `,
+	        ` + s.tagsCol("appointments") + `, ` + s.capacityCol("appointments") + `, ` + s.rescheduleCountCol("appointments") + `,
+	        ` + s.allDayCol("appointments") + `, ` + s.timeZoneCol("appointments") + `, ` + s.orgCol("appointments") + `
+	 FROM appointments
+	 WHERE user_id = $1 AND status <> 'invalid'`
+	args := []any{userID}
+	if afterID != "" {
+		args = append(args, afterStart, afterID)
+		q += ` AND (start_time, id) > ($2, $3)`
+	}
+	q += fmt.Sprintf(` ORDER BY start_time, id LIMIT %d`, limit)
+
+	var out []model.Appointment
+	err := s.read(ctx, "AllAppointments", func() error {
+		var err error
+		out, err = s.listAppointments(ctx, q, args)
+		return err
+	})
+	return out, err
+}
+
+// Attendance is an appointment of someone else's a user is invited to.
+type Attendance struct {
+	AppointmentID string
+	OwnerID       string
+	Status        string
+	StartTime     time.Time
+	EndTime       time.Time
+}
+
+// Attending lists the appointments userID is an attendee of, any status,
+// by start.
+func (s *Store) Attending(ctx context.Context, userID string) ([]Attendance, error) {
+	if !s.Has(FeatureAttendees) {
+		return nil, nil
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT a.id, a.user_id, a.status, a.start_time, a.end_time
+		 FROM appointment_attendees aa JOIN appointments a ON a.id = aa.appointment_id
+		 WHERE aa.user_id = $1 AND a.status <> 'invalid'
+		 ORDER BY a.start_time, a.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (Attendance, error) {
+		var at Attendance
+		err := r.Scan(&at.AppointmentID, &at.OwnerID, &at.Status, &at.StartTime, &at.EndTime)
+		return at, err
+	})
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+const freezeColumns = `id, starts_at, ends_at, scope, reason, created_by, created_at`
+
+func scanFreeze(row pgx.Row) (*model.FreezeWindow, error) {
+	w := &model.FreezeWindow{}
+	err := row.Scan(&w.ID, &w.Start, &w.End, &w.Scope, &w.Reason, &w.CreatedBy, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *Store) CreateFreezeWindow(ctx context.Context, w *model.FreezeWindow) error {
+	if !w.End.After(w.Start) {
+		return ErrEmptyRange
+	}
+	return s.pool.QueryRow(ctx,
+		`INSERT INTO freeze_windows (starts_at, ends_at, reason, created_by)
+		 VALUES ($1,$2,$3,$4) RETURNING id, scope, created_at`,
+		w.Start, w.End, w.Reason, w.CreatedBy,
+	).Scan(&w.ID, &w.Scope, &w.CreatedAt)
+}
+
+// FreezeWindows lists windows that haven't ended by since, ordered by start.
+func (s *Store) FreezeWindows(ctx context.Context, since time.Time) ([]model.FreezeWindow, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT `+freezeColumns+` FROM freeze_windows
+		 WHERE ends_at > $1 ORDER BY starts_at, id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.FreezeWindow
+	for rows.Next() {
+		w, err := scanFreeze(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *w)
+	}
+	return out, rows.Err()
+}
+
+// DeleteFreezeWindow returns pgx.ErrNoRows if there's no such window.
+func (s *Store) DeleteFreezeWindow(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM freeze_windows WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// FreezeOverlapping returns the earliest window overlapping [start, end), or
+// pgx.ErrNoRows if bookings there are open. Uses the gist index on the
+// same range expression, so it's cheap enough for every create.
+func (s *Store) FreezeOverlapping(ctx context.Context, start, end time.Time) (*model.FreezeWindow, error) {
+	return scanFreeze(s.pool.QueryRow(ctx,
+		`SELECT `+freezeColumns+` FROM freeze_windows
+		 WHERE tstzrange(starts_at, ends_at, '[)') && tstzrange($1, $2, '[)')
+		 ORDER BY starts_at LIMIT 1`, start, end))
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// IdempotencyKeyTTL is how long a CreateAppointment idempotency key keeps
+// returning the appointment it created. After that the key is free again.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// ErrKeyReused is returned for a live idempotency key that was first used
+// with a different request.
+var ErrKeyReused = errors.New("idempotency key was used with a different request")
+
+// IdempotentAppointment returns the appointment userID created with key,
+// pgx.ErrNoRows if the key is unknown or expired, or ErrKeyReused if it was
+// used with a request whose hash isn't hash.
+func (s *Store) IdempotentAppointment(ctx context.Context, userID, key, hash string) (*model.Appointment, error) {
+	var id string
+	var prev *string
+	err := s.pool.QueryRow(ctx,
+		`SELECT appointment_id, request_hash FROM idempotency_keys
+		 WHERE user_id = $1 AND key = $2 AND created_at >= $3`,
+		userID, key, time.Now().Add(-IdempotencyKeyTTL),
+	).Scan(&id, &prev)
+	if err != nil {
+		return nil, err
+	}
+	// keys from before request_hash match anything
+	if prev != nil && *prev != hash {
+		return nil, ErrKeyReused
+	}
+	return s.GetAppointment(ctx, id)
+}
+
+// CreateAppointmentWithKey inserts a unless key already belongs to one of
+// the user's appointments, in which case that one is returned instead and a
+// is not written, or ErrKeyReused if hash isn't the one the key was first
+// used with. The key row is claimed before the appointment, so of two
+// concurrent requests with the same key the second waits for the first to
+// commit and then gets its appointment; if the first rolls back, the second
+// books normally.
+func (s *Store) CreateAppointmentWithKey(ctx context.Context, a *model.Appointment, key, hash string) (*model.Appointment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// an expired key is taken over, a live one is left alone
+	var claimed string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO idempotency_keys (user_id, key, appointment_id, request_hash) VALUES ($1,$2,$3,$4)
+		 ON CONFLICT (user_id, key) DO UPDATE
+		   SET appointment_id = EXCLUDED.appointment_id, request_hash = EXCLUDED.request_hash, created_at = NOW()
+		   WHERE idempotency_keys.created_at < $5
+		 RETURNING appointment_id`,
+		a.UserID, key, a.ID, hash, time.Now().Add(-IdempotencyKeyTTL),
+	).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(ctx)
+		return s.IdempotentAppointment(ctx, a.UserID, key, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.insertAppointment(ctx, tx, a); err != nil {
+		return nil, err
+	}
+	if err := s.appendAudit(ctx, tx, a.UserID, "create", a.ID, nil, snapshot(a)); err != nil {
+		return nil, err
+	}
+	return a, commit(ctx, tx)
+}
+
+// PurgeIdempotencyKeys deletes keys past IdempotencyKeyTTL. Expired keys are
+// already ignored, this only reclaims the space.
+func (s *Store) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at < $1`,
+		time.Now().Add(-IdempotencyKeyTTL))
+	return tag.RowsAffected(), err
+}
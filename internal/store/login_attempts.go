@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginLockedUntil is when email's lockout ends, zero if it isn't locked.
+func (s *Store) LoginLockedUntil(ctx context.Context, email string) (time.Time, error) {
+	var until *time.Time
+	err := s.pool.QueryRow(ctx,
+		`SELECT locked_until FROM login_attempts WHERE email = $1 AND locked_until > NOW()`,
+		loginKey(email),
+	).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) || until == nil {
+		return time.Time{}, nil
+	}
+	return *until, err
+}
+
+// RecordLoginFailure counts a failed login for email. Failures older than
+// window don't count; the max-th within it locks the email for window and
+// starts the count over. Returns the lockout end when this one triggered it.
+func (s *Store) RecordLoginFailure(ctx context.Context, email string, max int, window time.Duration) (time.Time, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var n int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO login_attempts AS a (email, failures, first_failed_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (email) DO UPDATE SET
+			failures = CASE WHEN a.first_failed_at > NOW() - make_interval(secs => $2)
+			                THEN a.failures + 1 ELSE 1 END,
+			first_failed_at = CASE WHEN a.first_failed_at > NOW() - make_interval(secs => $2)
+			                       THEN a.first_failed_at ELSE NOW() END
+		RETURNING failures`,
+		loginKey(email), window.Seconds(),
+	).Scan(&n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var until time.Time
+	if n >= max {
+		err = tx.QueryRow(ctx, `
+			UPDATE login_attempts SET
+				failures = 0, first_failed_at = NOW(), locked_until = NOW() + make_interval(secs => $2)
+			WHERE email = $1
+			RETURNING locked_until`,
+			loginKey(email), window.Seconds(),
+		).Scan(&until)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return until, tx.Commit(ctx)
+}
+
+// ResetLoginFailures forgets email's failures after a successful login.
+func (s *Store) ResetLoginFailures(ctx context.Context, email string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM login_attempts WHERE email = $1`, loginKey(email))
+	return err
+}
+
+// PurgeLoginAttempts deletes rows that no longer count: not locked, and
+// failures older than window. Returns how many went.
+func (s *Store) PurgeLoginAttempts(ctx context.Context, window time.Duration) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE (locked_until IS NULL OR locked_until <= NOW())
+		  AND first_failed_at <= NOW() - make_interval(secs => $1)`,
+		window.Seconds())
+	return tag.RowsAffected(), err
+}
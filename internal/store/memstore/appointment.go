@@ -0,0 +1,494 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+)
+
+func (s *Store) CreateAppointment(ctx context.Context, a *model.Appointment) error {
+	return s.CreateAppointments(ctx, []*model.Appointment{a})
+}
+
+// CreateAppointments writes all of apts or none: ErrConflict if any of them
+// overlaps a confirmed appointment of its owner, an earlier one in the
+// batch included, ErrBuffer if it's only within its Buffer of one.
+func (s *Store) CreateAppointments(ctx context.Context, apts []*model.Appointment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(apts)
+}
+
+func (s *Store) insert(apts []*model.Appointment) error {
+	for i, a := range apts {
+		if err := s.checkAttendees(a.AttendeeIDs); err != nil {
+			return err
+		}
+		if s.overlaps(a.UserID, a.StartTime, a.EndTime, a.AllDay, "") {
+			return store.ErrConflict
+		}
+		for _, b := range apts[:i] {
+			if b.UserID == a.UserID && s.conflict(a, b) {
+				return store.ErrConflict
+			}
+		}
+		if s.tooClose(a.UserID, a.StartTime, a.EndTime, a.AllDay, "", a.Buffer) {
+			return store.ErrBuffer
+		}
+		for _, b := range apts[:i] {
+			if b.UserID == a.UserID && !a.AllDay && !b.AllDay && overlap(b.StartTime, b.EndTime, a.StartTime.Add(-a.Buffer), a.EndTime.Add(a.Buffer)) {
+				return store.ErrBuffer
+			}
+		}
+	}
+	now := time.Now()
+	for _, a := range apts {
+		a.CreatedAt, a.UpdatedAt = now, now
+		if m := s.members[a.UserID]; m != nil {
+			a.OrgID = m.OrgID
+		}
+		s.appointments[a.ID] = clone(a)
+	}
+	return nil
+}
+
+// CreateAppointmentWithKey returns the appointment a live key already
+// made instead of writing a.
+func (s *Store) CreateAppointmentWithKey(ctx context.Context, a *model.Appointment, key, hash string) (*model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, err := s.keyed(a.UserID, key, hash); err != nil || prev != nil {
+		return prev, err
+	}
+	if err := s.insert([]*model.Appointment{a}); err != nil {
+		return nil, err
+	}
+	s.keys[idemKey{a.UserID, key}] = idemEntry{appointmentID: a.ID, requestHash: hash, createdAt: time.Now()}
+	return a, nil
+}
+
+func (s *Store) IdempotentAppointment(ctx context.Context, userID, key, hash string) (*model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, err := s.keyed(userID, key, hash)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, pgx.ErrNoRows
+	}
+	return a, nil
+}
+
+// keyed is a copy of the appointment a live key made, nil without one.
+func (s *Store) keyed(userID, key, hash string) (*model.Appointment, error) {
+	e, ok := s.keys[idemKey{userID, key}]
+	if !ok || e.createdAt.Before(time.Now().Add(-store.IdempotencyKeyTTL)) {
+		return nil, nil
+	}
+	if e.requestHash != hash {
+		return nil, store.ErrKeyReused
+	}
+	return clone(s.appointments[e.appointmentID]), nil
+}
+
+func (s *Store) GetAppointment(ctx context.Context, id string) (*model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil {
+		return nil, pgx.ErrNoRows
+	}
+	return clone(a), nil
+}
+
+func (s *Store) ListAppointments(ctx context.Context, userID string, p store.ListParams) ([]model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Appointment
+	for _, a := range s.appointments {
+		if listed(a, userID, p) && (p.AfterID == "" || byStart(a, p.AfterStart, p.AfterID) > 0) {
+			out = append(out, *clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	if p.Limit > 0 && len(out) > p.Limit {
+		out = out[:p.Limit]
+	}
+	return out, nil
+}
+
+func (s *Store) UpcomingAppointments(ctx context.Context, userID string, now time.Time, limit int) ([]model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Appointment
+	for _, a := range s.appointments {
+		if a.UserID == userID && a.Status == "confirmed" && a.EndTime.After(now) {
+			out = append(out, *clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// CountAppointments ignores the cursor and Limit.
+func (s *Store) CountAppointments(ctx context.Context, userID string, p store.ListParams) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, a := range s.appointments {
+		if listed(a, userID, p) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// listed reports whether a passes p's filters, the cursor aside.
+func listed(a *model.Appointment, userID string, p store.ListParams) bool {
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{"confirmed"}
+	}
+	now := p.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	completed := slices.Contains(statuses, "completed") && a.Status == "confirmed" && !a.EndTime.After(now)
+	return a.UserID == userID &&
+		overlap(a.StartTime, a.EndTime, p.From, p.To) &&
+		(slices.Contains(statuses, a.Status) || completed) &&
+		(len(p.Tags) == 0 || slices.ContainsFunc(a.Tags, func(t string) bool { return slices.Contains(p.Tags, t) }))
+}
+
+// AllAppointments pages through every appointment of userID, any status
+// but invalid.
+func (s *Store) AllAppointments(ctx context.Context, userID string, afterStart time.Time, afterID string, limit int) ([]model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Appointment
+	for _, a := range s.appointments {
+		if a.UserID == userID && a.Status != "invalid" && (afterID == "" || byStart(a, afterStart, afterID) > 0) {
+			out = append(out, *clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Store) Attending(ctx context.Context, userID string) ([]store.Attendance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var apts []model.Appointment
+	for _, a := range s.appointments {
+		if slices.Contains(a.AttendeeIDs, userID) && a.Status != "invalid" {
+			apts = append(apts, *a)
+		}
+	}
+	slices.SortFunc(apts, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	out := make([]store.Attendance, len(apts))
+	for i, a := range apts {
+		out[i] = store.Attendance{AppointmentID: a.ID, OwnerID: a.UserID, Status: a.Status, StartTime: a.StartTime, EndTime: a.EndTime}
+	}
+	return out, nil
+}
+
+// byStart orders a against (start, id), the way lists are ordered.
+func byStart(a *model.Appointment, start time.Time, id string) int {
+	return cmp.Or(a.StartTime.Compare(start), strings.Compare(a.ID, id))
+}
+
+// UpdateAppointment follows store.Store's: fields names what to write (nil
+// is everything), the rest of a is filled in from what's stored, and an
+// update that changes nothing leaves UpdatedAt alone.
+func (s *Store) UpdateAppointment(ctx context.Context, a *model.Appointment, fields []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.appointments[a.ID]
+	if old == nil || old.UserID != a.UserID {
+		return pgx.ErrNoRows
+	}
+	has := func(f string) bool { return fields == nil || slices.Contains(fields, f) }
+	if !has("title") {
+		a.Title = old.Title
+	}
+	if !has("description") {
+		a.Description = old.Description
+	}
+	if !has("start_time") {
+		a.StartTime = old.StartTime
+	}
+	if !has("end_time") {
+		a.EndTime = old.EndTime
+	}
+	if !has("location") {
+		a.Location = old.Location
+	}
+	if !has("attendee_ids") {
+		a.AttendeeIDs = slices.Clone(old.AttendeeIDs)
+	}
+	if !has("tags") {
+		a.Tags = slices.Clone(old.Tags)
+	}
+	if (fields == nil && a.Capacity == 0) || !has("capacity") {
+		a.Capacity = old.Capacity
+	}
+	if !has("all_day") {
+		a.AllDay = old.AllDay
+	}
+	if !has("time_zone") {
+		a.TimeZone = old.TimeZone
+	}
+	a.ResourceID, a.CalendarID, a.OrgID = old.ResourceID, old.CalendarID, old.OrgID
+	if !a.EndTime.After(a.StartTime) {
+		return store.ErrEmptyRange
+	}
+	a.Status, a.CreatedAt, a.UpdatedAt = old.Status, old.CreatedAt, old.UpdatedAt
+	a.RescheduleCount = old.RescheduleCount
+	if a.Capacity > 0 && len(a.AttendeeIDs) > a.Capacity {
+		return store.ErrFull
+	}
+	if same(old, a) {
+		return nil
+	}
+	if err := s.checkAttendees(a.AttendeeIDs); err != nil {
+		return err
+	}
+	if a.Status == "confirmed" && s.overlaps(a.UserID, a.StartTime, a.EndTime, a.AllDay, a.ID) {
+		return store.ErrConflict
+	}
+	moved := !a.StartTime.Equal(old.StartTime) || !a.EndTime.Equal(old.EndTime) || a.AllDay != old.AllDay
+	if a.Status == "confirmed" && moved && s.tooClose(a.UserID, a.StartTime, a.EndTime, a.AllDay, a.ID, a.Buffer) {
+		return store.ErrBuffer
+	}
+	a.UpdatedAt = time.Now()
+	s.appointments[a.ID] = clone(a)
+	return nil
+}
+
+// DeleteAppointment cancels; an appointment that isn't the user's is no
+// error, like store.Store's.
+func (s *Store) DeleteAppointment(ctx context.Context, id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.appointments[id]; a != nil && a.UserID == userID && a.Status != "cancelled" {
+		a.Status, a.UpdatedAt = "cancelled", time.Now()
+	}
+	return nil
+}
+
+// ActivateAppointment confirms a cancelled appointment again if its slot
+// is still free.
+func (s *Store) ActivateAppointment(ctx context.Context, id, userID string) (*model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil || a.UserID != userID {
+		return nil, pgx.ErrNoRows
+	}
+	if a.Status != "confirmed" {
+		if s.overlaps(a.UserID, a.StartTime, a.EndTime, a.AllDay, a.ID) {
+			return nil, store.ErrConflict
+		}
+		a.Status, a.UpdatedAt = "confirmed", time.Now()
+	}
+	return clone(a), nil
+}
+
+// RescheduleAppointment follows store.Store's: ErrCancelled for a
+// cancelled appointment, and a conflict leaves no history entry.
+func (s *Store) RescheduleAppointment(ctx context.Context, id, ownerID, actorID string, start, end time.Time, buf time.Duration, reason string) (*model.Appointment, error) {
+	if !end.After(start) {
+		return nil, store.ErrEmptyRange
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil || a.UserID != ownerID {
+		return nil, pgx.ErrNoRows
+	}
+	if a.Status == "cancelled" {
+		return nil, store.ErrCancelled
+	}
+	if a.StartTime.Equal(start) && a.EndTime.Equal(end) {
+		return clone(a), nil
+	}
+	if s.overlaps(ownerID, start, end, a.AllDay, id) {
+		return nil, store.ErrConflict
+	}
+	if s.tooClose(ownerID, start, end, a.AllDay, id, buf) {
+		return nil, store.ErrBuffer
+	}
+	now := time.Now()
+	s.reschedules[id] = append(s.reschedules[id], model.Reschedule{
+		AppointmentID: id,
+		OldStart:      a.StartTime,
+		OldEnd:        a.EndTime,
+		NewStart:      start,
+		NewEnd:        end,
+		RescheduledBy: actorID,
+		Reason:        reason,
+		RescheduledAt: now,
+	})
+	a.StartTime, a.EndTime, a.UpdatedAt = start, end, now
+	a.RescheduleCount++
+	return clone(a), nil
+}
+
+func (s *Store) RescheduleHistory(ctx context.Context, appointmentID string) ([]model.Reschedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.reschedules[appointmentID]), nil
+}
+
+// JoinAppointment follows store.Store's: ErrFull once capacity is reached,
+// pgx.ErrNoRows unless id is someone else's confirmed group appointment.
+func (s *Store) JoinAppointment(ctx context.Context, id, userID string) (*model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil || a.UserID == userID || a.Capacity == 0 || a.Status != "confirmed" {
+		return nil, pgx.ErrNoRows
+	}
+	if slices.Contains(a.AttendeeIDs, userID) {
+		return clone(a), nil
+	}
+	if len(a.AttendeeIDs) >= a.Capacity {
+		return nil, store.ErrFull
+	}
+	a.AttendeeIDs = append(a.AttendeeIDs, userID)
+	return clone(a), nil
+}
+
+func (s *Store) LeaveAppointment(ctx context.Context, id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil || !slices.Contains(a.AttendeeIDs, userID) {
+		return pgx.ErrNoRows
+	}
+	a.AttendeeIDs = slices.DeleteFunc(a.AttendeeIDs, func(u string) bool { return u == userID })
+	return nil
+}
+
+func (s *Store) HasOverlap(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string) (bool, error) {
+	if !end.After(start) {
+		return false, store.ErrEmptyRange
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overlaps(userID, start, end, allDay, excludeID), nil
+}
+
+func (s *Store) FindOverlaps(ctx context.Context, userID string, start, end time.Time, allDay bool, excludeID string, limit int) ([]model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if allDay && !s.allDayConflicts {
+		return nil, nil
+	}
+	out := s.busy(userID, start, end, allDay, excludeID)
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Store) BusyIntervals(ctx context.Context, userID string, w slots.Interval, excludeID string) ([]slots.Interval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []slots.Interval
+	for _, a := range s.busy(userID, w.Start, w.End, false, excludeID) {
+		out = append(out, slots.Interval{Start: a.StartTime, End: a.EndTime})
+	}
+	return out, nil
+}
+
+// busy is userID's confirmed appointments overlapping [start, end), other
+// than excludeID, by start: the all-day ones or the timed ones.
+func (s *Store) busy(userID string, start, end time.Time, allDay bool, excludeID string) []model.Appointment {
+	var out []model.Appointment
+	for _, a := range s.appointments {
+		if a.UserID == userID && a.Status == "confirmed" && a.ID != excludeID && a.AllDay == allDay && overlap(a.StartTime, a.EndTime, start, end) {
+			out = append(out, *clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	return out
+}
+
+// overlaps compares like with like, as store.Store's hasOverlap does.
+func (s *Store) overlaps(userID string, start, end time.Time, allDay bool, excludeID string) bool {
+	if allDay && !s.allDayConflicts {
+		return false
+	}
+	for _, a := range s.appointments {
+		if a.UserID == userID && a.Status == "confirmed" && a.ID != excludeID && a.AllDay == allDay && overlap(a.StartTime, a.EndTime, start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooClose is store.Store's buffer check: whether a timed [start, end)
+// comes within buf of another of userID's confirmed timed appointments.
+func (s *Store) tooClose(userID string, start, end time.Time, allDay bool, excludeID string, buf time.Duration) bool {
+	return buf > 0 && !allDay && s.overlaps(userID, start.Add(-buf), end.Add(buf), false, excludeID)
+}
+
+// conflict reports whether a and b can't both be held.
+func (s *Store) conflict(a, b *model.Appointment) bool {
+	if a.AllDay != b.AllDay || (a.AllDay && !s.allDayConflicts) {
+		return false
+	}
+	return overlap(a.StartTime, a.EndTime, b.StartTime, b.EndTime)
+}
+
+// checkAttendees stands in for the foreign key on appointment_attendees.
+func (s *Store) checkAttendees(ids []string) error {
+	for _, id := range ids {
+		if s.users[id] == nil {
+			return fmt.Errorf("memstore: no user %s", id)
+		}
+	}
+	return nil
+}
+
+// overlap is for half-open ranges, [start, end): back to back is fine.
+func overlap(aStart, aEnd, bStart, bEnd time.Time) bool {
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+func same(a, b *model.Appointment) bool {
+	return a.Title == b.Title && a.Description == b.Description && a.Location == b.Location &&
+		a.StartTime.Equal(b.StartTime) && a.EndTime.Equal(b.EndTime) &&
+		slices.Equal(sorted(a.AttendeeIDs), sorted(b.AttendeeIDs)) && slices.Equal(a.Tags, b.Tags) &&
+		a.Capacity == b.Capacity && a.AllDay == b.AllDay && a.TimeZone == b.TimeZone
+}
+
+func sorted(ids []string) []string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return ids
+}
+
+func clone(a *model.Appointment) *model.Appointment {
+	c := *a
+	c.AttendeeIDs = slices.Clone(a.AttendeeIDs)
+	c.Tags = slices.Clone(a.Tags)
+	return &c
+}
@@ -0,0 +1,567 @@
+// Package memstore keeps what the handler stores in memory, so handler
+// tests can run without Postgres. One mutex guards everything, which also
+// makes every method atomic the way the Postgres store's transactions are.
+//
+// It covers users, sessions, login lockout, password resets, email
+// verification, appointments (with attendees, tags and idempotency keys)
+// availability, preferences and organizations. Has
+// reports the other optional features missing, so the handler answers
+// Unavailable for calendars, resources, freeze windows, reminders, share
+// links, webhooks and audit history without calling in here.
+// ScheduleSummary isn't behind a feature and fails with ErrUnsupported.
+package memstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"schedule-management-api/internal/auth"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+)
+
+// ErrUnsupported is returned by the methods of features memstore doesn't
+// have.
+var ErrUnsupported = errors.New("memstore: not supported")
+
+var features = map[string]bool{
+	store.FeatureAttendees:       true,
+	store.FeaturePasswordReset:   true,
+	store.FeatureAccountDeletion: true,
+	store.FeatureRoles:           true,
+	store.FeatureLoginLockout:    true,
+	store.FeatureIdempotencyKeys: true,
+	store.FeatureTags:            true,
+	store.FeatureAvailability:    true,
+	store.FeatureEmailVerify:     true,
+	store.FeaturePreferences:     true,
+	store.FeatureSessions:        true,
+	store.FeatureCapacity:        true,
+	store.FeatureReschedules:     true,
+	store.FeatureAllDay:          true,
+	store.FeatureOrganizations:   true,
+	store.FeatureScheduleVersion: true,
+}
+
+type Store struct {
+	mu           sync.Mutex
+	users        map[string]*model.User // by ID
+	appointments map[string]*model.Appointment
+	keys         map[idemKey]idemEntry
+	tokens       map[string]*store.RefreshToken // by ID
+	resets       map[string]*resetToken         // by hash
+	verifies     map[string]*resetToken         // by hash
+	logins       map[string]*loginAttempts      // by lower-case email
+	availability map[string]model.Availability  // by user ID
+	preferences  map[string]model.Preferences   // by user ID
+	reschedules  map[string][]model.Reschedule  // by appointment ID
+	orgs         map[string]*model.Organization
+	members      map[string]*model.OrgMember // by user ID
+	invites      map[string]*orgInvite       // by hash
+	versions     map[string]int64            // schedule version by user ID
+
+	allDayConflicts bool
+}
+
+type idemKey struct{ userID, key string }
+
+type idemEntry struct {
+	appointmentID string
+	requestHash   string
+	createdAt     time.Time
+}
+
+type resetToken struct {
+	userID    string
+	createdAt time.Time
+	expiresAt time.Time
+	used      bool
+}
+
+type loginAttempts struct {
+	failures    int
+	firstFailed time.Time
+	lockedUntil time.Time
+}
+
+func New() *Store {
+	return &Store{
+		users:        map[string]*model.User{},
+		appointments: map[string]*model.Appointment{},
+		keys:         map[idemKey]idemEntry{},
+		tokens:       map[string]*store.RefreshToken{},
+		resets:       map[string]*resetToken{},
+		verifies:     map[string]*resetToken{},
+		logins:       map[string]*loginAttempts{},
+		availability: map[string]model.Availability{},
+		preferences:  map[string]model.Preferences{},
+		reschedules:  map[string][]model.Reschedule{},
+		orgs:         map[string]*model.Organization{},
+		members:      map[string]*model.OrgMember{},
+		invites:      map[string]*orgInvite{},
+		versions:     map[string]int64{},
+	}
+}
+
+func (s *Store) Has(feature string) bool { return features[feature] }
+
+// SetAllDayConflicts is store.Store's. Call it before serving.
+func (s *Store) SetAllDayConflicts(on bool) { s.allDayConflicts = on }
+
+func (s *Store) AllDayConflicts() bool { return s.allDayConflicts }
+
+// Stat is nil: there's no pool.
+func (s *Store) Stat() *pgxpool.Stat { return nil }
+
+func (s *Store) Stats(ctx context.Context) (*store.Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &store.Stats{}
+	for _, u := range s.users {
+		if u.DeletedAt == nil {
+			st.Users++
+		} else {
+			st.DeletedUsers++
+		}
+	}
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	for _, a := range s.appointments {
+		switch a.Status {
+		case "confirmed":
+			st.Confirmed++
+		case "cancelled":
+			st.Cancelled++
+		}
+		if a.CreatedAt.After(dayAgo) {
+			st.CreatedLastDay++
+		}
+	}
+	for _, t := range s.tokens {
+		if !t.Revoked && t.ExpiresAt.After(time.Now()) {
+			st.RefreshTokens++
+		}
+	}
+	return st, nil
+}
+
+// ----- users -----
+
+// CreateUser fails if the email is taken, by a deleted user too.
+func (s *Store) CreateUser(ctx context.Context, u *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.users {
+		if o.Email == u.Email {
+			return errors.New("memstore: email taken")
+		}
+	}
+	now := time.Now()
+	c := *u
+	c.Role, c.Verified, c.CreatedAt, c.UpdatedAt = auth.RoleUser, false, now, now
+	s.users[c.ID] = &c
+	return nil
+}
+
+// UserByEmail also returns soft-deleted users, like store.Store's.
+func (s *Store) UserByEmail(ctx context.Context, email string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (s *Store) UserByID(ctx context.Context, id string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.liveUser(id)
+	if u == nil {
+		return nil, pgx.ErrNoRows
+	}
+	c := *u
+	return &c, nil
+}
+
+func (s *Store) UsersByIDs(ctx context.Context, ids []string) (map[string]model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string]model.User{}
+	for _, id := range ids {
+		if u := s.liveUser(id); u != nil {
+			c := *u
+			c.PasswordHash = ""
+			out[id] = c
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context, afterEmail string, limit int) ([]model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.User
+	for _, u := range s.users {
+		if u.DeletedAt == nil && u.Email > afterEmail {
+			c := *u
+			c.PasswordHash = ""
+			out = append(out, c)
+		}
+	}
+	slices.SortFunc(out, func(a, b model.User) int { return strings.Compare(a.Email, b.Email) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, u *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.users[u.ID]
+	if cur == nil {
+		return pgx.ErrNoRows
+	}
+	cur.Name, cur.UpdatedAt = u.Name, time.Now()
+	u.UpdatedAt = cur.UpdatedAt
+	return nil
+}
+
+func (s *Store) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u := s.users[userID]; u != nil {
+		u.PasswordHash, u.UpdatedAt = passwordHash, time.Now()
+	}
+	return nil
+}
+
+// SoftDeleteUser does what store.Store's does: takes the user out of their
+// organization, cancels their future appointments, drops them as an
+// attendee and revokes their tokens.
+func (s *Store) SoftDeleteUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.liveUser(userID)
+	if u == nil {
+		return pgx.ErrNoRows
+	}
+	if m := s.members[userID]; m != nil {
+		s.leave(m.OrgID, userID)
+	}
+	now := time.Now()
+	u.DeletedAt, u.UpdatedAt = &now, now
+	for _, a := range s.appointments {
+		if a.UserID == userID && a.Status == "confirmed" && a.StartTime.After(now) {
+			a.Status, a.UpdatedAt = "cancelled", now
+		}
+		a.AttendeeIDs = slices.DeleteFunc(a.AttendeeIDs, func(id string) bool { return id == userID })
+	}
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			t.Revoked = true
+		}
+	}
+	for _, r := range s.resets {
+		if r.userID == userID {
+			r.used = true
+		}
+	}
+	for _, r := range s.verifies {
+		if r.userID == userID {
+			r.used = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) liveUser(id string) *model.User {
+	if u := s.users[id]; u != nil && u.DeletedAt == nil {
+		return u
+	}
+	return nil
+}
+
+// ----- sessions and login -----
+
+func (s *Store) CreateRefreshToken(ctx context.Context, userID string, hash auth.VersionedHash, expiresAt time.Time, client store.SessionInfo) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.NewString()
+	s.addToken(id, userID, hash, expiresAt, client)
+	return id, nil
+}
+
+// ListRefreshTokensByUser leaves TokenHash empty, like store.Store's.
+func (s *Store) ListRefreshTokensByUser(ctx context.Context, userID string) ([]store.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []store.RefreshToken
+	for _, t := range s.tokens {
+		if t.UserID == userID && !t.Revoked && t.ExpiresAt.After(time.Now()) {
+			c := *t
+			c.TokenHash = ""
+			out = append(out, c)
+		}
+	}
+	slices.SortFunc(out, func(a, b store.RefreshToken) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return out, nil
+}
+
+// RevokeRefreshToken is pgx.ErrNoRows unless id is a live token of userID's.
+func (s *Store) RevokeRefreshToken(ctx context.Context, id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tokens[id]
+	if t == nil || t.UserID != userID || t.Revoked || !t.ExpiresAt.After(time.Now()) {
+		return pgx.ErrNoRows
+	}
+	t.Revoked = true
+	return nil
+}
+
+func (s *Store) addToken(id, userID string, hash auth.VersionedHash, expiresAt time.Time, client store.SessionInfo) {
+	s.tokens[id] = &store.RefreshToken{
+		ID: id, UserID: userID, TokenHash: hash.Hash, HashVersion: hash.Version,
+		ExpiresAt: expiresAt, CreatedAt: time.Now(), SessionInfo: client,
+	}
+}
+
+// FindRefreshToken tries every accepted hash scheme and rehashes a hit on
+// an old one, like store.Store's.
+func (s *Store) FindRefreshToken(ctx context.Context, cands []auth.VersionedHash) (*store.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range cands {
+		for _, t := range s.tokens {
+			if t.TokenHash != c.Hash || t.HashVersion != c.Version {
+				continue
+			}
+			if i > 0 {
+				t.TokenHash, t.HashVersion = cands[0].Hash, cands[0].Version
+			}
+			cp := *t
+			return &cp, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// RotateRefreshToken is pgx.ErrNoRows if oldID was already revoked.
+func (s *Store) RotateRefreshToken(ctx context.Context, oldID, newID, userID string, newHash auth.VersionedHash, newExpiry time.Time, client store.SessionInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.tokens[oldID]
+	if old == nil || old.Revoked {
+		return pgx.ErrNoRows
+	}
+	old.Revoked, old.ReplacedBy = true, &newID
+	s.addToken(newID, userID, newHash, newExpiry, client)
+	return nil
+}
+
+func (s *Store) RevokeAllRefreshTokens(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			t.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) LoginLockedUntil(ctx context.Context, email string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.logins[loginKey(email)]; l != nil && l.lockedUntil.After(time.Now()) {
+		return l.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// RecordLoginFailure counts failures within window; the max-th locks the
+// email for window and starts over.
+func (s *Store) RecordLoginFailure(ctx context.Context, email string, max int, window time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	l := s.logins[loginKey(email)]
+	if l == nil {
+		l = &loginAttempts{}
+		s.logins[loginKey(email)] = l
+	}
+	if l.firstFailed.After(now.Add(-window)) {
+		l.failures++
+	} else {
+		l.failures, l.firstFailed = 1, now
+	}
+	if l.failures < max {
+		return time.Time{}, nil
+	}
+	l.failures, l.firstFailed, l.lockedUntil = 0, now, now.Add(window)
+	return l.lockedUntil, nil
+}
+
+func (s *Store) ResetLoginFailures(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logins, loginKey(email))
+	return nil
+}
+
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CreatePasswordResetToken voids the user's earlier unused tokens.
+func (s *Store) CreatePasswordResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.resets {
+		if r.userID == userID {
+			r.used = true
+		}
+	}
+	s.resets[tokenHash] = &resetToken{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.resets[tokenHash]
+	if r == nil || r.used || !r.expiresAt.After(time.Now()) {
+		return "", pgx.ErrNoRows
+	}
+	r.used = true
+	return r.userID, nil
+}
+
+// CreateEmailVerificationToken voids the user's earlier unused tokens.
+func (s *Store) CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.verifies {
+		if r.userID == userID {
+			r.used = true
+		}
+	}
+	s.verifies[tokenHash] = &resetToken{userID: userID, createdAt: time.Now(), expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.verifies[tokenHash]
+	if r == nil || r.used || !r.expiresAt.After(time.Now()) || s.users[r.userID] == nil {
+		return "", pgx.ErrNoRows
+	}
+	r.used = true
+	u := s.users[r.userID]
+	u.Verified, u.UpdatedAt = true, time.Now()
+	return r.userID, nil
+}
+
+func (s *Store) ResendEmailVerificationToken(ctx context.Context, email, tokenHash string, sentAt, expiresAt time.Time, cooldown time.Duration) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var u *model.User
+	for _, x := range s.users {
+		if x.Email == email && x.DeletedAt == nil && !x.Verified {
+			u = x
+		}
+	}
+	if u == nil {
+		return nil, pgx.ErrNoRows
+	}
+	for _, r := range s.verifies {
+		if r.userID == u.ID && r.createdAt.After(sentAt.Add(-cooldown)) {
+			return nil, pgx.ErrNoRows
+		}
+	}
+	for _, r := range s.verifies {
+		if r.userID == u.ID {
+			r.used = true
+		}
+	}
+	s.verifies[tokenHash] = &resetToken{userID: u.ID, createdAt: sentAt, expiresAt: expiresAt}
+	c := *u
+	return &c, nil
+}
+
+// ----- availability -----
+
+func (s *Store) Availability(ctx context.Context, userID string) (*model.Availability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.availability[userID]
+	if !ok {
+		return &model.Availability{UserID: userID, TimeZone: "UTC"}, nil
+	}
+	a.Windows = slices.Clone(a.Windows)
+	return &a, nil
+}
+
+func (s *Store) SetAvailability(ctx context.Context, a *model.Availability) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.UpdatedAt = time.Now()
+	c := *a
+	c.Windows = slices.Clone(a.Windows)
+	s.availability[a.UserID] = c
+	return nil
+}
+
+// ----- preferences -----
+
+func (s *Store) Preferences(ctx context.Context, userID string) (*model.Preferences, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.preferences[userID]
+	if !ok {
+		return &model.Preferences{UserID: userID}, nil
+	}
+	return &p, nil
+}
+
+func (s *Store) SetPreferences(ctx context.Context, p *model.Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.UpdatedAt = time.Now()
+	s.preferences[p.UserID] = *p
+	return nil
+}
+
+// ----- schedule version -----
+
+func (s *Store) BumpScheduleVersion(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return 0, pgx.ErrNoRows
+	}
+	s.versions[userID]++
+	return s.versions[userID], nil
+}
+
+func (s *Store) ScheduleVersion(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return 0, pgx.ErrNoRows
+	}
+	return s.versions[userID], nil
+}
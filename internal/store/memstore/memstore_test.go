@@ -0,0 +1,109 @@
+package memstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/handler"
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+	"schedule-management-api/internal/store/memstore"
+)
+
+var _ handler.Store = (*memstore.Store)(nil)
+
+func TestOverlap(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New()
+	st.CreateUser(ctx, &model.User{ID: "u", Email: "u@test.com"})
+	at := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	apt := func(id string, from, to int) *model.Appointment {
+		return &model.Appointment{
+			ID: id, UserID: "u", Status: "confirmed", Title: id,
+			StartTime: at.Add(time.Duration(from) * time.Minute), EndTime: at.Add(time.Duration(to) * time.Minute),
+		}
+	}
+
+	if err := st.CreateAppointment(ctx, apt("a", 0, 60)); err != nil {
+		t.Fatal(err)
+	}
+	// back to back is fine, [start, end)
+	if err := st.CreateAppointment(ctx, apt("b", 60, 90)); err != nil {
+		t.Errorf("adjacent: %v", err)
+	}
+	if err := st.CreateAppointment(ctx, apt("c", 30, 45)); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("inside: %v", err)
+	}
+	// a batch is all or nothing
+	err := st.CreateAppointments(ctx, []*model.Appointment{apt("d", 120, 150), apt("e", 140, 160)})
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("batch: %v", err)
+	}
+	if _, err := st.GetAppointment(ctx, "d"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("half a batch written: %v", err)
+	}
+
+	// a cancelled appointment doesn't hold its slot, and can't come back
+	// once the slot is taken
+	st.DeleteAppointment(ctx, "a", "u")
+	if err := st.CreateAppointment(ctx, apt("f", 0, 30)); err != nil {
+		t.Errorf("after cancel: %v", err)
+	}
+	if _, err := st.ActivateAppointment(ctx, "a", "u"); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("restore onto a taken slot: %v", err)
+	}
+
+	// moving over itself isn't a conflict
+	b := apt("b", 70, 100)
+	if err := st.UpdateAppointment(ctx, b, []string{"start_time", "end_time"}); err != nil {
+		t.Errorf("move: %v", err)
+	}
+	if _, err := st.HasOverlap(ctx, "u", at, at, false, ""); !errors.Is(err, store.ErrEmptyRange) {
+		t.Errorf("empty range: %v", err)
+	}
+}
+
+func TestReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New()
+	st.CreateUser(ctx, &model.User{ID: "u", Email: "u@test.com"})
+	at := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	a := &model.Appointment{ID: "a", UserID: "u", Status: "confirmed", StartTime: at, EndTime: at.Add(time.Hour), Tags: []string{"x"}}
+	st.CreateAppointment(ctx, a)
+
+	a.Tags[0] = "changed"
+	got, _ := st.GetAppointment(ctx, "a")
+	got.Title = "changed"
+	again, _ := st.GetAppointment(ctx, "a")
+	if again.Tags[0] != "x" || again.Title != "" {
+		t.Errorf("stored appointment changed through a pointer: %+v", again)
+	}
+}
+
+// quarantined rows stay out of an export, as they do in Postgres
+func TestExportSkipsInvalid(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New()
+	st.CreateUser(ctx, &model.User{ID: "u", Email: "u@test.com"})
+	st.CreateUser(ctx, &model.User{ID: "v", Email: "v@test.com"})
+	at := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, status := range []string{"confirmed", "invalid"} {
+		start := at.Add(time.Duration(i) * time.Hour)
+		st.CreateAppointment(ctx, &model.Appointment{
+			ID: status, UserID: "u", Status: status, StartTime: start, EndTime: start.Add(time.Hour), AttendeeIDs: []string{"v"},
+		})
+	}
+
+	apts, err := st.AllAppointments(ctx, "u", time.Time{}, "", 10)
+	if err != nil || len(apts) != 1 || apts[0].ID != "confirmed" {
+		t.Errorf("all appointments: %v %v", apts, err)
+	}
+	att, err := st.Attending(ctx, "v")
+	if err != nil || len(att) != 1 || att[0].AppointmentID != "confirmed" {
+		t.Errorf("attending: %v %v", att, err)
+	}
+}
@@ -0,0 +1,192 @@
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/store"
+)
+
+type orgInvite struct {
+	model.OrgInvite
+	accepted bool
+}
+
+func (s *Store) CreateOrganization(ctx context.Context, o *model.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.members[o.CreatedBy] != nil {
+		return store.ErrInOrg
+	}
+	o.CreatedAt = time.Now()
+	c := *o
+	s.orgs[o.ID] = &c
+	s.join(o.ID, o.CreatedBy, store.OrgOwner)
+	return nil
+}
+
+func (s *Store) join(orgID, userID, role string) *model.OrgMember {
+	m := &model.OrgMember{OrgID: orgID, UserID: userID, Role: role, JoinedAt: time.Now()}
+	s.members[userID] = m
+	if u := s.users[userID]; u != nil {
+		u.OrgID = orgID
+	}
+	c := *m
+	return &c
+}
+
+func (s *Store) Organization(ctx context.Context, id string) (*model.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orgs[id]
+	if o == nil {
+		return nil, pgx.ErrNoRows
+	}
+	c := *o
+	return &c, nil
+}
+
+func (s *Store) OrgMembership(ctx context.Context, userID string) (*model.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[userID]
+	if m == nil {
+		return nil, pgx.ErrNoRows
+	}
+	c := *m
+	return &c, nil
+}
+
+// OrgMembers orders like store.Store's: owners first, then by joining.
+func (s *Store) OrgMembers(ctx context.Context, orgID string) ([]model.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.OrgMember
+	for _, m := range s.members {
+		if u := s.liveUser(m.UserID); u != nil && m.OrgID == orgID {
+			c := *m
+			c.Name, c.Email = u.Name, u.Email
+			out = append(out, c)
+		}
+	}
+	rank := func(m model.OrgMember) int {
+		if m.Role == store.OrgOwner {
+			return 0
+		}
+		return 1
+	}
+	slices.SortFunc(out, func(a, b model.OrgMember) int {
+		return cmp.Or(cmp.Compare(rank(a), rank(b)), a.JoinedAt.Compare(b.JoinedAt), strings.Compare(a.UserID, b.UserID))
+	})
+	return out, nil
+}
+
+func (s *Store) CreateOrgInvite(ctx context.Context, inv *model.OrgInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv.CreatedAt = time.Now()
+	s.invites[inv.TokenHash] = &orgInvite{OrgInvite: *inv}
+	return nil
+}
+
+func (s *Store) AcceptOrgInvite(ctx context.Context, tokenHash, userID, email string) (*model.OrgMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv := s.invites[tokenHash]
+	if inv == nil || inv.accepted || !inv.ExpiresAt.After(time.Now()) ||
+		!strings.EqualFold(inv.Email, email) || s.orgs[inv.OrgID] == nil {
+		return nil, pgx.ErrNoRows
+	}
+	if s.members[userID] != nil {
+		return nil, store.ErrInOrg
+	}
+	inv.accepted = true
+	return s.join(inv.OrgID, userID, inv.Role), nil
+}
+
+// LeaveOrganization hands over and deletes like store.Store's.
+func (s *Store) LeaveOrganization(ctx context.Context, orgID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leave(orgID, userID)
+}
+
+// leave is LeaveOrganization with s.mu held.
+func (s *Store) leave(orgID, userID string) error {
+	m := s.members[userID]
+	if m == nil || m.OrgID != orgID {
+		return pgx.ErrNoRows
+	}
+	delete(s.members, userID)
+	if u := s.users[userID]; u != nil {
+		u.OrgID = ""
+	}
+	var rest []*model.OrgMember
+	for _, o := range s.members {
+		if o.OrgID == orgID {
+			if o.Role == store.OrgOwner {
+				return nil
+			}
+			rest = append(rest, o)
+		}
+	}
+	if len(rest) == 0 {
+		delete(s.orgs, orgID)
+		for _, a := range s.appointments {
+			if a.OrgID == orgID {
+				a.OrgID = ""
+			}
+		}
+		return nil
+	}
+	if m.Role == store.OrgOwner {
+		slices.SortFunc(rest, func(a, b *model.OrgMember) int {
+			return cmp.Or(a.JoinedAt.Compare(b.JoinedAt), strings.Compare(a.UserID, b.UserID))
+		})
+		rest[0].Role = store.OrgOwner
+	}
+	return nil
+}
+
+func (s *Store) OrgAppointments(ctx context.Context, orgID, memberID string, p store.ListParams) ([]model.Appointment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Appointment
+	for _, a := range s.appointments {
+		m := s.members[a.UserID]
+		if a.OrgID != orgID || m == nil || m.OrgID != orgID || (memberID != "" && a.UserID != memberID) {
+			continue
+		}
+		if listed(a, a.UserID, p) && (p.AfterID == "" || byStart(a, p.AfterStart, p.AfterID) > 0) {
+			out = append(out, *clone(a))
+		}
+	}
+	slices.SortFunc(out, func(a, b model.Appointment) int { return byStart(&a, b.StartTime, b.ID) })
+	if p.Limit > 0 && len(out) > p.Limit {
+		out = out[:p.Limit]
+	}
+	return out, nil
+}
+
+func (s *Store) CancelOrgAppointment(ctx context.Context, id, actorID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.appointments[id]
+	if a == nil || a.OrgID == "" || a.UserID == actorID {
+		return "", pgx.ErrNoRows
+	}
+	actor, owner := s.members[actorID], s.members[a.UserID]
+	if actor == nil || actor.OrgID != a.OrgID || actor.Role != store.OrgOwner || owner == nil || owner.OrgID != a.OrgID {
+		return "", pgx.ErrNoRows
+	}
+	if a.Status != "cancelled" {
+		a.Status, a.UpdatedAt = "cancelled", time.Now()
+	}
+	return a.UserID, nil
+}
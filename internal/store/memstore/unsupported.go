@@ -0,0 +1,111 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+	"schedule-management-api/internal/store"
+)
+
+// The features below report missing from Has, so the handler doesn't get
+// this far; they're here to satisfy handler.Store.
+
+func (s *Store) SearchAppointments(ctx context.Context, p store.SearchParams) ([]store.SearchResult, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) AppointmentHistory(ctx context.Context, appointmentID string, afterID int64, limit int) ([]store.AuditEntry, error) {
+	return nil, ErrUnsupported
+}
+
+// ScheduleSummary has no feature to turn it off; it's the one a handler
+// on memstore fails (Internal) rather than reporting Unavailable.
+func (s *Store) ScheduleSummary(ctx context.Context, userID string, from, to time.Time, unit, tz string) ([]store.SummaryBucket, int, time.Duration, error) {
+	return nil, 0, 0, ErrUnsupported
+}
+
+func (s *Store) FreezeWindows(ctx context.Context, since time.Time) ([]model.FreezeWindow, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) FreezeOverlapping(ctx context.Context, start, end time.Time) (*model.FreezeWindow, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) CreateFreezeWindow(ctx context.Context, w *model.FreezeWindow) error {
+	return ErrUnsupported
+}
+
+func (s *Store) DeleteFreezeWindow(ctx context.Context, id string) error {
+	return ErrUnsupported
+}
+
+func (s *Store) Calendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) CreateCalendar(ctx context.Context, c *model.Calendar) error {
+	return ErrUnsupported
+}
+
+func (s *Store) UpdateCalendar(ctx context.Context, c *model.Calendar, makeDefault bool) error {
+	return ErrUnsupported
+}
+
+func (s *Store) DeleteCalendar(ctx context.Context, id, userID string) error {
+	return ErrUnsupported
+}
+
+func (s *Store) Resource(ctx context.Context, id string) (*model.Resource, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) Resources(ctx context.Context) ([]model.Resource, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) CreateResource(ctx context.Context, r *model.Resource) error {
+	return ErrUnsupported
+}
+
+func (s *Store) CheckResource(ctx context.Context, resourceID string, start, end time.Time, excludeID string) error {
+	return ErrUnsupported
+}
+
+func (s *Store) ResourceBusy(ctx context.Context, resourceID string, w slots.Interval) ([]slots.Interval, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) CreateShareLink(ctx context.Context, l *model.ShareLink) error {
+	return ErrUnsupported
+}
+
+func (s *Store) ActiveShareLink(ctx context.Context, tokenHash string) (*model.ShareLink, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) RevokeShareLink(ctx context.Context, id, userID string) error {
+	return ErrUnsupported
+}
+
+func (s *Store) Webhooks(ctx context.Context, userID string) ([]model.Webhook, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, w *model.Webhook, max int) error {
+	return ErrUnsupported
+}
+
+func (s *Store) SetWebhookEnabled(ctx context.Context, id, userID string, enabled bool) (*model.Webhook, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id, userID string) error {
+	return ErrUnsupported
+}
+
+func (s *Store) AppendAdminAudit(ctx context.Context, actorID, action string, params any) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Migration is one db/migrations/NNN_name.sql file.
+type Migration struct {
+	Version int
+	Name    string // file name without .sql, e.g. "001_init"
+	SQL     string
+}
+
+var migrationFile = regexp.MustCompile(`^(\d{3})_[a-z0-9_]+\.sql$`)
+
+// LoadMigrations reads every NNN_name.sql at the top of fsys, oldest first.
+// Other files are ignored; two files with the same number are an error.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		v, _ := strconv.Atoi(m[1])
+		if prev, ok := seen[v]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", prev, e.Name(), v)
+		}
+		seen[v] = e.Name()
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: v, Name: e.Name()[:len(e.Name())-len(".sql")], SQL: string(b)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// MigrateResult is what Migrate did and where the schema ended up.
+type MigrateResult struct {
+	Applied   []string  // names applied by this call, oldest first
+	Current   string    // newest recorded migration, "" if none
+	AppliedAt time.Time // when Current was applied
+}
+
+// arbitrary, just has to be the same for every replica
+const migrateLockKey = 44170001
+
+// Migrate applies the migrations schema_migrations has no row for, each in
+// its own transaction together with its row, and stops at the first one
+// that fails. Replicas starting together wait on an advisory lock, so each
+// file runs once.
+//
+// A database set up before this runner existed has no rows yet and gets
+// 001_init again, which is why that file has to stay idempotent.
+func (s *Store) Migrate(ctx context.Context, ms []Migration) (MigrateResult, error) {
+	var res MigrateResult
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrateLockKey); err != nil {
+		return res, fmt.Errorf("migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrateLockKey)
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+		return res, fmt.Errorf("schema_migrations: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return res, err
+	}
+	done := map[int]bool{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return res, err
+		}
+		done[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	for _, m := range ms {
+		if done[m.Version] {
+			continue
+		}
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return res, err
+		}
+		// no arguments, so pgx sends it as one simple query and a file can
+		// hold several statements
+		if _, err := tx.Exec(ctx, m.SQL); err != nil {
+			tx.Rollback(ctx)
+			return res, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			tx.Rollback(ctx)
+			return res, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return res, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		res.Applied = append(res.Applied, m.Name)
+	}
+
+	res.Current, res.AppliedAt, err = s.SchemaVersion(ctx)
+	return res, err
+}
+
+// SchemaVersion is the newest migration schema_migrations records and
+// when it was applied; "" if there's no record at all.
+func (s *Store) SchemaVersion(ctx context.Context) (string, time.Time, error) {
+	var name string
+	var at time.Time
+	err := s.pool.QueryRow(ctx, `
+		SELECT name, applied_at FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&name, &at)
+	var pgErr *pgconn.PgError
+	// 42P01: no schema_migrations table, nothing has run yet
+	if errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+		return "", time.Time{}, nil
+	}
+	return name, at, err
+}
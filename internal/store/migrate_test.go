@@ -0,0 +1,181 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+
+	"schedule-management-api/db/migrations"
+	"schedule-management-api/internal/store"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	ms, err := store.LoadMigrations(fstest.MapFS{
+		"010_later.sql":   {Data: []byte("SELECT 10")},
+		"002_second.sql":  {Data: []byte("SELECT 2")},
+		"001_init.sql":    {Data: []byte("SELECT 1")},
+		"README.md":       {Data: []byte("not sql")},
+		"3_unpadded.sql":  {Data: []byte("SELECT 3")},
+		"migrations.go":   {Data: []byte("package migrations")},
+		"004_Upper.sql":   {Data: []byte("SELECT 4")},
+		"old/005_sub.sql": {Data: []byte("SELECT 5")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range ms {
+		got = append(got, fmt.Sprintf("%d:%s:%s", m.Version, m.Name, m.SQL))
+	}
+	want := "1:001_init:SELECT 1 2:002_second:SELECT 2 10:010_later:SELECT 10"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	_, err = store.LoadMigrations(fstest.MapFS{
+		"002_a.sql": {Data: []byte("SELECT 1")},
+		"002_b.sql": {Data: []byte("SELECT 2")},
+	})
+	if err == nil {
+		t.Error("duplicate version accepted")
+	}
+}
+
+// the embedded set starts at 001 and has no gaps
+func TestEmbeddedMigrations(t *testing.T) {
+	ms, err := store.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range ms {
+		if m.Version != i+1 {
+			t.Errorf("%s: want version %d", m.Name, i+1)
+		}
+	}
+}
+
+// scratchPool is a pool whose search_path is a fresh schema, dropped at
+// the end of the test.
+func scratchPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	_ = godotenv.Load("../../.env")
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	t.Cleanup(admin.Close)
+	schema := fmt.Sprintf("mig_test_%d", time.Now().UnixNano())
+	mustExec(t, admin, `CREATE SCHEMA `+schema)
+	t.Cleanup(func() { admin.Exec(context.Background(), `DROP SCHEMA `+schema+` CASCADE`) })
+
+	cfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestMigrate(t *testing.T) {
+	pool := scratchPool(t)
+	ctx := context.Background()
+	files := fstest.MapFS{
+		"001_init.sql": {Data: []byte(`CREATE TABLE things (id INT PRIMARY KEY); INSERT INTO things VALUES (1);`)},
+		"002_more.sql": {Data: []byte(`INSERT INTO things VALUES (2);`)},
+		"notes.txt":    {Data: []byte(`ignored`)},
+	}
+	load := func() []store.Migration {
+		ms, err := store.LoadMigrations(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ms
+	}
+	count := func(q string) int {
+		var n int
+		if err := pool.QueryRow(ctx, q).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		return n
+	}
+
+	// a fresh process with nothing applied
+	res, err := store.New(pool).Migrate(ctx, load())
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if strings.Join(res.Applied, ",") != "001_init,002_more" || res.Current != "002_more" || res.AppliedAt.IsZero() {
+		t.Errorf("first run: %+v", res)
+	}
+
+	// restart: nothing runs twice (002 would insert a duplicate key)
+	res, err = store.New(pool).Migrate(ctx, load())
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if len(res.Applied) != 0 || res.Current != "002_more" {
+		t.Errorf("restart: %+v", res)
+	}
+	if n := count(`SELECT count(*) FROM things`); n != 2 {
+		t.Errorf("things = %d, want 2", n)
+	}
+
+	// a broken file stops the run, leaves nothing of itself behind and
+	// keeps later files from running
+	files["003_broken.sql"] = &fstest.MapFile{Data: []byte(`INSERT INTO things VALUES (3); SELECT no_such_column FROM things;`)}
+	files["004_after.sql"] = &fstest.MapFile{Data: []byte(`INSERT INTO things VALUES (4);`)}
+	res, err = store.New(pool).Migrate(ctx, load())
+	if err == nil || !strings.Contains(err.Error(), "003_broken") {
+		t.Fatalf("broken run: err = %v", err)
+	}
+	if len(res.Applied) != 0 {
+		t.Errorf("broken run applied %v", res.Applied)
+	}
+	if n := count(`SELECT count(*) FROM things`); n != 2 {
+		t.Errorf("things = %d after failed migration, want 2", n)
+	}
+	if n := count(`SELECT count(*) FROM schema_migrations`); n != 2 {
+		t.Errorf("schema_migrations has %d rows, want 2", n)
+	}
+	if cur, _, err := store.New(pool).SchemaVersion(ctx); err != nil || cur != "002_more" {
+		t.Errorf("SchemaVersion = %q, %v", cur, err)
+	}
+
+	// fixed, the rest goes through
+	files["003_broken.sql"] = &fstest.MapFile{Data: []byte(`INSERT INTO things VALUES (3);`)}
+	res, err = store.New(pool).Migrate(ctx, load())
+	if err != nil {
+		t.Fatalf("fixed run: %v", err)
+	}
+	if strings.Join(res.Applied, ",") != "003_broken,004_after" || res.Current != "004_after" {
+		t.Errorf("fixed run: %+v", res)
+	}
+}
+
+func TestSchemaVersionBeforeAnyMigration(t *testing.T) {
+	pool := scratchPool(t)
+	cur, at, err := store.New(pool).SchemaVersion(context.Background())
+	if err != nil || cur != "" || !at.IsZero() {
+		t.Errorf("SchemaVersion = %q, %v, %v", cur, at, err)
+	}
+}
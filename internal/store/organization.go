@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// ErrInOrg is returned when a user who's already in an organization
+// creates or joins another.
+var ErrInOrg = errors.New("user is already in an organization")
+
+// Organization member roles.
+const (
+	OrgMember = "member"
+	OrgOwner  = "owner"
+)
+
+// orgCol selects a user's or appointment's organization ID, "" for none
+// or without the feature.
+func (s *Store) orgCol(table string) string {
+	if !s.Has(FeatureOrganizations) {
+		return `''`
+	}
+	return `COALESCE(` + table + `.org_id::text, '')`
+}
+
+// CreateOrganization makes o with o.CreatedBy as its owner, ErrInOrg if
+// they're in one already.
+func (s *Store) CreateOrganization(ctx context.Context, o *model.Organization) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.QueryRow(ctx,
+		`INSERT INTO organizations (id, name, created_by) VALUES ($1,$2,$3) RETURNING created_at`,
+		o.ID, o.Name, o.CreatedBy,
+	).Scan(&o.CreatedAt); err != nil {
+		return err
+	}
+	if _, err := s.join(ctx, tx, o.ID, o.CreatedBy, OrgOwner); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// join adds userID to orgID in tx and points users.org_id at it.
+func (s *Store) join(ctx context.Context, tx pgx.Tx, orgID, userID, role string) (*model.OrgMember, error) {
+	m := &model.OrgMember{OrgID: orgID, UserID: userID, Role: role}
+	err := tx.QueryRow(ctx,
+		`INSERT INTO organization_members (org_id, user_id, role) VALUES ($1,$2,$3) RETURNING joined_at`,
+		orgID, userID, role,
+	).Scan(&m.JoinedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrInOrg
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET org_id = $1 WHERE id = $2`, orgID, userID); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *Store) Organization(ctx context.Context, id string) (*model.Organization, error) {
+	o := &model.Organization{}
+	err := s.pool.QueryRow(ctx,
+		`SELECT id, name, COALESCE(created_by::text, ''), created_at FROM organizations WHERE id = $1`, id,
+	).Scan(&o.ID, &o.Name, &o.CreatedBy, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// OrgMembership is userID's place in their organization, pgx.ErrNoRows if
+// they aren't in one. Name and Email are left empty.
+func (s *Store) OrgMembership(ctx context.Context, userID string) (*model.OrgMember, error) {
+	m := &model.OrgMember{UserID: userID}
+	err := s.pool.QueryRow(ctx,
+		`SELECT org_id, role, joined_at FROM organization_members WHERE user_id = $1`, userID,
+	).Scan(&m.OrgID, &m.Role, &m.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OrgMembers lists orgID's live members, owners first, then by when they
+// joined.
+func (s *Store) OrgMembers(ctx context.Context, orgID string) ([]model.OrgMember, error) {
+	live := ` AND u.deleted_at IS NULL`
+	if !s.Has(FeatureAccountDeletion) {
+		live = ``
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT m.user_id, u.name, u.email, m.role, m.joined_at
+		 FROM organization_members m JOIN users u ON u.id = m.user_id
+		 WHERE m.org_id = $1`+live+`
+		 ORDER BY m.role = 'owner' DESC, m.joined_at, m.user_id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.OrgMember, error) {
+		m := model.OrgMember{OrgID: orgID}
+		err := row.Scan(&m.UserID, &m.Name, &m.Email, &m.Role, &m.JoinedAt)
+		return m, err
+	})
+}
+
+func (s *Store) CreateOrgInvite(ctx context.Context, inv *model.OrgInvite) error {
+	return s.pool.QueryRow(ctx,
+		`INSERT INTO organization_invites (id, org_id, email, role, token_hash, invited_by, expires_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING created_at`,
+		inv.ID, inv.OrgID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt,
+	).Scan(&inv.CreatedAt)
+}
+
+// AcceptOrgInvite spends the live invite with tokenHash addressed to email
+// (in any case) and makes userID a member. pgx.ErrNoRows if there's no
+// such invite, ErrInOrg if userID is in an organization already, in which
+// case the invite is left unspent.
+func (s *Store) AcceptOrgInvite(ctx context.Context, tokenHash, userID, email string) (*model.OrgMember, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id, orgID, role string
+	err = tx.QueryRow(ctx,
+		`SELECT i.id, i.org_id, i.role FROM organization_invites i
+		 JOIN organizations o ON o.id = i.org_id
+		 WHERE i.token_hash = $1 AND lower(i.email) = lower($2)
+		   AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		 FOR UPDATE`, tokenHash, email,
+	).Scan(&id, &orgID, &role)
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.join(ctx, tx, orgID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE organization_invites SET accepted_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	return m, tx.Commit(ctx)
+}
+
+// LeaveOrganization takes userID out of orgID, pgx.ErrNoRows if they
+// aren't in it. The last owner out hands the organization to the
+// longest-standing member; the last member out deletes it.
+func (s *Store) LeaveOrganization(ctx context.Context, orgID, userID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := s.leaveOrg(ctx, tx, orgID, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// leaveOrg is LeaveOrganization inside tx: the membership goes, ownership
+// passes to the longest-standing member if the leaver was the last owner,
+// and an organization left empty is deleted.
+func (s *Store) leaveOrg(ctx context.Context, tx pgx.Tx, orgID, userID string) error {
+	// one leaver at a time, so two owners can't both think the other stays
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM organizations WHERE id = $1 FOR UPDATE`, orgID); err != nil {
+		return err
+	}
+	var role string
+	err := tx.QueryRow(ctx,
+		`DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2 RETURNING role`, orgID, userID,
+	).Scan(&role)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET org_id = NULL WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if role == OrgOwner {
+		if _, err := tx.Exec(ctx,
+			`UPDATE organization_members SET role = 'owner'
+			 WHERE org_id = $1
+			   AND NOT EXISTS (SELECT 1 FROM organization_members WHERE org_id = $1 AND role = 'owner')
+			   AND user_id = (SELECT user_id FROM organization_members WHERE org_id = $1
+			                  ORDER BY joined_at, user_id LIMIT 1)`, orgID,
+		); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx,
+		`DELETE FROM organizations
+		 WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM organization_members WHERE org_id = $1)`, orgID,
+	)
+	return err
+}
+
+// OrgAppointments is ListAppointments over orgID: the appointments booked
+// in it whose owners are still members, or just memberID's if set.
+// p.CalendarID is ignored, calendars being per user.
+func (s *Store) OrgAppointments(ctx context.Context, orgID, memberID string, p ListParams) ([]model.Appointment, error) {
+	p.CalendarID = ""
+	where, args := s.filterWhere(`org_id = $1
+	   AND user_id IN (SELECT user_id FROM organization_members WHERE org_id = $1)`, orgID, p)
+	if memberID != "" {
+		args = append(args, memberID)
+		where += fmt.Sprintf(` AND user_id = $%d`, len(args))
+	}
+	q := `SELECT id, title, description, start_time, end_time,
+	        user_id, status, location, created_at, updated_at, ` + s.calendarCol("appointments") + `, ` + s.resourceCol("appointments") + `,
+	        ` + s.tagsCol("appointments") + `, ` + s.capacityCol("appointments") + `, ` + s.rescheduleCountCol("appointments") + `,
+	        ` + s.allDayCol("appointments") + `, ` + s.timeZoneCol("appointments") + `, ` + s.orgCol("appointments") + `
+	 FROM appointments
+	 WHERE ` + where
+	if p.AfterID != "" {
+		args = append(args, p.AfterStart, p.AfterID)
+		q += fmt.Sprintf(` AND (start_time, id) > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	q += ` ORDER BY start_time, id`
+	if p.Limit > 0 {
+		q += fmt.Sprintf(` LIMIT %d`, p.Limit)
+	}
+
+	var out []model.Appointment
+	err := s.read(ctx, "OrgAppointments", func() error {
+		var err error
+		out, err = s.listAppointments(ctx, q, args)
+		return err
+	})
+	return out, err
+}
+
+// CancelOrgAppointment cancels appointment id for an owner of the
+// organization it was booked in, as long as its owner is still a member,
+// and returns that owner. pgx.ErrNoRows if actorID isn't such an owner or
+// it's their own appointment; cancelling it again changes nothing.
+func (s *Store) CancelOrgAppointment(ctx context.Context, id, actorID string) (string, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	// the shares keep both memberships until the cancel commits
+	var ownerID string
+	err = tx.QueryRow(ctx,
+		`SELECT a.user_id FROM appointments a
+		 JOIN organization_members o ON o.org_id = a.org_id AND o.user_id = $2 AND o.role = 'owner'
+		 JOIN organization_members m ON m.org_id = a.org_id AND m.user_id = a.user_id
+		 WHERE a.id = $1 AND a.user_id <> $2
+		 FOR SHARE OF o, m`, id, actorID,
+	).Scan(&ownerID)
+	if err != nil {
+		return "", err
+	}
+	a, err := s.lockAppointment(ctx, tx, id, ownerID)
+	if err != nil || a.Status == "cancelled" {
+		return ownerID, err
+	}
+	if err := s.cancelLocked(ctx, tx, a, actorID); err != nil {
+		return "", err
+	}
+	return ownerID, tx.Commit(ctx)
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// PublishEvents makes appointment changes write to the events outbox (once
+// the schema has it) for the relay to publish. Off by default so rows
+// don't pile up with nothing draining them. Call it before serving.
+func (s *Store) PublishEvents(on bool) {
+	s.events = on
+}
+
+func (s *Store) publishesEvents() bool {
+	return s.events && s.Has(FeatureEventsOutbox)
+}
+
+// enqueueEvent writes the outbox row for a change to an appointment. The
+// appointment's row lock is held by tx, so its events get seq in the
+// order they commit.
+func (s *Store) enqueueEvent(ctx context.Context, tx pgx.Tx, event, appointmentID string, body []byte) error {
+	if !s.publishesEvents() {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO outbox_events (type, aggregate_id, payload) VALUES ($1, $2, $3)`,
+		event, appointmentID, body,
+	)
+	return err
+}
+
+// ClaimOutboxEvents hands out up to limit due events in seq order, at
+// most one per appointment: the oldest not yet published. A later event
+// isn't handed out while an earlier one for the same appointment is
+// pending, claimed elsewhere or waiting for a retry, which is what keeps
+// one appointment's events in order. Claiming counts an attempt and
+// pushes the row lease into the future, like ClaimWebhookDeliveries, so
+// an event whose claimer died is picked up again then.
+func (s *Store) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	rows, err := s.pool.Query(ctx,
+		`WITH claimed AS (
+		   UPDATE outbox_events
+		   SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		   WHERE id IN (
+		     SELECT e.id FROM outbox_events e
+		     WHERE e.published_at IS NULL AND e.next_attempt_at <= NOW()
+		       AND NOT EXISTS (
+		         SELECT 1 FROM outbox_events p
+		         WHERE p.aggregate_id = e.aggregate_id AND p.published_at IS NULL AND p.seq < e.seq)
+		     ORDER BY e.seq
+		     LIMIT $1
+		     FOR UPDATE SKIP LOCKED)
+		   RETURNING id::text, seq, type, aggregate_id::text, payload, created_at, attempts)
+		 SELECT * FROM claimed ORDER BY seq`, limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.OutboxEvent])
+}
+
+// OutboxPublished marks an event done.
+func (s *Store) OutboxPublished(ctx context.Context, id string) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE outbox_events SET published_at = NOW(), last_error = '' WHERE id::text = $1`, id)
+	return err
+}
+
+// OutboxFailed records a failed publish; the event is due again at
+// retryAt, and the appointment's later events wait for it.
+func (s *Store) OutboxFailed(ctx context.Context, id, msg string, retryAt time.Time) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE outbox_events SET last_error = $2, next_attempt_at = $3 WHERE id::text = $1`,
+		id, msg, retryAt)
+	return err
+}
+
+// PurgeOutboxEvents deletes events published more than retention ago.
+// Unpublished ones stay however old they are. Returns how many went.
+func (s *Store) PurgeOutboxEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM outbox_events WHERE published_at < $1`, time.Now().Add(-retention))
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,134 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/outbox"
+	"schedule-management-api/internal/store"
+)
+
+// failing fails every publish for one appointment until healed.
+type failing struct {
+	*outbox.Memory
+	aggregate string
+	down      bool
+}
+
+func (p *failing) Publish(ctx context.Context, m outbox.Message) error {
+	if p.down && m.AggregateID == p.aggregate {
+		return errors.New("bus down")
+	}
+	return p.Memory.Publish(ctx, m)
+}
+
+func TestOutboxEvents(t *testing.T) {
+	f := seeded(t, 0)
+	ctx := context.Background()
+	if !f.st.Has(store.FeatureEventsOutbox) {
+		t.Skip("no outbox_events table")
+	}
+	f.st.PublishEvents(true)
+
+	start := f.base.Add(3 * time.Hour)
+	a := &model.Appointment{ID: uuid.NewString(), Title: "one", UserID: f.userID, Status: "confirmed", StartTime: start, EndTime: start.Add(time.Hour)}
+	b := &model.Appointment{ID: uuid.NewString(), Title: "two", UserID: f.userID, Status: "confirmed", StartTime: start.Add(2 * time.Hour), EndTime: start.Add(3 * time.Hour)}
+	t.Cleanup(func() {
+		f.pool.Exec(context.Background(), `DELETE FROM outbox_events WHERE aggregate_id::text = ANY($1)`, []string{a.ID, b.ID})
+	})
+	for _, x := range []*model.Appointment{a, b} {
+		if err := f.st.CreateAppointment(ctx, x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Title = "one, renamed"
+	if err := f.st.UpdateAppointment(ctx, a, []string{"title"}); err != nil {
+		t.Fatal(err)
+	}
+	a.StartTime, a.EndTime = a.StartTime.Add(30*time.Minute), a.EndTime.Add(30*time.Minute)
+	if err := f.st.UpdateAppointment(ctx, a, []string{"start_time", "end_time"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.st.DeleteAppointment(ctx, a.ID, f.userID); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := &failing{Memory: &outbox.Memory{}, aggregate: a.ID, down: true}
+	r := outbox.NewRelay(f.st, pub, outbox.WithBackoff(time.Hour, time.Hour))
+	r.Tick(ctx)
+
+	types := func(id string) []string {
+		var out []string
+		for _, m := range pub.Messages() {
+			if m.AggregateID == id {
+				out = append(out, m.Type)
+			}
+		}
+		return out
+	}
+	// a's first event failed: it and everything after it wait
+	if got := types(a.ID); len(got) != 0 {
+		t.Errorf("a published %v while its first event failed", got)
+	}
+	if got := types(b.ID); !slices.Equal(got, []string{store.EventCreated}) {
+		t.Errorf("b: %v", got)
+	}
+	var pending, attempts int
+	var lastError string
+	err := f.pool.QueryRow(ctx,
+		`SELECT count(*), max(attempts), max(last_error) FROM outbox_events
+		 WHERE aggregate_id = $1 AND published_at IS NULL`, a.ID,
+	).Scan(&pending, &attempts, &lastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 4 || attempts != 1 || lastError != "bus down" {
+		t.Errorf("a pending %d, attempts %d, error %q", pending, attempts, lastError)
+	}
+
+	// the bus is back and the retry comes due
+	pub.down = false
+	if _, err := f.pool.Exec(ctx, `UPDATE outbox_events SET next_attempt_at = NOW() WHERE aggregate_id = $1`, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	r.Tick(ctx)
+	want := []string{store.EventCreated, store.EventUpdated, store.EventRescheduled, store.EventCancelled}
+	if got := types(a.ID); !slices.Equal(got, want) {
+		t.Errorf("a: %v, want %v", got, want)
+	}
+	for _, m := range pub.Messages() {
+		if m.ID == "" || len(m.Payload) == 0 {
+			t.Errorf("message %+v", m)
+		}
+	}
+	err = f.pool.QueryRow(ctx,
+		`SELECT count(*) FROM outbox_events WHERE aggregate_id::text = ANY($1) AND published_at IS NULL`,
+		[]string{a.ID, b.ID},
+	).Scan(&pending)
+	if err != nil || pending != 0 {
+		t.Errorf("%d still pending (%v)", pending, err)
+	}
+
+	// past the retention a's events go, b's recent one stays
+	if _, err := f.pool.Exec(ctx, `UPDATE outbox_events SET published_at = NOW() - INTERVAL '8 days' WHERE aggregate_id = $1`, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.st.PurgeOutboxEvents(ctx, 7*24*time.Hour); err != nil || n < 4 {
+		t.Fatalf("purged %d (%v)", n, err)
+	}
+	var left [2]int
+	for i, id := range []string{a.ID, b.ID} {
+		if err := f.pool.QueryRow(ctx, `SELECT count(*) FROM outbox_events WHERE aggregate_id = $1`, id).Scan(&left[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if left != [2]int{0, 1} {
+		t.Errorf("left after purge: a %d, b %d", left[0], left[1])
+	}
+}
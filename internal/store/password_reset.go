@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// CreatePasswordResetToken stores a new reset token hash for the user and
+// invalidates any earlier unused ones, so only the latest email works.
+func (s *Store) CreatePasswordResetToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1,$2,$3)`,
+		userID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumePasswordResetToken marks a valid (unused, unexpired) token used and
+// returns its user. Single statement, so two concurrent resets can't both win.
+func (s *Store) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+	err := s.pool.QueryRow(ctx,
+		`UPDATE password_reset_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`, tokenHash,
+	).Scan(&userID)
+	return userID, err
+}
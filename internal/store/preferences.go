@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// ErrBuffer is returned when a timed appointment would start or end
+// within its owner's buffer of another of their confirmed timed ones.
+var ErrBuffer = errors.New("within the buffer of another appointment")
+
+// Preferences returns userID's preferences; a user who never set any gets
+// the defaults (no buffer).
+func (s *Store) Preferences(ctx context.Context, userID string) (*model.Preferences, error) {
+	p := &model.Preferences{UserID: userID}
+	err := s.pool.QueryRow(ctx,
+		`SELECT buffer_minutes, updated_at FROM user_preferences WHERE user_id = $1`,
+		userID,
+	).Scan(&p.BufferMinutes, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetPreferences replaces p.UserID's preferences and fills in UpdatedAt.
+func (s *Store) SetPreferences(ctx context.Context, p *model.Preferences) error {
+	return s.pool.QueryRow(ctx,
+		`INSERT INTO user_preferences (user_id, buffer_minutes)
+		 VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET buffer_minutes = EXCLUDED.buffer_minutes, updated_at = NOW()
+		 RETURNING updated_at`,
+		p.UserID, p.BufferMinutes,
+	).Scan(&p.UpdatedAt)
+}
+
+// checkSlot is slotTaken that also keeps buf free either side of a timed
+// [start, end): ErrConflict for an overlap, ErrBuffer for one that's only
+// too close. No constraint backs the buffer, so a buffered write first
+// queues on the owner's advisory lock, and of two racing ones the second
+// sees the first once it has committed.
+func (s *Store) checkSlot(ctx context.Context, tx pgx.Tx, userID string, start, end time.Time, allDay bool, excludeID string, buf time.Duration) error {
+	buffered := buf > 0 && !allDay
+	if buffered {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('buffer:' || $1, 0))`, userID); err != nil {
+			return err
+		}
+	}
+	if dup, err := s.slotTaken(ctx, tx, userID, start, end, allDay, excludeID); err != nil {
+		return err
+	} else if dup {
+		return ErrConflict
+	}
+	if !buffered {
+		return nil
+	}
+	near, err := s.hasOverlap(ctx, tx, userID, start.Add(-buf), end.Add(buf), false, excludeID)
+	if err != nil {
+		return err
+	}
+	if near {
+		return ErrBuffer
+	}
+	return nil
+}
@@ -2,44 +2,173 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"schedule-management-api/internal/auth"
 )
 
 type RefreshToken struct {
-	ID         string
-	UserID     string
-	TokenHash  string
-	ExpiresAt  time.Time
-	Revoked    bool
-	ReplacedBy *string
-	CreatedAt  time.Time
+	ID          string
+	UserID      string
+	TokenHash   string
+	HashVersion int
+	ExpiresAt   time.Time
+	Revoked     bool
+	ReplacedBy  *string
+	CreatedAt   time.Time
+	SessionInfo
+}
+
+// SessionInfo is the client a refresh token was issued to, as the session
+// list shows it. Empty for tokens from before the sessions migration.
+type SessionInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
 }
 
-func (s *Store) CreateRefreshToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) (string, error) {
+func (s *Store) CreateRefreshToken(ctx context.Context, userID string, hash auth.VersionedHash, expiresAt time.Time, client SessionInfo) (string, error) {
 	id := uuid.New().String()
-	_, err := s.pool.Exec(ctx,
-		`INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at) VALUES ($1,$2,$3,$4)`,
-		id, userID, tokenHash, expiresAt,
+	return id, s.insertRefreshToken(ctx, s.pool, id, userID, hash, expiresAt, client)
+}
+
+// insertRefreshToken adds a token row, with the client when the schema has
+// the columns for it.
+func (s *Store) insertRefreshToken(ctx context.Context, q execer, id, userID string, hash auth.VersionedHash, expiresAt time.Time, client SessionInfo) error {
+	if !s.Has(FeatureSessions) {
+		_, err := q.Exec(ctx,
+			`INSERT INTO refresh_tokens (id, user_id, token_hash, hash_version, expires_at) VALUES ($1,$2,$3,$4,$5)`,
+			id, userID, hash.Hash, hash.Version, expiresAt,
+		)
+		return err
+	}
+	_, err := q.Exec(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, token_hash, hash_version, expires_at, user_agent, ip)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		id, userID, hash.Hash, hash.Version, expiresAt, client.UserAgent, client.IP,
 	)
-	return id, err
+	return err
+}
+
+// ListRefreshTokensByUser lists userID's live sessions: refresh tokens
+// neither revoked nor expired, newest first. TokenHash is left empty.
+func (s *Store) ListRefreshTokensByUser(ctx context.Context, userID string) ([]RefreshToken, error) {
+	client := `'', ''`
+	if s.Has(FeatureSessions) {
+		client = `user_agent, ip`
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, user_id, hash_version, expires_at, created_at, `+client+` FROM refresh_tokens
+		 WHERE user_id = $1 AND NOT revoked AND expires_at > NOW()
+		 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (RefreshToken, error) {
+		var t RefreshToken
+		err := r.Scan(&t.ID, &t.UserID, &t.HashVersion, &t.ExpiresAt, &t.CreatedAt, &t.UserAgent, &t.IP)
+		return t, err
+	})
+}
+
+// RevokeRefreshToken ends one of userID's sessions. pgx.ErrNoRows if id
+// isn't a live token of theirs.
+func (s *Store) RevokeRefreshToken(ctx context.Context, id, userID string) error {
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked = true
+		 WHERE id::text = $1 AND user_id = $2 AND NOT revoked AND expires_at > NOW()`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
 }
 
 func (s *Store) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
 	rt := &RefreshToken{}
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, user_id, token_hash, expires_at, revoked, replaced_by, created_at
+		`SELECT id, user_id, token_hash, hash_version, expires_at, revoked, replaced_by, created_at
 		 FROM refresh_tokens WHERE token_hash = $1`, tokenHash,
-	).Scan(&rt.ID, &rt.UserID, &rt.TokenHash, &rt.ExpiresAt, &rt.Revoked, &rt.ReplacedBy, &rt.CreatedAt)
+	).Scan(&rt.ID, &rt.UserID, &rt.TokenHash, &rt.HashVersion, &rt.ExpiresAt, &rt.Revoked, &rt.ReplacedBy, &rt.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return rt, nil
 }
 
-// rotate: revoke old token, create new one, link them
-func (s *Store) RotateRefreshToken(ctx context.Context, oldID, newID, userID, newHash string, newExpiry time.Time) error {
+// FindRefreshToken looks a token up by its hash under each accepted
+// scheme, current one first (auth.Config.RefreshHashCandidates). A hit on
+// an older scheme is rehashed in place so legacy rows drain as they get
+// used.
+func (s *Store) FindRefreshToken(ctx context.Context, cands []auth.VersionedHash) (*RefreshToken, error) {
+	for i, c := range cands {
+		rt, err := s.GetRefreshTokenByHash(ctx, c.Hash)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && rt.HashVersion != c.Version) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			cur := cands[0]
+			_, err := s.pool.Exec(ctx,
+				`UPDATE refresh_tokens SET token_hash = $1, hash_version = $2 WHERE id = $3 AND hash_version = $4`,
+				cur.Hash, cur.Version, rt.ID, c.Version,
+			)
+			if err != nil {
+				return nil, err
+			}
+			rt.TokenHash, rt.HashVersion = cur.Hash, cur.Version
+		}
+		return rt, nil
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// HashVersionCount is one row of the legacy-hash migration report.
+type HashVersionCount struct {
+	Version int
+	Total   int
+	Active  int // not revoked and not expired
+}
+
+func (s *Store) CountRefreshTokensByHashVersion(ctx context.Context) ([]HashVersionCount, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT hash_version, COUNT(*),
+		        COUNT(*) FILTER (WHERE NOT revoked AND expires_at > NOW())
+		 FROM refresh_tokens GROUP BY hash_version ORDER BY hash_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HashVersionCount
+	for rows.Next() {
+		var c HashVersionCount
+		if err := rows.Scan(&c.Version, &c.Total, &c.Active); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// rotate: revoke old token, create new one, link them. pgx.ErrNoRows if
+// the old one was already revoked, so of two concurrent refreshes with the
+// same token only one gets a new one.
+func (s *Store) RotateRefreshToken(ctx context.Context, oldID, newID, userID string, newHash auth.VersionedHash, newExpiry time.Time, client SessionInfo) error {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -47,20 +176,19 @@ func (s *Store) RotateRefreshToken(ctx context.Context, oldID, newID, userID, ne
 	defer tx.Rollback(ctx)
 
 	// revoke old, point to replacement
-	_, err = tx.Exec(ctx,
-		`UPDATE refresh_tokens SET revoked = true, replaced_by = $1 WHERE id = $2`,
+	tag, err := tx.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked = true, replaced_by = $1 WHERE id = $2 AND NOT revoked`,
 		newID, oldID,
 	)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
 
 	// insert new
-	_, err = tx.Exec(ctx,
-		`INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at) VALUES ($1,$2,$3,$4)`,
-		newID, userID, newHash, newExpiry,
-	)
-	if err != nil {
+	if err := s.insertRefreshToken(ctx, tx, newID, userID, newHash, newExpiry, client); err != nil {
 		return err
 	}
 
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+
+	"schedule-management-api/internal/model"
+)
+
+// ClaimDueReminders marks up to limit due reminders sent and returns them for
+// delivery. Claiming and marking are one statement and the rows are taken
+// with SKIP LOCKED, so any number of instances can poll without two of them
+// getting the same reminder. A reminder whose appointment was cancelled or
+// has already started is skipped. Delivery is at most once: a failed send
+// isn't retried.
+func (s *Store) ClaimDueReminders(ctx context.Context, limit int) ([]model.Reminder, error) {
+	rows, err := s.pool.Query(ctx,
+		`WITH claimed AS (
+		   UPDATE reminders SET sent_at = NOW()
+		   WHERE id IN (
+		     SELECT r.id FROM reminders r JOIN appointments a ON a.id = r.appointment_id
+		     WHERE r.sent_at IS NULL AND r.remind_at <= NOW()
+		       AND a.status = 'confirmed' AND a.start_time > NOW()
+		     ORDER BY r.remind_at
+		     LIMIT $1
+		     FOR UPDATE OF r SKIP LOCKED)
+		   RETURNING id, appointment_id, user_id, remind_at)
+		 SELECT c.id, c.user_id, u.email, c.remind_at,
+		        a.id, a.title, a.description, a.start_time, a.end_time,
+		        a.user_id, a.status, a.location, a.created_at, a.updated_at,
+		        `+s.allDayCol("a")+`, `+s.timeZoneCol("a")+`
+		 FROM claimed c
+		 JOIN appointments a ON a.id = c.appointment_id
+		 JOIN users u ON u.id = c.user_id
+		 ORDER BY c.remind_at`, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.Reminder
+	for rows.Next() {
+		var r model.Reminder
+		a := &r.Appointment
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Email, &r.RemindAt,
+			&a.ID, &a.Title, &a.Description, &a.StartTime, &a.EndTime,
+			&a.UserID, &a.Status, &a.Location, &a.CreatedAt, &a.UpdatedAt, &a.AllDay, &a.TimeZone,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// ErrCancelled is returned when a cancelled appointment is rescheduled.
+var ErrCancelled = errors.New("appointment is cancelled")
+
+// rescheduleCountCol selects how often an appointment was rescheduled, 0
+// without the feature.
+func (s *Store) rescheduleCountCol(table string) string {
+	if !s.Has(FeatureReschedules) {
+		return `0`
+	}
+	return table + `.reschedule_count`
+}
+
+// RescheduleAppointment moves ownerID's appointment to start-end, checked
+// for overlaps and against their buffer buf like UpdateAppointment, and
+// records the times it had in its reschedule history, all in one
+// transaction: a conflict leaves neither.
+// actorID is who asked for it (an admin acting for the owner). ErrCancelled
+// for a cancelled appointment; moving it to the times it already has
+// changes nothing.
+func (s *Store) RescheduleAppointment(ctx context.Context, id, ownerID, actorID string, start, end time.Time, buf time.Duration, reason string) (*model.Appointment, error) {
+	if !end.After(start) {
+		return nil, ErrEmptyRange
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := s.lockAppointment(ctx, tx, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if a.Status == "cancelled" {
+		return nil, ErrCancelled
+	}
+	if a.StartTime.Equal(start) && a.EndTime.Equal(end) {
+		return a, nil
+	}
+	if err := s.checkSlot(ctx, tx, ownerID, start, end, a.AllDay, id, buf); err != nil {
+		return nil, err
+	}
+	if a.ResourceID != "" {
+		if err := checkResource(ctx, tx, a.ResourceID, start, end, id); err != nil {
+			return nil, err
+		}
+	}
+
+	before := snapshot(a)
+	oldStart, oldEnd := a.StartTime, a.EndTime
+	a.StartTime, a.EndTime = start, end
+	if err := s.appendAuditFor(ctx, tx, actorID, ownerID, "reschedule", id, before, snapshot(a)); err != nil {
+		return nil, err
+	}
+	if err := s.shiftReminders(ctx, tx, id, ownerID, start); err != nil {
+		return nil, err
+	}
+
+	set := `start_time=$3, end_time=$4, updated_at=NOW()`
+	if s.Has(FeatureReschedules) {
+		set += `, reschedule_count=reschedule_count+1`
+	}
+	err = tx.QueryRow(ctx,
+		`UPDATE appointments SET `+set+`
+		 WHERE id=$1 AND user_id=$2
+		 RETURNING updated_at, `+s.rescheduleCountCol("appointments"),
+		id, ownerID, start, end,
+	).Scan(&a.UpdatedAt, &a.RescheduleCount)
+	if isExclusionViolation(err) {
+		return nil, overlapErr(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Has(FeatureReschedules) {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO appointment_reschedules
+			   (appointment_id, old_start, old_end, new_start, new_end, rescheduled_by, reason)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+			id, oldStart, oldEnd, start, end, nullable(actorID), reason,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RescheduleHistory returns an appointment's reschedules oldest first;
+// none without the feature.
+func (s *Store) RescheduleHistory(ctx context.Context, appointmentID string) ([]model.Reschedule, error) {
+	if !s.Has(FeatureReschedules) {
+		return nil, nil
+	}
+	var out []model.Reschedule
+	err := s.read(ctx, "RescheduleHistory", func() error {
+		rows, err := s.reads.Query(ctx,
+			`SELECT appointment_id, old_start, old_end, new_start, new_end,
+			        COALESCE(rescheduled_by::text, ''), reason, rescheduled_at
+			 FROM appointment_reschedules
+			 WHERE appointment_id = $1
+			 ORDER BY id`, appointmentID,
+		)
+		if err != nil {
+			return err
+		}
+		out, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Reschedule, error) {
+			var r model.Reschedule
+			err := row.Scan(&r.AppointmentID, &r.OldStart, &r.OldEnd, &r.NewStart, &r.NewEnd,
+				&r.RescheduledBy, &r.Reason, &r.RescheduledAt)
+			return r, err
+		})
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"schedule-management-api/internal/model"
+	"schedule-management-api/internal/slots"
+)
+
+var (
+	// ErrUnknownResource is returned when an appointment names a resource
+	// that doesn't exist.
+	ErrUnknownResource = errors.New("resource not found")
+	// ErrResourceBooked is returned when the resource is already held by a
+	// confirmed appointment (anyone's) for an overlapping slot.
+	ErrResourceBooked = errors.New("resource already booked for that time")
+	// ErrResourceExists is returned for a resource name that's taken.
+	ErrResourceExists = errors.New("a resource with that name already exists")
+)
+
+// resourceCol selects an appointment's resource as text, "" for none or
+// without the feature.
+func (s *Store) resourceCol(table string) string {
+	if !s.Has(FeatureResources) {
+		return `''`
+	}
+	return `COALESCE(` + table + `.resource_id::text, '')`
+}
+
+// overlapErr maps an exclusion violation to the error for whichever
+// constraint fired.
+func overlapErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "no_resource_overlap" {
+		return ErrResourceBooked
+	}
+	return ErrConflict
+}
+
+// checkResource returns ErrUnknownResource or ErrResourceBooked if
+// resourceID can't be booked for [start, end) by anything but excludeID.
+// no_resource_overlap catches whatever races past it.
+func checkResource(ctx context.Context, q rowQuerier, resourceID string, start, end time.Time, excludeID string) error {
+	var exists, taken bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM resources WHERE id::text = $1),
+		        EXISTS(SELECT 1 FROM appointments
+		               WHERE resource_id::text = $1 AND status = 'confirmed' AND id::text <> $4
+		                 AND `+rangeExpr+` && tstzrange($2, $3, '[)'))`,
+		resourceID, start, end, excludeID,
+	).Scan(&exists, &taken)
+	switch {
+	case err != nil:
+		return err
+	case !exists:
+		return ErrUnknownResource
+	case taken:
+		return ErrResourceBooked
+	}
+	return nil
+}
+
+// CheckResource is checkResource outside a transaction, for reporting a
+// taken resource before trying the insert.
+func (s *Store) CheckResource(ctx context.Context, resourceID string, start, end time.Time, excludeID string) error {
+	return checkResource(ctx, s.pool, resourceID, start, end, excludeID)
+}
+
+// nullable is v, or NULL for "".
+func nullable(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// CreateResource adds a bookable resource. A taken name fails with
+// ErrResourceExists.
+func (s *Store) CreateResource(ctx context.Context, r *model.Resource) error {
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO resources (name, description) VALUES ($1,$2)
+		 RETURNING id, created_at`,
+		r.Name, r.Description,
+	).Scan(&r.ID, &r.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrResourceExists
+	}
+	return err
+}
+
+// Resources lists every resource by name.
+func (s *Store) Resources(ctx context.Context) ([]model.Resource, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, name, description, created_at FROM resources ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.Resource])
+}
+
+// Resource returns one resource, or ErrUnknownResource.
+func (s *Store) Resource(ctx context.Context, id string) (*model.Resource, error) {
+	r := &model.Resource{}
+	err := s.pool.QueryRow(ctx,
+		`SELECT id, name, description, created_at FROM resources WHERE id::text = $1`, id,
+	).Scan(&r.ID, &r.Name, &r.Description, &r.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownResource
+	}
+	return r, err
+}
+
+// ResourceBusy returns the confirmed bookings of resourceID that overlap
+// w, whole and ordered by start. It says when, not who.
+func (s *Store) ResourceBusy(ctx context.Context, resourceID string, w slots.Interval) ([]slots.Interval, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT start_time, end_time FROM appointments
+		 WHERE resource_id::text = $1 AND status = 'confirmed'
+		   AND `+rangeExpr+` && tstzrange($2, $3, '[)')
+		 ORDER BY start_time`,
+		resourceID, w.Start, w.End,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[slots.Interval])
+}
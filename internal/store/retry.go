@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// reader is the part of the pool the retried reads go through; a test
+// can put a fake in its place.
+type reader interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// RetryConfig is how hard the store retries a read that hit a transient
+// error. Zero fields keep the defaults below.
+type RetryConfig struct {
+	Attempts int           // tries in all, the first included
+	Backoff  time.Duration // upper bound of the first wait, doubled each time
+}
+
+const (
+	defaultReadAttempts = 3
+	defaultReadBackoff  = 25 * time.Millisecond
+	maxReadBackoff      = 500 * time.Millisecond
+
+	// after this many reads in a row ran out of attempts the database is
+	// taken to be down rather than hiccuping, and reads get one try each
+	// until breakerCooldown has passed, so an outage isn't made worse by
+	// every request hammering it three times
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+type retrier struct {
+	cfg     RetryConfig
+	onRetry func(op string)
+
+	mu        sync.Mutex
+	exhausted int // reads in a row that ran out of attempts
+	openUntil time.Time
+}
+
+// SetRetry changes how reads are retried.
+func (s *Store) SetRetry(cfg RetryConfig) {
+	s.retry.cfg = cfg
+}
+
+// OnRetry registers fn to be called with the operation's name (e.g.
+// "GetAppointment") before every retry. Call it before serving.
+func (s *Store) OnRetry(fn func(op string)) {
+	s.retry.onRetry = fn
+}
+
+// read runs fn, again after a jittered backoff while it fails with an
+// error worth retrying and ctx leaves time for it. Only reads go through
+// here: a write that failed part way may have committed, and running it
+// twice isn't safe unless it's its own transaction written to be re-run.
+// fn must start from scratch each time.
+func (s *Store) read(ctx context.Context, op string, fn func() error) error {
+	r := &s.retry
+	attempts := r.cfg.Attempts
+	if attempts <= 0 {
+		attempts = defaultReadAttempts
+	}
+	backoff := r.cfg.Backoff
+	if backoff <= 0 {
+		backoff = defaultReadBackoff
+	}
+	if r.open() {
+		attempts = 1
+	}
+	for i := 1; ; i++ {
+		err := fn()
+		if err == nil || !retryable(err) {
+			r.settle(false)
+			return err
+		}
+		if i >= attempts {
+			r.settle(attempts > 1)
+			return err
+		}
+		wait := rand.N(backoff) + 1
+		if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+			return err
+		}
+		if r.onRetry != nil {
+			r.onRetry(op)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff = min(backoff*2, maxReadBackoff)
+	}
+}
+
+func (r *retrier) open() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().Before(r.openUntil)
+}
+
+// settle records how a read ended: exhausted if it used up its retries.
+func (r *retrier) settle(exhausted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !exhausted {
+		r.exhausted = 0
+		return
+	}
+	r.exhausted++
+	if r.exhausted >= breakerThreshold {
+		r.openUntil = time.Now().Add(breakerCooldown)
+		r.exhausted = 0
+	}
+}
+
+// retryable reports whether err is the kind a second try could get past:
+// a serialization failure or deadlock, the server going away (failover,
+// restart) or the connection dropping. The caller's own deadline or
+// cancellation never is.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", // serialization_failure, deadlock_detected
+			"57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08") // connection exceptions
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
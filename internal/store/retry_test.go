@@ -0,0 +1,120 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"schedule-management-api/internal/store"
+)
+
+// flakyDB fails the first `fail` reads with err, then finds an overlap.
+type flakyDB struct {
+	fail  int
+	err   error
+	calls int
+}
+
+func (f *flakyDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("not used")
+}
+
+func (f *flakyDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.calls++
+	if f.calls <= f.fail {
+		return row{err: f.err}
+	}
+	return row{}
+}
+
+type row struct{ err error }
+
+func (r row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*bool) = true
+	return nil
+}
+
+func TestReadRetries(t *testing.T) {
+	serialization := &pgconn.PgError{Code: "40001"}
+	start := time.Now()
+	end := start.Add(time.Hour)
+
+	for _, tc := range []struct {
+		name      string
+		fail      int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"serialization failure", 2, serialization, 3, false},
+		{"connection dropped", 2, &pgconn.PgError{Code: "08006"}, 3, false},
+		{"failover", 1, &pgconn.PgError{Code: "57P01"}, 2, false},
+		{"out of attempts", 3, serialization, 3, true},
+		{"unique violation", 2, &pgconn.PgError{Code: "23505"}, 1, true},
+		{"no rows", 1, pgx.ErrNoRows, 1, true},
+		{"caller gave up", 2, context.Canceled, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &flakyDB{fail: tc.fail, err: tc.err}
+			st := store.NewWithReader(db)
+			st.SetRetry(store.RetryConfig{Attempts: 3, Backoff: time.Millisecond})
+			var retried []string
+			st.OnRetry(func(op string) { retried = append(retried, op) })
+
+			ok, err := st.HasOverlap(context.Background(), "u", start, end, false, "")
+			if (err != nil) != tc.wantErr || (err == nil && !ok) {
+				t.Errorf("got %v, %v", ok, err)
+			}
+			if db.calls != tc.wantCalls {
+				t.Errorf("%d calls, want %d", db.calls, tc.wantCalls)
+			}
+			if len(retried) != tc.wantCalls-1 || (len(retried) > 0 && retried[0] != "HasOverlap") {
+				t.Errorf("retries reported: %v", retried)
+			}
+		})
+	}
+}
+
+func TestReadRetryRespectsDeadline(t *testing.T) {
+	db := &flakyDB{fail: 10, err: &pgconn.PgError{Code: "40001"}}
+	st := store.NewWithReader(db)
+	st.SetRetry(store.RetryConfig{Attempts: 10, Backoff: time.Second})
+
+	// too little time left for even the first wait
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if _, err := st.HasOverlap(ctx, "u", begin, begin.Add(time.Hour), false, ""); err == nil {
+		t.Fatal("expected an error")
+	}
+	if took := time.Since(begin); took > 500*time.Millisecond {
+		t.Errorf("waited %s past the deadline", took)
+	}
+}
+
+func TestReadRetryBreaker(t *testing.T) {
+	db := &flakyDB{fail: 1000, err: &pgconn.PgError{Code: "08006"}}
+	st := store.NewWithReader(db)
+	st.SetRetry(store.RetryConfig{Attempts: 2, Backoff: time.Millisecond})
+	now := time.Now()
+
+	// reads that keep running out of attempts trip it; after that each
+	// read gets one try
+	for range 5 {
+		st.HasOverlap(context.Background(), "u", now, now.Add(time.Hour), false, "")
+	}
+	if db.calls != 10 {
+		t.Fatalf("%d calls before tripping, want 10", db.calls)
+	}
+	st.HasOverlap(context.Background(), "u", now, now.Add(time.Hour), false, "")
+	if db.calls != 11 {
+		t.Errorf("%d calls, want a single try once tripped", db.calls)
+	}
+}
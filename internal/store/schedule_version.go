@@ -0,0 +1,23 @@
+package store
+
+import "context"
+
+// BumpScheduleVersion moves userID's schedule version on by one after a
+// write to their appointments and returns the new value. Returns
+// pgx.ErrNoRows for an unknown user.
+func (s *Store) BumpScheduleVersion(ctx context.Context, userID string) (int64, error) {
+	var v int64
+	err := s.pool.QueryRow(ctx,
+		`UPDATE users SET schedule_version = schedule_version + 1 WHERE id = $1 RETURNING schedule_version`,
+		userID,
+	).Scan(&v)
+	return v, err
+}
+
+// ScheduleVersion returns userID's schedule version, 0 for a user whose
+// appointments were never written.
+func (s *Store) ScheduleVersion(ctx context.Context, userID string) (int64, error) {
+	var v int64
+	err := s.pool.QueryRow(ctx, `SELECT schedule_version FROM users WHERE id = $1`, userID).Scan(&v)
+	return v, err
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Helpers for schema changes on big tables that have to run while the API
+// is serving traffic. Each one avoids holding a heavy lock for longer than a
+// single short statement:
+//
+//   - CreateIndexConcurrently can't run inside a transaction, so migrations
+//     using it must not be wrapped in one
+//   - Backfill updates in small batches, each its own transaction, and is
+//     resumable because the where clause only matches unfinished rows
+//   - AddConstraintNotValid + ValidateConstraint split the table scan off
+//     from the ACCESS EXCLUSIVE lock
+//
+// DDL that needs a strong lock is run with lock_timeout so it fails fast
+// instead of queueing behind a long transaction and blocking everyone else.
+
+// how long DDL waits for its lock before giving up
+const ddlLockTimeout = 5 * time.Second
+
+const defaultBackfillBatch = 1000
+
+// CreateIndexConcurrently builds an index without blocking writes. A failed
+// concurrent build leaves an INVALID index behind, so one of those with the
+// same name is dropped and rebuilt rather than silently skipped by IF NOT
+// EXISTS.
+func (s *Store) CreateIndexConcurrently(ctx context.Context, name, table, columns string) error {
+	var valid bool
+	err := s.pool.QueryRow(ctx,
+		`SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		 WHERE c.relname = $1`, name,
+	).Scan(&valid)
+	switch {
+	case err == nil && valid:
+		return nil
+	case err == nil:
+		log.Printf("index %s is invalid from an earlier attempt, rebuilding", name)
+		if _, err := s.pool.Exec(ctx, `DROP INDEX CONCURRENTLY IF EXISTS `+ident(name)); err != nil {
+			return fmt.Errorf("drop invalid index %s: %w", name, err)
+		}
+	case err != pgx.ErrNoRows:
+		return err
+	}
+
+	_, err = s.pool.Exec(ctx, fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s (%s)`,
+		ident(name), ident(table), columns))
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", name, err)
+	}
+	return nil
+}
+
+// Backfill describes a batched UPDATE. Where must stop matching a row once
+// Set has been applied to it, that's what makes a restart pick up where the
+// last run stopped.
+type Backfill struct {
+	Table     string
+	Set       string // e.g. "status_v2 = status::appointment_status"
+	Where     string // e.g. "status_v2 IS NULL"
+	BatchSize int
+	Pause     time.Duration // between batches, to let replicas and autovacuum keep up
+}
+
+// Backfill runs b until no rows match and returns how many were updated.
+// Rows locked by someone else are skipped and picked up by a later batch.
+func (s *Store) Backfill(ctx context.Context, b Backfill) (int64, error) {
+	if b.BatchSize <= 0 {
+		b.BatchSize = defaultBackfillBatch
+	}
+	var remaining int64
+	if err := s.pool.QueryRow(ctx,
+		fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, ident(b.Table), b.Where),
+	).Scan(&remaining); err != nil {
+		return 0, err
+	}
+	log.Printf("backfill %s: %d rows to go", b.Table, remaining)
+
+	q := fmt.Sprintf(
+		`UPDATE %[1]s SET %[2]s WHERE id IN (
+		   SELECT id FROM %[1]s WHERE %[3]s LIMIT %[4]d FOR UPDATE SKIP LOCKED)`,
+		ident(b.Table), b.Set, b.Where, b.BatchSize)
+
+	var done int64
+	started, lastLog := time.Now(), time.Now()
+	for {
+		tag, err := s.pool.Exec(ctx, q)
+		if err != nil {
+			return done, fmt.Errorf("backfill %s after %d rows: %w", b.Table, done, err)
+		}
+		n := tag.RowsAffected()
+		done += n
+
+		if n == 0 {
+			// nothing updated can also mean every remaining row was locked
+			var left int64
+			if err := s.pool.QueryRow(ctx,
+				fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, ident(b.Table), b.Where),
+			).Scan(&left); err != nil {
+				return done, err
+			}
+			if left == 0 {
+				break
+			}
+		}
+		if time.Since(lastLog) > 5*time.Second {
+			log.Printf("backfill %s: %d/%d rows", b.Table, done, remaining)
+			lastLog = time.Now()
+		}
+
+		pause := b.Pause
+		if n == 0 && pause < 100*time.Millisecond {
+			pause = 100 * time.Millisecond
+		}
+		if pause > 0 {
+			select {
+			case <-ctx.Done():
+				return done, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+	log.Printf("backfill %s: done, %d rows in %s", b.Table, done, time.Since(started).Round(time.Millisecond))
+	return done, nil
+}
+
+// AddConstraintNotValid adds a CHECK or FOREIGN KEY constraint without
+// scanning existing rows. New writes are checked straight away; follow up
+// with ValidateConstraint.
+func (s *Store) AddConstraintNotValid(ctx context.Context, table, name, def string) error {
+	var exists bool
+	if err := s.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = $1 AND conrelid = $2::regclass)`,
+		name, table,
+	).Scan(&exists); err != nil || exists {
+		return err
+	}
+	return s.withLockTimeout(ctx, fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s %s NOT VALID`,
+		ident(table), ident(name), def))
+}
+
+// ValidateConstraint scans the table under SHARE UPDATE EXCLUSIVE, which
+// doesn't block reads or writes.
+func (s *Store) ValidateConstraint(ctx context.Context, table, name string) error {
+	return s.withLockTimeout(ctx, fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %s`,
+		ident(table), ident(name)))
+}
+
+func (s *Store) withLockTimeout(ctx context.Context, sql string) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`SET LOCAL lock_timeout = '%dms'`, ddlLockTimeout.Milliseconds())); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql)
+		return err
+	})
+}
+
+func ident(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
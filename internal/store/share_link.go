@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+func (s *Store) CreateShareLink(ctx context.Context, l *model.ShareLink) error {
+	return s.pool.QueryRow(ctx,
+		`INSERT INTO share_links (id, appointment_id, token_hash, include_description, include_attendees, expires_at)
+		 VALUES ($1,$2,$3,$4,$5,$6) RETURNING created_at`,
+		l.ID, l.AppointmentID, l.TokenHash, l.IncludeDescription, l.IncludeAttendees, l.ExpiresAt,
+	).Scan(&l.CreatedAt)
+}
+
+// ActiveShareLink finds an unrevoked, unexpired link by token hash.
+func (s *Store) ActiveShareLink(ctx context.Context, tokenHash string) (*model.ShareLink, error) {
+	l := &model.ShareLink{TokenHash: tokenHash}
+	err := s.pool.QueryRow(ctx,
+		`SELECT id, appointment_id, include_description, include_attendees, expires_at, created_at
+		 FROM share_links
+		 WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()`, tokenHash,
+	).Scan(&l.ID, &l.AppointmentID, &l.IncludeDescription, &l.IncludeAttendees, &l.ExpiresAt, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// RevokeShareLink only touches links on the user's own appointments.
+// Returns pgx.ErrNoRows when there's nothing of theirs to revoke.
+func (s *Store) RevokeShareLink(ctx context.Context, id, userID string) error {
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE share_links l SET revoked_at = NOW()
+		 FROM appointments a
+		 WHERE l.id = $1 AND a.id = l.appointment_id AND a.user_id = $2 AND l.revoked_at IS NULL`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import "context"
+
+// Stats is how much the service is used, for GetSystemStats.
+type Stats struct {
+	Users          int64 // not deleted
+	DeletedUsers   int64 // soft-deleted, not yet purged
+	Confirmed      int64
+	Cancelled      int64
+	CreatedLastDay int64 // appointments of any status created in the last 24h
+	RefreshTokens  int64 // neither revoked nor expired
+}
+
+// Stats counts everything in one round trip. Every count is a full scan
+// or close to it; fine for an operator poking at it, not for a dashboard
+// polling every second.
+func (s *Store) Stats(ctx context.Context) (*Stats, error) {
+	deleted := `(SELECT count(*) FROM users WHERE deleted_at IS NOT NULL)`
+	live := ` WHERE deleted_at IS NULL`
+	if !s.Has(FeatureAccountDeletion) {
+		deleted, live = `0::bigint`, ``
+	}
+	st := &Stats{}
+	err := s.pool.QueryRow(ctx,
+		`SELECT
+		   (SELECT count(*) FROM users`+live+`),
+		   `+deleted+`,
+		   (SELECT count(*) FROM appointments WHERE status = 'confirmed'),
+		   (SELECT count(*) FROM appointments WHERE status = 'cancelled'),
+		   (SELECT count(*) FROM appointments WHERE created_at > NOW() - interval '24 hours'),
+		   (SELECT count(*) FROM refresh_tokens WHERE NOT revoked AND expires_at > NOW())`,
+	).Scan(&st.Users, &st.DeletedUsers, &st.Confirmed, &st.Cancelled, &st.CreatedLastDay, &st.RefreshTokens)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
@@ -3,9 +3,23 @@ package store
 import "github.com/jackc/pgx/v5/pgxpool"
 
 type Store struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	reads reader       // the pool, for the reads in read()
+	caps  Capabilities // nil until DetectCapabilities runs
+	retry retrier
+
+	events          bool // write appointment changes to outbox_events
+	allDayConflicts bool // all-day events on the same days conflict
 }
 
 func New(pool *pgxpool.Pool) *Store {
-	return &Store{pool: pool}
+	return &Store{pool: pool, reads: pool}
+}
+
+// Stat is the pool's counters; nil without a pool.
+func (s *Store) Stat() *pgxpool.Stat {
+	if s == nil || s.pool == nil {
+		return nil
+	}
+	return s.pool.Stat()
 }
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SummaryBucket is one day or week of a schedule summary. Booked is the
+// confirmed time inside both the bucket and the summarised range.
+type SummaryBucket struct {
+	Start, End   time.Time
+	Appointments int
+	Booked       time.Duration
+}
+
+// ScheduleSummary counts userID's confirmed appointments in [from, to) per
+// unit ("day" or "week"), cut in the IANA zone tz. Buckets are computed
+// in local time so a DST day is 23 or 25 hours. An appointment counts in
+// every bucket it overlaps, with its time split at the boundaries; the
+// totals count it once.
+func (s *Store) ScheduleSummary(ctx context.Context, userID string, from, to time.Time, unit, tz string) ([]SummaryBucket, int, time.Duration, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT b.start_time, b.end_time, count(a.id),
+		        COALESCE(sum(EXTRACT(EPOCH FROM
+		          LEAST(a.end_time, b.end_time, $3) - GREATEST(a.start_time, b.start_time, $2))), 0)::float8
+		 FROM (
+		   SELECT l AT TIME ZONE $5 AS start_time, (l + ('1 ' || $4)::interval) AT TIME ZONE $5 AS end_time
+		   FROM generate_series(date_trunc($4, $2::timestamptz AT TIME ZONE $5),
+		                        $3::timestamptz AT TIME ZONE $5, ('1 ' || $4)::interval) l
+		   WHERE l < $3::timestamptz AT TIME ZONE $5
+		 ) b
+		 LEFT JOIN appointments a
+		   ON a.user_id = $1 AND a.status = 'confirmed'
+		  AND a.start_time < LEAST(b.end_time, $3) AND a.end_time > GREATEST(b.start_time, $2)
+		 GROUP BY b.start_time, b.end_time
+		 ORDER BY b.start_time`,
+		userID, from, to, unit, tz,
+	)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	buckets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SummaryBucket, error) {
+		var b SummaryBucket
+		var secs float64
+		err := row.Scan(&b.Start, &b.End, &b.Appointments, &secs)
+		b.Booked = time.Duration(secs * float64(time.Second))
+		return b, err
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var total int
+	var secs float64
+	err = s.pool.QueryRow(ctx,
+		`SELECT count(*), COALESCE(sum(EXTRACT(EPOCH FROM LEAST(end_time, $3) - GREATEST(start_time, $2))), 0)::float8
+		 FROM appointments
+		 WHERE user_id = $1 AND status = 'confirmed' AND start_time < $3 AND end_time > $2`,
+		userID, from, to,
+	).Scan(&total, &secs)
+	return buckets, total, time.Duration(secs * float64(time.Second)), err
+}
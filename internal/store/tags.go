@@ -0,0 +1,18 @@
+package store
+
+// tagsCol selects an appointment's tags, empty without the feature.
+func (s *Store) tagsCol(table string) string {
+	if !s.Has(FeatureTags) {
+		return `'{}'::text[]`
+	}
+	return table + `.tags`
+}
+
+// tagsArg is tags as a value for the NOT NULL column: pgx sends a nil
+// slice as NULL.
+func tagsArg(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"schedule-management-api/internal/tracing"
+)
+
+// QueryTracer returns a pgx tracer that puts each statement in a child
+// span of the caller's, named after the Store method that ran it (e.g.
+// "store.CreateAppointment") and carrying the SQL operation and the rows
+// it returned or changed. Connect installs it; a pool made some other way
+// needs it set on its ConnConfig.Tracer. With the no-op provider it costs
+// next to nothing.
+func QueryTracer() pgx.QueryTracer { return queryTracer{} }
+
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	// nothing to hang a span on: no trace is being recorded
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+	ctx, _ = tracing.Tracer().Start(ctx, "store."+storeMethod(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", sqlOperation(data.SQL)),
+			attribute.String("db.statement", data.SQL),
+		))
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(attribute.Int64("db.rows", data.CommandTag.RowsAffected()))
+	if data.Err != nil && data.Err != pgx.ErrNoRows {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	span.End()
+}
+
+// storeMethod is the outermost exported Store method on the stack, e.g.
+// "CreateAppointment" for a statement run by a helper it called.
+func storeMethod() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	name := "query"
+	for {
+		f, more := frames.Next()
+		const prefix = "schedule-management-api/internal/store.(*Store)."
+		if m, ok := strings.CutPrefix(f.Function, prefix); ok && m != "" && m[0] >= 'A' && m[0] <= 'Z' {
+			name, _, _ = strings.Cut(m, ".") // drop ".func1" of a closure
+		}
+		if !more {
+			return name
+		}
+	}
+}
+
+// sqlOperation is the statement's first keyword, upper-cased: SELECT,
+// INSERT, UPDATE, WITH...
+func sqlOperation(sql string) string {
+	f := strings.Fields(sql)
+	if len(f) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(f[0], "(;"))
+}
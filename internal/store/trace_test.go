@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"schedule-management-api/internal/store"
+)
+
+// tracedDB calls the query tracer around each read the way a pgx
+// connection would.
+type tracedDB struct{ flakyDB }
+
+func (d *tracedDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	qt := store.QueryTracer()
+	ctx = qt.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql, Args: args})
+	r := d.flakyDB.QueryRow(ctx, sql, args...)
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	return r
+}
+
+func TestQueryTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	st := store.NewWithReader(&tracedDB{})
+	start := time.Now()
+
+	// outside a trace nothing is recorded
+	st.HasOverlap(context.Background(), "u", start, start.Add(time.Hour), false, "")
+	if n := len(rec.Ended()); n != 0 {
+		t.Fatalf("%d spans without a parent", n)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "rpc")
+	st.HasOverlap(ctx, "u", start, start.Add(time.Hour), false, "")
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the query's and the parent", len(spans))
+	}
+	q := spans[0]
+	if q.Name() != "store.HasOverlap" || q.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %q under %s", q.Name(), q.Parent().SpanID())
+	}
+	attrs := attribute.NewSet(q.Attributes()...)
+	if v, _ := attrs.Value("db.operation"); v.AsString() != "SELECT" {
+		t.Errorf("db.operation %q", v.AsString())
+	}
+	if v, _ := attrs.Value("db.rows"); v.AsInt64() != 1 {
+		t.Errorf("db.rows %d", v.AsInt64())
+	}
+}
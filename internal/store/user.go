@@ -2,7 +2,12 @@ package store
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/auth"
 	"schedule-management-api/internal/model"
 )
 
@@ -14,14 +19,270 @@ func (s *Store) CreateUser(ctx context.Context, u *model.User) error {
 	return err
 }
 
+// UserByEmail also returns soft-deleted users so login can tell them apart
+// from bad credentials; check DeletedAt.
 func (s *Store) UserByEmail(ctx context.Context, email string) (*model.User, error) {
+	deletedAt := "deleted_at"
+	if !s.Has(FeatureAccountDeletion) {
+		deletedAt = "NULL::timestamptz"
+	}
+	u := &model.User{}
+	err := s.read(ctx, "UserByEmail", func() error {
+		return s.reads.QueryRow(ctx,
+			`SELECT id, email, password_hash, name, `+s.roleCol()+`, `+s.verifiedCol()+`, created_at, updated_at, `+deletedAt+`
+			 FROM users WHERE email = $1`, email,
+		).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.Role, &u.Verified, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *Store) UserByID(ctx context.Context, id string) (*model.User, error) {
+	live := " AND deleted_at IS NULL"
+	if !s.Has(FeatureAccountDeletion) {
+		live = ""
+	}
 	u := &model.User{}
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, email, password_hash, name, created_at, updated_at
-		 FROM users WHERE email = $1`, email,
-	).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.CreatedAt, &u.UpdatedAt)
+		`SELECT id, email, password_hash, name, `+s.roleCol()+`, `+s.verifiedCol()+`, created_at, updated_at, `+s.orgCol("users")+`
+		 FROM users WHERE id = $1`+live, id,
+	).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Name, &u.Role, &u.Verified, &u.CreatedAt, &u.UpdatedAt, &u.OrgID)
 	if err != nil {
 		return nil, err
 	}
 	return u, nil
 }
+
+// UsersByIDs looks up live users by ID in one query, for putting names
+// next to IDs. IDs that aren't a live user are left out of the map.
+func (s *Store) UsersByIDs(ctx context.Context, ids []string) (map[string]model.User, error) {
+	out := map[string]model.User{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	live := " AND deleted_at IS NULL"
+	if !s.Has(FeatureAccountDeletion) {
+		live = ""
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, email, name, `+s.roleCol()+`, created_at, updated_at
+		 FROM users WHERE id = ANY($1::uuid[])`+live, ids)
+	if err != nil {
+		return nil, err
+	}
+	users, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (model.User, error) {
+		var u model.User
+		err := r.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+		return u, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		out[u.ID] = u
+	}
+	return out, nil
+}
+
+// everyone is a plain user until the role column exists
+func (s *Store) roleCol() string {
+	if s.Has(FeatureRoles) {
+		return "role"
+	}
+	return "'" + auth.RoleUser + "'"
+}
+
+// without verification there's nothing to confirm, so everyone counts
+func (s *Store) verifiedCol() string {
+	if s.Has(FeatureEmailVerify) {
+		return "email_verified"
+	}
+	return "TRUE"
+}
+
+// ErrUnknownRole is returned by SetUserRole for anything but auth.RoleUser
+// and auth.RoleAdmin.
+var ErrUnknownRole = errors.New("unknown role")
+
+// SetUserRole promotes or demotes a live user. Returns pgx.ErrNoRows if
+// there's no such user.
+func (s *Store) SetUserRole(ctx context.Context, userID, role string) error {
+	if role != auth.RoleUser && role != auth.RoleAdmin {
+		return ErrUnknownRole
+	}
+	live := " AND deleted_at IS NULL"
+	if !s.Has(FeatureAccountDeletion) {
+		live = ""
+	}
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2`+live, role, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// ListUsers pages through live users by email, starting after afterEmail.
+func (s *Store) ListUsers(ctx context.Context, afterEmail string, limit int) ([]model.User, error) {
+	live := " AND deleted_at IS NULL"
+	if !s.Has(FeatureAccountDeletion) {
+		live = ""
+	}
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, email, name, `+s.roleCol()+`, created_at, updated_at
+		 FROM users WHERE email > $1`+live+`
+		 ORDER BY email LIMIT $2`, afterEmail, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (model.User, error) {
+		var u model.User
+		err := r.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+		return u, err
+	})
+}
+
+func (s *Store) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`,
+		passwordHash, userID,
+	)
+	return err
+}
+
+// UpdateUser writes the editable profile fields (just name today).
+func (s *Store) UpdateUser(ctx context.Context, u *model.User) error {
+	return s.pool.QueryRow(ctx,
+		`UPDATE users SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`,
+		u.Name, u.ID,
+	).Scan(&u.UpdatedAt)
+}
+
+// SoftDeleteUser marks the account deleted and, in the same transaction,
+// cancels its future confirmed appointments, drops it from other people's
+// attendee lists and revokes every refresh and reset token. Returns
+// pgx.ErrNoRows if the user doesn't exist or is already deleted.
+func (s *Store) SoftDeleteUser(ctx context.Context, userID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// out of their organization first, handing it over like a leave
+	// would, so a deleted owner doesn't leave it ownerless; the
+	// organization lock comes before the user row's, as in a leave
+	if s.Has(FeatureOrganizations) {
+		var orgID string
+		err := tx.QueryRow(ctx, `SELECT org_id FROM organization_members WHERE user_id = $1`, userID).Scan(&orgID)
+		if err == nil {
+			err = s.leaveOrg(ctx, tx, orgID, userID)
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE users SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	if s.Has(FeatureAppointmentAudit) {
+		if err := s.auditBulkCancel(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+
+	stmts := []string{
+		`UPDATE appointments SET status = 'cancelled', updated_at = NOW()
+		 WHERE user_id = $1 AND status = 'confirmed' AND start_time > NOW()`,
+		`UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND revoked = false`,
+	}
+	if s.Has(FeatureAttendees) {
+		stmts = append(stmts, `DELETE FROM appointment_attendees WHERE user_id = $1`)
+	}
+	if s.Has(FeaturePasswordReset) {
+		stmts = append(stmts, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`)
+	}
+	if s.Has(FeatureReminders) {
+		stmts = append(stmts, `DELETE FROM reminders WHERE user_id = $1 AND sent_at IS NULL`)
+	}
+	for _, q := range stmts {
+		if _, err := tx.Exec(ctx, q, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// auditBulkCancel writes a cancel entry for each appointment SoftDeleteUser
+// is about to cancel.
+func (s *Store) auditBulkCancel(ctx context.Context, tx pgx.Tx, userID string) error {
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM appointments
+		 WHERE user_id = $1 AND status = 'confirmed' AND start_time > NOW()`, userID)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		a, err := s.lockAppointment(ctx, tx, id, userID)
+		if err != nil {
+			return err
+		}
+		before := snapshot(a)
+		after := *before
+		after.Status = "cancelled"
+		if err := s.appendAudit(ctx, tx, userID, "cancel", id, before, &after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeDeletedUsers hard-deletes accounts soft-deleted more than retention
+// ago. Appointments, tokens and attendee rows go with them; attendee rows
+// are removed explicitly first so the purge doesn't depend on the FK
+// cascades being present. Meant to be run from cron via cmd/admin.
+func (s *Store) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM appointment_attendees
+		 WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)
+		    OR appointment_id IN (
+		        SELECT a.id FROM appointments a JOIN users u ON u.id = a.user_id
+		        WHERE u.deleted_at < $1)`,
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
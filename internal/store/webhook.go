@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"schedule-management-api/internal/model"
+)
+
+// ErrWebhookLimit is returned by CreateWebhook when the user already has
+// the most webhooks allowed.
+var ErrWebhookLimit = errors.New("too many webhooks")
+
+// Webhook event types, one per appointment_audit action (an update that
+// moves the appointment is a reschedule).
+const (
+	EventCreated     = "appointment.created"
+	EventUpdated     = "appointment.updated"
+	EventRescheduled = "appointment.rescheduled"
+	EventCancelled   = "appointment.cancelled"
+	EventRestored    = "appointment.restored"
+)
+
+// WebhookPayload is the JSON body of a delivery. Previous is the
+// appointment before an update, reschedule, join or leave.
+type WebhookPayload struct {
+	Event         string         `json:"event"`
+	OccurredAt    time.Time      `json:"occurred_at"`
+	AppointmentID string         `json:"appointment_id"`
+	Appointment   *AuditSnapshot `json:"appointment"`
+	Previous      *AuditSnapshot `json:"previous,omitempty"`
+}
+
+func webhookEvent(action string, before, after *AuditSnapshot) string {
+	switch action {
+	case "create":
+		return EventCreated
+	case "cancel":
+		return EventCancelled
+	case "restore":
+		return EventRestored
+	}
+	if before != nil && (!before.StartTime.Equal(after.StartTime) || !before.EndTime.Equal(after.EndTime)) {
+		return EventRescheduled
+	}
+	return EventUpdated
+}
+
+// changePayload describes a change the way webhooks and the events
+// outbox both carry it.
+func changePayload(action, appointmentID string, before, after *AuditSnapshot) WebhookPayload {
+	p := WebhookPayload{
+		Event:         webhookEvent(action, before, after),
+		OccurredAt:    time.Now().UTC(),
+		AppointmentID: appointmentID,
+		Appointment:   after,
+	}
+	switch action {
+	case "update", "reschedule", "join", "leave":
+		p.Previous = before
+	}
+	return p
+}
+
+// enqueueWebhooks writes an outbox row for each of the user's enabled
+// webhooks; the dispatcher sends them once tx commits.
+func (s *Store) enqueueWebhooks(ctx context.Context, tx pgx.Tx, userID, event string, body []byte) error {
+	if !s.Has(FeatureWebhooks) {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		 SELECT id, $2, $3 FROM webhooks WHERE user_id = $1 AND enabled`,
+		userID, event, body,
+	)
+	return err
+}
+
+const webhookCols = `id, user_id, url, secret, enabled, created_at,
+	last_attempt_at, COALESCE(last_status, 0), last_error, last_success_at`
+
+// CreateWebhook registers w unless its user already has max webhooks
+// (ErrWebhookLimit).
+func (s *Store) CreateWebhook(ctx context.Context, w *model.Webhook, max int) error {
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO webhooks (user_id, url, secret)
+		 SELECT $1, $2, $3
+		 WHERE (SELECT count(*) FROM webhooks WHERE user_id = $1) < $4
+		 RETURNING `+webhookCols,
+		w.UserID, w.URL, w.Secret, max,
+	).Scan(webhookDest(w)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWebhookLimit
+	}
+	return err
+}
+
+// Webhooks lists the user's webhooks, oldest first.
+func (s *Store) Webhooks(ctx context.Context, userID string) ([]model.Webhook, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT `+webhookCols+` FROM webhooks WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Webhook, error) {
+		var w model.Webhook
+		err := row.Scan(webhookDest(&w)...)
+		return w, err
+	})
+}
+
+// SetWebhookEnabled switches one of the user's webhooks on or off.
+// Returns pgx.ErrNoRows when it isn't theirs.
+func (s *Store) SetWebhookEnabled(ctx context.Context, id, userID string, enabled bool) (*model.Webhook, error) {
+	w := &model.Webhook{}
+	err := s.pool.QueryRow(ctx,
+		`UPDATE webhooks SET enabled = $3 WHERE id::text = $1 AND user_id = $2
+		 RETURNING `+webhookCols,
+		id, userID, enabled,
+	).Scan(webhookDest(w)...)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks and anything still
+// queued for it. Returns pgx.ErrNoRows when it isn't theirs.
+func (s *Store) DeleteWebhook(ctx context.Context, id, userID string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM webhooks WHERE id::text = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func webhookDest(w *model.Webhook) []any {
+	return []any{&w.ID, &w.UserID, &w.URL, &w.Secret, &w.Enabled, &w.CreatedAt,
+		&w.LastAttemptAt, &w.LastStatus, &w.LastError, &w.LastSuccessAt}
+}
+
+// ClaimWebhookDeliveries hands out up to limit due deliveries, oldest
+// first, counting an attempt on each. Like ClaimDueReminders the rows are
+// taken with SKIP LOCKED so instances don't share them; a claimed row is
+// pushed lease into the future, so if the claimer dies before reporting
+// back it's simply tried again then. Rows for disabled webhooks wait.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx,
+		`WITH claimed AS (
+		   UPDATE webhook_deliveries
+		   SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		   WHERE id IN (
+		     SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		     WHERE d.delivered_at IS NULL AND d.failed_at IS NULL
+		       AND d.next_attempt_at <= NOW() AND w.enabled
+		     ORDER BY d.next_attempt_at, d.id
+		     LIMIT $1
+		     FOR UPDATE OF d SKIP LOCKED)
+		   RETURNING id, webhook_id, event, payload, attempts)
+		 SELECT c.id, c.webhook_id, w.url, w.secret, c.event, c.payload, c.attempts
+		 FROM claimed c JOIN webhooks w ON w.id = c.webhook_id
+		 ORDER BY c.id`, limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[model.WebhookDelivery])
+}
+
+// WebhookDelivered marks a delivery done after a 2xx response.
+func (s *Store) WebhookDelivered(ctx context.Context, id int64, status int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var webhookID string
+	err = tx.QueryRow(ctx,
+		`UPDATE webhook_deliveries SET delivered_at = NOW(), last_error = ''
+		 WHERE id = $1 RETURNING webhook_id`, id,
+	).Scan(&webhookID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE webhooks
+		 SET last_attempt_at = NOW(), last_status = $2, last_error = '', last_success_at = NOW()
+		 WHERE id = $1`, webhookID, status,
+	)
+	if err != nil {
+		return err
+	}
+	return commit(ctx, tx)
+}
+
+// WebhookFailed records a failed attempt: status is the response's (0 for
+// none), retryAt when to try again, or nil to give up on the delivery.
+func (s *Store) WebhookFailed(ctx context.Context, id int64, status int, msg string, retryAt *time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var webhookID string
+	err = tx.QueryRow(ctx,
+		`UPDATE webhook_deliveries
+		 SET last_error = $2,
+		     next_attempt_at = COALESCE($3::timestamptz, next_attempt_at),
+		     failed_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() END
+		 WHERE id = $1 RETURNING webhook_id`, id, msg, retryAt,
+	).Scan(&webhookID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE webhooks SET last_attempt_at = NOW(), last_status = NULLIF($2, 0), last_error = $3
+		 WHERE id = $1`, webhookID, status, msg,
+	)
+	if err != nil {
+		return err
+	}
+	return commit(ctx, tx)
+}
@@ -0,0 +1,144 @@
+// Package tracing sets up OpenTelemetry: an OTLP exporter configured by
+// the standard OTEL_* environment variables, W3C trace context
+// propagation, and a span per RPC. Without an OTLP endpoint the global
+// provider stays the no-op one, so nothing is recorded or sent.
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Name is the instrumentation scope every span here is created under.
+const Name = "schedule-management-api"
+
+// Tracer is the global provider's tracer for Name. It's looked up on each
+// call so a provider set later (or by a test) takes effect.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Setup installs the trace context propagator and, when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set
+// and OTEL_SDK_DISABLED isn't "true", a provider batching spans to that
+// OTLP/gRPC endpoint. The exporter reads the rest of its settings
+// (headers, TLS, timeout) from the standard variables; OTEL_SERVICE_NAME
+// and OTEL_RESOURCE_ATTRIBUTES override the resource. shutdown flushes
+// what's buffered and is a no-op when nothing was installed.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	noop := func(context.Context) error { return nil }
+	if !Enabled() {
+		return noop, nil
+	}
+	exp, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", Name)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Enabled reports whether the environment asks for spans to be exported.
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// UnaryServer starts a server span per RPC, continuing the trace in the
+// incoming metadata's traceparent, or the span already on ctx when the
+// grpc-web bridge calls in-process. Put it first so the span covers every
+// other interceptor.
+func UnaryServer() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, MetadataCarrier(md))
+		}
+		service, method := splitMethod(info.FullMethod)
+		ctx, span := Tracer().Start(ctx, strings.TrimPrefix(info.FullMethod, "/"),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "grpc"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", method),
+			))
+		defer span.End()
+
+		resp, err := next(ctx, req)
+		code := status.Code(err)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+		if serverFault(code) {
+			span.SetStatus(codes.Error, code.String())
+		}
+		return resp, err
+	}
+}
+
+// serverFault is the semantic conventions' list of codes that mark a
+// server span failed; the rest (NotFound, InvalidArgument...) are the
+// caller's problem and a normal answer.
+func serverFault(c grpccodes.Code) bool {
+	switch c {
+	case grpccodes.Unknown, grpccodes.DeadlineExceeded, grpccodes.Unimplemented,
+		grpccodes.Internal, grpccodes.Unavailable, grpccodes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// "/appointment.v1.ScheduleService/CreateAppointment" ->
+// "appointment.v1.ScheduleService", "CreateAppointment"
+func splitMethod(full string) (string, string) {
+	full = strings.TrimPrefix(full, "/")
+	if i := strings.LastIndex(full, "/"); i >= 0 {
+		return full[:i], full[i+1:]
+	}
+	return "", full
+}
+
+// MetadataCarrier lets a propagator read and write grpc metadata.
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c MetadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c MetadataCarrier) Keys() []string {
+	out := make([]string, 0, len(c))
+	for k := range c {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/tracing"
+)
+
+func TestUnaryServer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(prevTP); otel.SetTextMapPropagator(prevProp) })
+
+	ic := tracing.UnaryServer()
+	info := &grpc.UnaryServerInfo{FullMethod: "/appointment.v1.ScheduleService/GetAppointment"}
+	md := metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	call := func(err error) sdktrace.ReadOnlySpan {
+		t.Helper()
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		ic(ctx, nil, info, func(context.Context, any) (any, error) { return nil, err })
+		spans := rec.Ended()
+		return spans[len(spans)-1]
+	}
+
+	s := call(status.Error(codes.NotFound, "gone"))
+	if s.Name() != "appointment.v1.ScheduleService/GetAppointment" {
+		t.Errorf("name %q", s.Name())
+	}
+	if s.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("didn't continue the metadata's trace: %s under %s", s.SpanContext().TraceID(), s.Parent().SpanID())
+	}
+	// the caller's mistake isn't the server failing
+	if s.Status().Code == otelcodes.Error {
+		t.Error("NotFound marked the span failed")
+	}
+	if s := call(status.Error(codes.Internal, "boom")); s.Status().Code != otelcodes.Error {
+		t.Error("Internal didn't mark the span failed")
+	}
+}
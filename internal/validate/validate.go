@@ -0,0 +1,132 @@
+// Package validate collects what's wrong with a request field by field and
+// reports all of it at once: one InvalidArgument status carrying a
+// google.rpc.BadRequest with a violation per field, next to the usual
+// apperr ErrorInfo. Field names are the proto (snake_case) names so a
+// client can map them straight onto its form. Descriptions are i18n
+// catalog keys, rendered in the caller's locale by apperr.Localize.
+package validate
+
+import (
+	"net/mail"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+)
+
+// Errors accumulates violations; the zero value is ready to use.
+type Errors struct {
+	reason     apperr.Reason
+	violations []violation
+}
+
+type violation struct {
+	field string
+	key   i18n.Key
+	args  []any
+}
+
+// Add records a problem with field, described by the catalog message key
+// with args.
+func (e *Errors) Add(field string, key i18n.Key, args ...any) {
+	e.AddReason(apperr.InvalidArgument, field, key, args...)
+}
+
+// AddReason is Add for a problem that has its own reason (APPT_PAST,
+// AUTH_PASSWORD_TOO_SHORT, ...). The error takes the reason of the first
+// violation, so check the fields in the order their reasons matter. r must
+// be an InvalidArgument reason.
+func (e *Errors) AddReason(r apperr.Reason, field string, key i18n.Key, args ...any) {
+	if len(e.violations) == 0 {
+		e.reason = r
+	}
+	e.violations = append(e.violations, violation{field: field, key: key, args: args})
+}
+
+// Required reports whether v is set, recording a violation if not.
+func (e *Errors) Required(field, v string) bool {
+	if v == "" {
+		e.Add(field, i18n.Required)
+		return false
+	}
+	return true
+}
+
+// MaxLen limits v to n characters (not bytes).
+func (e *Errors) MaxLen(field, v string, n int) {
+	if utf8.RuneCountInString(v) > n {
+		e.Add(field, i18n.MaxChars, n)
+	}
+}
+
+// Email checks v is a bare address: no display name, no angle brackets.
+func (e *Errors) Email(field, v string) {
+	if a, err := mail.ParseAddress(v); err != nil || a.Address != v {
+		e.Add(field, i18n.Email)
+	}
+}
+
+// Err is nil when nothing was recorded, otherwise the InvalidArgument
+// status with every violation attached, in English until localized.
+func (e *Errors) Err() error {
+	if len(e.violations) == 0 {
+		return nil
+	}
+	return &failure{reason: e.reason, violations: slices.Clone(e.violations)}
+}
+
+// failure is what Err returns: the violations stay keys until the status
+// is built, so it can be built in any locale.
+type failure struct {
+	reason     apperr.Reason
+	violations []violation
+}
+
+func (f *failure) Error() string { return f.GRPCStatus().Err().Error() }
+
+func (f *failure) GRPCStatus() *status.Status { return f.status(i18n.Default) }
+
+func (f *failure) Localize(locale string) error {
+	return apperr.Translated(f.status(locale), locale).Err()
+}
+
+func (f *failure) status(locale string) *status.Status {
+	fvs := make([]*errdetails.BadRequest_FieldViolation, len(f.violations))
+	msgs := make([]string, len(f.violations))
+	for i, v := range f.violations {
+		desc := i18n.T(locale, v.key, v.args...)
+		fvs[i] = &errdetails.BadRequest_FieldViolation{Field: v.field, Description: desc}
+		msgs[i] = v.field + ": " + desc
+	}
+	st := apperr.Status(f.reason, strings.Join(msgs, "; "))
+	if withBR, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: fvs}); err == nil {
+		st = withBR
+	}
+	return st
+}
+
+// Field is the error for a single bad field.
+func Field(field string, key i18n.Key, args ...any) error {
+	var e Errors
+	e.Add(field, key, args...)
+	return e.Err()
+}
+
+// Violations returns the field violations err carries, if any.
+func Violations(err error) []*errdetails.BadRequest_FieldViolation {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			return br.FieldViolations
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"schedule-management-api/internal/apperr"
+	"schedule-management-api/internal/i18n"
+)
+
+func TestErrors(t *testing.T) {
+	var v Errors
+	if v.Err() != nil {
+		t.Fatal("empty Errors is an error")
+	}
+	v.MaxLen("title", strings.Repeat("é", 3), 3) // characters, not bytes
+	v.Email("email", "ann@example.com")
+	if v.Err() != nil {
+		t.Fatalf("valid fields rejected: %v", v.Err())
+	}
+
+	v.Required("name", "")
+	v.Email("email", "Ann <ann@example.com>")
+	v.AddReason(apperr.ApptPast, "start_time", i18n.InPast)
+	err := v.Err()
+
+	st, _ := status.FromError(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Errorf("code %s", st.Code())
+	}
+	// the first violation picks the reason
+	if r := apperr.ReasonOf(err); r != apperr.InvalidArgument {
+		t.Errorf("reason %s", r)
+	}
+	if st.Message() != "name: required; email: not a valid email address; start_time: can't be in the past" {
+		t.Errorf("message %q", st.Message())
+	}
+	got := Violations(err)
+	if len(got) != 3 || got[0].Field != "name" || got[2].Field != "start_time" {
+		t.Errorf("violations %v", got)
+	}
+}
+
+func TestField(t *testing.T) {
+	err := Field("page_size", i18n.NotNegative)
+	if apperr.ReasonOf(err) != apperr.InvalidArgument || len(Violations(err)) != 1 {
+		t.Errorf("got %v", err)
+	}
+	if Violations(apperr.New(apperr.NotFound, "x")) != nil {
+		t.Error("violations on a plain error")
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	var v Errors
+	v.MaxLen("title", strings.Repeat("x", 201), 200)
+	v.AddReason(apperr.ApptPast, "start_time", i18n.InPast)
+	err := v.Err()
+
+	fr := apperr.Localize(err, "fr")
+	st, _ := status.FromError(fr)
+	if st.Message() != "title: 200 caractères au maximum; start_time: ne peut pas être dans le passé" {
+		t.Errorf("message %q", st.Message())
+	}
+	if got := Violations(fr); len(got) != 2 || got[0].Description != "200 caractères au maximum" {
+		t.Errorf("violations %v", got)
+	}
+	if st.Code() != codes.InvalidArgument || apperr.ReasonOf(fr) != apperr.InvalidArgument {
+		t.Errorf("code %s, reason %s", st.Code(), apperr.ReasonOf(fr))
+	}
+	// rendered once is rendered for good
+	if again := apperr.Localize(fr, "fr"); status.Convert(again).Message() != st.Message() {
+		t.Errorf("localized twice: %q", status.Convert(again).Message())
+	}
+
+	en := apperr.Localize(err, "en")
+	if got := status.Convert(en).Message(); got != status.Convert(err).Message() {
+		t.Errorf("en %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is returned for a webhook host that is, or resolves to, an
+// address off the public internet: loopback, link-local (cloud metadata
+// lives there), private, shared or reserved.
+var ErrNotPublic = errors.New("webhook address is not public")
+
+// ranges IsGlobalUnicast and IsPrivate let through but nobody outside
+// should be able to point us at
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 reaches IPv4 ones
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Public reports whether ip is a unicast address on the public internet.
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost resolves host (a name or a literal address) and fails with
+// ErrNotPublic if any of its addresses isn't public. It's for refusing a
+// URL up front; the dispatcher's client checks again at dial time, since
+// the name can resolve differently by then.
+func CheckHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !Public(ip) {
+			return ErrNotPublic
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !Public(ip) {
+			return ErrNotPublic
+		}
+	}
+	return nil
+}
+
+// newClient is the dispatcher's default client. Redirects aren't
+// followed, so a public URL can't bounce a delivery inwards, and unless
+// private is set every connection is refused whose address, as actually
+// dialed after DNS, isn't public.
+func newClient(private bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !private {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !Public(ap.Addr()) {
+				return fmt.Errorf("dial %s: %w", address, ErrNotPublic)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			// no proxy: it would do the dialing, past the check
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: requestTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
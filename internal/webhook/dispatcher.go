@@ -0,0 +1,252 @@
+// Package webhook sends queued appointment events to users' webhooks.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+const (
+	defaultInterval    = 10 * time.Second
+	defaultMaxAttempts = 8
+	defaultBaseBackoff = 30 * time.Second
+	defaultMaxBackoff  = time.Hour
+	requestTimeout     = 10 * time.Second
+	batchSize          = 50
+	// how long a claimed delivery is left alone; longer than a request can take
+	lease = 2 * requestTimeout
+)
+
+// Outbox is where deliveries are claimed from and reported back to
+// (store.Store).
+type Outbox interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	WebhookDelivered(ctx context.Context, id int64, status int) error
+	WebhookFailed(ctx context.Context, id int64, status int, msg string, retryAt *time.Time) error
+}
+
+type Dispatcher struct {
+	outbox      Outbox
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	onRun func(err error)
+}
+
+type Option func(*Dispatcher)
+
+// WithClient sends with c instead of a client with a 10s timeout that
+// only dials public addresses and doesn't follow redirects.
+func WithClient(c *http.Client) Option {
+	return func(d *Dispatcher) { d.client = c }
+}
+
+// WithPrivateAddresses lets deliveries reach loopback and private
+// addresses, for receivers on a developer's machine or network. Redirects
+// still aren't followed.
+func WithPrivateAddresses() Option {
+	return func(d *Dispatcher) { d.client = newClient(true) }
+}
+
+// WithInterval polls the outbox every interval (10s if zero).
+func WithInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		if interval > 0 {
+			d.interval = interval
+		}
+	}
+}
+
+// WithMaxAttempts gives up on a delivery after n failed attempts (8 if
+// zero).
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.maxAttempts = n
+		}
+	}
+}
+
+// WithBackoff waits base after the first failure, doubling per attempt up
+// to max (30s and 1h by default).
+func WithBackoff(base, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		if base > 0 {
+			d.baseBackoff = base
+		}
+		if max > 0 {
+			d.maxBackoff = max
+		}
+	}
+}
+
+func NewDispatcher(o Outbox, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		outbox:      o,
+		client:      newClient(false),
+		interval:    defaultInterval,
+		maxAttempts: defaultMaxAttempts,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// OnRun registers a callback for the end of every Tick, with the claim
+// error or the last reporting error, e.g. a diagnostics tracker. Failed
+// deliveries aren't errors here; they show on the webhook.
+func (d *Dispatcher) OnRun(fn func(err error)) {
+	d.onRun = fn
+}
+
+// Run sends deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		d.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Tick claims and sends everything currently due, a batch at a time, the
+// deliveries in a batch concurrently.
+func (d *Dispatcher) Tick(ctx context.Context) {
+	var (
+		mu     sync.Mutex
+		failed error
+	)
+	defer func() {
+		if d.onRun != nil {
+			d.onRun(failed)
+		}
+	}()
+	for ctx.Err() == nil {
+		due, err := d.outbox.ClaimWebhookDeliveries(ctx, batchSize, lease)
+		if err != nil {
+			log.Printf("webhooks: claim: %v", err)
+			failed = fmt.Errorf("claim: %w", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for _, del := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := d.deliver(ctx, del); err != nil {
+					log.Printf("webhooks: record delivery %d: %v", del.ID, err)
+					mu.Lock()
+					failed = fmt.Errorf("record %d: %w", del.ID, err)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends one delivery and reports how it went. The error is from
+// reporting, not sending.
+func (d *Dispatcher) deliver(ctx context.Context, del model.WebhookDelivery) error {
+	code, err := d.send(ctx, del)
+	if err == nil {
+		return d.outbox.WebhookDelivered(ctx, del.ID, code)
+	}
+	var retryAt *time.Time
+	if del.Attempts < d.maxAttempts {
+		t := time.Now().Add(d.backoff(del.Attempts))
+		retryAt = &t
+	}
+	return d.outbox.WebhookFailed(ctx, del.ID, code, err.Error(), retryAt)
+}
+
+// backoff is how long to wait after the attempts-th failure.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.baseBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.maxBackoff)
+}
+
+// send posts the payload, returning the response status (0 without one)
+// and an error for anything but a 2xx.
+func (d *Dispatcher) send(ctx context.Context, del model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "schedule-management-api-webhooks")
+	req.Header.Set("X-Webhook-Event", del.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(del.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(del.Secret, ts, del.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		log.Printf("webhooks: delivery %d: %v", del.ID, err)
+		return 0, sendFailure(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 == 2 {
+		return resp.StatusCode, nil
+	}
+	// the status only: the body, or a redirect's target, is the receiver's
+	// to show, and a webhook mustn't become a way to read internal pages
+	return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// sendFailure is what last_error says about a request that got no
+// response, without the dial details.
+func sendFailure(err error) error {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrNotPublic):
+		return errors.New("address not allowed")
+	case errors.As(err, &ne) && ne.Timeout():
+		return errors.New("timed out")
+	default:
+		return errors.New("no response")
+	}
+}
+
+// Sign is the hex HMAC-SHA256 of timestamp + "." + body under secret, what
+// X-Webhook-Signature carries after "sha256=". Receivers recompute it and
+// should reject stale timestamps to stop replays.
+func Sign(secret, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
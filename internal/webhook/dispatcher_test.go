@@ -0,0 +1,315 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"schedule-management-api/internal/model"
+)
+
+// fakeOutbox keeps deliveries the way the store would, except that a
+// retry is due on the next claim whatever its time.
+type fakeOutbox struct {
+	mu        sync.Mutex
+	rows      map[int64]*row
+	claimErr  error
+	reportErr error
+}
+
+type row struct {
+	del       model.WebhookDelivery
+	done      bool
+	gaveUp    bool
+	status    int
+	lastError string
+	retryAt   []time.Time
+}
+
+func newOutbox(dels ...model.WebhookDelivery) *fakeOutbox {
+	o := &fakeOutbox{rows: map[int64]*row{}}
+	for _, d := range dels {
+		o.rows[d.ID] = &row{del: d}
+	}
+	return o
+}
+
+func (o *fakeOutbox) ClaimWebhookDeliveries(_ context.Context, limit int, _ time.Duration) ([]model.WebhookDelivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.claimErr != nil {
+		return nil, o.claimErr
+	}
+	var out []model.WebhookDelivery
+	for id := int64(1); id <= int64(len(o.rows)) && len(out) < limit; id++ {
+		r := o.rows[id]
+		if r == nil || r.done || r.gaveUp || len(r.retryAt) < r.del.Attempts {
+			continue // finished, or claimed and not reported yet
+		}
+		r.del.Attempts++
+		out = append(out, r.del)
+	}
+	return out, nil
+}
+
+func (o *fakeOutbox) WebhookDelivered(_ context.Context, id int64, status int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := o.rows[id]
+	r.done, r.status = true, status
+	return o.reportErr
+}
+
+func (o *fakeOutbox) WebhookFailed(_ context.Context, id int64, status int, msg string, retryAt *time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r := o.rows[id]
+	r.status, r.lastError = status, msg
+	if retryAt == nil {
+		r.gaveUp = true
+	} else {
+		r.retryAt = append(r.retryAt, *retryAt)
+	}
+	return o.reportErr
+}
+
+func TestSignedDelivery(t *testing.T) {
+	payload := []byte(`{"event":"appointment.created","appointment_id":"a1"}`)
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	o := newOutbox(model.WebhookDelivery{ID: 1, URL: srv.URL, Secret: "s3cret", Event: "appointment.created", Payload: payload})
+	NewDispatcher(o, WithPrivateAddresses()).Tick(context.Background())
+
+	if got == nil {
+		t.Fatal("nothing posted")
+	}
+	if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("%s with %q", got.Method, got.Header.Get("Content-Type"))
+	}
+	if string(body) != string(payload) {
+		t.Errorf("body %s", body)
+	}
+	if got.Header.Get("X-Webhook-Event") != "appointment.created" || got.Header.Get("X-Webhook-Delivery") != "1" {
+		t.Errorf("headers %v", got.Header)
+	}
+	ts := got.Header.Get("X-Webhook-Timestamp")
+	if sec, err := strconv.ParseInt(ts, 10, 64); err != nil || time.Since(time.Unix(sec, 0)) > time.Minute {
+		t.Errorf("timestamp %q", ts)
+	}
+	// what a receiver would check
+	if want := "sha256=" + Sign("s3cret", ts, body); got.Header.Get("X-Webhook-Signature") != want {
+		t.Errorf("signature %q, want %q", got.Header.Get("X-Webhook-Signature"), want)
+	}
+	if got.Header.Get("X-Webhook-Signature") == "sha256="+Sign("other", ts, body) {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if r := o.rows[1]; !r.done || r.status != http.StatusNoContent {
+		t.Errorf("row %+v", r)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac key
+	if got := Sign("key", "1700000000", []byte("{}")); got != "9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae" {
+		t.Errorf("Sign = %q", got)
+	}
+	if Sign("key", "1", []byte("{}")) == Sign("key", "2", []byte("{}")) {
+		t.Error("timestamp not signed")
+	}
+}
+
+func TestRetryUntilDelivered(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	o := newOutbox(model.WebhookDelivery{ID: 1, URL: srv.URL, Secret: "s", Event: "appointment.updated", Payload: []byte(`{}`)})
+	d := NewDispatcher(o, WithPrivateAddresses(), WithBackoff(time.Minute, 10*time.Minute))
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		d.Tick(context.Background())
+		r := o.rows[1]
+		if i < 2 {
+			if r.done || r.status != http.StatusServiceUnavailable || r.lastError != "HTTP 503" {
+				t.Fatalf("attempt %d: %+v", i+1, r)
+			}
+			// 1m after the first failure, 2m after the second
+			wait := r.retryAt[i].Sub(start)
+			if want := time.Minute << i; wait < want || wait > want+time.Second {
+				t.Errorf("attempt %d: retry in %v, want %v", i+1, wait, want)
+			}
+		}
+	}
+	if r := o.rows[1]; !r.done || r.status != http.StatusOK || r.del.Attempts != 3 {
+		t.Errorf("after three attempts: %+v", r)
+	}
+	if calls != 3 {
+		t.Errorf("%d requests", calls)
+	}
+}
+
+func TestGiveUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	o := newOutbox(model.WebhookDelivery{ID: 1, URL: srv.URL, Secret: "s", Payload: []byte(`{}`)})
+	d := NewDispatcher(o, WithPrivateAddresses(), WithMaxAttempts(3))
+	for i := 0; i < 5; i++ {
+		d.Tick(context.Background())
+	}
+	if r := o.rows[1]; !r.gaveUp || len(r.retryAt) != 2 {
+		t.Errorf("row %+v", r)
+	}
+	if calls != 3 {
+		t.Errorf("%d requests, want 3", calls)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	o := newOutbox(model.WebhookDelivery{ID: 1, URL: url, Secret: "s", Payload: []byte(`{}`)})
+	NewDispatcher(o, WithPrivateAddresses()).Tick(context.Background())
+	if r := o.rows[1]; r.done || r.status != 0 || r.lastError == "" || len(r.retryAt) != 1 {
+		t.Errorf("row %+v", r)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, WithBackoff(time.Second, 10*time.Second))
+	var got []time.Duration
+	for n := 1; n <= 6; n++ {
+		got = append(got, d.backoff(n))
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("backoff %v, want %v", got, want)
+	}
+}
+
+func TestTickReportsErrors(t *testing.T) {
+	o := newOutbox()
+	o.claimErr = errors.New("db down")
+	d := NewDispatcher(o)
+	var runErr error
+	d.OnRun(func(err error) { runErr = err })
+	d.Tick(context.Background())
+	if runErr == nil {
+		t.Error("claim error not reported")
+	}
+
+	// a failed send alone isn't a run error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	o = newOutbox(model.WebhookDelivery{ID: 1, URL: srv.URL, Payload: []byte(`{}`)})
+	d = NewDispatcher(o, WithPrivateAddresses())
+	d.OnRun(func(err error) { runErr = err })
+	d.Tick(context.Background())
+	if runErr != nil {
+		t.Errorf("OnRun got %v", runErr)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.215.14":    true,
+		"2606:4700::6810":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"169.254.169.254":  false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"224.0.0.1":        false,
+	} {
+		if got := Public(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Public(%s) = %v", addr, got)
+		}
+	}
+	if err := CheckHost(context.Background(), "169.254.169.254"); !errors.Is(err, ErrNotPublic) {
+		t.Errorf("metadata address: %v", err)
+	}
+	if err := CheckHost(context.Background(), "localhost"); !errors.Is(err, ErrNotPublic) {
+		t.Errorf("localhost: %v", err)
+	}
+}
+
+// the default client won't dial loopback, whatever the URL says
+func TestRefusesPrivateAddresses(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer srv.Close()
+
+	o := newOutbox(model.WebhookDelivery{ID: 1, URL: srv.URL, Secret: "s", Payload: []byte(`{}`)})
+	NewDispatcher(o).Tick(context.Background())
+	if r := o.rows[1]; hit || r.done || r.status != 0 || r.lastError != "address not allowed" {
+		t.Errorf("hit %v, row %+v", hit, r)
+	}
+}
+
+// a redirect is a failed delivery, not followed, and nothing the receiver
+// sends back ends up in last_error
+func TestNoRedirectsOrBodies(t *testing.T) {
+	inner := false
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { inner = true }))
+	defer internal.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, internal.URL, http.StatusTemporaryRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "db password is hunter2")
+	}))
+	defer srv.Close()
+
+	o := newOutbox(
+		model.WebhookDelivery{ID: 1, URL: srv.URL + "/moved", Secret: "s", Payload: []byte(`{}`)},
+		model.WebhookDelivery{ID: 2, URL: srv.URL, Secret: "s", Payload: []byte(`{}`)},
+	)
+	NewDispatcher(o, WithPrivateAddresses()).Tick(context.Background())
+	if r := o.rows[1]; inner || r.done || r.status != http.StatusTemporaryRedirect || r.lastError != "HTTP 307" {
+		t.Errorf("redirect followed %v, row %+v", inner, r)
+	}
+	if r := o.rows[2]; r.status != http.StatusInternalServerError || r.lastError != "HTTP 500" {
+		t.Errorf("row %+v", r)
+	}
+}